@@ -0,0 +1,230 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/xshoji/go-img-diff/internal/batch"
+	"github.com/xshoji/go-img-diff/internal/core"
+	"github.com/xshoji/go-img-diff/internal/report"
+)
+
+// numCPU returns the CPU cores that batch jobs share; tests replace it.
+var numCPU = runtime.NumCPU
+
+// batchSummaryName is the aggregate report written into --out-dir unless
+// --json-report names another path.
+const batchSummaryName = "summary.json"
+
+// singlePairFlags are the outputs of one comparison, which batch mode does
+// not write (the diff image and JSON report of each pair go to --out-dir).
+var singlePairFlags = [][2]string{
+	{"oa", "output-a"}, {"ce", "crop-each"}, {"mk", "mask"}, {"hm", "heatmap"}, {"b", "blink"},
+	{"hr", "html-report"}, {"rc", "regions-csv"}, {"ob", "output-bundle"}, {"sa", "save-analysis"},
+	{"ds", "debug-score-surface"},
+}
+
+// batchMode reports whether --dir1, --dir2 or --manifest was given.
+func batchMode() bool {
+	return *optionDir1 != "" || *optionDir2 != "" || *optionManifest != ""
+}
+
+// validateBatchOptions checks the options of batch mode, which replace
+// --input1, --input2 and --output.
+func validateBatchOptions() error {
+	if *optionManifest != "" {
+		for _, f := range [][2]string{{"d1", "dir1"}, {"d2", "dir2"}, {"ou", "out-dir"}, {"cr", "compare-report"}} {
+			if isFlagSet(f[0], f[1]) {
+				return fmt.Errorf("--%s cannot be used with --manifest, which lists the inputs and outputs of every pair", f[1])
+			}
+		}
+	}
+	var missing []string
+	if *optionDir1 == "" && *optionManifest == "" {
+		missing = append(missing, "d1")
+	}
+	if *optionDir2 == "" && *optionManifest == "" {
+		missing = append(missing, "d2")
+	}
+	if *optionOutDir == "" && *optionManifest == "" && !*optionExitOnDiff {
+		missing = append(missing, "ou")
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("Missing required option(s) for batch mode: %s", strings.Join(missing, ", "))
+	}
+	for _, f := range singlePairFlags {
+		if isFlagSet(f[0], f[1]) {
+			return fmt.Errorf("--%s writes an output of a single pair and cannot be used in batch mode", f[1])
+		}
+	}
+	if *optionFailOnNewOnly && *optionCompareReport == "" {
+		return fmt.Errorf("--fail-on-new-only requires --compare-report")
+	}
+	if isFlagSet("fp", "fail-on") {
+		return fmt.Errorf("--fail-on applies to a single pair; use --max-failed-pairs and --max-pair-diff-percent in batch mode")
+	}
+	if _, err := parseGate(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// parseGate builds the batch gate from --max-failed-pairs ("N" or "N%"),
+// --max-pair-diff-percent and --fail-on-new-only.
+func parseGate() (report.Gate, error) {
+	gate := report.Gate{MaxPairDiffPercent: *optionMaxPairDiffPercent, NewOnly: *optionFailOnNewOnly}
+	s := strings.TrimSpace(*optionMaxFailedPairs)
+	if p, ok := strings.CutSuffix(s, "%"); ok {
+		v, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil || v < 0 || v > 100 {
+			return gate, fmt.Errorf("invalid --max-failed-pairs '%s': the percentage must be between 0 and 100", s)
+		}
+		gate.MaxFailedPercent = v
+		return gate, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < 0 {
+		return gate, fmt.Errorf("invalid --max-failed-pairs '%s': must be a non-negative count or a percentage such as 10%%", s)
+	}
+	gate.MaxFailedPairs = v
+	return gate, nil
+}
+
+// runBatch compares every pair of images of --dir1 and --dir2, or of
+// --manifest, and returns the process exit status. If any pair could not be
+// compared, including files found in only one directory, it is exitCodeError
+// whatever the gate says; pairs left out by --fail-fast do not count. Otherwise
+// the gate decides between exitCodeDiff with --exit-on-diff and exitCodeOK. If
+// the pairs cannot be listed at all, it is exitCodeError.
+func runBatch(opts core.Options, logger *slog.Logger) (int, error) {
+	gate, _ := parseGate() // validated by validateBatchOptions
+	var listing *batch.Listing
+	var err error
+	if *optionManifest != "" {
+		// Pairs without an output are only checked, as with -e for one pair.
+		listing, err = batch.ReadManifest(*optionManifest, opts.Diff.Metric, !*optionExitOnDiff)
+	} else {
+		listing, err = batch.Match(*optionDir1, *optionDir2)
+	}
+	if err != nil {
+		return exitCodeError, err
+	}
+
+	if *optionOutDir != "" {
+		if err := os.MkdirAll(*optionOutDir, 0o755); err != nil {
+			return exitCodeError, fmt.Errorf("failed to create output directory: %w", err)
+		}
+	}
+
+	jobs := *optionJobs
+	if jobs <= 0 {
+		jobs = opts.Runtime.Workers
+	}
+	jobs = max(1, min(jobs, len(listing.Pairs)))
+	cores := numCPU()
+	perJob, adjusted := opts.Runtime.Workers, false
+	switch {
+	case *optionOversubscribe:
+		if jobs*perJob > cores {
+			con.Warnf("%d job(s) with %d worker(s) each oversubscribe the %d CPU core(s).", jobs, perJob, cores)
+		}
+	default:
+		if perJob, adjusted = core.WorkersPerJob(jobs, opts.Runtime.Workers, cores); adjusted && isFlagSet("jb", "jobs", "c", "cpu") {
+			con.Warnf("%d job(s) with %d worker(s) each would oversubscribe the %d CPU core(s); using %d worker(s) per pair (--oversubscribe keeps --cpu).", jobs, opts.Runtime.Workers, cores, perJob)
+		}
+	}
+	opts.Runtime.Workers = perJob
+	con.Infof("Comparing %d pair(s), %d at a time with %d worker(s) each.", len(listing.Pairs), jobs, perJob)
+
+	var mu sync.Mutex
+	results := batch.Run(listing.Pairs, batch.Options{Compare: opts, OutDir: *optionOutDir, PreviousDir: *optionCompareReport, Jobs: jobs, FailFast: *optionFailFast}, logger, func(r batch.PairResult) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch s := r.Summary(); {
+		case r.Err != nil:
+			con.Errorf("%s: %v", r.Name, r.Err)
+		case s.HasDiff:
+			con.Printf("[DIFF] %s: %.4f%% differing, %d region(s)", r.Name, s.DiffPercent, len(r.Report.Regions))
+		default:
+			con.Printf("[SAME] %s", r.Name)
+		}
+	})
+	skipped := countSkipped(results)
+	if skipped > 0 {
+		con.Printf("Stopped after the first failing pair (--fail-fast); %d pair(s) not compared.", skipped)
+	}
+	for _, name := range listing.OnlyIn1 {
+		con.Printf("[MISSING] %s: %s", name, report.MissingError(listing.Dir2))
+	}
+	for _, name := range listing.OnlyIn2 {
+		con.Printf("[MISSING] %s: %s", name, report.MissingError(listing.Dir1))
+	}
+
+	rep := listing.Report(results, gate)
+	rep.Jobs, rep.WorkersPerJob, rep.WorkersAdjusted, rep.Cores = jobs, perJob, adjusted, cores
+	if listing.Manifest != "" {
+		con.Printf("Batch: %d pair(s) compared, %d with differences, %d failed",
+			rep.PairsCompared, rep.PairsWithDiff, len(results)-rep.PairsCompared)
+	} else {
+		con.Printf("Batch: %d pair(s) compared, %d with differences, %d only in %s, %d only in %s",
+			rep.PairsCompared, rep.PairsWithDiff, len(rep.OnlyInDir1), listing.Dir1, len(rep.OnlyInDir2), listing.Dir2)
+	}
+
+	path := *optionJSONReport
+	if path == "" && *optionOutDir != "" {
+		path = filepath.Join(*optionOutDir, batchSummaryName)
+	}
+	if path != "" {
+		if err := rep.Save(path, outputWriteMode()); err != nil {
+			return exitCodeError, err
+		}
+		con.Printf("Batch report saved to %s", path)
+	}
+
+	if !rep.Gate.Passed {
+		for _, line := range rep.Gate.Tripped() {
+			con.Printf("Gate %s", line)
+		}
+	}
+	if errored := countErrored(rep.Pairs) - skipped; errored > 0 {
+		con.Infof("%d pair(s) could not be compared. Exiting with status code %d.", errored, exitCodeError)
+		return exitCodeError, nil
+	}
+	if !rep.Gate.Passed {
+		if *optionExitOnDiff {
+			con.Infof("The batch failed the gate. Exiting with status code %d.", exitCodeDiff)
+			return exitCodeDiff, nil
+		}
+	}
+	return exitCodeOK, nil
+}
+
+// countErrored returns the number of pairs that could not be compared,
+// including those skipped by --fail-fast.
+func countErrored(pairs []report.PairSummary) int {
+	n := 0
+	for _, p := range pairs {
+		if p.Error != "" {
+			n++
+		}
+	}
+	return n
+}
+
+// countSkipped returns the number of pairs left uncompared by --fail-fast.
+func countSkipped(results []batch.PairResult) int {
+	n := 0
+	for _, r := range results {
+		if errors.Is(r.Err, batch.ErrSkipped) {
+			n++
+		}
+	}
+	return n
+}
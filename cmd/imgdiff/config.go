@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// configExcluded are the flags that cannot be set from a config file.
+var configExcluded = map[string]bool{"config": true, "print-config": true, "version": true}
+
+// shortName returns the short alias of a long flag, as recorded in its usage.
+func shortName(f *flag.Flag) string {
+	return strings.Split(f.Usage, UsageDummy)[0]
+}
+
+// isLongFlag reports whether f is the long name of an option; short aliases
+// carry UsageDummy alone as their usage.
+func isLongFlag(f *flag.Flag) bool {
+	return f.Usage != UsageDummy
+}
+
+// loadConfig applies the config file at path to fs; see applyConfig.
+func loadConfig(fs *flag.FlagSet, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config: %w", err)
+	}
+	return applyConfig(fs, data, path)
+}
+
+// applyConfig sets the options of a JSON object keyed by long option names,
+// such as {"diff-threshold": 20, "ignore-rect": ["0,0,200,40"]}, on fs.
+// Options given on the command line take precedence and are left untouched;
+// options in neither keep their defaults. Values are strings, numbers,
+// booleans, or arrays of strings for repeatable options, and are parsed like
+// command-line values, so they are range-checked by the same validation.
+// name prefixes the errors.
+func applyConfig(fs *flag.FlagSet, data []byte, name string) error {
+	var values map[string]json.RawMessage
+	if err := json.Unmarshal(data, &values); err != nil {
+		return fmt.Errorf("%s: the config must be a JSON object of option names and values: %w", name, err)
+	}
+
+	explicit := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		f := fs.Lookup(key)
+		switch {
+		case f == nil:
+			return fmt.Errorf("%s: unknown option '%s'", name, key)
+		case !isLongFlag(f):
+			return fmt.Errorf("%s: use the long name of option '%s'%s", name, key, longNameHint(fs, key))
+		case configExcluded[key]:
+			return fmt.Errorf("%s: option '%s' cannot be set in a config file", name, key)
+		case explicit[key] || explicit[shortName(f)]:
+			continue
+		}
+		if err := setConfigValue(fs, f, values[key]); err != nil {
+			return fmt.Errorf("%s: invalid value %s for '%s': %w", name, values[key], key, err)
+		}
+	}
+	return nil
+}
+
+// longNameHint names the long option whose short alias is short, if any.
+func longNameHint(fs *flag.FlagSet, short string) string {
+	hint := ""
+	fs.VisitAll(func(f *flag.Flag) {
+		if isLongFlag(f) && shortName(f) == short {
+			hint = fmt.Sprintf(" ('%s')", f.Name)
+		}
+	})
+	return hint
+}
+
+// setConfigValue sets f from a JSON value, as if given on the command line.
+func setConfigValue(fs *flag.FlagSet, f *flag.Flag, raw json.RawMessage) error {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return err
+	}
+	var args []string
+	switch v := v.(type) {
+	case string:
+		args = []string{v}
+	case json.Number:
+		args = []string{v.String()}
+	case bool:
+		args = []string{strconv.FormatBool(v)}
+	case []any:
+		if _, ok := f.Value.(*listValue); !ok {
+			return fmt.Errorf("only repeatable options take an array")
+		}
+		for _, e := range v {
+			s, ok := e.(string)
+			if !ok {
+				return fmt.Errorf("array elements must be strings, got %v", e)
+			}
+			args = append(args, s)
+		}
+	default:
+		return fmt.Errorf("expected a string, number or boolean, got %s", raw)
+	}
+	for _, a := range args {
+		if err := fs.Set(f.Name, a); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeConfig writes the effective value of every option of fs, merged from
+// defaults, the config file and the command line, as a config file.
+func writeConfig(w io.Writer, fs *flag.FlagSet) error {
+	values := map[string]any{}
+	fs.VisitAll(func(f *flag.Flag) {
+		if !isLongFlag(f) || configExcluded[f.Name] {
+			return
+		}
+		if g, ok := f.Value.(flag.Getter); ok {
+			values[f.Name] = g.Get()
+		} else {
+			values[f.Name] = f.Value.String()
+		}
+	})
+	data, err := json.MarshalIndent(values, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode config: %w", err)
+	}
+	_, err = fmt.Fprintf(w, "%s\n", data)
+	return err
+}
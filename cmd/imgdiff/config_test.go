@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testFlags is a flag set registered like the options of main, each under a
+// long and a short name.
+type testFlags struct {
+	fs        *flag.FlagSet
+	threshold *int
+	alpha     *float64
+	layout    *string
+	quiet     *bool
+	rects     *listValue
+}
+
+func newTestFlags() *testFlags {
+	fs := flag.NewFlagSet("imgdiff", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	tf := &testFlags{fs: fs, rects: &listValue{}}
+	tf.threshold = fs.Int("diff-threshold", 30, "d"+UsageDummy+"threshold")
+	fs.IntVar(tf.threshold, "d", 30, UsageDummy)
+	tf.alpha = fs.Float64("overlay-transparency", 0.95, "ot"+UsageDummy+"transparency")
+	fs.Float64Var(tf.alpha, "ot", 0.95, UsageDummy)
+	tf.layout = fs.String("layout", "simple", "l"+UsageDummy+"layout")
+	fs.StringVar(tf.layout, "l", "simple", UsageDummy)
+	tf.quiet = fs.Bool("quiet", false, "q"+UsageDummy+"quiet")
+	fs.BoolVar(tf.quiet, "q", false, UsageDummy)
+	fs.Var(tf.rects, "ignore-rect", "ir"+UsageDummy+"rects")
+	fs.Var(tf.rects, "ir", UsageDummy)
+	fs.String("config", "", "cf"+UsageDummy+"config")
+	fs.Bool("print-config", false, "pc"+UsageDummy+"print")
+	return tf
+}
+
+func TestApplyConfig_Precedence(t *testing.T) {
+	config := `{"diff-threshold": 20, "overlay-transparency": 0.5, "quiet": true, "ignore-rect": ["0,0,10,10", "5,5,1,1"]}`
+	tests := []struct {
+		name      string
+		args      []string
+		threshold int
+		alpha     float64
+		layout    string
+		rects     []string
+	}{
+		{"file overrides defaults", nil, 20, 0.5, "simple", []string{"0,0,10,10", "5,5,1,1"}},
+		{"long flag overrides file", []string{"--diff-threshold", "40"}, 40, 0.5, "simple", []string{"0,0,10,10", "5,5,1,1"}},
+		{"short flag overrides file", []string{"-ot", "0.1", "-l", "horizontal"}, 20, 0.1, "horizontal", []string{"0,0,10,10", "5,5,1,1"}},
+		{"repeatable flag replaces the file list", []string{"-ir", "1,1,2,2"}, 20, 0.5, "simple", []string{"1,1,2,2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tf := newTestFlags()
+			if err := tf.fs.Parse(tt.args); err != nil {
+				t.Fatal(err)
+			}
+			if err := applyConfig(tf.fs, []byte(config), "c.json"); err != nil {
+				t.Fatal(err)
+			}
+			if *tf.threshold != tt.threshold || *tf.alpha != tt.alpha || *tf.layout != tt.layout || !*tf.quiet {
+				t.Errorf("threshold=%d alpha=%v layout=%s quiet=%v, want %d %v %s true", *tf.threshold, *tf.alpha, *tf.layout, *tf.quiet, tt.threshold, tt.alpha, tt.layout)
+			}
+			if !reflect.DeepEqual([]string(*tf.rects), tt.rects) {
+				t.Errorf("ignore rects = %q, want %q", *tf.rects, tt.rects)
+			}
+		})
+	}
+}
+
+func TestApplyConfig_Errors(t *testing.T) {
+	tests := []struct {
+		name, config, want string
+	}{
+		{"not an object", `["diff-threshold"]`, "c.json: the config must be a JSON object of option names and values"},
+		{"unknown option", `{"diff-treshold": 20}`, "c.json: unknown option 'diff-treshold'"},
+		{"short name", `{"d": 20}`, "c.json: use the long name of option 'd' ('diff-threshold')"},
+		{"nested config", `{"config": "other.json"}`, "c.json: option 'config' cannot be set in a config file"},
+		{"wrong type", `{"diff-threshold": "high"}`, `c.json: invalid value "high" for 'diff-threshold'`},
+		{"fractional int", `{"diff-threshold": 2.5}`, "c.json: invalid value 2.5 for 'diff-threshold'"},
+		{"array for a single value", `{"layout": ["simple"]}`, "only repeatable options take an array"},
+		{"null", `{"quiet": null}`, "expected a string, number or boolean, got null"},
+		{"non-string element", `{"ignore-rect": [1]}`, "array elements must be strings, got 1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := applyConfig(newTestFlags().fs, []byte(tt.config), "c.json")
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("applyConfig() = %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteConfig_RoundTrip(t *testing.T) {
+	tf := newTestFlags()
+	if err := tf.fs.Parse([]string{"-d", "12", "-ir", "0,0,4,4", "--config", "c.json"}); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := writeConfig(&buf, tf.fs); err != nil {
+		t.Fatal(err)
+	}
+	want := `{
+  "diff-threshold": 12,
+  "ignore-rect": [
+    "0,0,4,4"
+  ],
+  "layout": "simple",
+  "overlay-transparency": 0.95,
+  "quiet": false
+}
+`
+	if buf.String() != want {
+		t.Errorf("writeConfig() =\n%s\nwant\n%s", buf.String(), want)
+	}
+
+	// The printed config reproduces the options.
+	other := newTestFlags()
+	if err := applyConfig(other.fs, buf.Bytes(), "printed.json"); err != nil {
+		t.Fatal(err)
+	}
+	if *other.threshold != 12 || !reflect.DeepEqual(*other.rects, *tf.rects) {
+		t.Errorf("threshold=%d rects=%q after applying the printed config", *other.threshold, *other.rects)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+
+	"github.com/xshoji/go-img-diff/internal/progress"
+)
+
+// verbosity is the amount of console output, chosen with --quiet and --verbose.
+type verbosity int
+
+const (
+	verbosityQuiet   verbosity = iota // errors only
+	verbosityNormal                   // warnings and the summary of the comparison
+	verbosityVerbose                  // also the options, stage progress and details
+)
+
+// console prints the lines of the command at its verbosity. Results go to
+// out so that they can be piped; warnings, errors, details and progress go
+// to err.
+type console struct {
+	out, err io.Writer
+	level    verbosity
+	events   io.Writer // err without the --log-timestamps prefix, for JSON progress
+}
+
+// con is the console of the command; --log-timestamps wraps its writers to
+// prefix every line.
+var con = &console{out: os.Stdout, err: os.Stderr, level: verbosityNormal}
+
+// Printf prints a result line, such as the summary or a saved output path.
+func (c *console) Printf(format string, args ...any) {
+	if c.level >= verbosityNormal {
+		fmt.Fprintf(c.out, format+"\n", args...)
+	}
+}
+
+// Warnf prints a warning about the options or the result.
+func (c *console) Warnf(format string, args ...any) {
+	if c.level >= verbosityNormal {
+		fmt.Fprintf(c.err, "[WARNING] "+format+"\n", args...)
+	}
+}
+
+// Infof prints a detail that only --verbose shows.
+func (c *console) Infof(format string, args ...any) {
+	if c.level >= verbosityVerbose {
+		fmt.Fprintf(c.err, "[INFO] "+format+"\n", args...)
+	}
+}
+
+// Errorf prints an error, whatever the verbosity.
+func (c *console) Errorf(format string, args ...any) {
+	fmt.Fprintf(c.err, "[ERROR] "+format+"\n", args...)
+}
+
+// Verbose reports whether details are printed.
+func (c *console) Verbose() bool {
+	return c.level >= verbosityVerbose
+}
+
+// LogLevel returns the level of the pipeline log matching the verbosity:
+// its informational records are details, its warnings are warnings.
+func (c *console) LogLevel() slog.Level {
+	switch c.level {
+	case verbosityQuiet:
+		return slog.LevelError
+	case verbosityVerbose:
+		return slog.LevelInfo
+	}
+	return slog.LevelWarn
+}
+
+// Progress returns the reporter of the pipeline stages, which only prints
+// with --verbose.
+func (c *console) Progress() progress.Reporter {
+	if c.Verbose() {
+		return progress.NewText(c.err)
+	}
+	return progress.Silent{}
+}
+
+// JSON returns the --progress-format json reporter, which prints whatever
+// the verbosity so that wrappers can pass --quiet.
+func (c *console) JSON() *progress.JSON {
+	return progress.NewJSON(c.events)
+}
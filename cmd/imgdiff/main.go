@@ -1,24 +1,32 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
+	"image"
 	"image/color"
 	"log/slog"
+	"math"
 	"os"
 	"path/filepath"
 	"runtime"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/xshoji/go-img-diff/internal/analysis"
 	"github.com/xshoji/go-img-diff/internal/app"
 	"github.com/xshoji/go-img-diff/internal/core"
+	"github.com/xshoji/go-img-diff/internal/doctor"
+	"github.com/xshoji/go-img-diff/internal/inspect"
+	"github.com/xshoji/go-img-diff/internal/progress"
+	"github.com/xshoji/go-img-diff/internal/render"
+	"github.com/xshoji/go-img-diff/internal/report"
 )
 
-// version is set at build time via ldflags.
-var version = "dev"
-
 const (
 	Req        = "\033[33m(required)\033[0m "
 	UsageDummy = "########"
@@ -31,26 +39,76 @@ var (
 	optionImageInput1 = defineFlagValue("i1", "input1", Req+"First image path", "", flag.String, flag.StringVar)
 	optionImageInput2 = defineFlagValue("i2", "input2", Req+"Second image path", "", flag.String, flag.StringVar)
 	optionOutput      = defineFlagValue("o", "output", Req+"Output diff image path", "", flag.String, flag.StringVar)
+	optionOutputA     = defineFlagValue("oa", "output-a", "Also write a copy of the first image with the diff regions mapped onto it through the inverse offset", "", flag.String, flag.StringVar)
+	optionCropOutput  = defineFlagValue("co", "crop-output", "Crop the output to the union of the diff regions plus --crop-margin (the full image is kept without regions)", false, flag.Bool, flag.BoolVar)
+	optionCropMargin  = defineFlagValue("cg", "crop-margin", "Pixels added on every side of the --crop-output and --crop-each crops", 50, flag.Int, flag.IntVar)
+	optionCropEach    = defineFlagValue("ce", "crop-each", "Write one crop of the diff image per region to the given directory (region-001.png, ...)", "", flag.String, flag.StringVar)
 
 	// Alignment
-	optionMaxOffset  = defineFlagValue("m", "max-offset", "Maximum pixel offset to search for alignment", 10, flag.Int, flag.IntVar)
-	optionStripWidth = defineFlagValue("sw", "strip-width", "Width of each vertical strip used for local DP realignment", 320, flag.Int, flag.IntVar)
+	optionMaxOffset           = defineFlagValue("m", "max-offset", "Maximum pixel offset to search for alignment on both axes", 10, flag.Int, flag.IntVar)
+	optionMaxOffsetX          = defineFlagValue("mx", "max-offset-x", "Maximum horizontal pixel offset to search (0 disables horizontal search, -1 uses --max-offset)", -1, flag.Int, flag.IntVar)
+	optionMaxOffsetY          = defineFlagValue("my", "max-offset-y", "Maximum vertical pixel offset to search (0 disables vertical search, -1 uses --max-offset)", -1, flag.Int, flag.IntVar)
+	optionForcedOffset        = defineFlagValue("fo", "offset", "Use this offset as X,Y (e.g. 0,-12) instead of searching for one; cannot be combined with -m/-mx/-my", "", flag.String, flag.StringVar)
+	optionMinConfidence       = defineFlagValue("mc", "min-confidence", "Warn when the alignment confidence (runner-up error / best error, 1.0=ambiguous) is below this value (0 disables)", 1.2, flag.Float64, flag.Float64Var)
+	optionMaxAcceptableOffset = defineFlagValue("ma", "max-acceptable-offset", "Fail with status code 3 if the detected offset magnitude exceeds this value (0 disables)", 0, flag.Int, flag.IntVar)
+	optionMaxAspectFactor     = defineFlagValue("af", "max-aspect-factor", "Aspect ratio difference factor beyond which a 90 degree rotation of the first image is tried (0 disables)", 1.5, flag.Float64, flag.Float64Var)
+	optionStrictDimensions    = defineFlagValue("sd", "strict-dimensions", "Fail instead of rotating when aspect ratios differ beyond max-aspect-factor", false, flag.Bool, flag.BoolVar)
+	optionSizeMismatch        = defineFlagValue("sm", "size-mismatch", "How to compare images of different sizes: 'warn' (compare as they are), 'error' (exit with status code 2) or 'pad' (extend both to the larger width and height)", "warn", flag.String, flag.StringVar)
+	optionPadColor            = defineFlagValue("pb", "pad-color", "With --size-mismatch pad, the R,G,B or R,G,B,A color of the padding", "255,255,255", flag.String, flag.StringVar)
+	optionPadIgnore           = defineFlagValue("pi", "pad-ignore", "With --size-mismatch pad, exclude the padding from alignment and diff detection", false, flag.Bool, flag.BoolVar)
+	optionAutoScale           = defineFlagValue("au", "auto-scale", "When the image sizes differ by the same simple ratio in both axes (e.g. 2 for a high density capture), downsample the larger image with a box filter first; other size differences exit with status code 2", false, flag.Bool, flag.BoolVar)
+	optionAlignStrategy       = defineFlagValue("as", "align-strategy", "Alignment search: 'pyramid' (coarse-to-fine over downscaled images) or 'exhaustive' (every offset at full resolution)", "pyramid", flag.String, flag.StringVar)
+	optionAlignMetric         = defineFlagValue("me", "metric", "Alignment score: 'mae' (mean absolute luminance error) or 'ssim' (structural similarity, robust to global brightness changes; also reported as a quality number)", "mae", flag.String, flag.StringVar)
+	optionSearchStrategy      = defineFlagValue("ss", "search-strategy", "Offset search order: 'full' (every offset) or 'spiral' (rings outward from the predicted offset, stopping once a ring does not improve)", "full", flag.String, flag.StringVar)
+	optionSpiralEpsilon       = defineFlagValue("se", "spiral-epsilon", "Minimum alignment score gain (0.0-1.0) for the spiral search to expand another ring", 0.0, flag.Float64, flag.Float64Var)
+	optionStripWidth          = defineFlagValue("sw", "strip-width", "Width of each vertical strip used for local DP realignment", 320, flag.Int, flag.IntVar)
+	optionDetectScroll        = defineFlagValue("sc", "detect-scroll", "Match whole rows by their content instead of realigning strips, and report rows only one image has as inserted or deleted bands instead of pixel differences", false, flag.Bool, flag.BoolVar)
+	optionLocalAlign          = defineFlagValue("la", "local-align", "Re-align each large diff region by its own offset search and suppress it if it then matches", false, flag.Bool, flag.BoolVar)
+	optionLocalAlignRadius    = defineFlagValue("lr", "local-align-radius", "Search radius in pixels around the global offset for --local-align", 5, flag.Int, flag.IntVar)
+	optionLocalAlignMinArea   = defineFlagValue("lm", "local-align-min-area", "Minimum bounding box area in pixels of a region re-aligned by --local-align", 400, flag.Int, flag.IntVar)
 
 	// Diff
-	optionThreshold       = defineFlagValue("d", "diff-threshold", "Color difference threshold (0-255)", 30, flag.Int, flag.IntVar)
+	optionThreshold       = defineFlagValue("d", "diff-threshold", "Color difference threshold: 0-255 per channel for --color-metric rgb, 0-100 delta E for ciede2000 (default 5 there), or a percentage of that range such as 12%", "30", flag.String, flag.StringVar)
+	optionThresholdRGBA   = defineFlagValue("tr", "threshold-rgba", "Separate R,G,B,A thresholds (0-255 each, e.g. 20,40,40,0) for --color-metric rgb: a pixel differs if any channel exceeds its own", "", flag.String, flag.StringVar)
+	optionIgnoreAlpha     = defineFlagValue("na", "ignore-alpha", "Treat all pixels as opaque: compare colors only, not transparency", false, flag.Bool, flag.BoolVar)
+	optionColorMetric     = defineFlagValue("cm", "color-metric", "Pixel color difference: 'rgb' (largest channel difference) or 'ciede2000' (perceptual delta E in CIELAB)", "rgb", flag.String, flag.StringVar)
 	optionNoiseWindowSize = defineFlagValue("nw", "noise-window-size", "Local window size for sparse-noise filtering (0 disables)", 0, flag.Int, flag.IntVar)
 	optionNoiseMinRatio   = defineFlagValue("nr", "noise-min-ratio", "Minimum diff density in the local window to keep a diff pixel (0.0-1.0)", 0.0, flag.Float64, flag.Float64Var)
+	optionDespeckle       = defineFlagValue("sp", "despeckle", "Remove diff specks and lines narrower than 2N+1 pixels by a morphological opening of radius N before grouping (0 disables)", 0, flag.Int, flag.IntVar)
+	optionClose           = defineFlagValue("cl", "close", "Fill holes and gaps in the diff up to 2N pixels wide by a morphological closing of radius N before grouping (0 disables)", 0, flag.Int, flag.IntVar)
+	optionGrayscale       = defineFlagValue("gs", "grayscale", "Compare only the luminance (ITU-R BT.601) of the pixels, ignoring color casts; the output keeps the original colors", false, flag.Bool, flag.BoolVar)
+	optionNormalize       = defineFlagValue("nz", "normalize", "Match the mean and standard deviation of each color channel of the first image to the second before comparing, ignoring uniform brightness and contrast shifts; the output keeps the original colors", false, flag.Bool, flag.BoolVar)
+	optionIgnoreAA        = defineFlagValue("ia", "ignore-antialiasing", "Ignore differing pixels that look like anti-aliased edges in either image (e.g. text with different font hinting)", false, flag.Bool, flag.BoolVar)
+	optionMaxDiffRatio    = defineFlagValue("mr", "max-diff-ratio", "Fraction of compared pixels allowed to differ before the images count as different (e.g. 0.001; 0 = none)", 0.0, flag.Float64, flag.Float64Var)
+	optionMaxDiffPixels   = defineFlagValue("mp", "max-diff-pixels", "Number of differing pixels allowed before the images count as different (0 = none)", 0, flag.Int, flag.IntVar)
+	optionHistogramOnly   = defineFlagValue("hs", "histogram-only", "Compare only the color histograms of the images, skipping alignment and diff detection: exit with status code 1 if their chi-square distance exceeds --histogram-max-distance (no diff image)", false, flag.Bool, flag.BoolVar)
+	optionHistogramMax    = defineFlagValue("hd", "histogram-max-distance", "Chi-square histogram distance (0.0-1.0) above which --histogram-only reports the images as different", 0.01, flag.Float64, flag.Float64Var)
+	optionPHashPrefilter  = defineFlagValue("ph", "phash-prefilter", "Report images of the same size with equal perceptual hashes (dHash) as identical without comparing them", false, flag.Bool, flag.BoolVar)
+	optionVerifyClean     = defineFlagValue("vc", "verify-clean", "When the noise filter leaves no differences, re-check without it and report any it removed", false, flag.Bool, flag.BoolVar)
+	optionIgnoreMask      = defineFlagValue("im", "ignore-mask", "Mask image marking areas of the second image to ignore: non-transparent pixels, or white pixels if the mask is opaque", "", flag.String, flag.StringVar)
+	optionROI             = defineFlagValue("ro", "roi", "Compare only this area of both images, as X,Y,W,H (e.g. 0,200,800,400); the diff image still shows the whole second image", "", flag.String, flag.StringVar)
+	optionIgnoreRects     = defineListFlag("ir", "ignore-rect", "Area of the second image to ignore as X,Y,W,H (e.g. 0,0,200,40); may be given multiple times")
 	optionMinRegionArea   = defineFlagValue("ra", "min-region-area", "Minimum diff region area to keep (higher values ignore tiny differences)", 4, flag.Int, flag.IntVar)
+	optionMinRegionPixels = defineFlagValue("px", "min-region-pixels", "Drop diff regions with fewer differing pixels than this after merging, listing them as suppressed in the JSON report (0 keeps all)", 0, flag.Int, flag.IntVar)
+	optionMaxRegions      = defineFlagValue("rn", "max-regions", "Keep only this many diff regions, the most severe, reporting how many were dropped (0 = unlimited)", 0, flag.Int, flag.IntVar)
+	optionConnectDistance = defineFlagValue("rd", "region-connect-distance", "Join diff pixels up to this many pixels apart into one region (1 = touching pixels only)", 1, flag.Int, flag.IntVar)
+	optionRegionPadding   = defineFlagValue("rp", "region-padding", "Pixels of padding added around each diff region's bounding box", 5, flag.Int, flag.IntVar)
+	optionMinRegionSize   = defineFlagValue("rs", "min-region-size", "Grow diff region boxes narrower or shorter than this many pixels (0 disables)", 0, flag.Int, flag.IntVar)
+	optionMergeDistance   = defineFlagValue("md", "merge-distance", "Merge padded diff region boxes up to this many pixels apart (0 = overlapping or adjacent boxes only)", 0, flag.Int, flag.IntVar)
+	optionTileSize        = defineFlagValue("tl", "tile-size", "Group diff pixels into regions in tiles of this many pixels square to bound memory on very large images (0 = whole image)", 0, flag.Int, flag.IntVar)
+	optionOutline         = defineFlagValue("ol", "outline", "Region outline: 'box' (bounding box) or 'contour' (polygons following the differing pixels, also listed in the JSON report)", "box", flag.String, flag.StringVar)
+	optionContourEpsilon  = defineFlagValue("oe", "contour-epsilon", "With --outline contour, the largest distance in pixels by which the simplified polygons may deviate from the traced boundary (0 keeps every corner)", 1.0, flag.Float64, flag.Float64Var)
 
 	// Runtime
-	optionNumCPU = defineFlagValue("c", "cpu", "Number of CPU cores to use for parallel processing", runtime.NumCPU(), flag.Int, flag.IntVar)
+	optionNumCPU = defineFlagValue("c", "cpu", "Number of CPU cores to use for parallel processing (0 = all available cores)", runtime.NumCPU(), flag.Int, flag.IntVar)
 
 	// Precise mode (disables pyramid multi-scale, uses single-scale brute force)
 	optionPreciseMode = defineFlagValue("p", "precise", "Enable precise mode (larger pyramid min-size for more accurate comparison)", false, flag.Bool, flag.BoolVar)
 
 	// Overlay
-	optionNoOverlay    = defineFlagValue("od", "overlay-disable", "Disable transparent overlay of the first image in diff areas", false, flag.Bool, flag.BoolVar)
-	optionTransparency = defineFlagValue("ot", "overlay-transparency", "Transparency level for overlay (0.0=opaque, 1.0=transparent)", 0.95, flag.Float64, flag.Float64Var)
+	optionNoOverlay     = defineFlagValue("od", "overlay-disable", "Disable transparent overlay of the first image in diff areas", false, flag.Bool, flag.BoolVar)
+	optionTransparency  = defineFlagValue("ot", "overlay-transparency", "Transparency level for overlay (0.0=opaque, 1.0=transparent)", 0.95, flag.Float64, flag.Float64Var)
+	optionOverlayPreset = defineFlagValue("op", "overlay-preset", "Overlay preset setting transparency, tint strength and tint weight together: 'subtle', 'balanced' or 'strong' (explicit -ot/-ts/-tw take precedence)", "", flag.String, flag.StringVar)
 
 	// Tint
 	optionDisableTint      = defineFlagValue("td", "tint-disable", "Disable color tint on overlay", false, flag.Bool, flag.BoolVar)
@@ -58,59 +116,650 @@ var (
 	optionTintStrength     = defineFlagValue("ts", "tint-strength", "Tint strength (0.0=no tint, 1.0=full tint)", 0.05, flag.Float64, flag.Float64Var)
 	optionTintTransparency = defineFlagValue("tw", "tint-weight", "Transparency level for tint (0.0=opaque, 1.0=transparent)", 0.2, flag.Float64, flag.Float64Var)
 
+	// Style
+	optionBorderColor     = defineFlagValue("bc", "border-color", "Region border color as R,G,B (0-255 for each value)", "255,0,0", flag.String, flag.StringVar)
+	optionBorderThickness = defineFlagValue("bt", "border-thickness", "Region border thickness in pixels (0 = no border, overlay only)", 3, flag.Int, flag.IntVar)
+	optionStyle           = defineFlagValue("st", "style", "Region rendering: 'overlay' (tinted overlay of the differing pixels), 'fill' (translucent tint over the whole region), 'outline' (border only), or a JSON style sheet with border, fill, tint and label settings per region severity band", "overlay", flag.String, flag.StringVar)
+	optionFillAlpha       = defineFlagValue("fl", "fill-alpha", "Opacity of the tint filling each region with --style fill (0.0-1.0)", 0.25, flag.Float64, flag.Float64Var)
+	optionBase            = defineFlagValue("ba", "base", "Image the diff is drawn on: 'b' (the second image, in whose coordinates regions are reported) or 'a' (the first image, with the second image's pixels overlaid)", "b", flag.String, flag.StringVar)
+	optionLabels          = defineFlagValue("lb", "labels", "Draw the region index of each region, as numbered in the reports, next to its border", false, flag.Bool, flag.BoolVar)
+
 	// Layout
-	optionOutputLayout = defineFlagValue("l", "layout", "Output layout: 'simple' (diff image only) or 'horizontal' (input1 + diff side by side)", "simple", flag.String, flag.StringVar)
+	optionOutputLayout    = defineFlagValue("l", "layout", "Output layout: 'simple' (diff image only), 'horizontal' (input1 + diff) or 'side-by-side' (input1 + input2 + diff)", "simple", flag.String, flag.StringVar)
+	optionCaptionsDisable = defineFlagValue("cd", "caption-disable", "Disable panel captions in the side-by-side layout", false, flag.Bool, flag.BoolVar)
+	optionHatchIgnored    = defineFlagValue("hi", "hatch-ignored", "Hatch the areas excluded by --ignore-mask and --ignore-rect with gray diagonal lines", false, flag.Bool, flag.BoolVar)
+	optionHatchUncovered  = defineFlagValue("hu", "hatch-uncovered", "Hatch the areas of the second image that have no counterpart in the first image under the detected offset", false, flag.Bool, flag.BoolVar)
+	optionGridShading     = defineFlagValue("gd", "grid-shading", "Shade every --grid cell of the diff image in purple, more opaque the larger its share of differing pixels", false, flag.Bool, flag.BoolVar)
 
 	// Exit on diff
 	optionExitOnDiff = defineFlagValue("e", "exit-on-diff", "Exit with status code 1 if differences are found (does not save diff image)", false, flag.Bool, flag.BoolVar)
+
+	// Console output
+	optionQuiet          = defineFlagValue("q", "quiet", "Print errors only", false, flag.Bool, flag.BoolVar)
+	optionVerbose        = defineFlagValue("v", "verbose", "Also print the option listing, stage progress and informational logs to stderr", false, flag.Bool, flag.BoolVar)
+	optionProgressEvery  = defineFlagValue("pg", "progress-interval", "Minimum time in milliseconds between two progress lines of a stage (0 = no limit)", 200, flag.Int, flag.IntVar)
+	optionProgressFormat = defineFlagValue("pf", "progress-format", "Stage progress on stderr: 'text' (human-readable lines with --verbose) or 'json' (one JSON object per event, whatever the verbosity, ending with a 'done' event)", "text", flag.String, flag.StringVar)
+	optionLogTimestamps  = defineFlagValue("lt", "log-timestamps", "Prefix every console and log line with an RFC3339 timestamp", false, flag.Bool, flag.BoolVar)
+	optionVersion        = defineFlagValue("vr", "version", "Print the version, git commit, build date and Go version and exit", false, flag.Bool, flag.BoolVar)
+
+	// Config file
+	optionConfig      = defineFlagValue("cf", "config", "JSON file of option values keyed by long option name (e.g. {\"diff-threshold\": 20}); options given on the command line take precedence", "", flag.String, flag.StringVar)
+	optionPrintConfig = defineFlagValue("pc", "print-config", "Print the effective options, merged from defaults, --config and the command line, as a config file and exit", false, flag.Bool, flag.BoolVar)
+
+	optionDirectWrite = defineFlagValue("dw", "direct-write", "Write output files in place instead of via a temporary file renamed on success", false, flag.Bool, flag.BoolVar)
+	optionNoOverwrite = defineFlagValue("no", "no-overwrite", "Fail instead of replacing an existing output file", false, flag.Bool, flag.BoolVar)
+	optionSkipSame    = defineFlagValue("si", "skip-identical", "Write no diff image (--output, --output-a) when the images do not differ", false, flag.Bool, flag.BoolVar)
+	optionNoMkdir     = defineFlagValue("nm", "no-mkdir", "Fail instead of creating missing parent directories of output files", false, flag.Bool, flag.BoolVar)
+
+	optionJPEGQuality    = defineFlagValue("jq", "jpeg-quality", "Quality of .jpg/.jpeg output images (1-100)", core.DefaultJPEGQuality, flag.Int, flag.IntVar)
+	optionPNGCompression = defineFlagValue("pz", "png-compression", "Compression of .png output images: 'default', 'speed', 'best' or 'none'", string(core.PNGCompressionDefault), flag.String, flag.StringVar)
+
+	optionReportMemory = defineFlagValue("rm", "report-memory", "Log the duration and Go heap usage of each phase and add them to the JSON report", false, flag.Bool, flag.BoolVar)
+
+	// Mask
+	optionMask = defineFlagValue("mk", "mask", "Write the raw diff mask (white = differing pixel) to the given path", "", flag.String, flag.StringVar)
+
+	// Heatmap
+	optionHeatmap         = defineFlagValue("hm", "heatmap", "Write a heatmap of the per-pixel difference magnitude to the given path", "", flag.String, flag.StringVar)
+	optionHeatmapGradient = defineFlagValue("hg", "heatmap-gradient", "Heatmap gradient as comma-separated RRGGBB or RRGGBBAA colors, from no difference to maximum", "0000ff00,ffff00,ff0000", flag.String, flag.StringVar)
+	optionHeatmapOverlay  = defineFlagValue("ho", "heatmap-overlay", "Composite the heatmap at 50% opacity over the second image", false, flag.Bool, flag.BoolVar)
+
+	// Blink
+	optionBlink      = defineFlagValue("b", "blink", "Write an animated GIF alternating the aligned first image and the second image", "", flag.String, flag.StringVar)
+	optionBlinkDelay = defineFlagValue("bd", "blink-delay", "Display time of each blink frame in milliseconds", 500, flag.Int, flag.IntVar)
+
+	// Reports
+	optionHTMLReport    = defineFlagValue("hr", "html-report", "Write a self-contained HTML report (images + region table) to the given path", "", flag.String, flag.StringVar)
+	optionRegionsCSV    = defineFlagValue("rc", "regions-csv", "Write the merged diff regions as CSV to the given path", "", flag.String, flag.StringVar)
+	optionJSONReport    = defineFlagValue("jr", "json-report", "Write a machine-readable JSON report to the given path", "", flag.String, flag.StringVar)
+	optionGrid          = defineFlagValue("gr", "grid", "Divide the second image into COLSxROWS cells (e.g. 12x8) and list the differing pixels of each in the JSON report", "", flag.String, flag.StringVar)
+	optionCompareReport = defineFlagValue("cr", "compare-report", "Previous JSON report of the same pair (batch mode: the --out-dir of an earlier run); classifies regions as 'recurring' or 'new'", "", flag.String, flag.StringVar)
+	optionOutputBundle  = defineFlagValue("ob", "output-bundle", "Write a review bundle (diff, side-by-side, stats.json, per-region crops) into the given directory", "", flag.String, flag.StringVar)
+	optionFailOn        = defineFlagValue("fp", "fail-on", "With --exit-on-diff, what counts as a failure: 'any' difference, 'regions>N' (more than N regions) or 'ratio>X' (more than the fraction X of the pixels differ)", "any", flag.String, flag.StringVar)
+	optionFailOnNewOnly = defineFlagValue("fn", "fail-on-new-only", "With --exit-on-diff, exit with status code 1 only if new regions are found (requires --compare-report)", false, flag.Bool, flag.BoolVar)
+	optionPrintSchema   = defineFlagValue("ps", "print-schema", "Print the JSON Schema of the JSON report and exit", false, flag.Bool, flag.BoolVar)
+	optionStampVersion  = defineFlagValue("sv", "stamp-version", "Write the imgdiff version into a 'Software' tEXt chunk of a PNG diff image (the JSON report always records it)", false, flag.Bool, flag.BoolVar)
+
+	// Batch
+	optionDir1               = defineFlagValue("d1", "dir1", "Batch mode: directory of first images, compared with the files under the same relative path in --dir2", "", flag.String, flag.StringVar)
+	optionDir2               = defineFlagValue("d2", "dir2", "Batch mode: directory of second images", "", flag.String, flag.StringVar)
+	optionOutDir             = defineFlagValue("ou", "out-dir", "Batch mode: directory receiving the diff image and JSON report of each pair and the summary.json batch report", "", flag.String, flag.StringVar)
+	optionManifest           = defineFlagValue("mn", "manifest", "Batch mode: JSON or CSV file listing the pairs to compare (input1, input2, output and optional threshold, max_offset, ignore_rects per pair)", "", flag.String, flag.StringVar)
+	optionJobs               = defineFlagValue("jb", "jobs", "Batch mode: number of pairs compared at a time, sharing --cpu (0 = one per --cpu core)", 0, flag.Int, flag.IntVar)
+	optionOversubscribe      = defineFlagValue("os", "oversubscribe", "Batch mode: keep --cpu workers per pair even when --jobs × --cpu exceeds the CPU cores, only warning about it", false, flag.Bool, flag.BoolVar)
+	optionFailFast           = defineFlagValue("ff", "fail-fast", "Batch mode: stop at the first pair that cannot be compared instead of continuing with the others", false, flag.Bool, flag.BoolVar)
+	optionMaxFailedPairs     = defineFlagValue("mf", "max-failed-pairs", "Batch mode: failing pairs tolerated by --exit-on-diff, as a count or a percentage such as 5%", "0", flag.String, flag.StringVar)
+	optionMaxPairDiffPercent = defineFlagValue("pd", "max-pair-diff-percent", "Batch mode: fail --exit-on-diff if any pair differs in more than this percentage of its pixels (0 = disabled)", 0.0, flag.Float64, flag.Float64Var)
+
+	// Analysis
+	optionSaveAnalysis = defineFlagValue("sa", "save-analysis", "Save the analysis (offset, diff mask, regions, options) to the given path for 'render'", "", flag.String, flag.StringVar)
+	optionFromAnalysis = defineFlagValue("fa", "from-analysis", "With 'render', re-render outputs from the given saved analysis instead of comparing", "", flag.String, flag.StringVar)
+
+	// Debug
+	optionDebugScoreSurface = defineFlagValue("ds", "debug-score-surface", "Write the alignment score for every offset within max-offset as a PNG to the given path", "", flag.String, flag.StringVar)
 )
 
+// Exit statuses of the command, listed in the usage text.
+const (
+	exitCodeOK    = 0 // no differences
+	exitCodeDiff  = 1 // differences found with --exit-on-diff, or a failed batch gate
+	exitCodeUsage = 2 // invalid options or config, or a size mismatch with --size-mismatch error or --auto-scale
+	exitCodeError = 3 // an input could not be read or decoded, an output could not be written, or the offset was rejected
+)
+
+// exitStatusUsage documents the exit statuses in the usage text.
+const exitStatusUsage = `Exit status:
+  0  no differences (or differences without --exit-on-diff)
+  1  differences found with --exit-on-diff (see --fail-on), or a failed batch gate
+  2  invalid options or config file, or images of different sizes with --size-mismatch error
+     or sizes that --auto-scale cannot match
+  3  I/O or decode error (in batch mode, any pair that could not be compared),
+     or an offset rejected by --max-acceptable-offset
+`
+
+// usageError is an invalid invocation after which the usage text is printed.
+type usageError struct{ error }
+
+func (e usageError) Unwrap() error { return e.error }
+
 func init() {
 	flag.Usage = customUsage(commandDescription)
 }
 
 func main() {
-	flag.Parse()
+	code, err := run(os.Args[1:])
+	if err != nil {
+		// Validation reports one problem per line.
+		for _, line := range strings.Split(err.Error(), "\n") {
+			con.Errorf("%s", line)
+		}
+		if errors.As(err, new(usageError)) {
+			flag.Usage()
+		}
+	}
+	os.Exit(code)
+}
 
-	if err := validateRequiredOptions(); err != nil {
-		fmt.Println(err)
-		flag.Usage()
-		os.Exit(1)
+// run executes the command line args (without the program name) and returns
+// the exit status, and the error to report if the run failed. Every exit
+// decision is made here so that deferred cleanup runs before main exits.
+func run(args []string) (code int, err error) {
+	if len(args) > 0 && args[0] == "doctor" {
+		return runDoctor()
 	}
 
-	layout := core.Layout(*optionOutputLayout)
-	if layout != core.LayoutSimple && layout != core.LayoutHorizontal {
-		fmt.Printf("[ERROR] Invalid layout value '%s'. Must be 'simple' or 'horizontal'.\n", *optionOutputLayout)
-		os.Exit(1)
+	// "imgdiff render --from-analysis ..." re-renders a saved analysis and
+	// "imgdiff inspect -i1 ... -i2 ..." summarizes the inputs without comparing them.
+	subcommand := ""
+	if len(args) > 0 && (args[0] == "render" || args[0] == "inspect") {
+		subcommand, args = args[0], args[1:]
+	}
+	if err := flag.CommandLine.Parse(args); err != nil {
+		// The flag package has printed the error and the usage.
+		if errors.Is(err, flag.ErrHelp) {
+			return exitCodeOK, nil
+		}
+		return exitCodeUsage, nil
+	}
+	if *optionVersion {
+		fmt.Fprintf(os.Stdout, "imgdiff %s\n", buildVersion())
+		return exitCodeOK, nil
+	}
+	if *optionConfig != "" {
+		if err := loadConfig(flag.CommandLine, *optionConfig); err != nil {
+			return exitCodeUsage, err
+		}
+	}
+	if *optionPrintConfig {
+		if err := writeConfig(os.Stdout, flag.CommandLine); err != nil {
+			return exitCodeError, err
+		}
+		return exitCodeOK, nil
+	}
+	if *optionQuiet && *optionVerbose {
+		return exitCodeUsage, errors.New("--quiet and --verbose cannot be combined")
+	}
+	con.level = verbosityNormal
+	if *optionQuiet {
+		con.level = verbosityQuiet
+	} else if *optionVerbose {
+		con.level = verbosityVerbose
+	}
+	con.events = con.err
+	if *optionLogTimestamps {
+		con.out, con.err = progress.NewTimestampWriter(con.out), progress.NewTimestampWriter(con.err)
+	}
+	renderMode := subcommand == "render"
+
+	// The comparison is summarized by the last JSON event, whatever ends it.
+	var result *core.Result
+	var events *progress.JSON
+	if *optionProgressFormat == "json" {
+		events = con.JSON()
+		defer func() { events.Done(summarize(code, err, result)) }()
+	}
+
+	if *optionPrintSchema {
+		if err := report.WriteSchema(os.Stdout); err != nil {
+			return exitCodeError, err
+		}
+		return exitCodeOK, nil
+	}
+
+	var savedAnalysis *analysis.File
+	if renderMode {
+		var err error
+		if savedAnalysis, err = loadAnalysis(); err != nil {
+			if errors.As(err, new(usageError)) {
+				return exitCodeUsage, err
+			}
+			return exitCodeError, err
+		}
+	}
+
+	if batchMode() && subcommand != "" {
+		return exitCodeUsage, fmt.Errorf("--dir1/--dir2 and --manifest cannot be used with '%s'", subcommand)
+	}
+	if *optionHistogramOnly && (batchMode() || subcommand != "") {
+		return exitCodeUsage, errors.New("--histogram-only compares a single pair and cannot be used in batch mode or with a subcommand")
+	}
+	if err := validateRequiredOptions(subcommand != "inspect" && !*optionHistogramOnly); err != nil {
+		return exitCodeUsage, usageError{err}
+	}
+	layout, strategy, err := validateOptions()
+	if err != nil {
+		return exitCodeUsage, err
+	}
+
+	if subcommand == "inspect" {
+		return runInspect(buildOptions(layout, strategy))
 	}
 
 	// Print current options
-	optionValues, _ := getOptionsUsage(true)
-	fmt.Printf("[ Command options ]\n%s\n", optionValues)
+	if con.Verbose() {
+		optionValues, _ := getOptionsUsage(true)
+		fmt.Fprintf(con.err, "[ Command options ]\n%s\n", optionValues)
+	}
 
 	// Build options
-	opts := buildOptions(layout)
+	opts := buildOptions(layout, strategy)
+	if style := core.RenderStyle(*optionStyle); style.Valid() {
+		opts.Render.Style = style
+	} else if *optionStyle != "" {
+		styles, err := render.LoadStyleSheet(*optionStyle)
+		if err != nil {
+			return exitCodeUsage, err
+		}
+		opts.Render.SeverityStyles = styles
+	}
+	if err := opts.Validate(); err != nil {
+		return exitCodeUsage, fmt.Errorf("invalid options:\n%w", err)
+	}
+	runtime.GOMAXPROCS(opts.Runtime.Workers)
+	if opts.Diff.ChannelThresholds == nil {
+		con.Infof("Diff threshold: %d of %d for --color-metric %s", opts.Diff.Threshold, opts.Diff.Metric.MaxThreshold(), opts.Diff.Metric)
+	}
+	if opts.Render.OverlayImperceptible() {
+		con.Warnf("The overlay is only %.0f%% opaque and will be practically invisible; lower --overlay-transparency or use --overlay-preset balanced.", opts.Render.OverlayOpacity()*100)
+	}
+	if n := opts.Diff.MinDetectableChange(); n > 1 && !opts.Diff.VerifyClean {
+		con.Infof("Changes smaller than %dx%d px may be removed by the noise filter; use --verify-clean to re-check when none are found.", n, n)
+	}
+
+	// Create logger and progress reporter
+	reporter := con.Progress()
+	if events != nil {
+		reporter = events
+	}
+	opts.Runtime.Progress = progress.Throttle(reporter, time.Duration(*optionProgressEvery)*time.Millisecond)
+	handlerOpts := &slog.HandlerOptions{Level: con.LogLevel()}
+	if *optionLogTimestamps {
+		// The line prefix replaces slog's own time attribute.
+		handlerOpts.ReplaceAttr = func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey && len(groups) == 0 {
+				return slog.Attr{}
+			}
+			return a
+		}
+	}
+	logger := slog.New(slog.NewTextHandler(con.err, handlerOpts))
+
+	if err := checkReportOutputs(); err != nil {
+		return exitCodeError, err
+	}
+	if batchMode() {
+		return runBatch(opts, logger)
+	}
+
+	if renderMode {
+		result, err = app.Rerender(savedAnalysis, opts, logger)
+	} else {
+		result, err = app.Run(opts, *optionExitOnDiff && !needsRegions(), logger)
+	}
+	var offsetErr *app.OffsetRejectedError
+	if errors.As(err, &offsetErr) {
+		if _, reportErr := writeReports(opts, result); reportErr != nil {
+			con.Errorf("%v", reportErr)
+		}
+		return exitCodeError, fmt.Errorf("%w; the capture is likely broken", offsetErr)
+	}
+	if errors.As(err, new(*app.ImageSizeError)) {
+		return exitCodeUsage, fmt.Errorf("%w (--size-mismatch error)", err)
+	}
+	if errors.As(err, new(*app.ScaleError)) {
+		return exitCodeUsage, err
+	}
+	if err != nil {
+		return exitCodeError, err
+	}
+
+	rep, err := writeReports(opts, result)
+	if err != nil {
+		return exitCodeError, err
+	}
+
+	h := result.Histogram
+	if opts.HistogramOnly {
+		verdict := "histograms match"
+		if result.HasDiff {
+			verdict = "histograms differ"
+		}
+		con.Printf("RESULT: %s: intersection %.4f, chi-square distance %.4f (limit %.4f)", verdict, h.Intersection, h.ChiSquare, opts.HistogramMaxDistance)
+		if result.HasDiff {
+			return exitCodeDiff, nil
+		}
+		return exitCodeOK, nil
+	}
+	con.Infof("Histograms: intersection %.4f, chi-square distance %.4f", h.Intersection, h.ChiSquare)
+
+	if result.Orientation != core.OrientationOriginal {
+		con.Warnf("Aspect ratios differ; the first image was compared %s.", result.Orientation)
+	}
+	if s := result.Scale; result.Scaled {
+		con.Infof("Scale: the first image is %s times the size of the second; the larger one was downsampled to match.", s)
+	} else if !s.IsZero() {
+		con.Warnf("The first image is %s times the size of the second. Consider --auto-scale to compare them at the same size.", s)
+	}
+	if al := result.Aligned; opts.Align.Ambiguous(al) {
+		con.Warnf("The offset (%d,%d) is ambiguous: (%d,%d) scores almost as well (confidence %.2f < %.2f). Consider --offset if the correct offset is known.",
+			al.DX, al.DY, al.RunnerUp.DX, al.RunnerUp.DY, al.Confidence, opts.Align.MinConfidence)
+	}
+
+	if result.Unfiltered {
+		con.Warnf("The noise filter removed every difference; --verify-clean found %d differing pixels without it.", result.DiffPixels())
+	}
+
+	if result.Prefiltered {
+		con.Infof("The perceptual hashes match; the images were reported identical without comparing them.")
+	} else if psnr := result.PSNR(); math.IsInf(psnr, 1) {
+		con.Infof("Similarity: identical after alignment (MSE 0, PSNR +Inf)")
+	} else {
+		con.Infof("Similarity: MSE %.3f, PSNR %.2f dB", result.MSE, psnr)
+	}
+
+	if opts.Diff.Tolerant() && result.DiffPixels() > 0 && !result.HasDiff {
+		con.Infof("%d differing pixels (%.4f%%) are within --max-diff-ratio/--max-diff-pixels; the images count as identical.", result.DiffPixels(), 100*result.DiffRatio())
+	}
+
+	if result.HasDiff && len(result.Regions) == 0 && result.DiffPixels() > 0 {
+		con.Warnf("%d differing pixels form no region (see --min-region-area and --min-region-pixels), so the diff image shows no box; they still count as a difference.", result.DiffPixels())
+	}
+
+	for _, b := range result.RowBands {
+		if b.Kind == core.RowBandInserted {
+			con.Printf("Inserted rows: %d-%d of the second image (%d rows) are not in the first.", b.Y0, b.Y1-1, b.Height())
+		} else {
+			con.Printf("Deleted rows: %d-%d of the first image (%d rows) are not in the second.", b.SrcY0, b.SrcY1-1, b.Height())
+		}
+	}
+
+	if result.HasDiff {
+		bands := ""
+		if n := len(result.RowBands); n > 0 {
+			bands = fmt.Sprintf(", %d inserted/deleted row band(s)", n)
+		}
+		con.Printf("RESULT: %d diff region(s)%s, %.4f%% pixels differ, offset (%d,%d)", len(result.Regions), bands, 100*result.DiffRatio(), result.Aligned.DX, result.Aligned.DY)
+	} else {
+		con.Printf("RESULT: no differences")
+	}
+	switch {
+	case opts.Output.Path == "":
+	case opts.Output.SkipIdentical && !result.HasDiff:
+		con.Infof("No diff image written to %s (--skip-identical).", opts.Output.Path)
+	default:
+		con.Printf("Diff image saved to %s", opts.Output.Path)
+	}
+
+	if *optionExitOnDiff {
+		policy, _ := report.ParseFailPolicy(*optionFailOn) // validated by validateOptions
+		failed := policy.Fails(rep)
+		if *optionFailOnNewOnly {
+			failed = rep.Comparison.New > 0
+		}
+		if failed {
+			con.Infof("Differences detected (--fail-on %s). Exiting with status code %d.", policy, exitCodeDiff)
+			return exitCodeDiff, nil
+		}
+	}
+	return exitCodeOK, nil
+}
+
+// summarize returns the summary of the "done" JSON event of a run that
+// returned code and err, with the comparison result if there is one.
+func summarize(code int, err error, result *core.Result) progress.Summary {
+	s := progress.Summary{ExitCode: code}
+	if err != nil {
+		s.Error = err.Error()
+	}
+	if result != nil {
+		s.HasDiff, s.Regions = result.HasDiff, len(result.Regions)
+		s.DiffPercent = 100 * result.DiffRatio()
+		s.OffsetX, s.OffsetY = result.Aligned.DX, result.Aligned.DY
+	}
+	return s
+}
 
-	// Create logger
-	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelInfo}))
+// validateOptions checks the option values that do not depend on each
+// other's defaults and returns the parsed layout and search strategy.
+func validateOptions() (core.Layout, core.SearchStrategy, error) {
+	if err := validateFlagRanges(); err != nil {
+		return "", "", err
+	}
+	if *optionAlignStrategy != "pyramid" && *optionAlignStrategy != "exhaustive" {
+		return "", "", fmt.Errorf("invalid align strategy '%s'. Must be 'pyramid' or 'exhaustive'", *optionAlignStrategy)
+	}
+	if *optionProgressFormat != "text" && *optionProgressFormat != "json" {
+		return "", "", fmt.Errorf("invalid progress format '%s'. Must be 'text' or 'json'", *optionProgressFormat)
+	}
+	if !core.AlignMetric(*optionAlignMetric).Valid() {
+		return "", "", fmt.Errorf("invalid metric '%s'. Must be 'mae' or 'ssim'", *optionAlignMetric)
+	}
+	if *optionForcedOffset != "" {
+		if isFlagSet("m", "max-offset", "mx", "max-offset-x", "my", "max-offset-y") {
+			return "", "", errors.New("--offset skips the alignment search and cannot be combined with --max-offset, --max-offset-x or --max-offset-y")
+		}
+		if _, err := parseOffset(*optionForcedOffset); err != nil {
+			return "", "", err
+		}
+	}
+	if _, err := parseROI(*optionROI); err != nil {
+		return "", "", err
+	}
+	if _, err := parseGrid(*optionGrid); err != nil {
+		return "", "", err
+	}
+	if *optionGridShading && *optionGrid == "" {
+		return "", "", errors.New("--grid-shading requires --grid")
+	}
+	if _, err := parseRects(*optionIgnoreRects); err != nil {
+		return "", "", err
+	}
+	metric := core.ColorMetric(*optionColorMetric)
+	if !metric.Valid() {
+		return "", "", fmt.Errorf("invalid color metric '%s'. Must be 'rgb' or 'ciede2000'", *optionColorMetric)
+	}
+	if isFlagSet("d", "diff-threshold") {
+		if _, err := metric.ParseThreshold(*optionThreshold); err != nil {
+			return "", "", fmt.Errorf("--diff-threshold: %w", err)
+		}
+	}
+	if *optionThresholdRGBA != "" {
+		if metric != core.ColorMetricRGB {
+			return "", "", errors.New("--threshold-rgba requires --color-metric rgb")
+		}
+		if _, err := parseChannelThresholds(*optionThresholdRGBA); err != nil {
+			return "", "", err
+		}
+	}
+	strategy := core.SearchStrategy(*optionSearchStrategy)
+	if strategy != core.SearchFull && strategy != core.SearchSpiral {
+		return "", "", fmt.Errorf("invalid search strategy '%s'. Must be 'full' or 'spiral'", *optionSearchStrategy)
+	}
+	layout := core.Layout(*optionOutputLayout)
+	if layout != core.LayoutSimple && layout != core.LayoutHorizontal && layout != core.LayoutSideBySide {
+		return "", "", fmt.Errorf("invalid layout value '%s'. Must be 'simple', 'horizontal' or 'side-by-side'", *optionOutputLayout)
+	}
+	if !core.SizeMismatch(*optionSizeMismatch).Valid() {
+		return "", "", fmt.Errorf("invalid size mismatch mode '%s'. Must be 'warn', 'error' or 'pad'", *optionSizeMismatch)
+	}
+	if core.SizeMismatch(*optionSizeMismatch) != core.SizeMismatchPad && isFlagSet("pb", "pad-color", "pi", "pad-ignore") {
+		return "", "", errors.New("--pad-color and --pad-ignore require --size-mismatch pad")
+	}
+	if _, err := parsePadColor(*optionPadColor); err != nil {
+		return "", "", err
+	}
+	if !core.PNGCompression(*optionPNGCompression).Valid() {
+		return "", "", fmt.Errorf("invalid PNG compression '%s'. Must be 'default', 'speed', 'best' or 'none'", *optionPNGCompression)
+	}
+	if !core.RegionOutline(*optionOutline).Valid() {
+		return "", "", fmt.Errorf("invalid outline '%s'. Must be 'box' or 'contour'", *optionOutline)
+	}
+	if !core.RenderBase(*optionBase).Valid() {
+		return "", "", fmt.Errorf("invalid base '%s'. Must be 'a' or 'b'", *optionBase)
+	}
+	if *optionOverlayPreset != "" && !core.OverlayPreset(*optionOverlayPreset).Valid() {
+		return "", "", fmt.Errorf("invalid overlay preset '%s'. Must be 'subtle', 'balanced' or 'strong'", *optionOverlayPreset)
+	}
+	if isFlagSet("fp", "fail-on") {
+		if !*optionExitOnDiff {
+			return "", "", errors.New("--fail-on requires --exit-on-diff")
+		}
+		policy, err := report.ParseFailPolicy(*optionFailOn)
+		if err != nil {
+			return "", "", err
+		}
+		if *optionFailOnNewOnly && policy.Kind != report.FailOnAny {
+			return "", "", errors.New("--fail-on-new-only cannot be combined with a --fail-on threshold")
+		}
+	}
+	if *optionHistogramOnly {
+		for _, names := range histogramOnlyConflicts {
+			if isFlagSet(names[0], names[1]) {
+				return "", "", fmt.Errorf("--histogram-only skips the pixel comparison and cannot be combined with --%s", names[1])
+			}
+		}
+	}
+	return layout, strategy, nil
+}
 
-	hasDiff, err := app.Run(opts, *optionExitOnDiff, logger)
+// histogramOnlyConflicts are the short and long names of the options that
+// need the pixel comparison skipped by --histogram-only. Its JSON report
+// only records the histograms.
+var histogramOnlyConflicts = [][2]string{
+	{"o", "output"}, {"oa", "output-a"}, {"ob", "output-bundle"}, {"ce", "crop-each"},
+	{"hr", "html-report"}, {"rc", "regions-csv"}, {"sa", "save-analysis"}, {"cr", "compare-report"},
+	{"mk", "mask"}, {"hm", "heatmap"}, {"b", "blink"}, {"ds", "debug-score-surface"},
+	{"fp", "fail-on"}, {"fn", "fail-on-new-only"},
+}
+
+// validateFlagRanges rejects numeric flags outside their range, naming the
+// flag, instead of letting them produce an empty search or a broken render.
+// Every problem is reported at once.
+func validateFlagRanges() error {
+	var errs []error
+	atLeast := func(name string, v, lower int) {
+		if v < lower {
+			errs = append(errs, fmt.Errorf("--%s must be at least %d, got %d", name, lower, v))
+		}
+	}
+	unit := func(name string, v float64) {
+		if v < 0 || v > 1 {
+			errs = append(errs, fmt.Errorf("--%s must be between 0.0 and 1.0, got %v", name, v))
+		}
+	}
+	factor := func(name string, v float64) {
+		if v != 0 && v < 1 {
+			errs = append(errs, fmt.Errorf("--%s must be 0 (disabled) or at least 1.0, got %v", name, v))
+		}
+	}
+	atLeast("cpu", *optionNumCPU, 0)
+	atLeast("jobs", *optionJobs, 0)
+	atLeast("max-offset", *optionMaxOffset, 0)
+	atLeast("max-offset-x", *optionMaxOffsetX, -1)
+	atLeast("max-offset-y", *optionMaxOffsetY, -1)
+	atLeast("max-acceptable-offset", *optionMaxAcceptableOffset, 0)
+	factor("min-confidence", *optionMinConfidence)
+	factor("max-aspect-factor", *optionMaxAspectFactor)
+	atLeast("strip-width", *optionStripWidth, 1)
+	atLeast("local-align-radius", *optionLocalAlignRadius, 1)
+	atLeast("local-align-min-area", *optionLocalAlignMinArea, 0)
+	atLeast("noise-window-size", *optionNoiseWindowSize, 0)
+	atLeast("despeckle", *optionDespeckle, 0)
+	atLeast("close", *optionClose, 0)
+	atLeast("max-diff-pixels", *optionMaxDiffPixels, 0)
+	atLeast("min-region-area", *optionMinRegionArea, 0)
+	atLeast("min-region-pixels", *optionMinRegionPixels, 0)
+	atLeast("max-regions", *optionMaxRegions, 0)
+	atLeast("region-padding", *optionRegionPadding, 0)
+	atLeast("region-connect-distance", *optionConnectDistance, 1)
+	atLeast("min-region-size", *optionMinRegionSize, 0)
+	atLeast("merge-distance", *optionMergeDistance, 0)
+	atLeast("tile-size", *optionTileSize, 0)
+	if *optionContourEpsilon < 0 {
+		errs = append(errs, fmt.Errorf("--contour-epsilon must not be negative, got %v", *optionContourEpsilon))
+	}
+	atLeast("border-thickness", *optionBorderThickness, 0)
+	atLeast("crop-margin", *optionCropMargin, 0)
+	atLeast("progress-interval", *optionProgressEvery, 0)
+	// GIF frame delays are stored in hundredths of a second.
+	atLeast("blink-delay", *optionBlinkDelay, 10)
+	if *optionMaxPairDiffPercent < 0 || *optionMaxPairDiffPercent > 100 {
+		errs = append(errs, fmt.Errorf("--max-pair-diff-percent must be between 0 and 100, got %v", *optionMaxPairDiffPercent))
+	}
+	if *optionJPEGQuality < 1 || *optionJPEGQuality > 100 {
+		errs = append(errs, fmt.Errorf("--jpeg-quality must be between 1 and 100, got %d", *optionJPEGQuality))
+	}
+	unit("spiral-epsilon", *optionSpiralEpsilon)
+	unit("histogram-max-distance", *optionHistogramMax)
+	unit("noise-min-ratio", *optionNoiseMinRatio)
+	unit("max-diff-ratio", *optionMaxDiffRatio)
+	unit("overlay-transparency", *optionTransparency)
+	unit("tint-strength", *optionTintStrength)
+	unit("tint-weight", *optionTintTransparency)
+	unit("fill-alpha", *optionFillAlpha)
+	for _, c := range [][2]string{{"tint-color", *optionTintColor}, {"border-color", *optionBorderColor}} {
+		if _, _, _, err := parseRGB(c[0], c[1]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// runDoctor runs the pipeline self-test on synthetic fixtures in a temp dir
+// and returns the process exit status: a failing check is reported like a
+// difference.
+func runDoctor() (int, error) {
+	dir, err := os.MkdirTemp("", "imgdiff-doctor-")
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "[ERROR] %v\n", err)
-		os.Exit(1)
+		return exitCodeError, err
 	}
+	defer os.RemoveAll(dir)
 
-	if *optionExitOnDiff && hasDiff {
-		fmt.Println("[INFO] Differences detected. Exiting with status code 1.")
-		os.Exit(1)
+	checks, err := doctor.Run(dir)
+	if err != nil {
+		return exitCodeError, err
+	}
+	doctor.Print(os.Stdout, checks, version)
+	if !doctor.AllPassed(checks) {
+		return exitCodeDiff, nil
 	}
+	return exitCodeOK, nil
+}
 
-	if opts.Output.Path != "" {
-		fmt.Printf("Diff image saved to %s\n", opts.Output.Path)
+// loadAnalysis reads --from-analysis for render mode and defaults the input
+// paths to the ones recorded in the analysis.
+func loadAnalysis() (*analysis.File, error) {
+	if *optionFromAnalysis == "" {
+		return nil, usageError{errors.New("render requires --from-analysis")}
+	}
+	file, err := analysis.Load(*optionFromAnalysis)
+	if err != nil {
+		return nil, err
 	}
+	if *optionImageInput1 == "" {
+		*optionImageInput1 = file.Input1
+	}
+	if *optionImageInput2 == "" {
+		*optionImageInput2 = file.Input2
+	}
+	return file, nil
+}
+
+// runInspect prints the header summary and search cost of the inputs and
+// returns the process exit status.
+func runInspect(opts core.Options) (int, error) {
+	r, err := inspect.Run(opts)
+	if err != nil {
+		return exitCodeError, err
+	}
+	r.Print(os.Stdout)
+	return exitCodeOK, nil
 }
 
-func validateRequiredOptions() error {
+func validateRequiredOptions(requireOutput bool) error {
+	if batchMode() {
+		return validateBatchOptions()
+	}
 	var missing []string
 	if *optionImageInput1 == "" {
 		missing = append(missing, "i1")
@@ -118,23 +767,24 @@ func validateRequiredOptions() error {
 	if *optionImageInput2 == "" {
 		missing = append(missing, "i2")
 	}
-	if *optionOutput == "" && !*optionExitOnDiff {
+	if requireOutput && *optionOutput == "" && !*optionExitOnDiff {
 		missing = append(missing, "o")
 	}
 	if len(missing) > 0 {
-		return fmt.Errorf("[ERROR] Missing required option(s): %s", strings.Join(missing, ", "))
+		return fmt.Errorf("Missing required option(s): %s", strings.Join(missing, ", "))
+	}
+	if *optionFailOnNewOnly && *optionCompareReport == "" {
+		return fmt.Errorf("--fail-on-new-only requires --compare-report")
 	}
 	return nil
 }
 
-func buildOptions(layout core.Layout) core.Options {
-	r, g, b := parseTintColor(*optionTintColor)
+func buildOptions(layout core.Layout, strategy core.SearchStrategy) core.Options {
+	// The colors are validated by validateFlagRanges.
+	r, g, b, _ := parseRGB("tint-color", *optionTintColor)
+	br, bg, bb, _ := parseRGB("border-color", *optionBorderColor)
 	opts := core.DefaultOptions()
 
-	transparency := clampF64(*optionTransparency, 0.0, 1.0)
-	tintStrength := clampF64(*optionTintStrength, 0.0, 1.0)
-	tintTransparency := clampF64(*optionTintTransparency, 0.0, 1.0)
-
 	// Precise mode: use larger MinPyramidSize to reduce pyramid levels
 	minPyramidSize := 32
 	if *optionPreciseMode {
@@ -143,68 +793,247 @@ func buildOptions(layout core.Layout) core.Options {
 
 	opts.Input1 = *optionImageInput1
 	opts.Input2 = *optionImageInput2
-	opts.Align.MaxOffset = *optionMaxOffset
+	opts.ROI, _ = parseROI(*optionROI)
+	opts.Grid, _ = parseGrid(*optionGrid)
+	opts.Align.MaxOffsetX = axisMaxOffset(*optionMaxOffsetX, *optionMaxOffset)
+	opts.Align.MaxOffsetY = axisMaxOffset(*optionMaxOffsetY, *optionMaxOffset)
+	if offset, err := parseOffset(*optionForcedOffset); err == nil {
+		opts.Align.ForcedOffset = &offset
+	}
+	opts.Align.MinConfidence = *optionMinConfidence
+	opts.Align.MaxAcceptableOffset = *optionMaxAcceptableOffset
+	opts.Align.MaxAspectFactor = *optionMaxAspectFactor
+	opts.Align.StrictDimensions = *optionStrictDimensions
 	opts.Align.MinPyramidSize = minPyramidSize
 	opts.Align.RefinementRadius = 2
-	opts.VerticalAlign.StripWidth = max(1, *optionStripWidth)
-	opts.Diff.Threshold = uint8(clampInt(*optionThreshold, 0, 255))
-	opts.Diff.NoiseWindowSize = max(0, *optionNoiseWindowSize)
-	opts.Diff.NoiseMinDiffRatio = clampF64(*optionNoiseMinRatio, 0.0, 1.0)
-	opts.Region.MinArea = max(0, *optionMinRegionArea)
+	opts.Align.Exhaustive = *optionAlignStrategy == "exhaustive"
+	opts.Align.SearchStrategy = strategy
+	opts.Align.Metric = core.AlignMetric(*optionAlignMetric)
+	opts.Align.SpiralEpsilon = *optionSpiralEpsilon
+	opts.VerticalAlign.StripWidth = *optionStripWidth
+	opts.VerticalAlign.DetectScroll = *optionDetectScroll
+	opts.LocalAlign.Enabled = *optionLocalAlign
+	opts.LocalAlign.Radius = *optionLocalAlignRadius
+	opts.LocalAlign.MinArea = *optionLocalAlignMinArea
+	opts.Diff.Metric = core.ColorMetric(*optionColorMetric)
+	opts.Diff.Threshold = opts.Diff.Metric.DefaultThreshold()
+	if isFlagSet("d", "diff-threshold") {
+		opts.Diff.Threshold, _ = opts.Diff.Metric.ParseThreshold(*optionThreshold) // validated by validateOptions
+	}
+	opts.Diff.NoiseWindowSize = *optionNoiseWindowSize
+	opts.Diff.NoiseMinDiffRatio = *optionNoiseMinRatio
+	opts.Diff.Despeckle = *optionDespeckle
+	opts.Diff.Close = *optionClose
+	opts.Diff.VerifyClean = *optionVerifyClean
+	opts.PHashPrefilter = *optionPHashPrefilter
+	opts.HistogramOnly = *optionHistogramOnly
+	opts.HistogramMaxDistance = *optionHistogramMax
+	opts.SizeMismatch = core.SizeMismatch(*optionSizeMismatch)
+	opts.PadColor, _ = parsePadColor(*optionPadColor) // validated by validateOptions
+	opts.PadIgnore = *optionPadIgnore
+	opts.AutoScale = *optionAutoScale
+	opts.Diff.MaxDiffRatio = *optionMaxDiffRatio
+	opts.Diff.MaxDiffPixels = *optionMaxDiffPixels
+	opts.Diff.Grayscale = *optionGrayscale
+	opts.Diff.Normalize = *optionNormalize
+	opts.Diff.IgnoreAntialiasing = *optionIgnoreAA
+	opts.Diff.ChannelThresholds, _ = parseChannelThresholds(*optionThresholdRGBA)
+	opts.Diff.IgnoreAlpha = *optionIgnoreAlpha
+	opts.Diff.IgnoreMaskPath = *optionIgnoreMask
+	opts.Diff.IgnoreRects, _ = parseRects(*optionIgnoreRects)
+	opts.Region.MinArea = *optionMinRegionArea
+	opts.Region.MinPixels = *optionMinRegionPixels
+	opts.Region.MaxRegions = *optionMaxRegions
+	opts.Region.ConnectDistance = *optionConnectDistance
+	opts.Region.Padding = *optionRegionPadding
+	opts.Region.MinSize = *optionMinRegionSize
+	opts.Region.MergeDistance = *optionMergeDistance
+	opts.Region.TileSize = *optionTileSize
+	opts.Region.Outline = core.RegionOutline(*optionOutline)
+	opts.Region.ContourEpsilon = *optionContourEpsilon
 	opts.Render.DrawOverlay = !*optionNoOverlay
-	opts.Render.OverlayAlpha = transparency
 	opts.Render.TintEnabled = !*optionDisableTint
 	opts.Render.TintColor = color.NRGBA{uint8(r), uint8(g), uint8(b), 255}
-	opts.Render.TintStrength = tintStrength
-	opts.Render.TintTransparency = tintTransparency
+	// A preset replaces the overlay defaults; explicitly given values still win.
+	preset := *optionOverlayPreset != ""
+	opts.Render.ApplyOverlayPreset(core.OverlayPreset(*optionOverlayPreset))
+	if !preset || isFlagSet("ot", "overlay-transparency") {
+		opts.Render.OverlayAlpha = *optionTransparency
+	}
+	if !preset || isFlagSet("ts", "tint-strength") {
+		opts.Render.TintStrength = *optionTintStrength
+	}
+	if !preset || isFlagSet("tw", "tint-weight") {
+		opts.Render.TintTransparency = *optionTintTransparency
+	}
 	opts.Render.Layout = layout
+	opts.Render.Captions = !*optionCaptionsDisable
+	opts.Render.BorderColor = color.NRGBA{uint8(br), uint8(bg), uint8(bb), 255}
+	opts.Render.BorderWidth = *optionBorderThickness
+	opts.Render.Labels = *optionLabels
+	opts.Render.FillAlpha = *optionFillAlpha
+	opts.Render.Base = core.RenderBase(*optionBase)
+	opts.Render.HatchUncovered = *optionHatchUncovered
+	opts.Render.HatchIgnored = *optionHatchIgnored
+	opts.Render.GridShading = *optionGridShading
 	opts.Runtime.Workers = *optionNumCPU
+	if opts.Runtime.Workers == 0 {
+		opts.Runtime.Workers = runtime.NumCPU()
+	}
+	opts.Runtime.ReportMemory = *optionReportMemory
 	opts.Output.Path = *optionOutput
+	opts.Output.PathA = *optionOutputA
+	opts.Output.Crop = *optionCropOutput
+	opts.Output.CropMargin = *optionCropMargin
+	opts.Output.CropDir = *optionCropEach
+	opts.Output.ScoreSurfacePath = *optionDebugScoreSurface
+	opts.Output.MaskPath = *optionMask
+	opts.Output.HeatmapPath = *optionHeatmap
+	opts.Render.HeatmapGradient = parseHeatmapGradient(*optionHeatmapGradient)
+	opts.Render.HeatmapOverlay = *optionHeatmapOverlay
+	opts.Output.BlinkPath = *optionBlink
+	opts.Output.BlinkDelay = time.Duration(*optionBlinkDelay) * time.Millisecond
+	opts.Output.AnalysisPath = *optionSaveAnalysis
+	opts.Output.DirectWrite = *optionDirectWrite
+	opts.Output.NoOverwrite = *optionNoOverwrite
+	opts.Output.NoMkdir = *optionNoMkdir
+	opts.Output.SkipIdentical = *optionSkipSame
+	opts.Output.JPEGQuality = *optionJPEGQuality
+	opts.Output.PNGCompression = core.PNGCompression(*optionPNGCompression)
+	opts.Output.Version = buildVersion()
+	opts.Output.StampVersion = *optionStampVersion
 
 	return opts
 }
 
-func parseTintColor(colorStr string) (r, g, b int) {
-	r, g, b = 255, 0, 0
-	parts := strings.Split(colorStr, ",")
-	if len(parts) != 3 {
-		fmt.Printf("[WARNING] Invalid tint color format '%s'. Using default (255,0,0).\n", colorStr)
-		return
+// parseOffset parses an "X,Y" offset; either value may be negative.
+func parseOffset(s string) (image.Point, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) == 2 {
+		x, errX := strconv.Atoi(strings.TrimSpace(parts[0]))
+		y, errY := strconv.Atoi(strings.TrimSpace(parts[1]))
+		if errX == nil && errY == nil {
+			return image.Pt(x, y), nil
+		}
+	}
+	return image.Point{}, fmt.Errorf("invalid offset '%s'. Must be X,Y (e.g. 0,-12)", s)
+}
+
+// parseChannelThresholds parses the --threshold-rgba value; an empty value
+// means no per-channel thresholds.
+func parseChannelThresholds(s string) (*[4]uint8, error) {
+	if s == "" {
+		return nil, nil
+	}
+	parts := strings.Split(s, ",")
+	if len(parts) != 4 {
+		return nil, fmt.Errorf("invalid channel thresholds '%s'. Must be R,G,B,A (e.g. 20,40,40,0)", s)
+	}
+	var t [4]uint8
+	for i, p := range parts {
+		n, err := strconv.Atoi(strings.TrimSpace(p))
+		if err != nil || n < 0 || n > 255 {
+			return nil, fmt.Errorf("invalid channel thresholds '%s': '%s' is not an integer between 0 and 255", s, strings.TrimSpace(p))
+		}
+		t[i] = uint8(n)
+	}
+	return &t, nil
+}
+
+// parseROI parses the --roi rectangle; an empty value means no ROI.
+func parseROI(s string) (image.Rectangle, error) {
+	if s == "" {
+		return image.Rectangle{}, nil
 	}
-	var err error
-	if r, err = strconv.Atoi(strings.TrimSpace(parts[0])); err != nil {
-		r = 255
+	rects, err := parseRects([]string{s})
+	if err != nil {
+		return image.Rectangle{}, err
 	}
-	if g, err = strconv.Atoi(strings.TrimSpace(parts[1])); err != nil {
-		g = 0
+	return rects[0], nil
+}
+
+// parseGrid parses the --grid size; an empty value means no grid.
+func parseGrid(s string) (core.GridSize, error) {
+	if s == "" {
+		return core.GridSize{}, nil
 	}
-	if b, err = strconv.Atoi(strings.TrimSpace(parts[2])); err != nil {
-		b = 0
+	return core.ParseGridSize(s)
+}
+
+// parseRects parses X,Y,W,H rectangles given with --ignore-rect.
+func parseRects(values []string) ([]image.Rectangle, error) {
+	var rects []image.Rectangle
+	for _, s := range values {
+		r, err := core.ParseRect(s)
+		if err != nil {
+			return nil, err
+		}
+		rects = append(rects, r)
 	}
-	r = clampInt(r, 0, 255)
-	g = clampInt(g, 0, 255)
-	b = clampInt(b, 0, 255)
-	return
+	return rects, nil
 }
 
-func clampInt(v, lo, hi int) int {
-	if v < lo {
-		return lo
+// parsePadColor parses the --pad-color R,G,B or R,G,B,A components (0-255).
+func parsePadColor(s string) (color.NRGBA, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 3 && len(parts) != 4 {
+		return color.NRGBA{}, fmt.Errorf("invalid pad color '%s'. Must be R,G,B or R,G,B,A", s)
 	}
-	if v > hi {
-		return hi
+	c := [4]uint8{3: 255}
+	for i, p := range parts {
+		v, err := strconv.Atoi(strings.TrimSpace(p))
+		if err != nil || v < 0 || v > 255 {
+			return color.NRGBA{}, fmt.Errorf("invalid pad color '%s': components must be integers from 0 to 255", s)
+		}
+		c[i] = uint8(v)
 	}
-	return v
+	return color.NRGBA{c[0], c[1], c[2], c[3]}, nil
 }
 
-func clampF64(v, lo, hi float64) float64 {
-	if v < lo {
-		return lo
+// parseRGB parses the R,G,B value of the color flag named name.
+func parseRGB(name, colorStr string) (r, g, b int, err error) {
+	parts := strings.Split(colorStr, ",")
+	if len(parts) != 3 {
+		return 0, 0, 0, fmt.Errorf("--%s must be R,G,B, got '%s'", name, colorStr)
 	}
-	if v > hi {
-		return hi
+	var c [3]int
+	for i, p := range parts {
+		v, err := strconv.Atoi(strings.TrimSpace(p))
+		if err != nil || v < 0 || v > 255 {
+			return 0, 0, 0, fmt.Errorf("--%s components must be integers between 0 and 255, got '%s'", name, colorStr)
+		}
+		c[i] = v
 	}
-	return v
+	return c[0], c[1], c[2], nil
+}
+
+func parseHeatmapGradient(s string) []color.NRGBA {
+	ramp, err := render.ParseColorRamp(s)
+	if err != nil {
+		con.Warnf("Invalid heatmap gradient '%s' (%v). Using default.", s, err)
+		return nil
+	}
+	return ramp
+}
+
+// axisMaxOffset returns the per-axis search limit, falling back to the
+// --max-offset shorthand when the axis flag is negative (unset).
+func axisMaxOffset(axis, shorthand int) int {
+	if axis < 0 {
+		return max(0, shorthand)
+	}
+	return axis
+}
+
+// isFlagSet reports whether any of the given flag names was passed on the command line.
+func isFlagSet(names ...string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if slices.Contains(names, f.Name) {
+			set = true
+		}
+	})
+	return set
 }
 
 // =======================================
@@ -222,12 +1051,28 @@ func defineFlagValue[T comparable](short, long, description string, defaultValue
 	return f
 }
 
+// listValue collects every occurrence of a repeatable flag.
+type listValue []string
+
+func (l *listValue) String() string     { return strings.Join(*l, " ") }
+func (l *listValue) Set(s string) error { *l = append(*l, s); return nil }
+func (l *listValue) Get() any           { return append([]string{}, *l...) }
+
+// defineListFlag registers a repeatable string flag under both names.
+func defineListFlag(short, long, description string) *listValue {
+	l := &listValue{}
+	flag.Var(l, long, short+UsageDummy+description)
+	flag.Var(l, short, UsageDummy)
+	return l
+}
+
 func customUsage(description string) func() {
 	return func() {
 		optionsUsage, requiredOptionExample := getOptionsUsage(false)
 		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s %s[OPTIONS]\n  version: %s\n\n", func() string { e, _ := os.Executable(); return filepath.Base(e) }(), requiredOptionExample, version)
 		fmt.Fprintf(flag.CommandLine.Output(), "Description:\n  %s\n\n", description)
-		fmt.Fprintf(flag.CommandLine.Output(), "Options:\n%s", optionsUsage)
+		fmt.Fprintf(flag.CommandLine.Output(), "Options:\n%s\n", optionsUsage)
+		fmt.Fprint(flag.CommandLine.Output(), exitStatusUsage)
 	}
 }
 
@@ -236,7 +1081,7 @@ func getOptionsUsage(currentValue bool) (string, string) {
 	optionNameWidth := 0
 	usages := make([]string, 0)
 	getType := func(v string) string {
-		return strings.NewReplacer("*flag.boolValue", "", "*flag.", "<", "Value", ">").Replace(v)
+		return strings.NewReplacer("*flag.boolValue", "", "*flag.", "<", "*main.", "<", "Value", ">").Replace(v)
 	}
 	flag.VisitAll(func(f *flag.Flag) {
 		optionNameWidth = max(optionNameWidth, len(fmt.Sprintf("%s %s", f.Name, getType(fmt.Sprintf("%T", f.Value))))+4)
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/xshoji/go-img-diff/imgdiff"
+	"github.com/xshoji/go-img-diff/internal/core"
+	"github.com/xshoji/go-img-diff/internal/imgio"
+	"github.com/xshoji/go-img-diff/internal/report"
+)
+
+// needsRegions reports whether any requested artifact, or the --fail-on
+// policy, requires the full pipeline (region extraction and rendering) even
+// in exit-on-diff mode.
+func needsRegions() bool {
+	policy, _ := report.ParseFailPolicy(*optionFailOn)
+	return *optionHTMLReport != "" || *optionRegionsCSV != "" || *optionJSONReport != "" || *optionCompareReport != "" || *optionOutputBundle != "" || *optionSaveAnalysis != "" || policy.NeedsRegions()
+}
+
+// checkReportOutputs verifies that every requested report file can be written
+// before the analysis starts. The bundle directory is created on demand.
+func checkReportOutputs() error {
+	for _, path := range []string{*optionHTMLReport, *optionRegionsCSV, *optionJSONReport} {
+		if path == "" {
+			continue
+		}
+		if err := imgio.CheckWritable(path, outputWriteMode()); err != nil {
+			return fmt.Errorf("report check failed: %w", err)
+		}
+	}
+	return nil
+}
+
+// writeReports writes every requested report artifact and returns the
+// structured report (also when no JSON file was requested).
+func writeReports(opts core.Options, result *core.Result) (*report.Report, error) {
+	rep := report.Build(opts, result)
+
+	if *optionCompareReport != "" {
+		prev, err := report.Load(*optionCompareReport)
+		if err != nil {
+			return nil, err
+		}
+		c := rep.CompareWith(prev, *optionCompareReport)
+		con.Printf("Compared with %s: %d recurring, %d new region(s)", *optionCompareReport, c.Recurring, c.New)
+	}
+
+	if *optionHTMLReport != "" {
+		if err := writeFile(*optionHTMLReport, func(w io.Writer) error { return imgdiff.WriteHTMLReport(w, result, opts) }); err != nil {
+			return nil, err
+		}
+		con.Printf("HTML report saved to %s", *optionHTMLReport)
+	}
+
+	if *optionRegionsCSV != "" {
+		if err := writeFile(*optionRegionsCSV, func(w io.Writer) error { return imgdiff.WriteRegionsCSV(w, result) }); err != nil {
+			return nil, err
+		}
+		con.Printf("Regions CSV saved to %s", *optionRegionsCSV)
+	}
+
+	if *optionJSONReport != "" {
+		if err := rep.Save(*optionJSONReport, outputWriteMode()); err != nil {
+			return nil, err
+		}
+		con.Printf("JSON report saved to %s", *optionJSONReport)
+	}
+
+	if *optionOutputBundle != "" {
+		if err := writeBundle(*optionOutputBundle, opts, result); err != nil {
+			return nil, err
+		}
+		con.Printf("Review bundle saved to %s", *optionOutputBundle)
+	}
+
+	return rep, nil
+}
+
+// writeBundle stores every artifact of the review bundle under dir.
+func writeBundle(dir string, opts core.Options, result *core.Result) error {
+	bundle, err := imgdiff.NewReviewBundle(result, opts, imgdiff.DefaultBundleOptions())
+	if err != nil {
+		return fmt.Errorf("failed to build review bundle: %w", err)
+	}
+	for _, a := range bundle.Artifacts {
+		path := filepath.Join(dir, filepath.FromSlash(a.Name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return fmt.Errorf("failed to create bundle directory: %w", err)
+		}
+		if err := writeFile(path, func(w io.Writer) error { _, err := w.Write(a.Data); return err }); err != nil {
+			return fmt.Errorf("failed to write bundle artifact: %w", err)
+		}
+	}
+	return nil
+}
+
+// writeFile creates path and fills it with write, honoring --direct-write.
+func writeFile(path string, write func(w io.Writer) error) error {
+	return imgio.WriteFile(path, outputWriteMode(), func(w io.Writer) error {
+		if err := write(w); err != nil {
+			return fmt.Errorf("failed to write %s: %w", path, err)
+		}
+		return nil
+	})
+}
+
+// outputWriteMode returns how report files are written.
+func outputWriteMode() imgio.WriteMode {
+	return imgio.OutputWriteMode(core.OutputOptions{DirectWrite: *optionDirectWrite, NoOverwrite: *optionNoOverwrite, NoMkdir: *optionNoMkdir})
+}
@@ -0,0 +1,982 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/xshoji/go-img-diff/internal/progress"
+)
+
+// resetFlags gives every option its default value and clears which ones
+// were set, so that each call of run starts from a fresh command line. The
+// new flag set returns parse errors instead of exiting, and the console
+// output is discarded.
+func resetFlags(t *testing.T) {
+	t.Helper()
+	fs := flag.NewFlagSet("imgdiff", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	flag.CommandLine.VisitAll(func(f *flag.Flag) {
+		if strings.HasPrefix(f.Name, "test.") {
+			return // registered by the testing package
+		}
+		if l, ok := f.Value.(*listValue); ok {
+			*l = nil
+		} else if err := f.Value.Set(f.DefValue); err != nil {
+			t.Fatalf("reset %s: %v", f.Name, err)
+		}
+		fs.Var(f.Value, f.Name, f.Usage)
+	})
+	flag.CommandLine = fs
+	con = &console{out: io.Discard, err: io.Discard}
+}
+
+// writePNG writes a 64x48 gradient to path with rect painted white.
+func writePNG(t *testing.T, path string, rect image.Rectangle) {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, 64, 48))
+	for y := 0; y < 48; y++ {
+		for x := 0; x < 64; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{uint8(4 * x), uint8(5 * y), 90, 255})
+		}
+	}
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{255, 255, 255, 255})
+		}
+	}
+	encodePNG(t, path, img)
+}
+
+// encodePNG writes img to path as a PNG.
+func encodePNG(t *testing.T, path string, img image.Image) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := png.Encode(f, img); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRun_ExitCodes(t *testing.T) {
+	dir := t.TempDir()
+	base, same, changed := filepath.Join(dir, "base.png"), filepath.Join(dir, "same.png"), filepath.Join(dir, "changed.png")
+	writePNG(t, base, image.Rectangle{})
+	writePNG(t, same, image.Rectangle{})
+	writePNG(t, changed, image.Rect(20, 20, 30, 28)) // 80 of 3072 pixels, one region
+	tiny := filepath.Join(dir, "tiny.png")
+	writePNG(t, tiny, image.Rect(41, 17, 43, 19)) // 2x2 pixels, the smallest default region
+	pixel := filepath.Join(dir, "pixel.png")
+	writePNG(t, pixel, image.Rect(63, 47, 64, 48)) // the bottom right pixel, too small for a region
+	broken := filepath.Join(dir, "broken.png")
+	if err := os.WriteFile(broken, []byte("not a png"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	config := filepath.Join(dir, "bad.json")
+	if err := os.WriteFile(config, []byte(`{"diff-treshold": 1}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	small := filepath.Join(dir, "small.png")
+	encodePNG(t, small, image.NewNRGBA(image.Rect(0, 0, 64, 40)))
+	double := filepath.Join(dir, "double.png") // base at twice the size
+	doubled := image.NewNRGBA(image.Rect(0, 0, 128, 96))
+	for y := 0; y < 96; y++ {
+		for x := 0; x < 128; x++ {
+			doubled.SetNRGBA(x, y, color.NRGBA{uint8(4 * (x / 2)), uint8(5 * (y / 2)), 90, 255})
+		}
+	}
+	encodePNG(t, double, doubled)
+	out := filepath.Join(dir, "diff.png")
+
+	tests := []struct {
+		name      string
+		args      []string
+		code      int
+		wantErr   bool
+		showUsage bool
+	}{
+		{"identical", []string{"-q", "-e", "-i1", base, "-i2", same}, exitCodeOK, false, false},
+		{"differences without -e", []string{"-q", "-i1", base, "-i2", changed, "-o", out}, exitCodeOK, false, false},
+		{"differences with -e", []string{"-q", "-e", "-i1", base, "-i2", changed}, exitCodeDiff, false, false},
+		{"2x2 change with -e", []string{"-q", "-e", "-i1", base, "-i2", tiny}, exitCodeDiff, false, false},
+		{"1 px change in the corner with -e", []string{"-q", "-e", "-i1", base, "-i2", pixel}, exitCodeDiff, false, false},
+		{"2x2 change below --min-region-area", []string{"-q", "-e", "-ra", "5", "-i1", base, "-i2", tiny}, exitCodeDiff, false, false},
+		{"2x2 change below --min-region-area with --fail-on regions>0", []string{"-q", "-e", "-ra", "5", "-fp", "regions>0", "-i1", base, "-i2", tiny}, exitCodeOK, false, false},
+		{"2x2 change removed by --despeckle", []string{"-q", "-e", "-sp", "1", "-i1", base, "-i2", tiny}, exitCodeOK, false, false},
+		{"2x2 change kept by --close", []string{"-q", "-e", "-cl", "2", "-i1", base, "-i2", tiny}, exitCodeDiff, false, false},
+		{"2x2 change suppressed by --min-region-pixels", []string{"-q", "-e", "-px", "5", "-i1", base, "-i2", tiny}, exitCodeDiff, false, false},
+		{"2x2 change suppressed by --min-region-pixels with --fail-on regions>0", []string{"-q", "-e", "-px", "5", "-fp", "regions>0", "-i1", base, "-i2", tiny}, exitCodeOK, false, false},
+		{"2x2 change kept by --min-region-pixels 4", []string{"-q", "-e", "-px", "4", "-i1", base, "-i2", tiny}, exitCodeDiff, false, false},
+		{"negative --min-region-pixels", []string{"-q", "-e", "-px", "-1", "-i1", base, "-i2", tiny}, exitCodeUsage, true, false},
+		{"negative --max-regions", []string{"-q", "-e", "-rn", "-1", "-i1", base, "-i2", tiny}, exitCodeUsage, true, false},
+		{"negative --despeckle", []string{"-q", "-e", "-sp", "-1", "-i1", base, "-i2", tiny}, exitCodeUsage, true, false},
+		{"regions within --fail-on", []string{"-q", "-e", "-fp", "regions>1", "-i1", base, "-i2", changed}, exitCodeOK, false, false},
+		{"regions beyond --fail-on", []string{"-q", "-e", "-fp", "regions>0", "-i1", base, "-i2", changed}, exitCodeDiff, false, false},
+		{"ratio within --fail-on", []string{"-q", "-e", "--fail-on", "ratio>0.05", "-i1", base, "-i2", changed}, exitCodeOK, false, false},
+		{"ratio beyond --fail-on", []string{"-q", "-e", "--fail-on", "ratio>0.01", "-i1", base, "-i2", changed}, exitCodeDiff, false, false},
+		{"help", []string{"-h"}, exitCodeOK, false, false},
+		{"unknown flag", []string{"--no-such-flag"}, exitCodeUsage, false, false},
+		{"malformed value", []string{"-m", "high", "-i1", base, "-i2", same, "-e"}, exitCodeUsage, false, false},
+		{"missing inputs", []string{"-q", "-e"}, exitCodeUsage, true, true},
+		{"invalid --fail-on", []string{"-q", "-e", "-fp", "pixels>3", "-i1", base, "-i2", same}, exitCodeUsage, true, false},
+		{"--fail-on without -e", []string{"-q", "-fp", "regions>3", "-i1", base, "-i2", same, "-o", out}, exitCodeUsage, true, false},
+		{"out of range option", []string{"-q", "-ot", "2", "-i1", base, "-i2", same, "-o", out}, exitCodeUsage, true, false},
+		{"invalid config", []string{"-q", "-cf", config, "-i1", base, "-i2", same, "-e"}, exitCodeUsage, true, false},
+		{"size mismatch warned", []string{"-q", "-e", "-i1", base, "-i2", small}, exitCodeDiff, false, false},
+		{"size mismatch padded", []string{"-q", "-e", "-sm", "pad", "-i1", base, "-i2", small}, exitCodeDiff, false, false},
+		{"size mismatch error", []string{"-q", "-e", "-sm", "error", "-i1", base, "-i2", small}, exitCodeUsage, true, false},
+		{"2x scale without --auto-scale", []string{"-q", "-e", "-i1", double, "-i2", base}, exitCodeDiff, false, false},
+		{"2x scale with --auto-scale", []string{"-q", "-e", "-au", "-i1", double, "-i2", base}, exitCodeOK, false, false},
+		{"half scale with --auto-scale", []string{"-q", "-e", "--auto-scale", "-i1", base, "-i2", double}, exitCodeOK, false, false},
+		{"non-uniform sizes with --auto-scale", []string{"-q", "-e", "-au", "-i1", base, "-i2", small}, exitCodeUsage, true, false},
+		{"invalid --size-mismatch", []string{"-q", "-e", "-sm", "crop", "-i1", base, "-i2", small}, exitCodeUsage, true, false},
+		{"--pad-color without pad", []string{"-q", "-e", "-pb", "0,0,0", "-i1", base, "-i2", small}, exitCodeUsage, true, false},
+		{"invalid --pad-color", []string{"-q", "-e", "-sm", "pad", "-pb", "0,0,256", "-i1", base, "-i2", small}, exitCodeUsage, true, false},
+		{"missing input", []string{"-q", "-e", "-i1", filepath.Join(dir, "missing.png"), "-i2", same}, exitCodeError, true, false},
+		{"undecodable input", []string{"-q", "-e", "-i1", base, "-i2", broken}, exitCodeError, true, false},
+		{"output directory created", []string{"-q", "-i1", base, "-i2", changed, "-o", filepath.Join(dir, "new", "dir", "diff.png")}, exitCodeOK, false, false},
+		{"missing output directory with --no-mkdir", []string{"-q", "-nm", "-i1", base, "-i2", changed, "-o", filepath.Join(dir, "no", "such", "dir.png")}, exitCodeError, true, false},
+		{"existing output with --no-overwrite", []string{"-q", "-no", "-i1", base, "-i2", changed, "-o", same}, exitCodeError, true, false},
+		{"rejected offset", []string{"-q", "-e", "-ma", "1", "-fo", "0,5", "-i1", base, "-i2", same}, exitCodeError, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetFlags(t)
+			code, err := run(tt.args)
+			if code != tt.code || (err != nil) != tt.wantErr {
+				t.Fatalf("run() = %d, %v; want %d with error %v", code, err, tt.code, tt.wantErr)
+			}
+			if got := errors.As(err, new(usageError)); got != tt.showUsage {
+				t.Errorf("usage shown = %v, want %v (err %v)", got, tt.showUsage, err)
+			}
+		})
+	}
+}
+
+func TestRun_FlagRanges(t *testing.T) {
+	dir := t.TempDir()
+	base := filepath.Join(dir, "base.png")
+	writePNG(t, base, image.Rectangle{})
+
+	tests := []struct {
+		args []string
+		want []string
+	}{
+		{[]string{"-c", "-1"}, []string{"--cpu must be at least 0, got -1"}},
+		{[]string{"-m", "-5"}, []string{"--max-offset must be at least 0, got -5"}},
+		{[]string{"-mx", "-2"}, []string{"--max-offset-x must be at least -1, got -2"}},
+		{[]string{"-d", "256"}, []string{"--diff-threshold: threshold 256 is not between 0 and 255"}},
+		{[]string{"-d", "101%"}, []string{"--diff-threshold: threshold 101% is not between 0% and 100%"}},
+		{[]string{"-d", "12 percent"}, []string{"invalid threshold '12 percent'"}},
+		{[]string{"-ot", "1.5"}, []string{"--overlay-transparency must be between 0.0 and 1.0, got 1.5"}},
+		{[]string{"-ts", "-0.1"}, []string{"--tint-strength must be between 0.0 and 1.0, got -0.1"}},
+		{[]string{"-tw", "2"}, []string{"--tint-weight must be between 0.0 and 1.0, got 2"}},
+		{[]string{"-jq", "0"}, []string{"--jpeg-quality must be between 1 and 100, got 0"}},
+		{[]string{"-pz", "max"}, []string{"invalid PNG compression 'max'"}},
+		{[]string{"-tl", "-64"}, []string{"--tile-size must be at least 0, got -64"}},
+		{[]string{"-mc", "-1"}, []string{"--min-confidence must be 0 (disabled) or at least 1.0, got -1"}},
+		{[]string{"-af", "0.5"}, []string{"--max-aspect-factor must be 0 (disabled) or at least 1.0, got 0.5"}},
+		{[]string{"-sw", "0"}, []string{"--strip-width must be at least 1, got 0"}},
+		{[]string{"-lr", "0"}, []string{"--local-align-radius must be at least 1, got 0"}},
+		{[]string{"-bd", "-1"}, []string{"--blink-delay must be at least 10, got -1"}},
+		{[]string{"-rd", "0"}, []string{"--region-connect-distance must be at least 1, got 0"}},
+		{[]string{"-tc", "0,300,0"}, []string{"--tint-color components must be integers between 0 and 255, got '0,300,0'"}},
+		{[]string{"-bc", "red"}, []string{"--border-color must be R,G,B, got 'red'"}},
+		{[]string{"-pd", "-5"}, []string{"--max-pair-diff-percent must be between 0 and 100, got -5"}},
+		{
+			[]string{"-ra", "-1", "-bt", "-3", "-nr", "1.1"},
+			[]string{"--min-region-area must be at least 0", "--border-thickness must be at least 0", "--noise-min-ratio must be between"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.args, " "), func(t *testing.T) {
+			resetFlags(t)
+			code, err := run(append([]string{"-q", "-e", "-i1", base, "-i2", base}, tt.args...))
+			if code != exitCodeUsage || err == nil {
+				t.Fatalf("run() = %d, %v; want %d with an error", code, err, exitCodeUsage)
+			}
+			for _, w := range tt.want {
+				if !strings.Contains(err.Error(), w) {
+					t.Errorf("error %q does not contain %q", err, w)
+				}
+			}
+		})
+	}
+
+	t.Run("cpu 0 uses every core", func(t *testing.T) {
+		resetFlags(t)
+		if code, err := run([]string{"-q", "-e", "-c", "0", "-i1", base, "-i2", base}); code != exitCodeOK || err != nil {
+			t.Fatalf("run() = %d, %v; want %d", code, err, exitCodeOK)
+		}
+	})
+}
+
+func TestRun_ExitOnDiffStillWritesOutputs(t *testing.T) {
+	dir := t.TempDir()
+	base, changed := filepath.Join(dir, "base.png"), filepath.Join(dir, "changed.png")
+	writePNG(t, base, image.Rectangle{})
+	writePNG(t, changed, image.Rect(20, 20, 30, 28))
+	out, jsonReport := filepath.Join(dir, "diff.png"), filepath.Join(dir, "report.json")
+
+	resetFlags(t)
+	code, err := run([]string{"-q", "-e", "-i1", base, "-i2", changed, "-o", out, "-jr", jsonReport})
+	if code != exitCodeDiff || err != nil {
+		t.Fatalf("run() = %d, %v; want %d", code, err, exitCodeDiff)
+	}
+	for _, path := range []string{out, jsonReport} {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("output not written before exiting: %v", err)
+		}
+	}
+}
+
+func TestRun_DiffWithoutRegionWarned(t *testing.T) {
+	// A 1 px change fails -e although it is too small to be drawn as a
+	// region, and the warning says why.
+	dir := t.TempDir()
+	base, pixel := filepath.Join(dir, "base.png"), filepath.Join(dir, "pixel.png")
+	writePNG(t, base, image.Rectangle{})
+	writePNG(t, pixel, image.Rect(30, 20, 31, 21))
+
+	resetFlags(t)
+	var stdout, stderr strings.Builder
+	con.out, con.err = &stdout, &stderr
+	if code, err := run([]string{"-e", "-i1", base, "-i2", pixel}); code != exitCodeDiff || err != nil {
+		t.Fatalf("run() = %d, %v; want %d", code, err, exitCodeDiff)
+	}
+	if want := "[WARNING] 1 differing pixels form no region"; !strings.Contains(stderr.String(), want) {
+		t.Errorf("stderr lacks %q:\n%s", want, stderr.String())
+	}
+	if want := "RESULT: 0 diff region(s)"; !strings.Contains(stdout.String(), want) {
+		t.Errorf("stdout lacks %q:\n%s", want, stdout.String())
+	}
+}
+
+func TestRun_ForcedOffsetWithoutOverlap(t *testing.T) {
+	// An offset beyond the images is scored 0 instead of crashing.
+	dir := t.TempDir()
+	base, jsonReport := filepath.Join(dir, "base.png"), filepath.Join(dir, "report.json")
+	writePNG(t, base, image.Rectangle{})
+
+	resetFlags(t)
+	if code, err := run([]string{"-q", "-fo", "200,200", "-i1", base, "-i2", base, "-o", filepath.Join(dir, "diff.png"), "-jr", jsonReport}); code != exitCodeOK || err != nil {
+		t.Fatalf("run() = %d, %v; want %d", code, err, exitCodeOK)
+	}
+	data, err := os.ReadFile(jsonReport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rep struct {
+		Offset struct{ X, Y int } `json:"offset"`
+		Score  *float64           `json:"score"`
+	}
+	if err := json.Unmarshal(data, &rep); err != nil {
+		t.Fatal(err)
+	}
+	if rep.Offset.X != 200 || rep.Offset.Y != 200 || rep.Score == nil || *rep.Score != 0 {
+		t.Errorf("offset %+v score %v, want (200,200) scored 0", rep.Offset, rep.Score)
+	}
+}
+
+func TestRun_BatchExitCodes(t *testing.T) {
+	root := t.TempDir()
+	dir1, dir2 := filepath.Join(root, "before"), filepath.Join(root, "after")
+	for _, d := range []string{dir1, dir2} {
+		if err := os.Mkdir(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writePNG(t, filepath.Join(dir1, "home.png"), image.Rectangle{})
+	writePNG(t, filepath.Join(dir2, "home.png"), image.Rect(20, 20, 30, 28))
+
+	resetFlags(t)
+	if code, err := run([]string{"-q", "-e", "-d1", dir1, "-d2", dir2}); code != exitCodeDiff || err != nil {
+		t.Errorf("failed gate: run() = %d, %v; want %d", code, err, exitCodeDiff)
+	}
+	resetFlags(t)
+	if code, err := run([]string{"-q", "-e", "-mf", "1", "-d1", dir1, "-d2", dir2}); code != exitCodeOK || err != nil {
+		t.Errorf("tolerated pair: run() = %d, %v; want %d", code, err, exitCodeOK)
+	}
+	resetFlags(t)
+	if code, err := run([]string{"-q", "-e", "-fp", "regions>3", "-d1", dir1, "-d2", dir2}); code != exitCodeUsage || err == nil {
+		t.Errorf("--fail-on in batch mode: run() = %d, %v; want %d", code, err, exitCodeUsage)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir2, "home.png"), []byte("not a png"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// A pair that cannot be compared exits with status 3, also without -e.
+	for _, args := range [][]string{{"-e"}, {"-ou", t.TempDir()}} {
+		resetFlags(t)
+		if code, _ := run(append([]string{"-q", "-d1", dir1, "-d2", dir2}, args...)); code != exitCodeError {
+			t.Errorf("undecodable pair with %v: run() = %d, want %d", args, code, exitCodeError)
+		}
+	}
+	resetFlags(t)
+	// A gate that tolerates the pair does not hide the failure.
+	if code, err := run([]string{"-q", "-e", "-mf", "1", "-d1", dir1, "-d2", dir2}); code != exitCodeError || err != nil {
+		t.Errorf("undecodable pair within the gate: run() = %d, %v; want %d", code, err, exitCodeError)
+	}
+
+	// Files found in only one directory are recorded as not_found errors and
+	// follow the same rule.
+	writePNG(t, filepath.Join(dir2, "home.png"), image.Rectangle{})
+	writePNG(t, filepath.Join(dir1, "only.png"), image.Rectangle{})
+	resetFlags(t)
+	if code, _ := run([]string{"-q", "-e", "-d1", dir1, "-d2", dir2}); code != exitCodeError {
+		t.Errorf("missing pair: run() = %d, want %d", code, exitCodeError)
+	}
+	resetFlags(t)
+	if code, err := run([]string{"-q", "-e", "-mf", "50%", "-d1", dir1, "-d2", dir2}); code != exitCodeError || err != nil {
+		t.Errorf("missing pair within the gate: run() = %d, %v; want %d", code, err, exitCodeError)
+	}
+}
+
+func TestRun_BatchFailFast(t *testing.T) {
+	root := t.TempDir()
+	dir1, dir2 := filepath.Join(root, "before"), filepath.Join(root, "after")
+	for _, d := range []string{dir1, dir2} {
+		if err := os.Mkdir(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		writePNG(t, filepath.Join(d, "a.png"), image.Rectangle{})
+		writePNG(t, filepath.Join(d, "b.png"), image.Rectangle{})
+		writePNG(t, filepath.Join(d, "c.png"), image.Rectangle{})
+	}
+	writePNG(t, filepath.Join(dir2, "a.png"), image.Rect(20, 20, 30, 28))
+	if err := os.WriteFile(filepath.Join(dir2, "b.png"), []byte("not a png"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	type summary struct {
+		PairsCompared int `json:"pairs_compared"`
+		Pairs         []struct {
+			Name      string `json:"name"`
+			Error     string `json:"error"`
+			ErrorKind string `json:"error_kind"`
+		} `json:"pairs"`
+	}
+	runBatch := func(extra ...string) summary {
+		t.Helper()
+		out := filepath.Join(t.TempDir(), "out")
+		resetFlags(t)
+		// A failed pair exits with the error status, not the diff one.
+		if code, err := run(append([]string{"-q", "-e", "-jb", "1", "-d1", dir1, "-d2", dir2, "-ou", out}, extra...)); code != exitCodeError || err != nil {
+			t.Fatalf("run(%v) = %d, %v; want %d", extra, code, err, exitCodeError)
+		}
+		data, err := os.ReadFile(filepath.Join(out, "summary.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var s summary
+		if err := json.Unmarshal(data, &s); err != nil {
+			t.Fatal(err)
+		}
+		if len(s.Pairs) != 3 || s.Pairs[1].Name != "b.png" || s.Pairs[1].ErrorKind != "decode" {
+			t.Fatalf("run(%v): pairs = %+v, want b.png to fail to decode", extra, s.Pairs)
+		}
+		return s
+	}
+
+	if s := runBatch(); s.PairsCompared != 2 || s.Pairs[0].Error != "" || s.Pairs[2].Error != "" {
+		t.Errorf("default: %+v, want a.png and c.png compared", s)
+	}
+	if s := runBatch("-ff"); s.PairsCompared != 1 || s.Pairs[2].Error == "" || s.Pairs[2].ErrorKind != "" {
+		t.Errorf("--fail-fast: %+v, want c.png not compared", s)
+	}
+}
+
+func TestRun_BatchOversubscription(t *testing.T) {
+	root := t.TempDir()
+	dir1, dir2 := filepath.Join(root, "before"), filepath.Join(root, "after")
+	for _, d := range []string{dir1, dir2} {
+		if err := os.Mkdir(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		writePNG(t, filepath.Join(d, "a.png"), image.Rectangle{})
+		writePNG(t, filepath.Join(d, "b.png"), image.Rectangle{})
+	}
+	defer func(f func() int) { numCPU = f }(numCPU)
+	numCPU = func() int { return 4 }
+
+	tests := []struct {
+		name     string
+		args     []string
+		perJob   int
+		adjusted bool
+		warning  string
+	}{
+		{"fits", []string{"-jb", "2", "-c", "2"}, 2, false, ""},
+		{"reduced", []string{"-jb", "2", "-c", "4"}, 2, true, "2 job(s) with 4 worker(s) each would oversubscribe the 4 CPU core(s); using 2 worker(s) per pair"},
+		{"--cpu above the cores", []string{"-jb", "2", "-c", "16"}, 2, true, "using 2 worker(s) per pair"},
+		{"kept", []string{"-jb", "2", "-c", "4", "-os"}, 4, false, "2 job(s) with 4 worker(s) each oversubscribe the 4 CPU core(s)."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := filepath.Join(t.TempDir(), "out")
+			resetFlags(t)
+			var stderr strings.Builder
+			con.err = &stderr
+			if code, err := run(append([]string{"-d1", dir1, "-d2", dir2, "-ou", out}, tt.args...)); code != exitCodeOK || err != nil {
+				t.Fatalf("run() = %d, %v", code, err)
+			}
+			data, err := os.ReadFile(filepath.Join(out, "summary.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var rep struct {
+				WorkersPerJob   int  `json:"workers_per_job"`
+				WorkersAdjusted bool `json:"workers_adjusted"`
+				Cores           int  `json:"cores"`
+			}
+			if err := json.Unmarshal(data, &rep); err != nil {
+				t.Fatal(err)
+			}
+			if rep.WorkersPerJob != tt.perJob || rep.WorkersAdjusted != tt.adjusted || rep.Cores != 4 {
+				t.Errorf("summary = %+v, want %d worker(s) per job, adjusted %v, 4 cores", rep, tt.perJob, tt.adjusted)
+			}
+			if got := stderr.String(); tt.warning == "" && strings.Contains(got, "[WARNING]") || !strings.Contains(got, tt.warning) {
+				t.Errorf("stderr = %q, want warning %q", got, tt.warning)
+			}
+		})
+	}
+}
+
+func TestRun_SkipIdentical(t *testing.T) {
+	dir := t.TempDir()
+	base, same, changed := filepath.Join(dir, "base.png"), filepath.Join(dir, "same.png"), filepath.Join(dir, "changed.png")
+	writePNG(t, base, image.Rectangle{})
+	writePNG(t, same, image.Rectangle{})
+	writePNG(t, changed, image.Rect(20, 20, 30, 28))
+
+	tests := []struct {
+		name   string
+		input2 string
+		flags  []string
+		stdout string
+		saved  bool
+	}{
+		{"identical", same, nil, "RESULT: no differences\nDiff image saved to %s\n", true},
+		{"identical, skipped", same, []string{"-si"}, "RESULT: no differences\n", false},
+		{"different, not skipped", changed, []string{"-si"}, "RESULT: 1 diff region(s), 2.6042%% pixels differ, offset (0,0)\nDiff image saved to %s\n", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetFlags(t)
+			var stdout strings.Builder
+			con.out = &stdout
+			out := filepath.Join(t.TempDir(), "diff.png")
+			if code, err := run(append([]string{"-i1", base, "-i2", tt.input2, "-o", out, "-mc", "0"}, tt.flags...)); code != exitCodeOK || err != nil {
+				t.Fatalf("run() = %d, %v", code, err)
+			}
+			want := tt.stdout
+			if tt.saved {
+				want = fmt.Sprintf(tt.stdout, out)
+			}
+			if stdout.String() != want {
+				t.Errorf("stdout = %q, want %q", stdout.String(), want)
+			}
+			if _, err := os.Stat(out); (err == nil) != tt.saved {
+				t.Errorf("diff image written = %v, want %v", err == nil, tt.saved)
+			}
+		})
+	}
+}
+
+func TestRun_Verbosity(t *testing.T) {
+	dir := t.TempDir()
+	base, changed := filepath.Join(dir, "base.png"), filepath.Join(dir, "changed.png")
+	writePNG(t, base, image.Rectangle{})
+	writePNG(t, changed, image.Rect(20, 20, 30, 28))
+	out := filepath.Join(dir, "diff.png")
+	summary := []string{
+		"RESULT: 1 diff region(s), 2.6042% pixels differ, offset (0,0)",
+		"Diff image saved to " + out,
+	}
+
+	// The smooth gradient makes the offset ambiguous, which is warned about.
+	warning := "[WARNING] The offset (0,0) is ambiguous"
+	tests := []struct {
+		name      string
+		flag      string
+		stdout    []string
+		stderrHas []string
+		stderrNot []string
+	}{
+		{"quiet", "-q", nil, nil, []string{warning, "[INFO]", "[PROGRESS]"}},
+		{"default", "", summary, []string{warning}, []string{"[INFO]", "[PROGRESS]", "[ Command options ]", "level=INFO"}},
+		{"verbose", "-v", summary, []string{warning, "[ Command options ]", "[PROGRESS] ", "[INFO] Similarity: MSE ", `level=INFO msg="pipeline complete"`}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetFlags(t)
+			var stdout, stderr strings.Builder
+			con.out, con.err = &stdout, &stderr
+			args := []string{"-i1", base, "-i2", changed, "-o", out}
+			if tt.flag != "" {
+				args = append(args, tt.flag)
+			}
+			if code, err := run(args); code != exitCodeOK || err != nil {
+				t.Fatalf("run() = %d, %v", code, err)
+			}
+			var lines []string
+			if s := strings.TrimSuffix(stdout.String(), "\n"); s != "" {
+				lines = strings.Split(s, "\n")
+			}
+			if strings.Join(lines, "\n") != strings.Join(tt.stdout, "\n") {
+				t.Errorf("stdout =\n%s\nwant\n%s", strings.Join(lines, "\n"), strings.Join(tt.stdout, "\n"))
+			}
+			for _, want := range tt.stderrHas {
+				if !strings.Contains(stderr.String(), want) {
+					t.Errorf("stderr lacks %q", want)
+				}
+			}
+			for _, unwanted := range tt.stderrNot {
+				if strings.Contains(stderr.String(), unwanted) {
+					t.Errorf("stderr has %q:\n%s", unwanted, stderr.String())
+				}
+			}
+		})
+	}
+
+	resetFlags(t)
+	if code, err := run([]string{"-q", "-v", "-i1", base, "-i2", changed}); code != exitCodeUsage || err == nil {
+		t.Errorf("-q with -v: run() = %d, %v; want %d", code, err, exitCodeUsage)
+	}
+}
+
+func TestRun_HistogramOnly(t *testing.T) {
+	dir := t.TempDir()
+	base, same, changed := filepath.Join(dir, "base.png"), filepath.Join(dir, "same.png"), filepath.Join(dir, "changed.png")
+	writePNG(t, base, image.Rectangle{})
+	writePNG(t, same, image.Rectangle{})
+	writePNG(t, changed, image.Rect(20, 20, 30, 28))
+	jsonPath := filepath.Join(dir, "report.json")
+
+	tests := []struct {
+		name  string
+		args  []string
+		code  int
+		match bool
+	}{
+		{"identical", []string{"-i2", same}, exitCodeOK, true},
+		{"changed", []string{"-i2", changed, "-hd", "0"}, exitCodeDiff, false},
+		{"changed within the limit", []string{"-i2", changed, "-hd", "1"}, exitCodeOK, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetFlags(t)
+			var stdout strings.Builder
+			con.out = &stdout
+			code, err := run(append([]string{"-hs", "-i1", base, "-jr", jsonPath}, tt.args...))
+			if code != tt.code || err != nil {
+				t.Fatalf("run() = %d, %v; want %d", code, err, tt.code)
+			}
+			verdict := "RESULT: histograms differ"
+			if tt.match {
+				verdict = "RESULT: histograms match"
+			}
+			if !strings.Contains(stdout.String(), verdict) {
+				t.Errorf("stdout = %q, want %q", stdout.String(), verdict)
+			}
+			data, err := os.ReadFile(jsonPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var rep struct {
+				HasDiff       bool `json:"has_diff"`
+				HistogramOnly bool `json:"histogram_only"`
+				Histogram     struct {
+					Intersection float64 `json:"intersection"`
+					ChiSquare    float64 `json:"chi_square"`
+				} `json:"histogram"`
+			}
+			if err := json.Unmarshal(data, &rep); err != nil {
+				t.Fatal(err)
+			}
+			if !rep.HistogramOnly || rep.HasDiff == tt.match || (rep.Histogram.Intersection == 1) != (tt.name == "identical") {
+				t.Errorf("report = %+v", rep)
+			}
+		})
+	}
+
+	for _, args := range [][]string{{"-o", filepath.Join(dir, "diff.png")}, {"-e", "-fp", "regions>1"}, {"-hd", "1.5"}} {
+		resetFlags(t)
+		if code, err := run(append([]string{"-hs", "-i1", base, "-i2", changed}, args...)); code != exitCodeUsage || err == nil {
+			t.Errorf("%v: run() = %d, %v; want %d", args, code, err, exitCodeUsage)
+		}
+	}
+}
+
+func TestRun_DetectScroll(t *testing.T) {
+	dir := t.TempDir()
+	base, inserted := filepath.Join(dir, "base.png"), filepath.Join(dir, "inserted.png")
+	writePNG(t, base, image.Rectangle{})
+	// The base with 4 green rows inserted at row 10.
+	img := image.NewNRGBA(image.Rect(0, 0, 64, 52))
+	for y := 0; y < 52; y++ {
+		for x := 0; x < 64; x++ {
+			switch {
+			case y < 10:
+				img.SetNRGBA(x, y, color.NRGBA{uint8(4 * x), uint8(5 * y), 90, 255})
+			case y < 14:
+				img.SetNRGBA(x, y, color.NRGBA{0, 200, 0, 255})
+			default:
+				img.SetNRGBA(x, y, color.NRGBA{uint8(4 * x), uint8(5 * (y - 4)), 90, 255})
+			}
+		}
+	}
+	encodePNG(t, inserted, img)
+	jsonPath := filepath.Join(dir, "report.json")
+
+	resetFlags(t)
+	var stdout strings.Builder
+	con.out = &stdout
+	code, err := run([]string{"-sc", "-mx", "0", "-i1", base, "-i2", inserted, "-jr", jsonPath, "-o", filepath.Join(dir, "diff.png")})
+	if code != exitCodeOK || err != nil {
+		t.Fatalf("run() = %d, %v", code, err)
+	}
+	for _, want := range []string{"Inserted rows: 10-13 of the second image (4 rows)", "RESULT: 0 diff region(s), 1 inserted/deleted row band(s)"} {
+		if !strings.Contains(stdout.String(), want) {
+			t.Errorf("stdout = %q, want %q", stdout.String(), want)
+		}
+	}
+	data, err := os.ReadFile(jsonPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rep struct {
+		HasDiff  bool `json:"has_diff"`
+		RowBands []struct {
+			Kind    string `json:"kind"`
+			MinY    int    `json:"min_y"`
+			MaxY    int    `json:"max_y"`
+			SrcMinY int    `json:"src_min_y"`
+			Height  int    `json:"height"`
+		} `json:"row_bands"`
+	}
+	if err := json.Unmarshal(data, &rep); err != nil {
+		t.Fatal(err)
+	}
+	if !rep.HasDiff || len(rep.RowBands) != 1 || rep.RowBands[0].Kind != "inserted" || rep.RowBands[0].MinY != 10 || rep.RowBands[0].MaxY != 14 || rep.RowBands[0].SrcMinY != 10 || rep.RowBands[0].Height != 4 {
+		t.Errorf("report = %+v", rep)
+	}
+}
+
+func TestRun_Grid(t *testing.T) {
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a.png"), filepath.Join(dir, "b.png")
+	writePNG(t, a, image.Rectangle{})
+	writePNG(t, b, image.Rect(40, 20, 48, 28)) // 64 pixels in the cell of column 3, row 1
+	jsonPath, diffPath := filepath.Join(dir, "report.json"), filepath.Join(dir, "diff.png")
+
+	resetFlags(t)
+	con.out = &strings.Builder{}
+	code, err := run([]string{"-m", "0", "-bt", "0", "-gr", "5x3", "-gd", "-i1", a, "-i2", b, "-jr", jsonPath, "-o", diffPath})
+	if code != exitCodeOK || err != nil {
+		t.Fatalf("run() = %d, %v", code, err)
+	}
+	data, err := os.ReadFile(jsonPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rep struct {
+		Grid struct {
+			Cols, Rows int
+			Cells      []struct {
+				Col             int     `json:"col"`
+				Row             int     `json:"row"`
+				MinX            int     `json:"min_x"`
+				MaxX            int     `json:"max_x"`
+				DifferingPixels int     `json:"differing_pixels"`
+				DiffRatio       float64 `json:"diff_ratio"`
+			} `json:"cells"`
+		} `json:"grid"`
+	}
+	if err := json.Unmarshal(data, &rep); err != nil {
+		t.Fatal(err)
+	}
+	// 64 pixels do not divide by 5: the columns are 12 or 13 pixels wide.
+	if rep.Grid.Cols != 5 || rep.Grid.Rows != 3 || len(rep.Grid.Cells) != 15 {
+		t.Fatalf("grid = %+v, want 5x3 cells", rep.Grid)
+	}
+	for _, c := range rep.Grid.Cells {
+		want := 0
+		if c.Col == 3 && c.Row == 1 {
+			want = 64
+			if c.MinX != 38 || c.MaxX != 51 || c.DiffRatio != 64.0/(13*16) {
+				t.Errorf("cell (3,1) = %+v, want columns 38-51 and ratio 64/208", c)
+			}
+		}
+		if c.DifferingPixels != want {
+			t.Errorf("cell (%d,%d) has %d differing pixels, want %d", c.Col, c.Row, c.DifferingPixels, want)
+		}
+	}
+	if last := rep.Grid.Cells[14]; last.MaxX != 64 {
+		t.Errorf("last column ends at %d, want 64", last.MaxX)
+	}
+
+	// The shading darkens the unchanged pixels of the cell, and no others.
+	f, err := os.Open(diffPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	img, err := png.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r, g, _, _ := img.At(39, 17).RGBA(); r>>8 == 4*39 && g>>8 == 5*17 {
+		t.Error("cell (3,1) is not shaded")
+	}
+	if r, g, _, _ := img.At(30, 17).RGBA(); r>>8 != 4*30 || g>>8 != 5*17 {
+		t.Error("cell (2,1) is shaded")
+	}
+
+	resetFlags(t)
+	if code, err := run([]string{"-gd", "-i1", a, "-i2", b, "-o", diffPath}); code != exitCodeUsage || err == nil || !strings.Contains(err.Error(), "--grid-shading requires --grid") {
+		t.Errorf("--grid-shading without --grid: run() = %d, %v", code, err)
+	}
+	resetFlags(t)
+	if code, err := run([]string{"-gr", "12", "-i1", a, "-i2", b, "-o", diffPath}); code != exitCodeUsage || err == nil || !strings.Contains(err.Error(), "invalid grid '12'") {
+		t.Errorf("--grid 12: run() = %d, %v", code, err)
+	}
+}
+
+func TestRun_OutlineContour(t *testing.T) {
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a.png"), filepath.Join(dir, "b.png")
+	writePNG(t, a, image.Rectangle{})
+	// The base with a white disk of radius 12 around (32,24).
+	img := image.NewNRGBA(image.Rect(0, 0, 64, 48))
+	for y := 0; y < 48; y++ {
+		for x := 0; x < 64; x++ {
+			c := color.NRGBA{uint8(4 * x), uint8(5 * y), 90, 255}
+			if (x-32)*(x-32)+(y-24)*(y-24) <= 12*12 {
+				c = color.NRGBA{255, 255, 255, 255}
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	encodePNG(t, b, img)
+	jsonPath := filepath.Join(dir, "report.json")
+
+	resetFlags(t)
+	con.out = &strings.Builder{}
+	code, err := run([]string{"-m", "0", "-ol", "contour", "-i1", a, "-i2", b, "-jr", jsonPath, "-o", filepath.Join(dir, "diff.png")})
+	if code != exitCodeOK || err != nil {
+		t.Fatalf("run() = %d, %v", code, err)
+	}
+	data, err := os.ReadFile(jsonPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rep struct {
+		Regions []struct {
+			Contours [][][2]int `json:"contours"`
+		} `json:"regions"`
+	}
+	if err := json.Unmarshal(data, &rep); err != nil {
+		t.Fatal(err)
+	}
+	if len(rep.Regions) != 1 || len(rep.Regions[0].Contours) != 1 || len(rep.Regions[0].Contours[0]) < 8 {
+		t.Fatalf("regions = %+v, want one region with one polygon", rep.Regions)
+	}
+	for _, v := range rep.Regions[0].Contours[0] {
+		if d2 := (v[0]-32)*(v[0]-32) + (v[1]-24)*(v[1]-24); d2 < 10*10 || d2 > 12*12 {
+			t.Errorf("vertex %v is not on the disk's edge", v)
+		}
+	}
+
+	resetFlags(t)
+	if code, err := run([]string{"-ol", "hull", "-i1", a, "-i2", b, "-o", filepath.Join(dir, "diff.png")}); code != exitCodeUsage || err == nil || !strings.Contains(err.Error(), "invalid outline 'hull'") {
+		t.Errorf("--outline hull: run() = %d, %v", code, err)
+	}
+}
+
+func TestRun_MinRegionPixels(t *testing.T) {
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a.png"), filepath.Join(dir, "b.png")
+	writePNG(t, a, image.Rectangle{})
+	// A 10x10 change and a 2-pixel one.
+	img := image.NewNRGBA(image.Rect(0, 0, 64, 48))
+	for y := 0; y < 48; y++ {
+		for x := 0; x < 64; x++ {
+			c := color.NRGBA{uint8(4 * x), uint8(5 * y), 90, 255}
+			if image.Pt(x, y).In(image.Rect(40, 20, 50, 30)) || y == 5 && (x == 5 || x == 6) {
+				c = color.NRGBA{255, 255, 255, 255}
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	encodePNG(t, b, img)
+	jsonPath := filepath.Join(dir, "report.json")
+
+	resetFlags(t)
+	con.out = &strings.Builder{}
+	code, err := run([]string{"-m", "0", "-ra", "1", "-px", "5", "-i1", a, "-i2", b, "-jr", jsonPath, "-o", filepath.Join(dir, "diff.png")})
+	if code != exitCodeOK || err != nil {
+		t.Fatalf("run() = %d, %v", code, err)
+	}
+	data, err := os.ReadFile(jsonPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rep struct {
+		Regions []struct {
+			DifferingPixels int `json:"differing_pixels"`
+		} `json:"regions"`
+		SuppressedRegions []struct {
+			MinX            int `json:"min_x"`
+			MinY            int `json:"min_y"`
+			DifferingPixels int `json:"differing_pixels"`
+		} `json:"suppressed_regions"`
+	}
+	if err := json.Unmarshal(data, &rep); err != nil {
+		t.Fatal(err)
+	}
+	if len(rep.Regions) != 1 || rep.Regions[0].DifferingPixels != 100 {
+		t.Errorf("regions = %+v, want only the 10x10 change", rep.Regions)
+	}
+	if s := rep.SuppressedRegions; len(s) != 1 || s[0].DifferingPixels != 2 || s[0].MinX > 5 || s[0].MinY > 5 {
+		t.Errorf("suppressed_regions = %+v, want the 2-pixel diff", s)
+	}
+
+	// A 5-pixel cross exactly at the threshold, whose padded box also holds
+	// a 2-pixel change dropped by --min-region-area, and a 2x2 change below
+	// it. The JSON and CSV reports count the pixels the filter counted.
+	for y := 0; y < 48; y++ {
+		for x := 0; x < 64; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{uint8(4 * x), uint8(5 * y), 90, 255})
+		}
+	}
+	for _, p := range []image.Point{{20, 10}, {21, 10}, {22, 10}, {21, 9}, {21, 11}, {26, 10}, {26, 11}, {50, 40}, {51, 40}, {50, 41}, {51, 41}} {
+		img.SetNRGBA(p.X, p.Y, color.NRGBA{255, 255, 255, 255})
+	}
+	encodePNG(t, b, img)
+	csvPath := filepath.Join(dir, "regions.csv")
+
+	resetFlags(t)
+	code, err = run([]string{"-m", "0", "-ra", "3", "-px", "5", "-i1", a, "-i2", b, "-jr", jsonPath, "-rc", csvPath, "-o", filepath.Join(dir, "diff.png")})
+	if code != exitCodeOK || err != nil {
+		t.Fatalf("run() = %d, %v", code, err)
+	}
+	if data, err = os.ReadFile(jsonPath); err != nil {
+		t.Fatal(err)
+	}
+	rep.Regions, rep.SuppressedRegions = nil, nil
+	if err := json.Unmarshal(data, &rep); err != nil {
+		t.Fatal(err)
+	}
+	if len(rep.Regions) != 1 || rep.Regions[0].DifferingPixels != 5 {
+		t.Errorf("regions = %+v, want the cross with 5 differing pixels", rep.Regions)
+	}
+	if s := rep.SuppressedRegions; len(s) != 1 || s[0].DifferingPixels != 4 {
+		t.Errorf("suppressed_regions = %+v, want the 2x2 change", s)
+	}
+	if data, err = os.ReadFile(csvPath); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(strings.NewReader(string(data))).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || rows[1][8] != "5" {
+		t.Errorf("regions csv = %v, want one region with 5 differing pixels", rows)
+	}
+}
+
+// parseEvents decodes the JSON progress lines of stderr, which must be the
+// only lines there.
+func parseEvents(t *testing.T, stderr string) []progress.Event {
+	t.Helper()
+	var events []progress.Event
+	sc := bufio.NewScanner(strings.NewReader(stderr))
+	for sc.Scan() {
+		var e progress.Event
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			t.Fatalf("stderr line %q: %v", sc.Text(), err)
+		}
+		events = append(events, e)
+	}
+	return events
+}
+
+func TestRun_ProgressJSON(t *testing.T) {
+	dir := t.TempDir()
+	base, changed := filepath.Join(dir, "base.png"), filepath.Join(dir, "changed.png")
+	writePNG(t, base, image.Rectangle{})
+	writePNG(t, changed, image.Rect(20, 20, 30, 28))
+
+	// -q silences everything else, and -lt does not prefix the events.
+	resetFlags(t)
+	var stderr strings.Builder
+	con.err = &stderr
+	args := []string{"-i1", base, "-i2", changed, "-o", filepath.Join(dir, "diff.png"), "-pf", "json", "-pg", "0", "-q", "-lt", "-e"}
+	if code, err := run(args); code != exitCodeDiff || err != nil {
+		t.Fatalf("run() = %d, %v", code, err)
+	}
+	events := parseEvents(t, stderr.String())
+	if len(events) == 0 {
+		t.Fatal("no events")
+	}
+	started := map[string]bool{}
+	last := map[string]int{}
+	for _, e := range events[:len(events)-1] {
+		switch e.Event {
+		case progress.EventStart:
+			started[e.Stage] = true
+		case progress.EventProgress:
+			if !started[e.Stage] || e.Percent < last[e.Stage] || e.Percent > 100 {
+				t.Errorf("unexpected %+v", e)
+			}
+			last[e.Stage] = e.Percent
+		default:
+			t.Errorf("event %+v before the end", e)
+		}
+	}
+	for _, stage := range []string{"load", "align", "diff", "regions"} {
+		if last[stage] != 100 {
+			t.Errorf("stage %s ended at %d%%", stage, last[stage])
+		}
+	}
+	done := events[len(events)-1]
+	differing := 80.0 // the 10x8 changed rectangle
+	want := progress.Summary{ExitCode: exitCodeDiff, HasDiff: true, Regions: 1, DiffPercent: 100 * (differing / (64 * 48))}
+	if done.Event != progress.EventDone || done.Stage != "done" || done.Summary == nil || *done.Summary != want {
+		t.Errorf("last event = %+v, summary %+v; want done with %+v", done, done.Summary, want)
+	}
+
+	// Failed runs end with the error.
+	resetFlags(t)
+	stderr.Reset()
+	con.err = &stderr
+	args = []string{"-i1", base, "-i2", filepath.Join(dir, "missing.png"), "-o", filepath.Join(dir, "diff.png"), "-pf", "json"}
+	code, err := run(args)
+	if code != exitCodeError || err == nil {
+		t.Fatalf("missing input: run() = %d, %v", code, err)
+	}
+	events = parseEvents(t, stderr.String())
+	if done := events[len(events)-1]; done.Summary == nil || done.Summary.ExitCode != exitCodeError || done.Summary.Error != err.Error() {
+		t.Errorf("missing input: last event = %+v, summary %+v", done, done.Summary)
+	}
+
+	resetFlags(t)
+	if code, err := run([]string{"-i1", base, "-i2", changed, "-o", filepath.Join(dir, "diff.png"), "-pf", "xml"}); code != exitCodeUsage || err == nil {
+		t.Errorf("-pf xml: run() = %d, %v; want %d", code, err, exitCodeUsage)
+	}
+}
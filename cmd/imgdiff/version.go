@@ -0,0 +1,25 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// Build information, set at build time with
+// -ldflags "-X main.version=1.2.3 -X main.commit=abc1234 -X main.date=2024-03-05T09:04:02Z".
+var (
+	version = "dev"
+	commit  = "none"
+	date    = "unknown"
+)
+
+// buildVersion returns the version recorded in reports and PNG outputs.
+func buildVersion() string {
+	return formatVersion(version, commit, date, runtime.Version())
+}
+
+// formatVersion formats build information as
+// "1.2.3 (commit abc1234, built 2024-03-05T09:04:02Z, go1.23.0)".
+func formatVersion(version, commit, date, goVersion string) string {
+	return fmt.Sprintf("%s (commit %s, built %s, %s)", version, commit, date, goVersion)
+}
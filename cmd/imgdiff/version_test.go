@@ -0,0 +1,18 @@
+package main
+
+import "testing"
+
+func TestFormatVersion(t *testing.T) {
+	tests := []struct {
+		version, commit, date, goVersion string
+		want                             string
+	}{
+		{"1.2.3", "abc1234", "2024-03-05T09:04:02Z", "go1.23.0", "1.2.3 (commit abc1234, built 2024-03-05T09:04:02Z, go1.23.0)"},
+		{"dev", "none", "unknown", "go1.23.0", "dev (commit none, built unknown, go1.23.0)"},
+	}
+	for _, tt := range tests {
+		if got := formatVersion(tt.version, tt.commit, tt.date, tt.goVersion); got != tt.want {
+			t.Errorf("formatVersion() = %q, want %q", got, tt.want)
+		}
+	}
+}
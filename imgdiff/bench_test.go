@@ -0,0 +1,28 @@
+//go:build !light_test_only
+
+package imgdiff
+
+import (
+	"fmt"
+	"image"
+	"testing"
+)
+
+func BenchmarkCompare(b *testing.B) {
+	imgA := makeImage(960, 540)
+	imgB := makeImage(960, 540, image.Rect(100, 100, 180, 140), image.Rect(600, 300, 700, 420))
+	for _, reuse := range []bool{false, true} {
+		b.Run(fmt.Sprintf("workspace=%v", reuse), func(b *testing.B) {
+			opts := DefaultOptions()
+			if reuse {
+				opts.Runtime.Workspace = NewWorkspace()
+			}
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := Compare(imgA, imgB, opts); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package imgdiff
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+
+	"github.com/xshoji/go-img-diff/internal/app"
+	"github.com/xshoji/go-img-diff/internal/core"
+	"github.com/xshoji/go-img-diff/internal/render"
+	"github.com/xshoji/go-img-diff/internal/report"
+)
+
+// Options configures the comparison pipeline. Start from DefaultOptions.
+type Options = core.Options
+
+// Result is the structured output of a comparison.
+type Result = core.Result
+
+// DefaultOptions returns the same defaults as the imgdiff command.
+func DefaultOptions() Options {
+	return core.DefaultOptions()
+}
+
+// Artifact names used in a Bundle.
+const (
+	ArtifactDiff       = "diff.png"
+	ArtifactSideBySide = "side-by-side.png"
+	ArtifactStats      = "stats.json"
+)
+
+// RegionCropName returns the artifact name of the crop for the 1-based region index.
+func RegionCropName(index int) string {
+	return fmt.Sprintf("regions/region-%03d.png", index)
+}
+
+// BundleOptions selects the artifacts included in a review bundle.
+type BundleOptions struct {
+	Diff        bool // annotated diff image
+	SideBySide  bool // image A, image B and diff in one image
+	Stats       bool // JSON report with offset, diff ratio and regions
+	RegionCrops bool // one crop of the annotated diff per region
+	CropMargin  int  // pixels added around each region crop
+}
+
+// DefaultBundleOptions includes every artifact with a 50 px crop margin.
+func DefaultBundleOptions() BundleOptions {
+	return BundleOptions{Diff: true, SideBySide: true, Stats: true, RegionCrops: true, CropMargin: 50}
+}
+
+// Artifact is one in-memory file of a review bundle.
+type Artifact struct {
+	Name        string
+	ContentType string
+	Data        []byte
+}
+
+// Reader returns a reader over the artifact contents.
+func (a Artifact) Reader() io.Reader {
+	return bytes.NewReader(a.Data)
+}
+
+// Bundle holds the artifacts of one comparison in a stable order together with
+// the result they were built from.
+type Bundle struct {
+	Result    *Result
+	Artifacts []Artifact
+}
+
+// Get returns the artifact with the given name.
+func (b *Bundle) Get(name string) (Artifact, bool) {
+	for _, a := range b.Artifacts {
+		if a.Name == name {
+			return a, true
+		}
+	}
+	return Artifact{}, false
+}
+
+// BuildReviewBundle compares imgA and imgB once with Compare and renders the
+// requested artifacts from that single result. It fails as Compare does,
+// except that when the offset gate rejects the alignment, the bundle is
+// returned together with the *OffsetRejectedError.
+func BuildReviewBundle(imgA, imgB image.Image, opts Options, bopts BundleOptions) (*Bundle, error) {
+	result, err := Compare(imgA, imgB, opts)
+	if result == nil {
+		return nil, err
+	}
+	bundle, bundleErr := NewReviewBundle(result, opts, bopts)
+	if bundleErr != nil {
+		return nil, bundleErr
+	}
+	return bundle, err
+}
+
+// NewReviewBundle renders the requested artifacts from an existing result.
+func NewReviewBundle(result *Result, opts Options, bopts BundleOptions) (*Bundle, error) {
+	if result.Output == nil {
+		return nil, fmt.Errorf("result has no rendered diff image")
+	}
+	bundle := &Bundle{Result: result}
+
+	if bopts.Diff {
+		if err := bundle.addPNG(ArtifactDiff, result.Output); err != nil {
+			return nil, err
+		}
+	}
+
+	if bopts.SideBySide {
+		composite := render.RenderComposite(result.FrameA.Pix, result.FrameB.Pix, result.Output, render.DefaultCompositeOptions())
+		if err := bundle.addPNG(ArtifactSideBySide, composite); err != nil {
+			return nil, err
+		}
+	}
+
+	if bopts.Stats {
+		var buf bytes.Buffer
+		if err := report.Build(opts, result).Write(&buf); err != nil {
+			return nil, err
+		}
+		bundle.Artifacts = append(bundle.Artifacts, Artifact{Name: ArtifactStats, ContentType: "application/json", Data: buf.Bytes()})
+	}
+
+	if bopts.RegionCrops {
+		bounds := result.Output.Bounds()
+		for i, r := range app.OutputRegions(result, opts) {
+			crop, _ := render.CropRect([]core.Region{r}, bopts.CropMargin, bounds)
+			if err := bundle.addPNG(RegionCropName(i+1), subImage(result.Output, crop)); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return bundle, nil
+}
+
+func (b *Bundle) addPNG(name string, img image.Image) error {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return fmt.Errorf("failed to encode %s: %w", name, err)
+	}
+	b.Artifacts = append(b.Artifacts, Artifact{Name: name, ContentType: "image/png", Data: buf.Bytes()})
+	return nil
+}
+
+func subImage(img image.Image, r image.Rectangle) image.Image {
+	if s, ok := img.(interface {
+		SubImage(image.Rectangle) image.Image
+	}); ok {
+		return s.SubImage(r)
+	}
+	return img
+}
@@ -0,0 +1,113 @@
+package imgdiff
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+func makeImage(w, h int, changes ...image.Rectangle) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{uint8(x), uint8(y), 100, 255})
+		}
+	}
+	for _, r := range changes {
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				img.SetNRGBA(x, y, color.NRGBA{255, 255, 255, 255})
+			}
+		}
+	}
+	return img
+}
+
+func TestBuildReviewBundle(t *testing.T) {
+	a := makeImage(200, 150)
+	b := makeImage(200, 150, image.Rect(20, 20, 40, 40), image.Rect(120, 90, 160, 110))
+
+	bundle, err := BuildReviewBundle(a, b, DefaultOptions(), DefaultBundleOptions())
+	if err != nil {
+		t.Fatalf("BuildReviewBundle failed: %v", err)
+	}
+
+	regionCount := len(bundle.Result.Regions)
+	if regionCount != 2 {
+		t.Fatalf("expected 2 regions, got %d", regionCount)
+	}
+
+	for _, name := range []string{ArtifactDiff, ArtifactSideBySide, ArtifactStats} {
+		if _, ok := bundle.Get(name); !ok {
+			t.Errorf("missing artifact %s", name)
+		}
+	}
+
+	crops := 0
+	for _, a := range bundle.Artifacts {
+		if strings.HasPrefix(a.Name, "regions/") {
+			crops++
+			if _, err := png.Decode(a.Reader()); err != nil {
+				t.Errorf("crop %s is not a valid png: %v", a.Name, err)
+			}
+		}
+	}
+	if crops != regionCount {
+		t.Errorf("expected %d region crops, got %d", regionCount, crops)
+	}
+
+	stats, _ := bundle.Get(ArtifactStats)
+	var parsed struct {
+		Regions []json.RawMessage `json:"regions"`
+	}
+	if err := json.NewDecoder(bytes.NewReader(stats.Data)).Decode(&parsed); err != nil {
+		t.Fatalf("invalid stats json: %v", err)
+	}
+	if len(parsed.Regions) != regionCount {
+		t.Errorf("stats list %d regions, result has %d", len(parsed.Regions), regionCount)
+	}
+}
+
+func TestBuildReviewBundle_Subset(t *testing.T) {
+	a := makeImage(100, 100)
+	b := makeImage(100, 100, image.Rect(10, 10, 30, 30))
+
+	bundle, err := BuildReviewBundle(a, b, DefaultOptions(), BundleOptions{Stats: true})
+	if err != nil {
+		t.Fatalf("BuildReviewBundle failed: %v", err)
+	}
+	if len(bundle.Artifacts) != 1 || bundle.Artifacts[0].Name != ArtifactStats {
+		t.Errorf("expected only %s, got %d artifacts", ArtifactStats, len(bundle.Artifacts))
+	}
+}
+
+func TestBuildReviewBundle_Errors(t *testing.T) {
+	a := makeImage(100, 100)
+	b := makeImage(100, 100, image.Rect(10, 10, 30, 30))
+
+	if _, err := BuildReviewBundle(a, nil, DefaultOptions(), DefaultBundleOptions()); err == nil {
+		t.Error("nil image: no error")
+	}
+	opts := DefaultOptions()
+	opts.Align.MaxOffsetX = -1
+	if _, err := BuildReviewBundle(a, b, opts, DefaultBundleOptions()); err == nil {
+		t.Error("negative MaxOffsetX: no error")
+	}
+
+	// A rejected offset still yields the bundle, as Compare yields the result.
+	opts = DefaultOptions()
+	forced := image.Pt(0, 5)
+	opts.Align.ForcedOffset = &forced
+	opts.Align.MaxOffsetX, opts.Align.MaxOffsetY = 0, 0
+	opts.Align.MaxAcceptableOffset = 1
+	bundle, err := BuildReviewBundle(a, b, opts, BundleOptions{Stats: true})
+	var rejected *OffsetRejectedError
+	if !errors.As(err, &rejected) || bundle == nil || len(bundle.Artifacts) != 1 {
+		t.Errorf("rejected offset: bundle %v, err %v; want the bundle and an *OffsetRejectedError", bundle, err)
+	}
+}
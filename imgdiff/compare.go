@@ -0,0 +1,138 @@
+package imgdiff
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"log/slog"
+
+	"github.com/xshoji/go-img-diff/internal/app"
+	"github.com/xshoji/go-img-diff/internal/core"
+	"github.com/xshoji/go-img-diff/internal/progress"
+)
+
+// ProgressReporter receives stage and percentage events when set as
+// Options.Runtime.Progress. Compare is silent when it is nil.
+type ProgressReporter = progress.Reporter
+
+// OffsetRejectedError is returned by Compare when the detected offset exceeds
+// Options.Align.MaxAcceptableOffset.
+type OffsetRejectedError = app.OffsetRejectedError
+
+// AspectRatioError is returned by Compare when the aspect ratios differ by more
+// than Options.Align.MaxAspectFactor and Options.Align.StrictDimensions is set.
+type AspectRatioError = app.AspectRatioError
+
+// ScaleError is returned by Compare when Options.AutoScale is set and the
+// image sizes do not differ by the same simple ratio in both axes.
+type ScaleError = app.ScaleError
+
+// ImageSizeError is returned by Compare when the images differ in size and
+// Options.SizeMismatch is SizeMismatchError.
+type ImageSizeError = app.ImageSizeError
+
+// ColorMetric selects how Options.Diff.Threshold compares two pixels.
+type ColorMetric = core.ColorMetric
+
+// Color metrics.
+const (
+	ColorMetricRGB       = core.ColorMetricRGB       // largest channel difference, threshold 0-255
+	ColorMetricCIEDE2000 = core.ColorMetricCIEDE2000 // perceptual delta E in CIELAB, threshold 0-100
+)
+
+// RenderStyle selects what Options.Render draws inside each region.
+type RenderStyle = core.RenderStyle
+
+// Render styles. The region border is drawn in every style.
+const (
+	RenderStyleOverlay = core.RenderStyleOverlay // tinted overlay of the differing pixels (default)
+	RenderStyleFill    = core.RenderStyleFill    // Options.Render.TintColor at FillAlpha over the whole region
+	RenderStyleOutline = core.RenderStyleOutline // border only
+)
+
+// RenderBase selects the image Options.Render draws the diff on.
+type RenderBase = core.RenderBase
+
+// Render bases.
+const (
+	RenderBaseB = core.RenderBaseB // the second image, in whose coordinates regions are given (default)
+	RenderBaseA = core.RenderBaseA // the first image, with the regions moved by the inverse offset
+)
+
+// AlignMetric selects how Options.Align scores candidate offsets.
+type AlignMetric = core.AlignMetric
+
+// Alignment metrics. With AlignMetricSSIM, Result.Aligned.SSIM holds the
+// structural similarity of the aligned images.
+const (
+	AlignMetricMAE  = core.AlignMetricMAE  // mean absolute luminance error
+	AlignMetricSSIM = core.AlignMetricSSIM // structural similarity, robust to global brightness changes
+)
+
+// SizeMismatch selects how Options compares images of different sizes.
+type SizeMismatch = core.SizeMismatch
+
+// Size mismatch modes.
+const (
+	SizeMismatchWarn  = core.SizeMismatchWarn  // compare them as they are (default)
+	SizeMismatchError = core.SizeMismatchError // fail with an *ImageSizeError
+	SizeMismatchPad   = core.SizeMismatchPad   // pad both to a common canvas with Options.PadColor
+)
+
+// GridSize is the number of columns and rows of Options.Grid.
+type GridSize = core.GridSize
+
+// GridCell is one cell of Result.DiffMask.Grid: its bounds in the second
+// image and its number of differing pixels.
+type GridCell = core.GridCell
+
+// Compare aligns imgB to imgA, detects differing pixels, groups them into
+// regions and renders the annotated diff. With the same options it produces
+// the same result as the imgdiff command. Compare logs nothing.
+//
+// When the aspect ratios differ by more than Options.Align.MaxAspectFactor,
+// imgA is compared in whichever orientation (as-is or rotated by 90 degrees)
+// aligns best; Result.Orientation records the choice. Images of different
+// sizes are compared as configured by Options.SizeMismatch, after
+// Options.AutoScale has downsampled the larger one if their sizes differ by
+// a uniform ratio (see Result.Scale).
+//
+// Options outside their valid range are rejected with the problems listed by
+// Options.Validate. When the offset gate rejects the alignment, the result is
+// returned together with an *OffsetRejectedError.
+//
+// To compare many images with fewer allocations, set
+// Options.Runtime.Workspace; the result is then valid until the next
+// comparison with that Workspace.
+func Compare(imgA, imgB image.Image, opts Options) (*Result, error) {
+	if imgA == nil || imgB == nil {
+		return nil, errors.New("imgdiff: both images are required")
+	}
+	if err := opts.Validate(); err != nil {
+		return nil, fmt.Errorf("imgdiff: invalid options: %w", err)
+	}
+	frameA, frameB := core.NewFrame(imgA), core.NewFrame(imgB)
+	if err := app.CheckDimensions(frameA, frameB, opts); err != nil {
+		return nil, err
+	}
+	result := app.Compare(frameA, frameB, opts, false, discardLogger())
+	if !opts.Align.AcceptsOffset(result.Aligned) {
+		return result, &OffsetRejectedError{Offset: result.Aligned, Max: opts.Align.MaxAcceptableOffset}
+	}
+	return result, nil
+}
+
+// Workspace keeps the masks, labeling scratch and diff image of one
+// comparison for the next when set as Options.Runtime.Workspace. It must not
+// be shared by concurrent comparisons.
+type Workspace = core.Workspace
+
+// NewWorkspace returns an empty Workspace.
+func NewWorkspace() *Workspace {
+	return core.NewWorkspace()
+}
+
+func discardLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
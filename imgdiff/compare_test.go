@@ -0,0 +1,1375 @@
+package imgdiff
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"log/slog"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xshoji/go-img-diff/internal/analysis"
+	"github.com/xshoji/go-img-diff/internal/app"
+	"github.com/xshoji/go-img-diff/internal/core"
+)
+
+func writePNG(t *testing.T, path string, img image.Image) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := png.Encode(f, img); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestCompare_MatchesCLIPipeline runs the file-based pipeline used by the
+// command and the library API on the same fixtures and expects identical results.
+func TestCompare_MatchesCLIPipeline(t *testing.T) {
+	dir := t.TempDir()
+	a := makeImage(200, 150)
+	b := makeImage(200, 150, image.Rect(20, 20, 40, 40), image.Rect(120, 90, 160, 110))
+	pathA, pathB := filepath.Join(dir, "a.png"), filepath.Join(dir, "b.png")
+	writePNG(t, pathA, a)
+	writePNG(t, pathB, b)
+
+	opts := DefaultOptions()
+	opts.Input1, opts.Input2 = pathA, pathB
+	cli, err := app.Run(opts, false, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("app.Run failed: %v", err)
+	}
+
+	lib, err := Compare(a, b, DefaultOptions())
+	if err != nil {
+		t.Fatalf("Compare failed: %v", err)
+	}
+
+	if lib.Aligned != cli.Aligned {
+		t.Errorf("alignment %+v, CLI %+v", lib.Aligned, cli.Aligned)
+	}
+	if lib.DiffPixels() != cli.DiffPixels() || lib.DiffPixels() == 0 {
+		t.Errorf("diff pixels %d, CLI %d", lib.DiffPixels(), cli.DiffPixels())
+	}
+	if len(lib.Regions) != len(cli.Regions) {
+		t.Fatalf("regions %d, CLI %d", len(lib.Regions), len(cli.Regions))
+	}
+	for i := range lib.Regions {
+		if lib.Regions[i].Bounds != cli.Regions[i].Bounds {
+			t.Errorf("region %d bounds %v, CLI %v", i, lib.Regions[i].Bounds, cli.Regions[i].Bounds)
+		}
+	}
+
+	libImg, cliImg := lib.Render(), cli.Render()
+	if libImg.Bounds() != cliImg.Bounds() {
+		t.Fatalf("render bounds %v, CLI %v", libImg.Bounds(), cliImg.Bounds())
+	}
+	for y := libImg.Bounds().Min.Y; y < libImg.Bounds().Max.Y; y++ {
+		for x := libImg.Bounds().Min.X; x < libImg.Bounds().Max.X; x++ {
+			if libImg.At(x, y) != cliImg.At(x, y) {
+				t.Fatalf("rendered pixel (%d,%d) differs from CLI", x, y)
+			}
+		}
+	}
+}
+
+// TestRun_PreflightFailsBeforeLoading uses missing inputs: if the output check
+// did not run first, the error would be about loading the images.
+// TestRerender_MatchesRun saves an analysis and expects re-rendering it with
+// the same options to reproduce the original diff image.
+func TestRerender_MatchesRun(t *testing.T) {
+	dir := t.TempDir()
+	pathA, pathB := filepath.Join(dir, "a.png"), filepath.Join(dir, "b.png")
+	writePNG(t, pathA, makeImage(200, 150))
+	writePNG(t, pathB, makeImage(200, 150, image.Rect(20, 20, 40, 40), image.Rect(120, 90, 160, 110)))
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	opts := DefaultOptions()
+	opts.Input1, opts.Input2 = pathA, pathB
+	opts.Output.AnalysisPath = filepath.Join(dir, "analysis.json")
+	original, err := app.Run(opts, false, logger)
+	if err != nil {
+		t.Fatalf("app.Run failed: %v", err)
+	}
+
+	file, err := analysis.Load(opts.Output.AnalysisPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts.Output.AnalysisPath = ""
+	rerendered, err := app.Rerender(file, opts, logger)
+	if err != nil {
+		t.Fatalf("app.Rerender failed: %v", err)
+	}
+
+	if rerendered.Aligned != original.Aligned || len(rerendered.Regions) != len(original.Regions) {
+		t.Fatalf("rerendered %+v/%d regions, original %+v/%d regions",
+			rerendered.Aligned, len(rerendered.Regions), original.Aligned, len(original.Regions))
+	}
+	got, want := rerendered.Render(), original.Render()
+	if got.Bounds() != want.Bounds() {
+		t.Fatalf("render bounds %v, original %v", got.Bounds(), want.Bounds())
+	}
+	for y := want.Bounds().Min.Y; y < want.Bounds().Max.Y; y++ {
+		for x := want.Bounds().Min.X; x < want.Bounds().Max.X; x++ {
+			if got.At(x, y) != want.At(x, y) {
+				t.Fatalf("rendered pixel (%d,%d) differs from original", x, y)
+			}
+		}
+	}
+}
+
+func TestRun_PreflightFailsBeforeLoading(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "existing.png")
+	if err := os.WriteFile(existing, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for name, output := range map[string]core.OutputOptions{
+		"unsupported extension":      {Path: filepath.Join(dir, "diff.bmp")},
+		"missing directory, NoMkdir": {Path: filepath.Join(dir, "missing", "diff.png"), NoMkdir: true},
+		"existing file, NoOverwrite": {Path: existing, NoOverwrite: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			opts := DefaultOptions()
+			opts.Input1 = filepath.Join(dir, "missing-a.png")
+			opts.Input2 = filepath.Join(dir, "missing-b.png")
+			opts.Output = output
+			_, err := app.Run(opts, false, slog.New(slog.NewTextHandler(io.Discard, nil)))
+			if err == nil || !strings.Contains(err.Error(), "output check failed") {
+				t.Errorf("expected output check error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestRun_ReportMemory(t *testing.T) {
+	dir := t.TempDir()
+	pathA, pathB := filepath.Join(dir, "a.png"), filepath.Join(dir, "b.png")
+	writePNG(t, pathA, makeImage(120, 90))
+	writePNG(t, pathB, makeImage(120, 90, image.Rect(10, 10, 30, 30)))
+
+	opts := DefaultOptions()
+	opts.Input1, opts.Input2 = pathA, pathB
+	opts.Output.Path = filepath.Join(dir, "diff.png")
+	opts.Runtime.ReportMemory = true
+	result, err := app.Run(opts, false, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"load", "align", "detect", "render", "save"}
+	if len(result.Phases) != len(want) {
+		t.Fatalf("got %d phases, want %v", len(result.Phases), want)
+	}
+	var lastTotal uint64
+	for i, p := range result.Phases {
+		if p.Phase != want[i] {
+			t.Errorf("phase %d = %q, want %q", i, p.Phase, want[i])
+		}
+		if p.HeapAlloc == 0 || p.Sys == 0 || p.Sys < p.HeapAlloc {
+			t.Errorf("%s: implausible memory stats %+v", p.Phase, p)
+		}
+		if p.TotalAlloc < lastTotal {
+			t.Errorf("%s: TotalAlloc decreased from %d to %d", p.Phase, lastTotal, p.TotalAlloc)
+		}
+		lastTotal = p.TotalAlloc
+	}
+
+	var buf bytes.Buffer
+	if err := WriteJSONReport(&buf, result, opts); err != nil {
+		t.Fatal(err)
+	}
+	for _, field := range []string{`"phases"`, `"go_heap_alloc_bytes"`, `"go_total_alloc_bytes"`, `"go_sys_bytes"`, `"duration_ms"`} {
+		if !strings.Contains(buf.String(), field) {
+			t.Errorf("JSON report missing %s", field)
+		}
+	}
+
+	opts.Runtime.ReportMemory = false
+	result, err = app.Run(opts, false, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Phases) != 0 {
+		t.Errorf("expected no phases without ReportMemory, got %d", len(result.Phases))
+	}
+}
+
+func TestCompare_AspectRatio(t *testing.T) {
+	b := makeImage(160, 100, image.Rect(20, 20, 40, 40))
+	// A is B captured in portrait: rotating it clockwise restores B.
+	a := core.NewFrame(b).Rotate(core.OrientationRotateCCW).Pix
+
+	t.Run("strict", func(t *testing.T) {
+		opts := DefaultOptions()
+		opts.Align.StrictDimensions = true
+		_, err := Compare(a, b, opts)
+		var aspectErr *AspectRatioError
+		if !errors.As(err, &aspectErr) {
+			t.Fatalf("expected AspectRatioError, got %v", err)
+		}
+		if aspectErr.SizeA != image.Pt(100, 160) || aspectErr.SizeB != image.Pt(160, 100) {
+			t.Errorf("unexpected sizes in %v", aspectErr)
+		}
+	})
+
+	t.Run("auto-rotate", func(t *testing.T) {
+		opts := DefaultOptions()
+		result, err := Compare(a, b, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Orientation != core.OrientationRotateCW {
+			t.Errorf("orientation = %q, want %q", result.Orientation, core.OrientationRotateCW)
+		}
+		if result.HasDiff {
+			t.Errorf("expected no differences after rotation, got %d pixels", result.DiffPixels())
+		}
+
+		var buf bytes.Buffer
+		if err := WriteJSONReport(&buf, result, opts); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(buf.String(), `"orientation": "rotated-90-cw"`) {
+			t.Errorf("JSON report missing orientation:\n%s", buf.String())
+		}
+	})
+
+	t.Run("within factor", func(t *testing.T) {
+		result, err := Compare(makeImage(160, 120), makeImage(150, 120), DefaultOptions())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Orientation != core.OrientationOriginal {
+			t.Errorf("orientation = %q, want original", result.Orientation)
+		}
+	})
+}
+
+func TestCompare_SmallChangesAlwaysFound(t *testing.T) {
+	// Every pixel is compared, so any change, down to a single pixel, makes
+	// the images differ at any position, including next to the edges. It is
+	// drawn as a region from the default minimum region area on. The texture
+	// only matches itself unshifted, so the whole image is compared.
+	const w, h = 64, 48
+	texture := func(change image.Rectangle) *image.NRGBA {
+		img := image.NewNRGBA(image.Rect(0, 0, w, h))
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				v := uint8((x*37 ^ y*91) % 200)
+				if image.Pt(x, y).In(change) {
+					v = 255
+				}
+				img.SetNRGBA(x, y, color.NRGBA{v, v, v, 255})
+			}
+		}
+		return img
+	}
+	a := texture(image.Rectangle{})
+	for _, size := range []image.Point{{1, 1}, {3, 1}, {2, 2}, {4, 1}} {
+		for _, y := range []int{0, 1, 2, 3, 21, h - size.Y - 1, h - size.Y} {
+			for _, x := range []int{0, 1, 2, 3, 29, w - size.X - 1, w - size.X} {
+				change := image.Rectangle{Min: image.Pt(x, y), Max: image.Pt(x, y).Add(size)}
+				result, err := Compare(a, texture(change), DefaultOptions())
+				if err != nil {
+					t.Fatal(err)
+				}
+				n, regions := size.X*size.Y, 0
+				if n >= DefaultOptions().Region.MinArea {
+					regions = 1
+				}
+				if !result.HasDiff || len(result.Regions) != regions || result.DiffPixels() != n {
+					t.Errorf("change %v: has diff %v, %d regions, %d diff pixels; want it found with %d region(s)", change, result.HasDiff, len(result.Regions), result.DiffPixels(), regions)
+				}
+			}
+		}
+	}
+}
+
+func TestCompare_Despeckle(t *testing.T) {
+	// Salt-and-pepper noise over 2% of the pixels, as left by JPEG
+	// artifacts, and one genuine 10x10 change.
+	a := makeImage(200, 150)
+	noisy := makeImage(200, 150)
+	rng := rand.New(rand.NewSource(7))
+	for i := 0; i < 600; i++ {
+		c := color.NRGBA{0, 0, 0, 255}
+		if i%2 == 0 {
+			c = color.NRGBA{255, 255, 255, 255}
+		}
+		noisy.SetNRGBA(rng.Intn(200), rng.Intn(150), c)
+	}
+	changed := image.NewNRGBA(noisy.Rect)
+	copy(changed.Pix, noisy.Pix)
+	draw.Draw(changed, image.Rect(120, 60, 130, 70), image.NewUniform(color.NRGBA{255, 0, 255, 255}), image.Point{}, draw.Src)
+
+	opts := DefaultOptions()
+	result, err := Compare(a, noisy, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Regions) == 0 || result.DiffPixels() < 500 {
+		t.Fatalf("without despeckle: %d regions, %d diff pixels; want the noise to be found", len(result.Regions), result.DiffPixels())
+	}
+
+	opts.Diff.Despeckle = 1
+	result, err = Compare(a, noisy, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Regions) != 0 || result.DiffPixels() != 0 || result.HasDiff {
+		t.Errorf("noise only: %d regions, %d diff pixels; want none", len(result.Regions), result.DiffPixels())
+	}
+
+	result, err = Compare(a, changed, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Regions) != 1 || result.DiffPixels() != 100 {
+		t.Fatalf("with a change: %d regions, %d diff pixels; want the 10x10 change", len(result.Regions), result.DiffPixels())
+	}
+	if r := result.Regions[0].Bounds; !image.Rect(120, 60, 130, 70).In(r) {
+		t.Errorf("region %v does not contain the change", r)
+	}
+}
+
+func TestCompare_MaxRegions(t *testing.T) {
+	// 120 separate 2x2 changes, 20 pixels apart.
+	var changes []image.Rectangle
+	for y := 10; y < 200; y += 20 {
+		for x := 10; x < 240; x += 20 {
+			changes = append(changes, image.Rect(x, y, x+2, y+2))
+		}
+	}
+	a, b := makeImage(240, 200), makeImage(240, 200, changes...)
+
+	opts := DefaultOptions()
+	result, err := Compare(a, b, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Regions) != 120 || result.DroppedRegions != 0 {
+		t.Fatalf("unlimited: %d regions, %d dropped; want 120 and none", len(result.Regions), result.DroppedRegions)
+	}
+
+	opts.Region.MaxRegions = 50
+	var first []DiffRegion
+	for run := 0; run < 5; run++ {
+		opts.Runtime.Workers = 1 + run%3
+		result, err := Compare(a, b, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(result.Regions) != 50 || result.DroppedRegions != 70 || !result.HasDiff {
+			t.Fatalf("run %d: %d regions, %d dropped; want 50 and 70", run, len(result.Regions), result.DroppedRegions)
+		}
+		if run == 0 {
+			first = result.Regions
+		} else if !reflect.DeepEqual(result.Regions, first) {
+			t.Fatalf("run %d kept different regions:\n%v\nwant\n%v", run, result.Regions, first)
+		}
+	}
+}
+
+func TestCompare_DetectScroll(t *testing.T) {
+	// B is A with 12 rows inserted at row 40, pushing the rest down.
+	a := makeImage(200, 150)
+	b := image.NewNRGBA(image.Rect(0, 0, 200, 162))
+	for y := 0; y < 162; y++ {
+		for x := 0; x < 200; x++ {
+			switch {
+			case y < 40:
+				b.SetNRGBA(x, y, a.NRGBAAt(x, y))
+			case y < 52:
+				b.SetNRGBA(x, y, color.NRGBA{0, 200, 0, 255})
+			default:
+				b.SetNRGBA(x, y, a.NRGBAAt(x, y-12))
+			}
+		}
+	}
+
+	opts := DefaultOptions()
+	opts.Align.MaxOffsetX = 0
+	result, err := Compare(a, b, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.RowBands) != 0 || len(result.Regions) == 0 {
+		t.Fatalf("without scroll detection: %d bands, %d regions; want regions only", len(result.RowBands), len(result.Regions))
+	}
+
+	opts.VerticalAlign.DetectScroll = true
+	result, err = Compare(a, b, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []core.RowBand{{Kind: core.RowBandInserted, Y0: 40, Y1: 52, SrcY0: 40, SrcY1: 40}}
+	if !reflect.DeepEqual(result.RowBands, want) {
+		t.Errorf("bands = %+v, want %+v", result.RowBands, want)
+	}
+	if len(result.Regions) != 0 || result.DiffPixels() != 0 || !result.HasDiff {
+		t.Errorf("%d regions, %d diff pixels, has diff %v; want the band only", len(result.Regions), result.DiffPixels(), result.HasDiff)
+	}
+	// The inserted rows are drawn in their own color.
+	if got := result.Output.(*image.NRGBA).NRGBAAt(100, 40); got != opts.Render.InsertedColor {
+		t.Errorf("band border = %v, want %v", got, opts.Render.InsertedColor)
+	}
+}
+
+func TestCompare_AutoScale(t *testing.T) {
+	small := makeImage(100, 60)
+	// small at 1.5 times the size; downsampling blends neighbouring pixels of
+	// the gradient, which stays far below the diff threshold.
+	large := image.NewNRGBA(image.Rect(0, 0, 150, 90))
+	for y := 0; y < 90; y++ {
+		for x := 0; x < 150; x++ {
+			large.SetNRGBA(x, y, small.NRGBAAt(x*2/3, y*2/3))
+		}
+	}
+
+	opts := DefaultOptions()
+	opts.AutoScale = true
+	for _, tt := range []struct {
+		name string
+		a, b image.Image
+		want core.ScaleFactor
+	}{
+		{"input1 larger", large, small, core.ScaleFactor{Num: 3, Den: 2}},
+		{"input2 larger", small, large, core.ScaleFactor{Num: 2, Den: 3}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Compare(tt.a, tt.b, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Scale != tt.want || !result.Scaled {
+				t.Errorf("scale = %v, scaled %v; want %v, scaled", result.Scale, result.Scaled, tt.want)
+			}
+			for _, f := range []*core.Frame{result.FrameA, result.FrameB} {
+				if f.W != 100 || f.H != 60 {
+					t.Fatalf("frame %dx%d, want both 100x60", f.W, f.H)
+				}
+			}
+			if result.Aligned.DX != 0 || result.Aligned.DY != 0 || result.HasDiff {
+				t.Errorf("offset (%d,%d), diff %v; want (0,0) without differences", result.Aligned.DX, result.Aligned.DY, result.HasDiff)
+			}
+		})
+	}
+
+	// Without AutoScale the ratio is only reported.
+	result, err := Compare(large, small, DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Scale != (core.ScaleFactor{Num: 3, Den: 2}) || result.Scaled {
+		t.Errorf("scale = %v, scaled %v; want 3/2, not scaled", result.Scale, result.Scaled)
+	}
+
+	// Sizes that do not scale uniformly are refused.
+	_, err = Compare(makeImage(200, 60), small, opts)
+	var scaleErr *ScaleError
+	if !errors.As(err, &scaleErr) {
+		t.Fatalf("expected ScaleError, got %v", err)
+	}
+	if scaleErr.SizeA != image.Pt(200, 60) || scaleErr.SizeB != image.Pt(100, 60) {
+		t.Errorf("unexpected sizes in %v", scaleErr)
+	}
+}
+
+func TestCompare_SizeMismatch(t *testing.T) {
+	tall := makeImage(200, 150)
+	short := makeImage(200, 120, image.Rect(20, 20, 40, 40)) // the top of tall with one change
+	pad := color.NRGBA{255, 0, 255, 255}
+
+	t.Run("error", func(t *testing.T) {
+		opts := DefaultOptions()
+		opts.SizeMismatch = SizeMismatchError
+		_, err := Compare(tall, short, opts)
+		var sizeErr *ImageSizeError
+		if !errors.As(err, &sizeErr) {
+			t.Fatalf("expected ImageSizeError, got %v", err)
+		}
+		if sizeErr.SizeA != image.Pt(200, 150) || sizeErr.SizeB != image.Pt(200, 120) {
+			t.Errorf("unexpected sizes in %v", sizeErr)
+		}
+		if _, err := Compare(tall, tall, opts); err != nil {
+			t.Errorf("same size: %v", err)
+		}
+	})
+
+	for _, tt := range []struct {
+		name string
+		a, b image.Image
+	}{
+		{"A taller than B", tall, short},
+		{"B taller than A", short, tall},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultOptions()
+			opts.SizeMismatch = SizeMismatchPad
+			opts.PadColor = pad
+			// The luminance of the gradient repeats along diagonals; no search.
+			opts.Align.MaxOffsetX, opts.Align.MaxOffsetY = 0, 0
+			result, err := Compare(tt.a, tt.b, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, f := range []*core.Frame{result.FrameA, result.FrameB} {
+				if f.W != 200 || f.H != 150 {
+					t.Fatalf("frame %dx%d, want both padded to 200x150", f.W, f.H)
+				}
+			}
+			padded := result.FrameB
+			if tt.b == tall {
+				padded = result.FrameA
+			}
+			if got := padded.Pix.NRGBAAt(10, 140); got != pad {
+				t.Errorf("padding pixel = %v, want %v", got, pad)
+			}
+			// The change and the padded strip (rows 120-150) differ.
+			if got := result.DiffPixels(); got != 20*20+200*30 {
+				t.Errorf("%d diff pixels, want the change and the padded strip", got)
+			}
+
+			opts.PadIgnore = true
+			result, err = Compare(tt.a, tt.b, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.DiffPixels() != 20*20 || len(result.Regions) != 1 {
+				t.Errorf("%d diff pixels in regions %v, want only the change with the padding ignored", result.DiffPixels(), result.Regions)
+			}
+		})
+	}
+}
+
+func TestCompare_Identical(t *testing.T) {
+	img := makeImage(100, 80)
+	result, err := Compare(img, img, DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.HasDiff || result.DiffPixels() != 0 || len(result.Regions) != 0 {
+		t.Errorf("expected no differences, got %d pixels in %d regions", result.DiffPixels(), len(result.Regions))
+	}
+	if h := result.Histogram; h.Intersection != 1 || h.ChiSquare != 0 {
+		t.Errorf("histogram distance %+v, want equal histograms", h)
+	}
+	if result.Render() == nil {
+		t.Error("expected a rendered image")
+	}
+}
+
+func TestCompare_CornerRegionBorder(t *testing.T) {
+	a := image.NewNRGBA(image.Rect(0, 0, 30, 30))
+	draw.Draw(a, a.Bounds(), image.White, image.Point{}, draw.Src)
+	b := image.NewNRGBA(a.Bounds())
+	draw.Draw(b, b.Bounds(), a, image.Point{}, draw.Src)
+	draw.Draw(b, image.Rect(26, 26, 30, 30), image.Black, image.Point{}, draw.Src)
+
+	opts := DefaultOptions()
+	opts.Align.MaxOffsetX, opts.Align.MaxOffsetY = 0, 0
+	opts.Region.MinSize = 20
+	opts.Render.DrawOverlay = false
+	result, err := Compare(a, b, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Regions) != 1 {
+		t.Fatalf("regions = %+v, want one", result.Regions)
+	}
+	r := result.Regions[0].Bounds
+	if !r.In(b.Bounds()) || !image.Pt(29, 29).In(r) {
+		t.Fatalf("bounds %v, want a box within %v containing the corner", r, b.Bounds())
+	}
+
+	// The border is drawn inside the box, so all four sides are visible.
+	out := result.Render()
+	mid := image.Pt((r.Min.X+r.Max.X)/2, (r.Min.Y+r.Max.Y)/2)
+	for side, p := range map[string]image.Point{
+		"left":   {r.Min.X, mid.Y},
+		"right":  {r.Max.X - 1, mid.Y},
+		"top":    {mid.X, r.Min.Y},
+		"bottom": {mid.X, r.Max.Y - 1},
+	} {
+		if got := color.NRGBAModel.Convert(out.At(p.X, p.Y)); got != opts.Render.BorderColor {
+			t.Errorf("%s border pixel %v = %v, want %v", side, p, got, opts.Render.BorderColor)
+		}
+	}
+}
+
+func TestCompare_Base(t *testing.T) {
+	const dx, dy = 3, 0
+	a := makeImage(100, 80)
+	b := image.NewNRGBA(a.Bounds())
+	for y := 0; y < 80; y++ {
+		for x := 0; x < 100; x++ {
+			b.SetNRGBA(x, y, color.NRGBA{uint8(x - dx), uint8(y - dy), 100, 255})
+		}
+	}
+	draw.Draw(b, image.Rect(60, 40, 70, 50), image.White, image.Point{}, draw.Src)
+
+	for _, tt := range []struct {
+		base  RenderBase
+		img   *image.NRGBA
+		shift image.Point
+	}{
+		{RenderBaseB, b, image.Point{}},
+		{RenderBaseA, a, image.Pt(-dx, -dy)},
+	} {
+		t.Run(string(tt.base), func(t *testing.T) {
+			opts := DefaultOptions()
+			opts.Align.ForcedOffset = &image.Point{X: dx, Y: dy}
+			opts.Render.Base = tt.base
+			opts.VerticalAlign.Enabled = false
+			result, err := Compare(a, b, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(result.Regions) != 1 {
+				t.Fatalf("regions = %+v, want one", result.Regions)
+			}
+			box := result.Regions[0].Bounds.Add(tt.shift)
+			out := result.Render()
+			if out.Bounds() != a.Bounds() {
+				t.Fatalf("canvas %v, want %v", out.Bounds(), a.Bounds())
+			}
+			var mismatches int
+			for y := 0; y < 80; y++ {
+				for x := 0; x < 100; x++ {
+					if image.Pt(x, y).In(box) {
+						continue
+					}
+					if color.NRGBAModel.Convert(out.At(x, y)) != tt.img.NRGBAAt(x, y) {
+						mismatches++
+					}
+				}
+			}
+			if mismatches > 0 {
+				t.Errorf("%d pixels outside the region %v differ from the base image", mismatches, box)
+			}
+			if got := color.NRGBAModel.Convert(out.At(box.Min.X, box.Min.Y)); got != opts.Render.BorderColor {
+				t.Errorf("border pixel %v = %v, want %v", box.Min, got, opts.Render.BorderColor)
+			}
+			// Inside, the overlay blends the differing pixels of the other image.
+			center := image.Pt((box.Min.X+box.Max.X)/2, (box.Min.Y+box.Max.Y)/2)
+			if got := color.NRGBAModel.Convert(out.At(center.X, center.Y)); got == tt.img.NRGBAAt(center.X, center.Y) {
+				t.Errorf("pixel %v inside the region was not overlaid", center)
+			}
+		})
+	}
+}
+
+// makeIgnoreMask returns an opaque mask image where the rectangles are white.
+func makeIgnoreMask(w, h int, rects ...image.Rectangle) *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, w, h))
+	for _, r := range rects {
+		draw.Draw(img, r, image.White, image.Point{}, draw.Src)
+	}
+	return img
+}
+
+func TestCompare_IgnoreMask(t *testing.T) {
+	a := makeImage(200, 150)
+	b := makeImage(200, 150, image.Rect(20, 20, 40, 40), image.Rect(120, 90, 160, 110))
+	cases := []struct {
+		name    string
+		mask    image.Image
+		regions int
+	}{
+		{"both changes", makeIgnoreMask(200, 150, image.Rect(10, 10, 50, 50), image.Rect(110, 80, 170, 120)), 0},
+		{"one change", makeIgnoreMask(200, 150, image.Rect(10, 10, 50, 50)), 1},
+		{"scaled mask", makeIgnoreMask(100, 75, image.Rect(5, 5, 25, 25), image.Rect(55, 40, 85, 60)), 0},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			opts := DefaultOptions()
+			opts.Diff.Ignore = IgnoreMask(c.mask)
+			result, err := Compare(a, b, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Aligned.DX != 0 || result.Aligned.DY != 0 {
+				t.Errorf("offset (%d,%d), want (0,0)", result.Aligned.DX, result.Aligned.DY)
+			}
+			if len(result.Regions) != c.regions || result.HasDiff != (c.regions > 0) {
+				t.Errorf("%d regions, hasDiff %v; want %d regions", len(result.Regions), result.HasDiff, c.regions)
+			}
+		})
+	}
+}
+
+func TestCompare_IgnoreRects(t *testing.T) {
+	a := makeImage(200, 150)
+	b := makeImage(200, 150, image.Rect(20, 20, 40, 40), image.Rect(120, 90, 160, 110))
+	opts := DefaultOptions()
+	opts.Region.Padding = 5
+	opts.Diff.IgnoreRects = []image.Rectangle{
+		// Two overlapping rectangles covering the first change.
+		image.Rect(10, 10, 30, 50),
+		image.Rect(25, 10, 50, 50),
+		// The left half of the second change.
+		image.Rect(110, 80, 140, 120),
+	}
+	result, err := Compare(a, b, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.DiffPixels() != 20*20 {
+		t.Errorf("%d diff pixels, want 400 from the right half of the second change", result.DiffPixels())
+	}
+	if len(result.Regions) != 1 {
+		t.Fatalf("regions %v, want one", result.Regions)
+	}
+	for _, r := range opts.Diff.IgnoreRects {
+		if result.Regions[0].Bounds.Overlaps(r) {
+			t.Errorf("region %v overlaps ignore rect %v", result.Regions[0].Bounds, r)
+		}
+	}
+}
+
+// TestCompare_HasDiffIgnoresRegionFilters checks that differences too small
+// to form a region still count: the region filters only decide what is
+// reported and drawn, not whether the images differ.
+func TestCompare_HasDiffIgnoresRegionFilters(t *testing.T) {
+	a := makeImage(200, 150)
+	opts := DefaultOptions() // regions need at least 4 differing pixels
+
+	for _, change := range []image.Rectangle{image.Rect(50, 50, 51, 51), image.Rect(50, 50, 51, 53)} {
+		result, err := Compare(a, makeImage(200, 150, change), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		n := change.Dx() * change.Dy()
+		if result.DiffPixels() != n || len(result.Regions) != 0 || !result.HasDiff {
+			t.Errorf("%d px change: diffPixels=%d regions=%d hasDiff=%v, want %d, 0, true", n, result.DiffPixels(), len(result.Regions), result.HasDiff, n)
+		}
+	}
+
+	result, err := Compare(a, makeImage(200, 150), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.HasDiff {
+		t.Error("identical images: hasDiff=true, want false")
+	}
+
+	result, err = Compare(a, makeImage(200, 150, image.Rect(50, 50, 52, 52)), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Regions) != 1 || !result.HasDiff {
+		t.Errorf("4 px change: regions=%d hasDiff=%v, want 1, true", len(result.Regions), result.HasDiff)
+	}
+}
+
+func TestCompare_RegionsBySeverity(t *testing.T) {
+	// A tiny change near the top left and a large solid one further down.
+	tiny, large := image.Rect(20, 20, 23, 23), image.Rect(120, 80, 160, 120)
+	result, err := Compare(makeImage(200, 150), makeImage(200, 150, tiny, large), DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Regions) != 2 {
+		t.Fatalf("regions = %d, want 2", len(result.Regions))
+	}
+	first, second := result.Regions[0], result.Regions[1]
+	if !large.In(first.Bounds) || first.Severity <= second.Severity || first.MeanDiff == 0 {
+		t.Errorf("regions = %+v, want the large change first with the higher severity", result.Regions)
+	}
+}
+
+func TestCompare_MaxDiffRatio(t *testing.T) {
+	// 0.05% noise: five 2x2 specks, 20 of 40000 pixels.
+	var specks []image.Rectangle
+	for i := 0; i < 5; i++ {
+		specks = append(specks, image.Rect(20+i*35, 30+i*30, 22+i*35, 32+i*30))
+	}
+	a, b := makeImage(200, 200), makeImage(200, 200, specks...)
+
+	tests := []struct {
+		ratio  float64
+		pixels int
+		want   bool
+	}{
+		{0, 0, true},
+		{0.001, 0, false},
+		{0.0001, 0, true},
+		{0, 20, false},
+		{0, 19, true},
+		{0.001, 10, true}, // both limits apply
+	}
+	for _, tt := range tests {
+		opts := DefaultOptions()
+		opts.Diff.MaxDiffRatio, opts.Diff.MaxDiffPixels = tt.ratio, tt.pixels
+		result, err := Compare(a, b, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.DiffPixels() != 20 || len(result.Regions) != 5 {
+			t.Fatalf("diffPixels=%d regions=%d, want 20 and 5", result.DiffPixels(), len(result.Regions))
+		}
+		if result.HasDiff != tt.want {
+			t.Errorf("ratio=%g pixels=%d: HasDiff = %v, want %v", tt.ratio, tt.pixels, result.HasDiff, tt.want)
+		}
+	}
+}
+
+func TestCompare_MaxDiffRatioOfComparedPixels(t *testing.T) {
+	// 40 differing pixels in the right half, the left half ignored: 0.2% of
+	// the 20000 compared pixels, but only 0.1% of the canvas.
+	specks := []image.Rectangle{image.Rect(120, 20, 122, 30), image.Rect(150, 100, 152, 110)}
+	a, b := makeImage(200, 200), makeImage(200, 200, specks...)
+	opts := DefaultOptions()
+	opts.Diff.IgnoreRects = []image.Rectangle{image.Rect(0, 0, 100, 200)}
+	opts.Diff.MaxDiffRatio = 0.0015
+
+	result, err := Compare(a, b, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.ComparedPixels != 20000 || result.DiffPixels() != 40 || result.DiffRatio() != 0.002 {
+		t.Fatalf("compared=%d diffPixels=%d ratio=%g, want 20000, 40, 0.002", result.ComparedPixels, result.DiffPixels(), result.DiffRatio())
+	}
+	if !result.HasDiff {
+		t.Error("HasDiff = false, want the ratio of the compared pixels to exceed the tolerance")
+	}
+}
+
+func TestCompare_PHashPrefilter(t *testing.T) {
+	opts := DefaultOptions()
+	opts.PHashPrefilter = true
+
+	a := makeImage(200, 150)
+	result, err := Compare(a, makeImage(200, 150), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Prefiltered || result.HasDiff || result.DiffPixels() != 0 || result.Render() == nil {
+		t.Errorf("identical: prefiltered=%v hasDiff=%v diffPixels=%d, want a rendered result without differences", result.Prefiltered, result.HasDiff, result.DiffPixels())
+	}
+
+	// Differing hashes or sizes are always compared.
+	result, err = Compare(a, makeImage(200, 150, image.Rect(20, 20, 120, 100)), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Prefiltered || !result.HasDiff {
+		t.Errorf("large change: prefiltered=%v hasDiff=%v, want compared with differences", result.Prefiltered, result.HasDiff)
+	}
+	result, err = Compare(a, makeImage(210, 150), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Prefiltered {
+		t.Error("different sizes: prefiltered, want compared")
+	}
+}
+
+func TestCompare_VerifyClean(t *testing.T) {
+	a := makeImage(200, 150)
+	b := makeImage(200, 150, image.Rect(100, 70, 102, 72))
+	opts := DefaultOptions()
+	// 4 of 49 window pixels is below the ratio, so the filter drops the
+	// 2x2 change entirely.
+	opts.Diff.NoiseWindowSize = 7
+	opts.Diff.NoiseMinDiffRatio = 0.1
+	if got := opts.Diff.MinDetectableChange(); got != 3 {
+		t.Fatalf("MinDetectableChange() = %d, want 3", got)
+	}
+
+	result, err := Compare(a, b, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.HasDiff || result.Unfiltered {
+		t.Fatalf("hasDiff=%v unfiltered=%v, want the noise filter to hide the change", result.HasDiff, result.Unfiltered)
+	}
+
+	opts.Diff.VerifyClean = true
+	result, err = Compare(a, b, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.HasDiff || !result.Unfiltered || result.DiffPixels() != 4 {
+		t.Fatalf("hasDiff=%v unfiltered=%v diffPixels=%d, want the 4 changed pixels", result.HasDiff, result.Unfiltered, result.DiffPixels())
+	}
+	if len(result.Regions) != 1 || !result.Regions[0].Bounds.Overlaps(image.Rect(100, 70, 102, 72)) {
+		t.Errorf("regions %v, want one around the change", result.Regions)
+	}
+}
+
+func TestCompare_Grayscale(t *testing.T) {
+	// The patch differs in hue but not in BT.601 luminance (120).
+	a, b := makeImage(200, 150), makeImage(200, 150)
+	patch := image.Rect(60, 40, 100, 80)
+	for y := patch.Min.Y; y < patch.Max.Y; y++ {
+		for x := patch.Min.X; x < patch.Max.X; x++ {
+			a.SetNRGBA(x, y, color.NRGBA{120, 120, 120, 255})
+			b.SetNRGBA(x, y, color.NRGBA{170, 68, 253, 255})
+		}
+	}
+
+	opts := DefaultOptions()
+	result, err := Compare(a, b, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Regions) == 0 {
+		t.Fatal("color mode: no regions, want the hue change")
+	}
+
+	opts.Diff.Grayscale = true
+	result, err = Compare(a, b, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.HasDiff || len(result.Regions) != 0 {
+		t.Fatalf("grayscale mode: hasDiff=%v regions=%v, want none", result.HasDiff, result.Regions)
+	}
+	// The output is still based on the colors of B.
+	if got := color.NRGBAModel.Convert(result.Output.At(80, 60)); got != (color.NRGBA{170, 68, 253, 255}) {
+		t.Errorf("output pixel %v, want the original color of B", got)
+	}
+}
+
+func TestCompare_Normalize(t *testing.T) {
+	// b is a 20% brighter capture of a; no channel saturates.
+	a, b := image.NewNRGBA(image.Rect(0, 0, 200, 150)), image.NewNRGBA(image.Rect(0, 0, 200, 150))
+	for y := 0; y < 150; y++ {
+		for x := 0; x < 200; x++ {
+			p := color.NRGBA{uint8(40 + (x*7+y*3)%160), uint8(30 + y), uint8(60 + x/2), 255}
+			a.SetNRGBA(x, y, p)
+			b.SetNRGBA(x, y, color.NRGBA{uint8(float64(p.R) * 1.2), uint8(float64(p.G) * 1.2), uint8(float64(p.B) * 1.2), 255})
+		}
+	}
+
+	opts := DefaultOptions()
+	result, err := Compare(a, b, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Regions) == 0 || result.DiffRatio() < 0.25 {
+		t.Fatalf("without normalization: %d regions, %.2f%% differing; want the bright half", len(result.Regions), 100*result.DiffRatio())
+	}
+
+	opts.Diff.Normalize = true
+	result, err = Compare(a, b, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.HasDiff || len(result.Regions) != 0 {
+		t.Fatalf("with normalization: hasDiff=%v, %d regions, want none", result.HasDiff, len(result.Regions))
+	}
+	if result.Aligned.DX != 0 || result.Aligned.DY != 0 {
+		t.Errorf("offset (%d,%d), want (0,0)", result.Aligned.DX, result.Aligned.DY)
+	}
+	// The histograms compare the inputs as given.
+	if result.Histogram.ChiSquare < 0.1 {
+		t.Errorf("histogram distance %+v, want the brightness shift", result.Histogram)
+	}
+	// The outputs are based on the original colors of A.
+	if got := color.NRGBAModel.Convert(result.FrameA.Pix.At(17, 9)); got != a.NRGBAAt(17, 9) {
+		t.Errorf("frame A pixel %v, want the original %v", got, a.NRGBAAt(17, 9))
+	}
+
+	// A real change is still found.
+	for y := 60; y < 80; y++ {
+		for x := 90; x < 120; x++ {
+			b.SetNRGBA(x, y, color.NRGBA{250, 20, 20, 255})
+		}
+	}
+	result, err = Compare(a, b, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Regions) != 1 {
+		t.Fatalf("with a change: %d regions, want 1", len(result.Regions))
+	}
+}
+
+func TestCompare_ROI(t *testing.T) {
+	a := makeImage(200, 150)
+	inside, outside := image.Rect(120, 90, 140, 110), image.Rect(20, 20, 40, 40)
+	b := makeImage(200, 150, inside, outside)
+	opts := DefaultOptions()
+	opts.ROI = image.Rect(100, 70, 180, 130)
+
+	result, err := Compare(a, b, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.ROI != opts.ROI {
+		t.Errorf("ROI %v, want %v", result.ROI, opts.ROI)
+	}
+	if result.DiffPixels() != 20*20 || result.DiffMask.CountIn(inside) != 20*20 {
+		t.Errorf("%d diff pixels, want the 400 inside the ROI", result.DiffPixels())
+	}
+	if len(result.Regions) != 1 || !result.Regions[0].Bounds.Overlaps(inside) {
+		t.Errorf("regions %v, want one around %v", result.Regions, inside)
+	}
+	if b := result.Output.Bounds(); b.Dx() != 200 || b.Dy() != 150 {
+		t.Errorf("output %v, want the whole second image", b)
+	}
+	if got := result.Output.At(100, 100); got != opts.Render.ROIColor {
+		t.Errorf("ROI outline pixel = %v, want %v", got, opts.Render.ROIColor)
+	}
+
+	// Only the change outside: no differences, also in mask-only mode.
+	opts.ROI = image.Rect(150, 0, 400, 150)
+	result, err = Compare(a, makeImage(200, 150, outside), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.HasDiff {
+		t.Errorf("%d diff pixels outside the ROI were reported", result.DiffPixels())
+	}
+	if want := image.Rect(150, 0, 200, 150); result.ROI != want {
+		t.Errorf("ROI %v, want it clamped to %v", result.ROI, want)
+	}
+}
+
+// makeSplitTexture draws 4x4 pseudo-random gray blocks; rows from splitY on
+// are shifted right by shiftX.
+func makeSplitTexture(w, h, splitY, shiftX int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			sx := x
+			if y >= splitY {
+				sx -= shiftX
+			}
+			v := uint8((((sx+64)/4)*7919 + (y/4)*104729) % 251)
+			img.SetNRGBA(x, y, color.NRGBA{v, v, v, 255})
+		}
+	}
+	return img
+}
+
+func TestCompare_LocalAlign(t *testing.T) {
+	a := makeSplitTexture(240, 160, 160, 0)
+	// The header stays put while the content below moves 3px to the right.
+	b := makeSplitTexture(240, 160, 60, 3)
+
+	opts := DefaultOptions()
+	result, err := Compare(a, b, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Regions) == 0 {
+		t.Fatal("fixture: without local alignment the shifted part should differ")
+	}
+
+	opts.LocalAlign.Enabled = true
+	result, err = Compare(a, b, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.HasDiff || len(result.Regions) != 0 {
+		t.Errorf("%d regions, %d diff pixels; want none after local alignment", len(result.Regions), result.DiffPixels())
+	}
+	if len(result.LocallyAligned) == 0 {
+		t.Fatal("no locally aligned regions")
+	}
+	for _, la := range result.LocallyAligned {
+		if d := la.DX - result.Aligned.DX; (d != 3 && d != -3) || la.DY != result.Aligned.DY {
+			t.Errorf("local offset (%d,%d) against global (%d,%d), want 3px apart horizontally", la.DX, la.DY, result.Aligned.DX, result.Aligned.DY)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := WriteJSONReport(&buf, result, opts); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `"locally_aligned"`) {
+		t.Error("JSON report does not list the locally aligned regions")
+	}
+}
+
+func TestRun_IgnoreMaskHatched(t *testing.T) {
+	dir := t.TempDir()
+	opts := DefaultOptions()
+	opts.Input1, opts.Input2 = filepath.Join(dir, "a.png"), filepath.Join(dir, "b.png")
+	opts.Diff.IgnoreMaskPath = filepath.Join(dir, "mask.png")
+	opts.Render.HatchIgnored = true
+	writePNG(t, opts.Input1, makeImage(200, 150))
+	writePNG(t, opts.Input2, makeImage(200, 150, image.Rect(20, 20, 40, 40)))
+	writePNG(t, opts.Diff.IgnoreMaskPath, makeIgnoreMask(200, 150, image.Rect(10, 10, 50, 50)))
+
+	result, err := app.Run(opts, false, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.HasDiff {
+		t.Errorf("expected no differences outside the ignore mask, got %d pixels", result.DiffPixels())
+	}
+	// (24,24) lies on a hatch line inside the mask, (25,24) does not.
+	out := result.Output.(*image.NRGBA)
+	if got := out.NRGBAAt(24, 24); got != opts.Render.IgnoredColor {
+		t.Errorf("pixel on hatch line = %v, want %v", got, opts.Render.IgnoredColor)
+	}
+	if got := out.NRGBAAt(25, 24); got == opts.Render.IgnoredColor {
+		t.Error("pixel off the hatch line is hatched")
+	}
+}
+
+func TestCompare_OffsetRejected(t *testing.T) {
+	a := makeImage(100, 80)
+	b := image.NewNRGBA(a.Bounds())
+	for y := 0; y < 80; y++ {
+		for x := 0; x < 100; x++ {
+			b.Set(x, y, a.At(max(0, x-4), y))
+		}
+	}
+	opts := DefaultOptions()
+	opts.Align.MaxAcceptableOffset = 2
+	result, err := Compare(a, b, opts)
+
+	var offsetErr *OffsetRejectedError
+	if !errors.As(err, &offsetErr) {
+		t.Fatalf("expected OffsetRejectedError, got %v", err)
+	}
+	if result == nil || result.Aligned.DX != 4 {
+		t.Errorf("expected result with DX=4, got %+v", result)
+	}
+}
+
+type progressEvent struct {
+	stage   string
+	percent int // -1 for OnStage
+}
+
+type recordingReporter struct {
+	events []progressEvent
+}
+
+func (r *recordingReporter) OnStage(name string) {
+	r.events = append(r.events, progressEvent{name, -1})
+}
+
+func (r *recordingReporter) OnProgress(stage string, percent int, _, _ time.Duration) {
+	r.events = append(r.events, progressEvent{stage, percent})
+}
+
+func TestCompare_Progress(t *testing.T) {
+	opts := DefaultOptions()
+	checkProgress(t, opts)
+}
+
+// Many workers deliver results in bursts and the spiral search stops before
+// scoring every counted offset; events must still rise steadily to 100%.
+func TestCompare_ProgressManyWorkers(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Runtime.Workers = 64
+	opts.Align.SearchStrategy = core.SearchSpiral
+	checkProgress(t, opts)
+}
+
+func checkProgress(t *testing.T, opts Options) {
+	t.Helper()
+	rec := &recordingReporter{}
+	opts.Runtime.Progress = rec
+	a := makeImage(200, 150)
+	b := makeImage(200, 150, image.Rect(20, 20, 40, 40))
+	if _, err := Compare(a, b, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	var stages []string
+	last := map[string]int{}
+	for _, e := range rec.events {
+		if e.percent < 0 {
+			stages = append(stages, e.stage)
+			last[e.stage] = -1
+			continue
+		}
+		if e.percent <= last[e.stage] || e.percent > 100 {
+			t.Errorf("%s: percent %d after %d", e.stage, e.percent, last[e.stage])
+		}
+		last[e.stage] = e.percent
+	}
+
+	want := []string{"align", "diff", "vertical-align", "regions", "render"}
+	if strings.Join(stages, ",") != strings.Join(want, ",") {
+		t.Errorf("stages = %v, want %v", stages, want)
+	}
+	for _, s := range want {
+		if last[s] != 100 {
+			t.Errorf("%s: last percent %d, want 100", s, last[s])
+		}
+	}
+}
+
+// TestCompare_Workspace compares a sequence of pairs, including sizes that
+// shrink and grow, with one shared Workspace and expects the same masks,
+// regions and diff images as without one.
+func TestCompare_Workspace(t *testing.T) {
+	pairs := []struct{ a, b *image.NRGBA }{
+		{makeImage(200, 150), makeImage(200, 150, image.Rect(20, 20, 40, 40), image.Rect(120, 90, 160, 110))},
+		{makeImage(120, 80), makeImage(120, 80, image.Rect(10, 10, 14, 12))},
+		{makeImage(200, 150), makeImage(200, 150)},
+		{makeImage(240, 160), makeImage(240, 160, image.Rect(0, 0, 30, 30), image.Rect(200, 120, 240, 160))},
+	}
+	opts := DefaultOptions()
+	opts.Region.DilateRadius = 2
+	opts.Diff.NoiseWindowSize, opts.Diff.NoiseMinDiffRatio = 3, 0.2
+	wsOpts := opts
+	wsOpts.Runtime.Workspace = NewWorkspace()
+
+	for i, p := range pairs {
+		want, err := Compare(p.a, p.b, opts)
+		if err != nil {
+			t.Fatalf("pair %d: Compare failed: %v", i, err)
+		}
+		got, err := Compare(p.a, p.b, wsOpts)
+		if err != nil {
+			t.Fatalf("pair %d: Compare with workspace failed: %v", i, err)
+		}
+		if got.DiffMask.W != want.DiffMask.W || got.DiffMask.H != want.DiffMask.H || got.DiffMask.Count != want.DiffMask.Count || !bytes.Equal(got.DiffMask.Data, want.DiffMask.Data) {
+			t.Errorf("pair %d: mask differs with workspace (count %d, want %d)", i, got.DiffMask.Count, want.DiffMask.Count)
+		}
+		if fmt.Sprint(got.Regions) != fmt.Sprint(want.Regions) {
+			t.Errorf("pair %d: regions = %v, want %v", i, got.Regions, want.Regions)
+		}
+		gotOut, wantOut := got.Output.(*image.NRGBA), want.Output.(*image.NRGBA)
+		if gotOut.Rect != wantOut.Rect || !bytes.Equal(gotOut.Pix, wantOut.Pix) {
+			t.Errorf("pair %d: diff image differs with workspace", i)
+		}
+	}
+}
+
+func TestCompare_TileSize(t *testing.T) {
+	var changes []image.Rectangle
+	for i := 0; i < 12; i++ {
+		x, y := 37+i*97, 23+(i%4)*170 // several cross the 128 px tile borders
+		changes = append(changes, image.Rect(x, y, x+30+i*3, y+12+i*2))
+	}
+	a := makeImage(1300, 700)
+	b := makeImage(1300, 700, changes...)
+	want, err := Compare(a, b, DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := DefaultOptions()
+	opts.Region.TileSize = 128
+	got, err := Compare(a, b, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Regions) != len(changes) || fmt.Sprint(got.Regions) != fmt.Sprint(want.Regions) {
+		t.Errorf("tiled regions = %v\nwant %v", got.Regions, want.Regions)
+	}
+}
+
+func TestCompare_NilImage(t *testing.T) {
+	if _, err := Compare(nil, makeImage(10, 10), DefaultOptions()); err == nil {
+		t.Error("expected error for nil image")
+	}
+}
+
+func TestCompare_InvalidOptions(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Align.MaxOffsetX = -5
+	opts.Runtime.Workers = 0
+	img := makeImage(10, 10)
+	for name, compare := range map[string]func() error{
+		"Compare":          func() error { _, err := Compare(img, img, opts); return err },
+		"DetectRegions":    func() error { _, err := DetectRegions(img, img, 0, 0, opts); return err },
+		"GenerateDiffMask": func() error { _, err := GenerateDiffMask(img, img, 0, 0, opts); return err },
+		"ForEachComparedPixel": func() error {
+			return ForEachComparedPixel(img, img, 0, 0, opts, func(int, int, color.NRGBA, color.NRGBA, float64) bool { return true })
+		},
+	} {
+		err := compare()
+		if err == nil || !strings.Contains(err.Error(), "max offset X must not be negative") || !strings.Contains(err.Error(), "workers must be at least 1") {
+			t.Errorf("%s() error = %v, want the invalid max offset and workers", name, err)
+		}
+	}
+}
+
+func TestComposeLayout_Crop(t *testing.T) {
+	a := makeImage(400, 300)
+	opts := DefaultOptions()
+	opts.Output.Crop, opts.Output.CropMargin = true, 50
+
+	// One 20x20 change: its region spans 32x32 with the dilation and padding,
+	// then grows by the margin.
+	result, err := Compare(a, makeImage(400, 300, image.Rect(200, 150, 220, 170)), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := ComposeLayout(result, opts)
+	if b := out.Bounds(); b.Dx() != 132 || b.Dy() != 132 {
+		t.Fatalf("cropped size = %dx%d, want 132x132", b.Dx(), b.Dy())
+	}
+	// The 3px red border starts at the margin.
+	origin := out.Bounds().Min
+	for _, p := range []image.Point{{50, 50}, {52, 60}, {81, 81}} {
+		if r, g, b, _ := out.At(origin.X+p.X, origin.Y+p.Y).RGBA(); r>>8 != 255 || g != 0 || b != 0 {
+			t.Errorf("pixel %v of the crop is not red", p)
+		}
+	}
+
+	// Near the top-left corner the crop is clamped to the image.
+	result, err = Compare(a, makeImage(400, 300, image.Rect(10, 10, 20, 20)), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := ComposeLayout(result, opts).Bounds(); b != image.Rect(0, 0, 76, 76) {
+		t.Errorf("clamped crop = %v, want (0,0)-(76,76)", b)
+	}
+
+	// Without regions the full image is kept.
+	result, err = Compare(a, a, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := ComposeLayout(result, opts).Bounds(); b.Dx() != 400 || b.Dy() != 300 {
+		t.Errorf("uncropped size = %dx%d, want 400x300", b.Dx(), b.Dy())
+	}
+}
+
+func TestRun_CropEach(t *testing.T) {
+	dir := t.TempDir()
+	pathA, pathB := filepath.Join(dir, "a.png"), filepath.Join(dir, "b.png")
+	writePNG(t, pathA, makeImage(200, 150))
+	writePNG(t, pathB, makeImage(200, 150, image.Rect(20, 20, 40, 40), image.Rect(120, 90, 160, 110)))
+
+	opts := DefaultOptions()
+	opts.Input1, opts.Input2 = pathA, pathB
+	opts.Output.CropDir, opts.Output.CropMargin = filepath.Join(dir, "crops"), 10
+	result, err := app.Run(opts, false, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("app.Run failed: %v", err)
+	}
+	if len(result.Regions) != 2 {
+		t.Fatalf("regions = %d, want 2", len(result.Regions))
+	}
+	for i, r := range result.Regions {
+		f, err := os.Open(filepath.Join(opts.Output.CropDir, fmt.Sprintf("region-%03d.png", i+1)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg, err := png.DecodeConfig(f)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.Width != r.Bounds.Dx()+20 || cfg.Height != r.Bounds.Dy()+20 {
+			t.Errorf("crop %d = %dx%d, want the region %v plus 10 px", i+1, cfg.Width, cfg.Height, r.Bounds)
+		}
+	}
+}
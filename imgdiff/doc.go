@@ -0,0 +1,4 @@
+// Package imgdiff is the public Go API of go-img-diff. It runs the same
+// alignment, diff and rendering pipeline as the imgdiff command on in-memory
+// images.
+package imgdiff
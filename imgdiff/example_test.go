@@ -0,0 +1,171 @@
+package imgdiff_test
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"os"
+
+	"github.com/xshoji/go-img-diff/imgdiff"
+)
+
+// screenshot draws a gradient; each rectangle in changes is painted white.
+func screenshot(changes ...image.Rectangle) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, 160, 120))
+	for y := 0; y < 120; y++ {
+		for x := 0; x < 160; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{uint8(x), uint8(y), 100, 255})
+		}
+	}
+	for _, r := range changes {
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				img.SetNRGBA(x, y, color.NRGBA{255, 255, 255, 255})
+			}
+		}
+	}
+	return img
+}
+
+func ExampleCompare() {
+	before := screenshot()
+	after := screenshot(image.Rect(40, 30, 60, 50))
+
+	result, err := imgdiff.Compare(before, after, imgdiff.DefaultOptions())
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println("offset:", result.Aligned.DX, result.Aligned.DY)
+	fmt.Println("differing pixels:", result.DiffPixels())
+	for _, r := range result.Regions {
+		fmt.Println("region:", r.Bounds)
+	}
+	fmt.Println("rendered:", result.Render().Bounds())
+	// Output:
+	// offset: 0 0
+	// differing pixels: 400
+	// region: (34,24)-(66,56)
+	// rendered: (0,0)-(160,120)
+}
+
+func ExampleComposeLayout() {
+	before := screenshot()
+	after := screenshot(image.Rect(40, 30, 60, 50))
+
+	opts := imgdiff.DefaultOptions()
+	opts.Render.Layout = imgdiff.LayoutHorizontal
+	result, err := imgdiff.Compare(before, after, opts)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(imgdiff.ComposeLayout(result, opts).Bounds())
+	// Output:
+	// (0,0)-(340,120)
+}
+
+func ExampleGenerateDiffMask() {
+	before := screenshot()
+	after := screenshot(image.Rect(10, 10, 12, 11))
+
+	mask, err := imgdiff.GenerateDiffMask(before, after, 0, 0, imgdiff.DefaultOptions())
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(mask.GrayAt(10, 10).Y, mask.GrayAt(11, 10).Y, mask.GrayAt(12, 10).Y)
+	// Output:
+	// 255 255 0
+}
+
+func ExampleDetectRegions() {
+	before := screenshot()
+	after := screenshot(image.Rect(40, 30, 60, 50))
+
+	regions, err := imgdiff.DetectRegions(before, after, 0, 0, imgdiff.DefaultOptions())
+	if err != nil {
+		panic(err)
+	}
+	for _, r := range regions {
+		fmt.Println(r.Bounds, r.Area)
+	}
+	// Output:
+	// (34,24)-(66,56) 400
+}
+
+func ExampleDrawRegions() {
+	before := screenshot()
+	after := screenshot(image.Rect(40, 30, 60, 50))
+
+	regions, err := imgdiff.DetectRegions(before, after, 0, 0, imgdiff.DefaultOptions())
+	if err != nil {
+		panic(err)
+	}
+	rects := make([]image.Rectangle, len(regions))
+	for i, r := range regions {
+		rects[i] = r.Bounds
+	}
+
+	// Draw the boxes onto a half-size thumbnail owned by the caller.
+	thumb := image.NewRGBA(image.Rect(0, 0, 80, 60))
+	style := imgdiff.DefaultRegionStyle()
+	style.Thickness = 1
+	style.Scale = 0.5
+	imgdiff.DrawRegions(thumb, rects, style)
+	fmt.Println(thumb.RGBAAt(17, 20), thumb.RGBAAt(20, 20))
+	// Output:
+	// {255 0 0 255} {0 0 0 0}
+}
+
+func ExampleForEachComparedPixel() {
+	before := screenshot()
+	after := screenshot(image.Rect(10, 10, 12, 11))
+
+	// Count the pixels that got brighter in every channel.
+	brighter, largest := 0, 0.0
+	err := imgdiff.ForEachComparedPixel(before, after, 0, 0, imgdiff.DefaultOptions(), func(x, y int, a, b color.NRGBA, diff float64) bool {
+		if b.R > a.R && b.G > a.G && b.B > a.B {
+			brighter++
+		}
+		largest = max(largest, diff)
+		return true
+	})
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(brighter, largest)
+	// Output:
+	// 2 245
+}
+
+func ExampleBuildReviewBundle() {
+	before := screenshot()
+	after := screenshot(image.Rect(40, 30, 60, 50))
+
+	bundle, err := imgdiff.BuildReviewBundle(before, after, imgdiff.DefaultOptions(), imgdiff.DefaultBundleOptions())
+	if err != nil {
+		panic(err)
+	}
+	for _, a := range bundle.Artifacts {
+		fmt.Println(a.Name, a.ContentType)
+	}
+	// Output:
+	// diff.png image/png
+	// side-by-side.png image/png
+	// stats.json application/json
+	// regions/region-001.png image/png
+}
+
+func ExampleWriteRegionsCSV() {
+	before := screenshot()
+	after := screenshot(image.Rect(40, 30, 60, 50))
+
+	result, err := imgdiff.Compare(before, after, imgdiff.DefaultOptions())
+	if err != nil {
+		panic(err)
+	}
+	if err := imgdiff.WriteRegionsCSV(os.Stdout, result); err != nil {
+		panic(err)
+	}
+	// Output:
+	// index,min_x,min_y,max_x,max_y,width,height,area,differing_pixels,diff_ratio,mean_diff,severity,schema_version
+	// 1,34,24,66,56,32,32,1024,400,0.390625,215.912,0.330748,1
+}
@@ -0,0 +1,80 @@
+package imgdiff
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+
+	"github.com/xshoji/go-img-diff/internal/core"
+	"github.com/xshoji/go-img-diff/internal/diff"
+	"github.com/xshoji/go-img-diff/internal/render"
+)
+
+// Mask is a per-pixel mask, such as Options.Diff.Ignore.
+type Mask = core.Mask
+
+// IgnoreMask converts a mask image for Options.Diff.Ignore: if the image has
+// any transparency its non-transparent pixels are ignored, otherwise its light
+// pixels are.
+func IgnoreMask(img image.Image) *Mask {
+	return core.MaskFromImage(img)
+}
+
+// GenerateDiffMask compares imgB against imgA shifted by (offsetX, offsetY) and
+// returns a mask with the dimensions of imgB where white marks a differing
+// pixel. Pixels in Options.Diff.Ignore and Options.Diff.IgnoreRects never differ. No alignment search or
+// region grouping is performed.
+func GenerateDiffMask(imgA, imgB image.Image, offsetX, offsetY int, opts Options) (*image.Gray, error) {
+	if err := checkMaskInputs(imgA, imgB, opts); err != nil {
+		return nil, err
+	}
+	a := core.NewFrame(imgA)
+	b := core.NewFrame(imgB)
+	if ignore := opts.Diff.IgnoreMask(b.W, b.H); ignore != nil {
+		b = b.WithIgnore(ignore)
+	}
+	rowAlign := core.NewRowAlignment(b.W, b.H, offsetX, offsetY)
+	mask := diff.BuildMask(a, b, rowAlign, opts.Diff, discardLogger())
+	return render.MaskImage(mask), nil
+}
+
+// ForEachComparedPixel calls fn for every pixel (x, y) of imgB that
+// GenerateDiffMask compares with a pixel of imgA shifted by (offsetX, offsetY),
+// in row-major order, until fn returns false. cA and cB are the two colors and
+// diff their difference under Options.Diff.Metric, on the scale of
+// Options.Diff.Threshold.
+//
+// GenerateDiffMask marks exactly the visited pixels with diff > Threshold
+// (with Options.Diff.ChannelThresholds: with any channel over its own),
+// unless they are removed by Options.Diff.IgnoreAntialiasing or the noise
+// filter, plus the rows of imgB that have no counterpart in imgA, which are
+// not visited. Ignored pixels are not visited either. fn is not called when
+// an error is returned.
+func ForEachComparedPixel(imgA, imgB image.Image, offsetX, offsetY int, opts Options, fn func(x, y int, cA, cB color.NRGBA, diff float64) bool) error {
+	if err := checkMaskInputs(imgA, imgB, opts); err != nil {
+		return err
+	}
+	a := core.NewFrame(imgA)
+	b := core.NewFrame(imgB)
+	if ignore := opts.Diff.IgnoreMask(b.W, b.H); ignore != nil {
+		b = b.WithIgnore(ignore)
+	}
+	rowAlign := core.NewRowAlignment(b.W, b.H, offsetX, offsetY)
+	diff.ForEachComparedPixel(a, b, rowAlign, opts.Diff, func(x, y, ax, ay int, d float64) bool {
+		return fn(x, y, a.Pix.NRGBAAt(ax, ay), b.Pix.NRGBAAt(x, y), d)
+	})
+	return nil
+}
+
+// checkMaskInputs rejects the inputs Compare and DetectRegions reject before
+// any frame is built.
+func checkMaskInputs(imgA, imgB image.Image, opts Options) error {
+	if imgA == nil || imgB == nil {
+		return errors.New("imgdiff: both images are required")
+	}
+	if err := opts.Validate(); err != nil {
+		return fmt.Errorf("imgdiff: invalid options: %w", err)
+	}
+	return nil
+}
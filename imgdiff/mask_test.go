@@ -0,0 +1,120 @@
+package imgdiff
+
+import (
+	"image"
+	"image/color"
+	"slices"
+	"testing"
+)
+
+func TestGenerateDiffMask(t *testing.T) {
+	a := makeImage(60, 40)
+	b := makeImage(60, 40, image.Rect(10, 5, 20, 15))
+
+	mask, err := GenerateDiffMask(a, b, 0, 0, DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mask.Bounds() != b.Bounds() {
+		t.Fatalf("mask bounds %v, want %v", mask.Bounds(), b.Bounds())
+	}
+	for y := 0; y < 40; y++ {
+		for x := 0; x < 60; x++ {
+			want := uint8(0)
+			if image.Pt(x, y).In(image.Rect(10, 5, 20, 15)) {
+				want = 255
+			}
+			if got := mask.GrayAt(x, y).Y; got != want {
+				t.Fatalf("pixel (%d,%d) = %d, want %d", x, y, got, want)
+			}
+		}
+	}
+}
+
+func TestForEachComparedPixel(t *testing.T) {
+	a := makeImage(30, 20)
+	b := makeImage(30, 20, image.Rect(10, 5, 14, 8))
+	opts := DefaultOptions()
+	opts.Diff.IgnoreRects = []image.Rectangle{image.Rect(0, 0, 30, 2)}
+
+	// Shifted by (2,1): row 0 of B has no counterpart, columns 0-1 are
+	// outside A and rows 0-1 are ignored.
+	mask, err := GenerateDiffMask(a, b, 2, 1, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	visited, differing := 0, 0
+	err = ForEachComparedPixel(a, b, 2, 1, opts, func(x, y int, cA, cB color.NRGBA, diff float64) bool {
+		visited++
+		if x < 2 || y < 2 {
+			t.Errorf("visited (%d,%d), which is not compared", x, y)
+		}
+		if cA != a.NRGBAAt(x-2, y-1) || cB != b.NRGBAAt(x, y) {
+			t.Errorf("(%d,%d): colors %v %v, want A at (%d,%d) and B at (%d,%d)", x, y, cA, cB, x-2, y-1, x, y)
+		}
+		if marked := mask.GrayAt(x, y).Y != 0; marked != (diff > float64(opts.Diff.Threshold)) {
+			t.Errorf("(%d,%d): diff %v disagrees with the mask (%v)", x, y, diff, marked)
+		}
+		if diff > float64(opts.Diff.Threshold) {
+			differing++
+		}
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if visited != 28*18 || differing != 4*3 {
+		t.Errorf("visited %d pixels with %d differing, want %d and 12", visited, differing, 28*18)
+	}
+
+	var seen []image.Point
+	_ = ForEachComparedPixel(a, b, 0, 0, DefaultOptions(), func(x, y int, _, _ color.NRGBA, _ float64) bool {
+		seen = append(seen, image.Pt(x, y))
+		return len(seen) < 3
+	})
+	if want := []image.Point{{0, 0}, {1, 0}, {2, 0}}; !slices.Equal(seen, want) {
+		t.Errorf("visited %v before stopping, want %v", seen, want)
+	}
+}
+
+func TestGenerateDiffMask_WithOffset(t *testing.T) {
+	a := image.NewNRGBA(image.Rect(0, 0, 30, 30))
+	b := image.NewNRGBA(image.Rect(0, 0, 30, 30))
+	a.SetNRGBA(10, 10, color.NRGBA{255, 255, 255, 255})
+	b.SetNRGBA(13, 12, color.NRGBA{255, 255, 255, 255})
+
+	if mask, _ := GenerateDiffMask(a, b, 3, 2, DefaultOptions()); mask.GrayAt(13, 12).Y != 0 {
+		t.Error("expected shifted pixel to match with offset (3,2)")
+	}
+	if mask, _ := GenerateDiffMask(a, b, 0, 0, DefaultOptions()); mask.GrayAt(13, 12).Y != 255 || mask.GrayAt(10, 10).Y != 255 {
+		t.Error("expected both pixels to differ without offset")
+	}
+}
+
+func TestGenerateDiffMask_NilImage(t *testing.T) {
+	img := makeImage(10, 10)
+	if mask, err := GenerateDiffMask(nil, img, 0, 0, DefaultOptions()); err == nil || mask != nil {
+		t.Errorf("GenerateDiffMask(nil, img) = %v, %v; want an error", mask, err)
+	}
+	if _, err := GenerateDiffMask(img, nil, 0, 0, DefaultOptions()); err == nil {
+		t.Error("expected an error for a nil second image")
+	}
+}
+
+func TestForEachComparedPixel_NilImage(t *testing.T) {
+	img := makeImage(10, 10)
+	called := false
+	fn := func(int, int, color.NRGBA, color.NRGBA, float64) bool {
+		called = true
+		return true
+	}
+	if err := ForEachComparedPixel(nil, img, 0, 0, DefaultOptions(), fn); err == nil {
+		t.Error("expected an error for a nil first image")
+	}
+	if err := ForEachComparedPixel(img, nil, 0, 0, DefaultOptions(), fn); err == nil {
+		t.Error("expected an error for a nil second image")
+	}
+	if called {
+		t.Error("fn was called for a nil image")
+	}
+}
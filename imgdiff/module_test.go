@@ -0,0 +1,98 @@
+package imgdiff
+
+import (
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+const modulePath = "github.com/xshoji/go-img-diff"
+
+// TestImportPaths guards against stale module paths: every non-standard import
+// must use the canonical module path, and go.mod must not need a replace
+// directive to build.
+func TestImportPaths(t *testing.T) {
+	root := ".."
+	goMod, err := os.ReadFile(filepath.Join(root, "go.mod"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(string(goMod), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "module ") && strings.TrimSpace(strings.TrimPrefix(line, "module ")) != modulePath {
+			t.Errorf("go.mod declares %q, want module %s", line, modulePath)
+		}
+		if strings.HasPrefix(line, "replace") {
+			t.Errorf("go.mod must not contain replace directives: %q", line)
+		}
+	}
+
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && (strings.HasPrefix(d.Name(), ".") && path != root || d.Name() == "testdata") {
+			return filepath.SkipDir
+		}
+		if d.IsDir() || !strings.HasSuffix(path, ".go") {
+			return nil
+		}
+		f, err := parser.ParseFile(token.NewFileSet(), path, nil, parser.ImportsOnly)
+		if err != nil {
+			return err
+		}
+		for _, imp := range f.Imports {
+			p, _ := strconv.Unquote(imp.Path.Value)
+			first := strings.Split(p, "/")[0]
+			if !strings.Contains(first, ".") {
+				continue // standard library
+			}
+			if p != modulePath && !strings.HasPrefix(p, modulePath+"/") {
+				t.Errorf("%s imports %q outside module %s", path, p, modulePath)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestInstallPath checks that the go install command in the README names a
+// main package of this module, so it works from a fresh clone and @latest.
+func TestInstallPath(t *testing.T) {
+	readme, err := os.ReadFile(filepath.Join("..", "README.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found bool
+	for _, line := range strings.Split(string(readme), "\n") {
+		pkg, ok := strings.CutPrefix(strings.TrimSpace(line), "go install ")
+		if !ok {
+			continue
+		}
+		found = true
+		pkg, _, _ = strings.Cut(pkg, "@")
+		rel, ok := strings.CutPrefix(pkg, modulePath+"/")
+		if !ok {
+			t.Errorf("README installs %q outside module %s", pkg, modulePath)
+			continue
+		}
+		pkgs, err := parser.ParseDir(token.NewFileSet(), filepath.Join("..", filepath.FromSlash(rel)), nil, parser.PackageClauseOnly)
+		if err != nil {
+			t.Errorf("README installs %q: %v", pkg, err)
+			continue
+		}
+		if _, ok := pkgs["main"]; !ok {
+			t.Errorf("README installs %q, which is not a main package", pkg)
+		}
+	}
+	if !found {
+		t.Error("README has no go install command")
+	}
+}
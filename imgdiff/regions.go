@@ -0,0 +1,81 @@
+package imgdiff
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+
+	"github.com/xshoji/go-img-diff/internal/app"
+	"github.com/xshoji/go-img-diff/internal/core"
+	"github.com/xshoji/go-img-diff/internal/render"
+)
+
+// DiffRegion is a rectangle of differing pixels in the coordinates of the
+// second image: Bounds, the number of differing pixels in it (Area), and their
+// MeanDiff and Severity. With Options.Region.Outline RegionOutlineContour,
+// Contour holds the polygons following the differing pixels.
+type DiffRegion = core.Region
+
+// Contour is the outline of a DiffRegion: one polygon of pixel positions per
+// group of touching differing pixels.
+type Contour = core.Contour
+
+// RegionOutline selects how Options outlines regions.
+type RegionOutline = core.RegionOutline
+
+// Region outlines.
+const (
+	RegionOutlineBox     = core.RegionOutlineBox     // the bounding box (default)
+	RegionOutlineContour = core.RegionOutlineContour // polygons traced around the differing pixels
+)
+
+// DetectRegions compares imgB against imgA shifted by (offsetX, offsetY), like
+// GenerateDiffMask, and groups the differing pixels into regions without
+// rendering anything. No alignment search, rotation, vertical or local
+// re-alignment is performed; otherwise the regions are those Compare extracts
+// and draws, sorted by severity. Progress is only reported to
+// Options.Runtime.Progress.
+func DetectRegions(imgA, imgB image.Image, offsetX, offsetY int, opts Options) ([]DiffRegion, error) {
+	if imgA == nil || imgB == nil {
+		return nil, errors.New("imgdiff: both images are required")
+	}
+	if err := opts.Validate(); err != nil {
+		return nil, fmt.Errorf("imgdiff: invalid options: %w", err)
+	}
+	frameA, frameB := core.NewFrame(imgA), core.NewFrame(imgB)
+	if err := app.CheckDimensions(frameA, frameB, opts); err != nil {
+		return nil, err
+	}
+	opts.Align.ForcedOffset = &image.Point{X: offsetX, Y: offsetY}
+	opts.Align.MaxAspectFactor = 0
+	opts.VerticalAlign.Enabled = false
+	opts.LocalAlign.Enabled = false
+	return app.Compare(frameA, frameB, opts, true, discardLogger()).Regions, nil
+}
+
+// RegionStyle sets the color, border thickness, fill, labels and coordinate
+// mapping DrawRegions uses.
+type RegionStyle = render.RegionStyle
+
+// RegionDrawMode selects how DrawRegions paints the inside of a region.
+type RegionDrawMode = render.RegionDrawMode
+
+// Region draw modes.
+const (
+	RegionDrawOutline = render.RegionDrawOutline // border only (default)
+	RegionDrawFill    = render.RegionDrawFill    // border plus a translucent fill at FillAlpha
+)
+
+// DefaultRegionStyle returns the style of the regular diff output: a 3 px red
+// outline without labels.
+func DefaultRegionStyle() RegionStyle {
+	return render.DefaultRegionStyle()
+}
+
+// DrawRegions draws region annotations onto dst, for example the Bounds of
+// the regions DetectRegions returns drawn onto a caller's own canvas. Regions
+// are multiplied by style.Scale, moved by style.Offset and clipped to dst.
+func DrawRegions(dst draw.Image, regions []image.Rectangle, style RegionStyle) {
+	render.DrawRegions(dst, regions, style)
+}
@@ -0,0 +1,69 @@
+package imgdiff
+
+import (
+	"image"
+	"image/draw"
+	"reflect"
+	"testing"
+)
+
+func TestDetectRegions(t *testing.T) {
+	change := image.Rect(80, 60, 120, 90)
+	a := makeImage(200, 150)
+	b := makeImage(200, 150, change)
+
+	regions, err := DetectRegions(a, b, 0, 0, DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(regions) != 1 || regions[0].Area != change.Dx()*change.Dy() || !change.In(regions[0].Bounds) {
+		t.Fatalf("regions %+v, want one covering %v with %d pixels", regions, change, change.Dx()*change.Dy())
+	}
+
+	// The regions are the ones Compare draws for the same offset.
+	opts := DefaultOptions()
+	opts.Align.MaxOffsetX, opts.Align.MaxOffsetY = 0, 0
+	result, err := Compare(a, b, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(regions, result.Regions) {
+		t.Errorf("DetectRegions = %+v, Compare regions = %+v", regions, result.Regions)
+	}
+}
+
+func TestDetectRegions_Offset(t *testing.T) {
+	a := makeImage(200, 150, image.Rect(80, 60, 120, 90))
+	// b shows a scrolled 5 px up: b(x, y) = a(x, y+5).
+	b := image.NewNRGBA(a.Bounds())
+	draw.Draw(b, b.Rect, a, image.Pt(0, 5), draw.Src)
+
+	regions, err := DetectRegions(a, b, 0, -5, DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Only the bottom rows of b, which have no counterpart in a, differ.
+	if len(regions) != 1 || regions[0].Area != 200*5 || regions[0].Bounds.Max.Y != 150 {
+		t.Errorf("regions %+v, want only the uncovered bottom rows", regions)
+	}
+	if regions, _ := DetectRegions(a, b, 0, 0, DefaultOptions()); len(regions) == 0 {
+		t.Error("expected differences at the wrong offset")
+	}
+}
+
+func TestDetectRegions_NilImage(t *testing.T) {
+	if _, err := DetectRegions(nil, makeImage(10, 10), 0, 0, DefaultOptions()); err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestDetectRegions_OffsetBeyondImages(t *testing.T) {
+	// Library callers pass arbitrary offsets; one without overlap compares
+	// nothing instead of indexing outside the images.
+	img := makeImage(20, 20)
+	for _, offset := range []image.Point{{500, 500}, {-500, 0}, {0, 20}} {
+		if _, err := DetectRegions(img, img, offset.X, offset.Y, DefaultOptions()); err != nil {
+			t.Errorf("offset %v: %v", offset, err)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package imgdiff
+
+import (
+	"image"
+	"io"
+
+	"github.com/xshoji/go-img-diff/internal/app"
+	"github.com/xshoji/go-img-diff/internal/core"
+	"github.com/xshoji/go-img-diff/internal/report"
+)
+
+// Layout selects the output image arrangement of ComposeLayout.
+type Layout = core.Layout
+
+// Output layouts.
+const (
+	LayoutSimple     = core.LayoutSimple     // annotated diff only
+	LayoutHorizontal = core.LayoutHorizontal // image A and the diff
+	LayoutSideBySide = core.LayoutSideBySide // image A, image B and the diff with captions
+)
+
+// ComposeLayout returns the final output image for opts.Render.Layout, the same
+// image the imgdiff command writes to --output.
+func ComposeLayout(result *Result, opts Options) image.Image {
+	return app.ApplyLayout(result, opts, discardLogger())
+}
+
+// WriteJSONReport writes the machine-readable report of --json-report.
+func WriteJSONReport(w io.Writer, result *Result, opts Options) error {
+	return report.Build(opts, result).Write(w)
+}
+
+// WriteHTMLReport writes the self-contained HTML page of --html-report.
+func WriteHTMLReport(w io.Writer, result *Result, opts Options) error {
+	return report.WriteHTML(w, opts, result)
+}
+
+// WriteRegionsCSV writes the region table of --regions-csv.
+func WriteRegionsCSV(w io.Writer, result *Result) error {
+	return report.WriteRegionsCSV(w, result.Regions)
+}
@@ -0,0 +1,134 @@
+//go:build !light_test_only
+
+package align
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"testing"
+
+	"github.com/xshoji/go-img-diff/internal/core"
+)
+
+// benchFrames returns a 1280x720 pair of random gray blocks, B shifted by
+// (9,-6) against A, generated once for all benchmarks of the package.
+var benchFrames = sync.OnceValues(func() (*core.Frame, *core.Frame) {
+	a := makeRandomBlockFrame(rand.New(rand.NewPCG(8, 8)), 1280, 720, 0, 0)
+	b := makeRandomBlockFrame(rand.New(rand.NewPCG(8, 8)), 1280, 720, 9, -6)
+	return a, b
+})
+
+// BenchmarkCalcMAE scores a single offset over the full overlap, the inner
+// loop of every alignment search.
+func BenchmarkCalcMAE(b *testing.B) {
+	fa, fb := benchFrames()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		calcMAE(fa, fb, 9, -6, 1e9)
+	}
+}
+
+// BenchmarkAlign runs the default pyramid search for a small and a large
+// offset window.
+func BenchmarkAlign(b *testing.B) {
+	fa, fb := benchFrames()
+	for _, maxOffset := range []int{10, 60} {
+		b.Run(fmt.Sprintf("max-offset=%d", maxOffset), func(b *testing.B) {
+			opts := core.DefaultOptions().Align
+			opts.MaxOffsetX, opts.MaxOffsetY = maxOffset, maxOffset
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				alignFrames(fa, fb, opts, 4, nil, testLogger())
+			}
+		})
+	}
+}
+
+func BenchmarkAlign_EarlyAbandon(b *testing.B) {
+	fa := makeTexturedFrame(400, 300, 0, 0)
+	fb := makeTexturedFrame(400, 300, 3, -2)
+	for _, abandon := range []bool{false, true} {
+		name := "full"
+		if abandon {
+			name = "early-abandon"
+		}
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			opts := core.AlignOptions{MaxOffsetX: 30, MaxOffsetY: 30, MinPyramidSize: 400, RefinementRadius: 2, EarlyAbandon: abandon}
+			var pixels int64
+			for i := 0; i < b.N; i++ {
+				_, stats := alignFrames(fa, fb, opts, 4, nil, testLogger())
+				pixels += stats.ScoredPixels
+			}
+			b.ReportMetric(float64(pixels)/float64(b.N), "pixels/op")
+		})
+	}
+}
+
+func BenchmarkAlign_SearchStrategy(b *testing.B) {
+	fa := makeTexturedFrame(400, 300, 0, 0)
+	fb := makeTexturedFrame(400, 300, 2, -1)
+	for _, strategy := range []core.SearchStrategy{core.SearchFull, core.SearchSpiral} {
+		b.Run(string(strategy), func(b *testing.B) {
+			opts := core.AlignOptions{MaxOffsetX: 30, MaxOffsetY: 30, MinPyramidSize: 400, RefinementRadius: 2, EarlyAbandon: true, SearchStrategy: strategy}
+			var offsets int
+			for i := 0; i < b.N; i++ {
+				_, stats := alignFrames(fa, fb, opts, 4, nil, testLogger())
+				offsets += stats.Candidates
+			}
+			b.ReportMetric(float64(offsets)/float64(b.N), "offsets/op")
+		})
+	}
+}
+
+func BenchmarkAlign_EarlyReject(b *testing.B) {
+	fa := makeTexturedFrame(400, 300, 0, 0)
+	fb := makeTexturedFrame(400, 300, 3, -2)
+	for _, early := range []bool{false, true} {
+		name := "exhaustive"
+		if early {
+			name = "early-reject"
+		}
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			opts := core.AlignOptions{MaxOffsetX: 30, MaxOffsetY: 30, MinPyramidSize: 400, RefinementRadius: 2, EarlyReject: early}
+			var pixels int64
+			for i := 0; i < b.N; i++ {
+				_, stats := alignFrames(fa, fb, opts, 4, nil, testLogger())
+				pixels += stats.ScoredPixels + stats.ProbedPixels
+			}
+			b.ReportMetric(float64(pixels)/float64(b.N), "pixels/op")
+		})
+	}
+}
+
+func BenchmarkAlign_Exhaustive(b *testing.B) {
+	fa := makeRandomBlockFrame(rand.New(rand.NewPCG(1, 2)), 800, 600, 0, 0)
+	fb := makeRandomBlockFrame(rand.New(rand.NewPCG(1, 2)), 800, 600, 7, -4)
+	for _, pruned := range []bool{false, true} {
+		name := "full"
+		if pruned {
+			name = "pruned"
+		}
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			opts := core.AlignOptions{MaxOffsetX: 20, MaxOffsetY: 20, Exhaustive: true, EarlyReject: pruned, EarlyAbandon: pruned}
+			for i := 0; i < b.N; i++ {
+				alignFrames(fa, fb, opts, 4, nil, testLogger())
+			}
+		})
+	}
+}
+
+// BenchmarkAlign_LargeWindow searches a +/-100 px window (about 40k offsets)
+// to measure the allocations of candidate dispatch.
+func BenchmarkAlign_LargeWindow(b *testing.B) {
+	fa := makeRandomBlockFrame(rand.New(rand.NewPCG(1, 2)), 320, 240, 0, 0)
+	fb := makeRandomBlockFrame(rand.New(rand.NewPCG(1, 2)), 320, 240, 9, -6)
+	opts := core.AlignOptions{MaxOffsetX: 100, MaxOffsetY: 100, Exhaustive: true, EarlyAbandon: true}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		alignFrames(fa, fb, opts, 4, nil, testLogger())
+	}
+}
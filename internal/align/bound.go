@@ -0,0 +1,118 @@
+package align
+
+import (
+	"image"
+	"math"
+
+	"github.com/xshoji/go-img-diff/internal/core"
+)
+
+// boundBlock is the side of the blocks whose grayscale sums bound the error
+// of an offset.
+const boundBlock = 16
+
+// integral is the summed-area table of a frame's grayscale values. The sums
+// wrap around modulo 2^32; rectangle sums below that are still exact, so
+// frames of any size fit.
+type integral struct {
+	stride int // frame width + 1
+	sum    []uint32
+}
+
+func newIntegral(f *core.Frame) *integral {
+	t := &integral{stride: f.W + 1, sum: make([]uint32, (f.W+1)*(f.H+1))}
+	for y := 0; y < f.H; y++ {
+		var row uint32
+		for x, v := range f.Gray[y*f.W : (y+1)*f.W] {
+			row += uint32(v)
+			t.sum[(y+1)*t.stride+x+1] = t.sum[y*t.stride+x+1] + row
+		}
+	}
+	return t
+}
+
+// rect returns the sum of the grayscale values in [x0,x1) x [y0,y1).
+func (t *integral) rect(x0, y0, x1, y1 int) uint32 {
+	return t.sum[y1*t.stride+x1] - t.sum[y0*t.stride+x1] - t.sum[y1*t.stride+x0] + t.sum[y0*t.stride+x0]
+}
+
+// errorBound rejects candidate offsets whose MAE cannot reach a limit
+// without scanning their overlap. The absolute error summed over a block is
+// at least the difference of the block's grayscale sums in A and B, so the
+// block differences over a tiling of the overlap bound the error from below.
+// It is only valid for frames without ignored pixels.
+type errorBound struct {
+	a, b  *integral
+	sizeA image.Point
+	sizeB image.Point
+}
+
+// newErrorBound returns the bound for frames a and b, or nil if b has an
+// ignore mask.
+func newErrorBound(a, b *core.Frame) *errorBound {
+	if b.Ignore != nil {
+		return nil
+	}
+	return &errorBound{a: newIntegral(a), b: newIntegral(b), sizeA: image.Pt(a.W, a.H), sizeB: image.Pt(b.W, b.H)}
+}
+
+// exceeds reports whether the MAE of offset (dx, dy), as computed by calcMAE,
+// is certain to exceed limit, i.e. calcMAE would abandon it. A nil bound
+// never does.
+func (e *errorBound) exceeds(dx, dy int, limit float64) bool {
+	if e == nil || limit == math.MaxFloat64 {
+		return false
+	}
+	overlap, ok := scoredOverlap(e.sizeA, e.sizeB, dx, dy)
+	if !ok {
+		return false
+	}
+	threshold := uint64(math.Ceil(limit * float64(overlap.Dx()*overlap.Dy())))
+	return e.sum(overlap, dx, dy, threshold) > threshold
+}
+
+// mae returns the lower bound of the MAE of offset (dx, dy), or
+// math.MaxFloat64 if the offset is not scored.
+func (e *errorBound) mae(dx, dy int) float64 {
+	overlap, ok := scoredOverlap(e.sizeA, e.sizeB, dx, dy)
+	if !ok {
+		return math.MaxFloat64
+	}
+	return float64(e.sum(overlap, dx, dy, math.MaxUint64)) / float64(overlap.Dx()*overlap.Dy())
+}
+
+// sum returns the bound of the summed absolute error of offset (dx, dy) over
+// overlap, or a partial sum above stop once it exceeds stop.
+func (e *errorBound) sum(overlap image.Rectangle, dx, dy int, stop uint64) uint64 {
+	var bound uint64
+	for y0 := overlap.Min.Y; y0 < overlap.Max.Y; y0 += boundBlock {
+		y1 := min(y0+boundBlock, overlap.Max.Y)
+		for x0 := overlap.Min.X; x0 < overlap.Max.X; x0 += boundBlock {
+			x1 := min(x0+boundBlock, overlap.Max.X)
+			sa := e.a.rect(x0, y0, x1, y1)
+			sb := e.b.rect(x0+dx, y0+dy, x1+dx, y1+dy)
+			if sa > sb {
+				bound += uint64(sa - sb)
+			} else {
+				bound += uint64(sb - sa)
+			}
+		}
+		if bound > stop {
+			return bound
+		}
+	}
+	return bound
+}
+
+// lowest returns the index of the first candidate of list with the lowest
+// bound: the likely winner, whose MAE lowers the limit for the rest.
+func (e *errorBound) lowest(list candidateList) int {
+	best, bestMAE := 0, math.MaxFloat64
+	for i := 0; i < list.n; i++ {
+		c := list.at(i)
+		if mae := e.mae(c.dx, c.dy); mae < bestMAE {
+			best, bestMAE = i, mae
+		}
+	}
+	return best
+}
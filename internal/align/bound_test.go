@@ -0,0 +1,106 @@
+package align
+
+import (
+	"image"
+	"math"
+	"math/rand/v2"
+	"testing"
+
+	"github.com/xshoji/go-img-diff/internal/core"
+)
+
+// naiveMAE is the reference scorer: the grayscale MAE over the scored overlap,
+// pixel by pixel, skipping pixels ignored in b.
+func naiveMAE(a, b *core.Frame, dx, dy int) float64 {
+	overlap, ok := scoredOverlap(image.Pt(a.W, a.H), image.Pt(b.W, b.H), dx, dy)
+	if !ok {
+		return math.MaxFloat64
+	}
+	var sum, n int
+	for y := overlap.Min.Y; y < overlap.Max.Y; y++ {
+		for x := overlap.Min.X; x < overlap.Max.X; x++ {
+			if b.Ignored(x+dx, y+dy) {
+				continue
+			}
+			d := int(a.Gray[y*a.W+x]) - int(b.Gray[(y+dy)*b.W+x+dx])
+			sum += abs(d)
+			n++
+		}
+	}
+	if n == 0 {
+		return math.MaxFloat64
+	}
+	return float64(sum) / float64(n)
+}
+
+func TestCalcMAE_MatchesNaive(t *testing.T) {
+	a := makeRandomBlockFrame(rand.New(rand.NewPCG(3, 3)), 90, 70, 0, 0)
+	b := makeRandomBlockFrame(rand.New(rand.NewPCG(3, 3)), 96, 64, 4, -3)
+	ignored := makeRandomBlockFrame(rand.New(rand.NewPCG(3, 3)), 96, 64, 4, -3)
+	ignored.Ignore = core.NewMask(96, 64)
+	ignored.Ignore.SetRect(image.Rect(10, 5, 40, 30))
+
+	for name, fb := range map[string]*core.Frame{"plain": b, "ignore mask": ignored} {
+		for dy := -12; dy <= 12; dy++ {
+			for dx := -12; dx <= 12; dx++ {
+				want := naiveMAE(a, fb, dx, dy)
+				if got, _ := calcMAE(a, fb, dx, dy, math.MaxFloat64); got != want {
+					t.Fatalf("%s: calcMAE(%d,%d) = %v, want %v", name, dx, dy, got, want)
+				}
+				// Abandoning at exactly the MAE never drops the candidate.
+				if want < math.MaxFloat64 {
+					if got, _ := calcMAE(a, fb, dx, dy, want); got != want {
+						t.Fatalf("%s: calcMAE(%d,%d) with limit %v = %v", name, dx, dy, want, got)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestErrorBound_BelowMAE(t *testing.T) {
+	a := makeRandomBlockFrame(rand.New(rand.NewPCG(4, 4)), 100, 80, 0, 0)
+	b := makeRandomBlockFrame(rand.New(rand.NewPCG(4, 4)), 100, 80, 5, 2)
+	bound := newErrorBound(a, b)
+	for dy := -15; dy <= 15; dy++ {
+		for dx := -15; dx <= 15; dx++ {
+			mae := naiveMAE(a, b, dx, dy)
+			if lower := bound.mae(dx, dy); lower > mae {
+				t.Fatalf("bound(%d,%d) = %v above MAE %v", dx, dy, lower, mae)
+			}
+			if mae < math.MaxFloat64 && bound.exceeds(dx, dy, mae) {
+				t.Fatalf("bound(%d,%d) exceeds its own MAE %v", dx, dy, mae)
+			}
+		}
+	}
+	if bound.mae(5, 2) != 0 || bound.exceeds(5, 2, 0) {
+		t.Error("bound of the true offset is not 0")
+	}
+
+	b.Ignore = core.NewMask(b.W, b.H)
+	if newErrorBound(a, b) != nil {
+		t.Error("newErrorBound returned a bound for a frame with an ignore mask")
+	}
+}
+
+// TestAlign_BoundMatchesFullScoring expects the exhaustive search with the
+// error bound and early abandon to find the same offset and score as full
+// scoring of every candidate.
+func TestAlign_BoundMatchesFullScoring(t *testing.T) {
+	pairs := []struct{ a, b *core.Frame }{
+		{makeRandomBlockFrame(rand.New(rand.NewPCG(6, 6)), 160, 120, 0, 0), makeRandomBlockFrame(rand.New(rand.NewPCG(6, 6)), 160, 120, -7, 5)},
+		{makeTexturedFrame(160, 120, 0, 0), makeTexturedFrame(160, 120, 3, 3)},
+		{makeCheckerboard(64, 64, 0), makeCheckerboard(64, 64, 1)},
+	}
+	for i, p := range pairs {
+		opts := core.AlignOptions{MaxOffsetX: 10, MaxOffsetY: 10, Exhaustive: true}
+		full, _ := alignFrames(p.a, p.b, opts, 4, nil, testLogger())
+		opts.EarlyAbandon = true
+		bounded, stats := alignFrames(p.a, p.b, opts, 4, nil, testLogger())
+		if bounded.DX != full.DX || bounded.DY != full.DY || bounded.Score != full.Score {
+			t.Errorf("pair %d: bounded (%d,%d) score %v, full (%d,%d) score %v",
+				i, bounded.DX, bounded.DY, bounded.Score, full.DX, full.DY, full.Score)
+		}
+		t.Logf("pair %d: %d of %d offsets rejected by the bound", i, stats.BoundRejected, stats.Candidates)
+	}
+}
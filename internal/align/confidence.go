@@ -0,0 +1,59 @@
+package align
+
+import (
+	"math"
+	"sync"
+
+	"github.com/xshoji/go-img-diff/internal/core"
+)
+
+// runnerUpRing is the distance from the chosen offset at which runner-up
+// candidates are scored: the nearest offsets that are not adjacent to it.
+const runnerUpRing = 2
+
+// runnerUp fully scores the offsets at distance runnerUpRing from the chosen
+// offset, within the search limits, and returns the best of them with the
+// resulting confidence. On a flat score landscape the runner-up scores as well
+// as the chosen offset. It returns a zero confidence if no candidate overlaps
+// enough to be scored.
+func runnerUp(a, b *core.Frame, chosen core.Alignment, opts core.AlignOptions, workers int) (core.OffsetScore, float64) {
+	var candidates []candidate
+	for _, c := range ringCandidates(chosen.DX, chosen.DY, runnerUpRing) {
+		if abs(c.dx) <= max(opts.MaxOffsetX, abs(chosen.DX)) && abs(c.dy) <= max(opts.MaxOffsetY, abs(chosen.DY)) {
+			candidates = append(candidates, c)
+		}
+	}
+
+	maes := make([]float64, len(candidates))
+	next := make(chan int, len(candidates))
+	for i := range candidates {
+		next <- i
+	}
+	close(next)
+	var wg sync.WaitGroup
+	for i := 0; i < min(workers, len(candidates)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range next {
+				maes[j], _ = calcError(a, b, candidates[j].dx, candidates[j].dy, math.MaxFloat64, opts.Metric)
+			}
+		}()
+	}
+	wg.Wait()
+
+	best := -1
+	for i, mae := range maes {
+		if mae == math.MaxFloat64 {
+			continue
+		}
+		if best < 0 || mae < maes[best] || (mae == maes[best] && preferOffset(candidates[i].dx, candidates[i].dy, candidates[best].dx, candidates[best].dy)) {
+			best = i
+		}
+	}
+	if best < 0 {
+		return core.OffsetScore{}, 0
+	}
+	score := 1.0 - maes[best]/maxError
+	return core.OffsetScore{DX: candidates[best].dx, DY: candidates[best].dy, Score: score}, core.AlignmentConfidence(chosen.Score, score)
+}
@@ -0,0 +1,59 @@
+package align
+
+import (
+	"image"
+	"math/rand/v2"
+	"testing"
+
+	"github.com/xshoji/go-img-diff/internal/core"
+)
+
+func TestAlign_ConfidenceUniformIsAmbiguous(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 120, 90))
+	for i := range img.Pix {
+		img.Pix[i] = 255
+	}
+	f := core.NewFrame(img)
+	opts := core.AlignOptions{MaxOffsetX: 10, MaxOffsetY: 10, MinPyramidSize: 16, RefinementRadius: 2, EarlyAbandon: true, MinConfidence: 1.2}
+	al := Align(f, f, opts, 4, testLogger())
+
+	if al.Confidence < 1 || al.Confidence > 1.01 {
+		t.Errorf("expected confidence ~1.0 on a uniform image, got %v (runner-up %+v)", al.Confidence, al.RunnerUp)
+	}
+	if al.RunnerUp.Score != al.Score {
+		t.Errorf("runner-up score %v, want %v", al.RunnerUp.Score, al.Score)
+	}
+	if !opts.Ambiguous(al) {
+		t.Error("expected the alignment to be ambiguous")
+	}
+}
+
+func TestAlign_ConfidenceHighContrast(t *testing.T) {
+	a := makeRandomBlockFrame(rand.New(rand.NewPCG(4, 4)), 120, 90, 0, 0)
+	b := makeRandomBlockFrame(rand.New(rand.NewPCG(4, 4)), 120, 90, 3, -2)
+	opts := core.AlignOptions{MaxOffsetX: 10, MaxOffsetY: 10, MinPyramidSize: 16, RefinementRadius: 2, EarlyAbandon: true, MinConfidence: 1.2}
+	al := Align(a, b, opts, 4, testLogger())
+
+	if al.DX != 3 || al.DY != -2 {
+		t.Fatalf("expected (3,-2), got (%d,%d)", al.DX, al.DY)
+	}
+	if d := max(abs(al.RunnerUp.DX-al.DX), abs(al.RunnerUp.DY-al.DY)); d != runnerUpRing {
+		t.Errorf("runner-up %+v is %d px from the chosen offset, want %d", al.RunnerUp, d, runnerUpRing)
+	}
+	if al.Confidence < 10 {
+		t.Errorf("expected high confidence, got %v (runner-up %+v)", al.Confidence, al.RunnerUp)
+	}
+	if opts.Ambiguous(al) {
+		t.Error("expected the alignment not to be ambiguous")
+	}
+}
+
+func TestAlign_RunnerUpRespectsAxisLimits(t *testing.T) {
+	a := makeRandomBlockFrame(rand.New(rand.NewPCG(4, 4)), 120, 90, 0, 0)
+	b := makeRandomBlockFrame(rand.New(rand.NewPCG(4, 4)), 120, 90, 0, 5)
+	opts := core.AlignOptions{MaxOffsetX: 0, MaxOffsetY: 10, MinPyramidSize: 16, RefinementRadius: 2}
+	al := Align(a, b, opts, 4, testLogger())
+	if al.RunnerUp.DX != 0 || abs(al.RunnerUp.DY-al.DY) != runnerUpRing {
+		t.Errorf("runner-up %+v outside the vertical-only search around %+v", al.RunnerUp, al)
+	}
+}
@@ -0,0 +1,63 @@
+package align
+
+import (
+	"image"
+
+	"github.com/xshoji/go-img-diff/internal/core"
+)
+
+// SearchCost is the work predicted for an offset search.
+type SearchCost struct {
+	Levels  int   // pyramid levels searched
+	Offsets int   // candidate offsets scored over all levels (an upper bound for the spiral strategy)
+	Pixels  int64 // pixel comparisons if no candidate is rejected or abandoned early
+}
+
+// EstimateCost predicts the search work for frames of sizes a and b without
+// loading them. Pixels assumes the predicted offset is (0,0) at every level,
+// so it is exact for an unshifted pair with EarlyReject and EarlyAbandon off;
+// with them (the default) the actual work is usually far smaller.
+func EstimateCost(a, b image.Point, opts core.AlignOptions) SearchCost {
+	if opts.ForcedOffset != nil {
+		cost := SearchCost{Offsets: 1}
+		if overlap, ok := scoredOverlap(a, b, opts.ForcedOffset.X, opts.ForcedOffset.Y); ok {
+			cost.Pixels = int64(overlap.Dx() * overlap.Dy())
+		}
+		return cost
+	}
+	sizesA, sizesB := []image.Point{a}, []image.Point{b}
+	if !opts.Exhaustive {
+		sizesA = pyramidSizes(a, opts.MinPyramidSize)
+		sizesB = pyramidSizes(b, opts.MinPyramidSize)
+		// Only the levels both frames have are searched (see alignFrames).
+		levels := min(len(sizesA), len(sizesB))
+		sizesA, sizesB = sizesA[:levels], sizesB[:levels]
+	}
+	cost := SearchCost{Levels: len(sizesA)}
+	for level := len(sizesA) - 1; level >= 0; level-- {
+		la, lb := sizesA[level], sizesB[level]
+		rx, ry := levelSearchRadius(level, len(sizesA), opts)
+		for dy := -ry; dy <= ry; dy++ {
+			for dx := -rx; dx <= rx; dx++ {
+				cost.Offsets++
+				if overlap, ok := scoredOverlap(la, lb, dx, dy); ok {
+					cost.Pixels += int64(overlap.Dx() * overlap.Dy())
+				}
+			}
+		}
+	}
+	return cost
+}
+
+// pyramidSizes returns the frame size at each level built by buildPyramid.
+func pyramidSizes(size image.Point, minSize int) []image.Point {
+	if minSize <= 0 {
+		minSize = 32
+	}
+	sizes := []image.Point{size}
+	for size.X > minSize && size.Y > minSize && size.X/2 > 0 && size.Y/2 > 0 {
+		size = image.Pt(size.X/2, size.Y/2)
+		sizes = append(sizes, size)
+	}
+	return sizes
+}
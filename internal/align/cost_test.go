@@ -0,0 +1,52 @@
+package align
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/xshoji/go-img-diff/internal/core"
+)
+
+func TestPyramidSizes_MatchesBuildPyramid(t *testing.T) {
+	for _, size := range []image.Point{{100, 100}, {123, 77}, {20, 500}, {1, 1}} {
+		for _, minSize := range []int{8, 16, 32} {
+			frame := makeFrame(size.X, size.Y, color.NRGBA{128, 128, 128, 255})
+			pyramid := buildPyramid(frame, minSize)
+			sizes := pyramidSizes(size, minSize)
+			if len(sizes) != len(pyramid) {
+				t.Fatalf("%v/%d: %d sizes, pyramid has %d levels", size, minSize, len(sizes), len(pyramid))
+			}
+			for i, f := range pyramid {
+				if sizes[i] != image.Pt(f.W, f.H) {
+					t.Errorf("%v/%d level %d: size %v, pyramid %dx%d", size, minSize, i, sizes[i], f.W, f.H)
+				}
+			}
+		}
+	}
+}
+
+// TestEstimateCost_MatchesSearchCounters checks the cost model against the
+// counters of a real search on an unshifted pair without early termination.
+func TestEstimateCost_MatchesSearchCounters(t *testing.T) {
+	a := makeTexturedFrame(150, 110, 0, 0)
+	// Frames of different sizes are searched on the levels both have.
+	for _, b := range []*core.Frame{makeTexturedFrame(150, 110, 0, 0), makeTexturedFrame(75, 55, 0, 0), makeTexturedFrame(1, 1, 0, 0)} {
+		for _, opts := range []core.AlignOptions{
+			{MaxOffsetX: 10, MaxOffsetY: 10, MinPyramidSize: 16, RefinementRadius: 2},
+			{MaxOffsetX: 6, MaxOffsetY: 6, MinPyramidSize: 200, RefinementRadius: 2},
+			{MaxOffsetX: 30, MaxOffsetY: 30, MinPyramidSize: 32, RefinementRadius: 3},
+			{MaxOffsetX: 8, MaxOffsetY: 8, MinPyramidSize: 16, RefinementRadius: 2, Exhaustive: true},
+		} {
+			_, stats := alignFrames(a, b, opts, 2, nil, testLogger())
+			cost := EstimateCost(image.Pt(a.W, a.H), image.Pt(b.W, b.H), opts)
+			if cost.Offsets != stats.Candidates || cost.Pixels != stats.ScoredPixels {
+				t.Errorf("%dx%d, %+v: estimated %d offsets / %d pixels, search counted %d / %d",
+					b.W, b.H, opts, cost.Offsets, cost.Pixels, stats.Candidates, stats.ScoredPixels)
+			}
+			if cost.Offsets != countCandidates(cost.Levels, opts) {
+				t.Errorf("%dx%d, %+v: offsets %d disagree with countCandidates", b.W, b.H, opts, cost.Offsets)
+			}
+		}
+	}
+}
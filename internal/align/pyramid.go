@@ -1,28 +1,66 @@
 package align
 
 import (
+	"image"
 	"log/slog"
 	"math"
 	"runtime"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/xshoji/go-img-diff/internal/core"
+	"github.com/xshoji/go-img-diff/internal/progress"
 )
 
 // Align finds the best translation offset between two frames using pyramid coarse-to-fine search.
 func Align(a, b *core.Frame, opts core.AlignOptions, workers int, logger *slog.Logger) core.Alignment {
+	al, _ := alignFrames(a, b, opts, workers, nil, logger)
+	return al
+}
+
+// AlignWithProgress is Align reporting the "align" stage to reporter, based
+// on the number of scored candidate offsets.
+func AlignWithProgress(a, b *core.Frame, opts core.AlignOptions, workers int, reporter progress.Reporter, logger *slog.Logger) core.Alignment {
+	al, _ := alignFrames(a, b, opts, workers, progress.Start(reporter, "align"), logger)
+	return al
+}
+
+// alignStats counts the work done by a search, for logging and benchmarks.
+type alignStats struct {
+	Candidates    int
+	EarlyRejected int
+	BoundRejected int
+	ScoredPixels  int64
+	ProbedPixels  int64
+}
+
+func alignFrames(a, b *core.Frame, opts core.AlignOptions, workers int, tracker *progress.Tracker, logger *slog.Logger) (core.Alignment, alignStats) {
+	if opts.ForcedOffset != nil {
+		return forcedAlignment(a, b, *opts.ForcedOffset, opts.Metric, tracker, logger)
+	}
 	if workers <= 0 {
 		workers = runtime.NumCPU()
 	}
 
-	// Build pyramids
-	pyramidA := buildPyramid(a, opts.MinPyramidSize)
-	pyramidB := buildPyramid(b, opts.MinPyramidSize)
+	// Build pyramids (a single full-resolution level for an exhaustive search)
+	pyramidA, pyramidB := []*core.Frame{a}, []*core.Frame{b}
+	if !opts.Exhaustive {
+		pyramidA = buildPyramid(a, opts.MinPyramidSize)
+		pyramidB = buildPyramid(b, opts.MinPyramidSize)
+		// Frames of different sizes may reach the minimum size at different
+		// levels; search only the levels both have.
+		levels := min(len(pyramidA), len(pyramidB))
+		pyramidA, pyramidB = pyramidA[:levels], pyramidB[:levels]
+	}
 
 	logger.Info("pyramid built", "levels", len(pyramidA))
 
 	bestDX, bestDY := 0, 0
 	bestScore := 0.0
+	var stats alignStats
+	totalCandidates := countCandidates(len(pyramidA), opts)
+	doneCandidates := 0
 
 	for level := len(pyramidA) - 1; level >= 0; level-- {
 		fA := pyramidA[level]
@@ -34,94 +72,447 @@ func Align(a, b *core.Frame, opts core.AlignOptions, workers int, logger *slog.L
 			bestDY *= 2
 		}
 
-		// Determine search range
-		var searchRadius int
-		if level == len(pyramidA)-1 {
-			// Coarsest level: full range scaled down
-			scale := 1 << uint(level)
-			searchRadius = opts.MaxOffset / scale
-			if searchRadius < 1 {
-				searchRadius = 1
+		radiusX, radiusY := levelSearchRadius(level, len(pyramidA), opts)
+
+		// The best MAE found so far is shared with the workers for early
+		// abandon. It only ever decreases and is lowered by each worker as
+		// soon as it scores a candidate. Early rejection is a heuristic, so it
+		// compares against the MAE of the predicted offset instead, fixed for
+		// the level: which candidates it rejects, and thus the chosen offset,
+		// does not depend on scheduling or the number of workers.
+		search := &levelSearch{fA: fA, fB: fB, opts: opts, workers: workers, tracker: tracker, total: totalCandidates, done: doneCandidates}
+		if opts.EarlyAbandon && opts.Metric != core.AlignMetricSSIM {
+			search.bound = newErrorBound(fA, fB)
+		}
+		search.bestDX, search.bestDY = bestDX, bestDY
+		search.bestMAE = scoreCandidate(fA, fB, bestDX, bestDY, math.MaxFloat64, math.MaxFloat64, opts, nil, &search.counters)
+		search.rejectMAE = search.bestMAE
+		search.best.Store(search.bestMAE)
+		search.evaluated = 1
+		search.done++
+		tracker.Update(search.done, totalCandidates)
+
+		if opts.SearchStrategy == core.SearchSpiral {
+			// Expand rings around the predicted offset until a ring no longer
+			// improves the best score by more than SpiralEpsilon. Rings are
+			// clipped to the window on axes with a smaller radius. SpiralEpsilon
+			// is a score gain, scaled to the error range of the metric.
+			minGain := opts.SpiralEpsilon * maxError
+			for ring := 1; ring <= max(radiusX, radiusY); ring++ {
+				before := search.bestMAE
+				var candidates []candidate
+				for _, c := range ringCandidates(bestDX, bestDY, ring) {
+					if abs(c.dx-bestDX) <= radiusX && abs(c.dy-bestDY) <= radiusY {
+						candidates = append(candidates, c)
+					}
+				}
+				search.run(sliceCandidates(candidates))
+				if before < math.MaxFloat64 && before-search.bestMAE <= minGain {
+					break
+				}
 			}
 		} else {
-			searchRadius = opts.RefinementRadius
+			// Every offset in the window around the predicted offset (excluding itself)
+			search.run(windowCandidates(bestDX, bestDY, radiusX, radiusY))
 		}
+		bestDX, bestDY = search.bestDX, search.bestDY
+		bestMAE := search.bestMAE
+		doneCandidates = search.done
+		levelStats := &search.counters
 
-		// Generate candidates
-		type candidate struct{ dx, dy int }
-		var candidates []candidate
-		for dy := bestDY - searchRadius; dy <= bestDY+searchRadius; dy++ {
-			for dx := bestDX - searchRadius; dx <= bestDX+searchRadius; dx++ {
-				candidates = append(candidates, candidate{dx, dy})
-			}
+		// Convert MAE to a 0..1 score (1.0 = perfect match, 0.0 = max error)
+		if bestMAE < math.MaxFloat64 {
+			bestScore = 1.0 - bestMAE/maxError
 		}
 
-		// Evaluate candidates in parallel
-		type result struct {
-			dx, dy int
-			mae    float64
-		}
+		stats.Candidates += search.evaluated
+		stats.EarlyRejected += int(levelStats.rejected.Load())
+		stats.BoundRejected += int(levelStats.bounded.Load())
+		stats.ScoredPixels += levelStats.scored.Load()
+		stats.ProbedPixels += levelStats.probed.Load()
 
-		resultCh := make(chan result, len(candidates))
-		candidateCh := make(chan candidate, len(candidates))
+		logger.Debug("alignment level complete",
+			"level", level,
+			"size", [2]int{fA.W, fA.H},
+			"searchRadius", [2]int{radiusX, radiusY},
+			"candidates", search.evaluated,
+			"earlyRejected", levelStats.rejected.Load(),
+			"boundRejected", levelStats.bounded.Load(),
+			"bestDX", bestDX,
+			"bestDY", bestDY,
+			"bestMAE", bestMAE,
+		)
+	}
 
-		numWorkers := workers
-		if numWorkers > len(candidates) {
-			numWorkers = len(candidates)
-		}
+	al := core.Alignment{DX: bestDX, DY: bestDY, Score: bestScore}
+	al.RunnerUp, al.Confidence = runnerUp(a, b, al, opts, workers)
+	if opts.Metric == core.AlignMetricSSIM {
+		al.SSIM, _ = SSIM(a, b, bestDX, bestDY)
+	}
 
-		// We need to know the current best MAE for early abandon.
-		// Initialize with max value; it will be updated as results come in.
-		var bestMAE float64 = math.MaxFloat64
-
-		var wg sync.WaitGroup
-		for i := 0; i < numWorkers; i++ {
-			wg.Add(1)
-			go func() {
-				defer wg.Done()
-				for c := range candidateCh {
-					mae := calcMAE(fA, fB, c.dx, c.dy, bestMAE)
-					resultCh <- result{c.dx, c.dy, mae}
-				}
-			}()
+	tracker.Done()
+	logger.Info("alignment complete", "dx", bestDX, "dy", bestDY, "score", bestScore,
+		"runnerUp", [2]int{al.RunnerUp.DX, al.RunnerUp.DY}, "confidence", al.Confidence)
+	return al, stats
+}
+
+// forcedAlignment scores the given offset without searching.
+func forcedAlignment(a, b *core.Frame, offset image.Point, metric core.AlignMetric, tracker *progress.Tracker, logger *slog.Logger) (core.Alignment, alignStats) {
+	mae, visited := calcError(a, b, offset.X, offset.Y, math.MaxFloat64, metric)
+	al := core.Alignment{DX: offset.X, DY: offset.Y}
+	if mae < math.MaxFloat64 {
+		al.Score = 1.0 - mae/maxError
+	}
+	if metric == core.AlignMetricSSIM {
+		al.SSIM, _ = SSIM(a, b, offset.X, offset.Y)
+	}
+	tracker.Done()
+	logger.Info("alignment search skipped; using forced offset", "dx", offset.X, "dy", offset.Y, "score", al.Score)
+	return al, alignStats{Candidates: 1, ScoredPixels: int64(visited)}
+}
+
+type candidate struct{ dx, dy int }
+
+// candidateList yields the candidates of one search step by index, so that
+// large windows are generated on the fly instead of being stored.
+type candidateList struct {
+	n  int
+	at func(i int) candidate
+}
+
+// windowCandidates lists every offset within (rx, ry) of (cx, cy) except
+// (cx, cy) itself, row by row.
+func windowCandidates(cx, cy, rx, ry int) candidateList {
+	w := 2*rx + 1
+	center := ry*w + rx
+	return candidateList{n: w*(2*ry+1) - 1, at: func(i int) candidate {
+		if i >= center {
+			i++
 		}
+		return candidate{cx - rx + i%w, cy - ry + i/w}
+	}}
+}
 
-		for _, c := range candidates {
-			candidateCh <- c
+// sliceCandidates lists candidates in their order.
+func sliceCandidates(candidates []candidate) candidateList {
+	return candidateList{n: len(candidates), at: func(i int) candidate { return candidates[i] }}
+}
+
+// ringCandidates returns the offsets at Chebyshev distance ring from (cx, cy),
+// row by row.
+func ringCandidates(cx, cy, ring int) []candidate {
+	var candidates []candidate
+	for dy := cy - ring; dy <= cy+ring; dy++ {
+		for dx := cx - ring; dx <= cx+ring; dx++ {
+			if max(abs(dx-cx), abs(dy-cy)) == ring {
+				candidates = append(candidates, candidate{dx, dy})
+			}
 		}
-		close(candidateCh)
+	}
+	return candidates
+}
 
+// levelSearch holds the state of the offset search at one pyramid level.
+type levelSearch struct {
+	fA, fB  *core.Frame
+	opts    core.AlignOptions
+	workers int
+	bound   *errorBound // nil unless EarlyAbandon applies
+
+	bestDX, bestDY int
+	bestMAE        float64
+	rejectMAE      float64 // reference of early rejection, fixed per level
+	best           sharedMAE
+	counters       levelCounters
+	evaluated      int
+
+	tracker     *progress.Tracker
+	done, total int
+}
+
+// progressPoll is how often a running search step reports its progress.
+const progressPoll = 50 * time.Millisecond
+
+// run scores the candidates of list in parallel and folds them into the
+// current best. Workers take the next index from a shared counter and keep
+// their own best, which are merged at the end; ties are broken by
+// preferOffset, so the winner does not depend on scheduling. With a bound,
+// the candidate with the lowest bound is scored first, so that its MAE
+// lets the bound reject most of the others.
+func (s *levelSearch) run(list candidateList) {
+	if list.n == 0 {
+		return
+	}
+	var scored atomic.Int64
+	seed := -1
+	if s.bound != nil {
+		seed = s.bound.lowest(list)
+		c := list.at(seed)
+		mae := scoreCandidate(s.fA, s.fB, c.dx, c.dy, s.rejectMAE, s.best.Load(), s.opts, s.bound, &s.counters)
+		s.best.Lower(mae)
+		s.fold(c, mae)
+		scored.Add(1)
+	}
+
+	type result struct {
+		c   candidate
+		mae float64
+	}
+	var next atomic.Int64
+	bests := make([]result, min(s.workers, list.n))
+	var wg sync.WaitGroup
+	for w := range bests {
+		wg.Add(1)
 		go func() {
-			wg.Wait()
-			close(resultCh)
+			defer wg.Done()
+			best := result{mae: math.MaxFloat64}
+			for i := int(next.Add(1) - 1); i < list.n; i = int(next.Add(1) - 1) {
+				if i == seed {
+					continue
+				}
+				c := list.at(i)
+				mae := scoreCandidate(s.fA, s.fB, c.dx, c.dy, s.rejectMAE, s.best.Load(), s.opts, s.bound, &s.counters)
+				s.best.Lower(mae)
+				if improves(c, mae, best.c, best.mae) {
+					best = result{c, mae}
+				}
+				scored.Add(1)
+			}
+			bests[w] = best
 		}()
+	}
+	s.wait(&wg, &scored)
 
-		for r := range resultCh {
-			if r.mae < bestMAE {
-				bestMAE = r.mae
-				bestDX = r.dx
-				bestDY = r.dy
-			}
+	for _, r := range bests {
+		s.fold(r.c, r.mae)
+	}
+	s.done += list.n
+	s.tracker.Update(s.done, s.total)
+	s.evaluated += list.n
+}
+
+// wait waits for wg, reporting the scored candidates every progressPoll from
+// this goroutine, as progress reporters require.
+func (s *levelSearch) wait(wg *sync.WaitGroup, scored *atomic.Int64) {
+	if s.tracker == nil {
+		wg.Wait()
+		return
+	}
+	finished := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(finished)
+	}()
+	ticker := time.NewTicker(progressPoll)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-finished:
+			return
+		case <-ticker.C:
+			s.tracker.Update(s.done+int(scored.Load()), s.total)
 		}
+	}
+}
 
-		// Convert MAE to a 0..1 score (1.0 = perfect match, 0.0 = max error)
-		if bestMAE < math.MaxFloat64 {
-			bestScore = 1.0 - bestMAE/255.0
+// fold makes candidate c with the given MAE the best if it improves on it.
+func (s *levelSearch) fold(c candidate, mae float64) {
+	if improves(c, mae, candidate{s.bestDX, s.bestDY}, s.bestMAE) {
+		s.bestMAE = mae
+		s.bestDX, s.bestDY = c.dx, c.dy
+	}
+}
+
+// improves reports whether candidate c with MAE mae beats best with bestMAE:
+// a lower MAE wins, and a tie of scored candidates is broken by preferOffset.
+func improves(c candidate, mae float64, best candidate, bestMAE float64) bool {
+	return mae < bestMAE || (mae == bestMAE && mae < math.MaxFloat64 && preferOffset(c.dx, c.dy, best.dx, best.dy))
+}
+
+// preferOffset reports whether offset (dx, dy) wins a tie against (bestDX,
+// bestDY): the smaller |dx|+|dy| wins, then the smaller dy, then the smaller dx.
+func preferOffset(dx, dy, bestDX, bestDY int) bool {
+	if d, bestD := abs(dx)+abs(dy), abs(bestDX)+abs(bestDY); d != bestD {
+		return d < bestD
+	}
+	if dy != bestDY {
+		return dy < bestDY
+	}
+	return dx < bestDX
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// levelSearchRadius returns the horizontal and vertical candidate search
+// radius at a pyramid level. An axis with a zero maximum offset is never searched.
+func levelSearchRadius(level, levels int, opts core.AlignOptions) (int, int) {
+	return axisSearchRadius(level, levels, opts.MaxOffsetX, opts.RefinementRadius),
+		axisSearchRadius(level, levels, opts.MaxOffsetY, opts.RefinementRadius)
+}
+
+func axisSearchRadius(level, levels, maxOffset, refinementRadius int) int {
+	if maxOffset <= 0 {
+		return 0
+	}
+	if level == levels-1 {
+		// Coarsest level: full range scaled down
+		scale := 1 << uint(level)
+		return max(1, maxOffset/scale)
+	}
+	return refinementRadius
+}
+
+// countCandidates returns the number of candidate offsets scored over all levels.
+func countCandidates(levels int, opts core.AlignOptions) int {
+	total := 0
+	for level := levels - 1; level >= 0; level-- {
+		rx, ry := levelSearchRadius(level, levels, opts)
+		total += (2*rx + 1) * (2*ry + 1)
+	}
+	return total
+}
+
+// sharedMAE is the best MAE of a level, lowered by the workers as they score
+// candidates so that the others can be abandoned or rejected sooner.
+type sharedMAE struct {
+	bits atomic.Uint64
+}
+
+func (s *sharedMAE) Load() float64 {
+	return math.Float64frombits(s.bits.Load())
+}
+
+func (s *sharedMAE) Store(v float64) {
+	s.bits.Store(math.Float64bits(v))
+}
+
+// Lower sets the value to v if v is smaller.
+func (s *sharedMAE) Lower(v float64) {
+	for {
+		old := s.bits.Load()
+		if v >= math.Float64frombits(old) || s.bits.CompareAndSwap(old, math.Float64bits(v)) {
+			return
 		}
+	}
+}
 
-		logger.Debug("alignment level complete",
-			"level", level,
-			"size", [2]int{fA.W, fA.H},
-			"searchRadius", searchRadius,
-			"candidates", len(candidates),
-			"bestDX", bestDX,
-			"bestDY", bestDY,
-			"bestMAE", bestMAE,
-		)
+type levelCounters struct {
+	rejected atomic.Int64
+	bounded  atomic.Int64
+	scored   atomic.Int64
+	probed   atomic.Int64
+}
+
+const (
+	// probePoints is the number of pixels scored before the full overlap scan.
+	probePoints = 256
+	// A candidate whose probe MAE exceeds probeRejectFactor*rejectMAE + probeRejectMargin
+	// is abandoned without a full scan.
+	probeRejectFactor = 2.0
+	probeRejectMargin = 8.0
+)
+
+// scoreCandidate returns the MAE (or SSIM error, see ssimError) of a
+// candidate offset, or math.MaxFloat64 if it was abandoned. With EarlyReject,
+// a deterministic sparse probe is scored first and candidates whose probe is
+// far worse than rejectMAE are rejected before the full scan. With EarlyAbandon, the full scan stops as
+// soon as the accumulated error exceeds what bestMAE allows, and candidates
+// that bound (if not nil) proves would be abandoned are not scanned at all.
+// Apart from early rejection, any candidate that can become the winner is
+// always fully scored. SSIM candidates are never rejected or abandoned.
+func scoreCandidate(a, b *core.Frame, dx, dy int, rejectMAE, bestMAE float64, opts core.AlignOptions, bound *errorBound, counters *levelCounters) float64 {
+	if opts.Metric == core.AlignMetricSSIM {
+		mae, visited := ssimError(a, b, dx, dy)
+		counters.scored.Add(int64(visited))
+		return mae
+	}
+	if opts.EarlyReject && rejectMAE < math.MaxFloat64 {
+		probe, n := probeMAE(a, b, dx, dy)
+		counters.probed.Add(int64(n))
+		if probe > probeRejectFactor*rejectMAE+probeRejectMargin {
+			counters.rejected.Add(1)
+			return math.MaxFloat64
+		}
+	}
+	limit := bestMAE
+	if !opts.EarlyAbandon {
+		limit = math.MaxFloat64
+	}
+	if bound.exceeds(dx, dy, limit) {
+		counters.bounded.Add(1)
+		return math.MaxFloat64
+	}
+	mae, visited := calcMAE(a, b, dx, dy, limit)
+	counters.scored.Add(int64(visited))
+	return mae
+}
+
+// probeMAE computes the grayscale MAE over a fixed pseudo-random subset of the
+// overlap. The point sequence only depends on the overlap size, so repeated
+// runs probe the same pixels. Points ignored in b are skipped; if all are, the
+// probe reports 0 so the candidate is not rejected.
+func probeMAE(a, b *core.Frame, dx, dy int) (float64, int) {
+	overlapMinX := max(0, -dx)
+	overlapMinY := max(0, -dy)
+	overlapW := min(a.W, b.W-dx) - overlapMinX
+	overlapH := min(a.H, b.H-dy) - overlapMinY
+	if overlapW <= 0 || overlapH <= 0 {
+		return math.MaxFloat64, 0
 	}
 
-	logger.Info("alignment complete", "dx", bestDX, "dy", bestDY, "score", bestScore)
-	return core.Alignment{DX: bestDX, DY: bestDY, Score: bestScore}
+	n := min(probePoints, overlapW*overlapH)
+	state := uint32(2463534242)
+	var sum uint64
+	counted := 0
+	for i := 0; i < n; i++ {
+		// xorshift32
+		state ^= state << 13
+		state ^= state >> 17
+		state ^= state << 5
+		x := overlapMinX + int(state%uint32(overlapW))
+		y := overlapMinY + int((state>>16)%uint32(overlapH))
+		if b.Ignored(x+dx, y+dy) {
+			continue
+		}
+		counted++
+		ga := a.Gray[y*a.W+x]
+		gb := b.Gray[(y+dy)*b.W+x+dx]
+		if ga > gb {
+			sum += uint64(ga - gb)
+		} else {
+			sum += uint64(gb - ga)
+		}
+	}
+	if counted == 0 {
+		return 0, n
+	}
+	return float64(sum) / float64(counted), n
+}
+
+// minCoverage is the smallest overlap, as a fraction of the larger frame, for
+// which an offset is scored at all.
+const minCoverage = 0.3
+
+// scoredOverlap returns the overlap of frames of sizes a and b under offset
+// (dx, dy) in A's coordinates, and false if it is too small to be scored.
+func scoredOverlap(a, b image.Point, dx, dy int) (image.Rectangle, bool) {
+	// image.Rect would swap inverted bounds, turning no overlap into a
+	// rectangle outside the frames.
+	x0, y0, x1, y1 := max(0, -dx), max(0, -dy), min(a.X, b.X-dx), min(a.Y, b.Y-dy)
+	if x1 <= x0 || y1 <= y0 {
+		return image.Rectangle{}, false
+	}
+	overlap := image.Rect(x0, y0, x1, y1)
+	totalArea := max(a.X*a.Y, b.X*b.Y)
+	if float64(overlap.Dx()*overlap.Dy())/float64(totalArea) < minCoverage {
+		return image.Rectangle{}, false
+	}
+	return overlap, true
 }
 
 // buildPyramid creates a multi-scale pyramid. Level 0 is full resolution.
@@ -142,54 +533,48 @@ func buildPyramid(f *core.Frame, minSize int) []*core.Frame {
 	return pyramid
 }
 
-// calcMAE computes mean absolute grayscale error over the overlap region.
+// calcMAE computes mean absolute grayscale error over the overlap region and
+// the number of pixels visited. Pixels ignored in b are not scored.
 // It uses early abandon: if cumulative error already exceeds bestMAE * overlapPixels, it returns math.MaxFloat64.
-func calcMAE(a, b *core.Frame, dx, dy int, bestMAE float64) float64 {
-	// Overlap region in b's coordinate space
-	overlapMinX := max(0, -dx)
-	overlapMinY := max(0, -dy)
-	overlapMaxX := min(a.W, b.W-dx)
-	overlapMaxY := min(a.H, b.H-dy)
-
-	overlapW := overlapMaxX - overlapMinX
-	overlapH := overlapMaxY - overlapMinY
-
-	if overlapW <= 0 || overlapH <= 0 {
-		return math.MaxFloat64
-	}
-
-	totalPixels := overlapW * overlapH
-
-	// Penalize small overlaps
-	totalArea := max(a.W*a.H, b.W*b.H)
-	coverageRatio := float64(totalPixels) / float64(totalArea)
-	if coverageRatio < 0.3 {
-		return math.MaxFloat64
+// The bound is rounded up, so a candidate tying bestMAE is never abandoned;
+// it is checked after each row. With ignored pixels the abandon bound stays
+// valid, just less tight.
+func calcMAE(a, b *core.Frame, dx, dy int, bestMAE float64) (float64, int) {
+	overlap, ok := scoredOverlap(image.Pt(a.W, a.H), image.Pt(b.W, b.H), dx, dy)
+	if !ok {
+		return math.MaxFloat64, 0
 	}
+	totalPixels := overlap.Dx() * overlap.Dy()
 
 	var cumError uint64
-	earlyAbandonThreshold := uint64(bestMAE * float64(totalPixels))
-
-	for y := overlapMinY; y < overlapMaxY; y++ {
-		for x := overlapMinX; x < overlapMaxX; x++ {
-			ga := a.Gray[y*a.W+x]
-			bx, by := x+dx, y+dy
-			gb := b.Gray[by*b.W+bx]
-
-			var diff uint64
-			if ga > gb {
-				diff = uint64(ga - gb)
+	earlyAbandonThreshold := uint64(math.Ceil(bestMAE * float64(totalPixels)))
+
+	visited, ignored := 0, 0
+	for y := overlap.Min.Y; y < overlap.Max.Y; y++ {
+		rowA := a.Gray[y*a.W+overlap.Min.X : y*a.W+overlap.Max.X]
+		offB := (y+dy)*b.W + overlap.Min.X + dx
+		rowB := b.Gray[offB : offB+len(rowA)]
+		for i, ga := range rowA {
+			if b.Ignore != nil && b.Ignore.Data[offB+i] != 0 {
+				ignored++
+				continue
+			}
+			if gb := rowB[i]; ga > gb {
+				cumError += uint64(ga - gb)
 			} else {
-				diff = uint64(gb - ga)
+				cumError += uint64(gb - ga)
 			}
-			cumError += diff
+		}
+		visited = (y-overlap.Min.Y+1)*len(rowA) - ignored
 
-			// Early abandon
-			if cumError > earlyAbandonThreshold {
-				return math.MaxFloat64
-			}
+		// Early abandon
+		if cumError > earlyAbandonThreshold {
+			return math.MaxFloat64, visited
 		}
 	}
 
-	return float64(cumError) / float64(totalPixels)
+	if ignored == totalPixels {
+		return math.MaxFloat64, visited
+	}
+	return float64(cumError) / float64(totalPixels-ignored), visited
 }
@@ -0,0 +1,42 @@
+//go:build !light_test_only
+
+package align
+
+import (
+	"math/rand/v2"
+	"testing"
+	"time"
+
+	"github.com/xshoji/go-img-diff/internal/core"
+)
+
+// TestAlign_PyramidRecoversLargeOffset compares the pyramid search with the
+// exhaustive full-resolution search on a 1000x1000 pair shifted by 25 px.
+func TestAlign_PyramidRecoversLargeOffset(t *testing.T) {
+	a := makeRandomBlockFrame(rand.New(rand.NewPCG(5, 5)), 1000, 1000, 0, 0)
+	b := makeRandomBlockFrame(rand.New(rand.NewPCG(5, 5)), 1000, 1000, 25, -18)
+	opts := core.AlignOptions{MaxOffsetX: 30, MaxOffsetY: 30, MinPyramidSize: 32, RefinementRadius: 2, EarlyAbandon: true}
+
+	start := time.Now()
+	pyramid, pyramidStats := alignFrames(a, b, opts, 4, nil, testLogger())
+	pyramidTime := time.Since(start)
+
+	opts.Exhaustive = true
+	start = time.Now()
+	exhaustive, exhaustiveStats := alignFrames(a, b, opts, 4, nil, testLogger())
+	exhaustiveTime := time.Since(start)
+
+	for name, al := range map[string]core.Alignment{"pyramid": pyramid, "exhaustive": exhaustive} {
+		if al.DX != 25 || al.DY != -18 {
+			t.Errorf("%s: expected (25,-18), got (%d,%d)", name, al.DX, al.DY)
+		}
+	}
+	// The error bound spares the exhaustive search most pixel scans, so the
+	// work is compared in evaluated offsets.
+	if pyramidStats.Candidates*10 > exhaustiveStats.Candidates {
+		t.Errorf("pyramid evaluated %d offsets, exhaustive %d; expected at least 10x less work",
+			pyramidStats.Candidates, exhaustiveStats.Candidates)
+	}
+	t.Logf("pyramid %v (%d offsets), exhaustive %v (%d offsets)",
+		pyramidTime, pyramidStats.Candidates, exhaustiveTime, exhaustiveStats.Candidates)
+}
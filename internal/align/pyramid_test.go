@@ -4,7 +4,9 @@ import (
 	"image"
 	"image/color"
 	"log/slog"
+	"math/rand/v2"
 	"os"
+	"sync"
 	"testing"
 
 	"github.com/xshoji/go-img-diff/internal/core"
@@ -46,7 +48,7 @@ func makeFrameWithCircle(w, h, cx, cy, radius int) *core.Frame {
 
 func TestAlign_ZeroOffset(t *testing.T) {
 	f := makeFrameWithCircle(100, 100, 50, 50, 15)
-	opts := core.AlignOptions{MaxOffset: 10, MinPyramidSize: 16, RefinementRadius: 2}
+	opts := core.AlignOptions{MaxOffsetX: 10, MaxOffsetY: 10, MinPyramidSize: 16, RefinementRadius: 2}
 	al := Align(f, f, opts, 1, testLogger())
 
 	if al.DX != 0 || al.DY != 0 {
@@ -54,11 +56,22 @@ func TestAlign_ZeroOffset(t *testing.T) {
 	}
 }
 
+func TestAlign_PyramidDepthsDiffer(t *testing.T) {
+	// 128x128 has one pyramid level more than 64x64 at MinPyramidSize 16;
+	// the search must stay within the levels both have.
+	a := makeFrameWithCircle(128, 128, 30, 30, 10)
+	b := makeFrameWithCircle(64, 64, 30, 30, 10)
+	opts := core.AlignOptions{MaxOffsetX: 10, MaxOffsetY: 10, MinPyramidSize: 16, RefinementRadius: 2}
+	if al := Align(a, b, opts, 1, testLogger()); al.DX != 0 || al.DY != 0 {
+		t.Errorf("expected (0,0), got (%d,%d)", al.DX, al.DY)
+	}
+}
+
 func TestAlign_SmallOffset(t *testing.T) {
 	a := makeFrameWithCircle(100, 100, 50, 50, 15)
 	// Create B with circle shifted by (5, 3) — circle at (45,47) in B
 	b := makeFrameWithCircle(100, 100, 50-5, 50-3, 15)
-	opts := core.AlignOptions{MaxOffset: 10, MinPyramidSize: 16, RefinementRadius: 2}
+	opts := core.AlignOptions{MaxOffsetX: 10, MaxOffsetY: 10, MinPyramidSize: 16, RefinementRadius: 2}
 	al := Align(a, b, opts, 1, testLogger())
 
 	// The alignment finds the offset to map B→A, so DX=-5, DY=-3
@@ -71,7 +84,7 @@ func TestAlign_SmallOffset(t *testing.T) {
 func TestAlign_NegativeOffset(t *testing.T) {
 	a := makeFrameWithCircle(100, 100, 50, 50, 15)
 	b := makeFrameWithCircle(100, 100, 50+4, 50+2, 15)
-	opts := core.AlignOptions{MaxOffset: 10, MinPyramidSize: 16, RefinementRadius: 2}
+	opts := core.AlignOptions{MaxOffsetX: 10, MaxOffsetY: 10, MinPyramidSize: 16, RefinementRadius: 2}
 	al := Align(a, b, opts, 1, testLogger())
 
 	// The alignment finds offset to map B→A, so DX=4, DY=2
@@ -84,7 +97,7 @@ func TestAlign_NegativeOffset(t *testing.T) {
 func TestAlign_IdenticalImages(t *testing.T) {
 	// Use a textured image so alignment has features to lock onto
 	a := makeFrameWithCircle(100, 100, 50, 50, 20)
-	opts := core.AlignOptions{MaxOffset: 5, MinPyramidSize: 8, RefinementRadius: 2}
+	opts := core.AlignOptions{MaxOffsetX: 5, MaxOffsetY: 5, MinPyramidSize: 8, RefinementRadius: 2}
 	al := Align(a, a, opts, 2, testLogger())
 
 	if al.DX != 0 || al.DY != 0 {
@@ -92,9 +105,364 @@ func TestAlign_IdenticalImages(t *testing.T) {
 	}
 }
 
-func abs(x int) int {
-	if x < 0 {
-		return -x
+func TestAlign_EarlyRejectMatchesExhaustive(t *testing.T) {
+	cases := []struct {
+		name string
+		a, b *core.Frame
+	}{
+		{"zero", makeFrameWithCircle(100, 100, 50, 50, 15), makeFrameWithCircle(100, 100, 50, 50, 15)},
+		{"small", makeFrameWithCircle(100, 100, 50, 50, 15), makeFrameWithCircle(100, 100, 45, 47, 15)},
+		{"negative", makeFrameWithCircle(100, 100, 50, 50, 15), makeFrameWithCircle(100, 100, 54, 52, 15)},
+		{"textured", makeTexturedFrame(120, 90, 0, 0), makeTexturedFrame(120, 90, 3, -2)},
+	}
+	// Rejection is a heuristic, so pixel counts are not compared per case;
+	// only the chosen offset must be identical and some candidates must be
+	// rejected.
+	rejected := 0
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			opts := core.AlignOptions{MaxOffsetX: 10, MaxOffsetY: 10, MinPyramidSize: 16, RefinementRadius: 2}
+			exhaustive, exhaustiveStats := alignFrames(c.a, c.b, opts, 4, nil, testLogger())
+			opts.EarlyReject = true
+			fast, fastStats := alignFrames(c.a, c.b, opts, 4, nil, testLogger())
+
+			if fast.DX != exhaustive.DX || fast.DY != exhaustive.DY || fast.Score != exhaustive.Score {
+				t.Errorf("early reject chose %+v, exhaustive chose %+v", fast, exhaustive)
+			}
+			if exhaustiveStats.EarlyRejected != 0 {
+				t.Errorf("expected no rejections without EarlyReject, got %d", exhaustiveStats.EarlyRejected)
+			}
+			rejected += fastStats.EarlyRejected
+		})
+	}
+	if rejected == 0 {
+		t.Error("expected early reject to abandon some candidates")
+	}
+}
+
+// TestAlign_EarlyAbandonMatchesFullScoring checks on random block images and
+// shifts that abandoning hopeless offsets never changes the chosen offset.
+func TestAlign_EarlyAbandonMatchesFullScoring(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	var fullPixels, abandonPixels int64
+	for i := 0; i < 8; i++ {
+		dx, dy := rng.IntN(13)-6, rng.IntN(13)-6
+		a := makeRandomBlockFrame(rand.New(rand.NewPCG(uint64(i), 7)), 120, 90, 0, 0)
+		b := makeRandomBlockFrame(rand.New(rand.NewPCG(uint64(i), 7)), 120, 90, dx, dy)
+
+		opts := core.AlignOptions{MaxOffsetX: 8, MaxOffsetY: 8, MinPyramidSize: 16, RefinementRadius: 2}
+		full, fullStats := alignFrames(a, b, opts, 4, nil, testLogger())
+		opts.EarlyAbandon = true
+		fast, fastStats := alignFrames(a, b, opts, 4, nil, testLogger())
+
+		if fast != full {
+			t.Errorf("shift (%d,%d): early abandon chose %+v, full scoring chose %+v", dx, dy, fast, full)
+		}
+		fullPixels += fullStats.ScoredPixels
+		abandonPixels += fastStats.ScoredPixels
 	}
-	return x
+	if abandonPixels >= fullPixels {
+		t.Errorf("early abandon scored %d pixels, full scoring %d", abandonPixels, fullPixels)
+	}
+}
+
+// makeRandomBlockFrame draws random gray blocks from rng, shifted by (shiftX, shiftY).
+func makeRandomBlockFrame(rng *rand.Rand, w, h, shiftX, shiftY int) *core.Frame {
+	const block = 6
+	cols, rows := w/block+4, h/block+4
+	values := make([]uint8, cols*rows)
+	for i := range values {
+		values[i] = uint8(rng.IntN(256))
+	}
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			bx := ((x-shiftX)/block + 2 + cols) % cols
+			by := ((y-shiftY)/block + 2 + rows) % rows
+			v := values[by*cols+bx]
+			img.SetNRGBA(x, y, color.NRGBA{v, v, v, 255})
+		}
+	}
+	return core.NewFrame(img)
+}
+
+func TestAlign_SpiralMatchesFull(t *testing.T) {
+	cases := []struct {
+		name string
+		a, b *core.Frame
+	}{
+		{"zero", makeFrameWithCircle(100, 100, 50, 50, 15), makeFrameWithCircle(100, 100, 50, 50, 15)},
+		{"small", makeFrameWithCircle(100, 100, 50, 50, 15), makeFrameWithCircle(100, 100, 45, 47, 15)},
+		{"negative", makeFrameWithCircle(100, 100, 50, 50, 15), makeFrameWithCircle(100, 100, 54, 52, 15)},
+		{"textured", makeTexturedFrame(120, 90, 0, 0), makeTexturedFrame(120, 90, 3, -2)},
+		{"textured-single-level", makeTexturedFrame(120, 90, 0, 0), makeTexturedFrame(120, 90, -2, 1)},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			opts := core.AlignOptions{MaxOffsetX: 10, MaxOffsetY: 10, MinPyramidSize: 16, RefinementRadius: 2, EarlyAbandon: true}
+			if c.name == "textured-single-level" {
+				opts.MinPyramidSize = 200
+			}
+			full, fullStats := alignFrames(c.a, c.b, opts, 4, nil, testLogger())
+			opts.SearchStrategy = core.SearchSpiral
+			spiral, spiralStats := alignFrames(c.a, c.b, opts, 4, nil, testLogger())
+
+			if spiral != full {
+				t.Errorf("spiral chose %+v, full search chose %+v", spiral, full)
+			}
+			if spiralStats.Candidates > fullStats.Candidates {
+				t.Errorf("spiral evaluated %d offsets, full search %d", spiralStats.Candidates, fullStats.Candidates)
+			}
+		})
+	}
+}
+
+func TestRingCandidates(t *testing.T) {
+	for ring, want := range []int{1, 8, 16, 24} {
+		got := ringCandidates(3, -2, ring)
+		if len(got) != want {
+			t.Errorf("ring %d: %d offsets, want %d", ring, len(got), want)
+		}
+		for _, c := range got {
+			if max(abs(c.dx-3), abs(c.dy+2)) != ring {
+				t.Errorf("ring %d: offset %+v at wrong distance", ring, c)
+			}
+		}
+	}
+}
+
+func TestAlign_NoOverlap(t *testing.T) {
+	// Offsets beyond the frames have no overlap and must be skipped, not
+	// scored outside the pixel buffers.
+	small := makeFrameWithCircle(60, 45, 30, 20, 10)
+	pixel := makeFrame(1, 1, color.NRGBA{200, 100, 50, 255})
+	cases := []struct {
+		name string
+		f    *core.Frame
+		opts core.AlignOptions
+	}{
+		{"max offset beyond the frame", small, core.AlignOptions{MaxOffsetX: 100, MaxOffsetY: 100, MinPyramidSize: 16, RefinementRadius: 2, EarlyAbandon: true, EarlyReject: true}},
+		{"exhaustive max offset beyond the frame", small, core.AlignOptions{MaxOffsetX: 100, MaxOffsetY: 100, Exhaustive: true, EarlyAbandon: true}},
+		{"1x1 frames", pixel, core.AlignOptions{MaxOffsetX: 10, MaxOffsetY: 10, MinPyramidSize: 32, RefinementRadius: 2, EarlyAbandon: true, EarlyReject: true}},
+	}
+	for _, c := range cases {
+		for _, metric := range []core.AlignMetric{core.AlignMetricMAE, core.AlignMetricSSIM} {
+			t.Run(c.name+"/"+string(metric), func(t *testing.T) {
+				opts := c.opts
+				opts.Metric = metric
+				if al := Align(c.f, c.f, opts, 4, testLogger()); al.DX != 0 || al.DY != 0 {
+					t.Errorf("got (%d,%d), want (0,0)", al.DX, al.DY)
+				}
+			})
+		}
+	}
+}
+
+func TestAlign_VerticalOnlySearch(t *testing.T) {
+	a := makeRandomBlockFrame(rand.New(rand.NewPCG(3, 3)), 160, 120, 0, 0)
+	b := makeRandomBlockFrame(rand.New(rand.NewPCG(3, 3)), 160, 120, 0, 9)
+	for _, strategy := range []core.SearchStrategy{core.SearchFull, core.SearchSpiral} {
+		t.Run(string(strategy), func(t *testing.T) {
+			opts := core.AlignOptions{MaxOffsetX: 0, MaxOffsetY: 12, MinPyramidSize: 16, RefinementRadius: 2, EarlyAbandon: true, SearchStrategy: strategy}
+			al, stats := alignFrames(a, b, opts, 4, nil, testLogger())
+			if al.DX != 0 || al.DY != 9 {
+				t.Errorf("expected (0,9), got (%d,%d)", al.DX, al.DY)
+			}
+			if limit := countCandidates(len(buildPyramid(a, 16)), opts); stats.Candidates > limit {
+				t.Errorf("scored %d offsets, more than the %d of a vertical-only search", stats.Candidates, limit)
+			}
+		})
+	}
+}
+
+func TestLevelSearchRadius_PerAxis(t *testing.T) {
+	opts := core.AlignOptions{MaxOffsetX: 0, MaxOffsetY: 20, RefinementRadius: 2}
+	for level, want := range [][2]int{{0, 2}, {0, 2}, {0, 5}} {
+		rx, ry := levelSearchRadius(level, 3, opts)
+		if rx != want[0] || ry != want[1] {
+			t.Errorf("level %d: radius (%d,%d), want (%d,%d)", level, rx, ry, want[0], want[1])
+		}
+	}
+}
+
+func TestAlign_ForcedOffsetSkipsSearch(t *testing.T) {
+	a := makeTexturedFrame(120, 90, 0, 0)
+	b := makeTexturedFrame(120, 90, 3, -2)
+	var scores []float64
+	for _, forced := range []image.Point{{3, -2}, {0, 0}} {
+		opts := core.AlignOptions{MaxOffsetX: 10, MaxOffsetY: 10, MinPyramidSize: 16, RefinementRadius: 2, ForcedOffset: &forced}
+		al, stats := alignFrames(a, b, opts, 4, nil, testLogger())
+		if al.DX != forced.X || al.DY != forced.Y {
+			t.Errorf("forced %v: got (%d,%d)", forced, al.DX, al.DY)
+		}
+		if stats.Candidates != 1 {
+			t.Errorf("forced %v: scored %d offsets, want only the forced one", forced, stats.Candidates)
+		}
+		cost := EstimateCost(image.Pt(a.W, a.H), image.Pt(b.W, b.H), opts)
+		if cost.Offsets != 1 || cost.Pixels != stats.ScoredPixels {
+			t.Errorf("forced %v: estimated %+v, scored %d pixels", forced, cost, stats.ScoredPixels)
+		}
+		scores = append(scores, al.Score)
+	}
+	if scores[0] != 1 || scores[1] >= scores[0] {
+		t.Errorf("scores %v: want a perfect score only for the true offset", scores)
+	}
+}
+
+func TestAlign_ForcedOffsetWithoutOverlap(t *testing.T) {
+	a := makeTexturedFrame(120, 90, 0, 0)
+	forced := image.Pt(200, 200)
+	for _, metric := range []core.AlignMetric{core.AlignMetricMAE, core.AlignMetricSSIM} {
+		opts := core.AlignOptions{ForcedOffset: &forced, Metric: metric}
+		al, stats := alignFrames(a, a, opts, 4, nil, testLogger())
+		if al.DX != 200 || al.DY != 200 || al.Score != 0 || al.SSIM != 0 {
+			t.Errorf("%s: got (%d,%d) score %v ssim %v, want (200,200) scored 0", metric, al.DX, al.DY, al.Score, al.SSIM)
+		}
+		if stats.Candidates != 1 || stats.ScoredPixels != 0 {
+			t.Errorf("%s: %d offsets, %d pixels scored, want 1 offset and no pixels", metric, stats.Candidates, stats.ScoredPixels)
+		}
+	}
+}
+
+func TestAlign_MaxAcceptableOffset(t *testing.T) {
+	a := makeTexturedFrame(120, 90, 0, 0)
+	b := makeTexturedFrame(120, 90, 3, -2)
+	opts := core.AlignOptions{MaxOffsetX: 10, MaxOffsetY: 10, MinPyramidSize: 16, RefinementRadius: 2, EarlyReject: true}
+	al := Align(a, b, opts, 4, testLogger())
+	if al.DX != 3 || al.DY != -2 {
+		t.Fatalf("expected (3,-2), got (%d,%d)", al.DX, al.DY)
+	}
+
+	for _, c := range []struct {
+		gate int
+		want bool
+	}{{0, true}, {2, false}, {3, true}, {8, true}} {
+		opts.MaxAcceptableOffset = c.gate
+		if got := opts.AcceptsOffset(al); got != c.want {
+			t.Errorf("gate %d: AcceptsOffset = %v, want %v", c.gate, got, c.want)
+		}
+	}
+}
+
+// makeCheckerboard returns a frame of alternating black and white pixels,
+// starting with white at (0,0) if phase is 0. Every offset with an even
+// |dx|+|dy| matches it perfectly, and so do the odd ones against phase 1.
+func makeCheckerboard(w, h, phase int) *core.Frame {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			v := uint8(0)
+			if (x+y+phase)%2 == 0 {
+				v = 255
+			}
+			img.SetNRGBA(x, y, color.NRGBA{v, v, v, 255})
+		}
+	}
+	return core.NewFrame(img)
+}
+
+func TestAlign_TiesAreDeterministic(t *testing.T) {
+	a := makeCheckerboard(64, 48, 0)
+	cases := []struct {
+		name           string
+		b              *core.Frame
+		exhaustive     bool
+		wantDX, wantDY int
+	}{
+		{"tie at zero", makeCheckerboard(64, 48, 0), true, 0, 0},
+		{"tie at zero, pyramid", makeCheckerboard(64, 48, 0), false, 0, 0},
+		// (0,-1), (-1,0), (1,0) and (0,1) tie: the smaller dy wins.
+		{"tie beside zero", makeCheckerboard(64, 48, 1), true, 0, -1},
+		{"tie beside zero, pyramid", makeCheckerboard(64, 48, 1), false, 0, -1},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			opts := core.AlignOptions{MaxOffsetX: 4, MaxOffsetY: 4, MinPyramidSize: 16, RefinementRadius: 2, EarlyReject: true, EarlyAbandon: true, Exhaustive: c.exhaustive}
+			for run := 0; run < 20; run++ {
+				al := Align(a, c.b, opts, 8, testLogger())
+				if al.DX != c.wantDX || al.DY != c.wantDY {
+					t.Fatalf("run %d: offset (%d,%d), want (%d,%d)", run, al.DX, al.DY, c.wantDX, c.wantDY)
+				}
+			}
+		})
+	}
+}
+
+// TestAlign_WorkerCountsAgree checks that the chosen offset, and which
+// candidates early reject drops, do not depend on the number of workers.
+func TestAlign_WorkerCountsAgree(t *testing.T) {
+	rng := rand.New(rand.NewPCG(3, 4))
+	for n := 0; n < 10; n++ {
+		dx, dy := rng.IntN(13)-6, rng.IntN(13)-6
+		a, b := makeTexturedFrame(160, 120, 0, 0), makeTexturedFrame(160, 120, dx, dy)
+		for _, strategy := range []core.SearchStrategy{core.SearchFull, core.SearchSpiral} {
+			opts := core.AlignOptions{MaxOffsetX: 10, MaxOffsetY: 10, MinPyramidSize: 16, RefinementRadius: 2, EarlyReject: true, EarlyAbandon: true, SearchStrategy: strategy, SpiralEpsilon: 0.001}
+			first, firstStats := alignFrames(a, b, opts, 1, nil, testLogger())
+			for _, workers := range []int{2, 3, 8} {
+				al, stats := alignFrames(a, b, opts, workers, nil, testLogger())
+				if al.DX != first.DX || al.DY != first.DY || al.Score != first.Score {
+					t.Errorf("shift (%d,%d) %s: %d workers chose %+v, 1 worker %+v", dx, dy, strategy, workers, al, first)
+				}
+				if stats.EarlyRejected != firstStats.EarlyRejected {
+					t.Errorf("shift (%d,%d) %s: %d workers rejected %d candidates, 1 worker %d", dx, dy, strategy, workers, stats.EarlyRejected, firstStats.EarlyRejected)
+				}
+			}
+		}
+	}
+}
+
+func TestPreferOffset(t *testing.T) {
+	// In preference order.
+	offsets := [][2]int{{0, 0}, {0, -1}, {-1, 0}, {1, 0}, {0, 1}, {0, -2}, {-1, -1}, {1, -1}}
+	for i, o := range offsets {
+		for j, p := range offsets {
+			if got := preferOffset(o[0], o[1], p[0], p[1]); got != (i < j) {
+				t.Errorf("preferOffset(%v over %v) = %v, want %v", o, p, got, i < j)
+			}
+		}
+	}
+}
+
+// TestAlign_Concurrent runs searches with different options on shared frames
+// at the same time; run with -race to check that no state is shared.
+func TestAlign_Concurrent(t *testing.T) {
+	a := makeTexturedFrame(160, 120, 0, 0)
+	cases := []struct {
+		b              *core.Frame
+		earlyReject    bool
+		wantDX, wantDY int
+	}{
+		{makeTexturedFrame(160, 120, 3, -2), true, 3, -2},
+		{makeTexturedFrame(160, 120, -4, 1), false, -4, 1},
+		{makeTexturedFrame(160, 120, 3, -2), false, 3, -2},
+		{makeTexturedFrame(160, 120, -4, 1), true, -4, 1},
+	}
+
+	var wg sync.WaitGroup
+	for i, c := range cases {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			opts := core.AlignOptions{MaxOffsetX: 10, MaxOffsetY: 10, MinPyramidSize: 16, RefinementRadius: 2, EarlyReject: c.earlyReject}
+			al := Align(a, c.b, opts, 4, testLogger())
+			if al.DX != c.wantDX || al.DY != c.wantDY {
+				t.Errorf("case %d: expected (%d,%d), got (%d,%d)", i, c.wantDX, c.wantDY, al.DX, al.DY)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// makeTexturedFrame draws a deterministic pattern of gray blocks resembling UI
+// content, shifted by (shiftX, shiftY).
+func makeTexturedFrame(w, h, shiftX, shiftY int) *core.Frame {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			sx, sy := x-shiftX, y-shiftY
+			v := uint8(((sx/7)*31 + (sy/5)*17) % 256)
+			img.SetNRGBA(x, y, color.NRGBA{v, v, v, 255})
+		}
+	}
+	return core.NewFrame(img)
 }
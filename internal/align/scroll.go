@@ -0,0 +1,153 @@
+package align
+
+import (
+	"hash/fnv"
+	"log/slog"
+
+	"github.com/xshoji/go-img-diff/internal/core"
+)
+
+// scrollMinSlack is the smallest number of rows by which ScrollAlign lets
+// the row shift stray beyond the global offset and the height difference.
+const scrollMinSlack = 64
+
+// Steps of the row path found by ScrollAlign.
+const (
+	scrollMatch  uint8 = iota + 1 // rows i of A and j of B are equal
+	scrollDelete                  // row i of A has no counterpart
+	scrollInsert                  // row j of B has no counterpart
+)
+
+// ScrollAlign maps the rows of b to the rows of a with the same content, for
+// VerticalAlignOptions.DetectScroll. Rows are compared by a hash of their
+// pixels in the columns both frames cover under the horizontal offset of
+// global, and matched by a longest common subsequence of the hashes. The row
+// shift is searched between the global vertical offset and the height
+// difference, widened by an eighth of the taller frame (at least
+// scrollMinSlack rows).
+//
+// Between two matched rows, the unmatched rows of b are paired top-down with
+// the unmatched rows of a and compared as changed rows; the remaining rows
+// form the returned bands. Inserted rows map to no row of a (-1).
+func ScrollAlign(a, b *core.Frame, global core.Alignment, logger *slog.Logger) (core.RowAlignment, []core.RowBand) {
+	rowAlign := core.NewRowAlignmentFromAlignment(b.W, b.H, global)
+	x0, x1 := max(0, global.DX), min(b.W, a.W+global.DX)
+	if x0 >= x1 || a.H == 0 || b.H == 0 {
+		return rowAlign, nil
+	}
+	hashesA := rowHashes(a, x0-global.DX, x1-global.DX)
+	hashesB := rowHashes(b, x0, x1)
+
+	slack := max(scrollMinSlack, max(a.H, b.H)/8)
+	lo := min(0, b.H-a.H, global.DY) - slack
+	hi := max(0, b.H-a.H, global.DY) + slack
+	path := lcsPath(hashesA, hashesB, lo, hi)
+
+	var bands []core.RowBand
+	matched := 0
+	i, j := 0, 0   // next rows of a and b
+	i0, j0 := 0, 0 // first rows of a and b since the last match
+	flush := func() {
+		paired := min(i-i0, j-j0)
+		for t := 0; t < paired; t++ {
+			rowAlign.SrcYByY[j0+t] = i0 + t
+		}
+		if j-j0 > paired {
+			for y := j0 + paired; y < j; y++ {
+				rowAlign.SrcYByY[y] = -1
+			}
+			bands = append(bands, core.RowBand{Kind: core.RowBandInserted, Y0: j0 + paired, Y1: j, SrcY0: i0 + paired, SrcY1: i0 + paired})
+		}
+		if i-i0 > paired {
+			bands = append(bands, core.RowBand{Kind: core.RowBandDeleted, Y0: j0 + paired, Y1: j0 + paired, SrcY0: i0 + paired, SrcY1: i})
+		}
+	}
+	for _, step := range path {
+		switch step {
+		case scrollMatch:
+			flush()
+			rowAlign.SrcYByY[j] = i
+			matched++
+			i, j = i+1, j+1
+			i0, j0 = i, j
+		case scrollDelete:
+			i++
+		case scrollInsert:
+			j++
+		}
+	}
+	flush()
+	rowAlign.Score = float64(matched) / float64(max(a.H, b.H))
+
+	logger.Info("scroll detection complete",
+		"rowsA", a.H,
+		"rowsB", b.H,
+		"matchedRows", matched,
+		"bands", len(bands),
+	)
+	return rowAlign, bands
+}
+
+// rowHashes returns the FNV-1a hash of the pixels in columns [x0,x1) of
+// every row of f.
+func rowHashes(f *core.Frame, x0, x1 int) []uint64 {
+	hashes := make([]uint64, f.H)
+	h := fnv.New64a()
+	for y := range hashes {
+		row := f.Pix.Pix[y*f.Pix.Stride:]
+		h.Reset()
+		h.Write(row[x0*4 : x1*4])
+		hashes[y] = h.Sum64()
+	}
+	return hashes
+}
+
+// lcsPath returns the steps of a longest common subsequence of a and b that
+// pairs element i of a only with elements j of b where lo <= j-i <= hi
+// (lo <= 0 <= hi, lo <= len(b)-len(a) <= hi). Ties prefer deletions from a
+// at the end, so that equal runs match as early as possible.
+func lcsPath(a, b []uint64, lo, hi int) []uint8 {
+	n, m, w := len(a), len(b), hi-lo+1
+	dir := make([]uint8, (n+1)*w)
+	prev, cur := make([]int32, w), make([]int32, w)
+	for i := 0; i <= n; i++ {
+		for j := max(0, i+lo); j <= min(m, i+hi); j++ {
+			k := j - i - lo
+			if i == 0 && j == 0 {
+				cur[k] = 0
+				continue
+			}
+			best, step := int32(-1), uint8(0)
+			if i > 0 && j > 0 && a[i-1] == b[j-1] {
+				best, step = prev[k]+1, scrollMatch
+			} else {
+				if i > 0 && k+1 < w && prev[k+1] > best {
+					best, step = prev[k+1], scrollDelete
+				}
+				if j > 0 && k > 0 && cur[k-1] > best {
+					best, step = cur[k-1], scrollInsert
+				}
+			}
+			cur[k], dir[i*w+k] = best, step
+		}
+		prev, cur = cur, prev
+	}
+
+	path := make([]uint8, 0, max(n, m))
+	for i, j := n, m; i > 0 || j > 0; {
+		step := dir[i*w+j-i-lo]
+		path = append(path, step)
+		switch step {
+		case scrollMatch:
+			i, j = i-1, j-1
+		case scrollDelete:
+			i--
+		default:
+			j--
+		}
+	}
+	for l, r := 0, len(path)-1; l < r; l, r = l+1, r-1 {
+		path[l], path[r] = path[r], path[l]
+	}
+	return path
+}
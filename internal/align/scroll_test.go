@@ -0,0 +1,179 @@
+package align
+
+import (
+	"image"
+	"image/color"
+	"reflect"
+	"testing"
+
+	"github.com/xshoji/go-img-diff/internal/core"
+	"github.com/xshoji/go-img-diff/internal/diff"
+)
+
+// pageRow is the color of row i of a synthetic page; rows below 256 differ.
+func pageRow(i int) color.NRGBA {
+	return color.NRGBA{uint8(i), uint8(3 * i), 100, 255}
+}
+
+// rowsFrame returns a frame 40 pixels wide whose rows are filled with the
+// given colors.
+func rowsFrame(rows []color.NRGBA) *core.Frame {
+	img := image.NewNRGBA(image.Rect(0, 0, 40, len(rows)))
+	for y, c := range rows {
+		for x := 0; x < 40; x++ {
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	return core.NewFrame(img)
+}
+
+// pageRows returns the rows [from,to) of the synthetic page.
+func pageRows(from, to int) []color.NRGBA {
+	var rows []color.NRGBA
+	for i := from; i < to; i++ {
+		rows = append(rows, pageRow(i))
+	}
+	return rows
+}
+
+// fillRows returns n rows of color c.
+func fillRows(n int, c color.NRGBA) []color.NRGBA {
+	rows := make([]color.NRGBA, n)
+	for i := range rows {
+		rows[i] = c
+	}
+	return rows
+}
+
+func concatRows(parts ...[]color.NRGBA) []color.NRGBA {
+	var rows []color.NRGBA
+	for _, p := range parts {
+		rows = append(rows, p...)
+	}
+	return rows
+}
+
+func TestScrollAlign(t *testing.T) {
+	inserted := color.NRGBA{0, 200, 0, 255}
+	changed := color.NRGBA{255, 0, 255, 255}
+	a := rowsFrame(pageRows(0, 100))
+	tests := []struct {
+		name  string
+		b     []color.NRGBA
+		bands []core.RowBand
+		srcY  map[int]int // expected source rows of some rows of B
+		diff  int         // rows that differ outside the bands
+	}{
+		{
+			name: "identical",
+			b:    pageRows(0, 100),
+			srcY: map[int]int{0: 0, 50: 50, 99: 99},
+		},
+		{
+			name:  "line inserted",
+			b:     concatRows(pageRows(0, 30), fillRows(10, inserted), pageRows(30, 100)),
+			bands: []core.RowBand{{Kind: core.RowBandInserted, Y0: 30, Y1: 40, SrcY0: 30, SrcY1: 30}},
+			srcY:  map[int]int{29: 29, 30: -1, 39: -1, 40: 30, 109: 99},
+		},
+		{
+			name:  "line deleted",
+			b:     concatRows(pageRows(0, 50), pageRows(56, 100)),
+			bands: []core.RowBand{{Kind: core.RowBandDeleted, Y0: 50, Y1: 50, SrcY0: 50, SrcY1: 56}},
+			srcY:  map[int]int{49: 49, 50: 56, 93: 99},
+		},
+		{
+			// Rows changed in place are paired and compared, not banded.
+			name: "rows changed",
+			b:    concatRows(pageRows(0, 20), fillRows(5, changed), pageRows(25, 100)),
+			srcY: map[int]int{20: 20, 24: 24, 25: 25},
+			diff: 5,
+		},
+		{
+			// Changed rows are paired top-down; the surplus is inserted.
+			name:  "rows changed and inserted",
+			b:     concatRows(pageRows(0, 20), fillRows(8, changed), pageRows(25, 100)),
+			bands: []core.RowBand{{Kind: core.RowBandInserted, Y0: 25, Y1: 28, SrcY0: 25, SrcY1: 25}},
+			srcY:  map[int]int{20: 20, 24: 24, 25: -1, 28: 25},
+			diff:  5,
+		},
+		{
+			name: "scrolled",
+			b:    concatRows(pageRows(10, 100), fillRows(10, inserted)),
+			bands: []core.RowBand{
+				{Kind: core.RowBandDeleted, Y0: 0, Y1: 0, SrcY0: 0, SrcY1: 10},
+				{Kind: core.RowBandInserted, Y0: 90, Y1: 100, SrcY0: 100, SrcY1: 100},
+			},
+			srcY: map[int]int{0: 10, 89: 99, 90: -1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := rowsFrame(tt.b)
+			rowAlign, bands := ScrollAlign(a, b, core.Alignment{}, testLogger())
+			if !reflect.DeepEqual(bands, tt.bands) {
+				t.Errorf("bands = %+v, want %+v", bands, tt.bands)
+			}
+			for y, want := range tt.srcY {
+				if got := rowAlign.SrcY(y); got != want {
+					t.Errorf("row %d of B maps to %d, want %d", y, got, want)
+				}
+			}
+
+			// Outside the bands, only the rows changed in place differ.
+			opts := core.DefaultOptions().Diff
+			mask := diff.BuildMask(a, b, rowAlign, opts, testLogger())
+			for _, band := range bands {
+				mask.ClearRect(image.Rect(0, band.Y0, b.W, band.Y1))
+			}
+			if mask.Count != tt.diff*b.W {
+				t.Errorf("%d diff pixels outside the bands, want %d", mask.Count, tt.diff*b.W)
+			}
+		})
+	}
+}
+
+func TestScrollAlign_HorizontalOffset(t *testing.T) {
+	// B is A moved right by 3 pixels with a line inserted: rows are hashed
+	// over the columns both cover under the global offset.
+	a := rowsFrame(pageRows(0, 60))
+	for y := 0; y < a.H; y++ {
+		a.Pix.SetNRGBA(y%a.W, y, color.NRGBA{255, 255, 255, 255}) // make rows column dependent
+	}
+	b := rowsFrame(concatRows(pageRows(0, 20), fillRows(4, color.NRGBA{0, 200, 0, 255}), pageRows(20, 60)))
+	for y := 0; y < b.H; y++ {
+		src := y
+		if y >= 24 {
+			src = y - 4
+		}
+		if y < 20 || y >= 24 {
+			if x := src%a.W + 3; x < b.W {
+				b.Pix.SetNRGBA(x, y, color.NRGBA{255, 255, 255, 255})
+			}
+		}
+	}
+	_, bands := ScrollAlign(a, b, core.Alignment{DX: 3}, testLogger())
+	want := []core.RowBand{{Kind: core.RowBandInserted, Y0: 20, Y1: 24, SrcY0: 20, SrcY1: 20}}
+	if !reflect.DeepEqual(bands, want) {
+		t.Errorf("bands = %+v, want %+v", bands, want)
+	}
+}
+
+func TestLCSPath(t *testing.T) {
+	// a = 1 2 3 4, b = 1 3 4 5: 2 is deleted, 5 inserted.
+	path := lcsPath([]uint64{1, 2, 3, 4}, []uint64{1, 3, 4, 5}, -2, 2)
+	want := []uint8{scrollMatch, scrollDelete, scrollMatch, scrollMatch, scrollInsert}
+	if !reflect.DeepEqual(path, want) {
+		t.Errorf("path = %v, want %v", path, want)
+	}
+
+	// The band keeps matches from straying: the 5s are 4 rows apart.
+	path = lcsPath([]uint64{1, 2, 3, 4, 5}, []uint64{5, 9, 9, 9, 9}, -1, 1)
+	for _, step := range path {
+		if step == scrollMatch {
+			t.Fatalf("path = %v, matched outside the band", path)
+		}
+	}
+	if len(path) != 10 {
+		t.Errorf("path has %d steps, want 10", len(path))
+	}
+}
@@ -0,0 +1,101 @@
+package align
+
+import (
+	"image"
+	"math"
+
+	"github.com/xshoji/go-img-diff/internal/core"
+)
+
+const (
+	// ssimWindow is the side of the square windows SSIM is computed over, and
+	// ssimStride the distance between them (windows overlap by half).
+	ssimWindow = 8
+	ssimStride = 4
+
+	// ssimC1 and ssimC2 stabilize the division for flat windows:
+	// (K1*L)^2 and (K2*L)^2 with K1=0.01, K2=0.03 and L=255.
+	ssimC1 = (0.01 * 255) * (0.01 * 255)
+	ssimC2 = (0.03 * 255) * (0.03 * 255)
+)
+
+// SSIM returns the mean structural similarity (Wang et al. 2004) of the
+// luminance of a and b over their overlap under offset (dx, dy), with uniform
+// 8x8 windows every 4 pixels, and the number of windows averaged. It ranges
+// from -1 to 1 (identical). Windows containing pixels ignored in b are
+// skipped; the overlap must be large enough to be scored (see scoredOverlap),
+// otherwise 0 windows are returned.
+func SSIM(a, b *core.Frame, dx, dy int) (float64, int) {
+	overlap, ok := scoredOverlap(image.Pt(a.W, a.H), image.Pt(b.W, b.H), dx, dy)
+	if !ok {
+		return 0, 0
+	}
+	// Overlaps smaller than a window are compared as a single window.
+	winW, winH := min(ssimWindow, overlap.Dx()), min(ssimWindow, overlap.Dy())
+	n := float64(winW * winH)
+
+	var sum float64
+	windows := 0
+	for y0 := overlap.Min.Y; y0+winH <= overlap.Max.Y; y0 += ssimStride {
+		for x0 := overlap.Min.X; x0+winW <= overlap.Max.X; x0 += ssimStride {
+			var sa, sb, saa, sbb, sab int
+			ignored := false
+			for y := y0; y < y0+winH && !ignored; y++ {
+				rowA := a.Gray[y*a.W+x0 : y*a.W+x0+winW]
+				rowB := b.Gray[(y+dy)*b.W+x0+dx : (y+dy)*b.W+x0+dx+winW]
+				for i, ga := range rowA {
+					if b.Ignored(x0+dx+i, y+dy) {
+						ignored = true
+						break
+					}
+					va, vb := int(ga), int(rowB[i])
+					sa += va
+					sb += vb
+					saa += va * va
+					sbb += vb * vb
+					sab += va * vb
+				}
+			}
+			if ignored {
+				continue
+			}
+			muA, muB := float64(sa)/n, float64(sb)/n
+			varA := float64(saa)/n - muA*muA
+			varB := float64(sbb)/n - muB*muB
+			cov := float64(sab)/n - muA*muB
+			sum += (2*muA*muB + ssimC1) * (2*cov + ssimC2) /
+				((muA*muA + muB*muB + ssimC1) * (varA + varB + ssimC2))
+			windows++
+		}
+	}
+	if windows == 0 {
+		return 0, 0
+	}
+	return sum / float64(windows), windows
+}
+
+// maxError is the error of the worst match under either metric. Scores,
+// confidences and the spiral cutoff divide or scale by it, so they work alike
+// for both metrics.
+const maxError = 255.0
+
+// ssimError maps SSIM onto the MAE scale of the search: 0 for identical
+// overlaps, maxError for SSIM <= 0, and math.MaxFloat64 if the offset cannot
+// be scored.
+func ssimError(a, b *core.Frame, dx, dy int) (float64, int) {
+	s, windows := SSIM(a, b, dx, dy)
+	if windows == 0 {
+		return math.MaxFloat64, 0
+	}
+	return maxError * (1 - max(0, s)), windows * ssimWindow * ssimWindow
+}
+
+// calcError scores offset (dx, dy) under metric: the grayscale MAE (see
+// calcMAE, abandoned beyond bestMAE) or ssimError, which is never abandoned.
+// It also returns the number of pixels visited.
+func calcError(a, b *core.Frame, dx, dy int, bestMAE float64, metric core.AlignMetric) (float64, int) {
+	if metric == core.AlignMetricSSIM {
+		return ssimError(a, b, dx, dy)
+	}
+	return calcMAE(a, b, dx, dy, bestMAE)
+}
@@ -0,0 +1,107 @@
+package align
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"math/rand/v2"
+	"testing"
+
+	"github.com/xshoji/go-img-diff/internal/core"
+)
+
+// makeTexture returns a w x h frame of random gray 4x4 blocks with values
+// offset+0..149, shifted so that pixel (x, y) shows block (x-dx, y-dy).
+func makeTexture(w, h, dx, dy int, offset uint8) *core.Frame {
+	rng := rand.New(rand.NewPCG(7, 11))
+	blocks := make([]uint8, (w/4+4)*(h/4+4))
+	for i := range blocks {
+		blocks[i] = uint8(rng.IntN(150))
+	}
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			bx, by := (x-dx+8)/4, (y-dy+8)/4
+			v := blocks[by*(w/4+4)+bx] + offset
+			img.SetNRGBA(x, y, color.NRGBA{v, v, v, 255})
+		}
+	}
+	return core.NewFrame(img)
+}
+
+func TestSSIM_KnownValues(t *testing.T) {
+	gray := func(v uint8) *core.Frame { return makeFrame(32, 32, color.NRGBA{v, v, v, 255}) }
+	flat := func(a, b float64) float64 { return (2*a*b + ssimC1) / (a*a + b*b + ssimC1) }
+	texture := makeTexture(64, 64, 0, 0, 50)
+	inverted := core.NewFrame(texture.Pix)
+	for i, g := range texture.Gray {
+		inverted.Gray[i] = 255 - g
+	}
+
+	tests := []struct {
+		name string
+		a, b *core.Frame
+		want float64
+		tol  float64
+	}{
+		{"identical", texture, texture, 1, 1e-12},
+		{"black and white", gray(0), gray(255), flat(0, 255), 1e-12}, // about 1e-4
+		{"flat 100 and 150", gray(100), gray(150), flat(100, 150), 1e-12},
+		{"inverted texture", texture, inverted, -0.8, 0.2}, // structure reversed
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, windows := SSIM(tt.a, tt.b, 0, 0)
+			if windows == 0 || math.Abs(got-tt.want) > tt.tol {
+				t.Errorf("SSIM = %v over %d windows, want %v ± %v", got, windows, tt.want, tt.tol)
+			}
+		})
+	}
+	if got, _ := SSIM(gray(0), gray(255), 0, 0); got > 0.001 {
+		t.Errorf("black and white: SSIM = %v, want near 0", got)
+	}
+}
+
+func TestSSIM_Ignored(t *testing.T) {
+	a := makeTexture(32, 32, 0, 0, 0)
+	b := makeTexture(32, 32, 0, 0, 100)
+	_, all := SSIM(a, b, 0, 0)
+	b.Ignore = core.NewMask(32, 32)
+	b.Ignore.Set(0, 0)
+	if _, windows := SSIM(a, b, 0, 0); windows != all-1 {
+		t.Errorf("windows = %d, want %d with the corner window skipped", windows, all-1)
+	}
+}
+
+func TestAlign_SSIMBrightnessChange(t *testing.T) {
+	// B is A moved by (3, 2) and 60 levels brighter.
+	a := makeTexture(128, 96, 0, 0, 0)
+	b := makeTexture(128, 96, 3, 2, 60)
+	opts := core.AlignOptions{MaxOffsetX: 8, MaxOffsetY: 8, MinPyramidSize: 16, RefinementRadius: 2, Metric: core.AlignMetricSSIM}
+	al := Align(a, b, opts, 2, testLogger())
+	if al.DX != 3 || al.DY != 2 {
+		t.Fatalf("offset = (%d,%d), want (3,2)", al.DX, al.DY)
+	}
+	want, _ := SSIM(a, b, 3, 2)
+	if al.SSIM != want || math.Abs(al.Score-want) > 1e-9 || al.SSIM <= 0.5 {
+		t.Errorf("SSIM = %v, score = %v, want %v (> 0.5) for both", al.SSIM, al.Score, want)
+	}
+	if al.Confidence <= 1 {
+		t.Errorf("confidence = %v, want > 1", al.Confidence)
+	}
+}
+
+func TestAlign_SSIMSpiralBeyondFirstRing(t *testing.T) {
+	// A single level, so the spiral has to expand six rings to reach the
+	// offset: the epsilon cutoff must not stop it after the first one.
+	a := makeFrameWithCircle(100, 100, 50, 50, 20)
+	b := makeFrameWithCircle(100, 100, 44, 53, 20)
+	opts := core.AlignOptions{MaxOffsetX: 10, MaxOffsetY: 10, MinPyramidSize: 200, RefinementRadius: 2, Metric: core.AlignMetricSSIM, SearchStrategy: core.SearchSpiral, SpiralEpsilon: 0.001}
+	al, stats := alignFrames(a, b, opts, 2, nil, testLogger())
+	if al.DX != -6 || al.DY != 3 {
+		t.Errorf("offset = (%d,%d), want (-6,3)", al.DX, al.DY)
+	}
+	if rings := 1 + 8 + 16 + 24 + 32 + 40 + 48; stats.Candidates < rings {
+		t.Errorf("spiral evaluated %d offsets, want at least the %d within six rings", stats.Candidates, rings)
+	}
+}
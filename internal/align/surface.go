@@ -0,0 +1,47 @@
+package align
+
+import (
+	"math"
+	"runtime"
+	"sync"
+
+	"github.com/xshoji/go-img-diff/internal/core"
+)
+
+// ScoreSurface scores every offset within ±maxOffset at full resolution under
+// metric and marks the chosen alignment. The pyramid search only visits a sparse subset of
+// offsets per level, so its stages cannot be composed into a dense landscape;
+// the surface is computed with an exhaustive scan and is meant for debugging.
+func ScoreSurface(a, b *core.Frame, chosen core.Alignment, maxOffset int, metric core.AlignMetric, workers int) *core.ScoreSurface {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	surface := core.NewScoreSurface(maxOffset)
+	surface.Chosen = chosen
+	radius := surface.Radius
+
+	rows := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < min(workers, surface.Size()); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for dy := range rows {
+				for dx := -radius; dx <= radius; dx++ {
+					mae, _ := calcError(a, b, dx, dy, math.MaxFloat64, metric)
+					if mae < math.MaxFloat64 {
+						// Each worker owns a distinct row of the grid.
+						surface.Set(dx, dy, 1.0-mae/maxError)
+					}
+				}
+			}
+		}()
+	}
+	for dy := -radius; dy <= radius; dy++ {
+		rows <- dy
+	}
+	close(rows)
+	wg.Wait()
+
+	return surface
+}
@@ -0,0 +1,35 @@
+package align
+
+import (
+	"math"
+	"testing"
+
+	"github.com/xshoji/go-img-diff/internal/core"
+)
+
+func TestScoreSurface_BrightestCellIsChosenOffset(t *testing.T) {
+	a := makeFrameWithCircle(100, 100, 50, 50, 15)
+	b := makeFrameWithCircle(100, 100, 50+4, 50-2, 15)
+	opts := core.AlignOptions{MaxOffsetX: 6, MaxOffsetY: 6, MinPyramidSize: 16, RefinementRadius: 2}
+	al := Align(a, b, opts, 2, testLogger())
+
+	surface := ScoreSurface(a, b, al, opts.MaxOffsetX, opts.Metric, 2)
+	if surface.Size() != 13 || len(surface.Scores) != 13*13 {
+		t.Fatalf("expected 13x13 surface, got size %d with %d scores", surface.Size(), len(surface.Scores))
+	}
+
+	bestDX, bestDY, best := 0, 0, math.Inf(-1)
+	for dy := -surface.Radius; dy <= surface.Radius; dy++ {
+		for dx := -surface.Radius; dx <= surface.Radius; dx++ {
+			if v := surface.At(dx, dy); v > best {
+				best, bestDX, bestDY = v, dx, dy
+			}
+		}
+	}
+	if bestDX != al.DX || bestDY != al.DY {
+		t.Errorf("brightest cell (%d,%d) does not match alignment (%d,%d)", bestDX, bestDY, al.DX, al.DY)
+	}
+	if surface.Chosen != al {
+		t.Errorf("expected chosen alignment %+v, got %+v", al, surface.Chosen)
+	}
+}
@@ -10,7 +10,7 @@ import (
 
 func TestVerticalDPAlign_ReducesTailDiffForInsertedSection(t *testing.T) {
 	a, b := makeWebsiteLikeFrames()
-	global := Align(a, b, core.AlignOptions{MaxOffset: 10, MinPyramidSize: 16, RefinementRadius: 2}, 1, testLogger())
+	global := Align(a, b, core.AlignOptions{MaxOffsetX: 10, MaxOffsetY: 10, MinPyramidSize: 16, RefinementRadius: 2}, 1, testLogger())
 	baseRows := core.NewRowAlignmentFromAlignment(b.W, b.H, global)
 	opts := core.DefaultOptions()
 
@@ -36,7 +36,7 @@ func TestVerticalDPAlign_ReducesTailDiffForInsertedSection(t *testing.T) {
 
 func TestVerticalDPAlignInRange_PreservesSidebarWhileResyncingContent(t *testing.T) {
 	a, b := makeWebsiteLikeFramesWithSidebar()
-	global := Align(a, b, core.AlignOptions{MaxOffset: 10, MinPyramidSize: 16, RefinementRadius: 2}, 1, testLogger())
+	global := Align(a, b, core.AlignOptions{MaxOffsetX: 10, MaxOffsetY: 10, MinPyramidSize: 16, RefinementRadius: 2}, 1, testLogger())
 	baseRows := core.NewRowAlignmentFromAlignment(b.W, b.H, global)
 	opts := core.DefaultOptions()
 
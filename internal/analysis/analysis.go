@@ -0,0 +1,252 @@
+// Package analysis stores the outcome of a comparison in a versioned sidecar
+// file, so outputs can be rendered again with different settings without
+// repeating alignment and diff detection.
+package analysis
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"io"
+	"os"
+
+	"github.com/xshoji/go-img-diff/internal/core"
+	"github.com/xshoji/go-img-diff/internal/imgio"
+)
+
+// Version is the sidecar format version written by Save. Load rejects files
+// with any other version.
+const Version = 1
+
+// File is the serialized analysis of one image pair.
+type File struct {
+	Version int    `json:"version"`
+	Input1  string `json:"input1"`
+	Input2  string `json:"input2"`
+
+	// SizeA is the size of input1 as compared, i.e. after Orientation was applied.
+	SizeA       Size             `json:"size_a"`
+	Orientation core.Orientation `json:"orientation,omitempty"`
+
+	Offset       Offset            `json:"offset"`
+	RowAlignment core.RowAlignment `json:"row_alignment"`
+	RowBands     []core.RowBand    `json:"row_bands,omitempty"`
+	DiffMask     Mask              `json:"diff_mask"`
+	Regions      []Region          `json:"regions"`
+	Stats        Stats             `json:"stats"`
+
+	// Options is the configuration the analysis was produced with.
+	Options core.Options `json:"options"`
+}
+
+// Size is an image size in pixels.
+type Size struct {
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+// Offset is the detected global translation and its alignment score, with
+// the runner-up offset and confidence when they were computed.
+type Offset struct {
+	X          int          `json:"x"`
+	Y          int          `json:"y"`
+	Score      float64      `json:"score"`
+	RunnerUp   *OffsetScore `json:"runner_up,omitempty"`
+	Confidence float64      `json:"confidence,omitempty"`
+	SSIM       float64      `json:"ssim,omitempty"`
+}
+
+// OffsetScore is a candidate offset and its alignment score.
+type OffsetScore struct {
+	X     int     `json:"x"`
+	Y     int     `json:"y"`
+	Score float64 `json:"score"`
+}
+
+// Mask is a run-length encoded diff mask. Runs alternate between unchanged
+// and differing pixels in row-major order, starting with unchanged pixels.
+type Mask struct {
+	Width  int   `json:"width"`
+	Height int   `json:"height"`
+	Runs   []int `json:"runs"`
+}
+
+// Region is one merged diff region.
+type Region struct {
+	MinX int `json:"min_x"`
+	MinY int `json:"min_y"`
+	MaxX int `json:"max_x"`
+	MaxY int `json:"max_y"`
+	Area int `json:"area"`
+
+	Severity float64 `json:"severity,omitempty"`
+	MeanDiff float64 `json:"mean_diff,omitempty"`
+}
+
+// Stats summarizes the diff mask.
+type Stats struct {
+	HasDiff    bool    `json:"has_diff"`
+	DiffPixels int     `json:"diff_pixels"`
+	DiffRatio  float64 `json:"diff_ratio"`
+	MSE        float64 `json:"mse"`
+	Compared   int     `json:"compared_pixels,omitempty"` // 0 in older files: the whole mask was compared
+}
+
+// New captures result, which must include the diff mask, together with the
+// options it was produced with.
+func New(opts core.Options, result *core.Result) *File {
+	opts.Runtime.Progress = nil
+	f := &File{
+		Version:      Version,
+		Input1:       opts.Input1,
+		Input2:       opts.Input2,
+		Orientation:  result.Orientation,
+		Offset:       Offset{X: result.Aligned.DX, Y: result.Aligned.DY, Score: result.Aligned.Score, Confidence: result.Aligned.Confidence, SSIM: result.Aligned.SSIM},
+		RowAlignment: result.RowAligned,
+		RowBands:     result.RowBands,
+		Regions:      make([]Region, 0, len(result.Regions)),
+		Stats: Stats{
+			HasDiff:    result.HasDiff,
+			DiffPixels: result.DiffPixels(),
+			DiffRatio:  result.DiffRatio(),
+			MSE:        result.MSE,
+			Compared:   result.ComparedPixels,
+		},
+		Options: opts,
+	}
+	if ru := result.Aligned.RunnerUp; result.Aligned.Confidence > 0 {
+		f.Offset.RunnerUp = &OffsetScore{X: ru.DX, Y: ru.DY, Score: ru.Score}
+	}
+	if result.FrameA != nil {
+		f.SizeA = Size{Width: result.FrameA.W, Height: result.FrameA.H}
+	}
+	if m := result.DiffMask; m != nil {
+		f.DiffMask = Mask{Width: m.W, Height: m.H, Runs: EncodeRuns(m.Data)}
+	}
+	for _, r := range result.Regions {
+		b := r.Bounds
+		f.Regions = append(f.Regions, Region{MinX: b.Min.X, MinY: b.Min.Y, MaxX: b.Max.X, MaxY: b.Max.Y, Area: r.Area, Severity: r.Severity, MeanDiff: r.MeanDiff})
+	}
+	return f
+}
+
+// Result rebuilds the comparison result from the loaded input images. Frame A
+// is rotated as recorded. The images must have the sizes of the analysis.
+// Output is left nil for the caller to render.
+func (f *File) Result(frameA, frameB *core.Frame) (*core.Result, error) {
+	frameA = frameA.Rotate(f.Orientation)
+	if frameA.W != f.SizeA.Width || frameA.H != f.SizeA.Height {
+		return nil, fmt.Errorf("input1 is %dx%d but the analysis was made with %dx%d", frameA.W, frameA.H, f.SizeA.Width, f.SizeA.Height)
+	}
+	if frameB.W != f.DiffMask.Width || frameB.H != f.DiffMask.Height {
+		return nil, fmt.Errorf("input2 is %dx%d but the analysis was made with %dx%d", frameB.W, frameB.H, f.DiffMask.Width, f.DiffMask.Height)
+	}
+	mask, err := f.DiffMask.Decode()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &core.Result{
+		FrameA:      frameA,
+		FrameB:      frameB,
+		Aligned:     core.Alignment{DX: f.Offset.X, DY: f.Offset.Y, Score: f.Offset.Score, Confidence: f.Offset.Confidence, SSIM: f.Offset.SSIM},
+		RowAligned:  f.RowAlignment,
+		RowBands:    f.RowBands,
+		Regions:     make([]core.Region, 0, len(f.Regions)),
+		DiffMask:    mask,
+		Orientation: f.Orientation,
+		MSE:         f.Stats.MSE,
+	}
+	if result.ComparedPixels = f.Stats.Compared; result.ComparedPixels == 0 {
+		result.ComparedPixels = mask.W * mask.H
+	}
+	if ru := f.Offset.RunnerUp; ru != nil {
+		result.Aligned.RunnerUp = core.OffsetScore{DX: ru.X, DY: ru.Y, Score: ru.Score}
+	}
+	for _, r := range f.Regions {
+		result.Regions = append(result.Regions, core.Region{Bounds: image.Rect(r.MinX, r.MinY, r.MaxX, r.MaxY), Area: r.Area, Severity: r.Severity, MeanDiff: r.MeanDiff})
+	}
+	result.Differs(f.Options.Diff)
+	return result, nil
+}
+
+// Decode expands the runs into a core.Mask.
+func (m Mask) Decode() (*core.Mask, error) {
+	if m.Width < 0 || m.Height < 0 {
+		return nil, fmt.Errorf("invalid diff mask size %dx%d", m.Width, m.Height)
+	}
+	mask := core.NewMask(m.Width, m.Height)
+	pos := 0
+	for i, run := range m.Runs {
+		if run < 0 || run > len(mask.Data)-pos {
+			return nil, fmt.Errorf("diff mask run %d overflows %dx%d mask", i, m.Width, m.Height)
+		}
+		if i%2 == 1 {
+			for j := pos; j < pos+run; j++ {
+				mask.Data[j] = 1
+			}
+			mask.Count += run
+		}
+		pos += run
+	}
+	if pos != len(mask.Data) {
+		return nil, fmt.Errorf("diff mask runs cover %d of %d pixels", pos, len(mask.Data))
+	}
+	return mask, nil
+}
+
+// EncodeRuns run-length encodes mask data: alternating counts of zero and
+// non-zero values, starting with zeros (possibly an empty run).
+func EncodeRuns(data []uint8) []int {
+	runs := []int{}
+	set := false
+	run := 0
+	for _, v := range data {
+		if (v != 0) != set {
+			runs = append(runs, run)
+			set = !set
+			run = 0
+		}
+		run++
+	}
+	return append(runs, run)
+}
+
+// Write encodes the analysis as compact JSON.
+func (f *File) Write(w io.Writer) error {
+	if err := json.NewEncoder(w).Encode(f); err != nil {
+		return fmt.Errorf("failed to encode analysis: %w", err)
+	}
+	return nil
+}
+
+// Save writes the analysis to path.
+func (f *File) Save(path string, mode imgio.WriteMode) error {
+	return imgio.WriteFile(path, mode, f.Write)
+}
+
+// Read decodes an analysis and checks its format version.
+func Read(r io.Reader) (*File, error) {
+	var f File
+	if err := json.NewDecoder(r).Decode(&f); err != nil {
+		return nil, fmt.Errorf("failed to parse analysis: %w", err)
+	}
+	if f.Version != Version {
+		return nil, fmt.Errorf("unsupported analysis version %d (supported: %d)", f.Version, Version)
+	}
+	return &f, nil
+}
+
+// Load reads an analysis previously written by Save.
+func Load(path string) (*File, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read analysis %s: %w", path, err)
+	}
+	defer file.Close()
+	f, err := Read(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return f, nil
+}
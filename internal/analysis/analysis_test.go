@@ -0,0 +1,107 @@
+package analysis
+
+import (
+	"bytes"
+	"image"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/xshoji/go-img-diff/internal/core"
+)
+
+func TestEncodeRunsRoundTrip(t *testing.T) {
+	cases := [][]uint8{
+		{},
+		{0, 0, 0},
+		{1, 1},
+		{1, 0, 0, 1, 1, 1, 0},
+		{0, 1, 0, 1, 0, 1},
+	}
+	for _, data := range cases {
+		runs := EncodeRuns(data)
+		mask, err := Mask{Width: len(data), Height: 1, Runs: runs}.Decode()
+		if err != nil {
+			t.Fatalf("%v: %v", data, err)
+		}
+		if !bytes.Equal(mask.Data, data) {
+			t.Errorf("round trip of %v = %v (runs %v)", data, mask.Data, runs)
+		}
+		count := bytes.Count(data, []byte{1})
+		if mask.Count != count {
+			t.Errorf("%v: count = %d, want %d", data, mask.Count, count)
+		}
+	}
+}
+
+func TestMaskDecode_RejectsBadRuns(t *testing.T) {
+	for _, runs := range [][]int{{5}, {1, 2}, {2, -1, 3}, {1, 2, 3}} {
+		if _, err := (Mask{Width: 2, Height: 2, Runs: runs}).Decode(); err == nil {
+			t.Errorf("runs %v: expected error", runs)
+		}
+	}
+}
+
+func TestFileRoundTrip(t *testing.T) {
+	frameA := core.NewFrame(image.NewNRGBA(image.Rect(0, 0, 12, 8)))
+	frameB := core.NewFrame(image.NewNRGBA(image.Rect(0, 0, 10, 6)))
+	mask := core.NewMask(10, 6)
+	for x := 2; x < 5; x++ {
+		mask.Set(x, 3)
+	}
+	result := &core.Result{
+		FrameA:     frameA,
+		FrameB:     frameB,
+		Aligned:    core.Alignment{DX: 2, DY: -1, Score: 0.75, RunnerUp: core.OffsetScore{DX: 4, DY: -1, Score: 0.7}, Confidence: 1.9},
+		RowAligned: core.NewRowAlignment(10, 6, 2, -1),
+		HasDiff:    true,
+		Regions:    []core.Region{{Bounds: image.Rect(0, 0, 7, 6), Area: 3}},
+		DiffMask:   mask,
+	}
+	opts := core.DefaultOptions()
+	opts.Input1, opts.Input2 = "a.png", "b.png"
+	opts.Diff.Threshold = 12
+
+	var buf bytes.Buffer
+	if err := New(opts, result).Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	f, err := Read(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Input1 != "a.png" || f.Input2 != "b.png" || f.Options.Diff.Threshold != 12 {
+		t.Errorf("inputs/options not preserved: %+v", f)
+	}
+	if f.Stats.DiffPixels != 3 || !f.Stats.HasDiff {
+		t.Errorf("stats = %+v", f.Stats)
+	}
+
+	got, err := f.Result(frameA, frameB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Aligned != result.Aligned || !got.HasDiff {
+		t.Errorf("alignment = %+v, hasDiff = %v", got.Aligned, got.HasDiff)
+	}
+	if !reflect.DeepEqual(got.RowAligned, result.RowAligned) {
+		t.Errorf("row alignment not preserved")
+	}
+	if !reflect.DeepEqual(got.Regions, result.Regions) {
+		t.Errorf("regions = %v, want %v", got.Regions, result.Regions)
+	}
+	if !reflect.DeepEqual(got.DiffMask, mask) {
+		t.Errorf("diff mask not preserved")
+	}
+
+	if _, err := f.Result(frameB, frameB); err == nil {
+		t.Error("expected error for a differently sized input1")
+	}
+}
+
+func TestRead_RejectsOtherVersions(t *testing.T) {
+	_, err := Read(strings.NewReader(`{"version":2}`))
+	if err == nil || !strings.Contains(err.Error(), "unsupported analysis version 2") {
+		t.Errorf("err = %v", err)
+	}
+}
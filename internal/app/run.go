@@ -5,36 +5,390 @@ import (
 	"image"
 	"io"
 	"log/slog"
-	"runtime"
+	"os"
+	"path/filepath"
 	"time"
 
 	"github.com/xshoji/go-img-diff/internal/align"
+	"github.com/xshoji/go-img-diff/internal/analysis"
 	"github.com/xshoji/go-img-diff/internal/core"
 	"github.com/xshoji/go-img-diff/internal/diff"
 	"github.com/xshoji/go-img-diff/internal/imgio"
+	"github.com/xshoji/go-img-diff/internal/phash"
+	"github.com/xshoji/go-img-diff/internal/progress"
 	"github.com/xshoji/go-img-diff/internal/region"
 	"github.com/xshoji/go-img-diff/internal/render"
 )
 
-// Run executes the full image diff pipeline.
-// Returns (hasDiff, error). If exitOnDiff is true and there are diffs, it returns early.
-func Run(opts core.Options, exitOnDiff bool, logger *slog.Logger) (bool, error) {
+// Run executes the full image diff pipeline and returns the structured result.
+// If exitOnDiff is true, it returns right after the regions are extracted
+// without rendering.
+func Run(opts core.Options, exitOnDiff bool, logger *slog.Logger) (*core.Result, error) {
 	startTime := time.Now()
 
-	runtime.GOMAXPROCS(opts.Runtime.Workers)
+	if err := opts.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid options: %w", err)
+	}
+	if err := Preflight(opts); err != nil {
+		return nil, err
+	}
+
 	logger.Info("starting pipeline", "workers", opts.Runtime.Workers)
 
 	// 1. Load images
+	phases := newPhaseRecorder(opts.Runtime.ReportMemory)
+	tracker := progress.Start(opts.Runtime.Progress, "load")
 	frameA, err := imgio.LoadFrame(opts.Input1, logger)
 	if err != nil {
-		return false, fmt.Errorf("failed to load input1: %w", err)
+		return nil, fmt.Errorf("failed to load input1: %w", err)
 	}
+	tracker.Update(1, 2)
 
 	frameB, err := imgio.LoadFrame(opts.Input2, logger)
 	if err != nil {
-		return false, fmt.Errorf("failed to load input2: %w", err)
+		return nil, fmt.Errorf("failed to load input2: %w", err)
+	}
+	if opts.Diff.Ignore, err = loadIgnoreMask(opts.Diff, logger); err != nil {
+		return nil, err
+	}
+	tracker.Done()
+	phases.end("load")
+
+	if opts.HistogramOnly {
+		result := compareHistograms(frameA, frameB, opts, logger)
+		result.StartedAt, result.FinishedAt = startTime, time.Now()
+		return result, nil
+	}
+
+	if err := CheckDimensions(frameA, frameB, opts); err != nil {
+		return nil, err
+	}
+
+	// 2-5. Align, diff, extract regions and render
+	result := Compare(frameA, frameB, opts, exitOnDiff, logger)
+	result.StartedAt = startTime
+	phases.samples = append(phases.samples, result.Phases...)
+	result.Phases = phases.samples
+	phases.restart()
+
+	if !opts.Align.AcceptsOffset(result.Aligned) {
+		result.FinishedAt = time.Now()
+		return result, &OffsetRejectedError{Offset: result.Aligned, Max: opts.Align.MaxAcceptableOffset}
+	}
+
+	if err := saveArtifacts(result, opts, logger); err != nil {
+		return nil, err
+	}
+
+	if exitOnDiff {
+		logPhases(result.Phases, logger)
+		if result.HasDiff {
+			logger.Info("differences detected (exit-on-diff mode)", "diffPixels", result.DiffPixels(), "regions", len(result.Regions))
+		} else {
+			logger.Info("no differences detected")
+		}
+		result.FinishedAt = time.Now()
+		return result, nil
+	}
+
+	// 6-7. Apply layout and save
+	if opts.Output.SkipIdentical && !result.HasDiff {
+		logger.Info("no differences; skipping the diff image")
+	} else if err := saveOutput(result, opts, logger); err != nil {
+		return result, err
+	}
+	phases.end("save")
+	result.Phases = phases.samples
+	logPhases(result.Phases, logger)
+
+	result.FinishedAt = time.Now()
+	logger.Info("pipeline complete", "elapsed", progress.FormatDuration(result.FinishedAt.Sub(startTime)), "hasDiff", result.HasDiff, "regions", len(result.Regions), "mse", result.MSE)
+
+	return result, nil
+}
+
+// Rerender rebuilds the result recorded in an analysis file from the input
+// images in opts and renders it with opts.Render, skipping alignment and diff
+// detection. Outputs are written as by Run.
+func Rerender(file *analysis.File, opts core.Options, logger *slog.Logger) (*core.Result, error) {
+	if err := Preflight(opts); err != nil {
+		return nil, err
+	}
+
+	tracker := progress.Start(opts.Runtime.Progress, "load")
+	frameA, err := imgio.LoadFrame(opts.Input1, logger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load input1: %w", err)
+	}
+	tracker.Update(1, 2)
+	frameB, err := imgio.LoadFrame(opts.Input2, logger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load input2: %w", err)
+	}
+	if opts.Diff.Ignore, err = loadIgnoreMask(opts.Diff, logger); err != nil {
+		return nil, err
+	}
+	tracker.Done()
+
+	frameA, frameB, scale := scaleFrames(frameA, frameB, file.Options, logger)
+	frameA, frameB, _ = padFrames(frameA, frameB, file.Options, logger)
+	result, err := file.Result(frameA, withIgnoreMask(frameB, opts.Diff, logger))
+	if err != nil {
+		return nil, err
+	}
+	result.Regions = region.Clamp(result.Regions, image.Rect(0, 0, result.FrameB.W, result.FrameB.H))
+	region.TraceContours(result.Regions, result.DiffMask, opts.Region)
+	result.ROI = clampROI(file.Options.ROI, result.FrameA, result.FrameB, logger)
+	result.Histogram = core.CompareHistograms(result.FrameA.Histogram(), result.FrameB.Histogram())
+	result.Scale, result.Scaled = scale, file.Options.AutoScale && !scale.IsZero()
+	tracker = progress.Start(opts.Runtime.Progress, "render")
+	result.Output = renderDiff(result, opts, logger)
+	tracker.Done()
+
+	if err := saveArtifacts(result, opts, logger); err != nil {
+		return nil, err
+	}
+	if opts.Output.SkipIdentical && !result.HasDiff {
+		logger.Info("no differences; skipping the diff image")
+	} else if err := saveOutput(result, opts, logger); err != nil {
+		return result, err
+	}
+	logger.Info("re-rendered analysis", "hasDiff", result.HasDiff, "regions", len(result.Regions))
+	return result, nil
+}
+
+// saveArtifacts writes the optional outputs derived from the diff mask and
+// alignment: analysis, score surface, mask, heatmap and blink GIF.
+func saveArtifacts(result *core.Result, opts core.Options, logger *slog.Logger) error {
+	if opts.Output.AnalysisPath != "" {
+		if err := analysis.New(opts, result).Save(opts.Output.AnalysisPath, writeMode(opts)); err != nil {
+			return err
+		}
+	}
+
+	if opts.Output.ScoreSurfacePath != "" {
+		if err := saveScoreSurface(result.FrameA, result.FrameB, result.Aligned, opts, logger); err != nil {
+			return err
+		}
+	}
+
+	if opts.Output.MaskPath != "" {
+		if err := saveImage(render.MaskImage(result.DiffMask), opts.Output.MaskPath, opts, logger); err != nil {
+			return fmt.Errorf("failed to save diff mask: %w", err)
+		}
+	}
+
+	if opts.Output.HeatmapPath != "" {
+		ramp := render.ColorRamp(opts.Render.HeatmapGradient)
+		if len(ramp) == 0 {
+			ramp = render.DefaultHeatmapRamp()
+		}
+		heatmap := render.RenderHeatmap(result.FrameA, result.FrameB, result.RowAligned, opts.Diff, ramp, opts.Render.HeatmapOverlay)
+		if err := saveImage(heatmap, opts.Output.HeatmapPath, opts, logger); err != nil {
+			return fmt.Errorf("failed to save heatmap: %w", err)
+		}
+	}
+
+	if opts.Output.BlinkPath != "" {
+		frames := []image.Image{render.AlignedA(result.FrameA, result.FrameB, result.RowAligned), result.FrameB.Pix}
+		if err := imgio.SaveBlinkGIF(frames, opts.Output.BlinkDelay, opts.Output.BlinkPath, writeMode(opts), logger); err != nil {
+			return fmt.Errorf("failed to save blink gif: %w", err)
+		}
+	}
+	return nil
+}
+
+// writeMode returns how output files are written under opts.
+func writeMode(opts core.Options) imgio.WriteMode {
+	return imgio.OutputWriteMode(opts.Output)
+}
+
+// saveImage saves img to path with the write mode and encoding of opts.
+func saveImage(img image.Image, path string, opts core.Options, logger *slog.Logger) error {
+	return imgio.SaveImageEncoded(img, path, imgio.OutputEncoding(opts.Output), writeMode(opts), logger)
+}
+
+// saveOutput applies the layout and saves the diff image, if an output path is
+// set, and the annotated copy of image A, if its path is set.
+func saveOutput(result *core.Result, opts core.Options, logger *slog.Logger) error {
+	outputImage := ApplyLayout(result, opts, logger)
+	if opts.Output.PathA != "" {
+		annotated := render.RenderA(result.FrameA, result.Regions, result.Aligned, opts.Render)
+		if err := saveImage(annotated, opts.Output.PathA, opts, logger); err != nil {
+			return fmt.Errorf("failed to save annotated input1: %w", err)
+		}
+	}
+	if opts.Output.CropDir != "" {
+		if err := saveRegionCrops(result, opts, logger); err != nil {
+			return err
+		}
+	}
+	if opts.Output.Path == "" {
+		return nil
+	}
+	tracker := progress.Start(opts.Runtime.Progress, "save")
+	defer tracker.Done()
+	enc := imgio.OutputEncoding(opts.Output)
+	if opts.Output.StampVersion && opts.Output.Version != "" {
+		enc.Text = map[string]string{"Software": "imgdiff " + opts.Output.Version}
 	}
+	if err := imgio.SaveImageEncoded(outputImage, opts.Output.Path, enc, writeMode(opts), logger); err != nil {
+		return fmt.Errorf("failed to save output: %w", err)
+	}
+	return nil
+}
+
+// OffsetRejectedError is returned by Run when the detected offset exceeds
+// AlignOptions.MaxAcceptableOffset. The accompanying result is still valid.
+type OffsetRejectedError struct {
+	Offset core.Alignment
+	Max    int
+}
 
+func (e *OffsetRejectedError) Error() string {
+	return fmt.Sprintf("detected offset (%d,%d) exceeds max acceptable offset %d", e.Offset.DX, e.Offset.DY, e.Max)
+}
+
+// Preflight checks that every configured output can be written, so a run
+// fails before the expensive analysis instead of after it.
+func Preflight(opts core.Options) error {
+	for _, path := range []string{opts.Output.Path, opts.Output.PathA, opts.Output.ScoreSurfacePath, opts.Output.MaskPath, opts.Output.HeatmapPath} {
+		if path == "" {
+			continue
+		}
+		if err := imgio.CheckImageOutput(path, writeMode(opts)); err != nil {
+			return fmt.Errorf("output check failed: %w", err)
+		}
+	}
+	for _, path := range []string{opts.Output.BlinkPath, opts.Output.AnalysisPath} {
+		if path == "" {
+			continue
+		}
+		if err := imgio.CheckWritable(path, writeMode(opts)); err != nil {
+			return fmt.Errorf("output check failed: %w", err)
+		}
+	}
+	return nil
+}
+
+// AspectRatioError is returned when the aspect ratios of the inputs differ by
+// more than AlignOptions.MaxAspectFactor and StrictDimensions is set.
+type AspectRatioError struct {
+	SizeA, SizeB image.Point
+	Factor       float64
+	Max          float64
+}
+
+func (e *AspectRatioError) Error() string {
+	return fmt.Sprintf("aspect ratios of %dx%d and %dx%d differ by a factor of %.2f (max %.2f)",
+		e.SizeA.X, e.SizeA.Y, e.SizeB.X, e.SizeB.Y, e.Factor, e.Max)
+}
+
+// ImageSizeError is returned when the inputs differ in size and
+// Options.SizeMismatch is SizeMismatchError.
+type ImageSizeError struct {
+	SizeA, SizeB image.Point
+}
+
+func (e *ImageSizeError) Error() string {
+	return fmt.Sprintf("image sizes differ: input1 is %dx%d, input2 is %dx%d",
+		e.SizeA.X, e.SizeA.Y, e.SizeB.X, e.SizeB.Y)
+}
+
+// ScaleError is returned when Options.AutoScale is set and the sizes of the
+// inputs do not differ by a uniform simple ratio (see core.DetectScale).
+type ScaleError struct {
+	SizeA, SizeB image.Point
+}
+
+func (e *ScaleError) Error() string {
+	return fmt.Sprintf("cannot auto-scale: input1 is %dx%d and input2 is %dx%d, which is not the same simple ratio in both axes",
+		e.SizeA.X, e.SizeA.Y, e.SizeB.X, e.SizeB.Y)
+}
+
+// CheckDimensions returns a *ScaleError if the frames cannot be scaled to
+// each other under AutoScale, an *ImageSizeError if they differ in size
+// under SizeMismatchError, or an *AspectRatioError if they cannot be
+// compared under StrictDimensions.
+func CheckDimensions(a, b *core.Frame, opts core.Options) error {
+	if opts.AutoScale && (a.W != b.W || a.H != b.H) {
+		factor, ok := core.DetectScale(image.Pt(a.W, a.H), image.Pt(b.W, b.H))
+		if !ok {
+			return &ScaleError{SizeA: image.Pt(a.W, a.H), SizeB: image.Pt(b.W, b.H)}
+		}
+		if factor != (core.ScaleFactor{Num: 1, Den: 1}) {
+			return nil
+		}
+	}
+	if opts.SizeMismatch == core.SizeMismatchError && (a.W != b.W || a.H != b.H) {
+		return &ImageSizeError{SizeA: image.Pt(a.W, a.H), SizeB: image.Pt(b.W, b.H)}
+	}
+	factor := core.AspectFactor(a, b)
+	if !opts.Align.StrictDimensions || opts.Align.MaxAspectFactor <= 0 || factor <= opts.Align.MaxAspectFactor {
+		return nil
+	}
+	return &AspectRatioError{SizeA: image.Pt(a.W, a.H), SizeB: image.Pt(b.W, b.H), Factor: factor, Max: opts.Align.MaxAspectFactor}
+}
+
+// chooseOrientation returns frame A unchanged unless the aspect ratios differ
+// by more than MaxAspectFactor (and StrictDimensions is off). Then frame A and
+// its 90 degree rotations are aligned against B and the best scoring
+// orientation wins.
+func chooseOrientation(a, b *core.Frame, opts core.Options, logger *slog.Logger) (*core.Frame, core.Orientation) {
+	factor := core.AspectFactor(a, b)
+	if opts.Align.StrictDimensions || opts.Align.MaxAspectFactor <= 0 || factor <= opts.Align.MaxAspectFactor {
+		return a, core.OrientationOriginal
+	}
+
+	quietLogger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	best, bestOrientation, bestScore := a, core.OrientationOriginal, -1.0
+	for _, o := range []core.Orientation{core.OrientationOriginal, core.OrientationRotateCW, core.OrientationRotateCCW} {
+		candidate := a.Rotate(o)
+		score := align.Align(candidate, b, opts.Align, opts.Runtime.Workers, quietLogger).Score
+		if score > bestScore {
+			best, bestOrientation, bestScore = candidate, o, score
+		}
+	}
+	logger.Warn("aspect ratios differ; compared the best scoring orientation of input1",
+		"factor", factor,
+		"maxFactor", opts.Align.MaxAspectFactor,
+		"orientation", orientationName(bestOrientation),
+		"score", bestScore,
+	)
+	return best, bestOrientation
+}
+
+func orientationName(o core.Orientation) string {
+	if o == core.OrientationOriginal {
+		return "original"
+	}
+	return string(o)
+}
+
+// Compare aligns two frames, builds the diff mask, extracts regions and, unless
+// maskOnly is set, renders the annotated diff image. The images differ
+// (Result.HasDiff) when the differing pixels of the mask exceed the tolerance
+// in opts.Diff, whether or not they form a region, so the answer is the same
+// with and without maskOnly. It does no I/O.
+// If the aspect ratios differ too much, frame A may be rotated first (see
+// Result.Orientation). With opts.ROI only that area is compared (see
+// Result.ROI) and no rotation is tried.
+func Compare(frameA, frameB *core.Frame, opts core.Options, maskOnly bool, logger *slog.Logger) *core.Result {
+	frameA, frameB, scale := scaleFrames(frameA, frameB, opts, logger)
+	frameA, frameB, opts = padFrames(frameA, frameB, opts, logger)
+	frameB = withIgnoreMask(frameB, opts.Diff, logger)
+	histogram := core.CompareHistograms(frameA.Histogram(), frameB.Histogram())
+	original := frameA
+	if opts.Diff.Normalize {
+		frameA = frameA.Normalize(frameB)
+	}
+	if opts.Diff.Workers == 0 {
+		opts.Diff.Workers = opts.Runtime.Workers
+	}
+	if ws := opts.Runtime.Workspace; ws != nil {
+		ws.Reset()
+		opts.Diff.Workspace, opts.Region.Workspace, opts.Render.Workspace = ws, ws, ws
+	}
 	if frameA.W != frameB.W || frameA.H != frameB.H {
 		logger.Warn("image dimensions differ",
 			"input1", [2]int{frameA.W, frameA.H},
@@ -42,18 +396,137 @@ func Run(opts core.Options, exitOnDiff bool, logger *slog.Logger) (bool, error)
 		)
 	}
 
-	// 2. Align
-	alignment := align.Align(frameA, frameB, opts.Align, opts.Runtime.Workers, logger)
+	phases := newPhaseRecorder(opts.Runtime.ReportMemory)
+	var result *core.Result
+	if opts.PHashPrefilter && hashesMatch(frameA, frameB, logger) {
+		result = &core.Result{
+			FrameA:         frameA,
+			FrameB:         frameB,
+			Aligned:        core.Alignment{Score: 1},
+			RowAligned:     core.NewRowAlignmentFromAlignment(frameB.W, frameB.H, core.Alignment{}),
+			DiffMask:       opts.Diff.Workspace.NewMask(frameB.W, frameB.H),
+			Prefiltered:    true,
+			ComparedPixels: frameB.W * frameB.H,
+		}
+	} else if roi := clampROI(opts.ROI, frameA, frameB, logger); !roi.Empty() {
+		logger.Info("comparing region of interest", "roi", roi)
+		result = detect(frameA.Crop(roi), frameB.Crop(roi), opts, phases, logger)
+		result.FrameA, result.FrameB = frameA, frameB
+		result.DiffMask = result.DiffMask.Embed(frameB.W, frameB.H, roi.Min)
+		result.RowAligned = result.RowAligned.Embed(frameB.W, frameB.H, roi, result.Aligned)
+		for i := range result.RowBands {
+			result.RowBands[i] = result.RowBands[i].Add(roi.Min.Y)
+		}
+		result.ROI = roi
+	} else {
+		frameA, orientation := chooseOrientation(frameA, frameB, opts, logger)
+		result = detect(frameA, frameB, opts, phases, logger)
+		result.Orientation = orientation
+	}
+
+	result.Histogram = histogram
+	result.Scale, result.Scaled = scale, opts.AutoScale && !scale.IsZero()
+
+	// Extract regions
+	tracker := progress.Start(opts.Runtime.Progress, "regions")
+	result.Regions = region.Extract(result.DiffMask, opts.Region, logger)
+	if len(opts.Diff.IgnoreRects) > 0 {
+		result.Regions = region.Exclude(result.Regions, result.DiffMask, opts.Diff.IgnoreRects)
+	}
+	if opts.LocalAlign.Enabled {
+		result.Regions, result.LocallyAligned = diff.LocalAlign(result.FrameA, result.FrameB, result.DiffMask, result.Regions, result.Aligned, opts.LocalAlign, opts.Diff, logger)
+	}
+	result.Regions = region.Clamp(result.Regions, image.Rect(0, 0, result.FrameB.W, result.FrameB.H))
+	if opts.Region.MinPixels > 0 {
+		result.Regions, result.Suppressed = region.Suppress(result.Regions, opts.Region.MinPixels)
+		logger.Info("suppressed small regions", "suppressed", len(result.Suppressed), "minPixels", opts.Region.MinPixels)
+	}
+	region.TraceContours(result.Regions, result.DiffMask, opts.Region)
+	diff.ScoreRegions(result.FrameA, result.FrameB, result.RowAligned, result.DiffMask, result.Regions, opts.Diff)
+	region.SortBySeverity(result.Regions)
+	if result.Regions, result.DroppedRegions = region.Limit(result.Regions, opts.Region.MaxRegions); result.DroppedRegions > 0 {
+		logger.Warn("too many regions; dropping the least severe", "dropped", result.DroppedRegions, "maxRegions", opts.Region.MaxRegions)
+	}
+	result.Differs(opts.Diff)
+	if opts.Diff.Normalize {
+		// Outputs show input1 as it was, in the orientation compared.
+		result.FrameA = original.Rotate(result.Orientation)
+	}
+	tracker.Done()
+	if maskOnly {
+		phases.end("detect")
+		result.Phases = phases.samples
+		return result
+	}
+
+	// Render
+	phases.end("detect")
+	tracker = progress.Start(opts.Runtime.Progress, "render")
+	result.Output = renderDiff(result, opts, logger)
+	tracker.Done()
+	phases.end("render")
+	result.Phases = phases.samples
+
+	return result
+}
+
+// compareHistograms compares only the color histograms of the frames, for
+// Options.HistogramOnly: the result differs when their chi-square distance
+// exceeds opts.HistogramMaxDistance, and has no offset, mask or regions.
+func compareHistograms(frameA, frameB *core.Frame, opts core.Options, logger *slog.Logger) *core.Result {
+	frameB = withIgnoreMask(frameB, opts.Diff, logger)
+	d := core.CompareHistograms(frameA.Histogram(), frameB.Histogram())
+	result := &core.Result{FrameA: frameA, FrameB: frameB, Histogram: d, HasDiff: d.ChiSquare > opts.HistogramMaxDistance}
+	logger.Info("compared histograms only", "intersection", d.Intersection, "chiSquare", d.ChiSquare, "maxDistance", opts.HistogramMaxDistance, "hasDiff", result.HasDiff)
+	return result
+}
+
+// hashesMatch reports whether the frames have the same size and perceptual
+// hash, so that comparing them can be skipped.
+func hashesMatch(a, b *core.Frame, logger *slog.Logger) bool {
+	if a.W != b.W || a.H != b.H {
+		return false
+	}
+	hashA, hashB := phash.DHash(a), phash.DHash(b)
+	if phash.Distance(hashA, hashB) != 0 {
+		logger.Info("perceptual hashes differ; comparing", "hash1", fmt.Sprintf("%016x", hashA), "hash2", fmt.Sprintf("%016x", hashB))
+		return false
+	}
+	logger.Info("perceptual hashes match; skipping alignment and diff detection", "hash", fmt.Sprintf("%016x", hashA))
+	return true
+}
+
+// detect aligns the frames and builds the diff mask, refining dirty vertical
+// strips with local DP. It records the align phase.
+func detect(frameA, frameB *core.Frame, opts core.Options, phases *phaseRecorder, logger *slog.Logger) *core.Result {
+	// Align
+	alignment := align.AlignWithProgress(frameA, frameB, opts.Align, opts.Runtime.Workers, opts.Runtime.Progress, logger)
+	phases.end("align")
 	baseRowAlignment := core.NewRowAlignmentFromAlignment(frameB.W, frameB.H, alignment)
 	rowAlignment := baseRowAlignment
 
-	// 3. Build diff mask and refine dirty vertical strips with local DP.
-	mask := diff.BuildMask(frameA, frameB, baseRowAlignment, opts.Diff, logger)
+	// With scroll detection, rows only one frame has are reported as bands
+	// instead of differing pixels.
+	var rowBands []core.RowBand
+	if opts.VerticalAlign.DetectScroll {
+		rowAlignment, rowBands = align.ScrollAlign(frameA, frameB, alignment, logger)
+	}
+	clearBands := func(mask *core.Mask) *core.Mask {
+		for _, band := range rowBands {
+			mask.ClearRect(image.Rect(0, band.Y0, frameB.W, band.Y1))
+		}
+		return mask
+	}
+
+	// Build diff mask and refine dirty vertical strips with local DP.
+	mask := clearBands(diff.BuildMaskWithProgress(frameA, frameB, rowAlignment, opts.Diff, opts.Runtime.Progress, logger))
 	baseDiffPixels := mask.Count
-	if opts.VerticalAlign.Enabled && baseDiffPixels > 0 {
+	if opts.VerticalAlign.Enabled && !opts.VerticalAlign.DetectScroll && baseDiffPixels > 0 {
 		stripWidth := verticalAlignStripWidth(opts.VerticalAlign, frameB.W)
-		rowAlignment, correctedStrips := mergeRowAlignmentByStrip(frameA, frameB, alignment, baseRowAlignment, mask, opts, stripWidth)
+		var correctedStrips int
+		rowAlignment, correctedStrips = mergeRowAlignmentByStrip(frameA, frameB, alignment, baseRowAlignment, mask, opts, stripWidth)
 		if correctedStrips > 0 {
+			opts.Diff.Workspace.Release(mask)
 			mask = diff.BuildMask(frameA, frameB, rowAlignment, opts.Diff, logger)
 		}
 		logger.Info("vertical dp alignment applied per strip",
@@ -64,41 +537,311 @@ func Run(opts core.Options, exitOnDiff bool, logger *slog.Logger) (bool, error)
 		)
 	}
 
-	hasDiff := mask.Count > 0
-
-	if exitOnDiff {
-		if hasDiff {
-			logger.Info("differences detected (exit-on-diff mode)")
+	// The noise filter can remove small changes entirely; check before
+	// declaring the images identical.
+	unfiltered := false
+	if opts.Diff.VerifyClean && mask.Count == 0 && opts.Diff.MinDetectableChange() > 1 {
+		diffOpts := opts.Diff
+		diffOpts.NoiseWindowSize, diffOpts.Despeckle = 0, 0
+		if raw := clearBands(diff.BuildMask(frameA, frameB, rowAlignment, diffOpts, logger)); raw.Count > 0 {
+			logger.Warn("noise filter removed every difference; reporting them unfiltered", "diffPixels", raw.Count)
+			opts.Diff.Workspace.Release(mask)
+			mask, unfiltered = raw, true
 		} else {
-			logger.Info("no differences detected")
+			opts.Diff.Workspace.Release(raw)
 		}
-		return hasDiff, nil
 	}
 
-	// 4. Extract regions
-	regions := region.Extract(mask, opts.Region, logger)
+	mse, _ := diff.MeanSquaredError(frameA, frameB, rowAlignment)
 
-	// 5. Render
-	diffImage := render.Render(frameA, frameB, mask, regions, rowAlignment, opts.Render, logger)
+	return &core.Result{
+		FrameA:         frameA,
+		FrameB:         frameB,
+		Aligned:        alignment,
+		RowAligned:     rowAlignment,
+		RowBands:       rowBands,
+		HasDiff:        mask.Count > 0 || len(rowBands) > 0,
+		DiffMask:       mask,
+		Unfiltered:     unfiltered,
+		MSE:            mse,
+		ComparedPixels: diff.CountCompared(frameA, frameB, rowAlignment, rowBands),
+	}
+}
 
-	// 6. Apply layout
-	var outputImage image.Image = diffImage
-	if opts.Render.Layout == core.LayoutHorizontal {
+// clampROI returns roi clamped to the area both frames cover, warning if it
+// had to be clamped. It is empty if roi is, or if nothing of it remains.
+func clampROI(roi image.Rectangle, frameA, frameB *core.Frame, logger *slog.Logger) image.Rectangle {
+	if roi.Empty() {
+		return roi
+	}
+	clamped := roi.Intersect(image.Rect(0, 0, min(frameA.W, frameB.W), min(frameA.H, frameB.H)))
+	switch {
+	case clamped.Empty():
+		logger.Warn("region of interest lies outside the images; comparing the whole images", "roi", roi)
+	case clamped != roi:
+		logger.Warn("region of interest exceeds the images; clamping it", "roi", roi, "clamped", clamped)
+	}
+	return clamped
+}
+
+// renderDiff renders the annotated diff image of result, hatches the
+// uncovered bands and shades the grid cells if requested.
+func renderDiff(result *core.Result, opts core.Options, logger *slog.Logger) *image.NRGBA {
+	out := render.Render(result.FrameA, result.FrameB, result.DiffMask, result.Regions, result.RowAligned, result.Aligned, opts.Render, logger)
+	shift := opts.Render.BaseShift(result.Aligned)
+	if opts.Render.HatchUncovered {
+		bands := result.UncoveredBands()
+		for i := range bands {
+			bands[i] = bands[i].Add(shift)
+		}
+		render.HatchRects(out, bands, opts.Render.HatchColor)
+	}
+	if opts.Render.HatchIgnored && result.FrameB.Ignore != nil {
+		render.HatchMask(out, result.FrameB.Ignore, shift, opts.Render.IgnoredColor)
+	}
+	if opts.Render.GridShading && result.DiffMask != nil {
+		render.ShadeGrid(out, result.DiffMask.Grid(opts.Grid), shift, opts.Render.GridColor)
+	}
+	render.DrawRowBands(out, result.RowBands, opts.Render)
+	if !result.ROI.Empty() {
+		style := render.DefaultRegionStyle()
+		style.Color = opts.Render.ROIColor
+		style.Thickness = 1
+		style.Offset = shift
+		render.DrawRegions(out, []image.Rectangle{result.ROI}, style)
+	}
+	return out
+}
+
+// loadIgnoreMask returns opts.Ignore, or the mask loaded from
+// opts.IgnoreMaskPath if it is not set.
+func loadIgnoreMask(opts core.DiffOptions, logger *slog.Logger) (*core.Mask, error) {
+	if opts.Ignore != nil || opts.IgnoreMaskPath == "" {
+		return opts.Ignore, nil
+	}
+	frame, err := imgio.LoadFrame(opts.IgnoreMaskPath, logger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load ignore mask: %w", err)
+	}
+	return core.MaskFromImage(frame.Pix), nil
+}
+
+// padFrames pads frames of different sizes to their larger width and height
+// under SizeMismatchPad (see Frame.Pad). With PadIgnore, the padding of
+// either frame is added to the ignore rectangles of the returned options.
+func padFrames(a, b *core.Frame, opts core.Options, logger *slog.Logger) (*core.Frame, *core.Frame, core.Options) {
+	if opts.SizeMismatch != core.SizeMismatchPad || (a.W == b.W && a.H == b.H) {
+		return a, b, opts
+	}
+	w, h := max(a.W, b.W), max(a.H, b.H)
+	logger.Info("padding inputs to a common size",
+		"input1", [2]int{a.W, a.H},
+		"input2", [2]int{b.W, b.H},
+		"size", [2]int{w, h},
+	)
+	if opts.PadIgnore {
+		rects := append([]image.Rectangle(nil), opts.Diff.IgnoreRects...)
+		for _, f := range []*core.Frame{a, b} {
+			if f.W < w {
+				rects = append(rects, image.Rect(f.W, 0, w, h))
+			}
+			if f.H < h {
+				rects = append(rects, image.Rect(0, f.H, w, h))
+			}
+		}
+		opts.Diff.IgnoreRects = rects
+	}
+	return a.Pad(w, h, opts.PadColor), b.Pad(w, h, opts.PadColor), opts
+}
+
+// scaleFrames returns the ratio of the frame sizes when they differ by a
+// uniform simple ratio, and with AutoScale downsamples the larger frame to the
+// size of the smaller one. Sizes off by a pixel or two are left to
+// SizeMismatch.
+func scaleFrames(a, b *core.Frame, opts core.Options, logger *slog.Logger) (*core.Frame, *core.Frame, core.ScaleFactor) {
+	if a.W == b.W && a.H == b.H {
+		return a, b, core.ScaleFactor{}
+	}
+	factor, ok := core.DetectScale(image.Pt(a.W, a.H), image.Pt(b.W, b.H))
+	if !ok || factor.Num == factor.Den {
+		return a, b, core.ScaleFactor{}
+	}
+	if !opts.AutoScale {
+		logger.Warn("input sizes differ by a uniform scale; enable auto-scaling to compare them at the same size",
+			"scale", factor.String(),
+			"input1", [2]int{a.W, a.H},
+			"input2", [2]int{b.W, b.H},
+		)
+		return a, b, factor
+	}
+	if factor.Num > factor.Den {
+		logger.Info("downscaling input1 with a box filter to the size of input2",
+			"scale", factor.String(),
+			"from", [2]int{a.W, a.H},
+			"to", [2]int{b.W, b.H},
+		)
+		return a.Downscale(b.W, b.H), b, factor
+	}
+	logger.Info("downscaling input2 with a box filter to the size of input1",
+		"scale", factor.String(),
+		"from", [2]int{b.W, b.H},
+		"to", [2]int{a.W, a.H},
+	)
+	return a, b.Downscale(a.W, a.H), factor
+}
+
+// withIgnoreMask attaches the ignore mask and rectangles of opts to frame B,
+// scaling the mask to the frame size with a warning if needed.
+func withIgnoreMask(frameB *core.Frame, opts core.DiffOptions, logger *slog.Logger) *core.Frame {
+	if m := opts.Ignore; m != nil && (m.W != frameB.W || m.H != frameB.H) {
+		logger.Warn("ignore mask size differs from input2; scaling it",
+			"mask", [2]int{m.W, m.H},
+			"input2", [2]int{frameB.W, frameB.H},
+		)
+	}
+	for _, r := range opts.IgnoreRects {
+		if !r.Overlaps(image.Rect(0, 0, frameB.W, frameB.H)) {
+			logger.Warn("ignore rectangle lies outside input2", "rect", r, "input2", [2]int{frameB.W, frameB.H})
+		}
+	}
+	ignore := opts.IgnoreMask(frameB.W, frameB.H)
+	if ignore == nil {
+		return frameB
+	}
+	logger.Info("ignore mask applied", "ignoredPixels", ignore.Count)
+	return frameB.WithIgnore(ignore)
+}
+
+// ApplyLayout composes the final output image for the configured layout,
+// cropped to the regions with opts.Output.Crop.
+func ApplyLayout(result *core.Result, opts core.Options, logger *slog.Logger) image.Image {
+	a, b, diff := image.Image(result.FrameA.Pix), image.Image(result.FrameB.Pix), result.Output
+	if opts.Output.Crop {
+		if r, ok := render.CropRect(OutputRegions(result, opts), opts.Output.CropMargin, diff.Bounds()); ok {
+			logger.Info("cropping output to the diff regions", "rect", r)
+			a, b, diff = subImage(a, r), subImage(b, r), subImage(diff, r)
+		} else {
+			logger.Info("no diff regions to crop to, keeping the full image")
+		}
+	}
+
+	switch opts.Render.Layout {
+	case core.LayoutHorizontal:
 		logger.Info("applying horizontal layout")
-		outputImage = render.CombineHorizontal(frameA.Pix, diffImage)
+		return render.CombineHorizontal(a, diff)
+	case core.LayoutSideBySide:
+		logger.Info("applying side-by-side layout")
+		compositeOpts := render.DefaultCompositeOptions()
+		if opts.Render.Captions {
+			compositeOpts.Captions = []string{panelCaption(opts.Input1, "A"), panelCaption(opts.Input2, "B"), "diff"}
+		} else {
+			compositeOpts.Captions = nil
+		}
+		return render.RenderComposite(a, b, diff, compositeOpts)
 	}
+	return diff
+}
+
+// OutputRegions returns the regions of result in the coordinates of the
+// rendered diff image, which differ from those of B when it is drawn on A.
+func OutputRegions(result *core.Result, opts core.Options) []core.Region {
+	shift := opts.Render.BaseShift(result.Aligned)
+	if shift == (image.Point{}) {
+		return result.Regions
+	}
+	regions := make([]core.Region, len(result.Regions))
+	for i, r := range result.Regions {
+		r.Bounds = r.Bounds.Add(shift)
+		regions[i] = r
+	}
+	return regions
+}
+
+// subImage returns the part r of img, clamped to it, keeping its coordinates.
+func subImage(img image.Image, r image.Rectangle) image.Image {
+	if s, ok := img.(interface {
+		SubImage(image.Rectangle) image.Image
+	}); ok {
+		return s.SubImage(r)
+	}
+	return img
+}
 
-	// 7. Save
-	if opts.Output.Path != "" {
-		if err := imgio.SaveImage(outputImage, opts.Output.Path, logger); err != nil {
-			return hasDiff, fmt.Errorf("failed to save output: %w", err)
+// saveRegionCrops writes one crop of the diff image per region, grown by
+// opts.Output.CropMargin, into opts.Output.CropDir as region-001.png and so on.
+func saveRegionCrops(result *core.Result, opts core.Options, logger *slog.Logger) error {
+	if err := os.MkdirAll(opts.Output.CropDir, 0o755); err != nil {
+		return fmt.Errorf("failed to create crop directory: %w", err)
+	}
+	for i, region := range OutputRegions(result, opts) {
+		r, _ := render.CropRect([]core.Region{region}, opts.Output.CropMargin, result.Output.Bounds())
+		path := filepath.Join(opts.Output.CropDir, fmt.Sprintf("region-%03d.png", i+1))
+		if err := saveImage(subImage(result.Output, r), path, opts, logger); err != nil {
+			return fmt.Errorf("failed to save region crop: %w", err)
 		}
 	}
+	return nil
+}
 
-	elapsed := time.Since(startTime)
-	logger.Info("pipeline complete", "elapsed", elapsed.Round(time.Millisecond), "hasDiff", hasDiff, "regions", len(regions))
+func panelCaption(path, fallback string) string {
+	if path == "" {
+		return fallback
+	}
+	return filepath.Base(path)
+}
+
+// phaseRecorder samples timing and memory at phase boundaries when enabled.
+type phaseRecorder struct {
+	enabled bool
+	start   time.Time
+	samples []core.PhaseSample
+}
 
-	return hasDiff, nil
+func newPhaseRecorder(enabled bool) *phaseRecorder {
+	return &phaseRecorder{enabled: enabled, start: time.Now()}
+}
+
+// end records the phase that started at the previous boundary.
+func (p *phaseRecorder) end(phase string) {
+	if !p.enabled {
+		return
+	}
+	p.samples = append(p.samples, core.SamplePhase(phase, p.start))
+	p.start = time.Now()
+}
+
+// restart begins the next phase now.
+func (p *phaseRecorder) restart() {
+	p.start = time.Now()
+}
+
+func logPhases(samples []core.PhaseSample, logger *slog.Logger) {
+	const mib = 1 << 20
+	for _, s := range samples {
+		logger.Info("phase timing and go memory",
+			"phase", s.Phase,
+			"duration", progress.FormatDuration(s.Duration),
+			"goHeapAllocMiB", float64(s.HeapAlloc)/mib,
+			"goTotalAllocMiB", float64(s.TotalAlloc)/mib,
+			"goSysMiB", float64(s.Sys)/mib,
+		)
+	}
+}
+
+// scoreSurfaceCellSize is the pixel size of one offset cell in the score surface PNG.
+const scoreSurfaceCellSize = 8
+
+func saveScoreSurface(a, b *core.Frame, alignment core.Alignment, opts core.Options, logger *slog.Logger) error {
+	logger.Info("pyramid search scores only a sparse set of offsets; computing the score surface with an exhaustive full-resolution scan",
+		"maxOffsetX", opts.Align.MaxOffsetX,
+		"maxOffsetY", opts.Align.MaxOffsetY,
+	)
+	surface := align.ScoreSurface(a, b, alignment, max(opts.Align.MaxOffsetX, opts.Align.MaxOffsetY), opts.Align.Metric, opts.Runtime.Workers)
+	img := render.RenderScoreSurface(surface, scoreSurfaceCellSize)
+	if err := saveImage(img, opts.Output.ScoreSurfacePath, opts, logger); err != nil {
+		return fmt.Errorf("failed to save score surface: %w", err)
+	}
+	return nil
 }
 
 func verticalAlignStripWidth(opts core.VerticalAlignOptions, frameWidth int) int {
@@ -115,9 +858,12 @@ func mergeRowAlignmentByStrip(a, b *core.Frame, global core.Alignment, base core
 	merged := base.Clone()
 	quietLogger := slog.New(slog.NewTextHandler(io.Discard, nil))
 	correctedStrips := 0
+	tracker := progress.Start(opts.Runtime.Progress, "vertical-align")
+	defer tracker.Done()
 
 	for minX := 0; minX < b.W; minX += stripWidth {
 		maxX := min(b.W, minX+stripWidth)
+		tracker.Update(minX, b.W)
 		baseStripDiffPixels := countMaskPixelsInColumns(baseMask, minX, maxX)
 		if baseStripDiffPixels == 0 {
 			continue
@@ -126,6 +872,7 @@ func mergeRowAlignmentByStrip(a, b *core.Frame, global core.Alignment, base core
 		candidate := align.VerticalDPAlignInRange(a, b, global, opts.VerticalAlign, minX, maxX, quietLogger)
 		candidateMask := diff.BuildMask(a, b, candidate, opts.Diff, quietLogger)
 		candidateStripDiffPixels := countMaskPixelsInColumns(candidateMask, minX, maxX)
+		opts.Diff.Workspace.Release(candidateMask)
 		if candidateStripDiffPixels >= baseStripDiffPixels {
 			continue
 		}
@@ -0,0 +1,106 @@
+package app
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/xshoji/go-img-diff/internal/core"
+)
+
+// makePage draws a 320x320 page of horizontal rules. With inserted, a 40 px
+// section is inserted at y=100, the rules below it move down and a box
+// changes above it.
+func makePage(inserted bool) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, 320, 320))
+	for y := 0; y < 320; y++ {
+		for x := 0; x < 320; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{255, 255, 255, 255})
+		}
+	}
+	for y := 20; y < 300; y += 18 {
+		top := y
+		if inserted && y >= 100 {
+			top += 40
+		}
+		for yy := top; yy < min(top+4, 320); yy++ {
+			for x := 24; x < 280; x++ {
+				img.SetNRGBA(x, yy, color.NRGBA{40, 40, 40, 255})
+			}
+		}
+	}
+	if inserted {
+		for y := 30; y < 70; y++ {
+			for x := 100; x < 200; x++ {
+				img.SetNRGBA(x, y, color.NRGBA{200, 30, 30, 255})
+			}
+		}
+		for y := 100; y < 140; y++ {
+			for x := 0; x < 320; x++ {
+				img.SetNRGBA(x, y, color.NRGBA{255, 241, 214, 255})
+			}
+		}
+	}
+	return img
+}
+
+func writePage(t *testing.T, path string, img image.Image) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := png.Encode(f, img); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRun_RendersWithRefinedRowAlignment(t *testing.T) {
+	dir := t.TempDir()
+	opts := core.DefaultOptions()
+	opts.Input1, opts.Input2 = filepath.Join(dir, "a.png"), filepath.Join(dir, "b.png")
+	// An opaque untinted overlay copies the input1 pixel the row alignment
+	// picks, so the diff image shows which alignment Render was given.
+	opts.Render.OverlayAlpha = 0
+	opts.Render.TintEnabled = false
+	pageA := makePage(false)
+	writePage(t, opts.Input1, pageA)
+	writePage(t, opts.Input2, makePage(true))
+
+	result, err := Run(opts, false, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := core.NewRowAlignmentFromAlignment(320, 320, result.Aligned)
+	if reflect.DeepEqual(result.RowAligned, base) {
+		t.Fatal("the result carries the global row alignment, not the refined one")
+	}
+
+	out := result.Output.(*image.NRGBA)
+	refined := 0
+	for y := 0; y < 320; y++ {
+		for x := 0; x < 320; x++ {
+			src, baseSrc := result.RowAligned.SrcYAt(x, y), base.SrcYAt(x, y)
+			if !result.DiffMask.Get(x, y) || src == -1 || baseSrc == -1 {
+				continue
+			}
+			want := pageA.NRGBAAt(x-result.RowAligned.DXAt(x, y), src)
+			if want == pageA.NRGBAAt(x-base.DXAt(x, y), baseSrc) {
+				continue
+			}
+			if out.NRGBAAt(x, y) == want {
+				refined++
+			}
+		}
+	}
+	if refined == 0 {
+		t.Error("no diff pixel was drawn from the refined row alignment")
+	}
+}
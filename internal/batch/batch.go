@@ -0,0 +1,264 @@
+// Package batch compares many pairs of images on a shared pool of workers:
+// the files of two directory trees matched by relative path, or the pairs
+// listed in a manifest.
+package batch
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/xshoji/go-img-diff/internal/app"
+	"github.com/xshoji/go-img-diff/internal/core"
+	"github.com/xshoji/go-img-diff/internal/imgio"
+	"github.com/xshoji/go-img-diff/internal/progress"
+	"github.com/xshoji/go-img-diff/internal/report"
+)
+
+// Pair is an image found under the same relative path in both directories,
+// or an entry of a manifest.
+type Pair struct {
+	Name         string // relative path with forward slashes
+	Path1, Path2 string
+
+	// Output is the diff image of a manifest pair, written instead of the
+	// one under Options.OutDir.
+	Output    string
+	Overrides Overrides
+}
+
+// Listing is the outcome of matching two directories or reading a manifest.
+type Listing struct {
+	Pairs    []Pair
+	OnlyIn1  []string // relative paths missing in the second directory
+	OnlyIn2  []string // relative paths missing in the first directory
+	Dir1     string
+	Dir2     string
+	Manifest string // path of the manifest the pairs were read from
+}
+
+// Match lists the PNG and JPEG files under dir1 and dir2 (recursively) and
+// pairs them by relative path. All lists are sorted by name.
+func Match(dir1, dir2 string) (*Listing, error) {
+	files1, err := listImages(dir1)
+	if err != nil {
+		return nil, err
+	}
+	files2, err := listImages(dir2)
+	if err != nil {
+		return nil, err
+	}
+	l := &Listing{Dir1: dir1, Dir2: dir2}
+	for _, name := range sortedKeys(files1) {
+		if _, ok := files2[name]; ok {
+			l.Pairs = append(l.Pairs, Pair{Name: name, Path1: files1[name], Path2: files2[name]})
+		} else {
+			l.OnlyIn1 = append(l.OnlyIn1, name)
+		}
+	}
+	for _, name := range sortedKeys(files2) {
+		if _, ok := files1[name]; !ok {
+			l.OnlyIn2 = append(l.OnlyIn2, name)
+		}
+	}
+	return l, nil
+}
+
+// listImages maps the relative path of every image under dir to its path.
+func listImages(dir string) (map[string]string, error) {
+	files := map[string]string{}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !imgio.IsSupportedImagePath(path) {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = path
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list images in %s: %w", dir, err)
+	}
+	return files, nil
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Options configures a batch run.
+type Options struct {
+	// Compare is applied to every pair; its inputs and output paths are
+	// replaced per pair (only the crop, write and encoding settings are kept).
+	Compare core.Options
+
+	// OutDir receives the diff image and JSON report of each pair under its
+	// relative path (the report as <name>.json); empty writes nothing. Pairs
+	// with an Output write there instead, with the report as <output>.json.
+	OutDir string
+
+	// PreviousDir is the OutDir of an earlier run: the regions of each pair
+	// are classified against its <name>.json there, if present.
+	PreviousDir string
+
+	// Jobs is the number of pairs compared concurrently, each with
+	// Compare.Runtime.Workers workers.
+	Jobs int
+
+	// FailFast stops at the first pair that cannot be compared: pairs not
+	// started by then fail with ErrSkipped. By default every pair is
+	// compared whatever the others' errors.
+	FailFast bool
+}
+
+// ErrSkipped is the error of the pairs left uncompared by Options.FailFast.
+var ErrSkipped = errors.New("not compared: an earlier pair failed")
+
+// PairResult is the outcome of one pair.
+type PairResult struct {
+	Pair
+	Report *report.Report // nil if Err is set
+	Err    error
+}
+
+// Summary returns the gate summary of the pair.
+func (r PairResult) Summary() report.PairSummary {
+	if r.Err != nil {
+		return report.PairSummary{Name: r.Name, Error: r.Err.Error(), ErrorKind: imgio.KindOf(r.Err)}
+	}
+	return r.Report.Summarize(r.Name)
+}
+
+// Run compares every pair on opts.Jobs concurrent jobs and returns the
+// results in the order of pairs. onDone, if set, is called after each pair
+// from the job that compared it, so calls may be concurrent; it is not called
+// for pairs skipped by opts.FailFast. Each job reuses one core.Workspace for
+// all of its pairs.
+func Run(pairs []Pair, opts Options, logger *slog.Logger, onDone func(PairResult)) []PairResult {
+	results := make([]PairResult, len(pairs))
+	next := make(chan int)
+	var failed atomic.Bool
+	var wg sync.WaitGroup
+	for range max(1, min(opts.Jobs, len(pairs))) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ws := core.NewWorkspace()
+			for i := range next {
+				if opts.FailFast && failed.Load() {
+					results[i] = PairResult{Pair: pairs[i], Err: ErrSkipped}
+					continue
+				}
+				results[i] = comparePair(pairs[i], opts, ws, logger.With("pair", pairs[i].Name))
+				if results[i].Err != nil {
+					failed.Store(true)
+				}
+				if onDone != nil {
+					onDone(results[i])
+				}
+			}
+		}()
+	}
+	for i := range pairs {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	return results
+}
+
+// comparePair runs the pipeline on one pair, with the buffers of ws, and
+// builds its report.
+func comparePair(p Pair, opts Options, ws *core.Workspace, logger *slog.Logger) PairResult {
+	o := p.Overrides.Apply(opts.Compare)
+	o.Input1, o.Input2 = p.Path1, p.Path2
+	o.Output = core.OutputOptions{DirectWrite: o.Output.DirectWrite, NoOverwrite: o.Output.NoOverwrite, NoMkdir: o.Output.NoMkdir, SkipIdentical: o.Output.SkipIdentical, JPEGQuality: o.Output.JPEGQuality, PNGCompression: o.Output.PNGCompression, Crop: o.Output.Crop, CropMargin: o.Output.CropMargin}
+	o.Runtime.Progress = progress.Silent{}
+	o.Runtime.Workspace = ws
+	switch {
+	case p.Output != "":
+		o.Output.Path = p.Output
+	case opts.OutDir != "":
+		o.Output.Path = filepath.Join(opts.OutDir, filepath.FromSlash(p.Name))
+	}
+	if o.Output.Path != "" {
+		if err := os.MkdirAll(filepath.Dir(o.Output.Path), 0o755); err != nil {
+			return PairResult{Pair: p, Err: fmt.Errorf("failed to create output directory: %w", err)}
+		}
+	}
+
+	result, err := app.Run(o, false, logger)
+	if err != nil {
+		return PairResult{Pair: p, Err: err}
+	}
+	rep := report.Build(o, result)
+	if opts.PreviousDir != "" {
+		prevPath := reportPath(opts.PreviousDir, p.Name)
+		prev, err := report.Load(prevPath)
+		switch {
+		case err == nil:
+			rep.CompareWith(prev, prevPath)
+		case !errors.Is(err, fs.ErrNotExist):
+			return PairResult{Pair: p, Err: err}
+		}
+	}
+	if o.Output.Path != "" {
+		if err := rep.Save(o.Output.Path+".json", imgio.OutputWriteMode(o.Output)); err != nil {
+			return PairResult{Pair: p, Err: err}
+		}
+	}
+	return PairResult{Pair: p, Report: rep}
+}
+
+// reportPath returns the path of the JSON report of pair name under dir.
+func reportPath(dir, name string) string {
+	return filepath.Join(dir, filepath.FromSlash(name)+".json")
+}
+
+// Report aggregates the results of the pairs of l, with the files found in
+// only one directory as failing pairs, and evaluates gate over them. The
+// worker fields are left to the caller.
+func (l *Listing) Report(results []PairResult, gate report.Gate) *report.BatchReport {
+	r := &report.BatchReport{
+		SchemaVersion: report.SchemaVersion,
+		Dir1:          l.Dir1,
+		Dir2:          l.Dir2,
+		Manifest:      l.Manifest,
+		OnlyInDir1:    append([]string{}, l.OnlyIn1...),
+		OnlyInDir2:    append([]string{}, l.OnlyIn2...),
+	}
+	for _, res := range results {
+		s := res.Summary()
+		if s.Error == "" {
+			r.PairsCompared++
+			if s.HasDiff {
+				r.PairsWithDiff++
+			}
+		}
+		r.Pairs = append(r.Pairs, s)
+	}
+	for _, name := range l.OnlyIn1 {
+		r.Pairs = append(r.Pairs, report.PairSummary{Name: name, Error: report.MissingError(l.Dir2), ErrorKind: imgio.ErrorKindNotFound})
+	}
+	for _, name := range l.OnlyIn2 {
+		r.Pairs = append(r.Pairs, report.PairSummary{Name: name, Error: report.MissingError(l.Dir1), ErrorKind: imgio.ErrorKindNotFound})
+	}
+	r.Gate = gate.Evaluate(r.Pairs)
+	return r
+}
@@ -0,0 +1,200 @@
+package batch
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync/atomic"
+	"testing"
+
+	"github.com/xshoji/go-img-diff/internal/core"
+	"github.com/xshoji/go-img-diff/internal/imgio"
+	"github.com/xshoji/go-img-diff/internal/report"
+)
+
+func testLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+// writeImage writes a 120x90 gradient to dir/name, with changes painted white.
+func writeImage(t *testing.T, dir, name string, changes ...image.Rectangle) {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, 120, 90))
+	for y := 0; y < 90; y++ {
+		for x := 0; x < 120; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{uint8(2 * x), uint8(2 * y), 100, 255})
+		}
+	}
+	for _, r := range changes {
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				img.SetNRGBA(x, y, color.NRGBA{255, 255, 255, 255})
+			}
+		}
+	}
+	path := filepath.Join(dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := png.Encode(f, img); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// fixture creates two directories: one identical pair, one differing pair in
+// a subdirectory, a file only in each directory and a non-image file.
+func fixture(t *testing.T) (dir1, dir2 string) {
+	root := t.TempDir()
+	dir1, dir2 = filepath.Join(root, "before"), filepath.Join(root, "after")
+	writeImage(t, dir1, "home.png")
+	writeImage(t, dir2, "home.png")
+	writeImage(t, dir1, "sub/login.png")
+	writeImage(t, dir2, "sub/login.png", image.Rect(40, 30, 60, 50))
+	writeImage(t, dir1, "removed.png")
+	writeImage(t, dir2, "added.png")
+	if err := os.WriteFile(filepath.Join(dir1, "notes.txt"), []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return dir1, dir2
+}
+
+func TestMatch(t *testing.T) {
+	dir1, dir2 := fixture(t)
+	l, err := Match(dir1, dir2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, p := range l.Pairs {
+		names = append(names, p.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"home.png", "sub/login.png"}) {
+		t.Errorf("pairs = %v", names)
+	}
+	if !reflect.DeepEqual(l.OnlyIn1, []string{"removed.png"}) || !reflect.DeepEqual(l.OnlyIn2, []string{"added.png"}) {
+		t.Errorf("only in dir1 = %v, only in dir2 = %v", l.OnlyIn1, l.OnlyIn2)
+	}
+	if _, err := Match(filepath.Join(dir1, "missing"), dir2); err == nil {
+		t.Error("Match of a missing directory succeeded")
+	}
+}
+
+func TestRun(t *testing.T) {
+	dir1, dir2 := fixture(t)
+	out := filepath.Join(t.TempDir(), "out")
+	l, err := Match(dir1, dir2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts := Options{Compare: core.DefaultOptions(), OutDir: out, Jobs: 2}
+	opts.Compare.Runtime.Workers = 1
+	var done atomic.Int32
+	results := Run(l.Pairs, opts, testLogger(), func(PairResult) { done.Add(1) })
+	if done.Load() != 2 || len(results) != 2 {
+		t.Fatalf("done = %d, results = %d, want 2 each", done.Load(), len(results))
+	}
+	for _, r := range results {
+		if r.Err != nil {
+			t.Fatalf("%s: %v", r.Name, r.Err)
+		}
+		for _, path := range []string{filepath.Join(out, filepath.FromSlash(r.Name)), reportPath(out, r.Name)} {
+			if _, err := os.Stat(path); err != nil {
+				t.Errorf("%s: %v", r.Name, err)
+			}
+		}
+	}
+	if results[0].Report.HasDiff || !results[1].Report.HasDiff {
+		t.Errorf("hasDiff = %v, %v, want false, true", results[0].Report.HasDiff, results[1].Report.HasDiff)
+	}
+
+	rep := l.Report(results, report.Gate{})
+	if rep.PairsCompared != 2 || rep.PairsWithDiff != 1 || len(rep.Pairs) != 4 {
+		t.Errorf("compared=%d withDiff=%d pairs=%d, want 2, 1, 4", rep.PairsCompared, rep.PairsWithDiff, len(rep.Pairs))
+	}
+	// The differing pair and both missing files fail the default gate.
+	if rep.Gate.Passed || rep.Gate.FailedPairs != 3 {
+		t.Errorf("gate = %+v, want failed with 3 failing pairs", rep.Gate)
+	}
+	if rep := l.Report(results, report.Gate{MaxFailedPairs: 3}); !rep.Gate.Passed {
+		t.Errorf("gate = %+v, want passed with 3 failures tolerated", rep.Gate)
+	}
+
+	// Compared with the first run, the regions recur: a new-only gate that
+	// tolerates the missing files passes.
+	opts.OutDir, opts.PreviousDir = "", out
+	results = Run(l.Pairs, opts, testLogger(), nil)
+	if c := results[1].Report.Comparison; c == nil || c.New != 0 || c.Recurring != 1 {
+		t.Fatalf("comparison = %+v, want 1 recurring region", c)
+	}
+	if rep := l.Report(results, report.Gate{MaxFailedPairs: 2, NewOnly: true}); !rep.Gate.Passed {
+		t.Errorf("gate = %+v, want passed without new regions", rep.Gate)
+	}
+}
+
+func TestRun_LoadError(t *testing.T) {
+	dir1, dir2 := fixture(t)
+	if err := os.WriteFile(filepath.Join(dir2, "home.png"), []byte("not a png"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	l, err := Match(dir1, dir2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := Run(l.Pairs, Options{Compare: core.DefaultOptions(), Jobs: 1}, testLogger(), nil)
+	if results[0].Err == nil || results[0].Summary().Error == "" {
+		t.Errorf("home.png: err = %v, want a load error", results[0].Err)
+	}
+	if results[1].Err != nil {
+		t.Errorf("sub/login.png: %v", results[1].Err)
+	}
+}
+
+func TestRun_FailFast(t *testing.T) {
+	dir := t.TempDir()
+	writeImage(t, dir, "a1.png")
+	writeImage(t, dir, "a2.png", image.Rect(40, 30, 60, 50))
+	pairs := []Pair{
+		{Name: "a", Path1: filepath.Join(dir, "a1.png"), Path2: filepath.Join(dir, "a2.png")},
+		{Name: "missing", Path1: filepath.Join(dir, "a1.png"), Path2: filepath.Join(dir, "missing.png")},
+		{Name: "c", Path1: filepath.Join(dir, "a1.png"), Path2: filepath.Join(dir, "a1.png")},
+	}
+
+	// By default the pairs after the failing one are still compared.
+	results := Run(pairs, Options{Compare: core.DefaultOptions(), Jobs: 1}, testLogger(), nil)
+	rep := (&Listing{Pairs: pairs}).Report(results, report.Gate{})
+	if rep.PairsCompared != 2 || rep.PairsWithDiff != 1 {
+		t.Errorf("default: %d compared, %d with diff; want 2 and 1", rep.PairsCompared, rep.PairsWithDiff)
+	}
+	if s := rep.Pairs[1]; s.Error == "" || s.ErrorKind != imgio.ErrorKindNotFound {
+		t.Errorf("default: missing pair = %+v, want a not_found error", s)
+	}
+	if rep.Pairs[0].ErrorKind != "" || rep.Pairs[2].Error != "" {
+		t.Errorf("default: pairs = %+v, want only the missing pair to fail", rep.Pairs)
+	}
+
+	// With FailFast the pairs after it are skipped.
+	var done atomic.Int32
+	results = Run(pairs, Options{Compare: core.DefaultOptions(), Jobs: 1, FailFast: true}, testLogger(), func(PairResult) { done.Add(1) })
+	if results[0].Err != nil || imgio.KindOf(results[1].Err) != imgio.ErrorKindNotFound || !errors.Is(results[2].Err, ErrSkipped) {
+		t.Errorf("fail fast: errors %v, %v, %v; want nil, not found, skipped", results[0].Err, results[1].Err, results[2].Err)
+	}
+	if done.Load() != 2 {
+		t.Errorf("fail fast: onDone called %d times, want 2", done.Load())
+	}
+	rep = (&Listing{Pairs: pairs}).Report(results, report.Gate{})
+	if rep.PairsCompared != 1 || rep.Pairs[2].Error == "" || rep.Pairs[2].ErrorKind != "" || rep.Gate.FailedPairs != 3 {
+		t.Errorf("fail fast: report = %+v, want 1 pair compared and 3 failing", rep)
+	}
+}
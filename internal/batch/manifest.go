@@ -0,0 +1,282 @@
+package batch
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/xshoji/go-img-diff/internal/core"
+	"github.com/xshoji/go-img-diff/internal/imgio"
+)
+
+// Entry is one pair of a manifest as written in the file. Paths are relative
+// to the directory of the manifest unless absolute.
+type Entry struct {
+	Input1 string `json:"input1"`
+	Input2 string `json:"input2"`
+	Output string `json:"output"`
+
+	// Threshold, MaxOffset and IgnoreRects (X,Y,W,H each) override the
+	// options of the pair; see Overrides.
+	Threshold   *int     `json:"threshold,omitempty"`
+	MaxOffset   *int     `json:"max_offset,omitempty"`
+	IgnoreRects []string `json:"ignore_rects,omitempty"`
+
+	Line int `json:"-"` // line of the entry in the manifest
+}
+
+// Overrides are the options of one manifest pair that differ from the
+// options of the run.
+type Overrides struct {
+	Threshold   *uint8 // replaces DiffOptions.Threshold
+	MaxOffset   *int   // replaces AlignOptions.MaxOffsetX and MaxOffsetY
+	IgnoreRects []image.Rectangle
+}
+
+// Apply returns o with the overrides merged in. IgnoreRects are added to
+// those of o rather than replacing them, so areas ignored for the whole run
+// stay ignored.
+func (ov Overrides) Apply(o core.Options) core.Options {
+	if ov.Threshold != nil {
+		o.Diff.Threshold = *ov.Threshold
+	}
+	if ov.MaxOffset != nil {
+		o.Align.MaxOffsetX, o.Align.MaxOffsetY = *ov.MaxOffset, *ov.MaxOffset
+	}
+	if len(ov.IgnoreRects) > 0 {
+		o.Diff.IgnoreRects = append(append([]image.Rectangle{}, o.Diff.IgnoreRects...), ov.IgnoreRects...)
+	}
+	return o
+}
+
+// manifestColumns are the CSV columns; the header row names them in any order
+// and only input1 and input2 are required. ignore_rects holds rectangles
+// separated by ';'.
+var manifestColumns = []string{"input1", "input2", "output", "threshold", "max_offset", "ignore_rects"}
+
+// ReadManifest reads the pairs of a manifest: a JSON array of entries, or a
+// CSV file with a header row if path ends in .csv. Every entry is validated
+// before any pair is compared: the inputs must exist, outputs must be
+// supported images and unique, and overrides must be in range for metric.
+// All problems are returned at once, each prefixed with its line.
+// requireOutput makes the output of every entry mandatory.
+func ReadManifest(path string, metric core.ColorMetric, requireOutput bool) (*Listing, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+	var entries []Entry
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		entries, err = parseManifestCSV(data)
+	} else {
+		entries, err = parseManifestJSON(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s:%w", path, err)
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("%s: the manifest lists no pairs", path)
+	}
+
+	l := &Listing{Manifest: path}
+	dir := filepath.Dir(path)
+	var errs []error
+	outputs := map[string]int{}
+	for _, e := range entries {
+		p, problems := e.pair(dir, metric, requireOutput)
+		if prev, ok := outputs[p.Output]; ok && p.Output != "" {
+			problems = append(problems, fmt.Sprintf("output %s is also written by the pair on line %d", e.Output, prev))
+		} else if p.Output != "" {
+			outputs[p.Output] = e.Line
+		}
+		for _, msg := range problems {
+			errs = append(errs, fmt.Errorf("%s:%d: %s", path, e.Line, msg))
+		}
+		l.Pairs = append(l.Pairs, p)
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return l, nil
+}
+
+// pair validates e and resolves it into a pair, returning every problem found.
+// The pair is named after its output, or its second input without one.
+func (e Entry) pair(dir string, metric core.ColorMetric, requireOutput bool) (Pair, []string) {
+	var problems []string
+	resolve := func(p string) string {
+		if p == "" || filepath.IsAbs(p) {
+			return p
+		}
+		return filepath.Join(dir, p)
+	}
+	p := Pair{Name: e.Output, Path1: resolve(e.Input1), Path2: resolve(e.Input2), Output: resolve(e.Output)}
+	if p.Name == "" {
+		p.Name = e.Input2
+	}
+
+	for _, in := range []struct{ field, path string }{{"input1", p.Path1}, {"input2", p.Path2}} {
+		if in.path == "" {
+			problems = append(problems, in.field+" is required")
+		} else if _, err := os.Stat(in.path); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", in.field, err))
+		}
+	}
+	switch {
+	case e.Output == "" && requireOutput:
+		problems = append(problems, "output is required")
+	case e.Output != "" && !imgio.IsSupportedImagePath(e.Output):
+		problems = append(problems, fmt.Sprintf("unsupported output format %q (use .png, .jpg or .jpeg)", filepath.Ext(e.Output)))
+	}
+
+	if e.Threshold != nil {
+		if *e.Threshold < 0 || *e.Threshold > metric.MaxThreshold() {
+			problems = append(problems, fmt.Sprintf("threshold must be between 0 and %d for color metric %s", metric.MaxThreshold(), metric))
+		} else {
+			t := uint8(*e.Threshold)
+			p.Overrides.Threshold = &t
+		}
+	}
+	if e.MaxOffset != nil {
+		if *e.MaxOffset < 0 {
+			problems = append(problems, "max_offset must not be negative")
+		} else {
+			p.Overrides.MaxOffset = e.MaxOffset
+		}
+	}
+	for _, s := range e.IgnoreRects {
+		r, err := core.ParseRect(s)
+		if err != nil {
+			problems = append(problems, err.Error())
+			continue
+		}
+		p.Overrides.IgnoreRects = append(p.Overrides.IgnoreRects, r)
+	}
+	return p, problems
+}
+
+// parseManifestJSON decodes a JSON array of entries, recording the line each
+// starts on. Unknown fields are rejected to catch misspelt overrides.
+func parseManifestJSON(data []byte) ([]Entry, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	fail := func(err error) ([]Entry, error) {
+		offset := dec.InputOffset()
+		var syntaxErr *json.SyntaxError
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &syntaxErr) {
+			offset = syntaxErr.Offset
+		} else if errors.As(err, &typeErr) {
+			offset = typeErr.Offset
+		}
+		return nil, fmt.Errorf("%d: %w", lineAt(data, offset), err)
+	}
+
+	if tok, err := dec.Token(); err != nil {
+		return fail(err)
+	} else if tok != json.Delim('[') {
+		return fail(errors.New("the manifest must be a JSON array of pairs"))
+	}
+	var entries []Entry
+	for dec.More() {
+		start := dec.InputOffset()
+		for start < int64(len(data)) && strings.ContainsRune(", \t\r\n", rune(data[start])) {
+			start++
+		}
+		var e Entry
+		if err := dec.Decode(&e); err != nil {
+			return fail(err)
+		}
+		e.Line = lineAt(data, start)
+		entries = append(entries, e)
+	}
+	if _, err := dec.Token(); err != nil {
+		return fail(err)
+	}
+	return entries, nil
+}
+
+// lineAt returns the 1-based line of the byte at offset in data.
+func lineAt(data []byte, offset int64) int {
+	offset = min(max(offset, 0), int64(len(data)))
+	return bytes.Count(data[:offset], []byte("\n")) + 1
+}
+
+// parseManifestCSV reads entries from CSV rows under a header row naming the
+// columns of manifestColumns.
+func parseManifestCSV(data []byte) ([]Entry, error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+	header, err := r.Read()
+	if err == io.EOF {
+		return nil, nil
+	} else if err != nil {
+		return nil, manifestCSVError(err)
+	}
+	column := map[string]int{}
+	for i, name := range header {
+		name = strings.TrimSpace(name)
+		known := false
+		for _, c := range manifestColumns {
+			known = known || c == name
+		}
+		if !known {
+			return nil, fmt.Errorf("1: unknown column %q (known: %s)", name, strings.Join(manifestColumns, ", "))
+		}
+		column[name] = i
+	}
+
+	var entries []Entry
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			return entries, nil
+		} else if err != nil {
+			return nil, manifestCSVError(err)
+		}
+		line, _ := r.FieldPos(0)
+		field := func(name string) string {
+			if i, ok := column[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		e := Entry{Input1: field("input1"), Input2: field("input2"), Output: field("output"), Line: line}
+		for _, num := range []struct {
+			name string
+			dst  **int
+		}{{"threshold", &e.Threshold}, {"max_offset", &e.MaxOffset}} {
+			if s := field(num.name); s != "" {
+				v, err := strconv.Atoi(s)
+				if err != nil {
+					return nil, fmt.Errorf("%d: %s '%s' is not an integer", line, num.name, s)
+				}
+				*num.dst = &v
+			}
+		}
+		for _, s := range strings.Split(field("ignore_rects"), ";") {
+			if s = strings.TrimSpace(s); s != "" {
+				e.IgnoreRects = append(e.IgnoreRects, s)
+			}
+		}
+		entries = append(entries, e)
+	}
+}
+
+// manifestCSVError prefixes a CSV syntax error with its line.
+func manifestCSVError(err error) error {
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return fmt.Errorf("%d: %w", parseErr.Line, parseErr.Err)
+	}
+	return err
+}
@@ -0,0 +1,195 @@
+package batch
+
+import (
+	"image"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/xshoji/go-img-diff/internal/core"
+	"github.com/xshoji/go-img-diff/internal/report"
+)
+
+// writeManifest writes content as dir/name and returns its path.
+func writeManifest(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReadManifest(t *testing.T) {
+	dir1, dir2 := fixture(t)
+	root := filepath.Dir(dir1)
+	want := []Pair{
+		{Name: "out/home.png", Path1: filepath.Join(dir1, "home.png"), Path2: filepath.Join(dir2, "home.png"), Output: filepath.Join(root, "out/home.png")},
+		{
+			Name: "out/login.png", Path1: filepath.Join(dir1, "sub/login.png"), Path2: filepath.Join(dir2, "sub/login.png"), Output: filepath.Join(root, "out/login.png"),
+			Overrides: Overrides{Threshold: ptr[uint8](50), MaxOffset: ptr(0), IgnoreRects: []image.Rectangle{image.Rect(0, 0, 10, 10), image.Rect(5, 5, 25, 25)}},
+		},
+	}
+
+	manifests := map[string]string{
+		"pairs.json": `[
+  {"input1": "before/home.png", "input2": "after/home.png", "output": "out/home.png"},
+  {"input1": "before/sub/login.png", "input2": "after/sub/login.png", "output": "out/login.png",
+   "threshold": 50, "max_offset": 0, "ignore_rects": ["0,0,10,10", "5,5,20,20"]}
+]`,
+		"pairs.csv": "input2,input1,output,threshold,max_offset,ignore_rects\n" +
+			"after/home.png,before/home.png,out/home.png,,,\n" +
+			`after/sub/login.png,before/sub/login.png,out/login.png,50,0,"0,0,10,10;5,5,20,20"` + "\n",
+	}
+	for name, content := range manifests {
+		t.Run(name, func(t *testing.T) {
+			l, err := ReadManifest(writeManifest(t, root, name, content), core.ColorMetricRGB, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(l.Pairs, want) {
+				t.Errorf("pairs = %+v\nwant %+v", l.Pairs, want)
+			}
+		})
+	}
+}
+
+func ptr[T any](v T) *T { return &v }
+
+func TestReadManifest_Errors(t *testing.T) {
+	dir1, _ := fixture(t)
+	root := filepath.Dir(dir1)
+	tests := []struct {
+		name, file, content string
+		want                []string // substrings of the error, one per problem
+	}{
+		{
+			name: "syntax error", file: "m.json",
+			content: "[\n  {\"input1\": \"before/home.png\",\n  \"input2\" \"after/home.png\"}\n]",
+			want:    []string{"m.json:3: invalid character"},
+		},
+		{
+			name: "misspelt override", file: "m.json",
+			content: "[\n  {\"input1\": \"before/home.png\", \"input2\": \"after/home.png\", \"output\": \"o.png\",\n   \"treshold\": 10}\n]",
+			want:    []string{`m.json:`, `unknown field "treshold"`},
+		},
+		{
+			name: "not an array", file: "m.json", content: `{"input1": "a.png"}`,
+			want: []string{"m.json:1: the manifest must be a JSON array of pairs"},
+		},
+		{
+			name: "empty", file: "m.json", content: "[]",
+			want: []string{"m.json: the manifest lists no pairs"},
+		},
+		{
+			name: "every problem with its line", file: "m.json",
+			content: `[
+  {"input1": "before/home.png", "input2": "after/home.png", "output": "out/a.png"},
+  {"input1": "before/missing.png", "output": "out/b.gif"},
+  {
+    "input1": "before/home.png", "input2": "after/home.png", "output": "out/a.png",
+    "threshold": 300, "max_offset": -1, "ignore_rects": ["1,2,3"]
+  }
+]`,
+			want: []string{
+				"m.json:3: input1: stat", "m.json:3: input2 is required", `m.json:3: unsupported output format ".gif"`,
+				"m.json:4: output out/a.png is also written by the pair on line 2",
+				"m.json:4: threshold must be between 0 and 255", "m.json:4: max_offset must not be negative",
+				"m.json:4: invalid rectangle '1,2,3'",
+			},
+		},
+		{
+			name: "csv unknown column", file: "m.csv", content: "input1,input2,treshold\n",
+			want: []string{`m.csv:1: unknown column "treshold"`},
+		},
+		{
+			name: "csv problems", file: "m.csv",
+			content: "input1,input2,output,threshold\nbefore/home.png,after/home.png,o.png,x\n",
+			want:    []string{"m.csv:2: threshold 'x' is not an integer"},
+		},
+		{
+			name: "csv missing output", file: "m.csv",
+			content: "input1,input2\nbefore/home.png,after/home.png\n",
+			want:    []string{"m.csv:2: output is required"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ReadManifest(writeManifest(t, root, tt.file, tt.content), core.ColorMetricRGB, true)
+			if err == nil {
+				t.Fatal("ReadManifest succeeded")
+			}
+			msg := strings.ReplaceAll(err.Error(), root+string(filepath.Separator), "")
+			for _, w := range tt.want {
+				if !strings.Contains(msg, w) {
+					t.Errorf("error %q does not contain %q", msg, w)
+				}
+			}
+			if lines := strings.Count(msg, "\n") + 1; len(tt.want) > 2 && lines != len(tt.want) {
+				t.Errorf("%d problems reported, want %d:\n%s", lines, len(tt.want), msg)
+			}
+		})
+	}
+
+	// Without requireOutput, pairs without an output are only compared.
+	path := writeManifest(t, root, "check.csv", "input1,input2\nbefore/home.png,after/home.png\n")
+	if l, err := ReadManifest(path, core.ColorMetricRGB, false); err != nil || l.Pairs[0].Name != "after/home.png" {
+		t.Errorf("ReadManifest() = %+v, %v, want one pair named after input2", l, err)
+	}
+}
+
+func TestOverrides_Apply(t *testing.T) {
+	base := core.DefaultOptions()
+	base.Diff.IgnoreRects = []image.Rectangle{image.Rect(0, 0, 5, 5)}
+
+	if got := (Overrides{}).Apply(base); !reflect.DeepEqual(got, base) {
+		t.Error("empty overrides changed the options")
+	}
+
+	ov := Overrides{Threshold: ptr[uint8](0), MaxOffset: ptr(3), IgnoreRects: []image.Rectangle{image.Rect(10, 10, 20, 20)}}
+	got := ov.Apply(base)
+	if got.Diff.Threshold != 0 || got.Align.MaxOffsetX != 3 || got.Align.MaxOffsetY != 3 {
+		t.Errorf("threshold = %d, max offset = %d,%d, want 0, 3,3", got.Diff.Threshold, got.Align.MaxOffsetX, got.Align.MaxOffsetY)
+	}
+	if want := []image.Rectangle{image.Rect(0, 0, 5, 5), image.Rect(10, 10, 20, 20)}; !reflect.DeepEqual(got.Diff.IgnoreRects, want) {
+		t.Errorf("ignore rects = %v, want %v", got.Diff.IgnoreRects, want)
+	}
+	if len(base.Diff.IgnoreRects) != 1 || base.Diff.Threshold != core.DefaultOptions().Diff.Threshold {
+		t.Error("Apply modified the base options")
+	}
+}
+
+func TestRun_Manifest(t *testing.T) {
+	dir1, _ := fixture(t)
+	root := filepath.Dir(dir1)
+	// The login pair differs; a threshold of 255 hides it.
+	path := writeManifest(t, root, "m.json", `[
+  {"input1": "before/sub/login.png", "input2": "after/sub/login.png", "output": "out/strict.png"},
+  {"input1": "before/sub/login.png", "input2": "after/sub/login.png", "output": "out/lenient.png", "threshold": 255}
+]`)
+	l, err := ReadManifest(path, core.ColorMetricRGB, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := Options{Compare: core.DefaultOptions(), Jobs: 2}
+	opts.Compare.Runtime.Workers = 1
+	results := Run(l.Pairs, opts, testLogger(), nil)
+	for _, r := range results {
+		if r.Err != nil {
+			t.Fatalf("%s: %v", r.Name, r.Err)
+		}
+		for _, p := range []string{r.Output, r.Output + ".json"} {
+			if _, err := os.Stat(p); err != nil {
+				t.Errorf("%s: %v", r.Name, err)
+			}
+		}
+	}
+	if !results[0].Report.HasDiff || results[1].Report.HasDiff {
+		t.Errorf("hasDiff = %v, %v, want true, false", results[0].Report.HasDiff, results[1].Report.HasDiff)
+	}
+	if rep := l.Report(results, report.Gate{}); rep.Manifest != path || rep.PairsCompared != 2 || rep.PairsWithDiff != 1 {
+		t.Errorf("report: manifest=%q compared=%d withDiff=%d", rep.Manifest, rep.PairsCompared, rep.PairsWithDiff)
+	}
+}
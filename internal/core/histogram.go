@@ -0,0 +1,93 @@
+package core
+
+import "math"
+
+// Histogram counts the values of the red, green and blue channels over the
+// pixels of a frame that are not ignored.
+type Histogram struct {
+	Bins  [3][256]int
+	Count int // pixels counted
+}
+
+// Histogram returns the channel histograms of f.
+func (f *Frame) Histogram() *Histogram {
+	h := &Histogram{}
+	for y := 0; y < f.H; y++ {
+		row := f.Pix.Pix[y*f.Pix.Stride : y*f.Pix.Stride+f.W*4]
+		for x := 0; x < f.W; x++ {
+			if f.Ignored(x, y) {
+				continue
+			}
+			h.Bins[0][row[x*4]]++
+			h.Bins[1][row[x*4+1]]++
+			h.Bins[2][row[x*4+2]]++
+			h.Count++
+		}
+	}
+	return h
+}
+
+// channelStat is the mean and standard deviation of one color channel.
+type channelStat struct {
+	mean, stdDev float64
+}
+
+// stats returns the statistics of the three channels; they are zero for an
+// empty histogram.
+func (h *Histogram) stats() [3]channelStat {
+	var stats [3]channelStat
+	if h.Count == 0 {
+		return stats
+	}
+	n := float64(h.Count)
+	for c, bins := range h.Bins {
+		var sum, sumSq float64
+		for v, count := range bins {
+			sum += float64(v * count)
+			sumSq += float64(v * v * count)
+		}
+		mean := sum / n
+		stats[c] = channelStat{mean: mean, stdDev: math.Sqrt(max(0, sumSq/n-mean*mean))}
+	}
+	return stats
+}
+
+// HistogramDistance compares the channel histograms of two images, each
+// normalized to the number of pixels counted, averaged over the channels.
+// It ignores where the colors are, so it is a cheap signal that two images
+// are alike, not proof.
+type HistogramDistance struct {
+	// Intersection is the sum of the smaller of the two shares of every
+	// bin: 1 for equal histograms, 0 for disjoint ones.
+	Intersection float64
+	// ChiSquare is half the sum of (p-q)^2/(p+q) over the bins with shares
+	// p and q: 0 for equal histograms, 1 for disjoint ones.
+	ChiSquare float64
+}
+
+// CompareHistograms returns the distance of a and b. Empty histograms are
+// equal to each other and disjoint from any other.
+func CompareHistograms(a, b *Histogram) HistogramDistance {
+	if a.Count == 0 || b.Count == 0 {
+		if a.Count == b.Count {
+			return HistogramDistance{Intersection: 1}
+		}
+		return HistogramDistance{ChiSquare: 1}
+	}
+	var d HistogramDistance
+	var common int // the intersection in units of 1/(a.Count*b.Count), exact
+	na, nb := float64(a.Count), float64(b.Count)
+	for c := range a.Bins {
+		for v, countA := range a.Bins[c] {
+			countB := b.Bins[c][v]
+			common += min(countA*b.Count, countB*a.Count)
+			if p, q := float64(countA)/na, float64(countB)/nb; p+q > 0 {
+				d.ChiSquare += (p - q) * (p - q) / (p + q)
+			}
+		}
+	}
+	channels := float64(len(a.Bins))
+	d.Intersection = float64(common) / (na * nb * channels)
+	d.ChiSquare /= 2 * channels
+	return d
+}
@@ -0,0 +1,103 @@
+package core
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+// tinyFrame returns a one-row frame of the given pixels.
+func tinyFrame(pixels ...color.NRGBA) *Frame {
+	img := image.NewNRGBA(image.Rect(0, 0, len(pixels), 1))
+	for x, p := range pixels {
+		img.SetNRGBA(x, 0, p)
+	}
+	return NewFrame(img)
+}
+
+func TestFrame_Histogram(t *testing.T) {
+	f := tinyFrame(color.NRGBA{0, 10, 255, 255}, color.NRGBA{0, 20, 255, 0}, color.NRGBA{7, 10, 0, 255})
+	h := f.Histogram()
+	if h.Count != 3 {
+		t.Fatalf("count = %d, want 3", h.Count)
+	}
+	want := []struct{ channel, value, count int }{
+		{0, 0, 2}, {0, 7, 1},
+		{1, 10, 2}, {1, 20, 1},
+		{2, 255, 2}, {2, 0, 1},
+	}
+	total := 0
+	for _, w := range want {
+		if got := h.Bins[w.channel][w.value]; got != w.count {
+			t.Errorf("bin %d of channel %d = %d, want %d", w.value, w.channel, got, w.count)
+		}
+		total += w.count
+	}
+	for c := range h.Bins {
+		for _, n := range h.Bins[c] {
+			total -= n
+		}
+	}
+	if total != 0 {
+		t.Error("unexpected non-empty bins")
+	}
+
+	// Ignored pixels are not counted.
+	f.Ignore = NewMask(3, 1)
+	f.Ignore.Set(2, 0)
+	if h := f.Histogram(); h.Count != 2 || h.Bins[0][7] != 0 || h.Bins[0][0] != 2 {
+		t.Errorf("with pixel 2 ignored: count %d, bins %d/%d", h.Count, h.Bins[0][0], h.Bins[0][7])
+	}
+
+	// Mean and standard deviation of red: values 0, 0, 7.
+	s := tinyFrame(color.NRGBA{0, 0, 0, 255}, color.NRGBA{0, 0, 0, 255}, color.NRGBA{7, 0, 0, 255}).Histogram().stats()
+	if wantMean, wantSD := 7.0/3, math.Sqrt(49.0/3-49.0/9); math.Abs(s[0].mean-wantMean) > 1e-12 || math.Abs(s[0].stdDev-wantSD) > 1e-12 {
+		t.Errorf("red stats = %+v, want mean %v, sd %v", s[0], wantMean, wantSD)
+	}
+}
+
+func TestCompareHistograms(t *testing.T) {
+	black, white := color.NRGBA{0, 0, 0, 255}, color.NRGBA{255, 255, 255, 255}
+	gray := color.NRGBA{128, 128, 128, 255}
+	tests := []struct {
+		name string
+		a, b *Frame
+		want HistogramDistance
+	}{
+		{"equal", tinyFrame(black, white), tinyFrame(white, black), HistogramDistance{Intersection: 1}},
+		{"disjoint", tinyFrame(black, black), tinyFrame(white), HistogramDistance{ChiSquare: 1}},
+		// Every channel: p = {0: 1/2, 255: 1/2}, q = {0: 1}.
+		// Intersection 1/2; chi-square (1/2)((1/2)^2/(3/2) + (1/2)^2/(1/2)) = 1/3.
+		{"half", tinyFrame(black, white), tinyFrame(black), HistogramDistance{Intersection: 0.5, ChiSquare: 1.0 / 3}},
+		// Red and green as "half", blue equal (all 128): averaged over
+		// the channels, intersection (1/2+1/2+1)/3 and chi-square (1/3+1/3+0)/3.
+		{
+			"per channel",
+			tinyFrame(color.NRGBA{0, 0, 128, 255}, color.NRGBA{255, 255, 128, 255}),
+			tinyFrame(color.NRGBA{0, 0, 128, 255}),
+			HistogramDistance{Intersection: 2.0 / 3, ChiSquare: 2.0 / 9},
+		},
+		// p = {0: 1/4, 128: 3/4}, q = {128: 1}: intersection 3/4;
+		// chi-square (1/2)((1/4)^2/(1/4) + (1/4)^2/(7/4)) = 1/8 + 1/56 = 1/7.
+		{"quarter", tinyFrame(black, gray, gray, gray), tinyFrame(gray, gray), HistogramDistance{Intersection: 0.75, ChiSquare: 1.0 / 7}},
+	}
+	for _, tt := range tests {
+		got := CompareHistograms(tt.a.Histogram(), tt.b.Histogram())
+		if math.Abs(got.Intersection-tt.want.Intersection) > 1e-12 || math.Abs(got.ChiSquare-tt.want.ChiSquare) > 1e-12 {
+			t.Errorf("%s: %+v, want %+v", tt.name, got, tt.want)
+		}
+		// The distance is symmetric.
+		if back := CompareHistograms(tt.b.Histogram(), tt.a.Histogram()); math.Abs(back.Intersection-got.Intersection) > 1e-12 || math.Abs(back.ChiSquare-got.ChiSquare) > 1e-12 {
+			t.Errorf("%s: reversed %+v, want %+v", tt.name, back, got)
+		}
+	}
+
+	empty := &Histogram{}
+	if d := CompareHistograms(empty, empty); d != (HistogramDistance{Intersection: 1}) {
+		t.Errorf("empty vs empty = %+v", d)
+	}
+	if d := CompareHistograms(empty, tinyFrame(black).Histogram()); d != (HistogramDistance{ChiSquare: 1}) {
+		t.Errorf("empty vs black = %+v", d)
+	}
+}
@@ -1,17 +1,101 @@
 package core
 
 import (
+	"errors"
+	"fmt"
+	"image"
 	"image/color"
+	"math"
 	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xshoji/go-img-diff/internal/progress"
 )
 
 // AlignOptions configures the pyramid alignment algorithm.
 type AlignOptions struct {
-	MaxOffset        int // maximum pixel offset to search
-	MinPyramidSize   int // minimum image dimension for pyramid (default: 32)
-	RefinementRadius int // search radius at each finer level (default: 2)
+	MaxOffsetX       int  // maximum horizontal pixel offset to search (0 = no horizontal search)
+	MaxOffsetY       int  // maximum vertical pixel offset to search (0 = no vertical search)
+	MinPyramidSize   int  // minimum image dimension for pyramid (default: 32)
+	RefinementRadius int  // search radius at each finer level (default: 2)
+	EarlyReject      bool // reject hopeless offsets from a sparse probe before the full scan
+	EarlyAbandon     bool // stop scoring an offset once its error can no longer beat the best so far
+	Exhaustive       bool // search the full range at full resolution only, without the pyramid
+
+	// SearchStrategy selects the candidate order at each pyramid level.
+	// SearchSpiral stops expanding rings around the predicted offset once a
+	// ring improves the best score by no more than SpiralEpsilon.
+	SearchStrategy SearchStrategy
+	SpiralEpsilon  float64
+
+	// MaxAspectFactor is the largest aspect ratio difference (as a factor >= 1)
+	// compared as-is. Beyond it, a 90 degree rotation of A is tried, or the run
+	// fails with StrictDimensions. 0 disables the check.
+	MaxAspectFactor  float64
+	StrictDimensions bool
+
+	// ForcedOffset, when set, is used as the offset (DX, DY) instead of
+	// searching for one; it is only scored. MaxOffsetX/Y do not apply.
+	ForcedOffset *image.Point
+
+	// MinConfidence is the alignment confidence below which the offset is
+	// reported as ambiguous (0=never). See AlignmentConfidence.
+	MinConfidence float64
+
+	// MaxAcceptableOffset fails the run when the detected offset magnitude
+	// exceeds it (0=disabled). Unlike MaxOffsetX/Y it does not bound the search.
+	MaxAcceptableOffset int
+
+	// Metric is how candidate offsets are scored (""=mae). EarlyReject and
+	// EarlyAbandon only apply to mae.
+	Metric AlignMetric
+}
+
+// AlignMetric is the score function of the offset search.
+type AlignMetric string
+
+const (
+	AlignMetricMAE  AlignMetric = "mae"  // mean absolute luminance error; score 1 - MAE/255
+	AlignMetricSSIM AlignMetric = "ssim" // mean structural similarity of the luminance; score max(0, SSIM)
+)
+
+// Valid reports whether m is a known metric.
+func (m AlignMetric) Valid() bool {
+	return m == AlignMetricMAE || m == AlignMetricSSIM
+}
+
+// Ambiguous reports whether al was found with a confidence below
+// MinConfidence. Alignments without a confidence are never ambiguous.
+func (o AlignOptions) Ambiguous(al Alignment) bool {
+	return o.MinConfidence > 0 && al.Confidence > 0 && al.Confidence < o.MinConfidence
+}
+
+// WorkersPerJob returns the worker count for each of jobs comparisons running
+// concurrently on cores CPUs: workers, reduced so that jobs*workers does not
+// exceed cores, but at least 1. adjusted reports whether it was reduced.
+func WorkersPerJob(jobs, workers, cores int) (perJob int, adjusted bool) {
+	jobs, workers, cores = max(1, jobs), max(1, workers), max(1, cores)
+	if jobs*workers <= cores {
+		return workers, false
+	}
+	return max(1, cores/jobs), true
 }
 
+// AcceptsOffset reports whether al is within MaxAcceptableOffset.
+func (o AlignOptions) AcceptsOffset(al Alignment) bool {
+	return o.MaxAcceptableOffset <= 0 || al.Magnitude() <= o.MaxAcceptableOffset
+}
+
+// SearchStrategy is the order in which candidate offsets are evaluated.
+type SearchStrategy string
+
+const (
+	SearchFull   SearchStrategy = "full"   // every offset within the search radius
+	SearchSpiral SearchStrategy = "spiral" // rings from the predicted offset outward, with cutoff
+)
+
 // VerticalAlignOptions configures stripe-based dynamic-programming alignment.
 type VerticalAlignOptions struct {
 	Enabled      bool
@@ -21,14 +105,243 @@ type VerticalAlignOptions struct {
 	MaxBandShift int
 	GapPenalty   float64
 	BlankInkMax  float64
+
+	// DetectScroll replaces the stripe alignment by a row alignment on the
+	// exact content of every row (see align.ScrollAlign): runs of rows that
+	// only one input has are reported as Result.RowBands instead of as
+	// differing pixels, and the other rows are compared as usual.
+	DetectScroll bool
+}
+
+// LocalAlignOptions configures the re-alignment of large diff regions by an
+// offset search restricted to each region.
+type LocalAlignOptions struct {
+	Enabled     bool
+	MinArea     int     // minimum bounding box area of a region to re-align
+	Radius      int     // search radius around the global offset in pixels
+	MaxResidual float64 // share of compared pixels that may still differ at the local offset
 }
 
 // DiffOptions configures pixel diff detection.
 type DiffOptions struct {
-	Threshold         uint8   // 0-255 max channel difference
+	Threshold         uint8   // difference threshold on Metric's scale (see ColorMetric.MaxThreshold)
 	StopAfterFirst    bool    // for --exit-on-diff: stop after first diff pixel
 	NoiseWindowSize   int     // local window size for sparse-noise suppression (0=disabled)
 	NoiseMinDiffRatio float64 // minimum diff density in the local window to keep a diff pixel
+	Workers           int     // parallel row workers (0=runtime.NumCPU())
+
+	// Despeckle is the radius of a morphological opening of the mask (an
+	// erosion followed by a dilation with a square of 2*Despeckle+1 pixels),
+	// which removes specks narrower than that square and keeps the shape of
+	// larger changes (0=disabled). Close is the radius of a closing (a
+	// dilation followed by an erosion), applied after it, which fills holes
+	// and gaps up to 2*Close pixels wide (0=disabled). Both run after the
+	// sparse-noise filter. Windows are clipped at the mask's edges, so changes
+	// touching an edge are not eroded there, and a closing also fills gaps of
+	// up to Close pixels between a change and an edge.
+	Despeckle int
+	Close     int
+
+	// VerifyClean re-checks every pixel without the noise filter and
+	// Despeckle when they left no differences, and reports the unfiltered
+	// ones if any.
+	VerifyClean bool
+
+	// Metric is how two pixels are compared against Threshold (""=rgb).
+	Metric ColorMetric
+
+	// Grayscale compares only the luminance of the pixels (ITU-R BT.601, as
+	// cached in Frame.Gray and used for alignment), ignoring color casts.
+	// Rendering still uses the original colors.
+	Grayscale bool
+
+	// Normalize maps the color channels of input1 to the mean and standard
+	// deviation of those of input2 before alignment (see Frame.Normalize),
+	// so that a uniform brightness or contrast shift is not a difference.
+	// Rendering still uses the original colors.
+	Normalize bool
+
+	// IgnoreAntialiasing skips differing pixels that look like anti-aliased
+	// edges in either image, e.g. text rendered with different font hinting.
+	IgnoreAntialiasing bool
+
+	// ChannelThresholds are separate R, G, B and A thresholds for the rgb
+	// metric (nil=Threshold for every channel): a pixel differs when any
+	// channel exceeds its own threshold. The alpha one is unused with IgnoreAlpha.
+	ChannelThresholds *[4]uint8
+
+	// IgnoreAlpha treats all pixels as opaque: only their colors are
+	// compared. The ciede2000 metric always does.
+	IgnoreAlpha bool
+
+	// MaxDiffRatio and MaxDiffPixels tolerate noise: the images differ only
+	// when the differing pixels exceed either limit, as a fraction of the
+	// compared pixels or as a count (0=no limit; both 0=any region differs).
+	// With a limit set, StopAfterFirst is ignored so that all are counted.
+	MaxDiffRatio  float64
+	MaxDiffPixels int
+
+	// Ignore marks pixels of input2 that are excluded from alignment scoring
+	// and never reported as different (nil=none); a mask of another size is
+	// scaled to input2. Run loads it from IgnoreMaskPath (see MaskFromImage).
+	Ignore         *Mask `json:"-"`
+	IgnoreMaskPath string
+
+	// IgnoreRects are areas of input2, in its pixel coordinates, excluded
+	// like Ignore. They may overlap; regions are clipped so they never
+	// overlap one of them.
+	IgnoreRects []image.Rectangle
+
+	// Workspace supplies reusable mask buffers (nil=allocate). Compare sets
+	// it from RuntimeOptions.Workspace.
+	Workspace *Workspace `json:"-"`
+}
+
+// ColorMetric is the per-pixel color difference compared against
+// DiffOptions.Threshold.
+type ColorMetric string
+
+const (
+	ColorMetricRGB       ColorMetric = "rgb"       // max(|dR|, |dG|, |dB|), 0-255
+	ColorMetricCIEDE2000 ColorMetric = "ciede2000" // CIEDE2000 delta E of the sRGB colors in CIELAB (D65), 0-100
+)
+
+// Valid reports whether m is a known metric.
+func (m ColorMetric) Valid() bool {
+	return m == ColorMetricRGB || m == ColorMetricCIEDE2000
+}
+
+// MaxThreshold is the largest meaningful threshold for m: 255 for rgb, 100
+// (the lightness range) for ciede2000.
+func (m ColorMetric) MaxThreshold() int {
+	if m == ColorMetricCIEDE2000 {
+		return 100
+	}
+	return 255
+}
+
+// ParseThreshold parses a threshold on m's scale: an integer from 0 to
+// MaxThreshold, or a percentage of MaxThreshold such as "12%" or "2.5%",
+// rounded to the nearest integer.
+func (m ColorMetric) ParseThreshold(s string) (uint8, error) {
+	s = strings.TrimSpace(s)
+	if p, ok := strings.CutSuffix(s, "%"); ok {
+		percent, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil || math.IsNaN(percent) {
+			return 0, fmt.Errorf("invalid threshold '%s'. Must be an integer or a percentage such as 12%%", s)
+		}
+		if percent < 0 || percent > 100 {
+			return 0, fmt.Errorf("threshold %s is not between 0%% and 100%%", s)
+		}
+		return m.PercentThreshold(percent), nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid threshold '%s'. Must be an integer or a percentage such as 12%%", s)
+	}
+	if n < 0 || n > m.MaxThreshold() {
+		return 0, fmt.Errorf("threshold %d is not between 0 and %d for color metric %s", n, m.MaxThreshold(), m)
+	}
+	return uint8(n), nil
+}
+
+// PercentThreshold converts percent (0-100) of MaxThreshold to a threshold
+// on m's scale, rounded to the nearest integer.
+func (m ColorMetric) PercentThreshold(percent float64) uint8 {
+	return uint8(math.Round(percent / 100 * float64(m.MaxThreshold())))
+}
+
+// DefaultThreshold is the threshold used for m when none is given. A delta E
+// of about 2 is just noticeable; 5 leaves room for compression artifacts.
+func (m ColorMetric) DefaultThreshold() uint8 {
+	if m == ColorMetricCIEDE2000 {
+		return 5
+	}
+	return 30
+}
+
+// MinDetectableChange returns the side in pixels of the smallest solid square
+// change (beyond Threshold) that is always detected: 1, unless the sparse-noise
+// filter or Despeckle may remove smaller changes. A k x k change survives the
+// filter when k*k reaches NoiseMinDiffRatio of the window, and the opening
+// when k is at least 2*Despeckle+1.
+func (o DiffOptions) MinDetectableChange() int {
+	side := 1
+	if o.Despeckle > 0 {
+		side = 2*o.Despeckle + 1
+	}
+	window := o.NoiseWindowSize
+	if window <= 1 || o.NoiseMinDiffRatio <= 0 {
+		return side
+	}
+	if window%2 == 0 {
+		window++
+	}
+	return max(side, int(math.Ceil(float64(window)*math.Sqrt(min(o.NoiseMinDiffRatio, 1))-1e-9)))
+}
+
+// Tolerant reports whether MaxDiffRatio or MaxDiffPixels is set.
+func (o DiffOptions) Tolerant() bool {
+	return o.MaxDiffRatio > 0 || o.MaxDiffPixels > 0
+}
+
+// Tolerates reports whether the given number of differing pixels, out of
+// total compared pixels, stays within MaxDiffRatio and MaxDiffPixels. It is
+// false when neither is set.
+func (o DiffOptions) Tolerates(pixels, total int) bool {
+	if !o.Tolerant() {
+		return false
+	}
+	if o.MaxDiffPixels > 0 && pixels > o.MaxDiffPixels {
+		return false
+	}
+	if o.MaxDiffRatio > 0 && total > 0 && float64(pixels)/float64(total) > o.MaxDiffRatio {
+		return false
+	}
+	return true
+}
+
+// IgnoreMask returns the pixels of a w x h input2 excluded by Ignore (scaled
+// to w x h) and IgnoreRects, or nil if neither is set. Ignore is not modified.
+func (o DiffOptions) IgnoreMask(w, h int) *Mask {
+	if o.Ignore == nil && len(o.IgnoreRects) == 0 {
+		return nil
+	}
+	m := o.Ignore
+	if m == nil {
+		m = NewMask(w, h)
+	} else if len(o.IgnoreRects) > 0 || m.W != w || m.H != h {
+		// Resize copies the mask even at the same size.
+		m = m.Resize(w, h)
+	}
+	for _, r := range o.IgnoreRects {
+		m.SetRect(r)
+	}
+	return m
+}
+
+// ParseRect parses a rectangle written as X,Y,W,H (e.g. 0,0,200,40), the form
+// of --ignore-rect, --roi and the ignore_rects of batch manifests.
+func ParseRect(s string) (image.Rectangle, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 4 {
+		return image.Rectangle{}, fmt.Errorf("invalid rectangle '%s'. Must be X,Y,W,H (e.g. 0,0,200,40)", s)
+	}
+	var v [4]int
+	for i, p := range parts {
+		n, err := strconv.Atoi(strings.TrimSpace(p))
+		if err != nil {
+			return image.Rectangle{}, fmt.Errorf("invalid rectangle '%s': '%s' is not an integer", s, strings.TrimSpace(p))
+		}
+		v[i] = n
+	}
+	if v[0] < 0 || v[1] < 0 {
+		return image.Rectangle{}, fmt.Errorf("invalid rectangle '%s': X and Y must not be negative", s)
+	}
+	if v[2] <= 0 || v[3] <= 0 {
+		return image.Rectangle{}, fmt.Errorf("invalid rectangle '%s': width and height must be positive", s)
+	}
+	return image.Rect(v[0], v[1], v[0]+v[2], v[1]+v[3]), nil
 }
 
 // RegionOptions configures connected-component region extraction.
@@ -36,6 +349,60 @@ type RegionOptions struct {
 	MinArea      int // minimum diff pixel count to keep a region
 	Padding      int // pixels of padding to add around bounding boxes
 	DilateRadius int // morphological dilation radius before CCL (0=none)
+
+	// ConnectDistance joins diff pixels up to this Chebyshev distance apart
+	// into one component without growing them like dilation does (<=1 means
+	// plain 8-connectivity).
+	ConnectDistance int
+
+	// MinSize grows (padded) bounding boxes narrower or shorter than this
+	// many pixels around their center, within the image (0=never).
+	MinSize int
+
+	// MergeDistance merges bounding boxes at most this many pixels apart
+	// after padding (0=only overlapping or adjacent boxes).
+	MergeDistance int
+
+	// MinPixels drops final regions, after padding and merging, with fewer
+	// than this many diff pixels (Region.Area); unlike MinArea it also counts
+	// the pixels of components merged into a region. The dropped regions are
+	// kept in Result.Suppressed (0=keep all).
+	MinPixels int
+
+	// MaxRegions keeps only this many regions, the first in the order of
+	// region.SortBySeverity; the number dropped is Result.DroppedRegions
+	// (0=unlimited).
+	MaxRegions int
+
+	// TileSize labels the mask in tiles of this many pixels square, so the
+	// labeling scratch covers one tile instead of the whole mask; the regions
+	// are the same (0=whole mask at once).
+	TileSize int
+
+	// Outline selects how regions are outlined ("" = box). With
+	// RegionOutlineContour, the boundaries of the diff components inside
+	// every region are traced and simplified to polygons whose vertices
+	// deviate at most ContourEpsilon pixels from the boundary (see
+	// Region.Contour); the bounding boxes still define the regions.
+	Outline        RegionOutline
+	ContourEpsilon float64
+
+	// Workspace supplies the labeling scratch (nil=allocate). Compare sets
+	// it from RuntimeOptions.Workspace.
+	Workspace *Workspace `json:"-"`
+}
+
+// RegionOutline selects the shape outlining a region.
+type RegionOutline string
+
+const (
+	RegionOutlineBox     RegionOutline = "box"     // the bounding box
+	RegionOutlineContour RegionOutline = "contour" // polygons following the differing pixels
+)
+
+// Valid reports whether o is a known outline.
+func (o RegionOutline) Valid() bool {
+	return o == RegionOutlineBox || o == RegionOutlineContour
 }
 
 // RenderOptions configures diff visualization.
@@ -49,16 +416,216 @@ type RenderOptions struct {
 	BorderColor      color.NRGBA
 	BorderWidth      int
 	Layout           Layout
+	Captions         bool          // draw panel captions in the side-by-side layout
+	HeatmapGradient  []color.NRGBA // evenly spaced heatmap colors from no difference to maximum (nil=default)
+	HeatmapOverlay   bool          // composite the heatmap at 50% opacity over the second image
+	HatchUncovered   bool          // hatch the areas of B without a counterpart in A
+	HatchColor       color.NRGBA
+	HatchIgnored     bool // hatch the areas excluded by DiffOptions.Ignore
+	IgnoredColor     color.NRGBA
+	ROIColor         color.NRGBA // outline of Options.ROI in the diff image
+	InsertedColor    color.NRGBA // rows only B has (see Result.RowBands)
+	DeletedColor     color.NRGBA // rows only A has
+	GridShading      bool        // shade every Options.Grid cell by its share of differing pixels
+	GridColor        color.NRGBA
+	Labels           bool        // draw the region index, as numbered in the reports, next to each border
+	Style            RenderStyle // what is drawn inside the regions ("" = overlay)
+	FillAlpha        float64     // opacity of the TintColor fill of RenderStyleFill (0.0-1.0)
+	Base             RenderBase  // image drawn as the canvas of the diff image ("" = b)
+
+	// SeverityStyles vary the region style by Region.Severity and are sorted
+	// by ascending MinSeverity. Regions below the first band, and all regions
+	// when there are none, use BorderColor, BorderWidth and the tint settings.
+	SeverityStyles []SeverityStyle
+
+	// Workspace supplies the canvas of the diff image (nil=allocate).
+	// Compare sets it from RuntimeOptions.Workspace.
+	Workspace *Workspace `json:"-"`
+}
+
+// RenderStyle selects what Render draws inside each region; the border is
+// drawn in every style.
+type RenderStyle string
+
+const (
+	RenderStyleOverlay RenderStyle = "overlay" // aligned pixels of A, tinted, over the diff pixels
+	RenderStyleFill    RenderStyle = "fill"    // TintColor at FillAlpha over the whole region
+	RenderStyleOutline RenderStyle = "outline" // border only, the inside is left untouched
+)
+
+// Valid reports whether s is a known style.
+func (s RenderStyle) Valid() bool {
+	return s == RenderStyleOverlay || s == RenderStyleFill || s == RenderStyleOutline
+}
+
+// RenderBase selects the image the diff image is drawn on. The overlay shows
+// the pixels of the other image, mapped by the alignment.
+type RenderBase string
+
+const (
+	RenderBaseA RenderBase = "a" // the first image, with the regions moved by the inverse offset
+	RenderBaseB RenderBase = "b" // the second image, in whose coordinates regions are reported
+)
+
+// Valid reports whether b is a known base.
+func (b RenderBase) Valid() bool {
+	return b == RenderBaseA || b == RenderBaseB
+}
+
+// BaseShift returns the translation from the coordinates of the second image,
+// in which regions, masks and bands are given, to those of the diff image
+// drawn on the base image under alignment al.
+func (o RenderOptions) BaseShift(al Alignment) image.Point {
+	if o.Base == RenderBaseA {
+		return image.Pt(-al.DX, -al.DY)
+	}
+	return image.Point{}
+}
+
+// SeverityStyle is the region style of a severity band: the regions whose
+// severity is at least MinSeverity and below the MinSeverity of the next band.
+// It replaces the border and tint settings of RenderOptions for them.
+type SeverityStyle struct {
+	MinSeverity  float64
+	BorderColor  color.NRGBA
+	BorderWidth  int     // 0=no border
+	Fill         bool    // blend BorderColor over the whole region
+	FillAlpha    float64 // fill opacity (0.0-1.0)
+	TintStrength float64 // tint of the overlaid diff pixels (0=no tint)
+	Label        bool    // draw the region index next to the border
+}
+
+// SeverityStyle returns the band of SeverityStyles that applies to severity,
+// or false if there is none.
+func (o RenderOptions) SeverityStyle(severity float64) (SeverityStyle, bool) {
+	for i := len(o.SeverityStyles) - 1; i >= 0; i-- {
+		if severity >= o.SeverityStyles[i].MinSeverity {
+			return o.SeverityStyles[i], true
+		}
+	}
+	return SeverityStyle{}, false
+}
+
+// OverlayPreset names a coherent combination of overlay transparency, tint
+// strength and tint transparency.
+type OverlayPreset string
+
+const (
+	OverlaySubtle   OverlayPreset = "subtle"   // A shows faintly through B
+	OverlayBalanced OverlayPreset = "balanced" // A and B are about equally visible
+	OverlayStrong   OverlayPreset = "strong"   // A dominates the diff areas
+)
+
+// overlayPresets holds OverlayAlpha, TintStrength and TintTransparency per preset.
+var overlayPresets = map[OverlayPreset][3]float64{
+	OverlaySubtle:   {0.85, 0.05, 0.4},
+	OverlayBalanced: {0.6, 0.2, 0.4},
+	OverlayStrong:   {0.3, 0.4, 0.3},
+}
+
+// Valid reports whether p is a known preset.
+func (p OverlayPreset) Valid() bool {
+	_, ok := overlayPresets[p]
+	return ok
+}
+
+// ApplyOverlayPreset sets OverlayAlpha, TintStrength and TintTransparency to
+// the values of preset. Unknown presets leave the options unchanged.
+func (o *RenderOptions) ApplyOverlayPreset(preset OverlayPreset) {
+	if v, ok := overlayPresets[preset]; ok {
+		o.OverlayAlpha, o.TintStrength, o.TintTransparency = v[0], v[1], v[2]
+	}
+}
+
+// MinVisibleOverlayOpacity is the overlay opacity below which the first image
+// is practically invisible in the diff areas.
+const MinVisibleOverlayOpacity = 0.1
+
+// OverlayOpacity returns the weight of the first image in overlaid pixels, as
+// blended by BlendColors: 0 when no overlay is drawn.
+func (o RenderOptions) OverlayOpacity() float64 {
+	switch {
+	case !o.DrawOverlay:
+		return 0
+	case o.TintEnabled:
+		return 1 - (o.OverlayAlpha+o.TintTransparency)/2
+	}
+	return 1 - o.OverlayAlpha
+}
+
+// OverlayImperceptible reports whether an overlay is drawn but too transparent
+// to be seen.
+func (o RenderOptions) OverlayImperceptible() bool {
+	return o.DrawOverlay && o.OverlayOpacity() < MinVisibleOverlayOpacity
 }
 
 // RuntimeOptions configures execution parameters.
 type RuntimeOptions struct {
-	Workers int
+	Workers  int
+	Progress progress.Reporter `json:"-"` // receives stage and percentage events (nil=silent)
+
+	// ReportMemory records the duration and Go memory statistics of each
+	// pipeline phase in Result.Phases.
+	ReportMemory bool
+
+	// Workspace keeps the buffers of a comparison for the next one (nil=none);
+	// see Workspace for how long results stay valid.
+	Workspace *Workspace `json:"-"`
 }
 
 // OutputOptions configures output.
 type OutputOptions struct {
-	Path string
+	Path             string
+	PathA            string        // copy of input1 with the regions mapped onto it by the inverse offset
+	ScoreSurfacePath string        // debug PNG of the full-resolution alignment score surface
+	MaskPath         string        // black/white diff mask (white = differing pixel)
+	HeatmapPath      string        // heatmap of the per-pixel difference magnitude
+	BlinkPath        string        // animated GIF alternating aligned A and B
+	BlinkDelay       time.Duration // display time of each blink frame
+	AnalysisPath     string        // versioned analysis sidecar for re-rendering without recomputing
+	DirectWrite      bool          // write outputs in place instead of via a temporary file and rename
+	NoOverwrite      bool          // fail instead of replacing an existing output file
+	NoMkdir          bool          // fail instead of creating missing output directories
+	SkipIdentical    bool          // write no diff image (Path, PathA) when the images do not differ
+
+	// Version identifies the imgdiff build in the JSON report; StampVersion
+	// also writes it into a "Software" tEXt chunk of a PNG diff image.
+	Version      string
+	StampVersion bool
+
+	// JPEGQuality is the quality (1-100) of JPEG outputs (0=DefaultJPEGQuality).
+	// PNGCompression is the zlib level of PNG outputs (""=default).
+	JPEGQuality    int
+	PNGCompression PNGCompression
+
+	// Crop crops every panel of the output to the regions plus CropMargin
+	// pixels (see render.CropRect); without regions the full image is kept.
+	// CropDir receives one crop of the diff image per region.
+	Crop       bool
+	CropMargin int
+	CropDir    string
+}
+
+// DefaultJPEGQuality is the quality of JPEG outputs unless configured.
+const DefaultJPEGQuality = 90
+
+// PNGCompression is the compression level of PNG outputs.
+type PNGCompression string
+
+const (
+	PNGCompressionDefault PNGCompression = "default" // zlib's default level
+	PNGCompressionSpeed   PNGCompression = "speed"   // fastest compression
+	PNGCompressionBest    PNGCompression = "best"    // smallest files
+	PNGCompressionNone    PNGCompression = "none"    // no compression
+)
+
+// Valid reports whether c is a known compression level.
+func (c PNGCompression) Valid() bool {
+	switch c {
+	case PNGCompressionDefault, PNGCompressionSpeed, PNGCompressionBest, PNGCompressionNone:
+		return true
+	}
+	return false
 }
 
 // Options is the top-level configuration aggregating all stage options.
@@ -67,20 +634,103 @@ type Options struct {
 	Input2        string
 	Align         AlignOptions
 	VerticalAlign VerticalAlignOptions
+	LocalAlign    LocalAlignOptions
 	Diff          DiffOptions
 	Region        RegionOptions
 	Render        RenderOptions
 	Runtime       RuntimeOptions
 	Output        OutputOptions
+
+	// ROI restricts alignment, diff detection and regions to this rectangle
+	// of both images (empty=whole images). It is clamped to the images.
+	ROI image.Rectangle
+
+	// PHashPrefilter reports images of the same size with equal perceptual
+	// hashes as identical without aligning or comparing them (see
+	// Result.Prefiltered). Differing hashes never skip anything.
+	PHashPrefilter bool
+
+	// HistogramOnly makes Run skip alignment and diff detection: the images
+	// differ when the chi-square distance of their color histograms exceeds
+	// HistogramMaxDistance (see Result.Histogram). Compare ignores it.
+	HistogramOnly        bool
+	HistogramMaxDistance float64
+
+	// SizeMismatch is how inputs of different sizes are handled (""=warn).
+	// With SizeMismatchPad both are extended on the right and bottom to their
+	// larger width and height with PadColor (see Frame.Pad), and PadIgnore
+	// excludes the padding of either input like Diff.IgnoreRects.
+	SizeMismatch SizeMismatch
+	PadColor     color.NRGBA
+	PadIgnore    bool
+
+	// AutoScale downsamples the larger input with a box filter to the size
+	// of the other one when their sizes differ by a uniform simple ratio
+	// (see DetectScale), before SizeMismatch applies. Inputs whose sizes
+	// differ otherwise are refused (see Result.Scale).
+	AutoScale bool
+
+	// Grid divides frame B into Grid.Cols x Grid.Rows cells whose differing
+	// pixels are counted for the JSON report (see Mask.Grid); zero = no grid.
+	Grid GridSize
+}
+
+// GridSize is the number of columns and rows of a cell grid.
+type GridSize struct {
+	Cols, Rows int
+}
+
+// IsZero reports whether no grid is configured.
+func (g GridSize) IsZero() bool {
+	return g.Cols <= 0 || g.Rows <= 0
+}
+
+// String returns the grid as "COLSxROWS".
+func (g GridSize) String() string {
+	return fmt.Sprintf("%dx%d", g.Cols, g.Rows)
+}
+
+// ParseGridSize parses a grid written as COLSxROWS (e.g. 12x8), the form of
+// --grid.
+func ParseGridSize(s string) (GridSize, error) {
+	cols, rows, ok := strings.Cut(strings.ToLower(s), "x")
+	if ok {
+		c, errC := strconv.Atoi(strings.TrimSpace(cols))
+		r, errR := strconv.Atoi(strings.TrimSpace(rows))
+		if errC == nil && errR == nil && c > 0 && r > 0 {
+			return GridSize{Cols: c, Rows: r}, nil
+		}
+	}
+	return GridSize{}, fmt.Errorf("invalid grid '%s'. Must be COLSxROWS with positive integers (e.g. 12x8)", s)
+}
+
+// SizeMismatch selects how inputs of different sizes are compared.
+type SizeMismatch string
+
+const (
+	SizeMismatchWarn  SizeMismatch = "warn"  // compare them as they are and log a warning
+	SizeMismatchError SizeMismatch = "error" // refuse to compare them
+	SizeMismatchPad   SizeMismatch = "pad"   // pad both to a common canvas first
+)
+
+// Valid reports whether m is a known mode.
+func (m SizeMismatch) Valid() bool {
+	return m == SizeMismatchWarn || m == SizeMismatchError || m == SizeMismatchPad
 }
 
 // DefaultOptions returns options with sensible defaults.
 func DefaultOptions() Options {
 	return Options{
 		Align: AlignOptions{
-			MaxOffset:        10,
+			MaxOffsetX:       10,
+			MaxOffsetY:       10,
 			MinPyramidSize:   32,
 			RefinementRadius: 2,
+			EarlyReject:      true,
+			EarlyAbandon:     true,
+			SearchStrategy:   SearchFull,
+			MaxAspectFactor:  1.5,
+			MinConfidence:    1.2,
 		},
 		VerticalAlign: VerticalAlignOptions{
 			Enabled:      true,
@@ -91,15 +741,22 @@ func DefaultOptions() Options {
 			GapPenalty:   18.0,
 			BlankInkMax:  0.03,
 		},
+		LocalAlign: LocalAlignOptions{
+			MinArea:     400,
+			Radius:      5,
+			MaxResidual: 0.005,
+		},
 		Diff: DiffOptions{
 			Threshold:         30,
 			NoiseWindowSize:   0,
 			NoiseMinDiffRatio: 0,
+			Metric:            ColorMetricRGB,
 		},
 		Region: RegionOptions{
-			MinArea:      4,
-			Padding:      5,
-			DilateRadius: 1,
+			MinArea:        4,
+			Padding:        5,
+			DilateRadius:   1,
+			ContourEpsilon: 1,
 		},
 		Render: RenderOptions{
 			DrawOverlay:      true,
@@ -111,9 +768,86 @@ func DefaultOptions() Options {
 			BorderColor:      color.NRGBA{255, 0, 0, 255},
 			BorderWidth:      3,
 			Layout:           LayoutSimple,
+			Captions:         true,
+			HatchColor:       color.NRGBA{0, 128, 255, 255},
+			IgnoredColor:     color.NRGBA{160, 160, 160, 255},
+			ROIColor:         color.NRGBA{255, 0, 255, 255},
+			InsertedColor:    color.NRGBA{0, 170, 0, 255},
+			DeletedColor:     color.NRGBA{255, 140, 0, 255},
+			GridColor:        color.NRGBA{160, 0, 255, 255},
+			Style:            RenderStyleOverlay,
+			FillAlpha:        0.25,
 		},
 		Runtime: RuntimeOptions{
 			Workers: runtime.NumCPU(),
 		},
+		Output: OutputOptions{
+			BlinkDelay:  500 * time.Millisecond,
+			JPEGQuality: DefaultJPEGQuality,
+		},
+		HistogramMaxDistance: 0.01,
 	}
 }
+
+// Validate range-checks the options and returns every problem found, or nil.
+// Empty metrics and styles stand for their defaults.
+func (o Options) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+	unit := func(name string, v float64) {
+		check(v >= 0 && v <= 1, "%s must be between 0.0 and 1.0, got %v", name, v)
+	}
+	nonNegative := func(name string, v int) {
+		check(v >= 0, "%s must not be negative, got %d", name, v)
+	}
+
+	check(o.Align.Metric == "" || o.Align.Metric.Valid(), "invalid alignment metric '%s'; must be 'mae' or 'ssim'", o.Align.Metric)
+	check(o.SizeMismatch == "" || o.SizeMismatch.Valid(), "invalid size mismatch mode '%s'; must be 'warn', 'error' or 'pad'", o.SizeMismatch)
+	nonNegative("max offset X", o.Align.MaxOffsetX)
+	nonNegative("max offset Y", o.Align.MaxOffsetY)
+	unit("spiral epsilon", o.Align.SpiralEpsilon)
+	unit("histogram max distance", o.HistogramMaxDistance)
+	nonNegative("grid columns", o.Grid.Cols)
+	nonNegative("grid rows", o.Grid.Rows)
+
+	metric := o.Diff.Metric
+	if metric == "" {
+		metric = ColorMetricRGB
+	}
+	check(metric.Valid(), "invalid color metric '%s'; must be 'rgb' or 'ciede2000'", metric)
+	if metric.Valid() {
+		check(int(o.Diff.Threshold) <= metric.MaxThreshold(), "diff threshold must be between 0 and %d for color metric %s, got %d", metric.MaxThreshold(), metric, o.Diff.Threshold)
+	}
+	nonNegative("noise window size", o.Diff.NoiseWindowSize)
+	nonNegative("despeckle radius", o.Diff.Despeckle)
+	nonNegative("close radius", o.Diff.Close)
+	unit("noise min ratio", o.Diff.NoiseMinDiffRatio)
+	unit("max diff ratio", o.Diff.MaxDiffRatio)
+	nonNegative("max diff pixels", o.Diff.MaxDiffPixels)
+
+	nonNegative("min region area", o.Region.MinArea)
+	nonNegative("min region pixels", o.Region.MinPixels)
+	nonNegative("max regions", o.Region.MaxRegions)
+	nonNegative("region padding", o.Region.Padding)
+	nonNegative("tile size", o.Region.TileSize)
+
+	unit("overlay transparency", o.Render.OverlayAlpha)
+	unit("tint strength", o.Render.TintStrength)
+	unit("tint weight", o.Render.TintTransparency)
+	unit("fill alpha", o.Render.FillAlpha)
+	check(o.Render.Base == "" || o.Render.Base.Valid(), "invalid render base '%s'; must be 'a' or 'b'", o.Render.Base)
+	check(o.Region.Outline == "" || o.Region.Outline.Valid(), "invalid region outline '%s'; must be 'box' or 'contour'", o.Region.Outline)
+	check(o.Region.ContourEpsilon >= 0, "contour epsilon must not be negative, got %v", o.Region.ContourEpsilon)
+	check(o.Render.Style == "" || o.Render.Style.Valid(), "invalid render style '%s'; must be 'overlay', 'fill' or 'outline'", o.Render.Style)
+	nonNegative("border thickness", o.Render.BorderWidth)
+
+	check(o.Runtime.Workers >= 1, "workers must be at least 1, got %d", o.Runtime.Workers)
+	nonNegative("crop margin", o.Output.CropMargin)
+	check(o.Output.JPEGQuality >= 0 && o.Output.JPEGQuality <= 100, "JPEG quality must be between 1 and 100, or 0 for the default (%d), got %d", DefaultJPEGQuality, o.Output.JPEGQuality)
+	check(o.Output.PNGCompression == "" || o.Output.PNGCompression.Valid(), "invalid PNG compression '%s'; must be 'default', 'speed', 'best' or 'none'", o.Output.PNGCompression)
+	return errors.Join(errs...)
+}
@@ -1,14 +1,15 @@
 package core
 
 import (
+	"strings"
 	"testing"
 )
 
 func TestDefaultOptions(t *testing.T) {
 	opts := DefaultOptions()
 
-	if opts.Align.MaxOffset != 10 {
-		t.Errorf("expected MaxOffset=10, got %d", opts.Align.MaxOffset)
+	if opts.Align.MaxOffsetX != 10 || opts.Align.MaxOffsetY != 10 {
+		t.Errorf("expected MaxOffsetX/Y=10, got %d/%d", opts.Align.MaxOffsetX, opts.Align.MaxOffsetY)
 	}
 	if !opts.VerticalAlign.Enabled {
 		t.Error("expected VerticalAlign.Enabled=true")
@@ -50,3 +51,258 @@ func TestDefaultOptions(t *testing.T) {
 		t.Errorf("expected positive Workers, got %d", opts.Runtime.Workers)
 	}
 }
+
+func TestApplyOverlayPreset(t *testing.T) {
+	cases := []struct {
+		preset                        OverlayPreset
+		alpha, strength, transparency float64
+	}{
+		{OverlaySubtle, 0.85, 0.05, 0.4},
+		{OverlayBalanced, 0.6, 0.2, 0.4},
+		{OverlayStrong, 0.3, 0.4, 0.3},
+	}
+	for _, c := range cases {
+		if !c.preset.Valid() {
+			t.Errorf("%s: expected valid preset", c.preset)
+		}
+		opts := DefaultOptions().Render
+		opts.ApplyOverlayPreset(c.preset)
+		if opts.OverlayAlpha != c.alpha || opts.TintStrength != c.strength || opts.TintTransparency != c.transparency {
+			t.Errorf("%s: got alpha=%v strength=%v transparency=%v", c.preset, opts.OverlayAlpha, opts.TintStrength, opts.TintTransparency)
+		}
+		// Every preset stays visible with and without tint.
+		for _, tint := range []bool{true, false} {
+			opts.TintEnabled = tint
+			if opts.OverlayImperceptible() {
+				t.Errorf("%s (tint %v): overlay opacity %.2f is imperceptible", c.preset, tint, opts.OverlayOpacity())
+			}
+		}
+	}
+
+	if OverlayPreset("loud").Valid() {
+		t.Error("expected unknown preset to be invalid")
+	}
+	opts := DefaultOptions().Render
+	opts.ApplyOverlayPreset("loud")
+	if opts.OverlayAlpha != 0.95 || opts.TintStrength != 0.05 || opts.TintTransparency != 0.2 {
+		t.Error("unknown preset changed the options")
+	}
+}
+
+func TestOverlayImperceptible(t *testing.T) {
+	opts := DefaultOptions().Render
+	if opts.OverlayImperceptible() {
+		t.Errorf("default tinted overlay should be visible, opacity %.2f", opts.OverlayOpacity())
+	}
+	opts.TintEnabled = false
+	if !opts.OverlayImperceptible() {
+		t.Errorf("untinted overlay at 0.95 transparency should be imperceptible, opacity %.2f", opts.OverlayOpacity())
+	}
+	opts.DrawOverlay = false
+	if opts.OverlayImperceptible() {
+		t.Error("a disabled overlay is not reported as imperceptible")
+	}
+}
+
+func TestWorkersPerJob(t *testing.T) {
+	cases := []struct {
+		jobs, workers, cores int
+		want                 int
+		adjusted             bool
+	}{
+		{1, 8, 8, 8, false},
+		{8, 8, 8, 1, true},
+		{2, 8, 8, 4, true},
+		{3, 8, 8, 2, true},
+		{4, 2, 8, 2, false},
+		{16, 4, 8, 1, true},
+		{2, 16, 32, 16, false},
+		{0, 0, 0, 1, false},
+	}
+	for _, c := range cases {
+		got, adjusted := WorkersPerJob(c.jobs, c.workers, c.cores)
+		if got != c.want || adjusted != c.adjusted {
+			t.Errorf("WorkersPerJob(%d, %d, %d) = %d, %v; want %d, %v", c.jobs, c.workers, c.cores, got, adjusted, c.want, c.adjusted)
+		}
+	}
+}
+
+func TestDiffOptions_Tolerates(t *testing.T) {
+	tests := []struct {
+		opts   DiffOptions
+		pixels int
+		want   bool
+	}{
+		{DiffOptions{}, 0, false},
+		{DiffOptions{MaxDiffRatio: 0.01}, 10, true},
+		{DiffOptions{MaxDiffRatio: 0.01}, 11, false},
+		{DiffOptions{MaxDiffPixels: 5}, 5, true},
+		{DiffOptions{MaxDiffPixels: 5}, 6, false},
+		{DiffOptions{MaxDiffRatio: 0.01, MaxDiffPixels: 5}, 8, false},
+	}
+	for _, tt := range tests {
+		if got := tt.opts.Tolerates(tt.pixels, 1000); got != tt.want {
+			t.Errorf("%+v.Tolerates(%d, 1000) = %v, want %v", tt.opts, tt.pixels, got, tt.want)
+		}
+	}
+}
+
+func TestColorMetric_ParseThreshold(t *testing.T) {
+	tests := []struct {
+		metric ColorMetric
+		in     string
+		want   uint8
+		err    string
+	}{
+		{ColorMetricRGB, "30", 30, ""},
+		{ColorMetricRGB, " 0 ", 0, ""},
+		{ColorMetricRGB, "255", 255, ""},
+		{ColorMetricRGB, "12%", 31, ""}, // 30.6
+		{ColorMetricRGB, "2.5%", 6, ""}, // 6.375
+		{ColorMetricRGB, "100%", 255, ""},
+		{ColorMetricRGB, "0%", 0, ""},
+		{ColorMetricCIEDE2000, "5", 5, ""},
+		{ColorMetricCIEDE2000, "12%", 12, ""},
+		{ColorMetricCIEDE2000, "2.5%", 3, ""}, // 2.5 rounds half away from zero
+		{ColorMetricCIEDE2000, "100%", 100, ""},
+		{ColorMetricRGB, "256", 0, "threshold 256 is not between 0 and 255 for color metric rgb"},
+		{ColorMetricCIEDE2000, "101", 0, "threshold 101 is not between 0 and 100 for color metric ciede2000"},
+		{ColorMetricRGB, "-1", 0, "threshold -1 is not between 0 and 255"},
+		{ColorMetricRGB, "100.5%", 0, "threshold 100.5% is not between 0% and 100%"},
+		{ColorMetricCIEDE2000, "-3%", 0, "threshold -3% is not between 0% and 100%"},
+		{ColorMetricRGB, "12.5", 0, "invalid threshold '12.5'"},
+		{ColorMetricRGB, "%", 0, "invalid threshold '%'"},
+		{ColorMetricRGB, "NaN%", 0, "invalid threshold 'NaN%'"},
+	}
+	for _, tt := range tests {
+		got, err := tt.metric.ParseThreshold(tt.in)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s ParseThreshold(%q) error = %v, want %q", tt.metric, tt.in, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("%s ParseThreshold(%q) = %d, %v; want %d", tt.metric, tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestColorMetric_PercentThreshold(t *testing.T) {
+	for _, m := range []ColorMetric{ColorMetricRGB, ColorMetricCIEDE2000} {
+		if got := m.PercentThreshold(100); int(got) != m.MaxThreshold() {
+			t.Errorf("%s: 100%% = %d, want %d", m, got, m.MaxThreshold())
+		}
+		// Every integer threshold is reachable from its own percentage.
+		for n := 0; n <= m.MaxThreshold(); n++ {
+			if got := m.PercentThreshold(100 * float64(n) / float64(m.MaxThreshold())); int(got) != n {
+				t.Fatalf("%s: %d%% of the range = %d, want %d", m, n, got, n)
+			}
+		}
+	}
+}
+
+func TestMinDetectableChange(t *testing.T) {
+	tests := []struct {
+		window int
+		ratio  float64
+		want   int
+	}{
+		{0, 0.5, 1},
+		{7, 0, 1},
+		{1, 0.5, 1},
+		{7, 0.1, 3},      // 2x2=4 < 4.9 of 49 pixels, 3x3=9 is enough
+		{7, 4.0 / 49, 2}, // exactly at the ratio
+		{6, 0.1, 3},      // even sizes are widened to 7
+		{5, 1, 5},
+		{5, 0.01, 1},
+	}
+	for _, tt := range tests {
+		o := DiffOptions{NoiseWindowSize: tt.window, NoiseMinDiffRatio: tt.ratio}
+		if got := o.MinDetectableChange(); got != tt.want {
+			t.Errorf("MinDetectableChange(window=%d, ratio=%g) = %d, want %d", tt.window, tt.ratio, got, tt.want)
+		}
+	}
+
+	// The opening removes changes narrower than its square; closing removes nothing.
+	for _, tt := range []struct {
+		o    DiffOptions
+		want int
+	}{
+		{DiffOptions{Despeckle: 1}, 3},
+		{DiffOptions{Despeckle: 2, NoiseWindowSize: 7, NoiseMinDiffRatio: 0.1}, 5},
+		{DiffOptions{Despeckle: 1, NoiseWindowSize: 5, NoiseMinDiffRatio: 1}, 5},
+		{DiffOptions{Close: 3}, 1},
+	} {
+		if got := tt.o.MinDetectableChange(); got != tt.want {
+			t.Errorf("MinDetectableChange(%+v) = %d, want %d", tt.o, got, tt.want)
+		}
+	}
+}
+
+func TestParseGridSize(t *testing.T) {
+	for _, s := range []string{"12x8", "12X8", " 12 x 8 "} {
+		if got, err := ParseGridSize(s); err != nil || got != (GridSize{Cols: 12, Rows: 8}) {
+			t.Errorf("ParseGridSize(%q) = %v, %v, want 12x8", s, got, err)
+		}
+	}
+	for _, s := range []string{"", "12", "12x", "0x8", "12x-1", "axb", "1x2x3"} {
+		if _, err := ParseGridSize(s); err == nil {
+			t.Errorf("ParseGridSize(%q) succeeded", s)
+		}
+	}
+	if got := (GridSize{Cols: 12, Rows: 8}).String(); got != "12x8" {
+		t.Errorf("String() = %q", got)
+	}
+}
+
+func TestOptions_Validate(t *testing.T) {
+	if err := DefaultOptions().Validate(); err != nil {
+		t.Fatalf("default options: %v", err)
+	}
+	opts := DefaultOptions()
+	opts.Output.JPEGQuality = 0 // DefaultJPEGQuality
+	if err := opts.Validate(); err != nil {
+		t.Fatalf("JPEG quality 0: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(*Options)
+		want   []string
+	}{
+		{"negative grid", func(o *Options) { o.Grid.Rows = -1 }, []string{"grid rows must not be negative, got -1"}},
+		{"transparency above 1", func(o *Options) { o.Render.OverlayAlpha = 1.5 }, []string{"overlay transparency must be between 0.0 and 1.0, got 1.5"}},
+		{"negative tint strength", func(o *Options) { o.Render.TintStrength = -0.1 }, []string{"tint strength must be between 0.0 and 1.0, got -0.1"}},
+		{"delta E threshold", func(o *Options) { o.Diff.Metric, o.Diff.Threshold = ColorMetricCIEDE2000, 101 }, []string{"diff threshold must be between 0 and 100 for color metric ciede2000, got 101"}},
+		{"unknown metric", func(o *Options) { o.Diff.Metric = "lab" }, []string{"invalid color metric 'lab'"}},
+		{"noise ratio", func(o *Options) { o.Diff.NoiseMinDiffRatio = 2 }, []string{"noise min ratio must be between 0.0 and 1.0, got 2"}},
+		{"no workers", func(o *Options) { o.Runtime.Workers = 0 }, []string{"workers must be at least 1, got 0"}},
+		{"jpeg quality", func(o *Options) { o.Output.JPEGQuality = 101 }, []string{"JPEG quality must be between 1 and 100, or 0 for the default (90), got 101"}},
+		{"negative jpeg quality", func(o *Options) { o.Output.JPEGQuality = -1 }, []string{"JPEG quality must be between 1 and 100, or 0 for the default (90), got -1"}},
+		{"png compression", func(o *Options) { o.Output.PNGCompression = "max" }, []string{"invalid PNG compression 'max'"}},
+		{
+			"every problem reported",
+			func(o *Options) { o.Align.MaxOffsetX, o.Diff.MaxDiffRatio, o.Render.FillAlpha = -1, 1.1, -1 },
+			[]string{"max offset X must not be negative", "max diff ratio must be between", "fill alpha must be between"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultOptions()
+			tt.modify(&opts)
+			err := opts.Validate()
+			if err == nil {
+				t.Fatal("Validate() = nil")
+			}
+			for _, w := range tt.want {
+				if !strings.Contains(err.Error(), w) {
+					t.Errorf("Validate() = %q, want it to contain %q", err, w)
+				}
+			}
+			if lines := strings.Count(err.Error(), "\n") + 1; lines != len(tt.want) {
+				t.Errorf("%d problems reported, want %d: %q", lines, len(tt.want), err)
+			}
+		})
+	}
+}
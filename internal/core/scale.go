@@ -0,0 +1,153 @@
+package core
+
+import (
+	"fmt"
+	"image"
+	"math"
+)
+
+// maxScaleDenominator bounds the denominators of the ratios DetectScale
+// recognizes: 2, 3/2, 4/3 and 5/4 are found, 6/5 is not.
+const maxScaleDenominator = 4
+
+// scaleTolerance is the share of an image side by which it may deviate from
+// the exact multiple of the other image's side, for the rounding of odd
+// sizes; it is never less than one pixel.
+const scaleTolerance = 0.01
+
+// ScaleFactor is the ratio Num/Den of the size of input1 to that of input2,
+// uniform in both axes: 2 for a high density capture of a normal one, 1/2
+// the other way round. The zero value means no uniform ratio was found.
+type ScaleFactor struct {
+	Num, Den int
+}
+
+// IsZero reports whether no ratio was found.
+func (s ScaleFactor) IsZero() bool {
+	return s.Den == 0
+}
+
+// Value returns the ratio as a number, 0 for the zero value.
+func (s ScaleFactor) Value() float64 {
+	if s.Den == 0 {
+		return 0
+	}
+	return float64(s.Num) / float64(s.Den)
+}
+
+// String returns the ratio as "2" or "3/2".
+func (s ScaleFactor) String() string {
+	if s.Den == 1 {
+		return fmt.Sprint(s.Num)
+	}
+	return fmt.Sprintf("%d/%d", s.Num, s.Den)
+}
+
+// DetectScale returns the ratio of size a to size b when both sides of a are
+// the same simple multiple of those of b, within a tolerance for rounding:
+// 1/1 for sizes that are equal or off by a pixel, 2/1 for 200x100 and
+// 100x50, 2/3 for 200x100 and 300x150. It reports false for sizes whose
+// axes scale differently, such as 200x100 and 100x100, or by a ratio with a
+// denominator above maxScaleDenominator.
+func DetectScale(a, b image.Point) (ScaleFactor, bool) {
+	if a.X <= 0 || a.Y <= 0 || b.X <= 0 || b.Y <= 0 {
+		return ScaleFactor{}, false
+	}
+	// Search the ratio of the larger to the smaller size, so that both
+	// directions allow the same denominators.
+	large, small, inverted := a, b, false
+	if a.X*a.Y < b.X*b.Y {
+		large, small, inverted = b, a, true
+	}
+	fits := func(l, s, num, den int) bool {
+		return math.Abs(float64(l)-float64(s*num)/float64(den)) <= max(1, scaleTolerance*float64(l))
+	}
+	for den := 1; den <= maxScaleDenominator; den++ {
+		num := int(math.Round(float64(large.X*den) / float64(small.X)))
+		if num < den || !fits(large.X, small.X, num, den) || !fits(large.Y, small.Y, num, den) {
+			continue
+		}
+		if g := gcd(num, den); g > 1 {
+			num, den = num/g, den/g
+		}
+		if inverted {
+			num, den = den, num
+		}
+		return ScaleFactor{Num: num, Den: den}, true
+	}
+	return ScaleFactor{}, false
+}
+
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+// boxTap is the share of source pixel index covered by a resized pixel.
+type boxTap struct {
+	index  int
+	weight float64
+}
+
+// boxTaps returns, for every one of n resized pixels along an axis of src
+// pixels, the source pixels it covers and their weights, which sum to 1.
+func boxTaps(src, n int) [][]boxTap {
+	taps := make([][]boxTap, n)
+	step := float64(src) / float64(n)
+	for i := range taps {
+		lo, hi := float64(i)*step, float64(i+1)*step
+		for s := int(lo); s < src && float64(s) < hi; s++ {
+			if w := (min(hi, float64(s+1)) - max(lo, float64(s))) / step; w > 1e-9 {
+				taps[i] = append(taps[i], boxTap{index: s, weight: w})
+			}
+		}
+	}
+	return taps
+}
+
+// Downscale returns f resized to w x h with a box filter: every pixel is the
+// area-weighted mean of the source pixels it covers, so ratios such as 1.5
+// work as well as 2 (where it matches Downscale2x up to rounding). A pixel
+// is ignored if any source pixel it covers is. It returns f for its own size
+// or an empty one.
+func (f *Frame) Downscale(w, h int) *Frame {
+	if (w == f.W && h == f.H) || w <= 0 || h <= 0 {
+		return f
+	}
+	tapsX, tapsY := boxTaps(f.W, w), boxTaps(f.H, h)
+
+	nrgba := image.NewNRGBA(image.Rect(0, 0, w, h))
+	gray := make([]uint8, w*h)
+	down := &Frame{W: w, H: h, Pix: nrgba, Gray: gray}
+	if f.Ignore != nil {
+		down.Ignore = NewMask(w, h)
+	}
+	for y, ty := range tapsY {
+		for x, tx := range tapsX {
+			var sum [5]float64 // R, G, B, A and gray
+			ignored := false
+			for _, sy := range ty {
+				for _, sx := range tx {
+					wt := sy.weight * sx.weight
+					off := sy.index*f.Pix.Stride + sx.index*4
+					for c := 0; c < 4; c++ {
+						sum[c] += wt * float64(f.Pix.Pix[off+c])
+					}
+					sum[4] += wt * float64(f.Gray[sy.index*f.W+sx.index])
+					ignored = ignored || f.Ignored(sx.index, sy.index)
+				}
+			}
+			doff := y*nrgba.Stride + x*4
+			for c := 0; c < 4; c++ {
+				nrgba.Pix[doff+c] = uint8(math.Round(sum[c]))
+			}
+			gray[y*w+x] = uint8(math.Round(sum[4]))
+			if ignored {
+				down.Ignore.Set(x, y)
+			}
+		}
+	}
+	return down
+}
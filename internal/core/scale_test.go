@@ -0,0 +1,120 @@
+package core
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestDetectScale(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b image.Point
+		want ScaleFactor
+		ok   bool
+	}{
+		{"equal", image.Pt(100, 50), image.Pt(100, 50), ScaleFactor{1, 1}, true},
+		{"off by a pixel", image.Pt(101, 50), image.Pt(100, 50), ScaleFactor{1, 1}, true},
+		{"2x", image.Pt(2560, 1600), image.Pt(1280, 800), ScaleFactor{2, 1}, true},
+		{"half", image.Pt(1280, 800), image.Pt(2560, 1600), ScaleFactor{1, 2}, true},
+		{"2x of odd size", image.Pt(201, 100), image.Pt(101, 50), ScaleFactor{2, 1}, true},
+		{"3x", image.Pt(300, 180), image.Pt(100, 60), ScaleFactor{3, 1}, true},
+		{"1.5x", image.Pt(150, 90), image.Pt(100, 60), ScaleFactor{3, 2}, true},
+		{"1.5x rounded", image.Pt(152, 91), image.Pt(101, 61), ScaleFactor{3, 2}, true},
+		{"2/3", image.Pt(200, 100), image.Pt(300, 150), ScaleFactor{2, 3}, true},
+		{"5/4", image.Pt(125, 250), image.Pt(100, 200), ScaleFactor{5, 4}, true},
+		{"axes differ", image.Pt(200, 100), image.Pt(100, 100), ScaleFactor{}, false},
+		{"axes differ slightly", image.Pt(200, 110), image.Pt(100, 50), ScaleFactor{}, false},
+		{"not a simple ratio", image.Pt(137, 137), image.Pt(100, 100), ScaleFactor{}, false},
+		{"empty", image.Pt(0, 0), image.Pt(100, 100), ScaleFactor{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := DetectScale(tt.a, tt.b)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("%s: DetectScale(%v, %v) = %v, %v, want %v, %v", tt.name, tt.a, tt.b, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestScaleFactor_String(t *testing.T) {
+	for _, tt := range []struct {
+		s    ScaleFactor
+		want string
+		v    float64
+	}{{ScaleFactor{2, 1}, "2", 2}, {ScaleFactor{3, 2}, "3/2", 1.5}, {ScaleFactor{1, 2}, "1/2", 0.5}} {
+		if got := tt.s.String(); got != tt.want {
+			t.Errorf("%#v.String() = %q, want %q", tt.s, got, tt.want)
+		}
+		if got := tt.s.Value(); got != tt.v {
+			t.Errorf("%#v.Value() = %v, want %v", tt.s, got, tt.v)
+		}
+	}
+	if !(ScaleFactor{}).IsZero() || (ScaleFactor{1, 1}).IsZero() {
+		t.Error("IsZero is wrong")
+	}
+}
+
+func TestFrame_Downscale(t *testing.T) {
+	// Every 2x2 block of a 4x2 image becomes one pixel holding its mean.
+	img := image.NewNRGBA(image.Rect(0, 0, 4, 2))
+	for y := 0; y < 2; y++ {
+		for x := 0; x < 4; x++ {
+			v := uint8(10*x + 100*y)
+			img.SetNRGBA(x, y, color.NRGBA{v, 255 - v, 40, 255})
+		}
+	}
+	f := NewFrame(img)
+	d := f.Downscale(2, 1)
+	if d.W != 2 || d.H != 1 {
+		t.Fatalf("expected 2x1, got %dx%d", d.W, d.H)
+	}
+	// Block 0: 0, 10, 100, 110 -> 55; block 1: 20, 30, 120, 130 -> 75.
+	for x, want := range []color.NRGBA{{55, 200, 40, 255}, {75, 180, 40, 255}} {
+		if got := d.Pix.NRGBAAt(x, 0); got != want {
+			t.Errorf("pixel %d = %v, want %v", x, got, want)
+		}
+	}
+	if half := f.Downscale2x(); half.W != d.W || half.H != d.H {
+		t.Errorf("Downscale2x size %dx%d, Downscale %dx%d", half.W, half.H, d.W, d.H)
+	}
+}
+
+func TestFrame_Downscale1_5x(t *testing.T) {
+	// A row of 0, 90, 180 becomes 2 pixels covering 1.5 source pixels each:
+	// (0 + 90/2) / 1.5 = 30 and (90/2 + 180) / 1.5 = 150.
+	f := tinyFrame(color.NRGBA{0, 0, 0, 255}, color.NRGBA{90, 90, 90, 255}, color.NRGBA{180, 180, 180, 255})
+	d := f.Downscale(2, 1)
+	if d.W != 2 || d.H != 1 {
+		t.Fatalf("expected 2x1, got %dx%d", d.W, d.H)
+	}
+	for x, want := range []uint8{30, 150} {
+		if got := d.Pix.NRGBAAt(x, 0); got != (color.NRGBA{want, want, want, 255}) {
+			t.Errorf("pixel %d = %v, want %d", x, got, want)
+		}
+		if d.Gray[x] != want {
+			t.Errorf("gray %d = %d, want %d", x, d.Gray[x], want)
+		}
+	}
+
+	// An ignored source pixel marks every pixel covering it: the middle one
+	// is shared by both.
+	f.Ignore = NewMask(3, 1)
+	f.Ignore.Set(1, 0)
+	d = f.Downscale(2, 1)
+	if !d.Ignored(0, 0) || !d.Ignored(1, 0) {
+		t.Error("pixels covering the ignored source pixel are not ignored")
+	}
+	f.Ignore = NewMask(3, 1)
+	f.Ignore.Set(2, 0)
+	d = f.Downscale(2, 1)
+	if d.Ignored(0, 0) || !d.Ignored(1, 0) {
+		t.Error("only pixel 1 covers source pixel 2")
+	}
+}
+
+func TestFrame_DownscaleSameSize(t *testing.T) {
+	f := tinyFrame(color.NRGBA{1, 2, 3, 255})
+	if f.Downscale(1, 1) != f || f.Downscale(0, 1) != f {
+		t.Error("Downscale to the same or an empty size must return the frame")
+	}
+}
@@ -4,6 +4,9 @@ import (
 	"image"
 	"image/color"
 	"image/draw"
+	"math"
+	"runtime"
+	"time"
 )
 
 // Frame is a normalized image with origin at (0,0) in NRGBA format.
@@ -12,6 +15,46 @@ type Frame struct {
 	W, H int
 	Pix  *image.NRGBA
 	Gray []uint8 // row-major grayscale cache (W*H)
+
+	// Ignore marks pixels excluded from alignment scoring and diff detection
+	// (nil=none). It has the size of the frame.
+	Ignore *Mask
+}
+
+// WithIgnore returns a copy of f sharing its pixels, with ignore (which must
+// have the size of f) as the ignore mask.
+func (f *Frame) WithIgnore(ignore *Mask) *Frame {
+	c := *f
+	c.Ignore = ignore
+	return &c
+}
+
+// Ignored reports whether pixel (x, y) is excluded by the ignore mask.
+func (f *Frame) Ignored(x, y int) bool {
+	return f.Ignore != nil && f.Ignore.Data[y*f.W+x] != 0
+}
+
+// Crop returns the part r of f, clamped to f, as a frame with origin (0,0).
+// The pixels are shared with f via SubImage; the grayscale cache and the
+// ignore mask are copied.
+func (f *Frame) Crop(r image.Rectangle) *Frame {
+	r = r.Intersect(image.Rect(0, 0, f.W, f.H))
+	w, h := r.Dx(), r.Dy()
+	sub := f.Pix.SubImage(r).(*image.NRGBA)
+	c := &Frame{
+		W:    w,
+		H:    h,
+		Pix:  &image.NRGBA{Pix: sub.Pix, Stride: sub.Stride, Rect: image.Rect(0, 0, w, h)},
+		Gray: make([]uint8, w*h),
+	}
+	for y := 0; y < h; y++ {
+		off := (r.Min.Y+y)*f.W + r.Min.X
+		copy(c.Gray[y*w:(y+1)*w], f.Gray[off:off+w])
+	}
+	if f.Ignore != nil {
+		c.Ignore = f.Ignore.Crop(r)
+	}
+	return c
 }
 
 // NewFrame normalizes any image.Image into a Frame.
@@ -19,24 +62,173 @@ func NewFrame(img image.Image) *Frame {
 	bounds := img.Bounds()
 	w, h := bounds.Dx(), bounds.Dy()
 
-	nrgba := image.NewNRGBA(image.Rect(0, 0, w, h))
-	draw.Draw(nrgba, nrgba.Bounds(), img, bounds.Min, draw.Src)
+	nrgba := toNRGBA(img)
 
 	gray := make([]uint8, w*h)
 	for y := 0; y < h; y++ {
 		for x := 0; x < w; x++ {
 			off := y*nrgba.Stride + x*4
-			r := nrgba.Pix[off]
-			g := nrgba.Pix[off+1]
-			b := nrgba.Pix[off+2]
-			// ITU-R BT.601 luminance
-			gray[y*w+x] = uint8((19595*uint32(r) + 38470*uint32(g) + 7471*uint32(b) + 1<<15) >> 16)
+			gray[y*w+x] = luma(nrgba.Pix[off], nrgba.Pix[off+1], nrgba.Pix[off+2])
 		}
 	}
 
 	return &Frame{W: w, H: h, Pix: nrgba, Gray: gray}
 }
 
+// luma returns the ITU-R BT.601 luminance of a color.
+func luma(r, g, b uint8) uint8 {
+	return uint8((19595*uint32(r) + 38470*uint32(g) + 7471*uint32(b) + 1<<15) >> 16)
+}
+
+// Pad returns f extended on the right and bottom to w x h (each at least the
+// size of f), with the new pixels filled with bg. It returns f itself when no
+// padding is needed. The ignore mask is extended with unignored pixels.
+func (f *Frame) Pad(w, h int, bg color.NRGBA) *Frame {
+	if w <= f.W && h <= f.H {
+		return f
+	}
+	w, h = max(w, f.W), max(h, f.H)
+	nrgba := image.NewNRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(nrgba, nrgba.Rect, image.NewUniform(bg), image.Point{}, draw.Src)
+	draw.Draw(nrgba, image.Rect(0, 0, f.W, f.H), f.Pix, image.Point{}, draw.Src)
+
+	gray := make([]uint8, w*h)
+	bgLuma := luma(bg.R, bg.G, bg.B)
+	for y := 0; y < h; y++ {
+		row := gray[y*w : (y+1)*w]
+		n := 0
+		if y < f.H {
+			n = copy(row, f.Gray[y*f.W:(y+1)*f.W])
+		}
+		for x := n; x < w; x++ {
+			row[x] = bgLuma
+		}
+	}
+
+	padded := &Frame{W: w, H: h, Pix: nrgba, Gray: gray}
+	if f.Ignore != nil {
+		padded.Ignore = f.Ignore.Embed(w, h, image.Point{})
+	}
+	return padded
+}
+
+// normalizeMinStdDev is the standard deviation, in channel levels, below
+// which Normalize treats a channel as flat and only shifts it.
+const normalizeMinStdDev = 1
+
+// Normalize returns a copy of f with its red, green and blue channels each
+// mapped linearly to the mean and standard deviation of that channel in ref,
+// which cancels a uniform brightness or contrast shift between the two.
+// The statistics come from the histograms of the frames, so pixels ignored
+// in ref do not count. A channel of f that is (almost) flat is only shifted
+// to the mean of ref. Alpha and the ignore mask are kept.
+func (f *Frame) Normalize(ref *Frame) *Frame {
+	hf, hr := f.Histogram(), ref.Histogram()
+	if hf.Count == 0 || hr.Count == 0 {
+		return f
+	}
+	from, to := hf.stats(), hr.stats()
+	var lut [3][256]uint8
+	for c := range lut {
+		scale := 1.0
+		if from[c].stdDev >= normalizeMinStdDev {
+			scale = to[c].stdDev / from[c].stdDev
+		}
+		for v := range lut[c] {
+			mapped := math.Round((float64(v)-from[c].mean)*scale + to[c].mean)
+			lut[c][v] = uint8(max(0, min(255, mapped)))
+		}
+	}
+
+	nrgba := image.NewNRGBA(image.Rect(0, 0, f.W, f.H))
+	gray := make([]uint8, f.W*f.H)
+	for y := 0; y < f.H; y++ {
+		src := f.Pix.Pix[y*f.Pix.Stride : y*f.Pix.Stride+f.W*4]
+		dst := nrgba.Pix[y*nrgba.Stride : y*nrgba.Stride+f.W*4]
+		for x := 0; x < f.W; x++ {
+			p, q := src[x*4:x*4+4], dst[x*4:x*4+4]
+			q[0], q[1], q[2], q[3] = lut[0][p[0]], lut[1][p[1]], lut[2][p[2]], p[3]
+			gray[y*f.W+x] = luma(q[0], q[1], q[2])
+		}
+	}
+	return &Frame{W: f.W, H: f.H, Pix: nrgba, Gray: gray, Ignore: f.Ignore}
+}
+
+// Orientation describes how frame A was rotated before comparison.
+type Orientation string
+
+const (
+	OrientationOriginal  Orientation = ""
+	OrientationRotateCW  Orientation = "rotated-90-cw"
+	OrientationRotateCCW Orientation = "rotated-90-ccw"
+)
+
+// Rotate returns the frame rotated by o. OrientationOriginal returns f itself.
+func (f *Frame) Rotate(o Orientation) *Frame {
+	if o != OrientationRotateCW && o != OrientationRotateCCW {
+		return f
+	}
+	nw, nh := f.H, f.W
+	nrgba := image.NewNRGBA(image.Rect(0, 0, nw, nh))
+	gray := make([]uint8, nw*nh)
+	for y := 0; y < f.H; y++ {
+		for x := 0; x < f.W; x++ {
+			// Destination of source pixel (x, y)
+			dx, dy := f.H-1-y, x
+			if o == OrientationRotateCCW {
+				dx, dy = y, f.W-1-x
+			}
+			copy(nrgba.Pix[dy*nrgba.Stride+dx*4:dy*nrgba.Stride+dx*4+4], f.Pix.Pix[y*f.Pix.Stride+x*4:y*f.Pix.Stride+x*4+4])
+			gray[dy*nw+dx] = f.Gray[y*f.W+x]
+		}
+	}
+	return &Frame{W: nw, H: nh, Pix: nrgba, Gray: gray}
+}
+
+// AspectFactor returns how much the aspect ratios of two frames differ as a
+// factor >= 1 (1 = same aspect ratio).
+func AspectFactor(a, b *Frame) float64 {
+	return AspectFactorOf(image.Pt(a.W, a.H), image.Pt(b.W, b.H))
+}
+
+// AspectFactorOf is AspectFactor for image sizes.
+func AspectFactorOf(a, b image.Point) float64 {
+	if a.X == 0 || a.Y == 0 || b.X == 0 || b.Y == 0 {
+		return 1
+	}
+	ra := float64(a.X) / float64(a.Y)
+	rb := float64(b.X) / float64(b.Y)
+	return math.Max(ra/rb, rb/ra)
+}
+
+// toNRGBA converts img to a zero-origin NRGBA image. Common decoder outputs
+// take a fast path: NRGBA is copied row by row, and opaque YCbCr (JPEG) and
+// gray images are drawn through the RGBA fast path, whose bytes equal NRGBA
+// for opaque pixels. Other images fall back to per-pixel conversion.
+func toNRGBA(img image.Image) *image.NRGBA {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	rect := image.Rect(0, 0, w, h)
+
+	switch src := img.(type) {
+	case *image.NRGBA:
+		dst := image.NewNRGBA(rect)
+		for y := 0; y < h; y++ {
+			off := src.PixOffset(bounds.Min.X, bounds.Min.Y+y)
+			copy(dst.Pix[y*dst.Stride:y*dst.Stride+w*4], src.Pix[off:off+w*4])
+		}
+		return dst
+	case *image.YCbCr, *image.Gray:
+		rgba := image.NewRGBA(rect)
+		draw.Draw(rgba, rect, src, bounds.Min, draw.Src)
+		return &image.NRGBA{Pix: rgba.Pix, Stride: rgba.Stride, Rect: rect}
+	}
+
+	dst := image.NewNRGBA(rect)
+	draw.Draw(dst, rect, img, bounds.Min, draw.Src)
+	return dst
+}
+
 // Downscale2x returns a new Frame at half resolution using box averaging.
 func (f *Frame) Downscale2x() *Frame {
 	nw, nh := f.W/2, f.H/2
@@ -72,13 +264,131 @@ func (f *Frame) Downscale2x() *Frame {
 		}
 	}
 
-	return &Frame{W: nw, H: nh, Pix: nrgba, Gray: gray}
+	down := &Frame{W: nw, H: nh, Pix: nrgba, Gray: gray}
+	if f.Ignore != nil {
+		// A coarse pixel is ignored if any of its source pixels is.
+		down.Ignore = NewMask(nw, nh)
+		for y := 0; y < nh; y++ {
+			for x := 0; x < nw; x++ {
+				if f.Ignored(2*x, 2*y) || f.Ignored(2*x+1, 2*y) || f.Ignored(2*x, 2*y+1) || f.Ignored(2*x+1, 2*y+1) {
+					down.Ignore.Set(x, y)
+				}
+			}
+		}
+	}
+	return down
 }
 
 // Alignment represents the detected positional offset between two images.
 type Alignment struct {
 	DX, DY int
 	Score  float64 // higher is better (0..1)
+
+	// RunnerUp is the best scoring offset that is not adjacent to (DX, DY),
+	// and Confidence compares the two (see AlignmentConfidence). Confidence
+	// is 0 when no runner-up was scored, e.g. for a forced offset.
+	RunnerUp   OffsetScore
+	Confidence float64
+
+	// SSIM is the mean structural similarity (-1..1) of the overlap at
+	// (DX, DY), computed with AlignMetricSSIM only (0 otherwise).
+	SSIM float64
+}
+
+// OffsetScore is a candidate offset and its alignment score.
+type OffsetScore struct {
+	DX, DY int
+	Score  float64
+}
+
+// AlignmentConfidence returns (runner-up MAE + 1) / (best MAE + 1) for two
+// alignment scores, with the mean absolute error in gray levels. 1 means the
+// runner-up fits as well as the best offset, so the choice is arbitrary, as on
+// a blank page; larger values mean a clearer winner.
+func AlignmentConfidence(best, runnerUp float64) float64 {
+	return ((1-runnerUp)*255 + 1) / ((1-best)*255 + 1)
+}
+
+// Magnitude returns the offset size as max(|DX|, |DY|), matching the
+// rectangular search window bounded by AlignOptions.MaxOffsetX/Y.
+func (a Alignment) Magnitude() int {
+	return max(abs(a.DX), abs(a.DY))
+}
+
+// UncoveredBands returns the parts of a sizeB frame that have no counterpart
+// in a sizeA frame under the offset: up to four strips (top, bottom, then left
+// and right between them). The whole frame is returned when nothing overlaps.
+func (a Alignment) UncoveredBands(sizeA, sizeB image.Point) []image.Rectangle {
+	frame := image.Rectangle{Max: sizeB}
+	covered := image.Rect(a.DX, a.DY, a.DX+sizeA.X, a.DY+sizeA.Y).Intersect(frame)
+	if covered.Empty() {
+		if frame.Empty() {
+			return nil
+		}
+		return []image.Rectangle{frame}
+	}
+
+	candidates := []image.Rectangle{
+		image.Rect(0, 0, sizeB.X, covered.Min.Y),
+		image.Rect(0, covered.Max.Y, sizeB.X, sizeB.Y),
+		image.Rect(0, covered.Min.Y, covered.Min.X, covered.Max.Y),
+		image.Rect(covered.Max.X, covered.Min.Y, sizeB.X, covered.Max.Y),
+	}
+	var bands []image.Rectangle
+	for _, r := range candidates {
+		if !r.Empty() {
+			bands = append(bands, r)
+		}
+	}
+	return bands
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// ScoreSurface holds the alignment score for every offset in
+// [-Radius, Radius] x [-Radius, Radius]. Unscorable offsets (too little
+// overlap) are stored as NaN.
+type ScoreSurface struct {
+	Radius int
+	Scores []float64 // row-major, Size() x Size(), index (dy+Radius)*Size() + (dx+Radius)
+	Chosen Alignment // offset returned by the alignment search
+}
+
+// NewScoreSurface creates a surface with every score set to NaN.
+func NewScoreSurface(radius int) *ScoreSurface {
+	radius = max(0, radius)
+	size := 2*radius + 1
+	scores := make([]float64, size*size)
+	for i := range scores {
+		scores[i] = math.NaN()
+	}
+	return &ScoreSurface{Radius: radius, Scores: scores}
+}
+
+// Size returns the width and height of the surface grid.
+func (s *ScoreSurface) Size() int {
+	return 2*s.Radius + 1
+}
+
+// At returns the score recorded for offset (dx, dy), or NaN if it is out of range.
+func (s *ScoreSurface) At(dx, dy int) float64 {
+	if dx < -s.Radius || dx > s.Radius || dy < -s.Radius || dy > s.Radius {
+		return math.NaN()
+	}
+	return s.Scores[(dy+s.Radius)*s.Size()+(dx+s.Radius)]
+}
+
+// Set records the score for offset (dx, dy). Out-of-range offsets are ignored.
+func (s *ScoreSurface) Set(dx, dy int, score float64) {
+	if dx < -s.Radius || dx > s.Radius || dy < -s.Radius || dy > s.Radius {
+		return
+	}
+	s.Scores[(dy+s.Radius)*s.Size()+(dx+s.Radius)] = score
 }
 
 // RowAlignment maps each row in frame B to a source row in frame A.
@@ -127,6 +437,35 @@ func NewRowAlignmentFromAlignment(width, height int, al Alignment) RowAlignment
 	return ra
 }
 
+// Embed lifts ra, computed on the crop r of both frames, to a width x height
+// frame: inside the columns of r rows map as in ra, elsewhere as by the
+// global alignment al.
+func (ra RowAlignment) Embed(width, height int, r image.Rectangle, al Alignment) RowAlignment {
+	full := NewRowAlignmentFromAlignment(width, height, al)
+	full.Score = ra.Score
+	lift := func(minX, maxX int, srcYByY, dxByY []int) RowAlignmentRange {
+		lr := RowAlignmentRange{
+			MinX:    minX + r.Min.X,
+			MaxX:    maxX + r.Min.X,
+			SrcYByY: append([]int(nil), full.SrcYByY...),
+			DXByY:   append([]int(nil), full.DXByY...),
+		}
+		for y, srcY := range srcYByY {
+			if srcY >= 0 {
+				srcY += r.Min.Y
+			}
+			lr.SrcYByY[r.Min.Y+y] = srcY
+			lr.DXByY[r.Min.Y+y] = dxByY[y]
+		}
+		return lr
+	}
+	full.Ranges = append(full.Ranges, lift(0, r.Dx(), ra.SrcYByY, ra.DXByY))
+	for _, rr := range ra.Ranges {
+		full.Ranges = append(full.Ranges, lift(rr.MinX, rr.MaxX, rr.SrcYByY, rr.DXByY))
+	}
+	return full
+}
+
 // SrcY returns the mapped source row for the given row in B.
 func (ra RowAlignment) SrcY(y int) int {
 	if y < 0 || y >= len(ra.SrcYByY) {
@@ -225,6 +564,38 @@ func (ra RowAlignment) rangeForX(x int) (RowAlignmentRange, bool) {
 	return RowAlignmentRange{}, false
 }
 
+// RowBandKind tells which input the rows of a RowBand exist in.
+type RowBandKind string
+
+const (
+	RowBandInserted RowBandKind = "inserted" // rows of B without a counterpart in A
+	RowBandDeleted  RowBandKind = "deleted"  // rows of A without a counterpart in B
+)
+
+// RowBand is a run of whole rows that only one input has, found by
+// VerticalAlignOptions.DetectScroll. Inserted bands cover rows [Y0,Y1) of B
+// and sit before row SrcY0 (== SrcY1) of A; deleted bands cover rows
+// [SrcY0,SrcY1) of A and sit before row Y0 (== Y1) of B.
+type RowBand struct {
+	Kind         RowBandKind
+	Y0, Y1       int
+	SrcY0, SrcY1 int
+}
+
+// Height returns the number of rows in the band.
+func (b RowBand) Height() int {
+	if b.Kind == RowBandDeleted {
+		return b.SrcY1 - b.SrcY0
+	}
+	return b.Y1 - b.Y0
+}
+
+// Add returns the band moved down by dy rows in both inputs.
+func (b RowBand) Add(dy int) RowBand {
+	b.Y0, b.Y1, b.SrcY0, b.SrcY1 = b.Y0+dy, b.Y1+dy, b.SrcY0+dy, b.SrcY1+dy
+	return b
+}
+
 // Mask is a full-resolution binary diff mask (row-major, 0=same, 1=diff).
 type Mask struct {
 	W, H  int
@@ -248,6 +619,16 @@ func (m *Mask) Set(x, y int) {
 	}
 }
 
+// SetRect marks every pixel of r inside the mask.
+func (m *Mask) SetRect(r image.Rectangle) {
+	r = r.Intersect(image.Rect(0, 0, m.W, m.H))
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			m.Set(x, y)
+		}
+	}
+}
+
 // Get returns true if pixel (x,y) is marked as different.
 func (m *Mask) Get(x, y int) bool {
 	if x >= 0 && x < m.W && y >= 0 && y < m.H {
@@ -256,20 +637,305 @@ func (m *Mask) Get(x, y int) bool {
 	return false
 }
 
+// CountIn returns the number of diff pixels inside r (clipped to the mask).
+func (m *Mask) CountIn(r image.Rectangle) int {
+	r = r.Intersect(image.Rect(0, 0, m.W, m.H))
+	count := 0
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		row := m.Data[y*m.W : (y+1)*m.W]
+		for x := r.Min.X; x < r.Max.X; x++ {
+			if row[x] != 0 {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+// GridCell is one cell of a grid laid over a mask (see Mask.Grid).
+type GridCell struct {
+	Col, Row   int
+	Bounds     image.Rectangle
+	DiffPixels int // number of diff pixels inside Bounds
+}
+
+// Ratio returns the share of the pixels of the cell that differ.
+func (c GridCell) Ratio() float64 {
+	area := c.Bounds.Dx() * c.Bounds.Dy()
+	if area == 0 {
+		return 0
+	}
+	return float64(c.DiffPixels) / float64(area)
+}
+
+// Grid divides the mask into size.Cols x size.Rows cells, listed row by row,
+// and counts the diff pixels of each. Cell boundaries are at i*W/Cols and
+// j*H/Rows, so when the size does not divide evenly the cells differ by at
+// most a pixel and the last column and row end exactly at the mask's edges.
+// A grid finer than the mask has empty cells. It returns nil for a zero size.
+func (m *Mask) Grid(size GridSize) []GridCell {
+	if size.IsZero() {
+		return nil
+	}
+	cells := make([]GridCell, 0, size.Cols*size.Rows)
+	for row := 0; row < size.Rows; row++ {
+		y0, y1 := row*m.H/size.Rows, (row+1)*m.H/size.Rows
+		for col := 0; col < size.Cols; col++ {
+			x0, x1 := col*m.W/size.Cols, (col+1)*m.W/size.Cols
+			r := image.Rect(x0, y0, x1, y1)
+			cells = append(cells, GridCell{Col: col, Row: row, Bounds: r, DiffPixels: m.CountIn(r)})
+		}
+	}
+	return cells
+}
+
+// MaskFromImage converts an ignore mask image into a Mask of its size. If the
+// image has any transparency, its non-transparent pixels (alpha >= 128) are
+// set; otherwise its light pixels (luminance >= 128) are.
+func MaskFromImage(img image.Image) *Mask {
+	f := NewFrame(img)
+	transparent := false
+	for i := 3; i < len(f.Pix.Pix); i += 4 {
+		if f.Pix.Pix[i] < 255 {
+			transparent = true
+			break
+		}
+	}
+	m := NewMask(f.W, f.H)
+	for y := 0; y < f.H; y++ {
+		for x := 0; x < f.W; x++ {
+			if transparent && f.Pix.Pix[y*f.Pix.Stride+x*4+3] >= 128 || !transparent && f.Gray[y*f.W+x] >= 128 {
+				m.Set(x, y)
+			}
+		}
+	}
+	return m
+}
+
+// ClearRect unmarks every pixel of r inside the mask.
+func (m *Mask) ClearRect(r image.Rectangle) {
+	r = r.Intersect(image.Rect(0, 0, m.W, m.H))
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		row := m.Data[y*m.W+r.Min.X : y*m.W+r.Max.X]
+		for x, v := range row {
+			if v != 0 {
+				row[x] = 0
+				m.Count--
+			}
+		}
+	}
+}
+
+// Crop returns the part r of the mask, clamped to it, with origin (0,0).
+func (m *Mask) Crop(r image.Rectangle) *Mask {
+	r = r.Intersect(image.Rect(0, 0, m.W, m.H))
+	c := NewMask(r.Dx(), r.Dy())
+	for y := 0; y < c.H; y++ {
+		off := (r.Min.Y+y)*m.W + r.Min.X
+		copy(c.Data[y*c.W:(y+1)*c.W], m.Data[off:off+c.W])
+	}
+	c.Count = c.CountIn(image.Rect(0, 0, c.W, c.H))
+	return c
+}
+
+// Embed returns a w x h mask with m placed at offset and nothing set
+// elsewhere. Parts of m outside w x h are dropped.
+func (m *Mask) Embed(w, h int, offset image.Point) *Mask {
+	e := NewMask(w, h)
+	for y := 0; y < m.H; y++ {
+		for x := 0; x < m.W; x++ {
+			if m.Data[y*m.W+x] != 0 {
+				e.Set(x+offset.X, y+offset.Y)
+			}
+		}
+	}
+	return e
+}
+
+// Resize scales the mask to w x h with nearest-neighbor sampling.
+func (m *Mask) Resize(w, h int) *Mask {
+	r := NewMask(w, h)
+	if m.W == 0 || m.H == 0 {
+		return r
+	}
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if m.Data[(y*m.H/h)*m.W+x*m.W/w] != 0 {
+				r.Set(x, y)
+			}
+		}
+	}
+	return r
+}
+
 // Region represents a detected diff region with bounding box and pixel count.
 type Region struct {
-	Bounds image.Rectangle
-	Area   int // number of diff pixels in this region
+	Bounds   image.Rectangle
+	Area     int     // number of diff pixels in this region
+	Severity float64 // share of Bounds that differs, weighted by MeanDiff once scored (0.0-1.0)
+	MeanDiff float64 // mean difference of its diff pixels on the metric's scale (0 until scored)
+
+	// Contour is the outline traced with RegionOutlineContour (nil
+	// otherwise). It is a pointer so that regions stay comparable.
+	Contour *Contour
+}
+
+// Contour is the outline of a region: the closed outer boundaries of the
+// diff components inside its bounds, as polygons of pixel positions.
+type Contour struct {
+	Polygons [][]image.Point
 }
 
 // Result holds the output of the diff pipeline.
 type Result struct {
+	FrameA     *Frame
+	FrameB     *Frame
 	Aligned    Alignment
 	RowAligned RowAlignment
-	HasDiff    bool
+	HasDiff    bool // some pixel differs beyond the DiffOptions tolerance, even if it forms no region (see Differs)
 	Regions    []Region
 	DiffMask   *Mask
-	Output     image.Image
+	Output     image.Image   // annotated diff image (before layout is applied)
+	Phases     []PhaseSample // per-phase timing and memory (only with RuntimeOptions.ReportMemory)
+
+	// RowBands are the runs of rows only one input has, with
+	// VerticalAlignOptions.DetectScroll. Their rows are not part of DiffMask
+	// or Regions, but make the images differ.
+	RowBands []RowBand
+
+	// Orientation records the rotation applied to frame A (and FrameA) when
+	// the aspect ratios differed too much to compare the images as-is.
+	Orientation Orientation
+
+	// ROI is the compared area when Options.ROI was set, after clamping
+	// (empty=whole images). Everything else is in full-image coordinates.
+	ROI image.Rectangle
+
+	// Unfiltered is set when DiffOptions.VerifyClean found differences that
+	// the noise filter had removed; DiffMask then holds the unfiltered mask.
+	Unfiltered bool
+
+	// LocallyAligned are the regions removed from Regions and DiffMask
+	// because they match under a local offset (see LocalAlignOptions).
+	LocallyAligned []LocalAlignment
+
+	// Suppressed are the regions removed from Regions for having fewer than
+	// RegionOptions.MinPixels diff pixels. Their pixels stay in DiffMask.
+	Suppressed []Region
+
+	// DroppedRegions is the number of regions removed from the end of
+	// Regions by RegionOptions.MaxRegions. Their pixels stay in DiffMask.
+	DroppedRegions int
+
+	// Prefiltered is set when Options.PHashPrefilter found equal hashes: the
+	// images were not compared, and the result reports no differences.
+	Prefiltered bool
+
+	// MSE is the mean squared R, G and B error of the aligned images over the
+	// compared pixels (see PSNR), independent of the diff threshold.
+	MSE float64
+
+	// ComparedPixels is the number of pixels of frame B the diff mask can
+	// mark: those compared with a pixel of frame A, plus those in rows
+	// without a counterpart outside RowBands, which always differ. Ignored
+	// pixels, pixels outside the ROI and pixels without a counterpart in the
+	// same row are not counted. DiffRatio divides by it.
+	ComparedPixels int
+
+	// Scale is the ratio of the size of input1 to that of input2 when they
+	// differ by a uniform simple ratio (zero otherwise), and Scaled records
+	// that Options.AutoScale downsampled the larger one to match: FrameA or
+	// FrameB then has the size of the other.
+	Scale  ScaleFactor
+	Scaled bool
+
+	// Histogram compares the color histograms of the inputs as given, before
+	// any normalization, over the pixels of input2 that are not ignored.
+	Histogram HistogramDistance
+
+	// StartedAt and FinishedAt are the wall-clock times of a whole run,
+	// including loading and saving (zero when only comparing in memory).
+	StartedAt, FinishedAt time.Time
+}
+
+// LocalAlignment is a diff region suppressed by local re-alignment: within
+// Region.Bounds, B matches A shifted by (DX, DY) instead of the global offset.
+type LocalAlignment struct {
+	Region Region
+	DX, DY int
+}
+
+// PhaseSample is the duration of one pipeline phase and the Go runtime memory
+// statistics (runtime.MemStats) read when it ended. The figures cover the Go
+// heap and runtime only, not the whole process.
+type PhaseSample struct {
+	Phase      string
+	Duration   time.Duration
+	HeapAlloc  uint64 // bytes of allocated heap objects
+	TotalAlloc uint64 // cumulative bytes allocated (never decreases)
+	Sys        uint64 // bytes obtained from the OS by the Go runtime
+}
+
+// SamplePhase reads the current memory statistics for a phase that started at start.
+func SamplePhase(phase string, start time.Time) PhaseSample {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return PhaseSample{
+		Phase:      phase,
+		Duration:   time.Since(start),
+		HeapAlloc:  m.HeapAlloc,
+		TotalAlloc: m.TotalAlloc,
+		Sys:        m.Sys,
+	}
+}
+
+// DiffPixels returns the number of differing pixels in the diff mask.
+func (r *Result) DiffPixels() int {
+	if r == nil || r.DiffMask == nil {
+		return 0
+	}
+	return r.DiffMask.Count
+}
+
+// UncoveredBands returns the areas of frame B without a counterpart in frame A
+// under the detected global offset (see Alignment.UncoveredBands).
+func (r *Result) UncoveredBands() []image.Rectangle {
+	if r == nil || r.FrameA == nil || r.FrameB == nil {
+		return nil
+	}
+	return r.Aligned.UncoveredBands(image.Pt(r.FrameA.W, r.FrameA.H), image.Pt(r.FrameB.W, r.FrameB.H))
+}
+
+// Render returns the annotated diff image (before layout is applied), or nil
+// if the result was produced without rendering.
+func (r *Result) Render() image.Image {
+	return r.Output
+}
+
+// DiffRatio returns the fraction of the compared pixels (ComparedPixels)
+// that differ.
+func (r *Result) DiffRatio() float64 {
+	if r == nil || r.ComparedPixels == 0 {
+		return 0
+	}
+	return float64(r.DiffPixels()) / float64(r.ComparedPixels)
+}
+
+// PSNR returns the peak signal-to-noise ratio in dB of the aligned images,
+// 10*log10(255^2/MSE): +Inf when they are identical.
+func (r *Result) PSNR() float64 {
+	if r.MSE == 0 {
+		return math.Inf(1)
+	}
+	return 10 * math.Log10(255*255/r.MSE)
+}
+
+// Differs sets HasDiff from the differing pixels of the diff mask and the
+// number tolerated by opts out of ComparedPixels (see DiffOptions.Tolerates). Row bands always
+// differ. The region filters do not affect it: a change too small to form a
+// region still differs.
+func (r *Result) Differs(opts DiffOptions) {
+	r.HasDiff = r.DiffPixels() > 0 && !opts.Tolerates(r.DiffPixels(), r.ComparedPixels) || len(r.RowBands) > 0
 }
 
 // Layout defines the output image layout.
@@ -278,6 +944,7 @@ type Layout string
 const (
 	LayoutSimple     Layout = "simple"
 	LayoutHorizontal Layout = "horizontal"
+	LayoutSideBySide Layout = "side-by-side"
 )
 
 // BlendColors blends src color over dst with configurable overlay and tint.
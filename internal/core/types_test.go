@@ -1,8 +1,11 @@
 package core
 
 import (
+	"bytes"
 	"image"
 	"image/color"
+	"image/draw"
+	"math"
 	"testing"
 )
 
@@ -27,6 +30,62 @@ func TestNewFrame(t *testing.T) {
 	}
 }
 
+// TestNewFrame_FastPathsMatchGeneric checks that the fast conversion paths
+// produce exactly the pixels of a per-pixel NRGBA conversion.
+func TestNewFrame_FastPathsMatchGeneric(t *testing.T) {
+	rect := image.Rect(3, 2, 37, 29)
+	ycbcr := image.NewYCbCr(rect, image.YCbCrSubsampleRatio420)
+	for i := range ycbcr.Y {
+		ycbcr.Y[i] = uint8(i * 7)
+	}
+	for i := range ycbcr.Cb {
+		ycbcr.Cb[i] = uint8(i * 13)
+		ycbcr.Cr[i] = uint8(255 - i*5)
+	}
+	gray := image.NewGray(rect)
+	nrgba := image.NewNRGBA(rect)
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			gray.SetGray(x, y, color.Gray{uint8(x * y)})
+			nrgba.SetNRGBA(x, y, color.NRGBA{uint8(x * 9), uint8(y * 5), uint8(x + y), uint8(x * y)})
+		}
+	}
+
+	for name, img := range map[string]image.Image{"ycbcr": ycbcr, "gray": gray, "nrgba": nrgba} {
+		t.Run(name, func(t *testing.T) {
+			f := NewFrame(img)
+			for y := 0; y < f.H; y++ {
+				for x := 0; x < f.W; x++ {
+					want := color.NRGBAModel.Convert(img.At(rect.Min.X+x, rect.Min.Y+y)).(color.NRGBA)
+					if got := f.Pix.NRGBAAt(x, y); got != want {
+						t.Fatalf("pixel (%d,%d) = %v, want %v", x, y, got, want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkNewFrame(b *testing.B) {
+	rect := image.Rect(0, 0, 1280, 800)
+	ycbcr := image.NewYCbCr(rect, image.YCbCrSubsampleRatio420)
+	for i := range ycbcr.Y {
+		ycbcr.Y[i] = uint8(i)
+	}
+
+	b.Run("ycbcr", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			NewFrame(ycbcr)
+		}
+	})
+	b.Run("ycbcr-generic", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			dst := image.NewNRGBA(rect)
+			draw.Draw(dst, rect, ycbcr, image.Point{}, draw.Src)
+		}
+	})
+}
+
 func TestNewFrame_NonZeroOrigin(t *testing.T) {
 	img := image.NewNRGBA(image.Rect(10, 20, 30, 40))
 	for y := 20; y < 40; y++ {
@@ -57,6 +116,39 @@ func TestDownscale2x(t *testing.T) {
 	}
 }
 
+func TestDownscale2x_BoxFilter(t *testing.T) {
+	// 5x3 image: the odd last column and row are dropped and every output
+	// pixel is the mean of its 2x2 source block (truncated).
+	img := image.NewNRGBA(image.Rect(0, 0, 5, 3))
+	for y := 0; y < 3; y++ {
+		for x := 0; x < 5; x++ {
+			v := uint8(10*x + 100*y)
+			img.SetNRGBA(x, y, color.NRGBA{v, 255 - v, uint8(x), 255})
+		}
+	}
+
+	d := NewFrame(img).Downscale2x()
+	if d.W != 2 || d.H != 1 {
+		t.Fatalf("expected 2x1, got %dx%d", d.W, d.H)
+	}
+	// Block (0,0): values 0, 10, 100, 110 -> 55; block (1,0): 20, 30, 120, 130 -> 75.
+	for x, want := range []color.NRGBA{{55, 200, 0, 255}, {75, 180, 2, 255}} {
+		if got := d.Pix.NRGBAAt(x, 0); got != want {
+			t.Errorf("pixel %d = %v, want %v", x, got, want)
+		}
+	}
+	for x, src := range [][4]int{{0, 1, 5, 6}, {2, 3, 7, 8}} {
+		f := NewFrame(img)
+		sum := 0
+		for _, i := range src {
+			sum += int(f.Gray[i])
+		}
+		if got := int(d.Gray[x]); got != sum/4 {
+			t.Errorf("gray %d = %d, want %d", x, got, sum/4)
+		}
+	}
+}
+
 func TestDownscale2x_TooSmall(t *testing.T) {
 	img := image.NewNRGBA(image.Rect(0, 0, 1, 1))
 	img.SetNRGBA(0, 0, color.NRGBA{255, 255, 255, 255})
@@ -70,6 +162,128 @@ func TestDownscale2x_TooSmall(t *testing.T) {
 	}
 }
 
+func TestFrame_Pad(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 3, 2))
+	for y := 0; y < 2; y++ {
+		for x := 0; x < 3; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{uint8(40 * x), uint8(80 * y), 10, 255})
+		}
+	}
+	f := NewFrame(img)
+	f.Ignore = NewMask(3, 2)
+	f.Ignore.Set(2, 1)
+	bg := color.NRGBA{0, 0, 255, 128}
+
+	p := f.Pad(4, 3, bg)
+	if p.W != 4 || p.H != 3 || p.Pix.Rect != image.Rect(0, 0, 4, 3) || len(p.Gray) != 12 {
+		t.Fatalf("padded frame %dx%d (pix %v, gray %d)", p.W, p.H, p.Pix.Rect, len(p.Gray))
+	}
+	for y := 0; y < 3; y++ {
+		for x := 0; x < 4; x++ {
+			inside := x < 3 && y < 2
+			wantPix, wantGray := bg, luma(bg.R, bg.G, bg.B)
+			if inside {
+				wantPix, wantGray = img.NRGBAAt(x, y), f.Gray[y*3+x]
+			}
+			if got := p.Pix.NRGBAAt(x, y); got != wantPix {
+				t.Errorf("pixel (%d,%d) = %v, want %v", x, y, got, wantPix)
+			}
+			if got := p.Gray[y*4+x]; got != wantGray {
+				t.Errorf("gray (%d,%d) = %d, want %d", x, y, got, wantGray)
+			}
+			if got := p.Ignored(x, y); got != (x == 2 && y == 1) {
+				t.Errorf("ignored (%d,%d) = %v", x, y, got)
+			}
+		}
+	}
+
+	if f.Pad(3, 2, bg) != f || f.Pad(2, 1, bg) != f {
+		t.Error("padding to a size within the frame should return it unchanged")
+	}
+	if p := f.Pad(5, 1, bg); p.W != 5 || p.H != 2 {
+		t.Errorf("pad to 5x1 = %dx%d, want 5x2 (never smaller than the frame)", p.W, p.H)
+	}
+}
+
+func TestFrame_Normalize(t *testing.T) {
+	// b is a brighter, higher-contrast version of a: red is 2a+10, green
+	// 3a+5. Blue is flat in a and b, and alpha must be kept.
+	a, b := image.NewNRGBA(image.Rect(0, 0, 8, 4)), image.NewNRGBA(image.Rect(0, 0, 8, 4))
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 8; x++ {
+			v, g := uint8(10*x+5*y), uint8(3*x+y)
+			a.SetNRGBA(x, y, color.NRGBA{v, g, 40, uint8(200 + x)})
+			b.SetNRGBA(x, y, color.NRGBA{2*v + 10, 3*g + 5, 90, 255})
+		}
+	}
+	fa, fb := NewFrame(a), NewFrame(b)
+	fa.Ignore = NewMask(8, 4)
+
+	n := fa.Normalize(fb)
+	if n == fa || n.Ignore != fa.Ignore {
+		t.Fatal("Normalize must return a copy keeping the ignore mask")
+	}
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 8; x++ {
+			got, want := n.Pix.NRGBAAt(x, y), b.NRGBAAt(x, y)
+			want.A = a.NRGBAAt(x, y).A
+			if got != want {
+				t.Fatalf("pixel (%d,%d) = %v, want %v", x, y, got, want)
+			}
+			if g := n.Gray[y*8+x]; g != luma(got.R, got.G, got.B) {
+				t.Fatalf("gray (%d,%d) = %d, want the luma of the normalized pixel", x, y, g)
+			}
+		}
+	}
+	if a.NRGBAAt(3, 1) != fa.Pix.NRGBAAt(3, 1) {
+		t.Error("Normalize modified its input")
+	}
+
+	// Pixels ignored in the reference do not count: painting them white
+	// changes nothing.
+	fb.Ignore = NewMask(8, 4)
+	fb.Ignore.SetRect(image.Rect(0, 0, 2, 4))
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 2; x++ {
+			fb.Pix.SetNRGBA(x, y, color.NRGBA{255, 255, 255, 255})
+		}
+	}
+	got, want := fa.Normalize(fb), fa.Normalize(NewFrame(b.SubImage(image.Rect(2, 0, 8, 4))))
+	if !bytes.Equal(got.Pix.Pix, want.Pix.Pix) {
+		t.Error("pixels ignored in the reference changed the result")
+	}
+}
+
+func TestFrame_NormalizeFlat(t *testing.T) {
+	flat, textured := image.NewNRGBA(image.Rect(0, 0, 4, 4)), image.NewNRGBA(image.Rect(0, 0, 4, 4))
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4; x++ {
+			flat.SetNRGBA(x, y, color.NRGBA{100, 100, 100, 255})
+			textured.SetNRGBA(x, y, color.NRGBA{uint8(60 * x), 130, 0, 255})
+		}
+	}
+
+	// A flat channel is only shifted to the mean of the reference.
+	n := NewFrame(flat).Normalize(NewFrame(textured))
+	if got, want := n.Pix.NRGBAAt(1, 1), (color.NRGBA{90, 130, 0, 255}); got != want {
+		t.Errorf("flat channel normalized to %v, want %v", got, want)
+	}
+	// A flat reference flattens the channel to its mean.
+	n = NewFrame(textured).Normalize(NewFrame(flat))
+	for x := 0; x < 4; x++ {
+		if got, want := n.Pix.NRGBAAt(x, 2), (color.NRGBA{100, 100, 100, 255}); got != want {
+			t.Errorf("pixel (%d,2) = %v, want %v", x, got, want)
+		}
+	}
+	// A fully ignored reference leaves the frame as it is.
+	ref := NewFrame(textured)
+	ref.Ignore = NewMask(4, 4)
+	ref.Ignore.SetRect(image.Rect(0, 0, 4, 4))
+	if f := NewFrame(flat); f.Normalize(ref) != f {
+		t.Error("Normalize against a fully ignored reference returned a copy")
+	}
+}
+
 func TestMask(t *testing.T) {
 	m := NewMask(10, 10)
 	if m.Count != 0 {
@@ -97,6 +311,62 @@ func TestMask(t *testing.T) {
 	m.Set(-1, 0) // should not panic
 }
 
+func TestMaskCountIn(t *testing.T) {
+	m := NewMask(10, 10)
+	m.Set(1, 1)
+	m.Set(2, 2)
+	m.Set(8, 8)
+
+	if got := m.CountIn(image.Rect(0, 0, 5, 5)); got != 2 {
+		t.Errorf("expected 2 pixels in top-left quadrant, got %d", got)
+	}
+	if got := m.CountIn(image.Rect(5, 5, 20, 20)); got != 1 {
+		t.Errorf("expected 1 pixel in clipped rect, got %d", got)
+	}
+}
+
+func TestMask_Grid(t *testing.T) {
+	// 10x7 in 3x2 cells: columns 0-3, 3-6, 6-10 and rows 0-3, 3-7.
+	m := NewMask(10, 7)
+	m.SetRect(image.Rect(7, 4, 9, 6)) // 4 pixels, all in the bottom-right cell
+
+	cells := m.Grid(GridSize{Cols: 3, Rows: 2})
+	if len(cells) != 6 {
+		t.Fatalf("expected 6 cells, got %d", len(cells))
+	}
+	wantBounds := []image.Rectangle{
+		image.Rect(0, 0, 3, 3), image.Rect(3, 0, 6, 3), image.Rect(6, 0, 10, 3),
+		image.Rect(0, 3, 3, 7), image.Rect(3, 3, 6, 7), image.Rect(6, 3, 10, 7),
+	}
+	area := 0
+	for i, c := range cells {
+		if c.Bounds != wantBounds[i] || c.Col != i%3 || c.Row != i/3 {
+			t.Errorf("cell %d = (%d,%d) %v, want (%d,%d) %v", i, c.Col, c.Row, c.Bounds, i%3, i/3, wantBounds[i])
+		}
+		want := 0
+		if i == 5 {
+			want = 4
+		}
+		if c.DiffPixels != want {
+			t.Errorf("cell %d has %d diff pixels, want %d", i, c.DiffPixels, want)
+		}
+		area += c.Bounds.Dx() * c.Bounds.Dy()
+	}
+	if area != 70 {
+		t.Errorf("cells cover %d pixels, want 70", area)
+	}
+	if got := cells[5].Ratio(); got != 4.0/16 {
+		t.Errorf("Ratio() = %v, want 0.25", got)
+	}
+
+	if cells := m.Grid(GridSize{}); cells != nil {
+		t.Errorf("expected no cells for a zero grid, got %d", len(cells))
+	}
+	if cells := NewMask(2, 2).Grid(GridSize{Cols: 3, Rows: 1}); len(cells) != 3 || cells[0].Ratio() != 0 {
+		t.Errorf("a grid finer than the mask must keep empty cells, got %v", cells)
+	}
+}
+
 func TestNewRowAlignment(t *testing.T) {
 	ra := NewRowAlignment(10, 5, 3, 1)
 
@@ -216,3 +486,253 @@ func TestBlendColors(t *testing.T) {
 		})
 	}
 }
+
+func TestFrameRotate(t *testing.T) {
+	// 3x2 image with distinct gray values 0..5 in row-major order.
+	img := image.NewNRGBA(image.Rect(0, 0, 3, 2))
+	for i := 0; i < 6; i++ {
+		img.SetNRGBA(i%3, i/3, color.NRGBA{uint8(i * 40), uint8(i * 40), uint8(i * 40), 255})
+	}
+	f := NewFrame(img)
+
+	cases := []struct {
+		o    Orientation
+		want [][]int // source index at each (x, y) of the result, by row
+	}{
+		{OrientationRotateCW, [][]int{{3, 0}, {4, 1}, {5, 2}}},
+		{OrientationRotateCCW, [][]int{{2, 5}, {1, 4}, {0, 3}}},
+	}
+	for _, c := range cases {
+		r := f.Rotate(c.o)
+		if r.W != 2 || r.H != 3 {
+			t.Fatalf("%s: size %dx%d, want 2x3", c.o, r.W, r.H)
+		}
+		for y, row := range c.want {
+			for x, src := range row {
+				if got := r.Pix.NRGBAAt(x, y).R; got != uint8(src*40) {
+					t.Errorf("%s: pixel (%d,%d) = %d, want %d", c.o, x, y, got, src*40)
+				}
+				if r.Gray[y*r.W+x] != f.Gray[src] {
+					t.Errorf("%s: gray (%d,%d) mismatch", c.o, x, y)
+				}
+			}
+		}
+	}
+	if f.Rotate(OrientationOriginal) != f {
+		t.Error("original orientation should return the frame itself")
+	}
+}
+
+func TestAspectFactor(t *testing.T) {
+	landscape := NewFrame(image.NewNRGBA(image.Rect(0, 0, 192, 108)))
+	portrait := NewFrame(image.NewNRGBA(image.Rect(0, 0, 108, 192)))
+	if f := AspectFactor(landscape, landscape); f != 1 {
+		t.Errorf("same aspect: got %v, want 1", f)
+	}
+	if f := AspectFactor(landscape, portrait); math.Abs(f-(192.0/108)*(192.0/108)) > 1e-9 {
+		t.Errorf("portrait vs landscape: got %v", f)
+	}
+}
+
+func TestAlignmentUncoveredBands(t *testing.T) {
+	size := image.Pt(100, 80)
+	tests := []struct {
+		name   string
+		dx, dy int
+		want   []image.Rectangle
+	}{
+		{"zero", 0, 0, nil},
+		{"right-down", 5, 3, []image.Rectangle{image.Rect(0, 0, 100, 3), image.Rect(0, 3, 5, 80)}},
+		{"left-up", -5, -3, []image.Rectangle{image.Rect(0, 77, 100, 80), image.Rect(95, 0, 100, 77)}},
+		{"right-up", 5, -3, []image.Rectangle{image.Rect(0, 77, 100, 80), image.Rect(0, 0, 5, 77)}},
+		{"left-down", -5, 3, []image.Rectangle{image.Rect(0, 0, 100, 3), image.Rect(95, 3, 100, 80)}},
+		{"horizontal", 7, 0, []image.Rectangle{image.Rect(0, 0, 7, 80)}},
+		{"vertical", 0, -4, []image.Rectangle{image.Rect(0, 76, 100, 80)}},
+		{"disjoint", 200, 0, []image.Rectangle{image.Rect(0, 0, 100, 80)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Alignment{DX: tt.dx, DY: tt.dy}.UncoveredBands(size, size)
+			if len(got) != len(tt.want) {
+				t.Fatalf("bands = %v, want %v", got, tt.want)
+			}
+			area := 0
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("band %d = %v, want %v", i, got[i], tt.want[i])
+				}
+				area += got[i].Dx() * got[i].Dy()
+			}
+			covered := image.Rect(tt.dx, tt.dy, tt.dx+size.X, tt.dy+size.Y).Intersect(image.Rectangle{Max: size})
+			if area+covered.Dx()*covered.Dy() != size.X*size.Y {
+				t.Errorf("bands and covered area do not tile the frame")
+			}
+		})
+	}
+}
+
+func TestAlignmentUncoveredBands_SmallerA(t *testing.T) {
+	// A 60x40 frame at offset (10,10) in a 100x80 frame leaves all four strips.
+	got := Alignment{DX: 10, DY: 10}.UncoveredBands(image.Pt(60, 40), image.Pt(100, 80))
+	want := []image.Rectangle{
+		image.Rect(0, 0, 100, 10),
+		image.Rect(0, 50, 100, 80),
+		image.Rect(0, 10, 10, 50),
+		image.Rect(70, 10, 100, 50),
+	}
+	if len(got) != len(want) {
+		t.Fatalf("bands = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("band %d = %v, want %v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestAlignmentConfidence(t *testing.T) {
+	if c := AlignmentConfidence(0.9, 0.9); c != 1 {
+		t.Errorf("equal scores: %v, want 1", c)
+	}
+	if c := AlignmentConfidence(1, 1-10.0/255); c < 10.99 || c > 11.01 {
+		t.Errorf("perfect vs 10 gray levels: %v, want 11", c)
+	}
+}
+
+func TestMaskFromImage(t *testing.T) {
+	opaque := image.NewGray(image.Rect(0, 0, 4, 2))
+	opaque.SetGray(1, 0, color.Gray{255})
+	opaque.SetGray(2, 1, color.Gray{100})
+	if m := MaskFromImage(opaque); m.Count != 1 || !m.Get(1, 0) {
+		t.Errorf("opaque mask: %v, want only the white pixel (1,0)", m.Data)
+	}
+
+	// With transparency, any visible pixel counts, whatever its color.
+	overlay := image.NewNRGBA(image.Rect(0, 0, 4, 2))
+	overlay.SetNRGBA(0, 1, color.NRGBA{0, 0, 0, 255})
+	overlay.SetNRGBA(3, 0, color.NRGBA{255, 255, 255, 40})
+	if m := MaskFromImage(overlay); m.Count != 1 || !m.Get(0, 1) {
+		t.Errorf("transparent mask: %v, want only the opaque pixel (0,1)", m.Data)
+	}
+}
+
+func TestMask_Resize(t *testing.T) {
+	m := NewMask(2, 2)
+	m.Set(1, 0)
+	r := m.Resize(4, 6)
+	if r.Count != 6 {
+		t.Errorf("count %d, want 6", r.Count)
+	}
+	for y := 0; y < 6; y++ {
+		for x := 0; x < 4; x++ {
+			if want := x >= 2 && y < 3; r.Get(x, y) != want {
+				t.Errorf("(%d,%d) = %v, want %v", x, y, r.Get(x, y), want)
+			}
+		}
+	}
+}
+
+func TestFrame_Crop(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 8, 6))
+	img.SetNRGBA(3, 2, color.NRGBA{255, 255, 255, 255})
+	f := NewFrame(img)
+	f.Ignore = NewMask(8, 6)
+	f.Ignore.Set(4, 3)
+
+	c := f.Crop(image.Rect(2, 1, 20, 5))
+	if c.W != 6 || c.H != 4 {
+		t.Fatalf("size %dx%d, want 6x4 (clamped)", c.W, c.H)
+	}
+	if c.Pix.NRGBAAt(1, 1) != (color.NRGBA{255, 255, 255, 255}) || c.Gray[1*c.W+1] != 255 {
+		t.Error("pixel (3,2) is not at (1,1) of the crop")
+	}
+	if !c.Ignored(2, 2) || c.Ignore.Count != 1 {
+		t.Error("ignore mask was not cropped")
+	}
+	// Pixels are shared with the original frame.
+	c.Pix.SetNRGBA(0, 0, color.NRGBA{1, 2, 3, 255})
+	if f.Pix.NRGBAAt(2, 1) != (color.NRGBA{1, 2, 3, 255}) {
+		t.Error("crop does not share pixels with the frame")
+	}
+}
+
+func TestMask_CropEmbed(t *testing.T) {
+	m := NewMask(10, 10)
+	m.Set(5, 6)
+	m.Set(0, 0)
+	c := m.Crop(image.Rect(4, 4, 8, 8))
+	if c.Count != 1 || !c.Get(1, 2) {
+		t.Errorf("crop count %d, want only (1,2)", c.Count)
+	}
+	e := c.Embed(10, 10, image.Pt(4, 4))
+	if e.Count != 1 || !e.Get(5, 6) {
+		t.Errorf("embed count %d, want only (5,6)", e.Count)
+	}
+}
+
+func TestRowAlignment_Embed(t *testing.T) {
+	al := Alignment{DX: 1, DY: 2}
+	roi := image.Rect(10, 20, 30, 40)
+	sub := NewRowAlignmentFromAlignment(roi.Dx(), roi.Dy(), al)
+	strip := NewRowAlignment(roi.Dx(), roi.Dy(), 0, 5)
+	sub.ApplyRange(10, 20, strip)
+
+	full := sub.Embed(50, 60, roi, al)
+	cases := []struct {
+		x, y, srcY, dx int
+	}{
+		{5, 30, 28, 1},  // outside the ROI: global alignment
+		{12, 30, 28, 1}, // ROI base mapping, lifted by roi.Min.Y
+		{12, 21, -1, 1}, // source row above the cropped frame A
+		{25, 30, 25, 0}, // strip override
+		{35, 30, 28, 1}, // right of the ROI
+	}
+	for _, c := range cases {
+		if srcY, dx := full.SrcYAt(c.x, c.y), full.DXAt(c.x, c.y); srcY != c.srcY || dx != c.dx {
+			t.Errorf("(%d,%d): srcY %d dx %d, want %d %d", c.x, c.y, srcY, dx, c.srcY, c.dx)
+		}
+	}
+}
+
+func TestDiffOptions_IgnoreMask(t *testing.T) {
+	if m := (DiffOptions{}).IgnoreMask(10, 10); m != nil {
+		t.Errorf("no ignore options: got %d pixels, want nil", m.Count)
+	}
+
+	ignore := NewMask(5, 5)
+	ignore.Set(0, 0)
+	opts := DiffOptions{
+		Ignore: ignore,
+		// Overlapping, and one partly outside the frame.
+		IgnoreRects: []image.Rectangle{image.Rect(4, 4, 8, 8), image.Rect(6, 6, 12, 12)},
+	}
+	m := opts.IgnoreMask(10, 10)
+	// 2x2 from the scaled mask, 4x4 + 4x4 - 2x2 from the rectangles.
+	if m.Count != 4+28 {
+		t.Errorf("count %d, want 32", m.Count)
+	}
+	for _, p := range []image.Point{{0, 0}, {1, 1}, {4, 4}, {7, 7}, {9, 9}} {
+		if !m.Get(p.X, p.Y) {
+			t.Errorf("%v not ignored", p)
+		}
+	}
+	if m.Get(8, 4) || m.Get(3, 3) {
+		t.Error("pixels outside the rectangles are ignored")
+	}
+	if ignore.Count != 1 {
+		t.Errorf("Ignore was modified: %d pixels", ignore.Count)
+	}
+}
+
+func TestDownscale2x_Ignore(t *testing.T) {
+	f := NewFrame(image.NewNRGBA(image.Rect(0, 0, 4, 4)))
+	ignore := NewMask(4, 4)
+	ignore.Set(3, 2)
+	down := f.WithIgnore(ignore).Downscale2x()
+	if down.Ignore == nil || down.Ignore.Count != 1 || !down.Ignore.Get(1, 1) {
+		t.Errorf("downscaled ignore mask = %+v, want only (1,1)", down.Ignore)
+	}
+	if f.Ignore != nil {
+		t.Error("WithIgnore modified the original frame")
+	}
+}
@@ -0,0 +1,132 @@
+package core
+
+import (
+	"image"
+	"slices"
+)
+
+// Workspace keeps the buffers of one comparison for the next, so that
+// comparing many images of the same size allocates them once: the diff
+// masks, the labeling scratch of region extraction and the rendered image.
+//
+// Compare resets the workspace it is given, so the DiffMask and Output of a
+// Result computed with a Workspace are only valid until the next comparison
+// using it. A Workspace must not be shared by concurrent comparisons. All
+// methods accept a nil *Workspace, which allocates fresh buffers every time.
+type Workspace struct {
+	used  []*Mask // masks handed out since the last Reset
+	free  []*Mask
+	bools []bool
+	ints  []int
+	queue []int
+	img   *image.NRGBA
+}
+
+// NewWorkspace returns an empty workspace.
+func NewWorkspace() *Workspace {
+	return &Workspace{}
+}
+
+// Reset makes every mask handed out by NewMask available again.
+func (ws *Workspace) Reset() {
+	if ws == nil {
+		return
+	}
+	ws.free = append(ws.free, ws.used...)
+	clear(ws.used)
+	ws.used = ws.used[:0]
+}
+
+// NewMask returns a zero-initialized w x h mask, reusing the buffer of a free
+// mask that is large enough.
+func (ws *Workspace) NewMask(w, h int) *Mask {
+	if ws == nil {
+		return NewMask(w, h)
+	}
+	var m *Mask
+	if i := slices.IndexFunc(ws.free, func(f *Mask) bool { return cap(f.Data) >= w*h }); i >= 0 {
+		m = ws.free[i]
+		ws.free = slices.Delete(ws.free, i, i+1)
+		*m = Mask{W: w, H: h, Data: m.Data[:w*h]}
+		clear(m.Data)
+	} else {
+		m = NewMask(w, h)
+	}
+	ws.used = append(ws.used, m)
+	return m
+}
+
+// Release makes mask m, obtained from NewMask, available again before the
+// next Reset. m must not be used afterwards.
+func (ws *Workspace) Release(m *Mask) {
+	if ws == nil {
+		return
+	}
+	if i := slices.Index(ws.used, m); i >= 0 {
+		ws.used = slices.Delete(ws.used, i, i+1)
+		ws.free = append(ws.free, m)
+	}
+}
+
+// Bools returns a zeroed slice of length n. It reuses the slice returned by
+// the previous call, which must no longer be used.
+func (ws *Workspace) Bools(n int) []bool {
+	if ws == nil {
+		return make([]bool, n)
+	}
+	if cap(ws.bools) < n {
+		ws.bools = make([]bool, n)
+	}
+	ws.bools = ws.bools[:n]
+	clear(ws.bools)
+	return ws.bools
+}
+
+// Ints returns a zeroed slice of length n. It reuses the slice returned by
+// the previous call, which must no longer be used.
+func (ws *Workspace) Ints(n int) []int {
+	if ws == nil {
+		return make([]int, n)
+	}
+	if cap(ws.ints) < n {
+		ws.ints = make([]int, n)
+	}
+	ws.ints = ws.ints[:n]
+	clear(ws.ints)
+	return ws.ints
+}
+
+// Queue returns an empty slice with the capacity of the one last passed to
+// KeepQueue, for breadth-first searches.
+func (ws *Workspace) Queue() []int {
+	if ws == nil {
+		return nil
+	}
+	return ws.queue[:0]
+}
+
+// KeepQueue stores q, grown from a slice returned by Queue, for the next
+// call of Queue.
+func (ws *Workspace) KeepQueue(q []int) {
+	if ws != nil {
+		ws.queue = q
+	}
+}
+
+// Image returns a transparent NRGBA image with bounds r, reusing the pixels
+// of the previous one when they are large enough.
+func (ws *Workspace) Image(r image.Rectangle) *image.NRGBA {
+	if ws == nil {
+		return image.NewNRGBA(r)
+	}
+	n := 4 * r.Dx() * r.Dy()
+	if ws.img == nil || cap(ws.img.Pix) < n {
+		ws.img = image.NewNRGBA(r)
+		return ws.img
+	}
+	ws.img.Pix = ws.img.Pix[:n]
+	clear(ws.img.Pix)
+	ws.img.Stride = 4 * r.Dx()
+	ws.img.Rect = r
+	return ws.img
+}
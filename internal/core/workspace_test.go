@@ -0,0 +1,80 @@
+package core
+
+import (
+	"image"
+	"testing"
+)
+
+func TestWorkspace_NewMask(t *testing.T) {
+	ws := NewWorkspace()
+	m := ws.NewMask(4, 3)
+	m.Set(1, 1)
+	ws.Reset()
+
+	// A smaller mask reuses the buffer and starts cleared.
+	reused := ws.NewMask(2, 2)
+	if reused != m {
+		t.Fatal("NewMask after Reset allocated a new mask")
+	}
+	if reused.W != 2 || reused.H != 2 || len(reused.Data) != 4 || reused.Count != 0 {
+		t.Fatalf("reused mask = %dx%d, %d bytes, count %d", reused.W, reused.H, len(reused.Data), reused.Count)
+	}
+	for i, v := range reused.Data {
+		if v != 0 {
+			t.Fatalf("reused mask not cleared at %d", i)
+		}
+	}
+
+	// Masks in use are never handed out twice; released ones are.
+	other := ws.NewMask(2, 2)
+	if other == reused {
+		t.Fatal("NewMask handed out a mask in use")
+	}
+	ws.Release(other)
+	if ws.NewMask(1, 1) != other {
+		t.Error("NewMask did not reuse the released mask")
+	}
+	if big := ws.NewMask(10, 10); big == m || big == other {
+		t.Error("NewMask reused a buffer that is too small")
+	}
+}
+
+func TestWorkspace_Scratch(t *testing.T) {
+	ws := NewWorkspace()
+	b := ws.Bools(8)
+	b[3] = true
+	if b2 := ws.Bools(6); &b2[0] != &b[0] || b2[3] {
+		t.Error("Bools did not reuse a cleared buffer")
+	}
+	n := ws.Ints(5)
+	n[0] = 7
+	if n2 := ws.Ints(5); &n2[0] != &n[0] || n2[0] != 0 {
+		t.Error("Ints did not reuse a cleared buffer")
+	}
+	q := append(ws.Queue(), 1, 2, 3)
+	ws.KeepQueue(q)
+	if q2 := ws.Queue(); len(q2) != 0 || cap(q2) != cap(q) {
+		t.Errorf("Queue = len %d cap %d, want len 0 cap %d", len(q2), cap(q2), cap(q))
+	}
+
+	img := ws.Image(image.Rect(0, 0, 4, 4))
+	img.Pix[0] = 255
+	img2 := ws.Image(image.Rect(0, 0, 2, 3))
+	if img2 != img || img2.Stride != 8 || len(img2.Pix) != 24 || img2.Pix[0] != 0 {
+		t.Errorf("Image = stride %d, %d bytes, first %d", img2.Stride, len(img2.Pix), img2.Pix[0])
+	}
+}
+
+func TestWorkspace_Nil(t *testing.T) {
+	var ws *Workspace
+	ws.Reset()
+	m := ws.NewMask(3, 2)
+	ws.Release(m)
+	if len(m.Data) != 6 || len(ws.Bools(4)) != 4 || len(ws.Ints(4)) != 4 || ws.Queue() != nil {
+		t.Error("nil Workspace did not allocate")
+	}
+	ws.KeepQueue([]int{1})
+	if ws.Image(image.Rect(0, 0, 2, 2)).Bounds().Dx() != 2 {
+		t.Error("nil Workspace did not allocate an image")
+	}
+}
@@ -0,0 +1,83 @@
+package diff
+
+import "github.com/xshoji/go-img-diff/internal/core"
+
+// antialiased reports whether the differing pixel (x, y) of B, compared with
+// pixel (ax, ay) of A, is likely an anti-aliased edge pixel in either image,
+// following the detector of pixelmatch (after Vysniauskas, "Anti-aliased
+// Pixel and Intensity Slope Detector", 2009). Neighbors are mapped between the
+// frames with the offset of the center pixel.
+func antialiased(a *core.Frame, ax, ay int, b *core.Frame, x, y int) bool {
+	return antialiasedIn(a, ax, ay, b, x-ax, y-ay) || antialiasedIn(b, x, y, a, ax-x, ay-y)
+}
+
+// antialiasedIn reports whether pixel (x, y) of f looks anti-aliased: at most
+// two of its neighbors have the same brightness, and it lies between a darker
+// and a brighter neighbor of which at least one is inside a flat area (more
+// than two identical neighbors) in both f and other. (dx, dy) maps f to other.
+func antialiasedIn(f *core.Frame, x, y int, other *core.Frame, dx, dy int) bool {
+	x0, y0 := max(x-1, 0), max(y-1, 0)
+	x1, y1 := min(x+1, f.W-1), min(y+1, f.H-1)
+	zeroes := 0
+	if x == x0 || x == x1 || y == y0 || y == y1 {
+		zeroes = 1
+	}
+
+	center := int(f.Gray[y*f.W+x])
+	minDelta, maxDelta := 0, 0
+	var minX, minY, maxX, maxY int
+	for ny := y0; ny <= y1; ny++ {
+		for nx := x0; nx <= x1; nx++ {
+			if nx == x && ny == y {
+				continue
+			}
+			delta := int(f.Gray[ny*f.W+nx]) - center
+			switch {
+			case delta == 0:
+				if zeroes++; zeroes > 2 {
+					return false
+				}
+			case delta < minDelta:
+				minDelta, minX, minY = delta, nx, ny
+			case delta > maxDelta:
+				maxDelta, maxX, maxY = delta, nx, ny
+			}
+		}
+	}
+	if minDelta == 0 || maxDelta == 0 {
+		return false
+	}
+	return (hasManySiblings(f, minX, minY) && hasManySiblings(other, minX+dx, minY+dy)) ||
+		(hasManySiblings(f, maxX, maxY) && hasManySiblings(other, maxX+dx, maxY+dy))
+}
+
+// hasManySiblings reports whether more than two neighbors of pixel (x, y) of
+// f have exactly its color. Pixels on the image border count one extra.
+func hasManySiblings(f *core.Frame, x, y int) bool {
+	if x < 0 || x >= f.W || y < 0 || y >= f.H {
+		return false
+	}
+	x0, y0 := max(x-1, 0), max(y-1, 0)
+	x1, y1 := min(x+1, f.W-1), min(y+1, f.H-1)
+	zeroes := 0
+	if x == x0 || x == x1 || y == y0 || y == y1 {
+		zeroes = 1
+	}
+
+	pix := f.Pix.Pix
+	off := y*f.Pix.Stride + x*4
+	for ny := y0; ny <= y1; ny++ {
+		for nx := x0; nx <= x1; nx++ {
+			if nx == x && ny == y {
+				continue
+			}
+			n := ny*f.Pix.Stride + nx*4
+			if pix[n] == pix[off] && pix[n+1] == pix[off+1] && pix[n+2] == pix[off+2] && pix[n+3] == pix[off+3] {
+				if zeroes++; zeroes > 2 {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
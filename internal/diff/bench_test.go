@@ -0,0 +1,31 @@
+//go:build !light_test_only
+
+package diff
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/xshoji/go-img-diff/internal/core"
+)
+
+// benchFrames returns two 1600x1200 pattern frames, generated once for all
+// benchmarks of the package.
+var benchFrames = sync.OnceValues(func() (*core.Frame, *core.Frame) {
+	return makePatternFrame(1600, 1200, 0), makePatternFrame(1600, 1200, 7)
+})
+
+func BenchmarkBuildMask(b *testing.B) {
+	fa, fb := benchFrames()
+	rowAlign := core.NewRowAlignmentFromAlignment(fb.W, fb.H, core.Alignment{})
+	for _, workers := range []int{1, 4} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			opts := core.DiffOptions{Threshold: 20, Workers: workers}
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				BuildMask(fa, fb, rowAlign, opts, testLogger())
+			}
+		})
+	}
+}
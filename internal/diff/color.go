@@ -0,0 +1,169 @@
+package diff
+
+import (
+	"math"
+
+	"github.com/xshoji/go-img-diff/internal/core"
+)
+
+// pixelDiffers reports whether pixel (ax, ay) of a and pixel (bx, by) of b
+// differ under opts. With opts.Grayscale only the luminance cached in the
+// frames (and alpha) is compared, as a gray color.
+func pixelDiffers(a *core.Frame, ax, ay int, b *core.Frame, bx, by int, opts core.DiffOptions) bool {
+	// Read pixel values directly from NRGBA pixel slices
+	aOff := ay*a.Pix.Stride + ax*4
+	bOff := by*b.Pix.Stride + bx*4
+	p, q := a.Pix.Pix[aOff:aOff+4], b.Pix.Pix[bOff:bOff+4]
+	if opts.Grayscale {
+		ga, gb := a.Gray[ay*a.W+ax], b.Gray[by*b.W+bx]
+		return differs([]uint8{ga, ga, ga, p[3]}, []uint8{gb, gb, gb, q[3]}, opts)
+	}
+	return differs(p, q, opts)
+}
+
+// pixelDifference is the difference of the pixels compared by pixelDiffers
+// under opts.Metric.
+func pixelDifference(a *core.Frame, ax, ay int, b *core.Frame, bx, by int, opts core.DiffOptions) float64 {
+	aOff := ay*a.Pix.Stride + ax*4
+	bOff := by*b.Pix.Stride + bx*4
+	p, q := a.Pix.Pix[aOff:aOff+4], b.Pix.Pix[bOff:bOff+4]
+	if opts.Grayscale {
+		ga, gb := a.Gray[ay*a.W+ax], b.Gray[by*b.W+bx]
+		return difference([]uint8{ga, ga, ga, p[3]}, []uint8{gb, gb, gb, q[3]}, opts)
+	}
+	return difference(p, q, opts)
+}
+
+// difference returns the difference of the NRGBA values p and q under
+// opts.Metric: the largest channel difference for rgb (alpha included unless
+// opts.IgnoreAlpha), the delta E of the colors for ciede2000.
+func difference(p, q []uint8, opts core.DiffOptions) float64 {
+	if opts.Metric == core.ColorMetricCIEDE2000 {
+		return ciede2000(srgbToLab(p[0], p[1], p[2]), srgbToLab(q[0], q[1], q[2]))
+	}
+	d := max(absDiffU8(p[0], q[0]), absDiffU8(p[1], q[1]), absDiffU8(p[2], q[2]))
+	if !opts.IgnoreAlpha {
+		d = max(d, absDiffU8(p[3], q[3]))
+	}
+	return float64(d)
+}
+
+// differs reports whether the NRGBA values p and q differ under opts: by
+// more than opts.Threshold under opts.Metric or, for rgb with
+// opts.ChannelThresholds, by more than its threshold in any channel.
+func differs(p, q []uint8, opts core.DiffOptions) bool {
+	dr, dg, db := absDiffU8(p[0], q[0]), absDiffU8(p[1], q[1]), absDiffU8(p[2], q[2])
+	if opts.Metric == core.ColorMetricCIEDE2000 {
+		return max(dr, dg, db) > 0 && difference(p, q, opts) > float64(opts.Threshold)
+	}
+	var da uint8
+	if !opts.IgnoreAlpha {
+		da = absDiffU8(p[3], q[3])
+	}
+	if t := opts.ChannelThresholds; t != nil {
+		return dr > t[0] || dg > t[1] || db > t[2] || da > t[3]
+	}
+	return max(dr, dg, db, da) > opts.Threshold
+}
+
+// lab is a CIELAB color (D65 white point).
+type lab struct{ L, A, B float64 }
+
+// srgbLinear maps an 8-bit sRGB component to linear light (0-1).
+var srgbLinear = func() (t [256]float64) {
+	for i := range t {
+		c := float64(i) / 255
+		if c <= 0.04045 {
+			t[i] = c / 12.92
+		} else {
+			t[i] = math.Pow((c+0.055)/1.055, 2.4)
+		}
+	}
+	return t
+}()
+
+// srgbToLab converts an sRGB color to CIELAB via CIEXYZ with the D65 white point.
+func srgbToLab(r, g, b uint8) lab {
+	lr, lg, lb := srgbLinear[r], srgbLinear[g], srgbLinear[b]
+	x := (0.4124564*lr + 0.3575761*lg + 0.1804375*lb) / 0.95047
+	y := 0.2126729*lr + 0.7151522*lg + 0.0721750*lb
+	z := (0.0193339*lr + 0.1191920*lg + 0.9503041*lb) / 1.08883
+	fx, fy, fz := labF(x), labF(y), labF(z)
+	return lab{L: 116*fy - 16, A: 500 * (fx - fy), B: 200 * (fy - fz)}
+}
+
+func labF(t float64) float64 {
+	const delta = 6.0 / 29
+	if t > delta*delta*delta {
+		return math.Cbrt(t)
+	}
+	return t/(3*delta*delta) + 4.0/29
+}
+
+// ciede2000 returns the CIEDE2000 color difference of p and q with unit
+// weighting factors (kL = kC = kH = 1), following Sharma, Wu and Dalal,
+// "The CIEDE2000 Color-Difference Formula" (2005).
+func ciede2000(p, q lab) float64 {
+	const pow25_7 = 6103515625.0 // 25^7
+	rad := math.Pi / 180
+
+	cBar := (math.Hypot(p.A, p.B) + math.Hypot(q.A, q.B)) / 2
+	cBar7 := math.Pow(cBar, 7)
+	g := 0.5 * (1 - math.Sqrt(cBar7/(cBar7+pow25_7)))
+	a1, a2 := (1+g)*p.A, (1+g)*q.A
+	c1, c2 := math.Hypot(a1, p.B), math.Hypot(a2, q.B)
+	h1, h2 := hueDegrees(p.B, a1), hueDegrees(q.B, a2)
+
+	dL := q.L - p.L
+	dC := c2 - c1
+	var dh float64
+	if c1*c2 != 0 {
+		dh = h2 - h1
+		if dh > 180 {
+			dh -= 360
+		} else if dh < -180 {
+			dh += 360
+		}
+	}
+	dH := 2 * math.Sqrt(c1*c2) * math.Sin(dh/2*rad)
+
+	lBar := (p.L + q.L) / 2
+	cBarP := (c1 + c2) / 2
+	hBar := h1 + h2
+	if c1*c2 != 0 {
+		switch {
+		case math.Abs(h1-h2) <= 180:
+			hBar /= 2
+		case hBar < 360:
+			hBar = (hBar + 360) / 2
+		default:
+			hBar = (hBar - 360) / 2
+		}
+	}
+
+	t := 1 - 0.17*math.Cos((hBar-30)*rad) + 0.24*math.Cos(2*hBar*rad) +
+		0.32*math.Cos((3*hBar+6)*rad) - 0.20*math.Cos((4*hBar-63)*rad)
+	dTheta := 30 * math.Exp(-math.Pow((hBar-275)/25, 2))
+	cBarP7 := math.Pow(cBarP, 7)
+	rC := 2 * math.Sqrt(cBarP7/(cBarP7+pow25_7))
+	l50 := (lBar - 50) * (lBar - 50)
+	sL := 1 + 0.015*l50/math.Sqrt(20+l50)
+	sC := 1 + 0.045*cBarP
+	sH := 1 + 0.015*cBarP*t
+	rT := -math.Sin(2*dTheta*rad) * rC
+
+	l, c, h := dL/sL, dC/sC, dH/sH
+	return math.Sqrt(l*l + c*c + h*h + rT*c*h)
+}
+
+// hueDegrees returns atan2(b, a) in degrees in [0, 360), 0 for a neutral color.
+func hueDegrees(b, a float64) float64 {
+	if a == 0 && b == 0 {
+		return 0
+	}
+	h := math.Atan2(b, a) * 180 / math.Pi
+	if h < 0 {
+		h += 360
+	}
+	return h
+}
@@ -0,0 +1,92 @@
+package diff
+
+import (
+	"math"
+	"testing"
+
+	"github.com/xshoji/go-img-diff/internal/core"
+)
+
+func TestSRGBToLab(t *testing.T) {
+	tests := []struct {
+		r, g, b uint8
+		want    lab
+	}{
+		{0, 0, 0, lab{0, 0, 0}},
+		{255, 255, 255, lab{100, 0, 0}},
+		{255, 0, 0, lab{53.2408, 80.0925, 67.2032}},
+		{0, 255, 0, lab{87.7347, -86.1827, 83.1793}},
+		{0, 0, 255, lab{32.2970, 79.1875, -107.8602}},
+		{128, 128, 128, lab{53.5850, 0, 0}},
+	}
+	for _, tt := range tests {
+		got := srgbToLab(tt.r, tt.g, tt.b)
+		if math.Abs(got.L-tt.want.L) > 0.01 || math.Abs(got.A-tt.want.A) > 0.01 || math.Abs(got.B-tt.want.B) > 0.01 {
+			t.Errorf("srgbToLab(%d, %d, %d) = %+v, want %+v", tt.r, tt.g, tt.b, got, tt.want)
+		}
+	}
+}
+
+// TestCIEDE2000 uses reference pairs from Sharma, Wu and Dalal (2005), which
+// exercise the hue averaging and rotation terms.
+func TestCIEDE2000(t *testing.T) {
+	tests := []struct {
+		p, q lab
+		want float64
+	}{
+		{lab{50, 2.6772, -79.7751}, lab{50, 0, -82.7485}, 2.0425},
+		{lab{50, 3.1571, -77.2803}, lab{50, 0, -82.7485}, 2.8615},
+		{lab{50, 0, 0}, lab{50, -1, 2}, 2.3669},
+		{lab{50, 2.49, -0.001}, lab{50, -2.49, 0.0009}, 7.1792},
+		{lab{50, 2.49, -0.001}, lab{50, -2.49, 0.0011}, 7.2195},
+		{lab{50, 2.5, 0}, lab{73, 25, -18}, 27.1492},
+		{lab{50, 2.5, 0}, lab{50, 3.1736, 0.5854}, 1.0000},
+		{lab{60.2574, -34.0099, 36.2677}, lab{60.4626, -34.1751, 39.4387}, 1.2644},
+		{lab{2.0776, 0.0795, -1.1350}, lab{0.9033, -0.0636, -0.5514}, 0.9082},
+	}
+	for _, tt := range tests {
+		for _, pair := range [][2]lab{{tt.p, tt.q}, {tt.q, tt.p}} {
+			if got := ciede2000(pair[0], pair[1]); math.Abs(got-tt.want) > 0.0001 {
+				t.Errorf("ciede2000(%+v, %+v) = %.4f, want %.4f", pair[0], pair[1], got, tt.want)
+			}
+		}
+	}
+}
+
+func TestDiffers_Channels(t *testing.T) {
+	base := []uint8{100, 100, 100, 255}
+	perChannel := &[4]uint8{10, 20, 30, 40}
+	tests := []struct {
+		name string
+		q    []uint8
+		opts core.DiffOptions
+		want bool
+	}{
+		{"red within", []uint8{110, 100, 100, 255}, core.DiffOptions{ChannelThresholds: perChannel}, false},
+		{"red over", []uint8{111, 100, 100, 255}, core.DiffOptions{ChannelThresholds: perChannel}, true},
+		{"green within", []uint8{100, 80, 100, 255}, core.DiffOptions{ChannelThresholds: perChannel}, false},
+		{"green over", []uint8{100, 79, 100, 255}, core.DiffOptions{ChannelThresholds: perChannel}, true},
+		{"blue within", []uint8{100, 100, 130, 255}, core.DiffOptions{ChannelThresholds: perChannel}, false},
+		{"blue over", []uint8{100, 100, 131, 255}, core.DiffOptions{ChannelThresholds: perChannel}, true},
+		{"alpha within", []uint8{100, 100, 100, 215}, core.DiffOptions{ChannelThresholds: perChannel}, false},
+		{"alpha over", []uint8{100, 100, 100, 214}, core.DiffOptions{ChannelThresholds: perChannel}, true},
+		{"alpha over ignored", []uint8{100, 100, 100, 0}, core.DiffOptions{ChannelThresholds: perChannel, IgnoreAlpha: true}, false},
+		// Each channel within its own threshold, though the largest
+		// difference exceeds the scalar one.
+		{"all within", []uint8{110, 120, 130, 215}, core.DiffOptions{Threshold: 5, ChannelThresholds: perChannel}, false},
+		{"scalar alpha", []uint8{100, 100, 100, 200}, core.DiffOptions{Threshold: 30}, true},
+		{"scalar alpha ignored", []uint8{100, 100, 100, 200}, core.DiffOptions{Threshold: 30, IgnoreAlpha: true}, false},
+		{"ciede2000 ignores alpha", []uint8{100, 100, 100, 0}, core.DiffOptions{Threshold: 1, Metric: core.ColorMetricCIEDE2000}, false},
+	}
+	for _, tt := range tests {
+		if got := differs(base, tt.q, tt.opts); got != tt.want {
+			t.Errorf("%s: differs(%v, %v) = %v, want %v", tt.name, base, tt.q, got, tt.want)
+		}
+		// difference agrees with the scalar threshold.
+		if tt.opts.ChannelThresholds == nil {
+			if got := difference(base, tt.q, tt.opts) > float64(tt.opts.Threshold); got != tt.want {
+				t.Errorf("%s: difference disagrees with differs", tt.name)
+			}
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package diff
+
+import (
+	"image"
+	"log/slog"
+
+	"github.com/xshoji/go-img-diff/internal/core"
+)
+
+// LocalAlign searches, for every region whose bounds cover at least
+// opts.MinArea pixels, the offsets within opts.Radius of the global alignment
+// for one under which the region matches. Such regions are cleared from mask
+// and returned as local alignments; the others are returned unchanged.
+//
+// A region matches when at most opts.MaxResidual of the comparable pixels in
+// the bounding box of its diff pixels (without the region padding) differ
+// under diffOpts. Pixels without a counterpart in A under the tried offset and
+// ignored pixels are not compared.
+func LocalAlign(a, b *core.Frame, mask *core.Mask, regions []core.Region, global core.Alignment, opts core.LocalAlignOptions, diffOpts core.DiffOptions, logger *slog.Logger) ([]core.Region, []core.LocalAlignment) {
+	kept := make([]core.Region, 0, len(regions))
+	var aligned []core.LocalAlignment
+	for _, r := range regions {
+		if r.Bounds.Dx()*r.Bounds.Dy() < opts.MinArea {
+			kept = append(kept, r)
+			continue
+		}
+		if off, ok := localOffset(a, b, diffBounds(mask, r.Bounds), global, opts, diffOpts); ok {
+			mask.ClearRect(r.Bounds)
+			aligned = append(aligned, core.LocalAlignment{Region: r, DX: off.X, DY: off.Y})
+			continue
+		}
+		kept = append(kept, r)
+	}
+	logger.Info("local alignment complete", "regions", len(regions), "locallyAligned", len(aligned))
+	return kept, aligned
+}
+
+// localOffset returns the offset around the global one, nearest first, under
+// which the pixels of r match.
+func localOffset(a, b *core.Frame, r image.Rectangle, global core.Alignment, opts core.LocalAlignOptions, diffOpts core.DiffOptions) (image.Point, bool) {
+	for ring := 1; ring <= opts.Radius; ring++ {
+		for ddy := -ring; ddy <= ring; ddy++ {
+			for ddx := -ring; ddx <= ring; ddx++ {
+				if max(abs(ddx), abs(ddy)) != ring {
+					continue
+				}
+				off := image.Pt(global.DX+ddx, global.DY+ddy)
+				if matchesAt(a, b, r, off, opts.MaxResidual, diffOpts) {
+					return off, true
+				}
+			}
+		}
+	}
+	return image.Point{}, false
+}
+
+// matchesAt reports whether at most maxResidual of the comparable pixels of r
+// differ when B is mapped to A by off.
+func matchesAt(a, b *core.Frame, r image.Rectangle, off image.Point, maxResidual float64, diffOpts core.DiffOptions) bool {
+	r = r.Intersect(image.Rect(0, 0, b.W, b.H))
+	allowed := int(maxResidual * float64(r.Dx()*r.Dy()))
+	compared, diffs := 0, 0
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		ay := y - off.Y
+		if ay < 0 || ay >= a.H {
+			continue
+		}
+		for x := r.Min.X; x < r.Max.X; x++ {
+			ax := x - off.X
+			if ax < 0 || ax >= a.W || b.Ignored(x, y) {
+				continue
+			}
+			compared++
+			if pixelDiffers(a, ax, ay, b, x, y, diffOpts) {
+				if diffs++; diffs > allowed {
+					return false
+				}
+			}
+		}
+	}
+	return compared > 0 && float64(diffs) <= maxResidual*float64(compared)
+}
+
+// diffBounds returns the bounding box of the set pixels of mask within r.
+func diffBounds(mask *core.Mask, r image.Rectangle) image.Rectangle {
+	r = r.Intersect(image.Rect(0, 0, mask.W, mask.H))
+	var b image.Rectangle
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			if mask.Data[y*mask.W+x] != 0 {
+				b = b.Union(image.Rect(x, y, x+1, y+1))
+			}
+		}
+	}
+	return b
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
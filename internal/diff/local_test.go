@@ -0,0 +1,65 @@
+package diff
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/xshoji/go-img-diff/internal/core"
+)
+
+// blockTexture draws 4x4 pseudo-random gray blocks; rows from splitY on are
+// shifted right by shiftX.
+func blockTexture(w, h, splitY, shiftX int) *core.Frame {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			sx := x
+			if y >= splitY {
+				sx -= shiftX
+			}
+			v := uint8((((sx+64)/4)*7919 + (y/4)*104729) % 251)
+			img.SetNRGBA(x, y, color.NRGBA{v, v, v, 255})
+		}
+	}
+	return core.NewFrame(img)
+}
+
+func TestLocalAlign(t *testing.T) {
+	a := blockTexture(80, 60, 60, 0)
+	b := blockTexture(80, 60, 30, 3)
+	rowAlign := core.NewRowAlignmentFromAlignment(80, 60, core.Alignment{})
+	mask := BuildMask(a, b, rowAlign, core.DiffOptions{Threshold: 30}, testLogger())
+	shifted := core.Region{Bounds: image.Rect(0, 30, 80, 60), Area: mask.CountIn(image.Rect(0, 30, 80, 60))}
+	if shifted.Area == 0 {
+		t.Fatal("fixture: the shifted half does not differ")
+	}
+	// A real change that no offset explains.
+	for y := 5; y < 25; y++ {
+		for x := 20; x < 40; x++ {
+			b.Pix.SetNRGBA(x, y, color.NRGBA{255, 0, 0, 255})
+			mask.Set(x, y)
+		}
+	}
+	changed := core.Region{Bounds: image.Rect(20, 5, 40, 25), Area: 400}
+	total := mask.Count
+
+	opts := core.DefaultOptions().LocalAlign
+	kept, aligned := LocalAlign(a, b, mask, []core.Region{changed, shifted}, core.Alignment{}, opts, core.DiffOptions{Threshold: 30}, testLogger())
+	if len(kept) != 1 || kept[0] != changed {
+		t.Errorf("kept %v, want only the changed region", kept)
+	}
+	if len(aligned) != 1 || aligned[0].Region != shifted || aligned[0].DX != 3 || aligned[0].DY != 0 {
+		t.Errorf("locally aligned %+v, want the shifted half at (3,0)", aligned)
+	}
+	if mask.Count != total-shifted.Area || mask.CountIn(shifted.Bounds) != 0 {
+		t.Errorf("mask has %d pixels, want the shifted half cleared", mask.Count)
+	}
+
+	// Regions below MinArea are left alone.
+	opts.MinArea = 80 * 30 * 2
+	kept, aligned = LocalAlign(a, b, mask, []core.Region{shifted}, core.Alignment{}, opts, core.DiffOptions{Threshold: 30}, testLogger())
+	if len(kept) != 1 || len(aligned) != 0 {
+		t.Errorf("small region: kept %v, aligned %v", kept, aligned)
+	}
+}
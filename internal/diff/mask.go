@@ -3,75 +3,46 @@ package diff
 import (
 	"log/slog"
 	"math"
+	"runtime"
 
 	"github.com/xshoji/go-img-diff/internal/core"
+	"github.com/xshoji/go-img-diff/internal/progress"
 )
 
 // BuildMask compares two aligned frames and produces a binary diff mask.
 // The mask is in frame B's coordinate space.
-// Metric: max(|dR|, |dG|, |dB|) > threshold.
+// Metric: opts.Metric difference > opts.Threshold (see core.ColorMetric).
 func BuildMask(a, b *core.Frame, rowAlign core.RowAlignment, opts core.DiffOptions, logger *slog.Logger) *core.Mask {
-	mask := core.NewMask(b.W, b.H)
-
-	threshold := opts.Threshold
-	earlyExit := opts.StopAfterFirst && !shouldApplyNoiseFilter(opts)
-
-	for y := 0; y < b.H; y++ {
-		for x := 0; x < b.W; x++ {
-			srcY := rowAlign.SrcYAt(x, y)
-			dx := rowAlign.DXAt(x, y)
-			if srcY == -1 {
-				mask.Set(x, y)
-				if earlyExit {
-					return mask
-				}
-				continue
-			}
-
-			// Corresponding position in frame A
-			ax := x - dx
-			ay := srcY
-
-			// Out of bounds in A → skip (not comparable)
-			if ax < 0 || ax >= a.W || ay < 0 || ay >= a.H {
-				continue
-			}
-
-			// Read pixel values directly from NRGBA pixel slices
-			aOff := ay*a.Pix.Stride + ax*4
-			bOff := y*b.Pix.Stride + x*4
-
-			ar := a.Pix.Pix[aOff]
-			ag := a.Pix.Pix[aOff+1]
-			ab := a.Pix.Pix[aOff+2]
-			br := b.Pix.Pix[bOff]
-			bg := b.Pix.Pix[bOff+1]
-			bb := b.Pix.Pix[bOff+2]
+	return buildMask(a, b, rowAlign, opts, nil, logger)
+}
 
-			dr := absDiffU8(ar, br)
-			dg := absDiffU8(ag, bg)
-			db := absDiffU8(ab, bb)
+// BuildMaskWithProgress is BuildMask reporting the "diff" stage to reporter,
+// based on the number of compared rows.
+func BuildMaskWithProgress(a, b *core.Frame, rowAlign core.RowAlignment, opts core.DiffOptions, reporter progress.Reporter, logger *slog.Logger) *core.Mask {
+	return buildMask(a, b, rowAlign, opts, progress.Start(reporter, "diff"), logger)
+}
 
-			maxDiff := dr
-			if dg > maxDiff {
-				maxDiff = dg
-			}
-			if db > maxDiff {
-				maxDiff = db
-			}
+func buildMask(a, b *core.Frame, rowAlign core.RowAlignment, opts core.DiffOptions, tracker *progress.Tracker, logger *slog.Logger) *core.Mask {
+	mask := opts.Workspace.NewMask(b.W, b.H)
+	defer tracker.Done()
 
-			if maxDiff > threshold {
-				mask.Set(x, y)
-				if earlyExit {
-					return mask
-				}
+	if opts.StopAfterFirst && !opts.Tolerant() && !shouldApplyNoiseFilter(opts) && opts.Despeckle == 0 {
+		// Early exit only needs to find one pixel; scan sequentially.
+		for y := 0; y < b.H; y++ {
+			if compareRow(a, b, rowAlign, opts, y, mask.Data[y*b.W:(y+1)*b.W], true) > 0 {
+				mask.Count = 1
+				return mask
 			}
+			tracker.Update(y+1, b.H)
 		}
+		return mask
 	}
 
+	mask.Count = compareRows(a, b, rowAlign, opts, mask.Data, tracker)
+
 	if shouldApplyNoiseFilter(opts) {
 		rawCount := mask.Count
-		filterSparseNoise(mask, opts.NoiseWindowSize, opts.NoiseMinDiffRatio)
+		filterSparseNoise(mask, opts.NoiseWindowSize, opts.NoiseMinDiffRatio, opts.Workspace)
 		logger.Info("diff noise filter applied",
 			"windowSize", normalizeNoiseWindowSize(opts.NoiseWindowSize),
 			"minDiffRatio", opts.NoiseMinDiffRatio,
@@ -79,11 +50,134 @@ func BuildMask(a, b *core.Frame, rowAlign core.RowAlignment, opts core.DiffOptio
 			"filteredDiffPixels", mask.Count,
 		)
 	}
+	if shouldApplyMorphology(opts) {
+		rawCount := mask.Count
+		applyMorphology(mask, opts, opts.Workspace)
+		logger.Info("diff morphology applied",
+			"despeckle", opts.Despeckle,
+			"close", opts.Close,
+			"rawDiffPixels", rawCount,
+			"filteredDiffPixels", mask.Count,
+		)
+	}
 
 	logger.Info("diff mask built", "width", b.W, "height", b.H, "diffPixels", mask.Count)
 	return mask
 }
 
+// rowChunk is the number of rows a worker compares per work unit.
+const rowChunk = 16
+
+// compareRows fills data (one byte per pixel of B) using opts.Workers workers
+// and returns the number of differing pixels. Rows are independent, so each
+// chunk is written by exactly one worker; progress is reported from the
+// calling goroutine as chunks complete.
+func compareRows(a, b *core.Frame, rowAlign core.RowAlignment, opts core.DiffOptions, data []uint8, tracker *progress.Tracker) int {
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	chunks := (b.H + rowChunk - 1) / rowChunk
+	workers = max(1, min(workers, chunks))
+
+	type done struct{ rows, count int }
+	chunkCh := make(chan int, chunks)
+	doneCh := make(chan done, chunks)
+	for i := 0; i < chunks; i++ {
+		chunkCh <- i * rowChunk
+	}
+	close(chunkCh)
+
+	for i := 0; i < workers; i++ {
+		go func() {
+			for minY := range chunkCh {
+				maxY := min(b.H, minY+rowChunk)
+				count := 0
+				for y := minY; y < maxY; y++ {
+					count += compareRow(a, b, rowAlign, opts, y, data[y*b.W:(y+1)*b.W], false)
+				}
+				doneCh <- done{maxY - minY, count}
+			}
+		}()
+	}
+
+	total, rows := 0, 0
+	for i := 0; i < chunks; i++ {
+		d := <-doneCh
+		total += d.count
+		rows += d.rows
+		tracker.Update(rows, b.H)
+	}
+	return total
+}
+
+// compareRow marks the differing pixels of row y of B in row and returns how
+// many it marked. With stopAtFirst it returns after the first one.
+// Metric: opts.Metric difference > opts.Threshold; rows without a source row
+// in A are entirely different, pixels outside A are not comparable and pixels
+// ignored in B never differ. With opts.IgnoreAntialiasing, differing pixels
+// that look anti-aliased are not marked.
+func compareRow(a, b *core.Frame, rowAlign core.RowAlignment, opts core.DiffOptions, y int, row []uint8, stopAtFirst bool) int {
+	count := 0
+	for x := 0; x < b.W; x++ {
+		ax, ay, state := mapPixel(a, b, rowAlign, x, y)
+		if state == pixelSkipped {
+			continue
+		}
+		if state == pixelUnmapped || (pixelDiffers(a, ax, ay, b, x, y, opts) && !(opts.IgnoreAntialiasing && antialiased(a, ax, ay, b, x, y))) {
+			row[x] = 1
+			count++
+			if stopAtFirst {
+				return count
+			}
+		}
+	}
+	return count
+}
+
+// States of a pixel of B under a row alignment (see mapPixel).
+const (
+	pixelCompared = iota // compared with a pixel of A
+	pixelUnmapped        // its row has no source row in A: always different
+	pixelSkipped         // ignored, or outside A: never different
+)
+
+// mapPixel returns the pixel (ax, ay) of A that pixel (x, y) of B is compared
+// with under rowAlign, and whether it is compared at all. Pixels ignored in B
+// are skipped before their row is looked up.
+func mapPixel(a, b *core.Frame, rowAlign core.RowAlignment, x, y int) (ax, ay, state int) {
+	if b.Ignored(x, y) {
+		return 0, 0, pixelSkipped
+	}
+	srcY := rowAlign.SrcYAt(x, y)
+	if srcY == -1 {
+		return 0, 0, pixelUnmapped
+	}
+	ax, ay = x-rowAlign.DXAt(x, y), srcY
+	if ax < 0 || ax >= a.W || ay < 0 || ay >= a.H {
+		return 0, 0, pixelSkipped
+	}
+	return ax, ay, pixelCompared
+}
+
+// ForEachComparedPixel calls fn for every pixel (x, y) of B that BuildMask
+// compares with a pixel (ax, ay) of A under rowAlign, in row-major order, with
+// their difference under opts.Metric (and opts.Grayscale). It stops when fn
+// returns false. Rows without a source row in A are not visited.
+func ForEachComparedPixel(a, b *core.Frame, rowAlign core.RowAlignment, opts core.DiffOptions, fn func(x, y, ax, ay int, diff float64) bool) {
+	for y := 0; y < b.H; y++ {
+		for x := 0; x < b.W; x++ {
+			ax, ay, state := mapPixel(a, b, rowAlign, x, y)
+			if state != pixelCompared {
+				continue
+			}
+			if !fn(x, y, ax, ay, pixelDifference(a, ax, ay, b, x, y, opts)) {
+				return
+			}
+		}
+	}
+}
+
 func shouldApplyNoiseFilter(opts core.DiffOptions) bool {
 	return opts.NoiseWindowSize > 1 && opts.NoiseMinDiffRatio > 0
 }
@@ -98,14 +192,16 @@ func normalizeNoiseWindowSize(windowSize int) int {
 	return windowSize
 }
 
-func filterSparseNoise(mask *core.Mask, windowSize int, minDiffRatio float64) {
+// filterSparseNoise keeps the diff pixels whose window differs in at least
+// minDiffRatio of its pixels. Its scratch buffers come from ws.
+func filterSparseNoise(mask *core.Mask, windowSize int, minDiffRatio float64, ws *core.Workspace) {
 	windowSize = normalizeNoiseWindowSize(windowSize)
 	if windowSize == 0 || minDiffRatio <= 0 || mask.Count == 0 {
 		return
 	}
 
 	radius := windowSize / 2
-	prefix := make([]int, (mask.W+1)*(mask.H+1))
+	prefix := ws.Ints((mask.W + 1) * (mask.H + 1))
 	for y := 0; y < mask.H; y++ {
 		rowSum := 0
 		for x := 0; x < mask.W; x++ {
@@ -115,7 +211,7 @@ func filterSparseNoise(mask *core.Mask, windowSize int, minDiffRatio float64) {
 		}
 	}
 
-	filtered := make([]uint8, len(mask.Data))
+	filtered := ws.NewMask(mask.W, mask.H)
 	count := 0
 	for y := 0; y < mask.H; y++ {
 		for x := 0; x < mask.W; x++ {
@@ -134,14 +230,15 @@ func filterSparseNoise(mask *core.Mask, windowSize int, minDiffRatio float64) {
 
 			diffCount := sumRect(prefix, mask.W+1, x0, y0, x1, y1)
 			if float64(diffCount)/float64(windowArea) >= minDiffRatio-math.SmallestNonzeroFloat64 {
-				filtered[y*mask.W+x] = 1
+				filtered.Data[y*mask.W+x] = 1
 				count++
 			}
 		}
 	}
 
-	mask.Data = filtered
+	mask.Data, filtered.Data = filtered.Data, mask.Data
 	mask.Count = count
+	ws.Release(filtered)
 }
 
 func sumRect(prefix []int, stride, minX, minY, maxX, maxY int) int {
@@ -144,6 +144,69 @@ func TestBuildMask_ColumnSpecificMapping(t *testing.T) {
 	}
 }
 
+func TestBuildMask_ColorMetric(t *testing.T) {
+	a := makeFrame(2, 1, color.NRGBA{0, 0, 0, 255})
+	a.Pix.SetNRGBA(0, 0, color.NRGBA{60, 60, 200, 255})
+	a.Pix.SetNRGBA(1, 0, color.NRGBA{200, 200, 200, 255})
+	a = core.NewFrame(a.Pix)
+	b := makeFrame(2, 1, color.NRGBA{0, 0, 0, 255})
+	// A channel difference of 20 within saturated blue is barely visible
+	// (delta E 2.5); 15 turning light gray bluish is obvious (delta E 7.2).
+	b.Pix.SetNRGBA(0, 0, color.NRGBA{80, 60, 200, 255})
+	b.Pix.SetNRGBA(1, 0, color.NRGBA{200, 200, 215, 255})
+	b = core.NewFrame(b.Pix)
+	rowAlign := core.NewRowAlignmentFromAlignment(2, 1, core.Alignment{})
+
+	rgb := BuildMask(a, b, rowAlign, core.DiffOptions{Threshold: 16, Metric: core.ColorMetricRGB}, testLogger())
+	if !rgb.Get(0, 0) || rgb.Get(1, 0) {
+		t.Errorf("rgb mask %v, want only the blue shift", rgb.Data)
+	}
+	perceptual := BuildMask(a, b, rowAlign, core.DiffOptions{Threshold: 3, Metric: core.ColorMetricCIEDE2000}, testLogger())
+	if perceptual.Get(0, 0) || !perceptual.Get(1, 0) {
+		t.Errorf("ciede2000 mask %v, want only the gray turning bluish", perceptual.Data)
+	}
+}
+
+func TestBuildMask_IgnoreAntialiasing(t *testing.T) {
+	white := color.NRGBA{255, 255, 255, 255}
+	a := makeFrame(30, 20, white)
+	b := makeFrame(30, 20, white)
+	for y := 0; y < 20; y++ {
+		// A two pixel wide black stroke whose edges are anti-aliased
+		// differently, as with another font hinting.
+		for _, f := range []*core.Frame{a, b} {
+			f.Pix.SetNRGBA(10, y, color.NRGBA{0, 0, 0, 255})
+			f.Pix.SetNRGBA(11, y, color.NRGBA{0, 0, 0, 255})
+		}
+		a.Pix.SetNRGBA(12, y, color.NRGBA{128, 128, 128, 255})
+		b.Pix.SetNRGBA(12, y, color.NRGBA{64, 64, 64, 255})
+		b.Pix.SetNRGBA(9, y, color.NRGBA{200, 200, 200, 255})
+	}
+	// A real change.
+	for y := 5; y < 10; y++ {
+		for x := 20; x < 25; x++ {
+			b.Pix.SetNRGBA(x, y, color.NRGBA{255, 0, 0, 255})
+		}
+	}
+	a, b = core.NewFrame(a.Pix), core.NewFrame(b.Pix)
+	rowAlign := core.NewRowAlignmentFromAlignment(30, 20, core.Alignment{})
+
+	mask := BuildMask(a, b, rowAlign, core.DiffOptions{Threshold: 30}, testLogger())
+	if mask.Count != 2*20+25 {
+		t.Fatalf("expected 65 diff pixels without the detector, got %d", mask.Count)
+	}
+	for _, stop := range []bool{false, true} {
+		opts := core.DiffOptions{Threshold: 30, IgnoreAntialiasing: true, StopAfterFirst: stop}
+		mask = BuildMask(a, b, rowAlign, opts, testLogger())
+		if !stop && (mask.Count != 25 || mask.CountIn(image.Rect(20, 5, 25, 10)) != 25) {
+			t.Errorf("expected only the 25 pixels of the real change, got %d", mask.Count)
+		}
+		if stop && mask.Count != 1 {
+			t.Errorf("stop after first: expected the real change to be found, got %d", mask.Count)
+		}
+	}
+}
+
 func TestBuildMask_NoiseFilterRemovesSparsePixels(t *testing.T) {
 	a := makeFrame(20, 20, color.NRGBA{255, 255, 255, 255})
 	b := makeFrame(20, 20, color.NRGBA{255, 255, 255, 255})
@@ -192,6 +255,46 @@ func TestBuildMask_StopAfterFirstWithNoiseFilterBuildsFullMask(t *testing.T) {
 	}
 }
 
+// makePatternFrame draws a fixed pseudo-random pattern; seed changes a subset of pixels.
+func makePatternFrame(w, h int, seed uint32) *core.Frame {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	state := uint32(2463534242)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			state ^= state << 13
+			state ^= state >> 17
+			state ^= state << 5
+			v := uint8(x*3 + y*5)
+			if seed != 0 && state%97 < seed {
+				v += uint8(state >> 24)
+			}
+			img.SetNRGBA(x, y, color.NRGBA{v, v / 2, 255 - v, 255})
+		}
+	}
+	return core.NewFrame(img)
+}
+
+func TestBuildMask_ParallelMatchesSequential(t *testing.T) {
+	a := makePatternFrame(203, 157, 0)
+	b := makePatternFrame(203, 157, 7)
+	for _, al := range []core.Alignment{{}, {DX: 2, DY: -3}} {
+		rowAlign := core.NewRowAlignmentFromAlignment(b.W, b.H, al)
+		opts := core.DiffOptions{Threshold: 20, Workers: 1}
+		want := BuildMask(a, b, rowAlign, opts, testLogger())
+		if want.Count == 0 {
+			t.Fatal("expected differences in the fixture")
+		}
+
+		for _, workers := range []int{2, 3, 8, 64} {
+			opts.Workers = workers
+			got := BuildMask(a, b, rowAlign, opts, testLogger())
+			if got.Count != want.Count || string(got.Data) != string(want.Data) {
+				t.Errorf("offset %+v, %d workers: mask differs from sequential (%d vs %d pixels)", al, workers, got.Count, want.Count)
+			}
+		}
+	}
+}
+
 func countPixels(mask *core.Mask, minX, minY, maxX, maxY int) int {
 	count := 0
 	for y := max(0, minY); y < min(mask.H, maxY); y++ {
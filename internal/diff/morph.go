@@ -0,0 +1,79 @@
+package diff
+
+import "github.com/xshoji/go-img-diff/internal/core"
+
+// shouldApplyMorphology reports whether Despeckle or Close is set.
+func shouldApplyMorphology(opts core.DiffOptions) bool {
+	return opts.Despeckle > 0 || opts.Close > 0
+}
+
+// applyMorphology opens the mask with radius opts.Despeckle and then closes
+// it with radius opts.Close (see core.DiffOptions), updating its count.
+func applyMorphology(mask *core.Mask, opts core.DiffOptions, ws *core.Workspace) {
+	if opts.Despeckle > 0 {
+		erode(mask, opts.Despeckle, ws)
+		dilate(mask, opts.Despeckle, ws)
+	}
+	if opts.Close > 0 {
+		dilate(mask, opts.Close, ws)
+		erode(mask, opts.Close, ws)
+	}
+	count := 0
+	for _, v := range mask.Data {
+		count += int(v)
+	}
+	mask.Count = count
+}
+
+// erode keeps the pixels of mask whose square of 2*radius+1 pixels, clipped
+// to the mask, is set entirely. mask.Count is not updated.
+func erode(mask *core.Mask, radius int, ws *core.Workspace) {
+	morph(mask, radius, true, ws)
+}
+
+// dilate sets the pixels of mask whose square of 2*radius+1 pixels has any
+// pixel set. mask.Count is not updated.
+func dilate(mask *core.Mask, radius int, ws *core.Workspace) {
+	morph(mask, radius, false, ws)
+}
+
+// morph erodes or dilates mask with a square, as a horizontal pass into a
+// scratch mask from ws followed by a vertical pass back, each sliding a count
+// of the set pixels along the line: O(1) per pixel whatever the radius.
+func morph(mask *core.Mask, radius int, all bool, ws *core.Workspace) {
+	if radius <= 0 || mask.W == 0 || mask.H == 0 {
+		return
+	}
+	tmp := ws.NewMask(mask.W, mask.H)
+	for y := 0; y < mask.H; y++ {
+		morphLine(mask.Data, tmp.Data, y*mask.W, 1, mask.W, radius, all)
+	}
+	for x := 0; x < mask.W; x++ {
+		morphLine(tmp.Data, mask.Data, x, mask.W, mask.H, radius, all)
+	}
+	ws.Release(tmp)
+}
+
+// morphLine writes to dst, for each of the n pixels of the line starting at
+// offset with the given stride, whether all (erosion) or any (dilation) of
+// the pixels of src within radius along the line, clipped to it, are set.
+func morphLine(src, dst []uint8, offset, stride, n, radius int, all bool) {
+	count := 0
+	for i := 0; i < min(radius, n); i++ {
+		count += int(src[offset+i*stride])
+	}
+	for i := 0; i < n; i++ {
+		if j := i + radius; j < n {
+			count += int(src[offset+j*stride])
+		}
+		if j := i - radius - 1; j >= 0 {
+			count -= int(src[offset+j*stride])
+		}
+		window := min(n-1, i+radius) - max(0, i-radius) + 1
+		var v uint8
+		if all && count == window || !all && count > 0 {
+			v = 1
+		}
+		dst[offset+i*stride] = v
+	}
+}
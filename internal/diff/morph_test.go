@@ -0,0 +1,213 @@
+package diff
+
+import (
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+
+	"github.com/xshoji/go-img-diff/internal/core"
+)
+
+// parseMask builds a mask from rows of '#' (set) and '.' (clear).
+func parseMask(rows ...string) *core.Mask {
+	m := core.NewMask(len(rows[0]), len(rows))
+	for y, row := range rows {
+		for x, c := range row {
+			if c == '#' {
+				m.Set(x, y)
+			}
+		}
+	}
+	return m
+}
+
+// formatMask is the inverse of parseMask, one row per line.
+func formatMask(m *core.Mask) string {
+	var sb strings.Builder
+	for y := 0; y < m.H; y++ {
+		for x := 0; x < m.W; x++ {
+			if m.Get(x, y) {
+				sb.WriteByte('#')
+			} else {
+				sb.WriteByte('.')
+			}
+		}
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
+
+func TestApplyMorphology(t *testing.T) {
+	tests := []struct {
+		name      string
+		despeckle int
+		close     int
+		in, want  []string
+	}{
+		{
+			name:      "opening removes specks and thin lines",
+			despeckle: 1,
+			in: []string{
+				"#.......",
+				"...#....",
+				".....###",
+				"........",
+				".###....",
+				".###..#.",
+				".###..#.",
+			},
+			want: []string{
+				"........",
+				"........",
+				"........",
+				"........",
+				".###....",
+				".###....",
+				".###....",
+			},
+		},
+		{
+			name:      "opening keeps blocks at the edges",
+			despeckle: 1,
+			in: []string{
+				"###...",
+				"###...",
+				"###..#",
+				"......",
+			},
+			want: []string{
+				"###...",
+				"###...",
+				"###...",
+				"......",
+			},
+		},
+		{
+			name:      "opening rounds off protrusions",
+			despeckle: 1,
+			in: []string{
+				"......",
+				".####.",
+				".#####",
+				".####.",
+				"......",
+			},
+			want: []string{
+				"......",
+				".####.",
+				".####.",
+				".####.",
+				"......",
+			},
+		},
+		{
+			name:  "closing fills holes and gaps up to 2 pixels",
+			close: 1,
+			in: []string{
+				"..........",
+				"..........",
+				"..#####...",
+				"..#.#.#...",
+				"..#####...",
+				"..........",
+				"..........",
+				"..........",
+				"..##..#...",
+				"..........",
+				"..........",
+			},
+			want: []string{
+				"..........",
+				"..........",
+				"..#####...",
+				"..#####...",
+				"..#####...",
+				"..........",
+				"..........",
+				"..........",
+				"..#####...",
+				"..........",
+				"..........",
+			},
+		},
+		{
+			name:      "opening then closing",
+			despeckle: 1,
+			close:     1,
+			in: []string{
+				"#...........",
+				"............",
+				"..###.###...",
+				"..###.###...",
+				"..###.###..#",
+				"............",
+				"............",
+			},
+			want: []string{
+				"............",
+				"............",
+				"..#######...",
+				"..#######...",
+				"..#######...",
+				"............",
+				"............",
+			},
+		},
+	}
+	for _, tt := range tests {
+		m := parseMask(tt.in...)
+		applyMorphology(m, core.DiffOptions{Despeckle: tt.despeckle, Close: tt.close}, nil)
+		want := parseMask(tt.want...)
+		if got := formatMask(m); got != formatMask(want) {
+			t.Errorf("%s:\n%s\nwant\n%s", tt.name, got, formatMask(want))
+		}
+		if m.Count != want.Count {
+			t.Errorf("%s: Count = %d, want %d", tt.name, m.Count, want.Count)
+		}
+	}
+}
+
+func TestMorph_Radius2(t *testing.T) {
+	// A 5x5 block survives an opening of radius 2, a 4x4 one does not.
+	m := core.NewMask(20, 10)
+	m.SetRect(image.Rect(1, 1, 6, 6))
+	m.SetRect(image.Rect(10, 1, 14, 5))
+	applyMorphology(m, core.DiffOptions{Despeckle: 2}, nil)
+	if m.Count != 25 || !m.Get(1, 1) || !m.Get(5, 5) || m.Get(10, 1) {
+		t.Errorf("opening of radius 2:\n%s", formatMask(m))
+	}
+
+	// Dilation and erosion with a radius larger than the mask clip to it.
+	m = parseMask("...", ".#.", "...")
+	dilate(m, 5, nil)
+	if got := formatMask(m); got != "###\n###\n###\n" {
+		t.Errorf("dilate:\n%s", got)
+	}
+	erode(m, 5, nil)
+	if got := formatMask(m); got != "###\n###\n###\n" {
+		t.Errorf("erode of a full mask:\n%s", got)
+	}
+}
+
+func TestBuildMask_Despeckle(t *testing.T) {
+	a := makeFrame(20, 20, color.NRGBA{255, 255, 255, 255})
+	b := makeFrame(20, 20, color.NRGBA{255, 255, 255, 255})
+	b.Pix.SetNRGBA(5, 5, color.NRGBA{0, 0, 0, 255})
+	for y := 12; y < 15; y++ {
+		for x := 12; x < 15; x++ {
+			b.Pix.SetNRGBA(x, y, color.NRGBA{0, 0, 0, 255})
+		}
+	}
+	b = core.NewFrame(b.Pix)
+	rowAlign := core.NewRowAlignmentFromAlignment(20, 20, core.Alignment{})
+
+	// StopAfterFirst must not stop at the speck the opening removes.
+	for _, stop := range []bool{false, true} {
+		opts := core.DiffOptions{Threshold: 30, Despeckle: 1, StopAfterFirst: stop}
+		mask := BuildMask(a, b, rowAlign, opts, testLogger())
+		if mask.Count != 9 || mask.Get(5, 5) {
+			t.Errorf("stop after first %v: expected only the 3x3 block, got %d diff pixels", stop, mask.Count)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package diff
+
+import (
+	"image"
+
+	"github.com/xshoji/go-img-diff/internal/core"
+)
+
+// ScoreRegions sets the MeanDiff of each region to the mean difference under
+// opts (see ForEachComparedPixel) of the differing pixels of mask within its
+// bounds, counting pixels without a counterpart in a as the largest
+// difference, and refines its Severity: the share of its bounds that differs,
+// weighted by MeanDiff on the metric's scale. A faint change thus ranks below
+// an equally large solid one.
+func ScoreRegions(a, b *core.Frame, rowAlign core.RowAlignment, mask *core.Mask, regions []core.Region, opts core.DiffOptions) {
+	maxDiff := float64(opts.Metric.MaxThreshold())
+	for i := range regions {
+		r := &regions[i]
+		bounds := r.Bounds.Intersect(image.Rect(0, 0, mask.W, mask.H))
+		var sum float64
+		n := 0
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				if !mask.Get(x, y) {
+					continue
+				}
+				switch ax, ay, state := mapPixel(a, b, rowAlign, x, y); state {
+				case pixelCompared:
+					sum += min(maxDiff, pixelDifference(a, ax, ay, b, x, y, opts))
+					n++
+				case pixelUnmapped:
+					sum += maxDiff
+					n++
+				}
+			}
+		}
+		r.MeanDiff = 0
+		if n > 0 {
+			r.MeanDiff = sum / float64(n)
+		}
+		size := r.Bounds.Dx() * r.Bounds.Dy()
+		r.Severity = 0
+		if size > 0 {
+			r.Severity = min(1, float64(r.Area)/float64(size)) * r.MeanDiff / maxDiff
+		}
+	}
+}
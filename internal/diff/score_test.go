@@ -0,0 +1,70 @@
+package diff
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+
+	"github.com/xshoji/go-img-diff/internal/core"
+	"github.com/xshoji/go-img-diff/internal/region"
+)
+
+func TestScoreRegions_RanksSolidChangeFirst(t *testing.T) {
+	// A tiny faint change (a 2x2 speck 30 levels off) at the top left and a
+	// large solid one (20x20, 150 levels off) further down.
+	a := makeFrame(60, 40, color.NRGBA{100, 100, 100, 255})
+	b := makeFrame(60, 40, color.NRGBA{100, 100, 100, 255})
+	tiny, large := image.Rect(2, 2, 4, 4), image.Rect(35, 15, 55, 35)
+	mask := core.NewMask(60, 40)
+	for _, c := range []struct {
+		r image.Rectangle
+		v uint8
+	}{{tiny, 130}, {large, 250}} {
+		for y := c.r.Min.Y; y < c.r.Max.Y; y++ {
+			for x := c.r.Min.X; x < c.r.Max.X; x++ {
+				b.Pix.SetNRGBA(x, y, color.NRGBA{c.v, c.v, c.v, 255})
+			}
+		}
+		mask.SetRect(c.r)
+	}
+	// Padded bounds, as region.Extract returns them.
+	regions := []core.Region{
+		{Bounds: image.Rect(0, 0, 6, 6), Area: 4},
+		{Bounds: image.Rect(33, 13, 57, 37), Area: 400},
+	}
+
+	rowAlign := core.NewRowAlignmentFromAlignment(60, 40, core.Alignment{})
+	ScoreRegions(a, b, rowAlign, mask, regions, core.DiffOptions{Metric: core.ColorMetricRGB})
+	if regions[0].MeanDiff != 30 || regions[1].MeanDiff != 150 {
+		t.Errorf("mean diffs = %v, %v, want 30 and 150", regions[0].MeanDiff, regions[1].MeanDiff)
+	}
+	if want := 4.0 / 36 * 30 / 255; math.Abs(regions[0].Severity-want) > 1e-12 {
+		t.Errorf("tiny severity = %v, want %v", regions[0].Severity, want)
+	}
+	if want := 400.0 / 576 * 150 / 255; math.Abs(regions[1].Severity-want) > 1e-12 {
+		t.Errorf("large severity = %v, want %v", regions[1].Severity, want)
+	}
+
+	region.SortBySeverity(regions)
+	if regions[0].Bounds.Min != image.Pt(33, 13) {
+		t.Errorf("first region = %v, want the large change", regions[0].Bounds)
+	}
+}
+
+func TestScoreRegions_UnmappedRowsCountAsMaxDiff(t *testing.T) {
+	a := makeFrame(10, 10, color.NRGBA{100, 100, 100, 255})
+	b := makeFrame(10, 10, color.NRGBA{100, 100, 100, 255})
+	mask := core.NewMask(10, 10)
+	mask.SetRect(image.Rect(0, 8, 10, 10))
+	regions := []core.Region{{Bounds: image.Rect(0, 8, 10, 10), Area: 20}}
+
+	// The bottom rows of B have no source row in A.
+	rowAlign := core.NewRowAlignmentFromAlignment(10, 10, core.Alignment{})
+	rowAlign.SrcYByY[8] = -1
+	rowAlign.SrcYByY[9] = -1
+	ScoreRegions(a, b, rowAlign, mask, regions, core.DiffOptions{Metric: core.ColorMetricCIEDE2000})
+	if regions[0].MeanDiff != 100 || regions[0].Severity != 1 {
+		t.Errorf("mean diff = %v, severity = %v, want 100 and 1", regions[0].MeanDiff, regions[0].Severity)
+	}
+}
@@ -0,0 +1,60 @@
+package diff
+
+import "github.com/xshoji/go-img-diff/internal/core"
+
+// MeanSquaredError returns the mean squared difference of the R, G and B
+// values of the pixels of B compared with A under rowAlign (the pixels
+// visited by ForEachComparedPixel), and their number. It does not depend on
+// the diff options, so it is comparable across thresholds. It is 0 if no
+// pixel is compared.
+func MeanSquaredError(a, b *core.Frame, rowAlign core.RowAlignment) (float64, int) {
+	var sum uint64
+	n := 0
+	for y := 0; y < b.H; y++ {
+		for x := 0; x < b.W; x++ {
+			ax, ay, state := mapPixel(a, b, rowAlign, x, y)
+			if state != pixelCompared {
+				continue
+			}
+			aOff := ay*a.Pix.Stride + ax*4
+			bOff := y*b.Pix.Stride + x*4
+			for c := 0; c < 3; c++ {
+				d := int(a.Pix.Pix[aOff+c]) - int(b.Pix.Pix[bOff+c])
+				sum += uint64(d * d)
+			}
+			n++
+		}
+	}
+	if n == 0 {
+		return 0, 0
+	}
+	return float64(sum) / float64(3*n), n
+}
+
+// CountCompared returns the number of pixels of B that BuildMask can mark
+// under rowAlign: those ForEachComparedPixel visits, plus those in rows
+// without a source row in A, which always differ, except in the rows of
+// bands, which are reported separately.
+func CountCompared(a, b *core.Frame, rowAlign core.RowAlignment, bands []core.RowBand) int {
+	n := 0
+	for y := 0; y < b.H; y++ {
+		if inBands(y, bands) {
+			continue
+		}
+		for x := 0; x < b.W; x++ {
+			if _, _, state := mapPixel(a, b, rowAlign, x, y); state != pixelSkipped {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+func inBands(y int, bands []core.RowBand) bool {
+	for _, band := range bands {
+		if y >= band.Y0 && y < band.Y1 {
+			return true
+		}
+	}
+	return false
+}
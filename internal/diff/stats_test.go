@@ -0,0 +1,46 @@
+package diff
+
+import (
+	"image/color"
+	"math"
+	"testing"
+
+	"github.com/xshoji/go-img-diff/internal/core"
+)
+
+func TestMeanSquaredError(t *testing.T) {
+	a := makeFrame(10, 10, color.NRGBA{100, 100, 100, 255})
+	b := makeFrame(10, 10, color.NRGBA{110, 100, 70, 0}) // alpha is not compared
+
+	rowAlign := core.NewRowAlignmentFromAlignment(10, 10, core.Alignment{})
+	if mse, n := MeanSquaredError(a, a, rowAlign); mse != 0 || n != 100 {
+		t.Errorf("identical: mse=%v n=%d, want 0 and 100", mse, n)
+	}
+
+	// Only the overlap under the offset and pixels not ignored are compared.
+	b.Ignore = core.NewMask(10, 10)
+	b.Ignore.Set(5, 5)
+	rowAlign = core.NewRowAlignmentFromAlignment(10, 10, core.Alignment{DX: 2})
+	mse, n := MeanSquaredError(a, b, rowAlign)
+	if n != 79 || math.Abs(mse-1000.0/3) > 1e-9 {
+		t.Errorf("mse=%v n=%d, want %v and 79", mse, n, 1000.0/3)
+	}
+}
+
+func TestCountCompared(t *testing.T) {
+	a := makeFrame(10, 10, color.NRGBA{100, 100, 100, 255})
+	b := makeFrame(10, 10, color.NRGBA{100, 100, 100, 255})
+	b.Ignore = core.NewMask(10, 10)
+	b.Ignore.Set(5, 5)
+
+	// Columns shifted out of A are not compared; rows shifted out of A always
+	// differ, so they are counted unless a row band reports them.
+	rowAlign := core.NewRowAlignmentFromAlignment(10, 10, core.Alignment{DX: 2, DY: 3})
+	if n := CountCompared(a, b, rowAlign, nil); n != 85 {
+		t.Errorf("n=%d, want 85", n)
+	}
+	bands := []core.RowBand{{Kind: core.RowBandInserted, Y0: 0, Y1: 3}}
+	if n := CountCompared(a, b, rowAlign, bands); n != 55 {
+		t.Errorf("with a band: n=%d, want 55", n)
+	}
+}
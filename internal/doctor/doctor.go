@@ -0,0 +1,134 @@
+// Package doctor runs the full imgdiff pipeline on synthetic image pairs and
+// checks the results against known outcomes.
+package doctor
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"runtime"
+	"text/tabwriter"
+
+	"github.com/xshoji/go-img-diff/internal/app"
+	"github.com/xshoji/go-img-diff/internal/core"
+	"github.com/xshoji/go-img-diff/internal/imgio"
+)
+
+const (
+	fixtureW = 240
+	fixtureH = 180
+)
+
+// Check is the outcome of one synthetic scenario.
+type Check struct {
+	Name   string
+	Passed bool
+	Detail string
+}
+
+// scenario describes a synthetic image pair and its expected result.
+type scenario struct {
+	name        string
+	a, b        image.Image
+	wantOffset  image.Point
+	wantRegions int
+}
+
+func scenarios() []scenario {
+	base := fixture(fixtureW, fixtureH, 0, 0)
+	return []scenario{
+		{name: "identical", a: base, b: fixture(fixtureW, fixtureH, 0, 0)},
+		// Rows scrolled in at the top have no counterpart in A and form one region.
+		{name: "shifted", a: base, b: fixture(fixtureW, fixtureH, 4, 3), wantOffset: image.Pt(4, 3), wantRegions: 1},
+		{name: "single-region", a: base, b: withPatch(fixture(fixtureW, fixtureH, 0, 0), image.Rect(100, 70, 140, 100)), wantRegions: 1},
+		{name: "size-mismatch", a: base, b: fixture(fixtureW-20, fixtureH-20, 0, 0)},
+	}
+}
+
+// Run writes each synthetic pair as PNG into dir, runs the full pipeline with
+// default options and returns one check per scenario.
+func Run(dir string) ([]Check, error) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	var checks []Check
+	for _, s := range scenarios() {
+		pathA := filepath.Join(dir, s.name+"-a.png")
+		pathB := filepath.Join(dir, s.name+"-b.png")
+		for path, img := range map[string]image.Image{pathA: s.a, pathB: s.b} {
+			if err := imgio.SaveImage(img, path, imgio.WriteAtomic, logger); err != nil {
+				return nil, fmt.Errorf("failed to write fixture: %w", err)
+			}
+		}
+
+		opts := core.DefaultOptions()
+		opts.Input1 = pathA
+		opts.Input2 = pathB
+		opts.Output.Path = filepath.Join(dir, s.name+"-diff.png")
+		checks = append(checks, evaluate(s, opts, logger))
+	}
+	return checks, nil
+}
+
+func evaluate(s scenario, opts core.Options, logger *slog.Logger) Check {
+	result, err := app.Run(opts, false, logger)
+	if err != nil {
+		return Check{Name: s.name, Detail: err.Error()}
+	}
+	gotOffset := image.Pt(result.Aligned.DX, result.Aligned.DY)
+	detail := fmt.Sprintf("offset %v (want %v), regions %d (want %d)", gotOffset, s.wantOffset, len(result.Regions), s.wantRegions)
+	return Check{
+		Name:   s.name,
+		Passed: gotOffset == s.wantOffset && len(result.Regions) == s.wantRegions,
+		Detail: detail,
+	}
+}
+
+// Print writes the environment summary and a pass/fail table to w.
+func Print(w io.Writer, checks []Check, version string) {
+	fmt.Fprintf(w, "imgdiff %s (%s, %s/%s, %d CPUs)\n\n", version, runtime.Version(), runtime.GOOS, runtime.GOARCH, runtime.NumCPU())
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "CHECK\tSTATUS\tDETAIL")
+	for _, c := range checks {
+		status := "FAIL"
+		if c.Passed {
+			status = "PASS"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", c.Name, status, c.Detail)
+	}
+	tw.Flush()
+}
+
+// AllPassed reports whether every check passed.
+func AllPassed(checks []Check) bool {
+	for _, c := range checks {
+		if !c.Passed {
+			return false
+		}
+	}
+	return true
+}
+
+// fixture draws a deterministic block pattern resembling UI content, shifted
+// by (shiftX, shiftY).
+func fixture(w, h, shiftX, shiftY int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			sx, sy := x-shiftX, y-shiftY
+			v := uint8(((sx/9)*37 + (sy/6)*23) % 256)
+			img.SetNRGBA(x, y, color.NRGBA{v, 255 - v, uint8(sy), 255})
+		}
+	}
+	return img
+}
+
+func withPatch(img *image.NRGBA, r image.Rectangle) *image.NRGBA {
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{255, 255, 255, 255})
+		}
+	}
+	return img
+}
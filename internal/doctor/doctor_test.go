@@ -0,0 +1,36 @@
+package doctor
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestRun_AllChecksPass(t *testing.T) {
+	checks, err := Run(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(checks) != len(scenarios()) {
+		t.Fatalf("got %d checks, want %d", len(checks), len(scenarios()))
+	}
+	for _, c := range checks {
+		if !c.Passed {
+			t.Errorf("%s failed: %s", c.Name, c.Detail)
+		}
+	}
+	if !AllPassed(checks) {
+		t.Error("AllPassed = false")
+	}
+}
+
+func TestPrint(t *testing.T) {
+	var buf bytes.Buffer
+	Print(&buf, []Check{{Name: "identical", Passed: true}, {Name: "shifted", Detail: "boom"}}, "v1.2.3")
+	out := buf.String()
+	for _, want := range []string{"imgdiff v1.2.3", "CPUs", "identical  PASS", "shifted    FAIL    boom"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+}
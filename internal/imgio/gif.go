@@ -0,0 +1,44 @@
+package imgio
+
+import (
+	"fmt"
+	"image"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"io"
+	"log/slog"
+	"time"
+)
+
+// EncodeBlinkGIF encodes the frames as an endlessly looping animated GIF that
+// shows each frame for delay. Frames are quantized to the Plan 9 palette with
+// Floyd-Steinberg dithering.
+func EncodeBlinkGIF(w io.Writer, frames []image.Image, delay time.Duration) error {
+	centis := max(1, int(delay/(10*time.Millisecond)))
+	anim := &gif.GIF{LoopCount: 0}
+	for _, f := range frames {
+		b := f.Bounds()
+		p := image.NewPaletted(image.Rect(0, 0, b.Dx(), b.Dy()), palette.Plan9)
+		draw.FloydSteinberg.Draw(p, p.Bounds(), f, b.Min)
+		anim.Image = append(anim.Image, p)
+		anim.Delay = append(anim.Delay, centis)
+	}
+	if err := gif.EncodeAll(w, anim); err != nil {
+		return fmt.Errorf("failed to encode gif: %w", err)
+	}
+	return nil
+}
+
+// SaveBlinkGIF writes a looping blink comparison GIF to path.
+func SaveBlinkGIF(frames []image.Image, delay time.Duration, path string, mode WriteMode, logger *slog.Logger) error {
+	err := WriteFile(path, mode, func(w io.Writer) error {
+		return EncodeBlinkGIF(w, frames, delay)
+	})
+	if err != nil {
+		return err
+	}
+
+	logger.Info("saved blink gif", "path", path, "frames", len(frames), "delay", delay)
+	return nil
+}
@@ -1,13 +1,21 @@
 package imgio
 
 import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
 	"image"
 	"image/color"
+	"image/gif"
 	"image/png"
 	"log/slog"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/xshoji/go-img-diff/internal/core"
 )
 
 func testLogger() *slog.Logger {
@@ -31,7 +39,25 @@ func TestLoadFrame(t *testing.T) {
 func TestLoadFrame_NotFound(t *testing.T) {
 	_, err := LoadFrame("/nonexistent/file.png", testLogger())
 	if err == nil {
-		t.Error("expected error for non-existent file")
+		t.Fatal("expected error for non-existent file")
+	}
+	if kind := KindOf(err); kind != ErrorKindNotFound {
+		t.Errorf("expected kind %q, got %q", ErrorKindNotFound, kind)
+	}
+}
+
+func TestLoadFrame_DecodeError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "broken.png")
+	if err := os.WriteFile(path, []byte("not an image"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := LoadFrame(path, testLogger())
+	if err == nil {
+		t.Fatal("expected error for undecodable file")
+	}
+	if kind := KindOf(err); kind != ErrorKindDecode {
+		t.Errorf("expected kind %q, got %q", ErrorKindDecode, kind)
 	}
 }
 
@@ -41,7 +67,7 @@ func TestSaveImage(t *testing.T) {
 
 	t.Run("png", func(t *testing.T) {
 		path := filepath.Join(dir, "out.png")
-		if err := SaveImage(img, path, testLogger()); err != nil {
+		if err := SaveImage(img, path, WriteAtomic, testLogger()); err != nil {
 			t.Fatalf("SaveImage failed: %v", err)
 		}
 		if _, err := os.Stat(path); err != nil {
@@ -51,19 +77,58 @@ func TestSaveImage(t *testing.T) {
 
 	t.Run("jpg", func(t *testing.T) {
 		path := filepath.Join(dir, "out.jpg")
-		if err := SaveImage(img, path, testLogger()); err != nil {
+		if err := SaveImage(img, path, WriteAtomic, testLogger()); err != nil {
 			t.Fatalf("SaveImage failed: %v", err)
 		}
 	})
 
 	t.Run("unsupported", func(t *testing.T) {
 		path := filepath.Join(dir, "out.bmp")
-		if err := SaveImage(img, path, testLogger()); err == nil {
+		if err := SaveImage(img, path, WriteAtomic, testLogger()); err == nil {
 			t.Error("expected error for unsupported format")
 		}
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Error("unsupported format must not leave a file behind")
+		}
 	})
 }
 
+func TestCheckImageOutput(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "file.png")
+	createTestPNG(t, file, 1, 1)
+
+	for _, path := range []string{
+		filepath.Join(dir, "out.png"),
+		filepath.Join(dir, "missing", "nested", "out.png"), // created on save
+	} {
+		if err := CheckImageOutput(path, WriteAtomic); err != nil {
+			t.Errorf("%s: unexpected error %v", path, err)
+		}
+	}
+	for _, tt := range []struct {
+		path string
+		mode WriteMode
+	}{
+		{filepath.Join(dir, "out.bmp"), WriteAtomic},
+		{filepath.Join(dir, "missing", "out.png"), WriteNoMkdir},
+		{filepath.Join(file, "out.png"), WriteAtomic}, // parent is a file
+		{file, WriteNoOverwrite},
+	} {
+		if err := CheckImageOutput(tt.path, tt.mode); err == nil {
+			t.Errorf("%s (mode %d): expected error", tt.path, tt.mode)
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("probe files left behind: %d entries", len(entries))
+	}
+}
+
 func createTestPNG(t *testing.T, path string, w, h int) {
 	t.Helper()
 	img := image.NewNRGBA(image.Rect(0, 0, w, h))
@@ -81,3 +146,147 @@ func createTestPNG(t *testing.T, path string, w, h int) {
 		t.Fatal(err)
 	}
 }
+
+func TestSaveBlinkGIF(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blink.gif")
+	a := image.NewNRGBA(image.Rect(0, 0, 20, 10))
+	b := image.NewNRGBA(image.Rect(0, 0, 20, 10))
+	for x := 0; x < 20; x++ {
+		b.SetNRGBA(x, 5, color.NRGBA{255, 0, 0, 255})
+	}
+
+	if err := SaveBlinkGIF([]image.Image{a, b}, 500*time.Millisecond, path, WriteAtomic, testLogger()); err != nil {
+		t.Fatalf("SaveBlinkGIF failed: %v", err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	anim, err := gif.DecodeAll(f)
+	if err != nil {
+		t.Fatalf("failed to decode gif: %v", err)
+	}
+	if len(anim.Image) != 2 {
+		t.Fatalf("expected 2 frames, got %d", len(anim.Image))
+	}
+	for i, d := range anim.Delay {
+		if d != 50 {
+			t.Errorf("frame %d: expected delay 50 (1/100 s), got %d", i, d)
+		}
+	}
+	if anim.LoopCount != 0 {
+		t.Errorf("expected endless loop, got LoopCount=%d", anim.LoopCount)
+	}
+	if anim.Image[0].Bounds().Dx() != 20 || anim.Image[0].Bounds().Dy() != 10 {
+		t.Errorf("unexpected frame size %v", anim.Image[0].Bounds())
+	}
+}
+
+func TestInspectImage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "in.png")
+	createTestPNG(t, path, 30, 20)
+
+	info, err := InspectImage(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stat, _ := os.Stat(path)
+	want := ImageInfo{Path: path, Format: "png", Width: 30, Height: 20, ColorModel: "rgba", BitDepth: 8, FileSize: stat.Size()} // opaque PNGs decode as RGBA
+	if info != want {
+		t.Errorf("info = %+v, want %+v", info, want)
+	}
+
+	if _, err := InspectImage(filepath.Join(t.TempDir(), "missing.png")); KindOf(err) != ErrorKindNotFound {
+		t.Errorf("missing file: kind %q", KindOf(err))
+	}
+}
+
+func TestSaveImageEncoded(t *testing.T) {
+	dir := t.TempDir()
+	img := image.NewNRGBA(image.Rect(0, 0, 64, 64))
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 64; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{uint8(x * 4), uint8(y * 4), uint8((x*7 + y*13) % 256), 255})
+		}
+	}
+
+	tests := []struct {
+		name         string
+		small, large Encoding
+		ext          string
+	}{
+		{"jpeg quality", Encoding{JPEGQuality: 10}, Encoding{JPEGQuality: 100}, ".jpg"},
+		{"png compression", Encoding{PNGCompression: core.PNGCompressionBest}, Encoding{PNGCompression: core.PNGCompressionNone}, ".png"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sizes [2]int64
+			for i, enc := range []Encoding{tt.small, tt.large} {
+				path := filepath.Join(dir, fmt.Sprintf("%s-%d%s", strings.ReplaceAll(tt.name, " ", "-"), i, tt.ext))
+				if err := SaveImageEncoded(img, path, enc, WriteAtomic, testLogger()); err != nil {
+					t.Fatal(err)
+				}
+				frame, err := LoadFrame(path, testLogger())
+				if err != nil {
+					t.Fatalf("decode %s: %v", path, err)
+				}
+				if frame.Pix.Bounds() != img.Bounds() {
+					t.Errorf("%s: bounds = %v, want %v", path, frame.Pix.Bounds(), img.Bounds())
+				}
+				info, _ := os.Stat(path)
+				sizes[i] = info.Size()
+			}
+			if sizes[0] >= sizes[1] {
+				t.Errorf("sizes = %d, %d; want the first smaller", sizes[0], sizes[1])
+			}
+		})
+	}
+}
+
+func TestSaveImageEncoded_Text(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.png")
+	img := image.NewNRGBA(image.Rect(0, 0, 4, 3))
+	text := map[string]string{"Software": "imgdiff 1.2.3 (commit abc1234)", "Comment": "diff"}
+	if err := SaveImageEncoded(img, path, Encoding{Text: text}, WriteAtomic, testLogger()); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The decoder verifies the CRC of every chunk, including tEXt.
+	if _, err := png.Decode(bytes.NewReader(data)); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+
+	var chunks []string
+	for p := 8; p+8 <= len(data); {
+		n := int(binary.BigEndian.Uint32(data[p:]))
+		typ, body := string(data[p+4:p+8]), data[p+8:p+8+n]
+		if typ == "tEXt" {
+			chunks = append(chunks, strings.Replace(string(body), "\x00", "=", 1))
+		} else {
+			chunks = append(chunks, typ)
+		}
+		p += 12 + n
+	}
+	want := "IHDR|Comment=diff|Software=imgdiff 1.2.3 (commit abc1234)|IDAT|IEND"
+	if got := strings.Join(chunks, "|"); got != want {
+		t.Errorf("chunks = %s, want %s", got, want)
+	}
+}
+
+func TestAddPNGText_InvalidKeyword(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 1, 1))); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := addPNGText(buf.Bytes(), map[string]string{"": "x"}); err == nil {
+		t.Error("expected an error for an empty keyword")
+	}
+	if _, err := addPNGText([]byte("not a png"), map[string]string{"Software": "x"}); err == nil {
+		t.Error("expected an error for data that is not a png")
+	}
+}
@@ -0,0 +1,76 @@
+package imgio
+
+import (
+	"image"
+	"image/color"
+	"os"
+)
+
+// ImageInfo is the header metadata of an image file.
+type ImageInfo struct {
+	Path       string
+	Format     string
+	Width      int
+	Height     int
+	ColorModel string
+	BitDepth   int // bits per channel
+	FileSize   int64
+}
+
+// Size returns the image dimensions.
+func (i ImageInfo) Size() image.Point {
+	return image.Pt(i.Width, i.Height)
+}
+
+// InspectImage reads only the header of the image at path.
+func InspectImage(path string) (ImageInfo, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return ImageInfo{}, &LoadError{Path: path, Kind: openErrorKind(err), Err: err}
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return ImageInfo{}, &LoadError{Path: path, Kind: ErrorKindIO, Err: err}
+	}
+	cfg, format, err := image.DecodeConfig(file)
+	if err != nil {
+		return ImageInfo{}, &LoadError{Path: path, Kind: ErrorKindDecode, Err: err}
+	}
+	model, depth := describeColorModel(cfg.ColorModel)
+	return ImageInfo{
+		Path:       path,
+		Format:     format,
+		Width:      cfg.Width,
+		Height:     cfg.Height,
+		ColorModel: model,
+		BitDepth:   depth,
+		FileSize:   stat.Size(),
+	}, nil
+}
+
+func describeColorModel(m color.Model) (string, int) {
+	switch m {
+	case color.GrayModel:
+		return "gray", 8
+	case color.Gray16Model:
+		return "gray", 16
+	case color.RGBAModel:
+		return "rgba", 8
+	case color.RGBA64Model:
+		return "rgba", 16
+	case color.NRGBAModel:
+		return "nrgba", 8
+	case color.NRGBA64Model:
+		return "nrgba", 16
+	case color.YCbCrModel:
+		return "ycbcr", 8
+	case color.CMYKModel:
+		return "cmyk", 8
+	}
+	if _, ok := m.(color.Palette); ok {
+		return "paletted", 8
+	}
+	return "unknown", 0
+}
@@ -1,30 +1,82 @@
 package imgio
 
 import (
+	"errors"
 	"fmt"
 	"image"
 	_ "image/jpeg"
 	_ "image/png"
+	"io/fs"
 	"log/slog"
 	"os"
 
 	"github.com/xshoji/go-img-diff/internal/core"
 )
 
+// ErrorKind classifies why an input image could not be loaded.
+type ErrorKind string
+
+const (
+	ErrorKindNone       ErrorKind = ""
+	ErrorKindNotFound   ErrorKind = "not_found"
+	ErrorKindPermission ErrorKind = "permission"
+	ErrorKindDecode     ErrorKind = "decode"
+	ErrorKindIO         ErrorKind = "io"
+)
+
+// LoadError is returned by LoadFrame and carries the failure kind so callers
+// can record it per input instead of parsing messages.
+type LoadError struct {
+	Path string
+	Kind ErrorKind
+	Err  error
+}
+
+func (e *LoadError) Error() string {
+	if e.Kind == ErrorKindDecode {
+		return fmt.Sprintf("failed to decode image %s: %v", e.Path, e.Err)
+	}
+	return fmt.Sprintf("failed to open image %s: %v", e.Path, e.Err)
+}
+
+func (e *LoadError) Unwrap() error {
+	return e.Err
+}
+
+// KindOf returns the ErrorKind of a load failure, or ErrorKindNone if err is not a LoadError.
+func KindOf(err error) ErrorKind {
+	var le *LoadError
+	if errors.As(err, &le) {
+		return le.Kind
+	}
+	return ErrorKindNone
+}
+
 // LoadFrame loads an image from the given path and normalizes it into a Frame.
 func LoadFrame(path string, logger *slog.Logger) (*core.Frame, error) {
 	file, err := os.Open(path)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open image %s: %w", path, err)
+		return nil, &LoadError{Path: path, Kind: openErrorKind(err), Err: err}
 	}
 	defer file.Close()
 
 	img, format, err := image.Decode(file)
 	if err != nil {
-		return nil, fmt.Errorf("failed to decode image %s: %w", path, err)
+		return nil, &LoadError{Path: path, Kind: ErrorKindDecode, Err: err}
 	}
 
 	frame := core.NewFrame(img)
 	logger.Info("loaded image", "path", path, "format", format, "width", frame.W, "height", frame.H)
 	return frame, nil
 }
+
+func openErrorKind(err error) ErrorKind {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return ErrorKindNotFound
+	case errors.Is(err, fs.ErrPermission):
+		return ErrorKindPermission
+	default:
+		return ErrorKindIO
+	}
+}
@@ -0,0 +1,42 @@
+package imgio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"sort"
+	"strings"
+)
+
+// pngHeaderEnd is the offset after the PNG signature (8 bytes) and the IHDR
+// chunk (length, type, 13 data bytes and CRC), which must come first.
+const pngHeaderEnd = 8 + 4 + 4 + 13 + 4
+
+// addPNGText returns the encoded PNG data with a tEXt chunk for every
+// keyword and text of text, in keyword order, inserted after the IHDR chunk.
+// Keywords are 1-79 printable Latin-1 characters; see PNG specification 11.3.4.
+func addPNGText(data []byte, text map[string]string) ([]byte, error) {
+	if len(data) < pngHeaderEnd || !bytes.Equal(data[12:16], []byte("IHDR")) {
+		return nil, fmt.Errorf("not an encoded png")
+	}
+	keys := make([]string, 0, len(text))
+	for k := range text {
+		if len(k) < 1 || len(k) > 79 || strings.ContainsRune(k, 0) || strings.ContainsRune(text[k], 0) {
+			return nil, fmt.Errorf("invalid png text keyword %q", k)
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var buf bytes.Buffer
+	buf.Write(data[:pngHeaderEnd])
+	for _, k := range keys {
+		chunk := append([]byte("tEXt"+k+"\x00"), text[k]...)
+		binary.Write(&buf, binary.BigEndian, uint32(len(chunk)-4))
+		buf.Write(chunk)
+		binary.Write(&buf, binary.BigEndian, crc32.ChecksumIEEE(chunk))
+	}
+	buf.Write(data[pngHeaderEnd:])
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,59 @@
+package imgio
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// IsSupportedImagePath reports whether SaveImage can encode the format implied
+// by the extension of path.
+func IsSupportedImagePath(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".png", ".jpg", ".jpeg":
+		return true
+	}
+	return false
+}
+
+// CheckWritable verifies that WriteFile can create a file at path with mode
+// without touching path itself: the parent directory must accept a temporary
+// probe file, which is removed again. Unless mode includes WriteNoMkdir, a
+// missing parent is fine if its nearest existing ancestor is writable. With
+// WriteNoOverwrite, path must not exist yet.
+func CheckWritable(path string, mode WriteMode) error {
+	if mode&WriteNoOverwrite != 0 {
+		if err := checkNotExists(path); err != nil {
+			return err
+		}
+	}
+	dir := filepath.Dir(path)
+	info, err := os.Stat(dir)
+	for mode&WriteNoMkdir == 0 && os.IsNotExist(err) && filepath.Dir(dir) != dir {
+		dir = filepath.Dir(dir)
+		info, err = os.Stat(dir)
+	}
+	if err != nil {
+		return fmt.Errorf("output directory %s is not accessible: %w", dir, err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("output directory %s is not a directory", dir)
+	}
+	probe, err := os.CreateTemp(dir, ".imgdiff-probe-*")
+	if err != nil {
+		return fmt.Errorf("output directory %s is not writable: %w", dir, err)
+	}
+	name := probe.Name()
+	probe.Close()
+	return os.Remove(name)
+}
+
+// CheckImageOutput verifies that an image can be saved to path with SaveImage
+// and mode.
+func CheckImageOutput(path string, mode WriteMode) error {
+	if !IsSupportedImagePath(path) {
+		return fmt.Errorf("unsupported output format %q for %s (use .png, .jpg or .jpeg)", filepath.Ext(path), path)
+	}
+	return CheckWritable(path, mode)
+}
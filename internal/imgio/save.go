@@ -1,36 +1,91 @@
 package imgio
 
 import (
+	"bytes"
 	"fmt"
 	"image"
 	"image/jpeg"
 	"image/png"
+	"io"
 	"log/slog"
-	"os"
 	"path/filepath"
 	"strings"
+
+	"github.com/xshoji/go-img-diff/internal/core"
 )
 
-// SaveImage saves an image to the given path. Format is determined by file extension.
-func SaveImage(img image.Image, path string, logger *slog.Logger) error {
-	file, err := os.Create(path)
-	if err != nil {
-		return fmt.Errorf("failed to create output file %s: %w", path, err)
+// Encoding holds the encoder settings of SaveImageEncoded.
+type Encoding struct {
+	JPEGQuality    int                 // 1-100 (0=core.DefaultJPEGQuality)
+	PNGCompression core.PNGCompression // zlib level of a PNG (""=default)
+
+	// Text adds a tEXt chunk to a PNG for every keyword and text, such as
+	// "Software". JPEG outputs carry no text.
+	Text map[string]string
+}
+
+// OutputEncoding returns the encoding of the images configured by o.
+func OutputEncoding(o core.OutputOptions) Encoding {
+	return Encoding{JPEGQuality: o.JPEGQuality, PNGCompression: o.PNGCompression}
+}
+
+// pngCompressionLevel maps c to the level of the png encoder.
+func pngCompressionLevel(c core.PNGCompression) png.CompressionLevel {
+	switch c {
+	case core.PNGCompressionSpeed:
+		return png.BestSpeed
+	case core.PNGCompressionBest:
+		return png.BestCompression
+	case core.PNGCompressionNone:
+		return png.NoCompression
 	}
-	defer file.Close()
+	return png.DefaultCompression
+}
+
+// SaveImage saves an image to the given path. Format is determined by file extension.
+func SaveImage(img image.Image, path string, mode WriteMode, logger *slog.Logger) error {
+	return SaveImageEncoded(img, path, Encoding{}, mode, logger)
+}
 
+// SaveImageEncoded saves an image like SaveImage with the encoder settings of
+// enc.
+func SaveImageEncoded(img image.Image, path string, enc Encoding, mode WriteMode, logger *slog.Logger) error {
 	ext := strings.ToLower(filepath.Ext(path))
-	switch ext {
-	case ".png":
-		err = png.Encode(file, img)
-	case ".jpg", ".jpeg":
-		err = jpeg.Encode(file, img, &jpeg.Options{Quality: 90})
-	default:
+	if !IsSupportedImagePath(path) {
 		return fmt.Errorf("unsupported output format: %s", ext)
 	}
 
+	err := WriteFile(path, mode, func(w io.Writer) error {
+		var err error
+		switch ext {
+		case ".png":
+			encoder := &png.Encoder{CompressionLevel: pngCompressionLevel(enc.PNGCompression)}
+			if len(enc.Text) == 0 {
+				err = encoder.Encode(w, img)
+				break
+			}
+			var buf bytes.Buffer
+			if err = encoder.Encode(&buf, img); err != nil {
+				break
+			}
+			var data []byte
+			if data, err = addPNGText(buf.Bytes(), enc.Text); err == nil {
+				_, err = w.Write(data)
+			}
+		case ".jpg", ".jpeg":
+			quality := enc.JPEGQuality
+			if quality == 0 {
+				quality = core.DefaultJPEGQuality
+			}
+			err = jpeg.Encode(w, img, &jpeg.Options{Quality: quality})
+		}
+		if err != nil {
+			return fmt.Errorf("failed to encode image: %w", err)
+		}
+		return nil
+	})
 	if err != nil {
-		return fmt.Errorf("failed to encode image: %w", err)
+		return err
 	}
 
 	logger.Info("saved image", "path", path, "format", ext)
@@ -0,0 +1,131 @@
+package imgio
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/xshoji/go-img-diff/internal/core"
+)
+
+// WriteMode selects how output files are written: WriteAtomic or
+// WriteDirect, optionally combined with WriteNoOverwrite and WriteNoMkdir.
+type WriteMode int
+
+const (
+	// WriteAtomic writes to a temporary file next to the destination and
+	// renames it into place on success, so an interrupted or failed write
+	// never leaves a truncated file at the destination.
+	WriteAtomic WriteMode = 0
+	// WriteDirect writes to the destination itself, for filesystems where
+	// rename is unsupported or not atomic.
+	WriteDirect WriteMode = 1 << (iota - 1)
+	// WriteNoOverwrite fails with an error wrapping fs.ErrExist instead of
+	// replacing an existing destination.
+	WriteNoOverwrite
+	// WriteNoMkdir fails when the parent directory of the destination does
+	// not exist instead of creating it.
+	WriteNoMkdir
+)
+
+// OutputWriteMode returns how the outputs configured by o are written.
+func OutputWriteMode(o core.OutputOptions) WriteMode {
+	var mode WriteMode
+	if o.DirectWrite {
+		mode |= WriteDirect
+	}
+	if o.NoOverwrite {
+		mode |= WriteNoOverwrite
+	}
+	if o.NoMkdir {
+		mode |= WriteNoMkdir
+	}
+	return mode
+}
+
+// WriteFile creates path and fills it with write according to mode. Missing
+// parent directories are created unless mode includes WriteNoMkdir. With
+// WriteAtomic, the temporary file is removed if anything fails.
+func WriteFile(path string, mode WriteMode, write func(w io.Writer) error) error {
+	if mode&WriteNoMkdir == 0 {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return fmt.Errorf("failed to create the directory of %s: %w", path, err)
+		}
+	}
+	if mode&WriteNoOverwrite != 0 {
+		if err := checkNotExists(path); err != nil {
+			return err
+		}
+	}
+	if mode&WriteDirect != 0 {
+		return writeDirect(path, mode, write)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	tmpName := tmp.Name()
+	ok := false
+	defer func() {
+		if !ok {
+			tmp.Close()
+			os.Remove(tmpName)
+		}
+	}()
+
+	if err := write(tmp); err != nil {
+		return err
+	}
+	// CreateTemp uses 0600; match the permissions os.Create would give.
+	if err := tmp.Chmod(0o644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	// The destination may have appeared while encoding.
+	if mode&WriteNoOverwrite != 0 {
+		if err := checkNotExists(path); err != nil {
+			return err
+		}
+	}
+	if err := os.Rename(tmpName, path); err != nil {
+		return fmt.Errorf("failed to move %s into place: %w", path, err)
+	}
+	ok = true
+	return nil
+}
+
+func writeDirect(path string, mode WriteMode, write func(w io.Writer) error) error {
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if mode&WriteNoOverwrite != 0 {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	}
+	file, err := os.OpenFile(path, flags, 0o644)
+	if err != nil {
+		if os.IsExist(err) {
+			return existsError(path)
+		}
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	defer file.Close()
+	if err := write(file); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// checkNotExists fails if anything exists at path.
+func checkNotExists(path string) error {
+	if _, err := os.Lstat(path); err == nil {
+		return existsError(path)
+	}
+	return nil
+}
+
+func existsError(path string) error {
+	return fmt.Errorf("refusing to overwrite %s: %w", path, fs.ErrExist)
+}
@@ -0,0 +1,142 @@
+package imgio
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// failingWriter passes the first limit bytes through and then fails, like an
+// encoder interrupted halfway.
+type failingWriter struct {
+	w     io.Writer
+	limit int
+}
+
+var errWriteFailed = errors.New("simulated write failure")
+
+func (f *failingWriter) Write(p []byte) (int, error) {
+	if len(p) > f.limit {
+		n, _ := f.w.Write(p[:f.limit])
+		f.limit = 0
+		return n, errWriteFailed
+	}
+	f.limit -= len(p)
+	return f.w.Write(p)
+}
+
+func writePartial(w io.Writer) error {
+	_, err := (&failingWriter{w: w, limit: 10}).Write([]byte("0123456789abcdefghij"))
+	return err
+}
+
+func writeComplete(w io.Writer) error {
+	_, err := io.WriteString(w, "complete")
+	return err
+}
+
+func TestWriteFile_AtomicLeavesNoPartialFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "out.json")
+
+	if err := WriteFile(path, WriteAtomic, writePartial); !errors.Is(err, errWriteFailed) {
+		t.Fatalf("err = %v, want simulated failure", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("failed write left a file at the destination")
+	}
+
+	// An existing destination is kept intact.
+	if err := os.WriteFile(path, []byte("previous"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFile(path, WriteAtomic, writePartial); err == nil {
+		t.Fatal("expected error")
+	}
+	if data, _ := os.ReadFile(path); string(data) != "previous" {
+		t.Errorf("destination = %q, want previous content", data)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("temporary files left behind: %d entries", len(entries))
+	}
+}
+
+func TestWriteFile_Atomic(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.txt")
+	err := WriteFile(path, WriteAtomic, func(w io.Writer) error {
+		_, err := io.WriteString(w, "complete")
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o644 {
+		t.Errorf("mode = %v, want 0644", info.Mode().Perm())
+	}
+	if data, _ := os.ReadFile(path); string(data) != "complete" {
+		t.Errorf("content = %q", data)
+	}
+}
+
+func TestWriteFile_CreatesDirectories(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "artifacts", "diffs", "page.json")
+	if err := WriteFile(filepath.Join(dir, "strict", "page.json"), WriteNoMkdir, writeComplete); err == nil {
+		t.Error("WriteNoMkdir: expected error for a missing directory")
+	}
+	for _, mode := range []WriteMode{WriteAtomic, WriteDirect} {
+		os.RemoveAll(filepath.Join(dir, "artifacts"))
+		if err := WriteFile(path, mode, writeComplete); err != nil {
+			t.Fatalf("mode %d: %v", mode, err)
+		}
+		if data, _ := os.ReadFile(path); string(data) != "complete" {
+			t.Errorf("mode %d: content = %q", mode, data)
+		}
+	}
+}
+
+func TestWriteFile_NoOverwrite(t *testing.T) {
+	for _, mode := range []WriteMode{WriteAtomic, WriteDirect} {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "out.json")
+		if err := os.WriteFile(path, []byte("previous"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := WriteFile(path, mode|WriteNoOverwrite, writeComplete); !errors.Is(err, fs.ErrExist) {
+			t.Errorf("mode %d: err = %v, want fs.ErrExist", mode, err)
+		}
+		if data, _ := os.ReadFile(path); string(data) != "previous" {
+			t.Errorf("mode %d: destination = %q, want previous content", mode, data)
+		}
+		if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+			t.Errorf("mode %d: temporary files left behind: %d entries", mode, len(entries))
+		}
+
+		fresh := filepath.Join(dir, "fresh.json")
+		if err := WriteFile(fresh, mode|WriteNoOverwrite, writeComplete); err != nil {
+			t.Errorf("mode %d: new file: %v", mode, err)
+		}
+	}
+}
+
+func TestWriteFile_DirectKeepsPartialFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.json")
+	if err := WriteFile(path, WriteDirect, writePartial); err == nil {
+		t.Fatal("expected error")
+	}
+	if data, _ := os.ReadFile(path); string(data) != "0123456789" {
+		t.Errorf("direct write content = %q, want the partial output", data)
+	}
+}
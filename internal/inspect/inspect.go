@@ -0,0 +1,110 @@
+// Package inspect summarizes an image pair from the file headers and predicts
+// the cost of comparing it, without decoding any pixel data.
+package inspect
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"text/tabwriter"
+
+	"github.com/xshoji/go-img-diff/internal/align"
+	"github.com/xshoji/go-img-diff/internal/core"
+	"github.com/xshoji/go-img-diff/internal/imgio"
+)
+
+// Thresholds above which settings are suggested.
+const (
+	largeSearchPixels = 2_000_000_000 // pixel comparisons of a full search
+	largeImagePixels  = 20_000_000    // pixels of one input
+)
+
+// Report describes an image pair and the alignment work for given options.
+type Report struct {
+	A, B            imgio.ImageInfo
+	DimensionsMatch bool
+	AspectFactor    float64
+	Cost            align.SearchCost
+	Suggestions     []string
+}
+
+// Run reads the headers of opts.Input1 and opts.Input2.
+func Run(opts core.Options) (*Report, error) {
+	a, err := imgio.InspectImage(opts.Input1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect input1: %w", err)
+	}
+	b, err := imgio.InspectImage(opts.Input2)
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect input2: %w", err)
+	}
+	r := &Report{
+		A:               a,
+		B:               b,
+		DimensionsMatch: a.Size() == b.Size(),
+		AspectFactor:    core.AspectFactorOf(a.Size(), b.Size()),
+		Cost:            align.EstimateCost(a.Size(), b.Size(), opts.Align),
+	}
+	r.Suggestions = suggest(r, opts)
+	return r, nil
+}
+
+func suggest(r *Report, opts core.Options) []string {
+	var s []string
+	if opts.Align.MaxAspectFactor > 0 && r.AspectFactor > opts.Align.MaxAspectFactor {
+		if opts.Align.StrictDimensions {
+			s = append(s, fmt.Sprintf("Aspect ratios differ by a factor of %.2f; the comparison will fail with --strict-dimensions.", r.AspectFactor))
+		} else {
+			s = append(s, fmt.Sprintf("Aspect ratios differ by a factor of %.2f; input1 will also be tried rotated by 90 degrees.", r.AspectFactor))
+		}
+	} else if !r.DimensionsMatch {
+		s = append(s, "Dimensions differ; areas of input2 without a counterpart in input1 will be reported as differences.")
+	}
+	if r.Cost.Pixels > largeSearchPixels && opts.Align.SearchStrategy != core.SearchSpiral {
+		s = append(s, "The alignment search is large; if the images are misaligned by only a few pixels, use --search-strategy spiral or a smaller --max-offset.")
+	}
+	if r.B.Width > 0 && opts.Align.MaxOffsetX > r.B.Width/4 {
+		s = append(s, fmt.Sprintf("--max-offset-x %d exceeds a quarter of the image width (%d px); offsets that large rarely align correctly.", opts.Align.MaxOffsetX, r.B.Width))
+	}
+	if r.B.Height > 0 && opts.Align.MaxOffsetY > r.B.Height/4 {
+		s = append(s, fmt.Sprintf("--max-offset-y %d exceeds a quarter of the image height (%d px); offsets that large rarely align correctly.", opts.Align.MaxOffsetY, r.B.Height))
+	}
+	if r.B.Width*r.B.Height > largeImagePixels && opts.Runtime.Workers < runtime.NumCPU() {
+		s = append(s, fmt.Sprintf("The images are large; --cpu %d uses every available core.", runtime.NumCPU()))
+	}
+	return s
+}
+
+// Print writes the report as a table followed by the cost estimate and suggestions.
+func (r *Report) Print(w io.Writer) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "\tINPUT1\tINPUT2")
+	fmt.Fprintf(tw, "path\t%s\t%s\n", r.A.Path, r.B.Path)
+	fmt.Fprintf(tw, "format\t%s\t%s\n", r.A.Format, r.B.Format)
+	fmt.Fprintf(tw, "size\t%dx%d\t%dx%d\n", r.A.Width, r.A.Height, r.B.Width, r.B.Height)
+	fmt.Fprintf(tw, "color\t%s\t%s\n", colorDescription(r.A), colorDescription(r.B))
+	fmt.Fprintf(tw, "file size\t%d bytes\t%d bytes\n", r.A.FileSize, r.B.FileSize)
+	tw.Flush()
+
+	match := "yes"
+	if !r.DimensionsMatch {
+		match = "no"
+	}
+	fmt.Fprintf(w, "\nDimensions match: %s\n", match)
+	fmt.Fprintf(w, "Alignment search: %d pyramid level(s), %d offsets, up to %d pixel comparisons\n", r.Cost.Levels, r.Cost.Offsets, r.Cost.Pixels)
+	if len(r.Suggestions) == 0 {
+		fmt.Fprintln(w, "Suggestions: none, the current settings suit these images.")
+		return
+	}
+	fmt.Fprintln(w, "Suggestions:")
+	for _, s := range r.Suggestions {
+		fmt.Fprintf(w, "  - %s\n", s)
+	}
+}
+
+func colorDescription(i imgio.ImageInfo) string {
+	if i.BitDepth == 0 {
+		return i.ColorModel
+	}
+	return fmt.Sprintf("%s %d-bit", i.ColorModel, i.BitDepth)
+}
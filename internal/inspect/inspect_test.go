@@ -0,0 +1,86 @@
+package inspect
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/xshoji/go-img-diff/internal/core"
+)
+
+func writePNG(t *testing.T, path string, w, h int) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := png.Encode(f, image.NewGray(image.Rect(0, 0, w, h))); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	opts := core.DefaultOptions()
+	opts.Input1, opts.Input2 = filepath.Join(dir, "a.png"), filepath.Join(dir, "b.png")
+	writePNG(t, opts.Input1, 120, 80)
+	writePNG(t, opts.Input2, 120, 80)
+
+	r, err := Run(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.DimensionsMatch || r.A.Format != "png" || r.B.ColorModel != "gray" || r.B.BitDepth != 8 {
+		t.Errorf("unexpected report %+v", r)
+	}
+	if r.Cost.Offsets == 0 || r.Cost.Pixels == 0 {
+		t.Errorf("cost = %+v", r.Cost)
+	}
+	if len(r.Suggestions) != 0 {
+		t.Errorf("suggestions = %v, want none", r.Suggestions)
+	}
+
+	var buf bytes.Buffer
+	r.Print(&buf)
+	for _, want := range []string{"120x80", "gray 8-bit", "Dimensions match: yes", "Suggestions: none"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("output missing %q:\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestRun_Suggestions(t *testing.T) {
+	dir := t.TempDir()
+	opts := core.DefaultOptions()
+	opts.Input1, opts.Input2 = filepath.Join(dir, "a.png"), filepath.Join(dir, "b.png")
+	writePNG(t, opts.Input1, 160, 90)
+	writePNG(t, opts.Input2, 90, 160)
+	opts.Align.MaxOffsetX, opts.Align.MaxOffsetY = 40, 40
+
+	r, err := Run(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.DimensionsMatch {
+		t.Error("dimensions should not match")
+	}
+	text := strings.Join(r.Suggestions, "\n")
+	for _, want := range []string{"rotated by 90 degrees", "--max-offset-x 40"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("suggestions missing %q: %v", want, r.Suggestions)
+		}
+	}
+}
+
+func TestRun_MissingInput(t *testing.T) {
+	opts := core.DefaultOptions()
+	opts.Input1, opts.Input2 = "missing-a.png", "missing-b.png"
+	if _, err := Run(opts); err == nil {
+		t.Error("expected error")
+	}
+}
@@ -0,0 +1,63 @@
+// Package phash computes perceptual hashes of frames, used to recognize
+// probably identical image pairs without comparing them pixel by pixel.
+package phash
+
+import (
+	"math/bits"
+
+	"github.com/xshoji/go-img-diff/internal/core"
+)
+
+// DHash returns the 64-bit difference hash of f: its luminance (Frame.Gray)
+// is box-averaged to 9x8 cells, and bit 63-(y*8+x) is set when cell (x+1, y)
+// is brighter than cell (x, y). Images that differ only slightly, e.g. by
+// compression artifacts or a few changed pixels, usually hash alike, so an
+// equal hash does not prove the images identical.
+func DHash(f *core.Frame) uint64 {
+	const cols, rows = 9, 8
+	if f.W == 0 || f.H == 0 {
+		return 0
+	}
+	var sums [rows][cols]uint64
+	var counts [rows][cols]uint64
+	cellX := make([]int, f.W)
+	for x := range cellX {
+		cellX[x] = min(x*cols/f.W, cols-1)
+	}
+	for y := 0; y < f.H; y++ {
+		cy := min(y*rows/f.H, rows-1)
+		row := f.Gray[y*f.W : (y+1)*f.W]
+		for x, g := range row {
+			sums[cy][cellX[x]] += uint64(g)
+			counts[cy][cellX[x]]++
+		}
+	}
+
+	var cells [rows][cols]float64
+	for y := range cells {
+		for x := range cells[y] {
+			if counts[y][x] > 0 {
+				cells[y][x] = float64(sums[y][x]) / float64(counts[y][x])
+			} else if x > 0 {
+				// Frames narrower than 9 pixels repeat the previous column.
+				cells[y][x] = cells[y][x-1]
+			}
+		}
+	}
+
+	var hash uint64
+	for y := 0; y < rows; y++ {
+		for x := 0; x < cols-1; x++ {
+			if cells[y][x+1] > cells[y][x] {
+				hash |= 1 << (63 - (y*8 + x))
+			}
+		}
+	}
+	return hash
+}
+
+// Distance returns the Hamming distance between two hashes: the number of
+// differing bits (0-64).
+func Distance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
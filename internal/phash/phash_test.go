@@ -0,0 +1,79 @@
+package phash
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/xshoji/go-img-diff/internal/core"
+)
+
+// makeFrame returns a w x h gray frame with the value of pixel (x, y) given by v.
+func makeFrame(w, h int, v func(x, y int) uint8) *core.Frame {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			g := v(x, y)
+			img.SetNRGBA(x, y, color.NRGBA{g, g, g, 255})
+		}
+	}
+	return core.NewFrame(img)
+}
+
+func TestDHash_KnownValues(t *testing.T) {
+	tests := []struct {
+		name  string
+		frame *core.Frame
+		want  uint64
+	}{
+		{"flat", makeFrame(90, 80, func(x, y int) uint8 { return 128 }), 0},
+		{"brighter to the right", makeFrame(90, 80, func(x, y int) uint8 { return uint8(x * 2) }), 0xffffffffffffffff},
+		{"darker to the right", makeFrame(90, 80, func(x, y int) uint8 { return uint8(255 - x*2) }), 0},
+		{"stripes", makeFrame(90, 80, func(x, y int) uint8 { return uint8(x / 10 % 2 * 255) }), 0xaaaaaaaaaaaaaaaa},
+		{"bright bottom-right quadrant", makeFrame(90, 80, func(x, y int) uint8 {
+			if x >= 40 && y >= 40 {
+				return 255
+			}
+			return 0
+		}), 0x0000000010101010},
+		{"9x8 pixels", makeFrame(9, 8, func(x, y int) uint8 { return uint8(x / 2 % 2 * 255) }), 0x4444444444444444},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DHash(tt.frame); got != tt.want {
+				t.Errorf("DHash = %016x, want %016x", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDHash_Sensitivity(t *testing.T) {
+	gradient := func(x, y int) uint8 { return uint8(x + y) }
+	base := DHash(makeFrame(200, 150, gradient))
+
+	// A small change within a cell keeps the hash; a large one changes it.
+	speck := makeFrame(200, 150, func(x, y int) uint8 {
+		if x == 100 && y == 70 {
+			return 255
+		}
+		return gradient(x, y)
+	})
+	if d := Distance(base, DHash(speck)); d != 0 {
+		t.Errorf("one changed pixel: distance %d, want 0", d)
+	}
+	block := makeFrame(200, 150, func(x, y int) uint8 {
+		if x >= 60 && x < 140 && y >= 40 && y < 110 {
+			return 0
+		}
+		return gradient(x, y)
+	})
+	if d := Distance(base, DHash(block)); d == 0 {
+		t.Error("large dark block: distance 0, want the hashes to differ")
+	}
+}
+
+func TestDistance(t *testing.T) {
+	if d := Distance(0xff00, 0x0f0f); d != 8 {
+		t.Errorf("Distance = %d, want 8", d)
+	}
+}
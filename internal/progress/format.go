@@ -0,0 +1,60 @@
+package progress
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// TimeFormat is the RFC3339 layout, with milliseconds, of log line
+// timestamps and of the times in reports. It sorts lexically in one zone.
+const TimeFormat = "2006-01-02T15:04:05.000Z07:00"
+
+// FormatDuration formats d for logs and console lines: whole milliseconds
+// under one second ("850ms"), seconds with two decimals otherwise ("2.35s").
+func FormatDuration(d time.Duration) string {
+	if d = d.Round(time.Millisecond); d < time.Second {
+		return fmt.Sprintf("%dms", d.Milliseconds())
+	}
+	return fmt.Sprintf("%.2fs", d.Round(10*time.Millisecond).Seconds())
+}
+
+type timestampWriter struct {
+	mu        sync.Mutex
+	w         io.Writer
+	now       func() time.Time
+	lineStart bool
+}
+
+// NewTimestampWriter returns a writer that prefixes every line written to w
+// with the current time in TimeFormat and a space, however the lines are
+// split across writes. It is safe for concurrent use.
+func NewTimestampWriter(w io.Writer) io.Writer {
+	return &timestampWriter{w: w, now: time.Now, lineStart: true}
+}
+
+func (t *timestampWriter) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var buf bytes.Buffer
+	for rest := p; len(rest) > 0; {
+		if t.lineStart {
+			buf.WriteString(t.now().Format(TimeFormat))
+			buf.WriteByte(' ')
+			t.lineStart = false
+		}
+		line := rest
+		if i := bytes.IndexByte(rest, '\n'); i >= 0 {
+			line, t.lineStart = rest[:i+1], true
+		}
+		buf.Write(line)
+		rest = rest[len(line):]
+	}
+	if _, err := t.w.Write(buf.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
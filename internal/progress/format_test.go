@@ -0,0 +1,53 @@
+package progress
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestFormatDuration(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{0, "0ms"},
+		{400 * time.Microsecond, "0ms"},
+		{850 * time.Millisecond, "850ms"},
+		{999 * time.Millisecond, "999ms"},
+		{999600 * time.Microsecond, "1.00s"},
+		{time.Second, "1.00s"},
+		{2345 * time.Millisecond, "2.35s"},
+		{90 * time.Second, "90.00s"},
+	}
+	for _, tt := range tests {
+		if got := FormatDuration(tt.d); got != tt.want {
+			t.Errorf("FormatDuration(%v) = %q, want %q", tt.d, got, tt.want)
+		}
+	}
+}
+
+func TestTimestampWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewTimestampWriter(&buf).(*timestampWriter)
+	at := time.Date(2024, 3, 5, 9, 4, 2, 7_000_000, time.UTC)
+	w.now = func() time.Time { return at }
+
+	// Lines split across writes get one prefix each.
+	fmt.Fprintf(w, "[INFO] first\nsecond ")
+	fmt.Fprintf(w, "line\n")
+	fmt.Fprintf(w, "\n")
+	want := "2024-03-05T09:04:02.007Z [INFO] first\n" +
+		"2024-03-05T09:04:02.007Z second line\n" +
+		"2024-03-05T09:04:02.007Z \n"
+	if got := buf.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	var plain bytes.Buffer
+	NewText(&plain).OnStage("load")
+	if got := plain.String(); got != "[PROGRESS] load: started\n" {
+		t.Errorf("without the writer: %q, want no prefix", got)
+	}
+}
@@ -0,0 +1,66 @@
+package progress
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// Event kinds of the JSON reporter.
+const (
+	EventStart    = "start"    // a stage started
+	EventProgress = "progress" // a stage reached a percentage
+	EventDone     = "done"     // the command finished; Stage is "done" too
+)
+
+// Event is one line written by the JSON reporter. The field names are part
+// of the command line interface: fields may be added, but never renamed or
+// removed.
+type Event struct {
+	Event     string   `json:"event"`
+	Stage     string   `json:"stage"`
+	Percent   int      `json:"percent"`
+	ElapsedMS int64    `json:"elapsed_ms"` // since the stage started; since the reporter was created for "done"
+	ETAMS     int64    `json:"eta_ms"`     // estimated remaining time of the stage, -1 while unknown
+	Summary   *Summary `json:"summary,omitempty"`
+}
+
+// Summary is the outcome of the command carried by the "done" event.
+type Summary struct {
+	ExitCode    int     `json:"exit_code"`
+	Error       string  `json:"error,omitempty"`
+	HasDiff     bool    `json:"has_diff"`
+	Regions     int     `json:"regions"`
+	DiffPercent float64 `json:"diff_percent"`
+	OffsetX     int     `json:"offset_x"`
+	OffsetY     int     `json:"offset_y"`
+}
+
+// JSON is a reporter writing one Event per line, for programs wrapping the
+// command. Each event is written with a single Write.
+type JSON struct {
+	enc   *json.Encoder
+	start time.Time
+}
+
+// NewJSON returns a reporter writing JSON lines to w.
+func NewJSON(w io.Writer) *JSON {
+	return &JSON{enc: json.NewEncoder(w), start: time.Now()}
+}
+
+func (j *JSON) OnStage(name string) {
+	j.enc.Encode(Event{Event: EventStart, Stage: name, ETAMS: -1})
+}
+
+func (j *JSON) OnProgress(stage string, percent int, elapsed, remaining time.Duration) {
+	eta := remaining.Milliseconds()
+	if percent == 0 {
+		eta = -1
+	}
+	j.enc.Encode(Event{Event: EventProgress, Stage: stage, Percent: percent, ElapsedMS: elapsed.Milliseconds(), ETAMS: eta})
+}
+
+// Done writes the final event with the summary of the command.
+func (j *JSON) Done(s Summary) {
+	j.enc.Encode(Event{Event: EventDone, Stage: EventDone, Percent: 100, ElapsedMS: time.Since(j.start).Milliseconds(), Summary: &s})
+}
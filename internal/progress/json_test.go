@@ -0,0 +1,70 @@
+package progress
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+// decodeEvents parses every line of out as an Event, rejecting unknown
+// fields so that the test notices schema changes.
+func decodeEvents(t *testing.T, out string) []Event {
+	t.Helper()
+	var events []Event
+	sc := bufio.NewScanner(strings.NewReader(out))
+	for sc.Scan() {
+		dec := json.NewDecoder(strings.NewReader(sc.Text()))
+		dec.DisallowUnknownFields()
+		var e Event
+		if err := dec.Decode(&e); err != nil {
+			t.Fatalf("line %q: %v", sc.Text(), err)
+		}
+		events = append(events, e)
+	}
+	return events
+}
+
+func TestJSON(t *testing.T) {
+	var buf bytes.Buffer
+	j := NewJSON(&buf)
+	j.OnStage("align")
+	j.OnProgress("align", 0, 0, 0)
+	j.OnProgress("align", 35, 1200*time.Millisecond, 2300*time.Millisecond)
+	j.OnProgress("align", 100, 3500*time.Millisecond, 0)
+	j.Done(Summary{ExitCode: 1, HasDiff: true, Regions: 2, DiffPercent: 1.5, OffsetX: 3, OffsetY: -4})
+
+	events := decodeEvents(t, buf.String())
+	want := []Event{
+		{Event: EventStart, Stage: "align", ETAMS: -1},
+		{Event: EventProgress, Stage: "align", ETAMS: -1},
+		{Event: EventProgress, Stage: "align", Percent: 35, ElapsedMS: 1200, ETAMS: 2300},
+		{Event: EventProgress, Stage: "align", Percent: 100, ElapsedMS: 3500},
+	}
+	if len(events) != len(want)+1 {
+		t.Fatalf("got %d events, want %d:\n%s", len(events), len(want)+1, buf.String())
+	}
+	for i := range want {
+		if events[i] != want[i] {
+			t.Errorf("event %d = %+v, want %+v", i, events[i], want[i])
+		}
+	}
+	done := events[len(want)]
+	if done.Event != EventDone || done.Stage != "done" || done.Percent != 100 || done.Summary == nil {
+		t.Fatalf("last event = %+v, want done with a summary", done)
+	}
+	if s := *done.Summary; s != (Summary{ExitCode: 1, HasDiff: true, Regions: 2, DiffPercent: 1.5, OffsetX: 3, OffsetY: -4}) {
+		t.Errorf("summary = %+v", s)
+	}
+}
+
+func TestJSON_FieldNames(t *testing.T) {
+	var buf bytes.Buffer
+	NewJSON(&buf).OnProgress("diff", 35, 1200*time.Millisecond, 2300*time.Millisecond)
+	want := `{"event":"progress","stage":"diff","percent":35,"elapsed_ms":1200,"eta_ms":2300}` + "\n"
+	if buf.String() != want {
+		t.Errorf("got %s, want %s", buf.String(), want)
+	}
+}
@@ -0,0 +1,144 @@
+// Package progress reports pipeline stages and completion percentages.
+package progress
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// Reporter receives progress events. Implementations must be safe to call
+// from the goroutine that drives the pipeline; stages are reported in order.
+type Reporter interface {
+	// OnStage is called once when a stage starts.
+	OnStage(name string)
+	// OnProgress is called with the completion percentage (0-100) of a stage,
+	// the time since the stage started and the estimated remaining time.
+	OnProgress(stage string, percent int, elapsed, remaining time.Duration)
+}
+
+// Silent discards all events.
+type Silent struct{}
+
+func (Silent) OnStage(string)                                       {}
+func (Silent) OnProgress(string, int, time.Duration, time.Duration) {}
+
+// textStep is the percentage step at which Text prints progress lines.
+const textStep = 10
+
+type text struct {
+	w    io.Writer
+	step int // last printed step of the current stage
+}
+
+// NewText returns a reporter that prints human-readable lines to w, one per
+// stage start and one per 10% of progress. When progress jumps over several
+// steps at once, only the highest crossed step is printed.
+func NewText(w io.Writer) Reporter {
+	return &text{w: w, step: -1}
+}
+
+func (t *text) OnStage(name string) {
+	t.step = -1
+	fmt.Fprintf(t.w, "[PROGRESS] %s: started\n", name)
+}
+
+func (t *text) OnProgress(stage string, percent int, elapsed, remaining time.Duration) {
+	// 0% is only printed as such; later steps are printed once crossed.
+	step := percent / textStep
+	if step <= t.step || (step == 0 && percent > 0) {
+		return
+	}
+	t.step = step
+	fmt.Fprintf(t.w, "[PROGRESS] %s: %3d%% (elapsed %s, remaining %s)\n",
+		stage, step*textStep, FormatDuration(elapsed), FormatDuration(remaining))
+}
+
+type throttled struct {
+	r        Reporter
+	interval time.Duration
+	now      func() time.Time
+	last     time.Time // when the last progress event of the stage was forwarded
+}
+
+// Throttle returns a reporter that forwards the events of r, except progress
+// events less than interval after the last forwarded one. Stage starts, the
+// first progress event of a stage and 100% are always forwarded, so a stage
+// never ends without its completion. With interval <= 0, r is returned.
+func Throttle(r Reporter, interval time.Duration) Reporter {
+	if interval <= 0 {
+		return r
+	}
+	return &throttled{r: r, interval: interval, now: time.Now}
+}
+
+func (t *throttled) OnStage(name string) {
+	t.last = time.Time{}
+	t.r.OnStage(name)
+}
+
+func (t *throttled) OnProgress(stage string, percent int, elapsed, remaining time.Duration) {
+	now := t.now()
+	if percent < 100 && !t.last.IsZero() && now.Sub(t.last) < t.interval {
+		return
+	}
+	t.last = now
+	t.r.OnProgress(stage, percent, elapsed, remaining)
+}
+
+// Percent returns done of total as a percentage rounded to the nearest
+// integer. 100 is only returned once done reaches total, so a nearly
+// finished stage reports 99; a total of 0 or less counts as complete.
+func Percent(done, total int) int {
+	if total <= 0 || done >= total {
+		return 100
+	}
+	if done <= 0 {
+		return 0
+	}
+	return min(99, (done*200+total)/(2*total))
+}
+
+// Tracker converts completed work units of one stage into progress events.
+// It only emits when the percentage increases and never above 100, so the
+// events of a stage are strictly increasing however bursty the updates are.
+// A nil *Tracker is a no-op.
+type Tracker struct {
+	reporter Reporter
+	stage    string
+	start    time.Time
+	last     int
+}
+
+// Start reports the beginning of stage and returns its tracker. A nil
+// reporter is treated as Silent.
+func Start(r Reporter, stage string) *Tracker {
+	if r == nil {
+		r = Silent{}
+	}
+	r.OnStage(stage)
+	return &Tracker{reporter: r, stage: stage, start: time.Now(), last: -1}
+}
+
+// Update reports that done of total work units are complete.
+func (t *Tracker) Update(done, total int) {
+	if t == nil || total <= 0 {
+		return
+	}
+	percent := Percent(done, total)
+	if percent <= t.last {
+		return
+	}
+	t.last = percent
+	elapsed := time.Since(t.start)
+	var remaining time.Duration
+	if percent > 0 {
+		remaining = elapsed * time.Duration(100-percent) / time.Duration(percent)
+	}
+	t.reporter.OnProgress(t.stage, percent, elapsed, remaining)
+}
+
+// Done reports 100% unless it was already reported.
+func (t *Tracker) Done() {
+	t.Update(1, 1)
+}
@@ -0,0 +1,187 @@
+package progress
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+type event struct {
+	stage   string
+	percent int // -1 for OnStage
+}
+
+type recorder struct {
+	events []event
+}
+
+func (r *recorder) OnStage(name string) {
+	r.events = append(r.events, event{name, -1})
+}
+
+func (r *recorder) OnProgress(stage string, percent int, _, _ time.Duration) {
+	r.events = append(r.events, event{stage, percent})
+}
+
+func TestTracker_Monotonic(t *testing.T) {
+	rec := &recorder{}
+	tr := Start(rec, "align")
+	for _, done := range []int{0, 1, 1, 3, 2, 7, 10} {
+		tr.Update(done, 10)
+	}
+	tr.Done()
+
+	want := []event{{"align", -1}, {"align", 0}, {"align", 10}, {"align", 30}, {"align", 70}, {"align", 100}}
+	if len(rec.events) != len(want) {
+		t.Fatalf("events = %v, want %v", rec.events, want)
+	}
+	for i := range want {
+		if rec.events[i] != want[i] {
+			t.Errorf("event %d = %v, want %v", i, rec.events[i], want[i])
+		}
+	}
+}
+
+func TestTracker_NilReporter(t *testing.T) {
+	tr := Start(nil, "diff")
+	tr.Update(5, 10)
+	tr.Update(1, 0)
+	tr.Done()
+
+	var none *Tracker
+	none.Update(1, 2)
+	none.Done()
+}
+
+func TestText(t *testing.T) {
+	var buf bytes.Buffer
+	tr := Start(NewText(&buf), "diff")
+	for i := 1; i <= 20; i++ {
+		tr.Update(i, 20)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 11 {
+		t.Fatalf("got %d lines, want stage line plus 10 progress lines:\n%s", len(lines), buf.String())
+	}
+	if lines[0] != "[PROGRESS] diff: started" || !strings.HasPrefix(lines[10], "[PROGRESS] diff: 100%") {
+		t.Errorf("unexpected output:\n%s", buf.String())
+	}
+}
+
+func TestTracker_CappedAt100(t *testing.T) {
+	rec := &recorder{}
+	tr := Start(rec, "align")
+	tr.Update(12, 10)
+	tr.Update(15, 10)
+	tr.Done()
+
+	want := []event{{"align", -1}, {"align", 100}}
+	if len(rec.events) != len(want) || rec.events[1] != want[1] {
+		t.Errorf("events = %v, want %v", rec.events, want)
+	}
+}
+
+func TestText_Jumps(t *testing.T) {
+	var buf bytes.Buffer
+	text := NewText(&buf)
+	tr := Start(text, "align")
+	for _, done := range []int{0, 3, 38, 52, 97} {
+		tr.Update(done, 100)
+	}
+	tr.Done()
+	tr = Start(text, "diff")
+	tr.Update(5, 100)
+	tr.Update(21, 100)
+
+	var percents []string
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if fields := strings.Fields(line); len(fields) > 2 && strings.HasSuffix(fields[2], "%") {
+			percents = append(percents, fields[1]+fields[2])
+		}
+	}
+	want := "align:0% align:30% align:50% align:90% align:100% diff:20%"
+	if got := strings.Join(percents, " "); got != want {
+		t.Errorf("printed %q, want %q", got, want)
+	}
+}
+
+func TestPercent(t *testing.T) {
+	tests := []struct {
+		done, total, want int
+	}{
+		{0, 0, 100},
+		{3, -1, 100},
+		{0, 3, 0},
+		{1, 3, 33},
+		{2, 3, 67},
+		{3, 3, 100},
+		{1, 200, 1}, // 0.5% rounds up
+		{199, 200, 99},
+		{1999, 2000, 99}, // 99.95% is not complete
+		{-1, 10, 0},
+	}
+	for _, tt := range tests {
+		if got := Percent(tt.done, tt.total); got != tt.want {
+			t.Errorf("Percent(%d, %d) = %d, want %d", tt.done, tt.total, got, tt.want)
+		}
+	}
+}
+
+func TestText_FewUnits(t *testing.T) {
+	var buf bytes.Buffer
+	tr := Start(NewText(&buf), "diff")
+	for i := 0; i <= 3; i++ {
+		tr.Update(i, 3)
+	}
+	var got []string
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		got = append(got, strings.SplitN(line, " (", 2)[0])
+	}
+	want := "[PROGRESS] diff: started|[PROGRESS] diff:   0%|[PROGRESS] diff:  30%|[PROGRESS] diff:  60%|[PROGRESS] diff: 100%"
+	if strings.Join(got, "|") != want {
+		t.Errorf("got %q, want %q", strings.Join(got, "|"), want)
+	}
+}
+
+func TestThrottle(t *testing.T) {
+	rec := &recorder{}
+	r := Throttle(rec, 100*time.Millisecond).(*throttled)
+	clock := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	r.now = func() time.Time { return clock }
+
+	tr := Start(r, "align")
+	for _, step := range []struct {
+		after time.Duration
+		done  int
+	}{
+		{0, 0},                      // first event: forwarded
+		{10 * time.Millisecond, 1},  // too soon
+		{50 * time.Millisecond, 2},  // too soon
+		{50 * time.Millisecond, 3},  // 110ms after the last forwarded one
+		{20 * time.Millisecond, 4},  // too soon
+		{100 * time.Millisecond, 5}, // exactly the interval
+		{1 * time.Millisecond, 10},  // completion is never dropped
+	} {
+		clock = clock.Add(step.after)
+		tr.Update(step.done, 10)
+	}
+	// A new stage forwards its first event at once.
+	tr = Start(r, "diff")
+	clock = clock.Add(time.Millisecond)
+	tr.Update(1, 10)
+
+	want := []event{{"align", -1}, {"align", 0}, {"align", 30}, {"align", 50}, {"align", 100}, {"diff", -1}, {"diff", 10}}
+	if len(rec.events) != len(want) {
+		t.Fatalf("events = %v, want %v", rec.events, want)
+	}
+	for i := range want {
+		if rec.events[i] != want[i] {
+			t.Errorf("event %d = %v, want %v", i, rec.events[i], want[i])
+		}
+	}
+
+	if got := Throttle(rec, 0); got != Reporter(rec) {
+		t.Error("Throttle with interval 0 wrapped the reporter")
+	}
+}
@@ -0,0 +1,46 @@
+//go:build !light_test_only
+
+package region
+
+import (
+	"fmt"
+	"image"
+	"math/rand/v2"
+	"sync"
+	"testing"
+
+	"github.com/xshoji/go-img-diff/internal/core"
+)
+
+// benchMask is a 1920x1080 mask with 400 scattered changes, generated once
+// for all benchmarks of the package.
+var benchMask = sync.OnceValue(func() *core.Mask {
+	return randomMask(rand.New(rand.NewPCG(8, 8)), 1920, 1080, 400)
+})
+
+func BenchmarkExtract(b *testing.B) {
+	mask := benchMask()
+	for _, tile := range []int{0, 256} {
+		b.Run(fmt.Sprintf("tile=%d", tile), func(b *testing.B) {
+			opts := core.DefaultOptions().Region
+			opts.TileSize = tile
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				Extract(mask, opts, testLogger())
+			}
+		})
+	}
+}
+
+func BenchmarkMergeOverlapping(b *testing.B) {
+	rng := rand.New(rand.NewPCG(8, 8))
+	regions := make([]core.Region, 500)
+	for i := range regions {
+		x, y := rng.IntN(1900), rng.IntN(1060)
+		regions[i] = core.Region{Bounds: image.Rect(x, y, x+5+rng.IntN(40), y+5+rng.IntN(20))}
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		mergeOverlapping(regions, 4)
+	}
+}
@@ -3,6 +3,7 @@ package region
 import (
 	"image"
 	"log/slog"
+	"sort"
 
 	"github.com/xshoji/go-img-diff/internal/core"
 )
@@ -10,132 +11,217 @@ import (
 // Extract performs connected-component labeling on the diff mask and returns regions.
 // Steps:
 // 1. Optional dilation to bridge small gaps
-// 2. 8-connected CCL via BFS
-// 3. Filter by MinArea
-// 4. Add padding to bounding boxes
-// 5. Merge overlapping bounding boxes (single pass)
+// 2. CCL via BFS (8-connected, or within opts.ConnectDistance)
+// 3. Filter by MinArea (counting differing pixels of the mask, not dilated ones)
+// 4. Add padding to bounding boxes and grow them to MinSize
+// 5. Merge bounding boxes within MergeDistance of each other
+// 6. Score each region's severity as the share of its bounds that differs
+//
+// With opts.TileSize, steps 1 and 2 run tile by tile (see tiledComponents)
+// and find the same components. The dilated mask, visited flags and BFS
+// queue come from opts.Workspace.
 func Extract(mask *core.Mask, opts core.RegionOptions, logger *slog.Logger) []core.Region {
 	w, h := mask.W, mask.H
 
-	// Step 1: Optional dilation
-	data := mask.Data
-	if opts.DilateRadius > 0 {
-		data = dilate(mask.Data, w, h, opts.DilateRadius)
+	// Steps 1 and 2: dilation and CCL
+	var components []component
+	if tile := opts.TileSize; tile > 0 && (w > tile || h > tile) {
+		components = tiledComponents(mask, opts, tile)
+	} else {
+		components = labelComponents(mask, opts)
 	}
 
-	// Step 2: 8-connected CCL via BFS
-	visited := make([]bool, w*h)
 	var regions []core.Region
+	for _, c := range components {
+		// Step 3: Filter by MinArea
+		if c.area < opts.MinArea {
+			continue
+		}
 
-	// 8-connected neighbor offsets
-	dx := [8]int{-1, 0, 1, -1, 1, -1, 0, 1}
-	dy := [8]int{-1, -1, -1, 0, 0, 1, 1, 1}
+		// Step 4: Add padding and grow to MinSize
+		minX := max(0, c.minX-opts.Padding)
+		minY := max(0, c.minY-opts.Padding)
+		maxX := min(w-1, c.maxX+opts.Padding)
+		maxY := min(h-1, c.maxY+opts.Padding)
 
-	for y := 0; y < h; y++ {
-		for x := 0; x < w; x++ {
-			idx := y*w + x
-			if data[idx] == 0 || visited[idx] {
-				continue
-			}
+		regions = append(regions, core.Region{
+			Bounds: growToSize(image.Rect(minX, minY, maxX+1, maxY+1), opts.MinSize, w, h),
+			Area:   c.area,
+		})
+	}
 
-			// BFS flood fill
-			queue := []int{idx}
-			visited[idx] = true
-			minX, minY, maxX, maxY := x, y, x, y
-			area := 0
-
-			for len(queue) > 0 {
-				curr := queue[0]
-				queue = queue[1:]
-				cx := curr % w
-				cy := curr / w
-				area++
-
-				if cx < minX {
-					minX = cx
-				}
-				if cx > maxX {
-					maxX = cx
-				}
-				if cy < minY {
-					minY = cy
-				}
-				if cy > maxY {
-					maxY = cy
-				}
+	// Step 5: Merge nearby bounding boxes
+	merged := mergeOverlapping(regions, max(0, opts.MergeDistance))
 
-				for d := 0; d < 8; d++ {
-					nx, ny := cx+dx[d], cy+dy[d]
-					if nx < 0 || nx >= w || ny < 0 || ny >= h {
-						continue
-					}
-					nidx := ny*w + nx
-					if !visited[nidx] && data[nidx] != 0 {
-						visited[nidx] = true
-						queue = append(queue, nidx)
-					}
-				}
-			}
+	// Step 6: Severity
+	for i := range merged {
+		merged[i].Severity = severity(merged[i])
+	}
 
-			// Step 3: Filter by MinArea
-			if area < opts.MinArea {
-				continue
-			}
+	logger.Info("region extraction complete", "raw", len(regions), "merged", len(merged))
+	return merged
+}
 
-			// Step 4: Add padding
-			minX = max(0, minX-opts.Padding)
-			minY = max(0, minY-opts.Padding)
-			maxX = min(w-1, maxX+opts.Padding)
-			maxY = min(h-1, maxY+opts.Padding)
+// component is a connected group of (dilated) diff pixels.
+type component struct {
+	minX, minY, maxX, maxY int // inclusive bounds
+	area                   int // differing pixels of the mask, not dilated ones
+	first                  int // mask index of its first pixel in row-major order
+}
 
-			regions = append(regions, core.Region{
-				Bounds: image.Rect(minX, minY, maxX+1, maxY+1),
-				Area:   area,
-			})
-		}
+// labelComponents dilates the whole mask and labels it in one pass,
+// returning the components in the row-major order of their first pixel.
+func labelComponents(mask *core.Mask, opts core.RegionOptions) []component {
+	l := newLabeler(mask, opts)
+	full := image.Rect(0, 0, mask.W, mask.H)
+	data := mask.Data
+	if opts.DilateRadius > 0 {
+		dilated := l.ws.NewMask(mask.W, mask.H)
+		defer l.ws.Release(dilated)
+		dilate(mask.Data, mask.W, mask.H, opts.DilateRadius, full, dilated.Data)
+		data = dilated.Data
 	}
+	return l.label(full, data, nil, nil)
+}
 
-	// Step 5: Merge overlapping bounding boxes
-	merged := mergeOverlapping(regions)
+// labeler finds the connected components of the (dilated) diff mask within
+// rectangles of it.
+type labeler struct {
+	mask   *core.Mask
+	reach  int   // connect distance
+	dx, dy []int // neighbor offsets within reach
+	ws     *core.Workspace
+}
 
-	logger.Info("region extraction complete", "raw", len(regions), "merged", len(merged))
-	return merged
+func newLabeler(mask *core.Mask, opts core.RegionOptions) *labeler {
+	l := &labeler{mask: mask, reach: max(1, opts.ConnectDistance), ws: opts.Workspace}
+	l.dx, l.dy = neighborOffsets(l.reach)
+	return l
 }
 
-// dilate performs morphological dilation on a binary mask with the given radius.
-func dilate(src []uint8, w, h, radius int) []uint8 {
-	dst := make([]uint8, len(src))
-	copy(dst, src)
+// label appends the components within r to comps. data is the (dilated)
+// mask over r, row by row with stride r.Dx(). Neighbors outside r are not
+// followed. If border is not nil, the mask index of every pixel within reach
+// of a side of r inside the mask is recorded in it with the index of its
+// component in comps.
+func (l *labeler) label(r image.Rectangle, data []uint8, comps []component, border map[int]int) []component {
+	w, rw := l.mask.W, r.Dx()
+	// Not image.Rect, which would swap the sides of a tile narrower than
+	// twice the reach.
+	inner := image.Rectangle{Min: r.Min.Add(image.Pt(l.reach, l.reach)), Max: r.Max.Sub(image.Pt(l.reach, l.reach))}
+	if r.Min.X == 0 {
+		inner.Min.X = 0
+	}
+	if r.Min.Y == 0 {
+		inner.Min.Y = 0
+	}
+	if r.Max.X == w {
+		inner.Max.X = w
+	}
+	if r.Max.Y == l.mask.H {
+		inner.Max.Y = l.mask.H
+	}
+
+	visited := l.ws.Bools(len(data))
+	queue := l.ws.Queue()
+	defer func() { l.ws.KeepQueue(queue) }()
+
+	for i, v := range data {
+		if v == 0 || visited[i] {
+			continue
+		}
+
+		// BFS flood fill
+		x, y := r.Min.X+i%rw, r.Min.Y+i/rw
+		c := component{minX: x, minY: y, maxX: x, maxY: y, first: y*w + x}
+		queue = append(queue[:0], i)
+		visited[i] = true
 
-	for y := 0; y < h; y++ {
-		for x := 0; x < w; x++ {
-			if src[y*w+x] != 0 {
-				continue
+		for head := 0; head < len(queue); head++ {
+			curr := queue[head]
+			cx, cy := r.Min.X+curr%rw, r.Min.Y+curr/rw
+			if l.mask.Data[cy*w+cx] != 0 {
+				c.area++
 			}
-			// Check if any neighbor within radius is set
-			found := false
-			for dy := -radius; dy <= radius && !found; dy++ {
-				for dx := -radius; dx <= radius && !found; dx++ {
-					nx, ny := x+dx, y+dy
-					if nx >= 0 && nx < w && ny >= 0 && ny < h {
-						if src[ny*w+nx] != 0 {
-							found = true
-						}
-					}
+			c.minX, c.maxX = min(c.minX, cx), max(c.maxX, cx)
+			c.minY, c.maxY = min(c.minY, cy), max(c.maxY, cy)
+			if border != nil && !image.Pt(cx, cy).In(inner) {
+				border[cy*w+cx] = len(comps)
+			}
+
+			for d := range l.dx {
+				nx, ny := cx+l.dx[d], cy+l.dy[d]
+				if nx < r.Min.X || nx >= r.Max.X || ny < r.Min.Y || ny >= r.Max.Y {
+					continue
+				}
+				next := (ny-r.Min.Y)*rw + nx - r.Min.X
+				if !visited[next] && data[next] != 0 {
+					visited[next] = true
+					queue = append(queue, next)
 				}
 			}
+		}
+		comps = append(comps, c)
+	}
+	return comps
+}
+
+// neighborOffsets returns the offsets of every pixel within Chebyshev distance
+// radius, excluding the center. Radius 1 gives the 8-connected neighborhood.
+func neighborOffsets(radius int) (dx, dy []int) {
+	for oy := -radius; oy <= radius; oy++ {
+		for ox := -radius; ox <= radius; ox++ {
+			if ox != 0 || oy != 0 {
+				dx = append(dx, ox)
+				dy = append(dy, oy)
+			}
+		}
+	}
+	return dx, dy
+}
+
+// dilate writes the morphological dilation with the given radius of the
+// w x h binary mask src, over r, to dst with stride r.Dx().
+func dilate(src []uint8, w, h, radius int, r image.Rectangle, dst []uint8) {
+	rw := r.Dx()
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			// Check if the pixel or any neighbor within radius is set
+			found := src[y*w+x] != 0
+			for ny := max(0, y-radius); ny <= min(h-1, y+radius) && !found; ny++ {
+				for nx := max(0, x-radius); nx <= min(w-1, x+radius) && !found; nx++ {
+					found = src[ny*w+nx] != 0
+				}
+			}
+			dst[(y-r.Min.Y)*rw+x-r.Min.X] = 0
 			if found {
-				dst[y*w+x] = 1
+				dst[(y-r.Min.Y)*rw+x-r.Min.X] = 1
 			}
 		}
 	}
+}
 
-	return dst
+// growToSize widens and heightens r to at least size pixels around its center,
+// shifted to stay within a w x h image and never larger than it.
+func growToSize(r image.Rectangle, size, w, h int) image.Rectangle {
+	grow := func(lo, hi, limit int) (int, int) {
+		n := min(size, limit)
+		if hi-lo >= n {
+			return lo, hi
+		}
+		lo -= (n - (hi - lo)) / 2
+		lo = max(0, min(lo, limit-n))
+		return lo, lo + n
+	}
+	r.Min.X, r.Max.X = grow(r.Min.X, r.Max.X, w)
+	r.Min.Y, r.Max.Y = grow(r.Min.Y, r.Max.Y, h)
+	return r
 }
 
-// mergeOverlapping merges regions whose bounding boxes overlap or touch.
+// mergeOverlapping merges regions whose bounding boxes overlap, touch or are at
+// most distance pixels apart on both axes.
 // Uses a simple iterative approach: keep merging until no changes occur.
-func mergeOverlapping(regions []core.Region) []core.Region {
+func mergeOverlapping(regions []core.Region, distance int) []core.Region {
 	if len(regions) <= 1 {
 		return regions
 	}
@@ -149,7 +235,7 @@ func mergeOverlapping(regions []core.Region) []core.Region {
 		for i := 0; i < len(result); i++ {
 			for j := i + 1; j < len(result); j++ {
 				if result[i].Bounds.Overlaps(result[j].Bounds) ||
-					touches(result[i].Bounds, result[j].Bounds) {
+					near(result[i].Bounds, result[j].Bounds, distance) {
 					// Merge j into i
 					result[i] = core.Region{
 						Bounds: result[i].Bounds.Union(result[j].Bounds),
@@ -167,9 +253,142 @@ func mergeOverlapping(regions []core.Region) []core.Region {
 	return result
 }
 
-// touches returns true if two rectangles are adjacent (share an edge but don't overlap).
-func touches(a, b image.Rectangle) bool {
-	// Expand a by 1 pixel and check overlap
-	expanded := image.Rect(a.Min.X-1, a.Min.Y-1, a.Max.X+1, a.Max.Y+1)
+// near reports whether two rectangles are adjacent or separated by at most
+// distance pixels (distance 0: they share an edge or corner).
+func near(a, b image.Rectangle, distance int) bool {
+	// Expand a by 1+distance pixels and check overlap
+	d := 1 + distance
+	expanded := image.Rect(a.Min.X-d, a.Min.Y-d, a.Max.X+d, a.Max.Y+d)
 	return expanded.Overlaps(b)
 }
+
+// Exclude clips regions so that none overlaps a rectangle of rects. A region
+// crossing a rectangle is split into the parts of its bounds outside it, each
+// shrunk to the bounding box of its diff pixels in mask; parts without diff
+// pixels are dropped. Other regions are returned unchanged.
+func Exclude(regions []core.Region, mask *core.Mask, rects []image.Rectangle) []core.Region {
+	out := make([]core.Region, 0, len(regions))
+	for _, r := range regions {
+		parts := []image.Rectangle{r.Bounds}
+		for _, ex := range rects {
+			var next []image.Rectangle
+			for _, p := range parts {
+				next = append(next, subtract(p, ex)...)
+			}
+			parts = next
+		}
+		if len(parts) == 1 && parts[0] == r.Bounds {
+			out = append(out, r)
+			continue
+		}
+		for _, p := range parts {
+			if b, area := maskBounds(mask, p); area > 0 {
+				part := core.Region{Bounds: b, Area: area}
+				part.Severity = severity(part)
+				out = append(out, part)
+			}
+		}
+	}
+	return out
+}
+
+// Suppress splits regions into those with at least minPixels diff pixels
+// (Region.Area) and the rest, both in their original order.
+func Suppress(regions []core.Region, minPixels int) (kept, suppressed []core.Region) {
+	for _, r := range regions {
+		if r.Area < minPixels {
+			suppressed = append(suppressed, r)
+		} else {
+			kept = append(kept, r)
+		}
+	}
+	return kept, suppressed
+}
+
+// Clamp clips the bounds of every region to bounds, the image the regions
+// were found in, and drops regions left empty, so that no later stage draws,
+// crops or reports a box extending past the image.
+func Clamp(regions []core.Region, bounds image.Rectangle) []core.Region {
+	out := regions[:0]
+	for _, r := range regions {
+		if r.Bounds = r.Bounds.Intersect(bounds); !r.Bounds.Empty() {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// severity returns the share of the bounds of r covered by its diff pixels.
+func severity(r core.Region) float64 {
+	size := r.Bounds.Dx() * r.Bounds.Dy()
+	if size == 0 {
+		return 0
+	}
+	return min(1, float64(r.Area)/float64(size))
+}
+
+// subtract returns up to four rectangles covering the part of r outside ex:
+// full-width bands above and below ex, and the parts left and right of it.
+func subtract(r, ex image.Rectangle) []image.Rectangle {
+	in := r.Intersect(ex)
+	if in.Empty() {
+		return []image.Rectangle{r}
+	}
+	var parts []image.Rectangle
+	for _, p := range []image.Rectangle{
+		image.Rect(r.Min.X, r.Min.Y, r.Max.X, in.Min.Y),
+		image.Rect(r.Min.X, in.Max.Y, r.Max.X, r.Max.Y),
+		image.Rect(r.Min.X, in.Min.Y, in.Min.X, in.Max.Y),
+		image.Rect(in.Max.X, in.Min.Y, r.Max.X, in.Max.Y),
+	} {
+		if !p.Empty() {
+			parts = append(parts, p)
+		}
+	}
+	return parts
+}
+
+// maskBounds returns the bounding box and count of the set pixels of mask
+// within r.
+func maskBounds(mask *core.Mask, r image.Rectangle) (image.Rectangle, int) {
+	r = r.Intersect(image.Rect(0, 0, mask.W, mask.H))
+	var b image.Rectangle
+	count := 0
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			if mask.Data[y*mask.W+x] != 0 {
+				b = b.Union(image.Rect(x, y, x+1, y+1))
+				count++
+			}
+		}
+	}
+	return b, count
+}
+
+// SortBySeverity orders regions by descending Severity, then descending Area,
+// then top to bottom and left to right, so that the order is deterministic.
+func SortBySeverity(regions []core.Region) {
+	sort.SliceStable(regions, func(i, j int) bool {
+		ri, rj := regions[i], regions[j]
+		if ri.Severity != rj.Severity {
+			return ri.Severity > rj.Severity
+		}
+		if ri.Area != rj.Area {
+			return ri.Area > rj.Area
+		}
+		if ri.Bounds.Min.Y != rj.Bounds.Min.Y {
+			return ri.Bounds.Min.Y < rj.Bounds.Min.Y
+		}
+		return ri.Bounds.Min.X < rj.Bounds.Min.X
+	})
+}
+
+// Limit keeps the first maxRegions regions (all when maxRegions is 0) and
+// returns them with the number dropped. Sorted by SortBySeverity, the same
+// regions are kept on every run.
+func Limit(regions []core.Region, maxRegions int) ([]core.Region, int) {
+	if maxRegions <= 0 || len(regions) <= maxRegions {
+		return regions, 0
+	}
+	return regions[:maxRegions], len(regions) - maxRegions
+}
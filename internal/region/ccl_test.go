@@ -4,6 +4,7 @@ import (
 	"image"
 	"log/slog"
 	"os"
+	"reflect"
 	"testing"
 
 	"github.com/xshoji/go-img-diff/internal/core"
@@ -49,6 +50,30 @@ func TestExtract_SingleRegion(t *testing.T) {
 	}
 }
 
+// Dilation only bridges gaps; the area and the MinArea filter count the
+// differing pixels of the mask.
+func TestExtract_AreaIgnoresDilation(t *testing.T) {
+	mask := core.NewMask(50, 50)
+	for y := 20; y < 23; y++ {
+		for x := 20; x < 23; x++ {
+			mask.Set(x, y)
+		}
+	}
+	mask.Set(40, 40) // isolated pixel, 25 pixels once dilated
+
+	opts := core.RegionOptions{MinArea: 4, DilateRadius: 2}
+	regions := Extract(mask, opts, testLogger())
+	if len(regions) != 1 {
+		t.Fatalf("expected 1 region, got %d: %v", len(regions), regions)
+	}
+	if regions[0].Area != 9 {
+		t.Errorf("expected area 9, got %d", regions[0].Area)
+	}
+	if want := image.Rect(18, 18, 25, 25); regions[0].Bounds != want {
+		t.Errorf("bounds %v, want %v", regions[0].Bounds, want)
+	}
+}
+
 func TestExtract_TwoSeparateRegions(t *testing.T) {
 	mask := core.NewMask(50, 50)
 	// Region 1: top-left
@@ -72,6 +97,43 @@ func TestExtract_TwoSeparateRegions(t *testing.T) {
 	}
 }
 
+func TestExtract_LongLineIsOneRegion(t *testing.T) {
+	mask := core.NewMask(600, 20)
+	for x := 50; x < 550; x++ {
+		mask.Set(x, 10)
+	}
+
+	regions := Extract(mask, core.RegionOptions{MinArea: 1}, testLogger())
+	if len(regions) != 1 {
+		t.Fatalf("expected 1 region, got %d", len(regions))
+	}
+	if want := image.Rect(50, 10, 550, 11); regions[0].Bounds != want || regions[0].Area != 500 {
+		t.Errorf("region = %v area %d, want %v area 500", regions[0].Bounds, regions[0].Area, want)
+	}
+}
+
+func TestExtract_ConnectDistance(t *testing.T) {
+	mask := core.NewMask(50, 10)
+	// Two 3x3 blocks with a 3-pixel gap between them.
+	for y := 3; y < 6; y++ {
+		for x := 10; x < 13; x++ {
+			mask.Set(x, y)
+			mask.Set(x+6, y)
+		}
+	}
+
+	if regions := Extract(mask, core.RegionOptions{MinArea: 1}, testLogger()); len(regions) != 2 {
+		t.Fatalf("8-connected: expected 2 regions, got %d", len(regions))
+	}
+	regions := Extract(mask, core.RegionOptions{MinArea: 1, ConnectDistance: 4}, testLogger())
+	if len(regions) != 1 {
+		t.Fatalf("connect distance 4: expected 1 region, got %d", len(regions))
+	}
+	if regions[0].Area != 18 {
+		t.Errorf("area = %d, want 18 (gap pixels must not count)", regions[0].Area)
+	}
+}
+
 func TestExtract_MinAreaFilter(t *testing.T) {
 	mask := core.NewMask(50, 50)
 	// Set just 2 pixels
@@ -127,15 +189,127 @@ func TestExtract_Dilation(t *testing.T) {
 	}
 }
 
+func TestExtract_Severity(t *testing.T) {
+	mask := core.NewMask(100, 100)
+	for y := 10; y < 20; y++ {
+		for x := 10; x < 20; x++ {
+			mask.Set(x, y)
+		}
+	}
+	for i := 0; i < 20; i++ {
+		mask.Set(50+i, 50+i)
+	}
+
+	regions := Extract(mask, core.RegionOptions{}, testLogger())
+	if len(regions) != 2 {
+		t.Fatalf("expected 2 regions, got %d", len(regions))
+	}
+	if regions[0].Severity != 1 {
+		t.Errorf("solid block severity = %v, want 1", regions[0].Severity)
+	}
+	if want := 20.0 / 400; regions[1].Severity != want {
+		t.Errorf("diagonal line severity = %v, want %v", regions[1].Severity, want)
+	}
+}
+
+func TestExclude(t *testing.T) {
+	mask := core.NewMask(100, 100)
+	for y := 10; y < 50; y++ {
+		for x := 10; x < 50; x++ {
+			mask.Set(x, y)
+		}
+	}
+	mask.Set(80, 80)
+	// Overlapping rectangles covering the middle of the block, leaving an
+	// L-shaped band along its top and left edges.
+	rects := []image.Rectangle{image.Rect(20, 20, 40, 60), image.Rect(30, 20, 60, 60)}
+	for _, r := range rects {
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				mask.Data[y*mask.W+x] = 0
+			}
+		}
+	}
+	regions := []core.Region{
+		{Bounds: image.Rect(8, 8, 52, 52), Area: 40*40 - 30*30},
+		{Bounds: image.Rect(78, 78, 83, 83), Area: 1},
+	}
+
+	got := Exclude(regions, mask, rects)
+	want := []core.Region{
+		{Bounds: image.Rect(10, 10, 50, 20), Area: 400, Severity: 1},
+		{Bounds: image.Rect(10, 20, 20, 50), Area: 300, Severity: 1},
+		regions[1],
+	}
+	if len(got) != len(want) {
+		t.Fatalf("regions %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("region %d = %v, want %v", i, got[i], want[i])
+		}
+		for _, r := range rects {
+			if got[i].Bounds.Overlaps(r) {
+				t.Errorf("region %v overlaps ignore rect %v", got[i].Bounds, r)
+			}
+		}
+	}
+}
+
 func TestMergeOverlapping(t *testing.T) {
 	regions := []core.Region{
 		{Bounds: image.Rect(0, 0, 20, 20), Area: 100},
 		{Bounds: image.Rect(15, 15, 35, 35), Area: 100},
 	}
 
-	merged := mergeOverlapping(regions)
+	merged := mergeOverlapping(regions, 0)
 	if len(merged) != 1 {
 		t.Errorf("expected 1 merged region, got %d", len(merged))
+	} else if merged[0].Area != 200 {
+		t.Errorf("merged area = %d, want 200", merged[0].Area)
+	}
+}
+
+func TestLimit(t *testing.T) {
+	regions := []core.Region{
+		{Bounds: image.Rect(0, 0, 2, 2), Area: 4},
+		{Bounds: image.Rect(9, 0, 11, 2), Area: 4},
+		{Bounds: image.Rect(0, 9, 2, 11), Area: 4},
+	}
+	SortBySeverity(regions)
+	if kept, dropped := Limit(regions, 2); dropped != 1 || !reflect.DeepEqual(kept, regions[:2]) {
+		t.Errorf("Limit(2) = %v, %d; want the first two and 1 dropped", kept, dropped)
+	}
+	for _, n := range []int{0, 3, 4} {
+		if kept, dropped := Limit(regions, n); dropped != 0 || len(kept) != 3 {
+			t.Errorf("Limit(%d) = %v, %d; want all regions", n, kept, dropped)
+		}
+	}
+}
+
+func TestSuppress(t *testing.T) {
+	mask := core.NewMask(60, 60)
+	mask.Set(5, 5) // a 2-pixel diff
+	mask.Set(6, 5)
+	for x := 30; x < 33; x++ { // two 3-pixel specks whose padded boxes merge
+		mask.Set(x, 30)
+		mask.Set(x, 34)
+	}
+	regions := Extract(mask, core.RegionOptions{MinArea: 1, Padding: 2}, testLogger())
+	if len(regions) != 2 {
+		t.Fatalf("expected 2 regions, got %v", regions)
+	}
+
+	kept, suppressed := Suppress(regions, 5)
+	if len(kept) != 1 || kept[0].Area != 6 || kept[0].Bounds != image.Rect(28, 28, 35, 37) {
+		t.Errorf("kept = %v, want the merged specks of 6 pixels", kept)
+	}
+	if len(suppressed) != 1 || suppressed[0].Area != 2 || suppressed[0].Bounds != image.Rect(3, 3, 9, 8) {
+		t.Errorf("suppressed = %v, want the 2-pixel diff", suppressed)
+	}
+
+	if kept, suppressed := Suppress(regions, 0); len(kept) != 2 || suppressed != nil {
+		t.Errorf("Suppress(0) = %v, %v, want all regions kept", kept, suppressed)
 	}
 }
 
@@ -145,8 +319,102 @@ func TestMergeOverlapping_NoOverlap(t *testing.T) {
 		{Bounds: image.Rect(30, 30, 40, 40), Area: 50},
 	}
 
-	merged := mergeOverlapping(regions)
+	merged := mergeOverlapping(regions, 0)
 	if len(merged) != 2 {
 		t.Errorf("expected 2 regions, got %d", len(merged))
 	}
 }
+
+func TestMergeOverlapping_Distance(t *testing.T) {
+	regions := []core.Region{
+		{Bounds: image.Rect(0, 0, 10, 10), Area: 50},
+		{Bounds: image.Rect(13, 0, 23, 10), Area: 50}, // 3 px apart
+	}
+	if merged := mergeOverlapping(regions, 2); len(merged) != 2 {
+		t.Errorf("distance 2: %d regions, want 2", len(merged))
+	}
+	if merged := mergeOverlapping(regions, 3); len(merged) != 1 || merged[0].Bounds != image.Rect(0, 0, 23, 10) || merged[0].Area != 100 {
+		t.Errorf("distance 3: %+v, want one merged region", merged)
+	}
+}
+
+func TestExtract_MergeDistance(t *testing.T) {
+	// Two 4x4 changes 3 px apart.
+	mask := core.NewMask(60, 40)
+	for y := 10; y < 14; y++ {
+		for x := 10; x < 14; x++ {
+			mask.Set(x, y)
+			mask.Set(x+7, y)
+		}
+	}
+
+	if got := Extract(mask, core.DefaultOptions().Region, testLogger()); len(got) != 1 {
+		t.Errorf("defaults: %d regions, want the padded boxes merged", len(got))
+	}
+	opts := core.RegionOptions{MinArea: 1}
+	if got := Extract(mask, opts, testLogger()); len(got) != 2 {
+		t.Errorf("MergeDistance 0: %d regions, want 2", len(got))
+	}
+	opts.MergeDistance = 3
+	if got := Extract(mask, opts, testLogger()); len(got) != 1 {
+		t.Errorf("MergeDistance 3: %d regions, want 1", len(got))
+	}
+}
+
+func TestExtract_MinSize(t *testing.T) {
+	mask := core.NewMask(30, 30)
+	mask.Set(10, 10)
+	mask.Set(29, 0)
+
+	got := Extract(mask, core.RegionOptions{MinArea: 1, MinSize: 20}, testLogger())
+	if len(got) != 1 || got[0].Bounds != image.Rect(1, 0, 30, 21) {
+		// Both pixels grow into overlapping 20x20 boxes, the corner one shifted inside the image.
+		t.Errorf("regions = %+v, want one merged box (1,0)-(30,21)", got)
+	}
+
+	got = Extract(mask, core.RegionOptions{MinArea: 1, MinSize: 5}, testLogger())
+	want := []image.Rectangle{image.Rect(25, 0, 30, 5), image.Rect(8, 8, 13, 13)}
+	if len(got) != 2 || got[0].Bounds != want[0] || got[1].Bounds != want[1] {
+		t.Errorf("regions = %+v, want bounds %v", got, want)
+	}
+}
+
+func TestExtract_CornerRegionInBounds(t *testing.T) {
+	bounds := image.Rect(0, 0, 30, 30)
+	for _, corner := range []image.Point{{0, 0}, {29, 0}, {0, 29}, {29, 29}} {
+		mask := core.NewMask(30, 30)
+		mask.Set(corner.X, corner.Y)
+		mask.Set(15, 15)
+
+		got := Extract(mask, core.RegionOptions{MinArea: 1, Padding: 5, MinSize: 20, MergeDistance: 10}, testLogger())
+		if len(got) != 1 {
+			t.Fatalf("corner %v: regions = %+v, want one merged region", corner, got)
+		}
+		if b := got[0].Bounds; !b.In(bounds) || !corner.In(b) {
+			t.Errorf("corner %v: bounds %v, want a box within %v containing the corner", corner, b, bounds)
+		}
+	}
+}
+
+func TestClamp(t *testing.T) {
+	regions := []core.Region{
+		{Bounds: image.Rect(20, 25, 40, 35), Area: 10},
+		{Bounds: image.Rect(-5, -5, 3, 4), Area: 2},
+		{Bounds: image.Rect(30, 0, 40, 10), Area: 5}, // entirely outside
+		{Bounds: image.Rect(5, 5, 10, 10), Area: 25},
+	}
+	got := Clamp(regions, image.Rect(0, 0, 30, 30))
+	want := []core.Region{
+		{Bounds: image.Rect(20, 25, 30, 30), Area: 10},
+		{Bounds: image.Rect(0, 0, 3, 4), Area: 2},
+		{Bounds: image.Rect(5, 5, 10, 10), Area: 25},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("regions = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("region %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
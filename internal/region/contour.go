@@ -0,0 +1,171 @@
+package region
+
+import (
+	"image"
+	"math"
+
+	"github.com/xshoji/go-img-diff/internal/core"
+)
+
+// mooreDirs are the 8 neighbors of a pixel in clockwise order (y grows
+// downwards), starting east.
+var mooreDirs = [8]image.Point{{1, 0}, {1, 1}, {0, 1}, {-1, 1}, {-1, 0}, {-1, -1}, {0, -1}, {1, -1}}
+
+// mooreWest is the index of the west neighbor in mooreDirs.
+const mooreWest = 4
+
+// TraceContours sets the Contour of every region for RegionOutlineContour:
+// the outer boundary of each 8-connected component of diff pixels inside its
+// bounds, traced by Moore-neighbor tracing and simplified by Douglas-Peucker
+// with opts.ContourEpsilon. Components of fewer than opts.MinArea pixels are
+// left out, as in Extract. Other outlines leave the regions unchanged.
+func TraceContours(regions []core.Region, mask *core.Mask, opts core.RegionOptions) {
+	if opts.Outline != core.RegionOutlineContour {
+		return
+	}
+	for i := range regions {
+		var polygons [][]image.Point
+		for _, boundary := range traceComponents(mask, regions[i].Bounds, max(1, opts.MinArea)) {
+			polygons = append(polygons, simplifyPolygon(boundary, opts.ContourEpsilon))
+		}
+		regions[i].Contour = &core.Contour{Polygons: polygons}
+	}
+}
+
+// traceComponents returns the outer boundary of every 8-connected component
+// of at least minArea diff pixels of mask inside r, in raster order of their
+// first pixel.
+func traceComponents(mask *core.Mask, r image.Rectangle, minArea int) [][]image.Point {
+	r = r.Intersect(image.Rect(0, 0, mask.W, mask.H))
+	inside := func(p image.Point) bool {
+		return p.In(r) && mask.Data[p.Y*mask.W+p.X] != 0
+	}
+	visited := make([]bool, r.Dx()*r.Dy())
+	seen := func(p image.Point) *bool {
+		return &visited[(p.Y-r.Min.Y)*r.Dx()+p.X-r.Min.X]
+	}
+
+	var boundaries [][]image.Point
+	var queue []image.Point
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			start := image.Pt(x, y)
+			if !inside(start) || *seen(start) {
+				continue
+			}
+			// Mark the component, counting its pixels.
+			area := 0
+			*seen(start) = true
+			queue = append(queue[:0], start)
+			for len(queue) > 0 {
+				p := queue[len(queue)-1]
+				queue = queue[:len(queue)-1]
+				area++
+				for _, d := range mooreDirs {
+					if n := p.Add(d); inside(n) && !*seen(n) {
+						*seen(n) = true
+						queue = append(queue, n)
+					}
+				}
+			}
+			if area >= minArea {
+				boundaries = append(boundaries, traceBoundary(start, inside))
+			}
+		}
+	}
+	return boundaries
+}
+
+// traceBoundary follows the outer boundary of the component of start, its
+// first pixel in raster order, clockwise. It stops on returning to start
+// about to repeat the first move (Jacob's stopping criterion), so boundaries
+// touching start more than once are followed completely.
+func traceBoundary(start image.Point, inside func(image.Point) bool) []image.Point {
+	boundary := []image.Point{start}
+	cur, back := start, mooreWest // the west neighbor of the first pixel is background
+	var second image.Point
+	for step := 0; ; step++ {
+		next, nextBack, ok := mooreNext(cur, back, inside)
+		if !ok {
+			return boundary // a single pixel
+		}
+		if step == 0 {
+			second = next
+		} else if cur == start && next == second {
+			return boundary[:len(boundary)-1]
+		}
+		boundary = append(boundary, next)
+		cur, back = next, nextBack
+	}
+}
+
+// mooreNext returns the first pixel of the component found clockwise around
+// cur after its background neighbor in direction back, and the direction of
+// the background neighbor checked just before it, as seen from that pixel.
+func mooreNext(cur image.Point, back int, inside func(image.Point) bool) (image.Point, int, bool) {
+	for k := 1; k <= 8; k++ {
+		d := (back + k) % 8
+		next := cur.Add(mooreDirs[d])
+		if !inside(next) {
+			continue
+		}
+		prev := cur.Add(mooreDirs[(d+7)%8]).Sub(next)
+		for i, dir := range mooreDirs {
+			if dir == prev {
+				return next, i, true
+			}
+		}
+	}
+	return cur, back, false
+}
+
+// simplifyPolygon reduces the closed polygon pts with the Douglas-Peucker
+// algorithm: vertices closer than epsilon to the simplified outline are
+// dropped. The polygon is split at its first vertex and the vertex farthest
+// from it, which are both kept.
+func simplifyPolygon(pts []image.Point, epsilon float64) []image.Point {
+	if len(pts) <= 3 {
+		return pts
+	}
+	far, farDist := 0, -1.0
+	for i, p := range pts {
+		if d := math.Hypot(float64(p.X-pts[0].X), float64(p.Y-pts[0].Y)); d > farDist {
+			far, farDist = i, d
+		}
+	}
+	closed := append(append([]image.Point{}, pts...), pts[0])
+	first := simplifyChain(closed[:far+1], epsilon)
+	second := simplifyChain(closed[far:], epsilon)
+	return append(first[:len(first)-1], second[:len(second)-1]...)
+}
+
+// simplifyChain reduces the open polyline pts, keeping its end points.
+func simplifyChain(pts []image.Point, epsilon float64) []image.Point {
+	if len(pts) <= 2 {
+		return append([]image.Point{}, pts...)
+	}
+	a, b := pts[0], pts[len(pts)-1]
+	index, dist := 0, -1.0
+	for i := 1; i < len(pts)-1; i++ {
+		if d := segmentDistance(pts[i], a, b); d > dist {
+			index, dist = i, d
+		}
+	}
+	if dist <= epsilon {
+		return []image.Point{a, b}
+	}
+	left := simplifyChain(pts[:index+1], epsilon)
+	right := simplifyChain(pts[index:], epsilon)
+	return append(left[:len(left)-1], right...)
+}
+
+// segmentDistance returns the distance of p from the segment a-b.
+func segmentDistance(p, a, b image.Point) float64 {
+	dx, dy := float64(b.X-a.X), float64(b.Y-a.Y)
+	px, py := float64(p.X-a.X), float64(p.Y-a.Y)
+	if dx == 0 && dy == 0 {
+		return math.Hypot(px, py)
+	}
+	t := math.Max(0, math.Min(1, (px*dx+py*dy)/(dx*dx+dy*dy)))
+	return math.Hypot(px-t*dx, py-t*dy)
+}
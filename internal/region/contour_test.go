@@ -0,0 +1,152 @@
+package region
+
+import (
+	"image"
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"github.com/xshoji/go-img-diff/internal/core"
+)
+
+func contourOptions(epsilon float64) core.RegionOptions {
+	return core.RegionOptions{MinArea: 1, Outline: core.RegionOutlineContour, ContourEpsilon: epsilon}
+}
+
+func TestTraceContours_Circle(t *testing.T) {
+	const cx, cy, radius = 40, 30, 15
+	mask := core.NewMask(80, 60)
+	for y := 0; y < mask.H; y++ {
+		for x := 0; x < mask.W; x++ {
+			if math.Hypot(float64(x-cx), float64(y-cy)) <= radius {
+				mask.Set(x, y)
+			}
+		}
+	}
+	regions := Extract(mask, core.RegionOptions{MinArea: 1, Padding: 2}, testLogger())
+	if len(regions) != 1 {
+		t.Fatalf("expected 1 region, got %d", len(regions))
+	}
+	TraceContours(regions, mask, contourOptions(1))
+
+	c := regions[0].Contour
+	if c == nil || len(c.Polygons) != 1 {
+		t.Fatalf("contour = %+v, want one polygon", c)
+	}
+	polygon := c.Polygons[0]
+	// The boundary has about 2*pi*15 = 94 pixels; the simplified polygon
+	// keeps enough vertices to stay round.
+	if len(polygon) < 8 || len(polygon) > 40 {
+		t.Errorf("polygon has %d vertices, want 8-40", len(polygon))
+	}
+	for _, p := range polygon {
+		// Vertices are boundary pixels, on the circle up to rounding.
+		if d := math.Hypot(float64(p.X-cx), float64(p.Y-cy)); d < radius-1.5 || d > radius+0.5 {
+			t.Errorf("vertex %v is %.2f from the center, want about %d", p, d, radius)
+		}
+	}
+	// The polygon covers the circle rather than its bounding box.
+	if area, want := polygonArea(polygon), math.Pi*radius*radius; area < 0.85*want || area > 1.05*want {
+		t.Errorf("polygon area %.0f, want about %.0f", area, want)
+	}
+}
+
+func TestTraceContours_Square(t *testing.T) {
+	mask := core.NewMask(20, 20)
+	mask.SetRect(image.Rect(2, 3, 7, 8))
+	regions := []core.Region{{Bounds: image.Rect(0, 0, 20, 20)}}
+	TraceContours(regions, mask, contourOptions(0.5))
+
+	// Corners clockwise from the first pixel in raster order.
+	want := [][]image.Point{{{2, 3}, {6, 3}, {6, 7}, {2, 7}}}
+	if got := regions[0].Contour.Polygons; !reflect.DeepEqual(got, want) {
+		t.Errorf("polygons = %v, want %v", got, want)
+	}
+}
+
+func TestTraceContours_Components(t *testing.T) {
+	mask := core.NewMask(30, 10)
+	mask.SetRect(image.Rect(1, 1, 4, 4))
+	mask.Set(10, 5) // a single pixel
+	mask.SetRect(image.Rect(20, 2, 25, 7))
+	mask.ClearRect(image.Rect(21, 3, 24, 6)) // a ring: only its outer boundary is traced
+	regions := []core.Region{{Bounds: image.Rect(0, 0, 30, 10)}}
+
+	TraceContours(regions, mask, contourOptions(0.5))
+	got := regions[0].Contour.Polygons
+	want := [][]image.Point{
+		{{1, 1}, {3, 1}, {3, 3}, {1, 3}},
+		{{20, 2}, {24, 2}, {24, 6}, {20, 6}},
+		{{10, 5}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("polygons = %v, want %v", got, want)
+	}
+
+	// MinArea drops the single pixel; the bounds clip the components.
+	regions = []core.Region{{Bounds: image.Rect(0, 0, 22, 10)}}
+	opts := contourOptions(0.5)
+	opts.MinArea = 2
+	TraceContours(regions, mask, opts)
+	if got := regions[0].Contour.Polygons; len(got) != 2 || got[1][0] != image.Pt(20, 2) {
+		t.Errorf("polygons = %v, want the square and the clipped ring", got)
+	}
+
+	// Box outlines trace nothing.
+	regions = []core.Region{{Bounds: image.Rect(0, 0, 30, 10)}}
+	TraceContours(regions, mask, core.RegionOptions{MinArea: 1})
+	if regions[0].Contour != nil {
+		t.Errorf("box outline traced %+v", regions[0].Contour)
+	}
+}
+
+func TestTraceContours_DiagonalLine(t *testing.T) {
+	mask := core.NewMask(20, 20)
+	for i := 0; i < 10; i++ {
+		mask.Set(5+i, 2+i)
+	}
+	regions := []core.Region{{Bounds: image.Rect(0, 0, 20, 20)}}
+	TraceContours(regions, mask, contourOptions(0.5))
+
+	// The boundary of a line one pixel wide runs there and back.
+	want := [][]image.Point{{{5, 2}, {14, 11}}}
+	if got := regions[0].Contour.Polygons; !reflect.DeepEqual(got, want) {
+		t.Errorf("polygons = %v, want %v", got, want)
+	}
+}
+
+func TestTraceBoundary_RandomShapes(t *testing.T) {
+	// Every traced boundary must end, and consist of pixels of the
+	// component that touch the background.
+	rng := rand.New(rand.NewSource(1))
+	for n := 0; n < 200; n++ {
+		mask := core.NewMask(12, 12)
+		for i := 0; i < 60; i++ {
+			mask.Set(rng.Intn(12), rng.Intn(12))
+		}
+		bounds := image.Rect(0, 0, 12, 12)
+		for _, boundary := range traceComponents(mask, bounds, 1) {
+			if len(boundary) > 4*mask.Count+1 {
+				t.Fatalf("boundary of %d points for %d pixels", len(boundary), mask.Count)
+			}
+			for _, p := range boundary {
+				if !mask.Get(p.X, p.Y) {
+					t.Fatalf("boundary point %v is not a diff pixel", p)
+				}
+			}
+		}
+	}
+}
+
+// polygonArea returns the area enclosed by the polygon through the centers
+// of the boundary pixels pts, plus half a pixel all round.
+func polygonArea(pts []image.Point) float64 {
+	area, perimeter := 0.0, 0.0
+	for i, p := range pts {
+		q := pts[(i+1)%len(pts)]
+		area += float64(p.X*q.Y - q.X*p.Y)
+		perimeter += math.Hypot(float64(q.X-p.X), float64(q.Y-p.Y))
+	}
+	return math.Abs(area)/2 + perimeter/2
+}
@@ -0,0 +1,89 @@
+package region
+
+import (
+	"cmp"
+	"image"
+	"slices"
+
+	"github.com/xshoji/go-img-diff/internal/core"
+)
+
+// tiledComponents finds the components of labelComponents tile by tile. Each
+// tile of tile x tile pixels is dilated and labeled on its own, so the
+// scratch buffers cover one tile instead of the whole mask. Components are
+// then joined across tile borders: two pixels in different tiles within the
+// connect distance of each other both lie within that distance of a border
+// of their tile, so only those border pixels are compared.
+func tiledComponents(mask *core.Mask, opts core.RegionOptions, tile int) []component {
+	l := newLabeler(mask, opts)
+	w, h := mask.W, mask.H
+	buf := l.ws.NewMask(min(tile, w), min(tile, h))
+	defer l.ws.Release(buf)
+
+	var comps []component
+	border := make(map[int]int)
+	for ty := 0; ty < h; ty += tile {
+		for tx := 0; tx < w; tx += tile {
+			r := image.Rect(tx, ty, min(tx+tile, w), min(ty+tile, h))
+			data := buf.Data[:r.Dx()*r.Dy()]
+			if opts.DilateRadius > 0 {
+				dilate(mask.Data, w, h, opts.DilateRadius, r, data)
+			} else {
+				for y := r.Min.Y; y < r.Max.Y; y++ {
+					copy(data[(y-r.Min.Y)*r.Dx():], mask.Data[y*w+r.Min.X:y*w+r.Max.X])
+				}
+			}
+			comps = l.label(r, data, comps, border)
+		}
+	}
+
+	// Join the components of border pixels within reach of each other; the
+	// smallest index of a joined set is its root.
+	parent := make([]int, len(comps))
+	for i := range parent {
+		parent[i] = i
+	}
+	find := func(i int) int {
+		for parent[i] != i {
+			parent[i] = parent[parent[i]]
+			i = parent[i]
+		}
+		return i
+	}
+	for idx, c := range border {
+		x, y := idx%w, idx/w
+		for d := range l.dx {
+			nx, ny := x+l.dx[d], y+l.dy[d]
+			if nx < 0 || nx >= w || ny < 0 || ny >= h {
+				continue
+			}
+			if n, ok := border[ny*w+nx]; ok {
+				if a, b := find(c), find(n); a != b {
+					parent[max(a, b)] = min(a, b)
+				}
+			}
+		}
+	}
+
+	// Fold every component into its root, then order the roots like the
+	// single-pass labeling does.
+	joined := comps[:0]
+	for i, c := range comps {
+		root := find(i)
+		if root == i {
+			continue
+		}
+		r := &comps[root]
+		r.minX, r.minY = min(r.minX, c.minX), min(r.minY, c.minY)
+		r.maxX, r.maxY = max(r.maxX, c.maxX), max(r.maxY, c.maxY)
+		r.area += c.area
+		r.first = min(r.first, c.first)
+	}
+	for i, c := range comps {
+		if find(i) == i {
+			joined = append(joined, c)
+		}
+	}
+	slices.SortFunc(joined, func(p, q component) int { return cmp.Compare(p.first, q.first) })
+	return joined
+}
@@ -0,0 +1,25 @@
+//go:build !light_test_only
+
+package region
+
+import (
+	"math/rand/v2"
+	"reflect"
+	"testing"
+
+	"github.com/xshoji/go-img-diff/internal/core"
+)
+
+// TestExtract_TiledLargeMask labels a 5000x5000 mask in 1024 px tiles and
+// expects the regions of the single-pass labeling.
+func TestExtract_TiledLargeMask(t *testing.T) {
+	mask := randomMask(rand.New(rand.NewPCG(7, 7)), 5000, 5000, 3000)
+	opts := core.DefaultOptions().Region
+	want := Extract(mask, opts, testLogger())
+	opts.TileSize = 1024
+	got := Extract(mask, opts, testLogger())
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("tiled: %d regions, untiled %d; they differ", len(got), len(want))
+	}
+	t.Logf("%d regions", len(got))
+}
@@ -0,0 +1,68 @@
+package region
+
+import (
+	"fmt"
+	"image"
+	"math/rand/v2"
+	"reflect"
+	"testing"
+
+	"github.com/xshoji/go-img-diff/internal/core"
+)
+
+// randomMask scatters n blobs, thin lines and single pixels over a w x h
+// mask, so that many of them cross tile borders.
+func randomMask(rng *rand.Rand, w, h, n int) *core.Mask {
+	mask := core.NewMask(w, h)
+	for i := 0; i < n; i++ {
+		x, y := rng.IntN(w), rng.IntN(h)
+		switch rng.IntN(4) {
+		case 0:
+			mask.SetRect(image.Rect(x, y, x+1+rng.IntN(12), y+1+rng.IntN(12)))
+		case 1:
+			mask.SetRect(image.Rect(x, y, x+1+rng.IntN(min(w/2, 64)), y+1))
+		case 2:
+			for d := 0; d < 20; d++ {
+				mask.Set(x+d, y+d) // diagonal: 8-connected only
+			}
+		default:
+			mask.Set(x, y)
+		}
+	}
+	return mask
+}
+
+func TestExtract_TiledMatchesUntiled(t *testing.T) {
+	optionSets := []core.RegionOptions{
+		{MinArea: 1},
+		{MinArea: 4, Padding: 3},
+		{MinArea: 1, ConnectDistance: 4},
+		{MinArea: 2, DilateRadius: 2, MergeDistance: 2},
+		{MinArea: 1, DilateRadius: 1, ConnectDistance: 3, Padding: 2, MinSize: 8},
+	}
+	for seed := uint64(1); seed <= 4; seed++ {
+		mask := randomMask(rand.New(rand.NewPCG(seed, 9)), 97, 83, 25)
+		for i, opts := range optionSets {
+			want := Extract(mask, opts, testLogger())
+			for _, tile := range []int{1, 5, 16, 40, 96} {
+				t.Run(fmt.Sprintf("seed%d/opts%d/tile%d", seed, i, tile), func(t *testing.T) {
+					tiled := opts
+					tiled.TileSize = tile
+					if got := Extract(mask, tiled, testLogger()); !reflect.DeepEqual(got, want) {
+						t.Errorf("tiled regions = %v\nwant %v", got, want)
+					}
+				})
+			}
+		}
+	}
+}
+
+func TestExtract_TileLargerThanMask(t *testing.T) {
+	mask := randomMask(rand.New(rand.NewPCG(2, 2)), 40, 30, 10)
+	opts := core.RegionOptions{MinArea: 1}
+	want := Extract(mask, opts, testLogger())
+	opts.TileSize = 64
+	if got := Extract(mask, opts, testLogger()); !reflect.DeepEqual(got, want) {
+		t.Errorf("regions = %v, want %v", got, want)
+	}
+}
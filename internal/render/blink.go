@@ -0,0 +1,31 @@
+package render
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+
+	"github.com/xshoji/go-img-diff/internal/core"
+)
+
+// AlignedA resamples frame A into frame B's coordinate space using the row
+// alignment, so static content lines up with B. Pixels without a counterpart
+// in A are filled with a neutral gray.
+func AlignedA(a, b *core.Frame, rowAlign core.RowAlignment) *image.NRGBA {
+	out := image.NewNRGBA(image.Rect(0, 0, b.W, b.H))
+	draw.Draw(out, out.Bounds(), &image.Uniform{color.NRGBA{128, 128, 128, 255}}, image.Point{}, draw.Src)
+
+	for y := 0; y < b.H; y++ {
+		for x := 0; x < b.W; x++ {
+			srcY := rowAlign.SrcYAt(x, y)
+			srcX := x - rowAlign.DXAt(x, y)
+			if srcY < 0 || srcY >= a.H || srcX < 0 || srcX >= a.W {
+				continue
+			}
+			srcOff := srcY*a.Pix.Stride + srcX*4
+			dstOff := y*out.Stride + x*4
+			copy(out.Pix[dstOff:dstOff+4], a.Pix.Pix[srcOff:srcOff+4])
+		}
+	}
+	return out
+}
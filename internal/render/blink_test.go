@@ -0,0 +1,26 @@
+package render
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/xshoji/go-img-diff/internal/core"
+)
+
+func TestAlignedA_AppliesOffset(t *testing.T) {
+	imgA := solidImage(30, 30, color.NRGBA{0, 0, 0, 255})
+	imgA.SetNRGBA(10, 10, color.NRGBA{255, 255, 255, 255})
+	a := core.NewFrame(imgA)
+	b := core.NewFrame(image.NewNRGBA(image.Rect(0, 0, 30, 30)))
+
+	rowAlign := core.NewRowAlignment(b.W, b.H, 2, 3)
+	out := AlignedA(a, b, rowAlign)
+
+	if got := out.NRGBAAt(12, 13); got != (color.NRGBA{255, 255, 255, 255}) {
+		t.Errorf("expected marker at (12,13), got %v", got)
+	}
+	if got := out.NRGBAAt(0, 0); got != (color.NRGBA{128, 128, 128, 255}) {
+		t.Errorf("expected uncovered pixel to be neutral gray, got %v", got)
+	}
+}
@@ -0,0 +1,78 @@
+package render
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+
+	"github.com/xshoji/go-img-diff/internal/core"
+)
+
+// drawContour draws the polygons of a region's contour, moved by
+// style.Offset, with lines style.Thickness pixels wide, instead of its
+// bounding box. The fill of RegionDrawFill and the label keep to the box.
+func drawContour(dst draw.Image, rect image.Rectangle, contour *core.Contour, index int, style RegionStyle) {
+	r := rect.Add(style.Offset).Intersect(dst.Bounds())
+	if r.Empty() {
+		return
+	}
+	if style.Mode == RegionDrawFill && style.FillAlpha > 0 {
+		fill := style.Color
+		fill.A = uint8(math.Round(clampUnit(style.FillAlpha) * 255))
+		draw.Draw(dst, r, &image.Uniform{fill}, image.Point{}, draw.Over)
+	}
+	if style.Thickness > 0 {
+		for _, polygon := range contour.Polygons {
+			for i, p := range polygon {
+				q := polygon[(i+1)%len(polygon)]
+				drawLine(dst, p.Add(style.Offset), q.Add(style.Offset), style.Color, style.Thickness)
+			}
+		}
+	}
+	if style.Labels {
+		drawLabel(dst, r, index, style.Color)
+	}
+}
+
+// drawLine draws the segment p-q with Bresenham's algorithm, stamping a
+// square of width pixels centered on every point.
+func drawLine(dst draw.Image, p, q image.Point, c color.NRGBA, width int) {
+	src := &image.Uniform{c}
+	dx, dy := abs(q.X-p.X), -abs(q.Y-p.Y)
+	sx, sy := sign(q.X-p.X), sign(q.Y-p.Y)
+	e := dx + dy
+	for {
+		dot := image.Rect(p.X-(width-1)/2, p.Y-(width-1)/2, p.X+width/2+1, p.Y+width/2+1)
+		draw.Draw(dst, dot.Intersect(dst.Bounds()), src, image.Point{}, draw.Src)
+		if p == q {
+			return
+		}
+		e2 := 2 * e
+		if e2 >= dy {
+			e += dy
+			p.X += sx
+		}
+		if e2 <= dx {
+			e += dx
+			p.Y += sy
+		}
+	}
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+func sign(v int) int {
+	switch {
+	case v > 0:
+		return 1
+	case v < 0:
+		return -1
+	}
+	return 0
+}
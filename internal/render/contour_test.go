@@ -0,0 +1,71 @@
+package render
+
+import (
+	"image"
+	"image/color"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/xshoji/go-img-diff/internal/core"
+)
+
+func TestRender_Contour(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 60, 60))
+	fillImage(img, color.White)
+	frame := core.NewFrame(img)
+	// A right triangle in the lower left half of its box.
+	region := core.Region{
+		Bounds:  image.Rect(10, 10, 51, 51),
+		Contour: &core.Contour{Polygons: [][]image.Point{{{10, 10}, {50, 50}, {10, 50}}}},
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	white := [4]uint32{255, 255, 255, 255}
+	red := [4]uint32{255, 0, 0, 255}
+
+	opts := core.DefaultOptions().Render
+	opts.BorderWidth = 1
+	out := Render(frame, frame, core.NewMask(60, 60), []core.Region{region}, core.NewRowAlignment(60, 60, 0, 0), core.Alignment{}, opts, logger)
+
+	for _, p := range []image.Point{{10, 10}, {30, 30}, {50, 50}, {30, 50}, {10, 30}} {
+		if got := rgbaAt(out, p.X, p.Y); got != red {
+			t.Errorf("contour pixel %v = %v, want red", p, got)
+		}
+	}
+	// The box corner outside the triangle and the inside stay untouched.
+	for _, p := range []image.Point{{50, 10}, {30, 10}, {50, 30}, {20, 40}} {
+		if got := rgbaAt(out, p.X, p.Y); got != white {
+			t.Errorf("pixel %v off the contour = %v, want white", p, got)
+		}
+	}
+
+	// Thicker lines grow around the segments, and on A they move with the offset.
+	opts.BorderWidth = 3
+	out = RenderA(frame, []core.Region{region}, core.Alignment{DX: 2}, opts)
+	for _, p := range []image.Point{{8, 29}, {7, 30}, {9, 30}} {
+		if got := rgbaAt(out, p.X, p.Y); got != red {
+			t.Errorf("on A, contour pixel %v = %v, want red", p, got)
+		}
+	}
+	if got := rgbaAt(out, 11, 30); got != white {
+		t.Errorf("on A, pixel beyond the 3px line = %v, want white", got)
+	}
+}
+
+func TestDrawLine(t *testing.T) {
+	dst := image.NewNRGBA(image.Rect(0, 0, 10, 10))
+	c := color.NRGBA{0, 0, 255, 255}
+	drawLine(dst, image.Pt(1, 1), image.Pt(7, 4), c, 1)
+	n := 0
+	for y := 0; y < 10; y++ {
+		for x := 0; x < 10; x++ {
+			if dst.NRGBAAt(x, y) == c {
+				n++
+			}
+		}
+	}
+	// One pixel per step along the longer axis, both ends included.
+	if n != 7 || dst.NRGBAAt(1, 1) != c || dst.NRGBAAt(7, 4) != c {
+		t.Errorf("line has %d pixels, want 7 from (1,1) to (7,4)", n)
+	}
+}
@@ -0,0 +1,23 @@
+package render
+
+import (
+	"image"
+	"image/color"
+
+	"github.com/xshoji/go-img-diff/internal/core"
+)
+
+// gridMaxAlpha is the opacity of the shading of a cell whose pixels all
+// differ; cells without differences are left as they are.
+const gridMaxAlpha = 0.6
+
+// ShadeGrid blends c over every cell at an opacity proportional to its share
+// of differing pixels, up to gridMaxAlpha. The cells' origin is placed at
+// offset in dst.
+func ShadeGrid(dst *image.NRGBA, cells []core.GridCell, offset image.Point, c color.NRGBA) {
+	for _, cell := range cells {
+		if ratio := cell.Ratio(); ratio > 0 {
+			fillRegion(dst, cell.Bounds.Add(offset), c, gridMaxAlpha*ratio)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package render
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/xshoji/go-img-diff/internal/core"
+)
+
+func TestShadeGrid(t *testing.T) {
+	white := color.NRGBA{255, 255, 255, 255}
+	c := color.NRGBA{0, 0, 0, 255}
+	dst := image.NewNRGBA(image.Rect(0, 0, 20, 10))
+	fillImage(dst, white)
+	cells := []core.GridCell{
+		{Col: 0, Bounds: image.Rect(0, 0, 10, 10)},
+		{Col: 1, Bounds: image.Rect(10, 0, 20, 10), DiffPixels: 50},
+	}
+	ShadeGrid(dst, cells, image.Point{}, c)
+
+	if got := dst.NRGBAAt(5, 5); got != white {
+		t.Errorf("cell without differences is shaded: %v", got)
+	}
+	// Half of the cell differs: c at 0.3 opacity over white.
+	want := uint8(255 - 77)
+	if got := dst.NRGBAAt(15, 5); got.R < want-1 || got.R > want+1 || got.A != 255 {
+		t.Errorf("half-differing cell = %v, want about %d", got, want)
+	}
+
+	// The offset moves the shading with the canvas.
+	fillImage(dst, white)
+	ShadeGrid(dst, cells[1:], image.Pt(-10, 0), c)
+	if dst.NRGBAAt(5, 5) == white || dst.NRGBAAt(15, 5) != white {
+		t.Error("shading is not moved by the offset")
+	}
+}
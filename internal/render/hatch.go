@@ -0,0 +1,46 @@
+package render
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+
+	"github.com/xshoji/go-img-diff/internal/core"
+)
+
+// HatchSpacing is the distance in pixels between the diagonal hatch lines.
+const HatchSpacing = 6
+
+// HatchRects draws diagonal lines (running from bottom-left to top-right)
+// across each rectangle, clipped to dst. The pattern is anchored to the image
+// origin so adjacent rectangles join seamlessly.
+func HatchRects(dst draw.Image, rects []image.Rectangle, c color.NRGBA) {
+	for _, r := range rects {
+		r = r.Intersect(dst.Bounds())
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				if IsHatched(x, y) {
+					dst.Set(x, y, c)
+				}
+			}
+		}
+	}
+}
+
+// HatchMask draws the hatch pattern over the pixels set in mask, whose origin
+// is placed at offset in dst.
+func HatchMask(dst draw.Image, mask *core.Mask, offset image.Point, c color.NRGBA) {
+	r := image.Rect(0, 0, mask.W, mask.H).Add(offset).Intersect(dst.Bounds())
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			if IsHatched(x, y) && mask.Get(x-offset.X, y-offset.Y) {
+				dst.Set(x, y, c)
+			}
+		}
+	}
+}
+
+// IsHatched reports whether (x, y) lies on a hatch line.
+func IsHatched(x, y int) bool {
+	return ((x+y)%HatchSpacing+HatchSpacing)%HatchSpacing == 0
+}
@@ -0,0 +1,37 @@
+package render
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestHatchRects(t *testing.T) {
+	blue := color.NRGBA{0, 0, 255, 255}
+	white := color.NRGBA{255, 255, 255, 255}
+	dst := image.NewNRGBA(image.Rect(0, 0, 40, 30))
+	fillImage(dst, white)
+
+	band := image.Rect(0, 0, 40, 10)
+	HatchRects(dst, []image.Rectangle{band, image.Rect(35, 25, 60, 60)}, blue)
+
+	for y := 0; y < 30; y++ {
+		for x := 0; x < 40; x++ {
+			p := image.Pt(x, y)
+			inside := p.In(band) || p.In(image.Rect(35, 25, 40, 30))
+			want := white
+			if inside && (x+y)%HatchSpacing == 0 {
+				want = blue
+			}
+			if got := dst.NRGBAAt(x, y); got != want {
+				t.Fatalf("pixel %v = %v, want %v", p, got, want)
+			}
+		}
+	}
+
+	// Each row of the band has lines spaced HatchSpacing apart, shifting by
+	// one pixel per row, so the pattern is diagonal.
+	if dst.NRGBAAt(0, 0) != blue || dst.NRGBAAt(5, 1) != blue || dst.NRGBAAt(0, 1) != white {
+		t.Error("hatch lines are not diagonal")
+	}
+}
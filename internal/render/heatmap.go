@@ -0,0 +1,54 @@
+package render
+
+import (
+	"image"
+
+	"github.com/xshoji/go-img-diff/internal/core"
+	"github.com/xshoji/go-img-diff/internal/diff"
+)
+
+// heatmapOverlayOpacity is the opacity of the heatmap when composited over B.
+const heatmapOverlayOpacity = 0.5
+
+// RenderHeatmap maps the per-pixel difference between aligned A and B through
+// ramp. The difference is the one the diff mask compares against the
+// threshold (see diff.ForEachComparedPixel), scaled by the largest threshold
+// of the metric. Pixels without a counterpart row in A count as maximum
+// difference; ignored pixels and pixels outside A as none. When overlay is
+// set, the heatmap is composited at 50% opacity over frame B; otherwise the
+// raw ramp colors (including their alpha) are returned.
+func RenderHeatmap(a, b *core.Frame, rowAlign core.RowAlignment, diffOpts core.DiffOptions, ramp ColorRamp, overlay bool) *image.NRGBA {
+	level := make([]float64, b.W*b.H)
+	for y := 0; y < b.H; y++ {
+		for x := 0; x < b.W; x++ {
+			if rowAlign.SrcYAt(x, y) == -1 && !b.Ignored(x, y) {
+				level[y*b.W+x] = 1
+			}
+		}
+	}
+	scale := float64(diffOpts.Metric.MaxThreshold())
+	diff.ForEachComparedPixel(a, b, rowAlign, diffOpts, func(x, y, _, _ int, d float64) bool {
+		level[y*b.W+x] = min(1, d/scale)
+		return true
+	})
+
+	out := image.NewNRGBA(image.Rect(0, 0, b.W, b.H))
+	if overlay {
+		copy(out.Pix, b.Pix.Pix)
+	}
+	for y := 0; y < b.H; y++ {
+		for x := 0; x < b.W; x++ {
+			c := ramp.At(level[y*b.W+x])
+			dst := out.Pix[y*out.Stride+x*4 : y*out.Stride+x*4+4]
+			if !overlay {
+				dst[0], dst[1], dst[2], dst[3] = c.R, c.G, c.B, c.A
+				continue
+			}
+			alpha := float64(c.A) / 255 * heatmapOverlayOpacity
+			for i, v := range [3]uint8{c.R, c.G, c.B} {
+				dst[i] = uint8(float64(dst[i])*(1-alpha) + float64(v)*alpha + 0.5)
+			}
+		}
+	}
+	return out
+}
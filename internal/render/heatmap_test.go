@@ -0,0 +1,87 @@
+package render
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/xshoji/go-img-diff/internal/core"
+)
+
+func TestColorRamp_At(t *testing.T) {
+	ramp := ColorRamp{{0, 0, 0, 0}, {200, 100, 0, 255}, {255, 0, 0, 255}}
+
+	cases := []struct {
+		t    float64
+		want color.NRGBA
+	}{
+		{0, color.NRGBA{0, 0, 0, 0}},
+		{-1, color.NRGBA{0, 0, 0, 0}},
+		{0.25, color.NRGBA{100, 50, 0, 128}},
+		{0.5, color.NRGBA{200, 100, 0, 255}},
+		{0.75, color.NRGBA{228, 50, 0, 255}},
+		{1, color.NRGBA{255, 0, 0, 255}},
+		{2, color.NRGBA{255, 0, 0, 255}},
+	}
+	for _, c := range cases {
+		if got := ramp.At(c.t); got != c.want {
+			t.Errorf("At(%v) = %v, want %v", c.t, got, c.want)
+		}
+	}
+}
+
+func TestParseColorRamp(t *testing.T) {
+	ramp, err := ParseColorRamp("#0000ff00, ffff00,FF0000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ColorRamp{{0, 0, 255, 0}, {255, 255, 0, 255}, {255, 0, 0, 255}}
+	if len(ramp) != len(want) {
+		t.Fatalf("got %d stops, want %d", len(ramp), len(want))
+	}
+	for i := range want {
+		if ramp[i] != want[i] {
+			t.Errorf("stop %d = %v, want %v", i, ramp[i], want[i])
+		}
+	}
+
+	for _, bad := range []string{"ff0000", "ff0000,zz0000", "ff00,00ff00"} {
+		if _, err := ParseColorRamp(bad); err == nil {
+			t.Errorf("ParseColorRamp(%q) expected error", bad)
+		}
+	}
+}
+
+func TestRenderHeatmap(t *testing.T) {
+	imgA := image.NewNRGBA(image.Rect(0, 0, 4, 1))
+	imgB := image.NewNRGBA(image.Rect(0, 0, 4, 1))
+	fillImage(imgA, color.Black)
+	fillImage(imgB, color.Black)
+	imgB.SetNRGBA(1, 0, color.NRGBA{255, 255, 255, 255})
+	a, b := core.NewFrame(imgA), core.NewFrame(imgB)
+	ramp := DefaultHeatmapRamp()
+	rowAlign := core.NewRowAlignment(4, 1, 0, 0)
+
+	raw := RenderHeatmap(a, b, rowAlign, core.DiffOptions{}, ramp, false)
+	if got := raw.NRGBAAt(0, 0); got != ramp[0] {
+		t.Errorf("matching pixel = %v, want %v", got, ramp[0])
+	}
+	if got := raw.NRGBAAt(1, 0); got != ramp[2] {
+		t.Errorf("max-diff pixel = %v, want %v", got, ramp[2])
+	}
+
+	// Black to white is also the largest delta E.
+	perceptual := RenderHeatmap(a, b, rowAlign, core.DiffOptions{Metric: core.ColorMetricCIEDE2000}, ramp, false)
+	if got := perceptual.NRGBAAt(1, 0); got != ramp[2] {
+		t.Errorf("ciede2000 max-diff pixel = %v, want %v", got, ramp[2])
+	}
+
+	over := RenderHeatmap(a, b, rowAlign, core.DiffOptions{}, ramp, true)
+	if got := over.NRGBAAt(0, 0); got != (color.NRGBA{0, 0, 0, 255}) {
+		t.Errorf("overlay matching pixel = %v, want B unchanged", got)
+	}
+	// White B blended 50% with red.
+	if got := over.NRGBAAt(1, 0); got != (color.NRGBA{255, 128, 128, 255}) {
+		t.Errorf("overlay max-diff pixel = %v, want half red over white", got)
+	}
+}
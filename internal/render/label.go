@@ -0,0 +1,140 @@
+package render
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"strconv"
+	"unicode"
+)
+
+const (
+	glyphW       = 3
+	glyphH       = 5
+	glyphScale   = 2
+	glyphSpacing = 2
+	labelPadding = 2
+)
+
+// glyphs is a 3x5 bitmap font. Each row uses the low 3 bits (MSB = left).
+// Lowercase letters are drawn with their uppercase glyph; unknown runes are blank.
+var glyphs = map[rune][glyphH]uint8{
+	'0': {0b111, 0b101, 0b101, 0b101, 0b111},
+	'1': {0b010, 0b110, 0b010, 0b010, 0b111},
+	'2': {0b111, 0b001, 0b111, 0b100, 0b111},
+	'3': {0b111, 0b001, 0b111, 0b001, 0b111},
+	'4': {0b101, 0b101, 0b111, 0b001, 0b001},
+	'5': {0b111, 0b100, 0b111, 0b001, 0b111},
+	'6': {0b111, 0b100, 0b111, 0b101, 0b111},
+	'7': {0b111, 0b001, 0b001, 0b001, 0b001},
+	'8': {0b111, 0b101, 0b111, 0b101, 0b111},
+	'9': {0b111, 0b101, 0b111, 0b001, 0b111},
+	'A': {0b010, 0b101, 0b111, 0b101, 0b101},
+	'B': {0b110, 0b101, 0b110, 0b101, 0b110},
+	'C': {0b011, 0b100, 0b100, 0b100, 0b011},
+	'D': {0b110, 0b101, 0b101, 0b101, 0b110},
+	'E': {0b111, 0b100, 0b110, 0b100, 0b111},
+	'F': {0b111, 0b100, 0b110, 0b100, 0b100},
+	'G': {0b011, 0b100, 0b101, 0b101, 0b011},
+	'H': {0b101, 0b101, 0b111, 0b101, 0b101},
+	'I': {0b111, 0b010, 0b010, 0b010, 0b111},
+	'J': {0b001, 0b001, 0b001, 0b101, 0b010},
+	'K': {0b101, 0b101, 0b110, 0b101, 0b101},
+	'L': {0b100, 0b100, 0b100, 0b100, 0b111},
+	'M': {0b101, 0b111, 0b111, 0b101, 0b101},
+	'N': {0b110, 0b101, 0b101, 0b101, 0b101},
+	'O': {0b010, 0b101, 0b101, 0b101, 0b010},
+	'P': {0b110, 0b101, 0b110, 0b100, 0b100},
+	'Q': {0b010, 0b101, 0b101, 0b110, 0b011},
+	'R': {0b110, 0b101, 0b110, 0b101, 0b101},
+	'S': {0b011, 0b100, 0b010, 0b001, 0b110},
+	'T': {0b111, 0b010, 0b010, 0b010, 0b010},
+	'U': {0b101, 0b101, 0b101, 0b101, 0b111},
+	'V': {0b101, 0b101, 0b101, 0b101, 0b010},
+	'W': {0b101, 0b101, 0b111, 0b111, 0b101},
+	'X': {0b101, 0b101, 0b010, 0b101, 0b101},
+	'Y': {0b101, 0b101, 0b010, 0b010, 0b010},
+	'Z': {0b111, 0b001, 0b010, 0b100, 0b111},
+	'.': {0b000, 0b000, 0b000, 0b000, 0b010},
+	',': {0b000, 0b000, 0b000, 0b010, 0b100},
+	':': {0b000, 0b010, 0b000, 0b010, 0b000},
+	'-': {0b000, 0b000, 0b111, 0b000, 0b000},
+	'_': {0b000, 0b000, 0b000, 0b000, 0b111},
+	'/': {0b001, 0b001, 0b010, 0b100, 0b100},
+	'(': {0b001, 0b010, 0b010, 0b010, 0b001},
+	')': {0b100, 0b010, 0b010, 0b010, 0b100},
+	'%': {0b101, 0b001, 0b010, 0b100, 0b101},
+}
+
+// textSize returns the pixel size of text drawn with drawText.
+func textSize(text string) (int, int) {
+	n := len([]rune(text))
+	if n == 0 {
+		return 0, glyphH * glyphScale
+	}
+	return n*glyphW*glyphScale + (n-1)*glyphSpacing, glyphH * glyphScale
+}
+
+// drawText draws text with its top-left corner at (x, y), clipped to dst bounds.
+func drawText(dst draw.Image, x, y int, text string, fg color.Color) {
+	bounds := dst.Bounds()
+	src := &image.Uniform{fg}
+	for _, ch := range text {
+		glyph := glyphs[unicode.ToUpper(ch)]
+		for gy := 0; gy < glyphH; gy++ {
+			for gx := 0; gx < glyphW; gx++ {
+				if glyph[gy]&(1<<(glyphW-1-gx)) == 0 {
+					continue
+				}
+				cell := image.Rect(
+					x+gx*glyphScale, y+gy*glyphScale,
+					x+(gx+1)*glyphScale, y+(gy+1)*glyphScale,
+				).Intersect(bounds)
+				draw.Draw(dst, cell, src, image.Point{}, draw.Src)
+			}
+		}
+		x += glyphW*glyphScale + glyphSpacing
+	}
+}
+
+// labelSize returns the pixel size of the label box for the given text.
+func labelSize(text string) (int, int) {
+	w, h := textSize(text)
+	return w + 2*labelPadding, h + 2*labelPadding
+}
+
+// labelRect places the label above the top-left corner of the region, flipping
+// it inside the box when there is no room above and shifting it left at the
+// right edge so it always stays within bounds.
+func labelRect(region, bounds image.Rectangle, w, h int) image.Rectangle {
+	x := region.Min.X
+	y := region.Min.Y - h
+	if y < bounds.Min.Y {
+		y = region.Min.Y
+	}
+	if x+w > bounds.Max.X {
+		x = bounds.Max.X - w
+	}
+	x = max(x, bounds.Min.X)
+	return image.Rect(x, y, x+w, y+h)
+}
+
+// drawLabel draws the numeric region index on a filled background pill.
+func drawLabel(dst draw.Image, region image.Rectangle, index int, bg color.NRGBA) {
+	text := strconv.Itoa(index)
+	w, h := labelSize(text)
+	bounds := dst.Bounds()
+	lr := labelRect(region, bounds, w, h)
+
+	draw.Draw(dst, lr.Intersect(bounds), &image.Uniform{bg}, image.Point{}, draw.Src)
+	drawText(dst, lr.Min.X+labelPadding, lr.Min.Y+labelPadding, text, contrastColor(bg))
+}
+
+// contrastColor returns black or white, whichever reads better on bg.
+func contrastColor(bg color.NRGBA) color.NRGBA {
+	lum := (19595*uint32(bg.R) + 38470*uint32(bg.G) + 7471*uint32(bg.B) + 1<<15) >> 16
+	if lum > 140 {
+		return color.NRGBA{0, 0, 0, 255}
+	}
+	return color.NRGBA{255, 255, 255, 255}
+}
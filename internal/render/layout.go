@@ -32,3 +32,70 @@ func CombineHorizontal(left, right image.Image) *image.NRGBA {
 
 	return combined
 }
+
+// CompositeOptions configures RenderComposite.
+type CompositeOptions struct {
+	DividerWidth int
+	DividerColor color.NRGBA
+	Background   color.NRGBA // fills padding below shorter panels and the caption band
+	Captions     []string    // captions for the A, B and diff panels (nil or empty = no caption band)
+}
+
+// DefaultCompositeOptions returns a thin gray divider on a light neutral background.
+func DefaultCompositeOptions() CompositeOptions {
+	return CompositeOptions{
+		DividerWidth: 2,
+		DividerColor: color.NRGBA{128, 128, 128, 255},
+		Background:   color.NRGBA{240, 240, 240, 255},
+		Captions:     []string{"A", "B", "DIFF"},
+	}
+}
+
+const captionPadding = 4
+
+// RenderComposite places image A, image B and the annotated diff side by side,
+// separated by dividers. All panels share the height of the tallest image;
+// shorter panels are padded with the background color.
+func RenderComposite(imgA, imgB, diff image.Image, opts CompositeOptions) *image.NRGBA {
+	panels := []image.Image{imgA, imgB, diff}
+
+	panelH := 0
+	totalW := 2 * max(0, opts.DividerWidth)
+	for _, p := range panels {
+		panelH = max(panelH, p.Bounds().Dy())
+		totalW += p.Bounds().Dx()
+	}
+
+	captionH := 0
+	for _, c := range opts.Captions {
+		if c != "" {
+			_, th := textSize(c)
+			captionH = th + 2*captionPadding
+			break
+		}
+	}
+
+	composite := image.NewNRGBA(image.Rect(0, 0, totalW, captionH+panelH))
+	draw.Draw(composite, composite.Bounds(), &image.Uniform{opts.Background}, image.Point{}, draw.Src)
+
+	x := 0
+	for i, p := range panels {
+		pb := p.Bounds()
+		draw.Draw(composite, image.Rect(x, captionH, x+pb.Dx(), captionH+pb.Dy()), p, pb.Min, draw.Src)
+
+		if captionH > 0 && i < len(opts.Captions) && opts.Captions[i] != "" {
+			// Clip the caption to its own panel so long names don't spill over.
+			band := composite.SubImage(image.Rect(x, 0, x+pb.Dx(), captionH)).(*image.NRGBA)
+			drawText(band, x+captionPadding, captionPadding, opts.Captions[i], color.NRGBA{0, 0, 0, 255})
+		}
+
+		x += pb.Dx()
+		if i < len(panels)-1 && opts.DividerWidth > 0 {
+			divider := image.Rect(x, 0, x+opts.DividerWidth, composite.Bounds().Dy())
+			draw.Draw(composite, divider, &image.Uniform{opts.DividerColor}, image.Point{}, draw.Src)
+			x += opts.DividerWidth
+		}
+	}
+
+	return composite
+}
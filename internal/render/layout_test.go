@@ -0,0 +1,65 @@
+package render
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func solidImage(w, h int, c color.NRGBA) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	fillImage(img, c)
+	return img
+}
+
+func TestRenderComposite_Dimensions(t *testing.T) {
+	a := solidImage(30, 20, color.NRGBA{255, 0, 0, 255})
+	b := solidImage(40, 50, color.NRGBA{0, 255, 0, 255})
+	d := solidImage(40, 50, color.NRGBA{0, 0, 255, 255})
+
+	opts := DefaultCompositeOptions()
+	opts.Captions = nil
+	out := RenderComposite(a, b, d, opts)
+
+	if out.Bounds().Dx() != 30+40+40+2*opts.DividerWidth || out.Bounds().Dy() != 50 {
+		t.Fatalf("unexpected composite size %v", out.Bounds())
+	}
+}
+
+func TestRenderComposite_PanelPlacement(t *testing.T) {
+	a := solidImage(30, 20, color.NRGBA{255, 0, 0, 255})
+	b := solidImage(40, 50, color.NRGBA{0, 255, 0, 255})
+	d := solidImage(40, 50, color.NRGBA{0, 0, 255, 255})
+
+	opts := DefaultCompositeOptions()
+	out := RenderComposite(a, b, d, opts)
+
+	_, th := textSize("A")
+	captionH := th + 2*captionPadding
+	if out.Bounds().Dy() != captionH+50 {
+		t.Fatalf("expected caption band of %d px, got height %d", captionH, out.Bounds().Dy())
+	}
+
+	dw := opts.DividerWidth
+	checks := []struct {
+		name string
+		x, y int
+		want color.NRGBA
+	}{
+		{"panel A", 10, captionH + 10, color.NRGBA{255, 0, 0, 255}},
+		{"padding below A", 10, captionH + 40, opts.Background},
+		{"divider", 30, captionH + 10, opts.DividerColor},
+		{"panel B", 30 + dw + 20, captionH + 40, color.NRGBA{0, 255, 0, 255}},
+		{"panel diff", 30 + dw + 40 + dw + 20, captionH + 40, color.NRGBA{0, 0, 255, 255}},
+	}
+	for _, c := range checks {
+		if got := out.NRGBAAt(c.x, c.y); got != c.want {
+			t.Errorf("%s at (%d,%d) = %v, want %v", c.name, c.x, c.y, got, c.want)
+		}
+	}
+
+	// The caption "A" has a set top-center pixel.
+	if got := out.NRGBAAt(captionPadding+glyphScale, captionPadding); got != (color.NRGBA{0, 0, 0, 255}) {
+		t.Errorf("expected caption glyph pixel, got %v", got)
+	}
+}
@@ -0,0 +1,22 @@
+package render
+
+import (
+	"image"
+
+	"github.com/xshoji/go-img-diff/internal/core"
+)
+
+// MaskImage converts a diff mask to a grayscale image (white = differing pixel).
+func MaskImage(mask *core.Mask) *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, mask.W, mask.H))
+	for y := 0; y < mask.H; y++ {
+		row := mask.Data[y*mask.W : (y+1)*mask.W]
+		dst := img.Pix[y*img.Stride : y*img.Stride+mask.W]
+		for x, v := range row {
+			if v != 0 {
+				dst[x] = 255
+			}
+		}
+	}
+	return img
+}
@@ -0,0 +1,29 @@
+package render
+
+import (
+	"testing"
+
+	"github.com/xshoji/go-img-diff/internal/core"
+)
+
+func TestMaskImage(t *testing.T) {
+	mask := core.NewMask(4, 3)
+	mask.Set(0, 0)
+	mask.Set(3, 2)
+
+	img := MaskImage(mask)
+	if img.Bounds().Dx() != 4 || img.Bounds().Dy() != 3 {
+		t.Fatalf("unexpected size %v", img.Bounds())
+	}
+	for y := 0; y < 3; y++ {
+		for x := 0; x < 4; x++ {
+			want := uint8(0)
+			if mask.Get(x, y) {
+				want = 255
+			}
+			if got := img.GrayAt(x, y).Y; got != want {
+				t.Errorf("pixel (%d,%d) = %d, want %d", x, y, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package render
+
+import (
+	"encoding/hex"
+	"fmt"
+	"image/color"
+	"math"
+	"strings"
+)
+
+// ColorRamp is a color gradient with evenly spaced stops from t=0 to t=1.
+type ColorRamp []color.NRGBA
+
+// DefaultHeatmapRamp returns the heatmap gradient: transparent blue for
+// matching pixels, through yellow, to opaque red for maximum difference.
+func DefaultHeatmapRamp() ColorRamp {
+	return ColorRamp{
+		{0, 0, 255, 0},
+		{255, 255, 0, 255},
+		{255, 0, 0, 255},
+	}
+}
+
+// ParseColorRamp parses a comma-separated list of RRGGBB or RRGGBBAA hex
+// colors (an optional leading '#' is allowed) into a ColorRamp.
+func ParseColorRamp(s string) (ColorRamp, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("color ramp needs at least 2 colors, got %q", s)
+	}
+	ramp := make(ColorRamp, 0, len(parts))
+	for _, p := range parts {
+		c, err := parseHexColor(p)
+		if err != nil {
+			return nil, err
+		}
+		ramp = append(ramp, c)
+	}
+	return ramp, nil
+}
+
+// parseHexColor parses an RRGGBB or RRGGBBAA hex color with an optional
+// leading '#'.
+func parseHexColor(s string) (color.NRGBA, error) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "#")
+	if len(s) != 6 && len(s) != 8 {
+		return color.NRGBA{}, fmt.Errorf("invalid color %q: want RRGGBB or RRGGBBAA", s)
+	}
+	v, err := hex.DecodeString(s)
+	if err != nil {
+		return color.NRGBA{}, fmt.Errorf("invalid color %q: %w", s, err)
+	}
+	c := color.NRGBA{v[0], v[1], v[2], 255}
+	if len(v) == 4 {
+		c.A = v[3]
+	}
+	return c, nil
+}
+
+// At returns the interpolated color at t, clamped to [0, 1].
+func (r ColorRamp) At(t float64) color.NRGBA {
+	switch len(r) {
+	case 0:
+		return color.NRGBA{}
+	case 1:
+		return r[0]
+	}
+	t = clampUnit(t)
+	pos := t * float64(len(r)-1)
+	i := min(int(pos), len(r)-2)
+	f := pos - float64(i)
+	c0, c1 := r[i], r[i+1]
+	lerp := func(a, b uint8) uint8 {
+		return uint8(math.Round(float64(a) + (float64(b)-float64(a))*f))
+	}
+	return color.NRGBA{lerp(c0.R, c1.R), lerp(c0.G, c1.G), lerp(c0.B, c1.B), lerp(c0.A, c1.A)}
+}
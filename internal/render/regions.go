@@ -0,0 +1,114 @@
+package render
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+
+	"github.com/xshoji/go-img-diff/internal/core"
+)
+
+// RegionDrawMode selects how DrawRegions paints the inside of a region.
+type RegionDrawMode string
+
+const (
+	// RegionDrawOutline draws only the border and leaves the interior untouched.
+	RegionDrawOutline RegionDrawMode = "outline"
+	// RegionDrawFill draws the border and blends a translucent fill over the interior.
+	RegionDrawFill RegionDrawMode = "fill"
+)
+
+// RegionStyle bundles the visual settings used by DrawRegions.
+type RegionStyle struct {
+	Color     color.NRGBA
+	Thickness int            // border width in pixels (0=no border)
+	Mode      RegionDrawMode // outline (default) or fill
+	FillAlpha float64        // fill opacity for RegionDrawFill (0.0-1.0)
+	Labels    bool           // draw the 1-based region index next to each box
+	Scale     float64        // factor applied to region coordinates before drawing (0 or 1=unchanged)
+	Offset    image.Point    // added to region coordinates after scaling, e.g. to map B onto A
+}
+
+// DefaultRegionStyle returns the style used for the regular diff output.
+func DefaultRegionStyle() RegionStyle {
+	return RegionStyle{
+		Color:     color.NRGBA{255, 0, 0, 255},
+		Thickness: 3,
+		Mode:      RegionDrawOutline,
+		FillAlpha: 0.25,
+		Scale:     1,
+	}
+}
+
+// DrawRegions renders region annotations onto an arbitrary destination image.
+// Regions are given in source coordinates, multiplied by style.Scale and moved
+// by style.Offset, then clipped to dst bounds.
+func DrawRegions(dst draw.Image, regions []image.Rectangle, style RegionStyle) {
+	for i, rect := range regions {
+		drawRegion(dst, rect, i+1, style)
+	}
+}
+
+// drawRegion draws one region annotation labeled with index.
+func drawRegion(dst draw.Image, rect image.Rectangle, index int, style RegionStyle) {
+	r := scaleRect(rect, style.Scale).Add(style.Offset).Intersect(dst.Bounds())
+	if r.Empty() {
+		return
+	}
+	if style.Mode == RegionDrawFill && style.FillAlpha > 0 {
+		fill := style.Color
+		fill.A = uint8(math.Round(clampUnit(style.FillAlpha) * 255))
+		draw.Draw(dst, r, &image.Uniform{fill}, image.Point{}, draw.Over)
+	}
+	drawBorder(dst, r, style.Color, style.Thickness)
+	if style.Labels {
+		drawLabel(dst, r, index, style.Color)
+	}
+}
+
+// drawBorder draws a rectangular border of the given width and color.
+func drawBorder(dst draw.Image, r image.Rectangle, c color.NRGBA, width int) {
+	if width <= 0 {
+		return
+	}
+	src := &image.Uniform{c}
+	edges := [4]image.Rectangle{
+		image.Rect(r.Min.X, r.Min.Y, r.Max.X, min(r.Max.Y, r.Min.Y+width)),
+		image.Rect(r.Min.X, max(r.Min.Y, r.Max.Y-width), r.Max.X, r.Max.Y),
+		image.Rect(r.Min.X, r.Min.Y, min(r.Max.X, r.Min.X+width), r.Max.Y),
+		image.Rect(max(r.Min.X, r.Max.X-width), r.Min.Y, r.Max.X, r.Max.Y),
+	}
+	for _, e := range edges {
+		draw.Draw(dst, e, src, image.Point{}, draw.Src)
+	}
+}
+
+func scaleRect(r image.Rectangle, scale float64) image.Rectangle {
+	if scale <= 0 || scale == 1 {
+		return r
+	}
+	return image.Rect(
+		int(math.Floor(float64(r.Min.X)*scale)),
+		int(math.Floor(float64(r.Min.Y)*scale)),
+		int(math.Ceil(float64(r.Max.X)*scale)),
+		int(math.Ceil(float64(r.Max.Y)*scale)),
+	)
+}
+
+func clampUnit(v float64) float64 {
+	return math.Max(0, math.Min(1, v))
+}
+
+// CropRect returns the union of the bounds of regions grown by margin on every
+// side and clamped to bounds, or false if there are no regions.
+func CropRect(regions []core.Region, margin int, bounds image.Rectangle) (image.Rectangle, bool) {
+	if len(regions) == 0 {
+		return image.Rectangle{}, false
+	}
+	var union image.Rectangle
+	for _, r := range regions {
+		union = union.Union(r.Bounds)
+	}
+	return union.Inset(-max(0, margin)).Intersect(bounds), true
+}
@@ -0,0 +1,328 @@
+package render
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+	"log/slog"
+	"strconv"
+	"testing"
+
+	"github.com/xshoji/go-img-diff/internal/core"
+)
+
+func fillImage(img draw.Image, c color.Color) {
+	draw.Draw(img, img.Bounds(), &image.Uniform{c}, image.Point{}, draw.Src)
+}
+
+func rgbaAt(img image.Image, x, y int) [4]uint32 {
+	r, g, b, a := img.At(x, y).RGBA()
+	return [4]uint32{r >> 8, g >> 8, b >> 8, a >> 8}
+}
+
+func TestDrawRegions_Outline(t *testing.T) {
+	green := color.NRGBA{0, 255, 0, 255}
+	white := color.NRGBA{255, 255, 255, 255}
+	dsts := map[string]draw.Image{
+		"rgba":  image.NewRGBA(image.Rect(0, 0, 60, 60)),
+		"nrgba": image.NewNRGBA(image.Rect(0, 0, 60, 60)),
+	}
+
+	for name, dst := range dsts {
+		t.Run(name, func(t *testing.T) {
+			fillImage(dst, white)
+			style := DefaultRegionStyle()
+			style.Color = green
+			style.Thickness = 2
+			DrawRegions(dst, []image.Rectangle{image.Rect(10, 10, 40, 30)}, style)
+
+			want := [4]uint32{0, 255, 0, 255}
+			for _, p := range []image.Point{{10, 10}, {11, 11}, {39, 29}, {38, 20}, {25, 28}} {
+				if got := rgbaAt(dst, p.X, p.Y); got != want {
+					t.Errorf("border pixel %v = %v, want %v", p, got, want)
+				}
+			}
+			// Interior and exterior must be untouched.
+			for _, p := range []image.Point{{12, 12}, {25, 20}, {9, 9}, {40, 30}} {
+				if got := rgbaAt(dst, p.X, p.Y); got != [4]uint32{255, 255, 255, 255} {
+					t.Errorf("pixel %v = %v, want white", p, got)
+				}
+			}
+		})
+	}
+}
+
+func TestDrawRegions_Fill(t *testing.T) {
+	dst := image.NewRGBA(image.Rect(0, 0, 40, 40))
+	fillImage(dst, color.White)
+
+	style := DefaultRegionStyle()
+	style.Mode = RegionDrawFill
+	style.FillAlpha = 1.0
+	style.Color = color.NRGBA{0, 0, 255, 255}
+	DrawRegions(dst, []image.Rectangle{image.Rect(5, 5, 30, 30)}, style)
+
+	if got := rgbaAt(dst, 15, 15); got != [4]uint32{0, 0, 255, 255} {
+		t.Errorf("interior pixel = %v, want fully filled blue", got)
+	}
+	if got := rgbaAt(dst, 35, 35); got != [4]uint32{255, 255, 255, 255} {
+		t.Errorf("exterior pixel = %v, want white", got)
+	}
+}
+
+func TestDrawRegions_Scale(t *testing.T) {
+	dst := image.NewNRGBA(image.Rect(0, 0, 100, 100))
+	fillImage(dst, color.White)
+
+	style := DefaultRegionStyle()
+	style.Thickness = 1
+	style.Scale = 2
+	DrawRegions(dst, []image.Rectangle{image.Rect(10, 10, 20, 20)}, style)
+
+	red := [4]uint32{255, 0, 0, 255}
+	if got := rgbaAt(dst, 20, 20); got != red {
+		t.Errorf("scaled top-left corner = %v, want red", got)
+	}
+	if got := rgbaAt(dst, 39, 39); got != red {
+		t.Errorf("scaled bottom-right corner = %v, want red", got)
+	}
+	if got := rgbaAt(dst, 10, 10); got == red {
+		t.Error("unscaled corner should not be drawn")
+	}
+}
+
+func TestDrawRegions_ClipsToBounds(t *testing.T) {
+	dst := image.NewNRGBA(image.Rect(0, 0, 30, 30))
+	fillImage(dst, color.White)
+
+	style := DefaultRegionStyle()
+	style.Thickness = 1
+	DrawRegions(dst, []image.Rectangle{image.Rect(20, 20, 50, 50)}, style)
+
+	red := [4]uint32{255, 0, 0, 255}
+	if got := rgbaAt(dst, 29, 25); got != red {
+		t.Errorf("clipped right edge = %v, want red", got)
+	}
+	if got := rgbaAt(dst, 25, 29); got != red {
+		t.Errorf("clipped bottom edge = %v, want red", got)
+	}
+}
+
+func TestDrawRegions_Labels(t *testing.T) {
+	dst := image.NewNRGBA(image.Rect(0, 0, 80, 80))
+	fillImage(dst, color.White)
+
+	style := DefaultRegionStyle()
+	style.Labels = true
+	// Region touching the top edge: the label must flip inside the box.
+	DrawRegions(dst, []image.Rectangle{image.Rect(10, 0, 60, 40)}, style)
+
+	w, h := labelSize("1")
+	lr := labelRect(image.Rect(10, 0, 60, 40), dst.Bounds(), w, h)
+	if lr.Min.Y != 0 {
+		t.Fatalf("expected label flipped inside at y=0, got %v", lr)
+	}
+	// The padding area of the pill uses the region color.
+	if got := rgbaAt(dst, lr.Min.X+1, lr.Max.Y-1); got != [4]uint32{255, 0, 0, 255} {
+		t.Errorf("label background = %v, want red", got)
+	}
+	// The "1" glyph has its bottom bar set; red background yields white text.
+	if got := rgbaAt(dst, lr.Min.X+labelPadding, lr.Min.Y+labelPadding+4*glyphScale); got != [4]uint32{255, 255, 255, 255} {
+		t.Errorf("label glyph pixel = %v, want white", got)
+	}
+}
+
+func TestLabelRect_RightEdge(t *testing.T) {
+	bounds := image.Rect(0, 0, 50, 50)
+	lr := labelRect(image.Rect(45, 20, 50, 30), bounds, 10, 14)
+	if lr.Max.X > bounds.Max.X || lr.Min.Y != 6 {
+		t.Errorf("unexpected label rect %v", lr)
+	}
+}
+
+func TestRender_Labels(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 100, 60))
+	fillImage(img, color.White)
+	frame := core.NewFrame(img)
+	// The first region touches the top edge, the second the right edge.
+	regions := []core.Region{
+		{Bounds: image.Rect(10, 0, 40, 30)},
+		{Bounds: image.Rect(70, 30, 100, 55)},
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	red, white := [4]uint32{255, 0, 0, 255}, [4]uint32{255, 255, 255, 255}
+
+	for _, labels := range []bool{false, true} {
+		opts := core.DefaultOptions().Render
+		opts.Labels = labels
+		out := Render(frame, frame, core.NewMask(100, 60), regions, core.NewRowAlignment(100, 60, 0, 0), core.Alignment{}, opts, logger)
+
+		for i, r := range regions {
+			w, h := labelSize(strconv.Itoa(i + 1))
+			lr := labelRect(r.Bounds, out.Bounds(), w, h)
+			if !lr.In(out.Bounds()) {
+				t.Fatalf("label %d at %v is outside the image", i+1, lr)
+			}
+			// The bottom right corner of the pill is background, off the border.
+			want := white
+			if labels {
+				want = red
+			}
+			p := image.Pt(lr.Max.X-1, lr.Max.Y-1)
+			if got := rgbaAt(out, p.X, p.Y); got != want {
+				t.Errorf("labels=%v: label %d background at %v = %v, want %v", labels, i+1, p, got, want)
+			}
+		}
+	}
+}
+
+func TestRender_BorderColorAndThickness(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 60, 60))
+	fillImage(img, color.White)
+	frame := core.NewFrame(img)
+	region := core.Region{Bounds: image.Rect(10, 10, 50, 50)}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	white := [4]uint32{255, 255, 255, 255}
+
+	tests := []struct {
+		name      string
+		color     color.NRGBA
+		thickness int
+	}{
+		{"default red", color.NRGBA{255, 0, 0, 255}, 3},
+		{"green 5px", color.NRGBA{0, 255, 0, 255}, 5},
+		{"blue 1px", color.NRGBA{0, 0, 255, 255}, 1},
+		{"no border", color.NRGBA{255, 0, 0, 255}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := core.DefaultOptions().Render
+			opts.BorderColor, opts.BorderWidth = tt.color, tt.thickness
+			out := Render(frame, frame, core.NewMask(60, 60), []core.Region{region}, core.NewRowAlignment(60, 60, 0, 0), core.Alignment{}, opts, logger)
+
+			border := [4]uint32{uint32(tt.color.R), uint32(tt.color.G), uint32(tt.color.B), 255}
+			// Walk inwards from each edge along the middle of the box.
+			for _, edge := range []struct {
+				start, step image.Point
+			}{
+				{image.Pt(10, 30), image.Pt(1, 0)},
+				{image.Pt(49, 30), image.Pt(-1, 0)},
+				{image.Pt(30, 10), image.Pt(0, 1)},
+				{image.Pt(30, 49), image.Pt(0, -1)},
+			} {
+				p := edge.start
+				for i := 0; i < tt.thickness; i++ {
+					if got := rgbaAt(out, p.X, p.Y); got != border {
+						t.Errorf("border pixel %v = %v, want %v", p, got, border)
+					}
+					p = p.Add(edge.step)
+				}
+				if got := rgbaAt(out, p.X, p.Y); got != white {
+					t.Errorf("pixel %v inside the %dpx border = %v, want white", p, tt.thickness, got)
+				}
+			}
+			if got := rgbaAt(out, 9, 30); got != white {
+				t.Errorf("pixel outside the box = %v, want white", got)
+			}
+		})
+	}
+}
+
+func TestRender_Styles(t *testing.T) {
+	a := image.NewNRGBA(image.Rect(0, 0, 60, 60))
+	fillImage(a, color.NRGBA{0, 0, 0, 255})
+	b := image.NewNRGBA(image.Rect(0, 0, 60, 60))
+	fillImage(b, color.White)
+	mask := core.NewMask(60, 60)
+	mask.SetRect(image.Rect(20, 20, 40, 40))
+	region := core.Region{Bounds: image.Rect(15, 15, 45, 45), Area: 400}
+	inside := image.Rect(18, 18, 42, 42) // within the 3px border
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	white := [4]uint32{255, 255, 255, 255}
+
+	render := func(style core.RenderStyle) *image.NRGBA {
+		opts := core.DefaultOptions().Render
+		opts.Style, opts.FillAlpha, opts.TintColor = style, 0.5, color.NRGBA{0, 0, 255, 255}
+		return Render(core.NewFrame(a), core.NewFrame(b), mask, []core.Region{region}, core.NewRowAlignment(60, 60, 0, 0), core.Alignment{}, opts, logger)
+	}
+
+	t.Run("outline", func(t *testing.T) {
+		out := render(core.RenderStyleOutline)
+		for y := inside.Min.Y; y < inside.Max.Y; y++ {
+			for x := inside.Min.X; x < inside.Max.X; x++ {
+				if got := rgbaAt(out, x, y); got != white {
+					t.Fatalf("interior pixel (%d,%d) = %v, want untouched white", x, y, got)
+				}
+			}
+		}
+		if got := rgbaAt(out, 15, 30); got != [4]uint32{255, 0, 0, 255} {
+			t.Errorf("border pixel = %v, want red", got)
+		}
+	})
+
+	t.Run("fill", func(t *testing.T) {
+		out := render(core.RenderStyleFill)
+		want := rgbaAt(out, inside.Min.X, inside.Min.Y)
+		if want[2] != 255 || want[0] < 126 || want[0] > 128 {
+			t.Fatalf("fill = %v, want white half tinted blue", want)
+		}
+		for y := inside.Min.Y; y < inside.Max.Y; y++ {
+			for x := inside.Min.X; x < inside.Max.X; x++ {
+				if got := rgbaAt(out, x, y); got != want {
+					t.Fatalf("interior pixel (%d,%d) = %v, want %v like the rest of the region", x, y, got, want)
+				}
+			}
+		}
+		if got := rgbaAt(out, 10, 10); got != white {
+			t.Errorf("pixel outside the region = %v, want white", got)
+		}
+	})
+
+	t.Run("overlay", func(t *testing.T) {
+		out := render(core.RenderStyleOverlay)
+		if got := rgbaAt(out, 18, 18); got != white {
+			t.Errorf("interior pixel without a diff = %v, want white", got)
+		}
+		if got := rgbaAt(out, 30, 30); got == white {
+			t.Errorf("diff pixel = %v, want the overlay of A", got)
+		}
+	})
+}
+
+func TestRenderA_MapsRegionsThroughInverseOffset(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 200, 200))
+	fillImage(img, color.White)
+	a := core.NewFrame(img)
+	// In B coordinates: one region at (100,100) and one at the edge that A
+	// only partly covers under the offset.
+	regions := []core.Region{
+		{Bounds: image.Rect(100, 100, 130, 120)},
+		{Bounds: image.Rect(2, 150, 20, 170)},
+	}
+	al := core.Alignment{DX: 7, DY: -4}
+	red, white := [4]uint32{255, 0, 0, 255}, [4]uint32{255, 255, 255, 255}
+
+	out := RenderA(a, regions, al, core.DefaultOptions().Render)
+	if out.Bounds() != a.Pix.Bounds() {
+		t.Fatalf("bounds = %v, want those of A", out.Bounds())
+	}
+	for _, c := range []struct {
+		p    image.Point
+		want [4]uint32
+	}{
+		{image.Pt(100-7, 100+4), red},       // top-left corner of the first region
+		{image.Pt(129-7, 119+4), red},       // bottom-right corner
+		{image.Pt(100, 100), white},         // where it is in B
+		{image.Pt(100-7+3, 100+4+3), white}, // inside the 3px border
+		{image.Pt(0, 160), red},             // clipped second region: left edge at x=0
+		{image.Pt(12, 160), red},            // its right edge
+	} {
+		if got := rgbaAt(out, c.p.X, c.p.Y); got != c.want {
+			t.Errorf("pixel %v = %v, want %v", c.p, got, c.want)
+		}
+	}
+	if got := rgbaAt(img, 93, 104); got != white {
+		t.Errorf("A was modified: %v", got)
+	}
+}
@@ -5,110 +5,167 @@ import (
 	"image/color"
 	"image/draw"
 	"log/slog"
+	"math"
 
 	"github.com/xshoji/go-img-diff/internal/core"
 )
 
 // Render creates the diff visualization image.
-// Base: frame B. Overlay: aligned pixels from A with tint on diff pixels. Borders: around regions.
-func Render(a, b *core.Frame, mask *core.Mask, regions []core.Region, rowAlign core.RowAlignment, opts core.RenderOptions, logger *slog.Logger) *image.NRGBA {
+// Base: frame B, or frame A with opts.Base RenderBaseA. Inside each region,
+// by opts.Style: the aligned pixels of the other frame with tint on diff
+// pixels (overlay), a translucent tint over the whole region (fill) or
+// nothing (outline). Borders: around regions.
+//
+// On frame A the regions are moved by the inverse of al, like in RenderA;
+// the overlaid pixels follow the per-row offsets of rowAlign. The canvas comes
+// from opts.Workspace.
+func Render(a, b *core.Frame, mask *core.Mask, regions []core.Region, rowAlign core.RowAlignment, al core.Alignment, opts core.RenderOptions, logger *slog.Logger) *image.NRGBA {
 	w := max(a.W, b.W)
 	h := max(a.H, b.H)
-	result := image.NewNRGBA(image.Rect(0, 0, w, h))
+	result := opts.Workspace.Image(image.Rect(0, 0, w, h))
 
-	// Draw frame B as base
-	draw.Draw(result, image.Rect(0, 0, b.W, b.H), b.Pix, image.Point{}, draw.Src)
+	// Draw the base frame
+	base, onA := b, opts.Base == core.RenderBaseA
+	if onA {
+		base = a
+	}
+	draw.Draw(result, image.Rect(0, 0, base.W, base.H), base.Pix, image.Point{}, draw.Src)
+	shift := opts.BaseShift(al)
 
-	// Apply overlay on diff pixels only
-	if opts.DrawOverlay {
-		for _, region := range regions {
-			r := region.Bounds
-			bw := opts.BorderWidth
-			// Only overlay inside the border area
-			innerMinX := r.Min.X + bw
-			innerMinY := r.Min.Y + bw
-			innerMaxX := r.Max.X - bw
-			innerMaxY := r.Max.Y - bw
-
-			for y := innerMinY; y < innerMaxY; y++ {
-				for x := innerMinX; x < innerMaxX; x++ {
-					if x < 0 || x >= w || y < 0 || y >= h {
-						continue
-					}
-
-					// Only overlay on actual diff pixels from the mask
-					if !mask.Get(x, y) {
-						continue
-					}
-
-					// Source pixel from A (aligned)
-					srcY := rowAlign.SrcYAt(x, y)
-					if srcY == -1 {
-						continue
-					}
-					dx := rowAlign.DXAt(x, y)
-					srcX := x - dx
-					if srcX < 0 || srcX >= a.W || srcY < 0 || srcY >= a.H {
-						continue
-					}
-
-					dstColor := result.NRGBAAt(x, y)
-					srcColor := a.Pix.NRGBAAt(srcX, srcY)
-
-					blended := core.BlendColors(
-						dstColor, srcColor,
-						opts.OverlayAlpha,
-						opts.TintColor,
-						opts.TintEnabled,
-						opts.TintStrength,
-						opts.TintTransparency,
-					)
-					result.SetNRGBA(x, y, blended)
-				}
+	// Paint the inside of each region according to the render style
+	for _, region := range regions {
+		bw := opts.BorderWidth
+		tintEnabled, tintStrength := opts.TintEnabled, opts.TintStrength
+		if s, ok := opts.SeverityStyle(region.Severity); ok {
+			bw = s.BorderWidth
+			tintEnabled, tintStrength = s.TintStrength > 0, s.TintStrength
+		}
+		switch opts.Style {
+		case core.RenderStyleOutline:
+			// Border only: the inside keeps the pixels of the base.
+		case core.RenderStyleFill:
+			fillRegion(result, region.Bounds.Add(shift), opts.TintColor, opts.FillAlpha)
+		default:
+			if opts.DrawOverlay {
+				overlayRegion(result, a, b, mask, region.Bounds.Inset(bw), rowAlign, onA, opts, tintEnabled, tintStrength)
 			}
 		}
 	}
 
 	// Draw borders around regions
-	for _, region := range regions {
-		drawBorder(result, region.Bounds, opts.BorderColor, opts.BorderWidth)
-	}
+	drawRegionBorders(result, regions, shift, opts)
 
 	logger.Info("render complete", "regions", len(regions), "size", [2]int{w, h})
 	return result
 }
 
-// drawBorder draws a rectangular border of the given width and color.
-func drawBorder(img *image.NRGBA, rect image.Rectangle, c color.NRGBA, width int) {
-	bounds := img.Bounds()
-
-	// Clamp rect to image bounds
-	r := rect.Intersect(bounds)
-	if r.Empty() {
-		return
+// RenderA annotates a copy of frame A with the regions found in B coordinates,
+// moved by the inverse of offset al and clipped to A: the same borders, labels
+// and, with RenderStyleFill, fills as Render draws. Regions are numbered as in
+// Render. Per-row offsets of a vertical alignment are not applied.
+func RenderA(a *core.Frame, regions []core.Region, al core.Alignment, opts core.RenderOptions) *image.NRGBA {
+	result := image.NewNRGBA(image.Rect(0, 0, a.W, a.H))
+	draw.Draw(result, result.Bounds(), a.Pix, image.Point{}, draw.Src)
+	offset := image.Pt(-al.DX, -al.DY)
+	if opts.Style == core.RenderStyleFill {
+		for _, region := range regions {
+			fillRegion(result, region.Bounds.Add(offset), opts.TintColor, opts.FillAlpha)
+		}
 	}
+	drawRegionBorders(result, regions, offset, opts)
+	return result
+}
 
-	// Top and bottom edges
-	for x := r.Min.X; x < r.Max.X; x++ {
-		for i := 0; i < width; i++ {
-			if y := r.Min.Y + i; y < r.Max.Y && y < bounds.Max.Y {
-				img.SetNRGBA(x, y, c)
-			}
-			if y := r.Max.Y - 1 - i; y >= r.Min.Y && y >= bounds.Min.Y {
-				img.SetNRGBA(x, y, c)
-			}
+// drawRegionBorders draws the border, or contour if traced, and label if
+// enabled, of each region moved by offset, in the style of its severity band.
+func drawRegionBorders(dst draw.Image, regions []core.Region, offset image.Point, opts core.RenderOptions) {
+	for i, region := range regions {
+		style := severityRegionStyle(opts, region.Severity)
+		style.Offset = offset
+		if region.Contour != nil {
+			drawContour(dst, region.Bounds, region.Contour, i+1, style)
+			continue
 		}
+		drawRegion(dst, region.Bounds, i+1, style)
 	}
+}
 
-	// Left and right edges
+// overlayRegion blends the aligned pixels of A, tinted, over the diff pixels
+// of mask inside r, given in B coordinates. With onA, dst is drawn on A and
+// the pixels of B are blended over their aligned positions instead.
+func overlayRegion(dst *image.NRGBA, a, b *core.Frame, mask *core.Mask, r image.Rectangle, rowAlign core.RowAlignment, onA bool, opts core.RenderOptions, tintEnabled bool, tintStrength float64) {
+	r = r.Intersect(dst.Bounds()).Intersect(image.Rect(0, 0, b.W, b.H))
 	for y := r.Min.Y; y < r.Max.Y; y++ {
-		for i := 0; i < width; i++ {
-			if x := r.Min.X + i; x < r.Max.X && x < bounds.Max.X {
-				img.SetNRGBA(x, y, c)
+		for x := r.Min.X; x < r.Max.X; x++ {
+			// Only overlay on actual diff pixels from the mask
+			if !mask.Get(x, y) {
+				continue
 			}
-			if x := r.Max.X - 1 - i; x >= r.Min.X && x >= bounds.Min.X {
-				img.SetNRGBA(x, y, c)
+
+			// Source pixel from A (aligned)
+			srcY := rowAlign.SrcYAt(x, y)
+			if srcY == -1 {
+				continue
 			}
+			srcX := x - rowAlign.DXAt(x, y)
+			if srcX < 0 || srcX >= a.W || srcY < 0 || srcY >= a.H {
+				continue
+			}
+
+			dx, dy, src := x, y, a.Pix.NRGBAAt(srcX, srcY)
+			if onA {
+				dx, dy, src = srcX, srcY, b.Pix.NRGBAAt(x, y)
+			}
+			blended := core.BlendColors(
+				dst.NRGBAAt(dx, dy), src,
+				opts.OverlayAlpha,
+				opts.TintColor,
+				tintEnabled,
+				tintStrength,
+				opts.TintTransparency,
+			)
+			dst.SetNRGBA(dx, dy, blended)
 		}
 	}
 }
+
+// fillRegion blends c at opacity alpha (0.0-1.0) over every pixel of r.
+func fillRegion(dst *image.NRGBA, r image.Rectangle, c color.NRGBA, alpha float64) {
+	c.A = uint8(math.Round(clampUnit(alpha) * 255))
+	draw.Draw(dst, r.Intersect(dst.Bounds()), &image.Uniform{c}, image.Point{}, draw.Over)
+}
+
+// RegionRects returns the bounding boxes of the given regions.
+func RegionRects(regions []core.Region) []image.Rectangle {
+	rects := make([]image.Rectangle, len(regions))
+	for i, r := range regions {
+		rects[i] = r.Bounds
+	}
+	return rects
+}
+
+func regionStyle(opts core.RenderOptions) RegionStyle {
+	style := DefaultRegionStyle()
+	style.Color = opts.BorderColor
+	style.Thickness = opts.BorderWidth
+	style.Labels = opts.Labels
+	return style
+}
+
+// severityRegionStyle returns the style of the severity band of a region, or
+// the regular style if no band applies.
+func severityRegionStyle(opts core.RenderOptions, severity float64) RegionStyle {
+	s, ok := opts.SeverityStyle(severity)
+	if !ok {
+		return regionStyle(opts)
+	}
+	style := DefaultRegionStyle()
+	style.Color = s.BorderColor
+	style.Thickness = s.BorderWidth
+	if s.Fill {
+		style.Mode = RegionDrawFill
+		style.FillAlpha = s.FillAlpha
+	}
+	style.Labels = s.Label || opts.Labels
+	return style
+}
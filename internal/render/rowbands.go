@@ -0,0 +1,40 @@
+package render
+
+import (
+	"image"
+
+	"github.com/xshoji/go-img-diff/internal/core"
+)
+
+// rowBandMarker is the height in pixels of the line marking where rows of the
+// other image are missing.
+const rowBandMarker = 2
+
+// DrawRowBands marks the row bands of a scroll detection across the width of
+// dst, which shows B or, with opts.Base RenderBaseA, A. Inserted rows (only
+// in B) are drawn in opts.InsertedColor and deleted rows (only in A) in
+// opts.DeletedColor: filled at opts.FillAlpha and outlined when dst shows
+// them, and as a line where they are missing otherwise. Pixel differences
+// keep their own colors, so the two read apart.
+func DrawRowBands(dst *image.NRGBA, bands []core.RowBand, opts core.RenderOptions) {
+	w := dst.Bounds().Dx()
+	onA := opts.Base == core.RenderBaseA
+	for _, band := range bands {
+		y0, y1, c := band.Y0, band.Y1, opts.InsertedColor
+		if band.Kind == core.RowBandDeleted {
+			c = opts.DeletedColor
+		}
+		if onA {
+			y0, y1 = band.SrcY0, band.SrcY1
+		}
+		if y0 == y1 {
+			// The rows are in the other image: mark where they would be.
+			marker := image.Rect(0, y0-rowBandMarker/2, w, y0+(rowBandMarker+1)/2)
+			fillRegion(dst, marker, c, 1)
+			continue
+		}
+		r := image.Rect(0, y0, w, y1)
+		fillRegion(dst, r, c, opts.FillAlpha)
+		drawBorder(dst, r.Intersect(dst.Bounds()), c, 1)
+	}
+}
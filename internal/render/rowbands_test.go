@@ -0,0 +1,53 @@
+package render
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/xshoji/go-img-diff/internal/core"
+)
+
+func TestDrawRowBands(t *testing.T) {
+	white := color.NRGBA{255, 255, 255, 255}
+	opts := core.DefaultOptions().Render
+	opts.FillAlpha = 1
+	bands := []core.RowBand{
+		{Kind: core.RowBandInserted, Y0: 4, Y1: 8, SrcY0: 4, SrcY1: 4},
+		{Kind: core.RowBandDeleted, Y0: 20, Y1: 20, SrcY0: 16, SrcY1: 22},
+	}
+
+	// On B the inserted rows are filled and the deleted ones marked by a line.
+	dst := image.NewNRGBA(image.Rect(0, 0, 30, 30))
+	fillImage(dst, white)
+	DrawRowBands(dst, bands, opts)
+	for _, tt := range []struct {
+		y    int
+		want color.NRGBA
+	}{
+		{3, white}, {4, opts.InsertedColor}, {6, opts.InsertedColor}, {7, opts.InsertedColor}, {8, white},
+		{18, white}, {19, opts.DeletedColor}, {20, opts.DeletedColor}, {21, white},
+	} {
+		for _, x := range []int{0, 15, 29} {
+			if got := dst.NRGBAAt(x, tt.y); got != tt.want {
+				t.Errorf("on B, pixel (%d,%d) = %v, want %v", x, tt.y, got, tt.want)
+			}
+		}
+	}
+
+	// On A it is the other way round, at the rows of A.
+	opts.Base = core.RenderBaseA
+	fillImage(dst, white)
+	DrawRowBands(dst, bands, opts)
+	for _, tt := range []struct {
+		y    int
+		want color.NRGBA
+	}{
+		{2, white}, {3, opts.InsertedColor}, {4, opts.InsertedColor}, {5, white},
+		{15, white}, {16, opts.DeletedColor}, {21, opts.DeletedColor}, {22, white},
+	} {
+		if got := dst.NRGBAAt(10, tt.y); got != tt.want {
+			t.Errorf("on A, pixel (10,%d) = %v, want %v", tt.y, got, tt.want)
+		}
+	}
+}
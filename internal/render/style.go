@@ -0,0 +1,110 @@
+package render
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/xshoji/go-img-diff/internal/core"
+)
+
+// styleSheet is the JSON form of a list of severity bands, e.g.
+//
+//	{"bands": [
+//	  {"min_severity": 0, "color": "ffff00", "thickness": 1},
+//	  {"min_severity": 0.6, "color": "ff0000", "thickness": 5, "tint_strength": 0.5, "label": true}
+//	]}
+type styleSheet struct {
+	Bands []styleBand `json:"bands"`
+}
+
+type styleBand struct {
+	MinSeverity  float64  `json:"min_severity"`
+	Color        string   `json:"color"`      // RRGGBB or RRGGBBAA (default ff0000)
+	Thickness    *int     `json:"thickness"`  // border width (default 3)
+	Style        string   `json:"style"`      // "outline" (default) or "fill"
+	FillAlpha    *float64 `json:"fill_alpha"` // fill opacity for "fill" (default 0.25)
+	TintStrength float64  `json:"tint_strength"`
+	Label        bool     `json:"label"`
+}
+
+// ParseStyleSheet decodes a JSON style sheet into severity styles sorted by
+// MinSeverity. Unknown fields, invalid values and duplicate bands are errors.
+func ParseStyleSheet(r io.Reader) ([]core.SeverityStyle, error) {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	var sheet styleSheet
+	if err := dec.Decode(&sheet); err != nil {
+		return nil, fmt.Errorf("failed to parse style sheet: %w", err)
+	}
+	if len(sheet.Bands) == 0 {
+		return nil, fmt.Errorf("style sheet has no bands")
+	}
+
+	defaults := DefaultRegionStyle()
+	styles := make([]core.SeverityStyle, 0, len(sheet.Bands))
+	for i, b := range sheet.Bands {
+		if b.MinSeverity < 0 || b.MinSeverity > 1 {
+			return nil, fmt.Errorf("band %d: min_severity %v is outside 0.0-1.0", i+1, b.MinSeverity)
+		}
+		s := core.SeverityStyle{
+			MinSeverity:  b.MinSeverity,
+			BorderColor:  defaults.Color,
+			BorderWidth:  defaults.Thickness,
+			FillAlpha:    defaults.FillAlpha,
+			TintStrength: b.TintStrength,
+			Label:        b.Label,
+		}
+		if b.Color != "" {
+			c, err := parseHexColor(b.Color)
+			if err != nil {
+				return nil, fmt.Errorf("band %d: %w", i+1, err)
+			}
+			s.BorderColor = c
+		}
+		if b.Thickness != nil {
+			if *b.Thickness < 0 {
+				return nil, fmt.Errorf("band %d: thickness must not be negative", i+1)
+			}
+			s.BorderWidth = *b.Thickness
+		}
+		switch RegionDrawMode(b.Style) {
+		case "", RegionDrawOutline:
+		case RegionDrawFill:
+			s.Fill = true
+		default:
+			return nil, fmt.Errorf("band %d: invalid style %q (want %q or %q)", i+1, b.Style, RegionDrawOutline, RegionDrawFill)
+		}
+		if b.FillAlpha != nil {
+			s.FillAlpha = clampUnit(*b.FillAlpha)
+		}
+		if b.TintStrength < 0 || b.TintStrength > 1 {
+			return nil, fmt.Errorf("band %d: tint_strength %v is outside 0.0-1.0", i+1, b.TintStrength)
+		}
+		styles = append(styles, s)
+	}
+
+	sort.SliceStable(styles, func(i, j int) bool { return styles[i].MinSeverity < styles[j].MinSeverity })
+	for i := 1; i < len(styles); i++ {
+		if styles[i].MinSeverity == styles[i-1].MinSeverity {
+			return nil, fmt.Errorf("two bands start at min_severity %v", styles[i].MinSeverity)
+		}
+	}
+	return styles, nil
+}
+
+// LoadStyleSheet reads a style sheet from path (see ParseStyleSheet).
+func LoadStyleSheet(path string) ([]core.SeverityStyle, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read style sheet %s: %w", path, err)
+	}
+	defer f.Close()
+	styles, err := ParseStyleSheet(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return styles, nil
+}
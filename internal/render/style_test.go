@@ -0,0 +1,105 @@
+package render
+
+import (
+	"image"
+	"image/color"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/xshoji/go-img-diff/internal/core"
+)
+
+const twoBandStyleSheet = `{"bands": [
+	{"min_severity": 0.6, "color": "ff0000", "thickness": 4, "tint_strength": 0.5, "label": true},
+	{"min_severity": 0, "color": "ffff00", "thickness": 1}
+]}`
+
+func TestParseStyleSheet(t *testing.T) {
+	styles, err := ParseStyleSheet(strings.NewReader(twoBandStyleSheet))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []core.SeverityStyle{
+		{MinSeverity: 0, BorderColor: color.NRGBA{255, 255, 0, 255}, BorderWidth: 1, FillAlpha: 0.25},
+		{MinSeverity: 0.6, BorderColor: color.NRGBA{255, 0, 0, 255}, BorderWidth: 4, FillAlpha: 0.25, TintStrength: 0.5, Label: true},
+	}
+	if len(styles) != len(want) {
+		t.Fatalf("styles %+v, want %+v", styles, want)
+	}
+	for i := range want {
+		if styles[i] != want[i] {
+			t.Errorf("band %d = %+v, want %+v", i, styles[i], want[i])
+		}
+	}
+
+	for _, bad := range []string{
+		`{"bands": []}`,
+		`{"bands": [{"min_severity": 1.5}]}`,
+		`{"bands": [{"color": "red"}]}`,
+		`{"bands": [{"style": "dotted"}]}`,
+		`{"bands": [{"thickness": -1}]}`,
+		`{"bands": [{"min_severity": 0.5}, {"min_severity": 0.5}]}`,
+		`{"bands": [{"colour": "ff0000"}]}`,
+	} {
+		if _, err := ParseStyleSheet(strings.NewReader(bad)); err == nil {
+			t.Errorf("%s: expected an error", bad)
+		}
+	}
+}
+
+func TestRender_SeverityStyles(t *testing.T) {
+	a := image.NewNRGBA(image.Rect(0, 0, 100, 60))
+	fillImage(a, color.NRGBA{128, 128, 128, 255})
+	b := image.NewNRGBA(image.Rect(0, 0, 100, 60))
+	fillImage(b, color.White)
+
+	mask := core.NewMask(100, 60)
+	low := core.Region{Bounds: image.Rect(5, 5, 35, 35)}
+	for i := 0; i < 30; i++ {
+		mask.Set(5+i, 5+i)
+		low.Area++
+	}
+	high := core.Region{Bounds: image.Rect(50, 10, 90, 50)}
+	for y := 10; y < 50; y++ {
+		for x := 50; x < 90; x++ {
+			mask.Set(x, y)
+			high.Area++
+		}
+	}
+	low.Severity, high.Severity = 30.0/900, 1
+
+	opts := core.DefaultOptions().Render
+	var err error
+	if opts.SeverityStyles, err = ParseStyleSheet(strings.NewReader(twoBandStyleSheet)); err != nil {
+		t.Fatal(err)
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	out := Render(core.NewFrame(a), core.NewFrame(b), mask, []core.Region{low, high}, core.NewRowAlignment(100, 60, 0, 0), core.Alignment{}, opts, logger)
+
+	yellow, red, white := [4]uint32{255, 255, 0, 255}, [4]uint32{255, 0, 0, 255}, [4]uint32{255, 255, 255, 255}
+	// Low severity: 1px yellow border, untinted overlay.
+	for _, c := range []struct {
+		p    image.Point
+		want [4]uint32
+	}{
+		{image.Pt(5, 20), yellow},
+		{image.Pt(34, 20), yellow},
+		{image.Pt(6, 20), white},
+		{image.Pt(50, 40), red},
+		{image.Pt(53, 40), red},
+		{image.Pt(89, 30), red},
+	} {
+		if got := rgbaAt(out, c.p.X, c.p.Y); got != c.want {
+			t.Errorf("pixel %v = %v, want %v", c.p, got, c.want)
+		}
+	}
+	if p := rgbaAt(out, 20, 20); p[0] != p[1] || p[0] == 255 {
+		t.Errorf("low severity diff pixel %v: want an untinted gray overlay", p)
+	}
+	// High severity: 4px red border, tinted overlay inside it.
+	if p := rgbaAt(out, 54, 30); p[0] <= p[1] {
+		t.Errorf("high severity diff pixel %v: want a red tint", p)
+	}
+}
@@ -0,0 +1,55 @@
+package render
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+
+	"github.com/xshoji/go-img-diff/internal/core"
+)
+
+// RenderScoreSurface draws an alignment score surface as a grayscale image with
+// cellSize x cellSize pixels per offset. Scores are normalized so the best offset
+// is brightest; unscorable offsets are drawn dark blue and the chosen offset is
+// outlined in red.
+func RenderScoreSurface(s *core.ScoreSurface, cellSize int) *image.NRGBA {
+	cellSize = max(1, cellSize)
+	size := s.Size()
+	img := image.NewNRGBA(image.Rect(0, 0, size*cellSize, size*cellSize))
+
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for _, v := range s.Scores {
+		if !math.IsNaN(v) {
+			lo = math.Min(lo, v)
+			hi = math.Max(hi, v)
+		}
+	}
+
+	for dy := -s.Radius; dy <= s.Radius; dy++ {
+		for dx := -s.Radius; dx <= s.Radius; dx++ {
+			c := color.NRGBA{0, 0, 64, 255}
+			if v := s.At(dx, dy); !math.IsNaN(v) {
+				level := uint8(255)
+				if hi > lo {
+					// Keep the worst valid score distinguishable from unscorable cells.
+					level = uint8(32 + math.Round((v-lo)/(hi-lo)*223))
+				}
+				c = color.NRGBA{level, level, level, 255}
+			}
+			draw.Draw(img, surfaceCell(s, dx, dy, cellSize), &image.Uniform{c}, image.Point{}, draw.Src)
+		}
+	}
+
+	chosen := surfaceCell(s, s.Chosen.DX, s.Chosen.DY, cellSize)
+	if chosen.In(img.Bounds()) {
+		drawBorder(img, chosen, color.NRGBA{255, 0, 0, 255}, max(1, cellSize/4))
+	}
+	return img
+}
+
+func surfaceCell(s *core.ScoreSurface, dx, dy, cellSize int) image.Rectangle {
+	x := (dx + s.Radius) * cellSize
+	y := (dy + s.Radius) * cellSize
+	return image.Rect(x, y, x+cellSize, y+cellSize)
+}
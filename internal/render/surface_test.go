@@ -0,0 +1,40 @@
+package render
+
+import (
+	"math"
+	"testing"
+
+	"github.com/xshoji/go-img-diff/internal/core"
+)
+
+func TestRenderScoreSurface(t *testing.T) {
+	s := core.NewScoreSurface(2)
+	for dy := -2; dy <= 2; dy++ {
+		for dx := -2; dx <= 2; dx++ {
+			s.Set(dx, dy, 0.5)
+		}
+	}
+	s.Set(1, -1, 0.9)
+	s.Set(-2, -2, math.NaN())
+	s.Chosen = core.Alignment{DX: 1, DY: -1}
+
+	img := RenderScoreSurface(s, 4)
+	if img.Bounds().Dx() != 20 || img.Bounds().Dy() != 20 {
+		t.Fatalf("expected 20x20 image, got %v", img.Bounds())
+	}
+
+	// Center of the chosen cell is the brightest value; its outline is red.
+	chosen := img.NRGBAAt(3*4+2, 1*4+2)
+	if chosen.R != 255 || chosen.G != 255 {
+		t.Errorf("expected brightest chosen cell, got %v", chosen)
+	}
+	if edge := img.NRGBAAt(3*4, 1*4); edge.R != 255 || edge.G != 0 {
+		t.Errorf("expected red outline on chosen cell, got %v", edge)
+	}
+	if dim := img.NRGBAAt(1*4+2, 2*4+2); dim.R != 32 {
+		t.Errorf("expected lowest valid score to map to 32, got %v", dim)
+	}
+	if nan := img.NRGBAAt(1, 1); nan.B != 64 || nan.R != 0 {
+		t.Errorf("expected unscorable cell in dark blue, got %v", nan)
+	}
+}
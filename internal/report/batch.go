@@ -0,0 +1,57 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/xshoji/go-img-diff/internal/imgio"
+)
+
+// BatchReport is the aggregate report of a batch run over two directories
+// or the pairs of a manifest. Files present in only one directory are listed
+// as pairs with an error, so that they fail the gate like pairs that could
+// not be compared.
+type BatchReport struct {
+	SchemaVersion int `json:"schema_version"`
+
+	Dir1     string `json:"dir1,omitempty"`
+	Dir2     string `json:"dir2,omitempty"`
+	Manifest string `json:"manifest,omitempty"`
+
+	PairsCompared int      `json:"pairs_compared"`
+	PairsWithDiff int      `json:"pairs_with_diff"`
+	OnlyInDir1    []string `json:"only_in_dir1"`
+	OnlyInDir2    []string `json:"only_in_dir2"`
+
+	// Jobs pairs were compared concurrently with WorkersPerJob workers each;
+	// WorkersAdjusted tells whether --cpu was reduced to fit them into the
+	// Cores CPU cores of the machine.
+	Jobs            int  `json:"jobs"`
+	WorkersPerJob   int  `json:"workers_per_job"`
+	WorkersAdjusted bool `json:"workers_adjusted"`
+	Cores           int  `json:"cores,omitempty"`
+
+	Pairs []PairSummary `json:"pairs"`
+	Gate  GateResult    `json:"gate"`
+}
+
+// MissingError is the PairSummary.Error of a file found in only one directory.
+func MissingError(dir string) string {
+	return fmt.Sprintf("missing in %s", dir)
+}
+
+// Write encodes the batch report as indented JSON.
+func (r *BatchReport) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(r); err != nil {
+		return fmt.Errorf("failed to encode batch report: %w", err)
+	}
+	return nil
+}
+
+// Save writes the batch report to path.
+func (r *BatchReport) Save(path string, mode imgio.WriteMode) error {
+	return imgio.WriteFile(path, mode, r.Write)
+}
@@ -0,0 +1,69 @@
+package report
+
+import "image"
+
+// RegionClass tells whether a region was already present in a previous report.
+type RegionClass string
+
+const (
+	RegionRecurring RegionClass = "recurring"
+	RegionNew       RegionClass = "new"
+)
+
+// RecurringMinIoU is the minimum intersection-over-union with a previous region
+// for a current region to count as recurring.
+const RecurringMinIoU = 0.5
+
+// Comparison summarizes how the current regions relate to a previous report.
+type Comparison struct {
+	PreviousReport string `json:"previous_report"`
+	Recurring      int    `json:"recurring"`
+	New            int    `json:"new"`
+}
+
+// CompareWith classifies every region in r against the regions of prev and
+// records the summary in r.Comparison.
+func (r *Report) CompareWith(prev *Report, prevPath string) *Comparison {
+	prevRects := make([]image.Rectangle, len(prev.Regions))
+	for i, p := range prev.Regions {
+		prevRects[i] = p.Bounds()
+	}
+
+	c := &Comparison{PreviousReport: prevPath}
+	for i := range r.Regions {
+		cur := r.Regions[i].Bounds()
+		r.Regions[i].Status = RegionNew
+		for _, p := range prevRects {
+			if IoU(cur, p) >= RecurringMinIoU {
+				r.Regions[i].Status = RegionRecurring
+				break
+			}
+		}
+		if r.Regions[i].Status == RegionRecurring {
+			c.Recurring++
+		} else {
+			c.New++
+		}
+	}
+	r.Comparison = c
+	return c
+}
+
+// Bounds returns the region rectangle.
+func (reg Region) Bounds() image.Rectangle {
+	return image.Rect(reg.MinX, reg.MinY, reg.MaxX, reg.MaxY)
+}
+
+// IoU returns the intersection-over-union of two rectangles (0 when disjoint).
+func IoU(a, b image.Rectangle) float64 {
+	inter := a.Intersect(b)
+	if inter.Empty() {
+		return 0
+	}
+	interArea := inter.Dx() * inter.Dy()
+	union := a.Dx()*a.Dy() + b.Dx()*b.Dy() - interArea
+	if union <= 0 {
+		return 0
+	}
+	return float64(interArea) / float64(union)
+}
@@ -0,0 +1,62 @@
+package report
+
+import (
+	"image"
+	"path/filepath"
+	"testing"
+
+	"github.com/xshoji/go-img-diff/internal/imgio"
+)
+
+func regionAt(r image.Rectangle) Region {
+	return Region{MinX: r.Min.X, MinY: r.Min.Y, MaxX: r.Max.X, MaxY: r.Max.Y, Width: r.Dx(), Height: r.Dy()}
+}
+
+func TestCompareWith(t *testing.T) {
+	dir := t.TempDir()
+	prevPath := filepath.Join(dir, "previous.json")
+	prev := &Report{Regions: []Region{
+		regionAt(image.Rect(10, 10, 50, 50)),
+		regionAt(image.Rect(100, 100, 140, 140)),
+	}}
+	if err := prev.Save(prevPath, imgio.WriteAtomic); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Load(prevPath)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	cur := &Report{Regions: []Region{
+		regionAt(image.Rect(12, 12, 52, 52)),     // overlapping: recurring
+		regionAt(image.Rect(130, 130, 170, 170)), // moved far: new
+		regionAt(image.Rect(300, 10, 320, 30)),   // brand new
+	}}
+	c := cur.CompareWith(loaded, prevPath)
+
+	want := []RegionClass{RegionRecurring, RegionNew, RegionNew}
+	for i, w := range want {
+		if cur.Regions[i].Status != w {
+			t.Errorf("region %d: expected %s, got %s", i, w, cur.Regions[i].Status)
+		}
+	}
+	if c.Recurring != 1 || c.New != 2 || c.PreviousReport != prevPath {
+		t.Errorf("unexpected comparison summary %+v", c)
+	}
+	if cur.Comparison != c {
+		t.Error("expected comparison to be recorded in the report")
+	}
+}
+
+func TestIoU(t *testing.T) {
+	a := image.Rect(0, 0, 10, 10)
+	if got := IoU(a, a); got != 1 {
+		t.Errorf("identical rects: expected 1, got %f", got)
+	}
+	if got := IoU(a, image.Rect(20, 20, 30, 30)); got != 0 {
+		t.Errorf("disjoint rects: expected 0, got %f", got)
+	}
+	if got := IoU(a, image.Rect(5, 0, 15, 10)); got < 0.333 || got > 0.334 {
+		t.Errorf("half overlap: expected 1/3, got %f", got)
+	}
+}
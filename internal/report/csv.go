@@ -0,0 +1,59 @@
+package report
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/xshoji/go-img-diff/internal/core"
+)
+
+// RegionsCSVHeader is the header row written by WriteRegionsCSV.
+var RegionsCSVHeader = []string{
+	"index", "min_x", "min_y", "max_x", "max_y",
+	"width", "height", "area", "differing_pixels", "diff_ratio",
+	"mean_diff", "severity", "schema_version",
+}
+
+// WriteRegionsCSV writes one row per region. Regions are numbered from 1 in the
+// order they are drawn in the diff image, most severe first. differing_pixels
+// is the region's Area, the count that region filters such as MinPixels use.
+// A header-only file is written when there are no regions.
+func WriteRegionsCSV(w io.Writer, regions []core.Region) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(RegionsCSVHeader); err != nil {
+		return fmt.Errorf("failed to write csv header: %w", err)
+	}
+
+	for i, r := range regions {
+		b := r.Bounds
+		area := b.Dx() * b.Dy()
+		differing := r.Area
+		ratio := 0.0
+		if area > 0 {
+			ratio = float64(differing) / float64(area)
+		}
+		row := []string{
+			strconv.Itoa(i + 1),
+			strconv.Itoa(b.Min.X),
+			strconv.Itoa(b.Min.Y),
+			strconv.Itoa(b.Max.X),
+			strconv.Itoa(b.Max.Y),
+			strconv.Itoa(b.Dx()),
+			strconv.Itoa(b.Dy()),
+			strconv.Itoa(area),
+			strconv.Itoa(differing),
+			strconv.FormatFloat(ratio, 'f', 6, 64),
+			strconv.FormatFloat(r.MeanDiff, 'f', 3, 64),
+			strconv.FormatFloat(r.Severity, 'f', 6, 64),
+			strconv.Itoa(SchemaVersion),
+		}
+		if err := cw.Write(row); err != nil {
+			return fmt.Errorf("failed to write csv row: %w", err)
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,43 @@
+package report
+
+import (
+	"bytes"
+	"encoding/csv"
+	"image"
+	"testing"
+
+	"github.com/xshoji/go-img-diff/internal/core"
+)
+
+func TestWriteRegionsCSV(t *testing.T) {
+	regions := []core.Region{{Bounds: image.Rect(0, 0, 10, 8), Area: 8, Severity: 0.05, MeanDiff: 127.5}}
+
+	var buf bytes.Buffer
+	if err := WriteRegionsCSV(&buf, regions); err != nil {
+		t.Fatalf("WriteRegionsCSV failed: %v", err)
+	}
+
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("failed to parse csv: %v", err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("expected header + 1 row, got %d rows", len(rows))
+	}
+	want := []string{"1", "0", "0", "10", "8", "10", "8", "80", "8", "0.100000", "127.500", "0.050000", "1"}
+	for i, v := range want {
+		if rows[1][i] != v {
+			t.Errorf("column %s = %q, want %q", RegionsCSVHeader[i], rows[1][i], v)
+		}
+	}
+}
+
+func TestWriteRegionsCSV_Empty(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteRegionsCSV(&buf, nil); err != nil {
+		t.Fatalf("WriteRegionsCSV failed: %v", err)
+	}
+	if got := buf.String(); got != "index,min_x,min_y,max_x,max_y,width,height,area,differing_pixels,diff_ratio,mean_diff,severity,schema_version\n" {
+		t.Errorf("unexpected output %q", got)
+	}
+}
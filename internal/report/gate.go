@@ -0,0 +1,149 @@
+package report
+
+import (
+	"fmt"
+
+	"github.com/xshoji/go-img-diff/internal/imgio"
+)
+
+// Gate rule names, as recorded in GateRule.Rule.
+const (
+	RuleMaxFailedPairs     = "max_failed_pairs"
+	RuleMaxFailedPercent   = "max_failed_percent"
+	RuleMaxPairDiffPercent = "max_pair_diff_percent"
+)
+
+// PairSummary is the outcome of one compared pair of a batch.
+type PairSummary struct {
+	Name        string  `json:"name"`
+	HasDiff     bool    `json:"has_diff"`
+	DiffPercent float64 `json:"diff_percent"`
+
+	// NewRegions is the number of regions not present in the previous report;
+	// Compared tells whether a previous report was given.
+	Compared   bool `json:"compared"`
+	NewRegions int  `json:"new_regions"`
+
+	// Error is set when the pair could not be compared; such a pair always
+	// fails. ErrorKind classifies load failures (see imgio.ErrorKind).
+	Error     string          `json:"error,omitempty"`
+	ErrorKind imgio.ErrorKind `json:"error_kind,omitempty"`
+}
+
+// Summarize returns the summary of the pair named name from its report.
+func (r *Report) Summarize(name string) PairSummary {
+	s := PairSummary{Name: name, HasDiff: r.HasDiff, DiffPercent: 100 * r.DiffRatio}
+	if r.Comparison != nil {
+		s.Compared = true
+		s.NewRegions = r.Comparison.New
+	}
+	return s
+}
+
+// Gate decides the overall verdict of a batch from its pair summaries. A pair
+// fails when it differs, or with NewOnly when it has new regions (pairs
+// without a previous report fall back to differing).
+type Gate struct {
+	// MaxFailedPairs is the number of failing pairs tolerated, or with
+	// MaxFailedPercent > 0 ignored in favor of that share of all pairs (0-100).
+	MaxFailedPairs   int
+	MaxFailedPercent float64
+
+	// MaxPairDiffPercent fails the batch when any pair differs in more than
+	// this percentage of its pixels, however many pairs fail (0=disabled).
+	MaxPairDiffPercent float64
+
+	NewOnly bool
+}
+
+// GateResult is the evaluation of a Gate, recorded in the aggregate report so
+// that a failing run shows which rule tripped and for which pairs.
+type GateResult struct {
+	Passed      bool       `json:"passed"`
+	Pairs       int        `json:"pairs"`
+	FailedPairs int        `json:"failed_pairs"`
+	Rules       []GateRule `json:"rules"`
+}
+
+// GateRule is the outcome of one rule: Actual compared against Limit, and the
+// pairs that count against it.
+type GateRule struct {
+	Rule   string   `json:"rule"`
+	Limit  float64  `json:"limit"`
+	Actual float64  `json:"actual"`
+	Passed bool     `json:"passed"`
+	Pairs  []string `json:"pairs,omitempty"`
+}
+
+// Failed reports whether pair s counts as failing under g.
+func (g Gate) Failed(s PairSummary) bool {
+	if s.Error != "" {
+		return true
+	}
+	if g.NewOnly && s.Compared {
+		return s.NewRegions > 0
+	}
+	return s.HasDiff
+}
+
+// Evaluate applies g to the pair summaries of a batch.
+func (g Gate) Evaluate(pairs []PairSummary) GateResult {
+	var failed []string
+	for _, p := range pairs {
+		if g.Failed(p) {
+			failed = append(failed, p.Name)
+		}
+	}
+	res := GateResult{Pairs: len(pairs), FailedPairs: len(failed)}
+
+	if g.MaxFailedPercent > 0 {
+		actual := 0.0
+		if len(pairs) > 0 {
+			actual = 100 * float64(len(failed)) / float64(len(pairs))
+		}
+		res.Rules = append(res.Rules, GateRule{
+			Rule:   RuleMaxFailedPercent,
+			Limit:  g.MaxFailedPercent,
+			Actual: actual,
+			Passed: actual <= g.MaxFailedPercent,
+			Pairs:  failed,
+		})
+	} else {
+		res.Rules = append(res.Rules, GateRule{
+			Rule:   RuleMaxFailedPairs,
+			Limit:  float64(g.MaxFailedPairs),
+			Actual: float64(len(failed)),
+			Passed: len(failed) <= g.MaxFailedPairs,
+			Pairs:  failed,
+		})
+	}
+
+	if g.MaxPairDiffPercent > 0 {
+		rule := GateRule{Rule: RuleMaxPairDiffPercent, Limit: g.MaxPairDiffPercent, Passed: true}
+		for _, p := range pairs {
+			rule.Actual = max(rule.Actual, p.DiffPercent)
+			if p.DiffPercent > g.MaxPairDiffPercent {
+				rule.Passed = false
+				rule.Pairs = append(rule.Pairs, p.Name)
+			}
+		}
+		res.Rules = append(res.Rules, rule)
+	}
+
+	res.Passed = true
+	for _, r := range res.Rules {
+		res.Passed = res.Passed && r.Passed
+	}
+	return res
+}
+
+// Tripped returns one line per failed rule, for the console.
+func (res GateResult) Tripped() []string {
+	var lines []string
+	for _, r := range res.Rules {
+		if !r.Passed {
+			lines = append(lines, fmt.Sprintf("%s: %g exceeds %g (%v)", r.Rule, r.Actual, r.Limit, r.Pairs))
+		}
+	}
+	return lines
+}
@@ -0,0 +1,100 @@
+package report
+
+import (
+	"reflect"
+	"testing"
+)
+
+// batchPairs is a synthetic batch: one identical pair, two with small diffs
+// (one only recurring), one with a large diff and one that failed to load.
+func batchPairs() []PairSummary {
+	return []PairSummary{
+		{Name: "same", Compared: true},
+		{Name: "small-new", HasDiff: true, DiffPercent: 0.5, Compared: true, NewRegions: 1},
+		{Name: "small-recurring", HasDiff: true, DiffPercent: 0.8, Compared: true},
+		{Name: "large", HasDiff: true, DiffPercent: 12, Compared: true, NewRegions: 3},
+		{Name: "broken", Error: "decode input2: unexpected EOF"},
+	}
+}
+
+func TestGate_Evaluate(t *testing.T) {
+	tests := []struct {
+		name    string
+		gate    Gate
+		passed  bool
+		failed  int
+		tripped map[string][]string
+	}{
+		{
+			name:    "default fails on any failing pair",
+			gate:    Gate{},
+			failed:  4,
+			tripped: map[string][]string{RuleMaxFailedPairs: {"small-new", "small-recurring", "large", "broken"}},
+		},
+		{
+			name:   "enough failures tolerated",
+			gate:   Gate{MaxFailedPairs: 4},
+			passed: true,
+			failed: 4,
+		},
+		{
+			name:    "share of pairs",
+			gate:    Gate{MaxFailedPairs: 10, MaxFailedPercent: 50},
+			failed:  4,
+			tripped: map[string][]string{RuleMaxFailedPercent: {"small-new", "small-recurring", "large", "broken"}},
+		},
+		{
+			name:   "new regions only",
+			gate:   Gate{MaxFailedPairs: 3, NewOnly: true},
+			passed: true,
+			failed: 3,
+		},
+		{
+			name:    "one pair above the diff limit",
+			gate:    Gate{MaxFailedPairs: 4, MaxPairDiffPercent: 10},
+			failed:  4,
+			tripped: map[string][]string{RuleMaxPairDiffPercent: {"large"}},
+		},
+		{
+			name:    "both rules trip",
+			gate:    Gate{MaxFailedPercent: 40, MaxPairDiffPercent: 0.6, NewOnly: true},
+			failed:  3,
+			tripped: map[string][]string{RuleMaxFailedPercent: {"small-new", "large", "broken"}, RuleMaxPairDiffPercent: {"small-recurring", "large"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := tt.gate.Evaluate(batchPairs())
+			if res.Passed != tt.passed || res.Pairs != 5 || res.FailedPairs != tt.failed {
+				t.Errorf("passed=%v pairs=%d failed=%d, want %v 5 %d", res.Passed, res.Pairs, res.FailedPairs, tt.passed, tt.failed)
+			}
+			tripped := map[string][]string{}
+			for _, r := range res.Rules {
+				if !r.Passed {
+					tripped[r.Rule] = r.Pairs
+				}
+			}
+			if len(tripped) != len(tt.tripped) || (len(tripped) > 0 && !reflect.DeepEqual(tripped, tt.tripped)) {
+				t.Errorf("tripped rules %v, want %v", tripped, tt.tripped)
+			}
+			if len(res.Tripped()) != len(tt.tripped) {
+				t.Errorf("Tripped() = %q, want %d lines", res.Tripped(), len(tt.tripped))
+			}
+		})
+	}
+}
+
+func TestGate_EmptyBatch(t *testing.T) {
+	res := Gate{MaxFailedPercent: 10, MaxPairDiffPercent: 1}.Evaluate(nil)
+	if !res.Passed || len(res.Rules) != 2 {
+		t.Errorf("empty batch: %+v, want both rules passed", res)
+	}
+}
+
+func TestReport_Summarize(t *testing.T) {
+	r := &Report{HasDiff: true, DiffRatio: 0.025, Comparison: &Comparison{New: 2, Recurring: 1}}
+	want := PairSummary{Name: "home", HasDiff: true, DiffPercent: 2.5, Compared: true, NewRegions: 2}
+	if got := r.Summarize("home"); got != want {
+		t.Errorf("Summarize() = %+v, want %+v", got, want)
+	}
+}
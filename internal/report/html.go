@@ -0,0 +1,91 @@
+package report
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"image"
+	"image/png"
+	"io"
+
+	"github.com/xshoji/go-img-diff/internal/core"
+)
+
+//go:embed report.html.tmpl
+var htmlTemplate string
+
+type htmlRegion struct {
+	Index                  int
+	MinX, MinY, MaxX, MaxY int
+	Width, Height          int
+	Area                   int
+	Severity               float64
+}
+
+type htmlData struct {
+	SchemaVersion    int
+	Input1, Input2   string
+	OffsetX, OffsetY int
+	DiffPixels       int
+	DiffPercent      float64
+	Regions          []htmlRegion
+	ImageA           template.URL
+	ImageB           template.URL
+	ImageDiff        template.URL
+}
+
+// WriteHTML writes a self-contained HTML page with the input images, the diff
+// image and the region table. Regions are listed in the same order they are
+// drawn in the diff image, most severe first.
+func WriteHTML(w io.Writer, opts core.Options, result *core.Result) error {
+	tmpl, err := template.New("report").Parse(htmlTemplate)
+	if err != nil {
+		return fmt.Errorf("failed to parse html report template: %w", err)
+	}
+
+	data := htmlData{
+		SchemaVersion: SchemaVersion,
+		Input1:        opts.Input1,
+		Input2:        opts.Input2,
+		OffsetX:       result.Aligned.DX,
+		OffsetY:       result.Aligned.DY,
+		DiffPixels:    result.DiffPixels(),
+		DiffPercent:   result.DiffRatio() * 100,
+	}
+	for i, r := range result.Regions {
+		b := r.Bounds
+		data.Regions = append(data.Regions, htmlRegion{
+			Index: i + 1,
+			MinX:  b.Min.X, MinY: b.Min.Y, MaxX: b.Max.X, MaxY: b.Max.Y,
+			Width: b.Dx(), Height: b.Dy(),
+			Area: r.Area, Severity: r.Severity,
+		})
+	}
+	for _, img := range []struct {
+		dst *template.URL
+		src image.Image
+	}{
+		{&data.ImageA, result.FrameA.Pix},
+		{&data.ImageB, result.FrameB.Pix},
+		{&data.ImageDiff, result.Output},
+	} {
+		if *img.dst, err = pngDataURI(img.src); err != nil {
+			return err
+		}
+	}
+
+	if err := tmpl.Execute(w, data); err != nil {
+		return fmt.Errorf("failed to render html report: %w", err)
+	}
+	return nil
+}
+
+func pngDataURI(img image.Image) (template.URL, error) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return "", fmt.Errorf("failed to encode image for html report: %w", err)
+	}
+	return template.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes())), nil
+}
@@ -0,0 +1,34 @@
+package report
+
+import (
+	"bytes"
+	"image"
+	"strings"
+	"testing"
+
+	"github.com/xshoji/go-img-diff/internal/core"
+)
+
+func TestWriteHTML(t *testing.T) {
+	frame := core.NewFrame(image.NewNRGBA(image.Rect(0, 0, 20, 20)))
+	result := &core.Result{
+		FrameA:  frame,
+		FrameB:  frame,
+		Output:  frame.Pix,
+		Aligned: core.Alignment{DX: 2, DY: -1},
+		Regions: []core.Region{{Bounds: image.Rect(1, 2, 5, 7), Area: 12}},
+	}
+	opts := core.DefaultOptions()
+	opts.Input1, opts.Input2 = "before.png", "after.png"
+
+	var buf bytes.Buffer
+	if err := WriteHTML(&buf, opts, result); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{"before.png", "after.png", "data:image/png;base64,", "<td>12</td>", `<meta name="imgdiff-schema-version" content="1">`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("html report missing %q", want)
+		}
+	}
+}
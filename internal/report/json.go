@@ -0,0 +1,390 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+
+	"github.com/xshoji/go-img-diff/internal/core"
+	"github.com/xshoji/go-img-diff/internal/imgio"
+	"github.com/xshoji/go-img-diff/internal/progress"
+)
+
+// Offset is the detected translation of image B relative to image A.
+type Offset struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+// RunnerUp is the alignment runner-up offset and its score.
+type RunnerUp struct {
+	X     int     `json:"x"`
+	Y     int     `json:"y"`
+	Score float64 `json:"score"`
+}
+
+// Region is one merged diff region as listed in the JSON report.
+type Region struct {
+	Index           int         `json:"index"`
+	MinX            int         `json:"min_x"`
+	MinY            int         `json:"min_y"`
+	MaxX            int         `json:"max_x"`
+	MaxY            int         `json:"max_y"`
+	Width           int         `json:"width"`
+	Height          int         `json:"height"`
+	DifferingPixels int         `json:"differing_pixels"`
+	MeanDiff        float64     `json:"mean_diff,omitempty"`
+	Severity        float64     `json:"severity,omitempty"`
+	Status          RegionClass `json:"status,omitempty"`
+
+	// Contours are the polygons of --outline contour as [x, y] vertices.
+	Contours [][][2]int `json:"contours,omitempty"`
+}
+
+// Report is the machine-readable summary of a single comparison.
+type Report struct {
+	SchemaVersion int `json:"schema_version"`
+
+	Input1 string  `json:"input1"`
+	Input2 string  `json:"input2"`
+	Offset Offset  `json:"offset"`
+	Score  float64 `json:"score"`
+
+	// RunnerUp is the best scoring offset not adjacent to Offset, and
+	// Confidence how clearly Offset wins over it (1 = equally good, 0 = not
+	// computed). Ambiguous is set when Confidence is below the configured minimum.
+	RunnerUp   *RunnerUp `json:"runner_up,omitempty"`
+	Confidence float64   `json:"confidence"`
+	Ambiguous  bool      `json:"ambiguous"`
+
+	// SSIM is the mean structural similarity (-1..1, 1 = identical) of the
+	// aligned images, reported with the ssim alignment metric only.
+	SSIM *float64 `json:"ssim,omitempty"`
+
+	// MaxAcceptableOffset is the configured offset gate (0=disabled) and
+	// OffsetRejected records whether the detected offset exceeded it.
+	MaxAcceptableOffset int  `json:"max_acceptable_offset,omitempty"`
+	OffsetRejected      bool `json:"offset_rejected"`
+
+	// Orientation is set when input1 was rotated to match the aspect ratio of input2.
+	Orientation core.Orientation `json:"orientation,omitempty"`
+
+	// Scale is set when the input sizes differ by a uniform simple ratio.
+	Scale *Scale `json:"scale,omitempty"`
+
+	// UncoveredBands are the areas of input2 without a counterpart in input1
+	// under the detected offset; UncoveredPercent is their share of input2.
+	UncoveredBands   []Band  `json:"uncovered_bands"`
+	UncoveredPercent float64 `json:"uncovered_percent"`
+
+	HasDiff    bool    `json:"has_diff"`
+	DiffPixels int     `json:"diff_pixels"`
+	DiffRatio  float64 `json:"diff_ratio"`
+
+	// MSE is the mean squared R, G and B error of the aligned images and
+	// PSNR the peak signal-to-noise ratio in dB. For identical images PSNR is
+	// infinite and both are omitted, so psnr reads as null.
+	MSE  float64  `json:"mse,omitempty"`
+	PSNR *float64 `json:"psnr,omitempty"`
+
+	// Histogram compares the color histograms of the inputs. HistogramOnly
+	// records that nothing else was compared (--histogram-only).
+	Histogram     *Histogram `json:"histogram,omitempty"`
+	HistogramOnly bool       `json:"histogram_only,omitempty"`
+
+	Regions    []Region    `json:"regions"`
+	Comparison *Comparison `json:"comparison,omitempty"`
+
+	// Grid counts the differing pixels of every cell of --grid.
+	Grid *Grid `json:"grid,omitempty"`
+
+	// RowBands are the runs of rows only one input has (--detect-scroll).
+	RowBands []RowBand `json:"row_bands,omitempty"`
+	Phases   []Phase   `json:"phases,omitempty"`
+
+	// Tolerance records the configured difference limits and whether the
+	// pair passed them (omitted when no limit is set).
+	Tolerance *Tolerance `json:"tolerance,omitempty"`
+
+	// LocallyAligned lists the regions suppressed by local re-alignment.
+	LocallyAligned []LocalRegion `json:"locally_aligned,omitempty"`
+
+	// SuppressedRegions lists the regions dropped by --min-region-pixels.
+	SuppressedRegions []SuppressedRegion `json:"suppressed_regions,omitempty"`
+
+	// DroppedRegions counts the regions left out by --max-regions.
+	DroppedRegions int `json:"dropped_regions,omitempty"`
+
+	// MinDetectableChange is the side of the smallest square change always
+	// detected under the noise filter settings (omitted when 1), and
+	// NoiseFilterBypassed records that --verify-clean found differences the
+	// filter had removed.
+	MinDetectableChange int  `json:"min_detectable_change,omitempty"`
+	NoiseFilterBypassed bool `json:"noise_filter_bypassed,omitempty"`
+
+	// PHashPrefiltered records that the images were reported identical by
+	// --phash-prefilter without being compared.
+	PHashPrefiltered bool `json:"phash_prefiltered,omitempty"`
+
+	// StartedAt and FinishedAt are the run's wall-clock times in
+	// progress.TimeFormat (ISO 8601), omitted for in-memory comparisons.
+	StartedAt  string `json:"started_at,omitempty"`
+	FinishedAt string `json:"finished_at,omitempty"`
+
+	// ToolVersion identifies the imgdiff build that wrote the report.
+	ToolVersion string `json:"tool_version,omitempty"`
+}
+
+// Scale is the ratio of the size of input1 to that of input2 (see
+// core.ScaleFactor), as "2" or "3/2" and as a number, and whether
+// --auto-scale downsampled the larger input to match.
+type Scale struct {
+	Factor  string  `json:"factor"`
+	Value   float64 `json:"value"`
+	Applied bool    `json:"applied"`
+}
+
+// RowBand is a run of rows only one input has (see core.RowBand): rows
+// [min_y,max_y) of input2 for "inserted" bands and [src_min_y,src_max_y) of
+// input1 for "deleted" ones. The empty range of the other input is where the
+// rows are missing.
+type RowBand struct {
+	Kind    core.RowBandKind `json:"kind"`
+	MinY    int              `json:"min_y"`
+	MaxY    int              `json:"max_y"`
+	SrcMinY int              `json:"src_min_y"`
+	SrcMaxY int              `json:"src_max_y"`
+	Height  int              `json:"height"`
+}
+
+// Grid is the cell grid laid over input2 (see core.Mask.Grid), with its
+// cells listed row by row.
+type Grid struct {
+	Cols  int        `json:"cols"`
+	Rows  int        `json:"rows"`
+	Cells []GridCell `json:"cells"`
+}
+
+// GridCell is one cell of the grid and the share of its pixels that differ.
+type GridCell struct {
+	Col             int     `json:"col"`
+	Row             int     `json:"row"`
+	MinX            int     `json:"min_x"`
+	MinY            int     `json:"min_y"`
+	MaxX            int     `json:"max_x"`
+	MaxY            int     `json:"max_y"`
+	DifferingPixels int     `json:"differing_pixels"`
+	DiffRatio       float64 `json:"diff_ratio"`
+}
+
+// Histogram is the distance of the color histograms of the inputs (see
+// core.HistogramDistance), and the limit of --histogram-only.
+type Histogram struct {
+	Intersection float64 `json:"intersection"`
+	ChiSquare    float64 `json:"chi_square"`
+	MaxDistance  float64 `json:"max_distance,omitempty"`
+}
+
+// Tolerance is the noise tolerance of a comparison: the largest share and
+// number of differing pixels accepted (0=no limit), and the verdict. Passed is
+// false when DiffPixels or DiffRatio exceeds a limit and a region remains.
+type Tolerance struct {
+	MaxDiffRatio  float64 `json:"max_diff_ratio"`
+	MaxDiffPixels int     `json:"max_diff_pixels"`
+	Passed        bool    `json:"passed"`
+}
+
+// LocalRegion is a diff region suppressed by local re-alignment because it
+// matches when input2 is mapped to input1 by its own offset (DX, DY).
+type LocalRegion struct {
+	MinX int `json:"min_x"`
+	MinY int `json:"min_y"`
+	MaxX int `json:"max_x"`
+	MaxY int `json:"max_y"`
+	DX   int `json:"dx"`
+	DY   int `json:"dy"`
+}
+
+// SuppressedRegion is a diff region dropped because fewer than
+// --min-region-pixels of its pixels differ.
+type SuppressedRegion struct {
+	MinX            int `json:"min_x"`
+	MinY            int `json:"min_y"`
+	MaxX            int `json:"max_x"`
+	MaxY            int `json:"max_y"`
+	DifferingPixels int `json:"differing_pixels"`
+}
+
+// Band is a strip of input2 that could not be compared.
+type Band struct {
+	MinX    int     `json:"min_x"`
+	MinY    int     `json:"min_y"`
+	MaxX    int     `json:"max_x"`
+	MaxY    int     `json:"max_y"`
+	Area    int     `json:"area"`
+	Percent float64 `json:"percent"`
+}
+
+// Phase is the duration of one pipeline phase and the Go runtime memory
+// statistics read when it ended. Memory figures cover the Go heap and runtime
+// only, not the whole process.
+type Phase struct {
+	Phase             string  `json:"phase"`
+	DurationMS        float64 `json:"duration_ms"`
+	GoHeapAllocBytes  uint64  `json:"go_heap_alloc_bytes"`
+	GoTotalAllocBytes uint64  `json:"go_total_alloc_bytes"`
+	GoSysBytes        uint64  `json:"go_sys_bytes"`
+}
+
+// Build creates a report from a pipeline result. Regions keep the order in
+// which they are drawn in the diff image, most severe first.
+func Build(opts core.Options, result *core.Result) *Report {
+	r := &Report{
+		SchemaVersion: SchemaVersion,
+
+		Input1: opts.Input1,
+		Input2: opts.Input2,
+		Offset: Offset{X: result.Aligned.DX, Y: result.Aligned.DY},
+		Score:  result.Aligned.Score,
+
+		Confidence: result.Aligned.Confidence,
+		Ambiguous:  opts.Align.Ambiguous(result.Aligned),
+
+		MaxAcceptableOffset: opts.Align.MaxAcceptableOffset,
+		OffsetRejected:      !opts.Align.AcceptsOffset(result.Aligned),
+		Orientation:         result.Orientation,
+		HasDiff:             result.HasDiff,
+		DiffPixels:          result.DiffPixels(),
+		DiffRatio:           result.DiffRatio(),
+		MSE:                 result.MSE,
+		Regions:             make([]Region, 0, len(result.Regions)),
+		UncoveredBands:      []Band{},
+		NoiseFilterBypassed: result.Unfiltered,
+		PHashPrefiltered:    result.Prefiltered,
+		HistogramOnly:       opts.HistogramOnly,
+		ToolVersion:         opts.Output.Version,
+	}
+	if !result.StartedAt.IsZero() {
+		r.StartedAt = result.StartedAt.Format(progress.TimeFormat)
+		r.FinishedAt = result.FinishedAt.Format(progress.TimeFormat)
+	}
+	if result.FrameA != nil {
+		r.Histogram = &Histogram{Intersection: result.Histogram.Intersection, ChiSquare: result.Histogram.ChiSquare}
+		if opts.HistogramOnly {
+			r.Histogram.MaxDistance = opts.HistogramMaxDistance
+		}
+	}
+	for _, b := range result.RowBands {
+		r.RowBands = append(r.RowBands, RowBand{Kind: b.Kind, MinY: b.Y0, MaxY: b.Y1, SrcMinY: b.SrcY0, SrcMaxY: b.SrcY1, Height: b.Height()})
+	}
+	if !opts.Grid.IsZero() && result.DiffMask != nil {
+		r.Grid = &Grid{Cols: opts.Grid.Cols, Rows: opts.Grid.Rows}
+		for _, c := range result.DiffMask.Grid(opts.Grid) {
+			b := c.Bounds
+			r.Grid.Cells = append(r.Grid.Cells, GridCell{Col: c.Col, Row: c.Row, MinX: b.Min.X, MinY: b.Min.Y, MaxX: b.Max.X, MaxY: b.Max.Y, DifferingPixels: c.DiffPixels, DiffRatio: c.Ratio()})
+		}
+	}
+	if s := result.Scale; !s.IsZero() {
+		r.Scale = &Scale{Factor: s.String(), Value: s.Value(), Applied: result.Scaled}
+	}
+	if psnr := result.PSNR(); !math.IsInf(psnr, 1) {
+		r.PSNR = &psnr
+	}
+	if opts.Diff.Tolerant() {
+		r.Tolerance = &Tolerance{MaxDiffRatio: opts.Diff.MaxDiffRatio, MaxDiffPixels: opts.Diff.MaxDiffPixels, Passed: !result.HasDiff}
+	}
+	if opts.Align.Metric == core.AlignMetricSSIM {
+		ssim := result.Aligned.SSIM
+		r.SSIM = &ssim
+	}
+	if n := opts.Diff.MinDetectableChange(); n > 1 {
+		r.MinDetectableChange = n
+	}
+	if ru := result.Aligned.RunnerUp; result.Aligned.Confidence > 0 {
+		r.RunnerUp = &RunnerUp{X: ru.DX, Y: ru.DY, Score: ru.Score}
+	}
+	if result.FrameB != nil {
+		frameArea := float64(result.FrameB.W * result.FrameB.H)
+		for _, b := range result.UncoveredBands() {
+			area := b.Dx() * b.Dy()
+			percent := 100 * float64(area) / frameArea
+			r.UncoveredBands = append(r.UncoveredBands, Band{MinX: b.Min.X, MinY: b.Min.Y, MaxX: b.Max.X, MaxY: b.Max.Y, Area: area, Percent: percent})
+			r.UncoveredPercent += percent
+		}
+	}
+	for _, p := range result.Phases {
+		r.Phases = append(r.Phases, Phase{
+			Phase:             p.Phase,
+			DurationMS:        float64(p.Duration.Microseconds()) / 1000,
+			GoHeapAllocBytes:  p.HeapAlloc,
+			GoTotalAllocBytes: p.TotalAlloc,
+			GoSysBytes:        p.Sys,
+		})
+	}
+	for i, reg := range result.Regions {
+		b := reg.Bounds
+		var contours [][][2]int
+		if reg.Contour != nil {
+			for _, polygon := range reg.Contour.Polygons {
+				vertices := make([][2]int, len(polygon))
+				for j, p := range polygon {
+					vertices[j] = [2]int{p.X, p.Y}
+				}
+				contours = append(contours, vertices)
+			}
+		}
+		r.Regions = append(r.Regions, Region{
+			Index:           i + 1,
+			MinX:            b.Min.X,
+			MinY:            b.Min.Y,
+			MaxX:            b.Max.X,
+			MaxY:            b.Max.Y,
+			Width:           b.Dx(),
+			Height:          b.Dy(),
+			DifferingPixels: reg.Area,
+			MeanDiff:        reg.MeanDiff,
+			Severity:        reg.Severity,
+			Contours:        contours,
+		})
+	}
+	for _, la := range result.LocallyAligned {
+		b := la.Region.Bounds
+		r.LocallyAligned = append(r.LocallyAligned, LocalRegion{MinX: b.Min.X, MinY: b.Min.Y, MaxX: b.Max.X, MaxY: b.Max.Y, DX: la.DX, DY: la.DY})
+	}
+	r.DroppedRegions = result.DroppedRegions
+	for _, reg := range result.Suppressed {
+		b := reg.Bounds
+		r.SuppressedRegions = append(r.SuppressedRegions, SuppressedRegion{MinX: b.Min.X, MinY: b.Min.Y, MaxX: b.Max.X, MaxY: b.Max.Y, DifferingPixels: reg.Area})
+	}
+	return r
+}
+
+// Write encodes the report as indented JSON.
+func (r *Report) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(r); err != nil {
+		return fmt.Errorf("failed to encode json report: %w", err)
+	}
+	return nil
+}
+
+// Save writes the report to path.
+func (r *Report) Save(path string, mode imgio.WriteMode) error {
+	return imgio.WriteFile(path, mode, r.Write)
+}
+
+// Load reads a JSON report previously written by Save.
+func Load(path string) (*Report, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read json report %s: %w", path, err)
+	}
+	var r Report
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("failed to parse json report %s: %w", path, err)
+	}
+	return &r, nil
+}
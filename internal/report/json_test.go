@@ -0,0 +1,137 @@
+package report
+
+import (
+	"encoding/json"
+	"image"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xshoji/go-img-diff/internal/core"
+)
+
+func TestBuild_UncoveredBands(t *testing.T) {
+	frame := core.NewFrame(image.NewNRGBA(image.Rect(0, 0, 100, 50)))
+	result := &core.Result{FrameA: frame, FrameB: frame, Aligned: core.Alignment{DX: -4, DY: 0}}
+
+	r := Build(core.DefaultOptions(), result)
+	if len(r.UncoveredBands) != 1 {
+		t.Fatalf("bands = %+v, want one right-hand strip", r.UncoveredBands)
+	}
+	want := Band{MinX: 96, MinY: 0, MaxX: 100, MaxY: 50, Area: 200, Percent: 4}
+	if got := r.UncoveredBands[0]; got != want {
+		t.Errorf("band = %+v, want %+v", got, want)
+	}
+	if math.Abs(r.UncoveredPercent-4) > 1e-9 {
+		t.Errorf("uncovered percent = %v, want 4", r.UncoveredPercent)
+	}
+}
+
+func TestBuild_Confidence(t *testing.T) {
+	frame := core.NewFrame(image.NewNRGBA(image.Rect(0, 0, 100, 50)))
+	result := &core.Result{FrameA: frame, FrameB: frame}
+
+	r := Build(core.DefaultOptions(), result)
+	if r.RunnerUp != nil || r.Confidence != 0 || r.Ambiguous {
+		t.Errorf("without a runner-up: runner_up=%+v confidence=%v ambiguous=%v", r.RunnerUp, r.Confidence, r.Ambiguous)
+	}
+
+	result.Aligned = core.Alignment{DX: 1, Score: 0.99, RunnerUp: core.OffsetScore{DX: 3, DY: 0, Score: 0.989}, Confidence: 1.1}
+	r = Build(core.DefaultOptions(), result)
+	if want := (RunnerUp{X: 3, Y: 0, Score: 0.989}); r.RunnerUp == nil || *r.RunnerUp != want {
+		t.Errorf("runner_up = %+v, want %+v", r.RunnerUp, want)
+	}
+	if r.Confidence != 1.1 || !r.Ambiguous {
+		t.Errorf("confidence=%v ambiguous=%v, want 1.1 and ambiguous below the default minimum", r.Confidence, r.Ambiguous)
+	}
+}
+
+func TestBuild_Grid(t *testing.T) {
+	frame := core.NewFrame(image.NewNRGBA(image.Rect(0, 0, 100, 50)))
+	mask := core.NewMask(100, 50)
+	mask.SetRect(image.Rect(40, 30, 50, 40)) // 100 pixels in cell (1,1)
+	result := &core.Result{FrameA: frame, FrameB: frame, DiffMask: mask}
+
+	if r := Build(core.DefaultOptions(), result); r.Grid != nil {
+		t.Errorf("grid without --grid: %+v", r.Grid)
+	}
+	opts := core.DefaultOptions()
+	opts.Grid = core.GridSize{Cols: 3, Rows: 2}
+	r := Build(opts, result)
+	if r.Grid == nil || r.Grid.Cols != 3 || r.Grid.Rows != 2 || len(r.Grid.Cells) != 6 {
+		t.Fatalf("grid = %+v, want 3x2 cells", r.Grid)
+	}
+	for _, c := range r.Grid.Cells {
+		want := GridCell{Col: c.Col, Row: c.Row, MinX: c.Col * 100 / 3, MinY: c.Row * 25, MaxX: (c.Col + 1) * 100 / 3, MaxY: (c.Row + 1) * 25}
+		if c.Col == 1 && c.Row == 1 {
+			want.DifferingPixels, want.DiffRatio = 100, 100.0/(33*25)
+		}
+		if c != want {
+			t.Errorf("cell = %+v, want %+v", c, want)
+		}
+	}
+}
+
+func TestBuild_Times(t *testing.T) {
+	frame := core.NewFrame(image.NewNRGBA(image.Rect(0, 0, 10, 10)))
+	result := &core.Result{FrameA: frame, FrameB: frame}
+	if r := Build(core.DefaultOptions(), result); r.StartedAt != "" || r.FinishedAt != "" {
+		t.Errorf("in-memory result: started_at=%q finished_at=%q, want both omitted", r.StartedAt, r.FinishedAt)
+	}
+
+	result.StartedAt = time.Date(2024, 3, 5, 9, 4, 2, 7_000_000, time.UTC)
+	result.FinishedAt = result.StartedAt.Add(1500 * time.Millisecond)
+	r := Build(core.DefaultOptions(), result)
+	if r.StartedAt != "2024-03-05T09:04:02.007Z" || r.FinishedAt != "2024-03-05T09:04:03.507Z" {
+		t.Errorf("started_at=%q finished_at=%q", r.StartedAt, r.FinishedAt)
+	}
+}
+
+func TestBuild_Tolerance(t *testing.T) {
+	frame := core.NewFrame(image.NewNRGBA(image.Rect(0, 0, 10, 10)))
+	result := &core.Result{FrameA: frame, FrameB: frame}
+	opts := core.DefaultOptions()
+	if r := Build(opts, result); r.Tolerance != nil {
+		t.Errorf("tolerance = %+v, want omitted without limits", r.Tolerance)
+	}
+
+	opts.Diff.MaxDiffRatio = 0.001
+	result.HasDiff = true
+	want := Tolerance{MaxDiffRatio: 0.001, Passed: false}
+	if r := Build(opts, result); r.Tolerance == nil || *r.Tolerance != want {
+		t.Errorf("tolerance = %+v, want %+v", r.Tolerance, want)
+	}
+}
+
+func TestBuild_PSNR(t *testing.T) {
+	frame := core.NewFrame(image.NewNRGBA(image.Rect(0, 0, 10, 10)))
+	result := &core.Result{FrameA: frame, FrameB: frame}
+	if r := Build(core.DefaultOptions(), result); r.MSE != 0 || r.PSNR != nil {
+		t.Errorf("identical images: mse=%v psnr=%v, want 0 and omitted", r.MSE, r.PSNR)
+	}
+
+	result.MSE = 65.025 // 255^2 / 1000
+	r := Build(core.DefaultOptions(), result)
+	if r.MSE != 65.025 || r.PSNR == nil || math.Abs(*r.PSNR-30) > 1e-9 {
+		t.Errorf("mse=%v psnr=%v, want 65.025 and 30 dB", r.MSE, r.PSNR)
+	}
+}
+
+func TestBuild_ToolVersion(t *testing.T) {
+	frame := core.NewFrame(image.NewNRGBA(image.Rect(0, 0, 10, 10)))
+	result := &core.Result{FrameA: frame, FrameB: frame}
+	opts := core.DefaultOptions()
+	if data, _ := json.Marshal(Build(opts, result)); strings.Contains(string(data), "tool_version") {
+		t.Errorf("tool_version written without a version: %s", data)
+	}
+
+	opts.Output.Version = "1.2.3 (commit abc1234, built 2024-03-05T09:04:02Z, go1.23.0)"
+	data, err := json.Marshal(Build(opts, result))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `"tool_version":"1.2.3 (commit abc1234, built 2024-03-05T09:04:02Z, go1.23.0)"`; !strings.Contains(string(data), want) {
+		t.Errorf("report lacks %s: %s", want, data)
+	}
+}
@@ -0,0 +1,72 @@
+package report
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Fail policy kinds, as written before the '>' of a policy.
+const (
+	FailOnAny     = "any"
+	FailOnRegions = "regions"
+	FailOnRatio   = "ratio"
+)
+
+// FailPolicy decides from the report of one comparison whether it fails
+// --exit-on-diff: on any difference (HasDiff, the default), or only when the
+// number of regions or the diff ratio exceeds Limit.
+type FailPolicy struct {
+	Kind  string
+	Limit float64
+}
+
+// ParseFailPolicy parses "any", "regions>N" (N a non-negative count) or
+// "ratio>X" (X a fraction of the compared pixels between 0 and 1).
+func ParseFailPolicy(s string) (FailPolicy, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || s == FailOnAny {
+		return FailPolicy{Kind: FailOnAny}, nil
+	}
+	kind, limit, ok := strings.Cut(s, ">")
+	kind, limit = strings.TrimSpace(kind), strings.TrimSpace(limit)
+	switch {
+	case !ok:
+	case kind == FailOnRegions:
+		if n, err := strconv.Atoi(limit); err == nil && n >= 0 {
+			return FailPolicy{Kind: kind, Limit: float64(n)}, nil
+		}
+		return FailPolicy{}, fmt.Errorf("invalid fail policy '%s': the region count must be a non-negative integer", s)
+	case kind == FailOnRatio:
+		if x, err := strconv.ParseFloat(limit, 64); err == nil && x >= 0 && x <= 1 {
+			return FailPolicy{Kind: kind, Limit: x}, nil
+		}
+		return FailPolicy{}, fmt.Errorf("invalid fail policy '%s': the ratio must be between 0 and 1 (e.g. ratio>0.001)", s)
+	}
+	return FailPolicy{}, fmt.Errorf("invalid fail policy '%s'. Must be 'any', 'regions>N' or 'ratio>X'", s)
+}
+
+// NeedsRegions reports whether the policy needs every region and the full
+// diff ratio, rather than stopping at the first differing pixel.
+func (p FailPolicy) NeedsRegions() bool {
+	return p.Kind == FailOnRegions || p.Kind == FailOnRatio
+}
+
+// Fails reports whether the comparison reported by r fails the policy.
+func (p FailPolicy) Fails(r *Report) bool {
+	switch p.Kind {
+	case FailOnRegions:
+		return float64(len(r.Regions)) > p.Limit
+	case FailOnRatio:
+		return r.DiffRatio > p.Limit
+	}
+	return r.HasDiff
+}
+
+// String returns the policy in the form ParseFailPolicy accepts.
+func (p FailPolicy) String() string {
+	if p.Kind == FailOnAny || p.Kind == "" {
+		return FailOnAny
+	}
+	return fmt.Sprintf("%s>%v", p.Kind, p.Limit)
+}
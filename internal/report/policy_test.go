@@ -0,0 +1,66 @@
+package report
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseFailPolicy(t *testing.T) {
+	tests := []struct {
+		in   string
+		want FailPolicy
+		err  string
+	}{
+		{in: "", want: FailPolicy{Kind: FailOnAny}},
+		{in: "any", want: FailPolicy{Kind: FailOnAny}},
+		{in: "regions>3", want: FailPolicy{Kind: FailOnRegions, Limit: 3}},
+		{in: " ratio > 0.001 ", want: FailPolicy{Kind: FailOnRatio, Limit: 0.001}},
+		{in: "regions>-1", err: "non-negative integer"},
+		{in: "regions>1.5", err: "non-negative integer"},
+		{in: "ratio>2", err: "between 0 and 1"},
+		{in: "pixels>10", err: "Must be 'any', 'regions>N' or 'ratio>X'"},
+		{in: "regions", err: "Must be 'any', 'regions>N' or 'ratio>X'"},
+	}
+	for _, tt := range tests {
+		got, err := ParseFailPolicy(tt.in)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("ParseFailPolicy(%q) error = %v, want %q", tt.in, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ParseFailPolicy(%q) = %+v, %v, want %+v", tt.in, got, err, tt.want)
+		}
+		if back, _ := ParseFailPolicy(got.String()); back != got {
+			t.Errorf("%q does not round-trip through String() = %q", tt.in, got.String())
+		}
+	}
+}
+
+func TestFailPolicy_Fails(t *testing.T) {
+	noisy := &Report{HasDiff: true, DiffRatio: 0.0005, Regions: make([]Region, 2)}
+	same := &Report{}
+	tests := []struct {
+		policy      string
+		noisy, same bool
+	}{
+		{"any", true, false},
+		{"regions>1", true, false},
+		{"regions>2", false, false},
+		{"ratio>0.0001", true, false},
+		{"ratio>0.001", false, false},
+	}
+	for _, tt := range tests {
+		p, err := ParseFailPolicy(tt.policy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := p.Fails(noisy); got != tt.noisy {
+			t.Errorf("%s: Fails(noisy) = %v, want %v", tt.policy, got, tt.noisy)
+		}
+		if got := p.Fails(same); got != tt.same {
+			t.Errorf("%s: Fails(same) = %v, want %v", tt.policy, got, tt.same)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// SchemaVersion is the version of the report formats written by this package.
+// It is recorded in every JSON report, CSV file and HTML page. Adding optional
+// fields keeps the version; removing, renaming or retyping fields, or making
+// an optional field required, increments it.
+const SchemaVersion = 1
+
+// schemaID identifies the JSON Schema of the current report version.
+var schemaID = fmt.Sprintf("https://github.com/xshoji/go-img-diff/schema/report-v%d.json", SchemaVersion)
+
+// Schema returns the JSON Schema (draft 2020-12) of Report, generated from
+// its struct fields. Fields without omitempty are required. Unknown
+// properties are allowed, so consumers keep validating newer reports of the
+// same version.
+func Schema() map[string]any {
+	s := typeSchema(reflect.TypeOf(Report{}))
+	s["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	s["$id"] = schemaID
+	s["title"] = "imgdiff JSON report"
+	return s
+}
+
+// WriteSchema writes Schema as indented JSON.
+func WriteSchema(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(Schema()); err != nil {
+		return fmt.Errorf("failed to encode json schema: %w", err)
+	}
+	return nil
+}
+
+func typeSchema(t reflect.Type) map[string]any {
+	switch t.Kind() {
+	case reflect.Pointer:
+		return typeSchema(t.Elem())
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": typeSchema(t.Elem())}
+	case reflect.Struct:
+		properties := map[string]any{}
+		required := []string{}
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+			if !f.IsExported() || name == "-" {
+				continue
+			}
+			if name == "" {
+				name = f.Name
+			}
+			properties[name] = typeSchema(f.Type)
+			if !strings.Contains(opts, "omitempty") {
+				required = append(required, name)
+			}
+		}
+		return map[string]any{"type": "object", "properties": properties, "required": required}
+	}
+	panic(fmt.Sprintf("report: no schema for %s", t))
+}
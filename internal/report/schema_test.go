@@ -0,0 +1,204 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/xshoji/go-img-diff/internal/core"
+)
+
+// goldenSchema loads the schema recorded when the given version was released.
+func goldenSchema(t *testing.T, version int) map[string]any {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", fmt.Sprintf("schema-v%d.json", version)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var s map[string]any
+	if err := json.Unmarshal(data, &s); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// currentSchema returns Schema as decoded JSON, like a consumer sees it.
+func currentSchema(t *testing.T) map[string]any {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := WriteSchema(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var s map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &s); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// validate checks v against the subset of JSON Schema emitted by Schema.
+// With strict set, properties missing from the schema are reported too.
+func validate(schema map[string]any, v any, path string, strict bool) []string {
+	var errs []string
+	switch schema["type"] {
+	case "object":
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return []string{fmt.Sprintf("%s: want object, got %T", path, v)}
+		}
+		for _, name := range schema["required"].([]any) {
+			if _, ok := obj[name.(string)]; !ok {
+				errs = append(errs, fmt.Sprintf("%s: missing required property %q", path, name))
+			}
+		}
+		properties := schema["properties"].(map[string]any)
+		for name, pv := range obj {
+			ps, ok := properties[name]
+			if !ok {
+				if strict {
+					errs = append(errs, fmt.Sprintf("%s: property %q is not in the schema", path, name))
+				}
+				continue
+			}
+			errs = append(errs, validate(ps.(map[string]any), pv, path+"."+name, strict)...)
+		}
+	case "array":
+		arr, ok := v.([]any)
+		if !ok {
+			return []string{fmt.Sprintf("%s: want array, got %T", path, v)}
+		}
+		for i, item := range arr {
+			errs = append(errs, validate(schema["items"].(map[string]any), item, fmt.Sprintf("%s[%d]", path, i), strict)...)
+		}
+	case "integer":
+		if n, ok := v.(float64); !ok || n != math.Trunc(n) {
+			errs = append(errs, fmt.Sprintf("%s: want integer, got %v", path, v))
+		}
+	case "number":
+		if _, ok := v.(float64); !ok {
+			errs = append(errs, fmt.Sprintf("%s: want number, got %T", path, v))
+		}
+	case "string":
+		if _, ok := v.(string); !ok {
+			errs = append(errs, fmt.Sprintf("%s: want string, got %T", path, v))
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			errs = append(errs, fmt.Sprintf("%s: want boolean, got %T", path, v))
+		}
+	default:
+		errs = append(errs, fmt.Sprintf("%s: unsupported schema type %v", path, schema["type"]))
+	}
+	return errs
+}
+
+// compatible reports the changes from old to cur that break consumers of old:
+// removed or retyped properties and newly required ones.
+func compatible(old, cur map[string]any, path string) []string {
+	if old["type"] != cur["type"] {
+		return []string{fmt.Sprintf("%s: type changed from %v to %v", path, old["type"], cur["type"])}
+	}
+	var errs []string
+	switch old["type"] {
+	case "object":
+		oldRequired := old["required"].([]any)
+		for _, name := range cur["required"].([]any) {
+			if !slices.Contains(oldRequired, name) {
+				errs = append(errs, fmt.Sprintf("%s: property %q became required", path, name))
+			}
+		}
+		curProperties := cur["properties"].(map[string]any)
+		for name, op := range old["properties"].(map[string]any) {
+			cp, ok := curProperties[name]
+			if !ok {
+				errs = append(errs, fmt.Sprintf("%s: property %q was removed", path, name))
+				continue
+			}
+			errs = append(errs, compatible(op.(map[string]any), cp.(map[string]any), path+"."+name)...)
+		}
+	case "array":
+		errs = append(errs, compatible(old["items"].(map[string]any), cur["items"].(map[string]any), path+"[]")...)
+	}
+	return errs
+}
+
+func TestSchema_MatchesBuild(t *testing.T) {
+	frame := core.NewFrame(image.NewNRGBA(image.Rect(0, 0, 100, 50)))
+	result := &core.Result{
+		FrameA:  frame,
+		FrameB:  frame,
+		Aligned: core.Alignment{DX: -4, Score: 0.99, RunnerUp: core.OffsetScore{DX: -6, Score: 0.9}, Confidence: 3},
+		HasDiff: true,
+		Regions: []core.Region{{Bounds: image.Rect(10, 10, 20, 20), Area: 50}},
+	}
+	opts := core.DefaultOptions()
+	opts.Align.MaxAcceptableOffset = 8
+	r := Build(opts, result)
+	r.CompareWith(&Report{}, "previous.json")
+	r.Phases = []Phase{{Phase: "align", DurationMS: 1}}
+
+	data, err := json.Marshal(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v any
+	if err := json.Unmarshal(data, &v); err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range validate(currentSchema(t), v, "$", true) {
+		t.Error(e)
+	}
+	if r.SchemaVersion != SchemaVersion {
+		t.Errorf("schema_version = %d, want %d", r.SchemaVersion, SchemaVersion)
+	}
+}
+
+func TestSchema_CompatibleWithRelease(t *testing.T) {
+	golden := goldenSchema(t, SchemaVersion)
+	if want := golden["$id"]; want != schemaID {
+		t.Errorf("$id = %v, want %v", schemaID, want)
+	}
+	for _, e := range compatible(golden, currentSchema(t), "$") {
+		t.Errorf("%s; increment SchemaVersion and add testdata/schema-v%d.json", e, SchemaVersion+1)
+	}
+}
+
+func TestSchema_GoldenReports(t *testing.T) {
+	paths, err := filepath.Glob(filepath.Join("testdata", "report-v*.json"))
+	if err != nil || len(paths) == 0 {
+		t.Fatalf("no golden reports: %v", err)
+	}
+	for _, path := range paths {
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var v map[string]any
+			if err := json.Unmarshal(data, &v); err != nil {
+				t.Fatal(err)
+			}
+			version := int(v["schema_version"].(float64))
+			if version != SchemaVersion {
+				t.Skipf("report of schema version %d", version)
+			}
+			// Strict: the golden report uses every property of its release,
+			// so a removed property shows up here as well.
+			for _, e := range validate(currentSchema(t), v, "$", true) {
+				t.Error(e)
+			}
+			for _, e := range validate(goldenSchema(t, version), v, "$", true) {
+				t.Error(e)
+			}
+			if _, err := Load(path); err != nil {
+				t.Errorf("Load: %v", err)
+			}
+		})
+	}
+}